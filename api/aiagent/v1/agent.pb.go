@@ -0,0 +1,1770 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: aiagent/v1/agent.proto
+
+package agentv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SubmitRunRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Input string                 `protobuf:"bytes,1,opt,name=input,proto3" json:"input,omitempty"`
+	// Session of the conversation history, "default" if empty
+	Session string `protobuf:"bytes,2,opt,name=session,proto3" json:"session,omitempty"`
+	// Continue the conversation of the session
+	Continue bool `protobuf:"varint,3,opt,name=continue,proto3" json:"continue,omitempty"`
+	// Every command waits for an answer to Approve before it runs
+	RequireApproval bool `protobuf:"varint,4,opt,name=require_approval,json=requireApproval,proto3" json:"require_approval,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *SubmitRunRequest) Reset() {
+	*x = SubmitRunRequest{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitRunRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitRunRequest) ProtoMessage() {}
+
+func (x *SubmitRunRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitRunRequest.ProtoReflect.Descriptor instead.
+func (*SubmitRunRequest) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubmitRunRequest) GetInput() string {
+	if x != nil {
+		return x.Input
+	}
+	return ""
+}
+
+func (x *SubmitRunRequest) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *SubmitRunRequest) GetContinue() bool {
+	if x != nil {
+		return x.Continue
+	}
+	return false
+}
+
+func (x *SubmitRunRequest) GetRequireApproval() bool {
+	if x != nil {
+		return x.RequireApproval
+	}
+	return false
+}
+
+type GetRunRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRunRequest) Reset() {
+	*x = GetRunRequest{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRunRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRunRequest) ProtoMessage() {}
+
+func (x *GetRunRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRunRequest.ProtoReflect.Descriptor instead.
+func (*GetRunRequest) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetRunRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListRunsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Maximum number of runs, 50 if 0
+	Limit         int32 `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRunsRequest) Reset() {
+	*x = ListRunsRequest{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRunsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRunsRequest) ProtoMessage() {}
+
+func (x *ListRunsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRunsRequest.ProtoReflect.Descriptor instead.
+func (*ListRunsRequest) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListRunsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListRunsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Runs          []*Run                 `protobuf:"bytes,1,rep,name=runs,proto3" json:"runs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRunsResponse) Reset() {
+	*x = ListRunsResponse{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRunsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRunsResponse) ProtoMessage() {}
+
+func (x *ListRunsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRunsResponse.ProtoReflect.Descriptor instead.
+func (*ListRunsResponse) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListRunsResponse) GetRuns() []*Run {
+	if x != nil {
+		return x.Runs
+	}
+	return nil
+}
+
+type PendingApproval struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Command       string                 `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PendingApproval) Reset() {
+	*x = PendingApproval{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PendingApproval) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PendingApproval) ProtoMessage() {}
+
+func (x *PendingApproval) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PendingApproval.ProtoReflect.Descriptor instead.
+func (*PendingApproval) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PendingApproval) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PendingApproval) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+type Run struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// queued, running, completed, failed or canceled
+	Status  string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Input   string `protobuf:"bytes,3,opt,name=input,proto3" json:"input,omitempty"`
+	Session string `protobuf:"bytes,4,opt,name=session,proto3" json:"session,omitempty"`
+	Result  string `protobuf:"bytes,5,opt,name=result,proto3" json:"result,omitempty"`
+	Error   string `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	// Exit code of the command line for the error of a failed run
+	ExitCode         int32                  `protobuf:"varint,7,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	CreatedAt        *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	StartedAt        *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt       *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	PendingApprovals []*PendingApproval     `protobuf:"bytes,11,rep,name=pending_approvals,json=pendingApprovals,proto3" json:"pending_approvals,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Run) Reset() {
+	*x = Run{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Run) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Run) ProtoMessage() {}
+
+func (x *Run) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Run.ProtoReflect.Descriptor instead.
+func (*Run) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Run) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Run) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Run) GetInput() string {
+	if x != nil {
+		return x.Input
+	}
+	return ""
+}
+
+func (x *Run) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *Run) GetResult() string {
+	if x != nil {
+		return x.Result
+	}
+	return ""
+}
+
+func (x *Run) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Run) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *Run) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Run) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Run) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Run) GetPendingApprovals() []*PendingApproval {
+	if x != nil {
+		return x.PendingApprovals
+	}
+	return nil
+}
+
+type CancelRunRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelRunRequest) Reset() {
+	*x = CancelRunRequest{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelRunRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelRunRequest) ProtoMessage() {}
+
+func (x *CancelRunRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelRunRequest.ProtoReflect.Descriptor instead.
+func (*CancelRunRequest) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CancelRunRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type StreamEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RunId         string                 `protobuf:"bytes,1,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamEventsRequest) GetRunId() string {
+	if x != nil {
+		return x.RunId
+	}
+	return ""
+}
+
+// RunEvent is one lifecycle event of a run, see pkg/events
+type RunEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	RunId string                 `protobuf:"bytes,1,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	Time  *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*RunEvent_RunStarted
+	//	*RunEvent_NodeStarted
+	//	*RunEvent_NodeFinished
+	//	*RunEvent_CommandProposed
+	//	*RunEvent_ApprovalRequested
+	//	*RunEvent_ApprovalPending
+	//	*RunEvent_ApprovalAnswered
+	//	*RunEvent_CommandRejected
+	//	*RunEvent_CommandExecuted
+	//	*RunEvent_RunFinished
+	//	*RunEvent_Decision
+	Event         isRunEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunEvent) Reset() {
+	*x = RunEvent{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunEvent) ProtoMessage() {}
+
+func (x *RunEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunEvent.ProtoReflect.Descriptor instead.
+func (*RunEvent) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RunEvent) GetRunId() string {
+	if x != nil {
+		return x.RunId
+	}
+	return ""
+}
+
+func (x *RunEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *RunEvent) GetEvent() isRunEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *RunEvent) GetRunStarted() *RunStarted {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_RunStarted); ok {
+			return x.RunStarted
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetNodeStarted() *NodeStarted {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_NodeStarted); ok {
+			return x.NodeStarted
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetNodeFinished() *NodeFinished {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_NodeFinished); ok {
+			return x.NodeFinished
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetCommandProposed() *CommandProposed {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_CommandProposed); ok {
+			return x.CommandProposed
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetApprovalRequested() *ApprovalRequested {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_ApprovalRequested); ok {
+			return x.ApprovalRequested
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetApprovalPending() *ApprovalPending {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_ApprovalPending); ok {
+			return x.ApprovalPending
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetApprovalAnswered() *ApprovalAnswered {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_ApprovalAnswered); ok {
+			return x.ApprovalAnswered
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetCommandRejected() *CommandRejected {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_CommandRejected); ok {
+			return x.CommandRejected
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetCommandExecuted() *CommandExecuted {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_CommandExecuted); ok {
+			return x.CommandExecuted
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetRunFinished() *RunFinished {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_RunFinished); ok {
+			return x.RunFinished
+		}
+	}
+	return nil
+}
+
+func (x *RunEvent) GetDecision() *Decision {
+	if x != nil {
+		if x, ok := x.Event.(*RunEvent_Decision); ok {
+			return x.Decision
+		}
+	}
+	return nil
+}
+
+type isRunEvent_Event interface {
+	isRunEvent_Event()
+}
+
+type RunEvent_RunStarted struct {
+	RunStarted *RunStarted `protobuf:"bytes,10,opt,name=run_started,json=runStarted,proto3,oneof"`
+}
+
+type RunEvent_NodeStarted struct {
+	NodeStarted *NodeStarted `protobuf:"bytes,11,opt,name=node_started,json=nodeStarted,proto3,oneof"`
+}
+
+type RunEvent_NodeFinished struct {
+	NodeFinished *NodeFinished `protobuf:"bytes,12,opt,name=node_finished,json=nodeFinished,proto3,oneof"`
+}
+
+type RunEvent_CommandProposed struct {
+	CommandProposed *CommandProposed `protobuf:"bytes,13,opt,name=command_proposed,json=commandProposed,proto3,oneof"`
+}
+
+type RunEvent_ApprovalRequested struct {
+	ApprovalRequested *ApprovalRequested `protobuf:"bytes,14,opt,name=approval_requested,json=approvalRequested,proto3,oneof"`
+}
+
+type RunEvent_ApprovalPending struct {
+	ApprovalPending *ApprovalPending `protobuf:"bytes,15,opt,name=approval_pending,json=approvalPending,proto3,oneof"`
+}
+
+type RunEvent_ApprovalAnswered struct {
+	ApprovalAnswered *ApprovalAnswered `protobuf:"bytes,16,opt,name=approval_answered,json=approvalAnswered,proto3,oneof"`
+}
+
+type RunEvent_CommandRejected struct {
+	CommandRejected *CommandRejected `protobuf:"bytes,17,opt,name=command_rejected,json=commandRejected,proto3,oneof"`
+}
+
+type RunEvent_CommandExecuted struct {
+	CommandExecuted *CommandExecuted `protobuf:"bytes,18,opt,name=command_executed,json=commandExecuted,proto3,oneof"`
+}
+
+type RunEvent_RunFinished struct {
+	RunFinished *RunFinished `protobuf:"bytes,19,opt,name=run_finished,json=runFinished,proto3,oneof"`
+}
+
+type RunEvent_Decision struct {
+	Decision *Decision `protobuf:"bytes,20,opt,name=decision,proto3,oneof"`
+}
+
+func (*RunEvent_RunStarted) isRunEvent_Event() {}
+
+func (*RunEvent_NodeStarted) isRunEvent_Event() {}
+
+func (*RunEvent_NodeFinished) isRunEvent_Event() {}
+
+func (*RunEvent_CommandProposed) isRunEvent_Event() {}
+
+func (*RunEvent_ApprovalRequested) isRunEvent_Event() {}
+
+func (*RunEvent_ApprovalPending) isRunEvent_Event() {}
+
+func (*RunEvent_ApprovalAnswered) isRunEvent_Event() {}
+
+func (*RunEvent_CommandRejected) isRunEvent_Event() {}
+
+func (*RunEvent_CommandExecuted) isRunEvent_Event() {}
+
+func (*RunEvent_RunFinished) isRunEvent_Event() {}
+
+func (*RunEvent_Decision) isRunEvent_Event() {}
+
+type RunStarted struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Session       string                 `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
+	Input         string                 `protobuf:"bytes,2,opt,name=input,proto3" json:"input,omitempty"`
+	Dir           string                 `protobuf:"bytes,3,opt,name=dir,proto3" json:"dir,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunStarted) Reset() {
+	*x = RunStarted{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunStarted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunStarted) ProtoMessage() {}
+
+func (x *RunStarted) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunStarted.ProtoReflect.Descriptor instead.
+func (*RunStarted) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RunStarted) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *RunStarted) GetInput() string {
+	if x != nil {
+		return x.Input
+	}
+	return ""
+}
+
+func (x *RunStarted) GetDir() string {
+	if x != nil {
+		return x.Dir
+	}
+	return ""
+}
+
+type NodeStarted struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Node          string                 `protobuf:"bytes,1,opt,name=node,proto3" json:"node,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NodeStarted) Reset() {
+	*x = NodeStarted{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeStarted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeStarted) ProtoMessage() {}
+
+func (x *NodeStarted) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeStarted.ProtoReflect.Descriptor instead.
+func (*NodeStarted) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *NodeStarted) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+type NodeFinished struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Node          string                 `protobuf:"bytes,1,opt,name=node,proto3" json:"node,omitempty"`
+	NextNode      string                 `protobuf:"bytes,2,opt,name=next_node,json=nextNode,proto3" json:"next_node,omitempty"`
+	Duration      *durationpb.Duration   `protobuf:"bytes,3,opt,name=duration,proto3" json:"duration,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NodeFinished) Reset() {
+	*x = NodeFinished{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeFinished) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeFinished) ProtoMessage() {}
+
+func (x *NodeFinished) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeFinished.ProtoReflect.Descriptor instead.
+func (*NodeFinished) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *NodeFinished) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *NodeFinished) GetNextNode() string {
+	if x != nil {
+		return x.NextNode
+	}
+	return ""
+}
+
+func (x *NodeFinished) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *NodeFinished) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type CommandProposed struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
+	Explanation   string                 `protobuf:"bytes,2,opt,name=explanation,proto3" json:"explanation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandProposed) Reset() {
+	*x = CommandProposed{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandProposed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandProposed) ProtoMessage() {}
+
+func (x *CommandProposed) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandProposed.ProtoReflect.Descriptor instead.
+func (*CommandProposed) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *CommandProposed) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *CommandProposed) GetExplanation() string {
+	if x != nil {
+		return x.Explanation
+	}
+	return ""
+}
+
+type ApprovalRequested struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
+	Policy        string                 `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApprovalRequested) Reset() {
+	*x = ApprovalRequested{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApprovalRequested) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApprovalRequested) ProtoMessage() {}
+
+func (x *ApprovalRequested) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApprovalRequested.ProtoReflect.Descriptor instead.
+func (*ApprovalRequested) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ApprovalRequested) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *ApprovalRequested) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+type ApprovalPending struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Answered with ApproveRequest.approval_id
+	Id      string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Command string `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	// Set when a risky command waits for the review of another person
+	Rating        string `protobuf:"bytes,3,opt,name=rating,proto3" json:"rating,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApprovalPending) Reset() {
+	*x = ApprovalPending{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApprovalPending) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApprovalPending) ProtoMessage() {}
+
+func (x *ApprovalPending) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApprovalPending.ProtoReflect.Descriptor instead.
+func (*ApprovalPending) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ApprovalPending) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ApprovalPending) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *ApprovalPending) GetRating() string {
+	if x != nil {
+		return x.Rating
+	}
+	return ""
+}
+
+type ApprovalAnswered struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Id       string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Command  string                 `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	Approved bool                   `protobuf:"varint,3,opt,name=approved,proto3" json:"approved,omitempty"`
+	Error    string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	// The person who reviewed a risky command
+	By            string `protobuf:"bytes,5,opt,name=by,proto3" json:"by,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApprovalAnswered) Reset() {
+	*x = ApprovalAnswered{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApprovalAnswered) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApprovalAnswered) ProtoMessage() {}
+
+func (x *ApprovalAnswered) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApprovalAnswered.ProtoReflect.Descriptor instead.
+func (*ApprovalAnswered) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ApprovalAnswered) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ApprovalAnswered) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *ApprovalAnswered) GetApproved() bool {
+	if x != nil {
+		return x.Approved
+	}
+	return false
+}
+
+func (x *ApprovalAnswered) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ApprovalAnswered) GetBy() string {
+	if x != nil {
+		return x.By
+	}
+	return ""
+}
+
+type CommandRejected struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
+	Reason        string                 `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandRejected) Reset() {
+	*x = CommandRejected{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandRejected) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandRejected) ProtoMessage() {}
+
+func (x *CommandRejected) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandRejected.ProtoReflect.Descriptor instead.
+func (*CommandRejected) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *CommandRejected) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *CommandRejected) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type CommandExecuted struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
+	ExitCode      int32                  `protobuf:"varint,2,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	Duration      *durationpb.Duration   `protobuf:"bytes,3,opt,name=duration,proto3" json:"duration,omitempty"`
+	Output        string                 `protobuf:"bytes,4,opt,name=output,proto3" json:"output,omitempty"`
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandExecuted) Reset() {
+	*x = CommandExecuted{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandExecuted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandExecuted) ProtoMessage() {}
+
+func (x *CommandExecuted) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandExecuted.ProtoReflect.Descriptor instead.
+func (*CommandExecuted) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *CommandExecuted) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *CommandExecuted) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *CommandExecuted) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *CommandExecuted) GetOutput() string {
+	if x != nil {
+		return x.Output
+	}
+	return ""
+}
+
+func (x *CommandExecuted) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Decision is a decision a node made with the LLM, e.g. the node the classifier routed to
+type Decision struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Node  string                 `protobuf:"bytes,1,opt,name=node,proto3" json:"node,omitempty"`
+	// route, task_done, goal_met, content_needs, validation, plan or review
+	Kind          string `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	Choice        string `protobuf:"bytes,3,opt,name=choice,proto3" json:"choice,omitempty"`
+	Explanation   string `protobuf:"bytes,4,opt,name=explanation,proto3" json:"explanation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Decision) Reset() {
+	*x = Decision{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Decision) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Decision) ProtoMessage() {}
+
+func (x *Decision) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Decision.ProtoReflect.Descriptor instead.
+func (*Decision) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *Decision) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *Decision) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *Decision) GetChoice() string {
+	if x != nil {
+		return x.Choice
+	}
+	return ""
+}
+
+func (x *Decision) GetExplanation() string {
+	if x != nil {
+		return x.Explanation
+	}
+	return ""
+}
+
+type RunFinished struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Result   string                 `protobuf:"bytes,1,opt,name=result,proto3" json:"result,omitempty"`
+	Error    string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	Duration *durationpb.Duration   `protobuf:"bytes,3,opt,name=duration,proto3" json:"duration,omitempty"`
+	// Cost of the run in USD; unset when the price of the model is unknown
+	Cost          *float64 `protobuf:"fixed64,4,opt,name=cost,proto3,oneof" json:"cost,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunFinished) Reset() {
+	*x = RunFinished{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunFinished) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunFinished) ProtoMessage() {}
+
+func (x *RunFinished) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunFinished.ProtoReflect.Descriptor instead.
+func (*RunFinished) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *RunFinished) GetResult() string {
+	if x != nil {
+		return x.Result
+	}
+	return ""
+}
+
+func (x *RunFinished) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *RunFinished) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *RunFinished) GetCost() float64 {
+	if x != nil && x.Cost != nil {
+		return *x.Cost
+	}
+	return 0
+}
+
+type ApproveRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RunId         string                 `protobuf:"bytes,1,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	ApprovalId    string                 `protobuf:"bytes,2,opt,name=approval_id,json=approvalId,proto3" json:"approval_id,omitempty"`
+	Approved      bool                   `protobuf:"varint,3,opt,name=approved,proto3" json:"approved,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApproveRequest) Reset() {
+	*x = ApproveRequest{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApproveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApproveRequest) ProtoMessage() {}
+
+func (x *ApproveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApproveRequest.ProtoReflect.Descriptor instead.
+func (*ApproveRequest) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ApproveRequest) GetRunId() string {
+	if x != nil {
+		return x.RunId
+	}
+	return ""
+}
+
+func (x *ApproveRequest) GetApprovalId() string {
+	if x != nil {
+		return x.ApprovalId
+	}
+	return ""
+}
+
+func (x *ApproveRequest) GetApproved() bool {
+	if x != nil {
+		return x.Approved
+	}
+	return false
+}
+
+type ApproveResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ApprovalId    string                 `protobuf:"bytes,1,opt,name=approval_id,json=approvalId,proto3" json:"approval_id,omitempty"`
+	Approved      bool                   `protobuf:"varint,2,opt,name=approved,proto3" json:"approved,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApproveResponse) Reset() {
+	*x = ApproveResponse{}
+	mi := &file_aiagent_v1_agent_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApproveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApproveResponse) ProtoMessage() {}
+
+func (x *ApproveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_aiagent_v1_agent_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApproveResponse.ProtoReflect.Descriptor instead.
+func (*ApproveResponse) Descriptor() ([]byte, []int) {
+	return file_aiagent_v1_agent_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ApproveResponse) GetApprovalId() string {
+	if x != nil {
+		return x.ApprovalId
+	}
+	return ""
+}
+
+func (x *ApproveResponse) GetApproved() bool {
+	if x != nil {
+		return x.Approved
+	}
+	return false
+}
+
+var File_aiagent_v1_agent_proto protoreflect.FileDescriptor
+
+const file_aiagent_v1_agent_proto_rawDesc = "" +
+	"\n" +
+	"\x16aiagent/v1/agent.proto\x12\n" +
+	"aiagent.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x89\x01\n" +
+	"\x10SubmitRunRequest\x12\x14\n" +
+	"\x05input\x18\x01 \x01(\tR\x05input\x12\x18\n" +
+	"\asession\x18\x02 \x01(\tR\asession\x12\x1a\n" +
+	"\bcontinue\x18\x03 \x01(\bR\bcontinue\x12)\n" +
+	"\x10require_approval\x18\x04 \x01(\bR\x0frequireApproval\"\x1f\n" +
+	"\rGetRunRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"'\n" +
+	"\x0fListRunsRequest\x12\x14\n" +
+	"\x05limit\x18\x01 \x01(\x05R\x05limit\"7\n" +
+	"\x10ListRunsResponse\x12#\n" +
+	"\x04runs\x18\x01 \x03(\v2\x0f.aiagent.v1.RunR\x04runs\";\n" +
+	"\x0fPendingApproval\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\"\xa5\x03\n" +
+	"\x03Run\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x14\n" +
+	"\x05input\x18\x03 \x01(\tR\x05input\x12\x18\n" +
+	"\asession\x18\x04 \x01(\tR\asession\x12\x16\n" +
+	"\x06result\x18\x05 \x01(\tR\x06result\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x12\x1b\n" +
+	"\texit_code\x18\a \x01(\x05R\bexitCode\x129\n" +
+	"\n" +
+	"created_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"started_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n" +
+	"\vfinished_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12H\n" +
+	"\x11pending_approvals\x18\v \x03(\v2\x1b.aiagent.v1.PendingApprovalR\x10pendingApprovals\"\"\n" +
+	"\x10CancelRunRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\",\n" +
+	"\x13StreamEventsRequest\x12\x15\n" +
+	"\x06run_id\x18\x01 \x01(\tR\x05runId\"\xcb\x06\n" +
+	"\bRunEvent\x12\x15\n" +
+	"\x06run_id\x18\x01 \x01(\tR\x05runId\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x129\n" +
+	"\vrun_started\x18\n" +
+	" \x01(\v2\x16.aiagent.v1.RunStartedH\x00R\n" +
+	"runStarted\x12<\n" +
+	"\fnode_started\x18\v \x01(\v2\x17.aiagent.v1.NodeStartedH\x00R\vnodeStarted\x12?\n" +
+	"\rnode_finished\x18\f \x01(\v2\x18.aiagent.v1.NodeFinishedH\x00R\fnodeFinished\x12H\n" +
+	"\x10command_proposed\x18\r \x01(\v2\x1b.aiagent.v1.CommandProposedH\x00R\x0fcommandProposed\x12N\n" +
+	"\x12approval_requested\x18\x0e \x01(\v2\x1d.aiagent.v1.ApprovalRequestedH\x00R\x11approvalRequested\x12H\n" +
+	"\x10approval_pending\x18\x0f \x01(\v2\x1b.aiagent.v1.ApprovalPendingH\x00R\x0fapprovalPending\x12K\n" +
+	"\x11approval_answered\x18\x10 \x01(\v2\x1c.aiagent.v1.ApprovalAnsweredH\x00R\x10approvalAnswered\x12H\n" +
+	"\x10command_rejected\x18\x11 \x01(\v2\x1b.aiagent.v1.CommandRejectedH\x00R\x0fcommandRejected\x12H\n" +
+	"\x10command_executed\x18\x12 \x01(\v2\x1b.aiagent.v1.CommandExecutedH\x00R\x0fcommandExecuted\x12<\n" +
+	"\frun_finished\x18\x13 \x01(\v2\x17.aiagent.v1.RunFinishedH\x00R\vrunFinished\x122\n" +
+	"\bdecision\x18\x14 \x01(\v2\x14.aiagent.v1.DecisionH\x00R\bdecisionB\a\n" +
+	"\x05event\"N\n" +
+	"\n" +
+	"RunStarted\x12\x18\n" +
+	"\asession\x18\x01 \x01(\tR\asession\x12\x14\n" +
+	"\x05input\x18\x02 \x01(\tR\x05input\x12\x10\n" +
+	"\x03dir\x18\x03 \x01(\tR\x03dir\"!\n" +
+	"\vNodeStarted\x12\x12\n" +
+	"\x04node\x18\x01 \x01(\tR\x04node\"\x8c\x01\n" +
+	"\fNodeFinished\x12\x12\n" +
+	"\x04node\x18\x01 \x01(\tR\x04node\x12\x1b\n" +
+	"\tnext_node\x18\x02 \x01(\tR\bnextNode\x125\n" +
+	"\bduration\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\bduration\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"M\n" +
+	"\x0fCommandProposed\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12 \n" +
+	"\vexplanation\x18\x02 \x01(\tR\vexplanation\"E\n" +
+	"\x11ApprovalRequested\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12\x16\n" +
+	"\x06policy\x18\x02 \x01(\tR\x06policy\"S\n" +
+	"\x0fApprovalPending\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\x12\x16\n" +
+	"\x06rating\x18\x03 \x01(\tR\x06rating\"~\n" +
+	"\x10ApprovalAnswered\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\x12\x1a\n" +
+	"\bapproved\x18\x03 \x01(\bR\bapproved\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x0e\n" +
+	"\x02by\x18\x05 \x01(\tR\x02by\"C\n" +
+	"\x0fCommandRejected\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\"\xad\x01\n" +
+	"\x0fCommandExecuted\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\x12\x1b\n" +
+	"\texit_code\x18\x02 \x01(\x05R\bexitCode\x125\n" +
+	"\bduration\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\bduration\x12\x16\n" +
+	"\x06output\x18\x04 \x01(\tR\x06output\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"l\n" +
+	"\bDecision\x12\x12\n" +
+	"\x04node\x18\x01 \x01(\tR\x04node\x12\x12\n" +
+	"\x04kind\x18\x02 \x01(\tR\x04kind\x12\x16\n" +
+	"\x06choice\x18\x03 \x01(\tR\x06choice\x12 \n" +
+	"\vexplanation\x18\x04 \x01(\tR\vexplanation\"\x94\x01\n" +
+	"\vRunFinished\x12\x16\n" +
+	"\x06result\x18\x01 \x01(\tR\x06result\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x125\n" +
+	"\bduration\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\bduration\x12\x17\n" +
+	"\x04cost\x18\x04 \x01(\x01H\x00R\x04cost\x88\x01\x01B\a\n" +
+	"\x05_cost\"d\n" +
+	"\x0eApproveRequest\x12\x15\n" +
+	"\x06run_id\x18\x01 \x01(\tR\x05runId\x12\x1f\n" +
+	"\vapproval_id\x18\x02 \x01(\tR\n" +
+	"approvalId\x12\x1a\n" +
+	"\bapproved\x18\x03 \x01(\bR\bapproved\"N\n" +
+	"\x0fApproveResponse\x12\x1f\n" +
+	"\vapproval_id\x18\x01 \x01(\tR\n" +
+	"approvalId\x12\x1a\n" +
+	"\bapproved\x18\x02 \x01(\bR\bapproved2\x89\x03\n" +
+	"\x05Agent\x12:\n" +
+	"\tSubmitRun\x12\x1c.aiagent.v1.SubmitRunRequest\x1a\x0f.aiagent.v1.Run\x124\n" +
+	"\x06GetRun\x12\x19.aiagent.v1.GetRunRequest\x1a\x0f.aiagent.v1.Run\x12E\n" +
+	"\bListRuns\x12\x1b.aiagent.v1.ListRunsRequest\x1a\x1c.aiagent.v1.ListRunsResponse\x12G\n" +
+	"\fStreamEvents\x12\x1f.aiagent.v1.StreamEventsRequest\x1a\x14.aiagent.v1.RunEvent0\x01\x12B\n" +
+	"\aApprove\x12\x1a.aiagent.v1.ApproveRequest\x1a\x1b.aiagent.v1.ApproveResponse\x12:\n" +
+	"\tCancelRun\x12\x1c.aiagent.v1.CancelRunRequest\x1a\x0f.aiagent.v1.RunB Z\x1eaiagent/api/aiagent/v1;agentv1b\x06proto3"
+
+var (
+	file_aiagent_v1_agent_proto_rawDescOnce sync.Once
+	file_aiagent_v1_agent_proto_rawDescData []byte
+)
+
+func file_aiagent_v1_agent_proto_rawDescGZIP() []byte {
+	file_aiagent_v1_agent_proto_rawDescOnce.Do(func() {
+		file_aiagent_v1_agent_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_aiagent_v1_agent_proto_rawDesc), len(file_aiagent_v1_agent_proto_rawDesc)))
+	})
+	return file_aiagent_v1_agent_proto_rawDescData
+}
+
+var file_aiagent_v1_agent_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
+var file_aiagent_v1_agent_proto_goTypes = []any{
+	(*SubmitRunRequest)(nil),      // 0: aiagent.v1.SubmitRunRequest
+	(*GetRunRequest)(nil),         // 1: aiagent.v1.GetRunRequest
+	(*ListRunsRequest)(nil),       // 2: aiagent.v1.ListRunsRequest
+	(*ListRunsResponse)(nil),      // 3: aiagent.v1.ListRunsResponse
+	(*PendingApproval)(nil),       // 4: aiagent.v1.PendingApproval
+	(*Run)(nil),                   // 5: aiagent.v1.Run
+	(*CancelRunRequest)(nil),      // 6: aiagent.v1.CancelRunRequest
+	(*StreamEventsRequest)(nil),   // 7: aiagent.v1.StreamEventsRequest
+	(*RunEvent)(nil),              // 8: aiagent.v1.RunEvent
+	(*RunStarted)(nil),            // 9: aiagent.v1.RunStarted
+	(*NodeStarted)(nil),           // 10: aiagent.v1.NodeStarted
+	(*NodeFinished)(nil),          // 11: aiagent.v1.NodeFinished
+	(*CommandProposed)(nil),       // 12: aiagent.v1.CommandProposed
+	(*ApprovalRequested)(nil),     // 13: aiagent.v1.ApprovalRequested
+	(*ApprovalPending)(nil),       // 14: aiagent.v1.ApprovalPending
+	(*ApprovalAnswered)(nil),      // 15: aiagent.v1.ApprovalAnswered
+	(*CommandRejected)(nil),       // 16: aiagent.v1.CommandRejected
+	(*CommandExecuted)(nil),       // 17: aiagent.v1.CommandExecuted
+	(*Decision)(nil),              // 18: aiagent.v1.Decision
+	(*RunFinished)(nil),           // 19: aiagent.v1.RunFinished
+	(*ApproveRequest)(nil),        // 20: aiagent.v1.ApproveRequest
+	(*ApproveResponse)(nil),       // 21: aiagent.v1.ApproveResponse
+	(*timestamppb.Timestamp)(nil), // 22: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 23: google.protobuf.Duration
+}
+var file_aiagent_v1_agent_proto_depIdxs = []int32{
+	5,  // 0: aiagent.v1.ListRunsResponse.runs:type_name -> aiagent.v1.Run
+	22, // 1: aiagent.v1.Run.created_at:type_name -> google.protobuf.Timestamp
+	22, // 2: aiagent.v1.Run.started_at:type_name -> google.protobuf.Timestamp
+	22, // 3: aiagent.v1.Run.finished_at:type_name -> google.protobuf.Timestamp
+	4,  // 4: aiagent.v1.Run.pending_approvals:type_name -> aiagent.v1.PendingApproval
+	22, // 5: aiagent.v1.RunEvent.time:type_name -> google.protobuf.Timestamp
+	9,  // 6: aiagent.v1.RunEvent.run_started:type_name -> aiagent.v1.RunStarted
+	10, // 7: aiagent.v1.RunEvent.node_started:type_name -> aiagent.v1.NodeStarted
+	11, // 8: aiagent.v1.RunEvent.node_finished:type_name -> aiagent.v1.NodeFinished
+	12, // 9: aiagent.v1.RunEvent.command_proposed:type_name -> aiagent.v1.CommandProposed
+	13, // 10: aiagent.v1.RunEvent.approval_requested:type_name -> aiagent.v1.ApprovalRequested
+	14, // 11: aiagent.v1.RunEvent.approval_pending:type_name -> aiagent.v1.ApprovalPending
+	15, // 12: aiagent.v1.RunEvent.approval_answered:type_name -> aiagent.v1.ApprovalAnswered
+	16, // 13: aiagent.v1.RunEvent.command_rejected:type_name -> aiagent.v1.CommandRejected
+	17, // 14: aiagent.v1.RunEvent.command_executed:type_name -> aiagent.v1.CommandExecuted
+	19, // 15: aiagent.v1.RunEvent.run_finished:type_name -> aiagent.v1.RunFinished
+	18, // 16: aiagent.v1.RunEvent.decision:type_name -> aiagent.v1.Decision
+	23, // 17: aiagent.v1.NodeFinished.duration:type_name -> google.protobuf.Duration
+	23, // 18: aiagent.v1.CommandExecuted.duration:type_name -> google.protobuf.Duration
+	23, // 19: aiagent.v1.RunFinished.duration:type_name -> google.protobuf.Duration
+	0,  // 20: aiagent.v1.Agent.SubmitRun:input_type -> aiagent.v1.SubmitRunRequest
+	1,  // 21: aiagent.v1.Agent.GetRun:input_type -> aiagent.v1.GetRunRequest
+	2,  // 22: aiagent.v1.Agent.ListRuns:input_type -> aiagent.v1.ListRunsRequest
+	7,  // 23: aiagent.v1.Agent.StreamEvents:input_type -> aiagent.v1.StreamEventsRequest
+	20, // 24: aiagent.v1.Agent.Approve:input_type -> aiagent.v1.ApproveRequest
+	6,  // 25: aiagent.v1.Agent.CancelRun:input_type -> aiagent.v1.CancelRunRequest
+	5,  // 26: aiagent.v1.Agent.SubmitRun:output_type -> aiagent.v1.Run
+	5,  // 27: aiagent.v1.Agent.GetRun:output_type -> aiagent.v1.Run
+	3,  // 28: aiagent.v1.Agent.ListRuns:output_type -> aiagent.v1.ListRunsResponse
+	8,  // 29: aiagent.v1.Agent.StreamEvents:output_type -> aiagent.v1.RunEvent
+	21, // 30: aiagent.v1.Agent.Approve:output_type -> aiagent.v1.ApproveResponse
+	5,  // 31: aiagent.v1.Agent.CancelRun:output_type -> aiagent.v1.Run
+	26, // [26:32] is the sub-list for method output_type
+	20, // [20:26] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
+}
+
+func init() { file_aiagent_v1_agent_proto_init() }
+func file_aiagent_v1_agent_proto_init() {
+	if File_aiagent_v1_agent_proto != nil {
+		return
+	}
+	file_aiagent_v1_agent_proto_msgTypes[8].OneofWrappers = []any{
+		(*RunEvent_RunStarted)(nil),
+		(*RunEvent_NodeStarted)(nil),
+		(*RunEvent_NodeFinished)(nil),
+		(*RunEvent_CommandProposed)(nil),
+		(*RunEvent_ApprovalRequested)(nil),
+		(*RunEvent_ApprovalPending)(nil),
+		(*RunEvent_ApprovalAnswered)(nil),
+		(*RunEvent_CommandRejected)(nil),
+		(*RunEvent_CommandExecuted)(nil),
+		(*RunEvent_RunFinished)(nil),
+		(*RunEvent_Decision)(nil),
+	}
+	file_aiagent_v1_agent_proto_msgTypes[19].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_aiagent_v1_agent_proto_rawDesc), len(file_aiagent_v1_agent_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   22,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_aiagent_v1_agent_proto_goTypes,
+		DependencyIndexes: file_aiagent_v1_agent_proto_depIdxs,
+		MessageInfos:      file_aiagent_v1_agent_proto_msgTypes,
+	}.Build()
+	File_aiagent_v1_agent_proto = out.File
+	file_aiagent_v1_agent_proto_goTypes = nil
+	file_aiagent_v1_agent_proto_depIdxs = nil
+}
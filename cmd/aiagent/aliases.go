@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	"aiagent/pkg/config"
+)
+
+// runAliasesCommand handles the "aliases" subcommand
+func runAliasesCommand(args []string, opts runOptions) error {
+	if len(args) > 0 && args[0] != "list" {
+		return fmt.Errorf("unknown aliases command: %s (expected list)", args[0])
+	}
+
+	names := opts.Config.AliasNames()
+	if len(names) == 0 {
+		fmt.Println("No aliases configured")
+		return nil
+	}
+
+	for _, name := range names {
+		fmt.Printf("%-20s %s\n", config.AliasPrefix+name, opts.Config.Aliases[name])
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"aiagent/pkg/nodes"
+)
+
+// runAPICommand implements the "api" subcommand: it prints the reference of the exported
+// API of the Go module in the working directory
+func runAPICommand(args []string, opts runOptions, stdout io.Writer) error {
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	format := fs.String("format", "markdown", "Reference format: markdown, text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dir, err := workingDir(opts)
+	if err != nil {
+		return err
+	}
+	ref, err := nodes.ExtractAPI(dir)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(ref)
+	case "text":
+		_, err = fmt.Fprint(stdout, ref.String())
+	case "markdown":
+		_, err = fmt.Fprint(stdout, ref.Markdown())
+	default:
+		return fmt.Errorf("unknown format %q, expected markdown, text or json", *format)
+	}
+	return err
+}
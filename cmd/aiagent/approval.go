@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"strings"
+
+	"aiagent/pkg/approval"
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/slack"
+)
+
+// teamApproval sends the risky commands of runs to another person of the team for approval
+type teamApproval struct {
+	channel   approval.Channel
+	approvers approval.Approvers
+	rating    nodes.Rating
+	cfg       config.ApprovalConfig
+
+	// slackIDs are the Slack user IDs of the server users, by name
+	slackIDs map[string]string
+
+	// offline denies every command needing approval, as the team cannot be reached
+	offline bool
+}
+
+// newTeamApproval creates the team approval of the config, or returns nil if it is disabled
+func newTeamApproval(cfg *config.Config) (*teamApproval, error) {
+	if cfg.Approval.Rating == "" {
+		return nil, nil
+	}
+	rating, err := nodes.ParseRating(cfg.Approval.Rating)
+	if err != nil {
+		return nil, fmt.Errorf("approval: %v", err)
+	}
+
+	t := &teamApproval{
+		approvers: approval.Approvers{Names: cfg.Approval.Approvers},
+		rating:    rating,
+		cfg:       cfg.Approval,
+		slackIDs:  map[string]string{},
+		offline:   cfg.HTTP.Offline,
+	}
+	for name, user := range cfg.Server.Users {
+		if user.SlackID != "" {
+			t.slackIDs[name] = user.SlackID
+		}
+	}
+	if cfg.Approval.SlackChannel != "" {
+		token := os.Getenv("SLACK_BOT_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("approval: SLACK_BOT_TOKEN must be set to ask for approvals in Slack")
+		}
+		t.channel = &approval.Slack{Client: slack.NewClient(token), Channel: cfg.Approval.SlackChannel, Approvers: cfg.Approval.Approvers}
+	} else {
+		secret := ""
+		if cfg.Approval.SecretEnv != "" {
+			secret = os.Getenv(cfg.Approval.SecretEnv)
+		}
+		t.channel = approval.NewWebhook(cfg.Approval.WebhookURL, secret)
+	}
+	return t, nil
+}
+
+// reviewer returns the CommandReviewer of a run started by requester; an empty requester is
+// the user running the agent
+func (t *teamApproval) reviewer(state *nodes.State, requester string) nodes.CommandReviewer {
+	local := requester == ""
+	slackID := t.slackIDs[requester]
+	if local {
+		requester = localUserName()
+		slackID = t.cfg.RequesterSlackID
+	}
+	return func(id, command string, rating nodes.Rating) (nodes.Review, error) {
+		if t.offline {
+			return nodes.Review{}, fmt.Errorf("%w: the team cannot be asked to approve a %s command", nodes.ErrOffline, rating)
+		}
+
+		timeout := t.cfg.Timeout
+		if timeout == 0 {
+			timeout = approval.DefaultTimeout
+		}
+		ctx, cancel := context.WithTimeout(state.GetContext(), timeout)
+		defer cancel()
+
+		request := approval.Request{
+			ID:          state.GetRunID() + "-" + id,
+			RunID:       state.GetRunID(),
+			Command:     command,
+			Rating:      string(rating),
+			RequestedBy: requester,
+			Directory:   state.GetWorkingDirectory(),
+
+			RequesterSlackID: slackID,
+		}
+		logger := state.NodeLogger(nodes.NodeTypeBash)
+		logger.Info("waiting for team approval", "command", command, "rating", string(rating), "timeout", timeout)
+		if local {
+			fmt.Fprintf(os.Stderr, "Waiting up to %s for another person to approve the %s command: %s\n", timeout, rating, command)
+		}
+
+		decision, err := t.channel.Ask(ctx, request)
+		if err != nil {
+			return nodes.Review{}, err
+		}
+		if err := t.approvers.Check(request, decision); err != nil {
+			return nodes.Review{}, err
+		}
+		logger.Info("team approval answered", "command", command, "approved", decision.Approved, "approver", decision.Approver)
+		return nodes.Review{Approved: decision.Approved, Reviewer: decision.Approver}, nil
+	}
+}
+
+// localUserName returns the name of the user running the agent
+func localUserName() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		// Windows names users DOMAIN\name
+		return current.Username[strings.LastIndex(current.Username, `\`)+1:]
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	slog.Warn("failed to determine the user name for approval requests")
+	return "unknown"
+}
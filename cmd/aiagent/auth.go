@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"aiagent/pkg/auth"
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+)
+
+// defaultUserClaim is the claim of an OIDC token naming the user
+const defaultUserClaim = "email"
+
+// errRateLimited is returned when a user starts more runs than allowed
+var errRateLimited = errors.New("rate limit exceeded")
+
+// serverUser is an authenticated user of the server; the runs of a user work in their
+// own directory with their own command policy
+type serverUser struct {
+	Name    string
+	APIKey  string
+	Dir     string
+	Policy  nodes.CommandPolicy
+	limiter *auth.RateLimiter
+}
+
+// serverAuth authenticates the requests of the HTTP API
+type serverAuth struct {
+	users     []*serverUser
+	byName    map[string]*serverUser
+	oidc      *auth.OIDCVerifier
+	userClaim string
+}
+
+type userContextKey struct{}
+
+// newServerAuth creates the authentication of the configured users, or returns nil if the
+// server has no users and is open to everyone
+func newServerAuth(cfg config.ServerConfig, defaultPolicy nodes.CommandPolicy) (*serverAuth, error) {
+	if len(cfg.Users) == 0 {
+		return nil, nil
+	}
+
+	a := &serverAuth{byName: make(map[string]*serverUser), userClaim: cfg.OIDC.UserClaim}
+	if a.userClaim == "" {
+		a.userClaim = defaultUserClaim
+	}
+	if cfg.OIDC.Issuer != "" {
+		a.oidc = auth.NewOIDCVerifier(cfg.OIDC.Issuer, cfg.OIDC.Audience)
+	}
+
+	names := make([]string, 0, len(cfg.Users))
+	for name := range cfg.Users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		userConfig := cfg.Users[name]
+		dir, err := config.ExpandHome(userConfig.Directory)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("server user %s: directory %s does not exist", name, dir)
+		}
+
+		policy := defaultPolicy
+		if userConfig.Policy != "" {
+			if policy, err = nodes.ParseCommandPolicy(userConfig.Policy); err != nil {
+				return nil, fmt.Errorf("server user %s: %v", name, err)
+			}
+		}
+
+		user := &serverUser{
+			Name:    name,
+			Dir:     dir,
+			Policy:  policy,
+			limiter: auth.NewRateLimiter(userConfig.RateLimit, time.Minute),
+		}
+		if userConfig.APIKeyEnv != "" {
+			user.APIKey = os.Getenv(userConfig.APIKeyEnv)
+			if user.APIKey == "" {
+				return nil, fmt.Errorf("server user %s: environment variable %s is not set", name, userConfig.APIKeyEnv)
+			}
+		}
+		a.users = append(a.users, user)
+		a.byName[name] = user
+	}
+	return a, nil
+}
+
+// authenticate returns the user a credential belongs to: an API key, or a token of the
+// OIDC provider naming a configured user
+func (a *serverAuth) authenticate(ctx context.Context, credential string) (*serverUser, error) {
+	if credential == "" {
+		return nil, fmt.Errorf("authentication required")
+	}
+
+	// Every key is compared, so the time taken does not tell which user exists
+	var found *serverUser
+	for _, user := range a.users {
+		if user.APIKey != "" && auth.Equal(credential, user.APIKey) {
+			found = user
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+
+	if a.oidc == nil {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	claims, err := a.oidc.Verify(ctx, credential)
+	if err != nil {
+		return nil, err
+	}
+	user, ok := a.byName[claims.String(a.userClaim)]
+	if !ok {
+		return nil, fmt.Errorf("unknown user %q", claims.String(a.userClaim))
+	}
+	return user, nil
+}
+
+// middleware rejects unauthenticated requests and passes the user to the handlers
+func (a *serverAuth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.authenticate(r.Context(), auth.Credential(r))
+		if err != nil {
+			slog.Info("rejected request", "path", r.URL.Path, "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="aiagent"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized: %v", err))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	})
+}
+
+// requestUser returns the authenticated user of a request, or nil if the server has no users
+func requestUser(r *http.Request) *serverUser {
+	return contextUser(r.Context())
+}
+
+// contextUser returns the authenticated user of a request context, or nil if the server has no users
+func contextUser(ctx context.Context) *serverUser {
+	user, _ := ctx.Value(userContextKey{}).(*serverUser)
+	return user
+}
+
+// userName returns the name of a user, or an empty string for the anonymous user of an open server
+func userName(user *serverUser) string {
+	if user == nil {
+		return ""
+	}
+	return user.Name
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+)
+
+// newAuthRunServer returns a server with the users alice (relaxed, 2 runs per minute) and bob
+func newAuthRunServer(t *testing.T, run func(input string, opts runOptions) (string, error)) (*runServer, *httptest.Server, map[string]string) {
+	t.Chdir(t.TempDir())
+	dirs := map[string]string{"alice": t.TempDir(), "bob": t.TempDir()}
+	t.Setenv("ALICE_KEY", "alice-key")
+	t.Setenv("BOB_KEY", "bob-key")
+	serverAuth, err := newServerAuth(config.ServerConfig{Users: map[string]config.ServerUserConfig{
+		"alice": {APIKeyEnv: "ALICE_KEY", Directory: dirs["alice"], Policy: "relaxed", RateLimit: 2},
+		"bob":   {APIKeyEnv: "BOB_KEY", Directory: dirs["bob"]},
+	}}, nodes.PolicyStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newRunServer(nil, runOptions{Storage: "file"}, newTestQueue(t))
+	s.run = run
+	s.auth = serverAuth
+	s.Start(1)
+	t.Cleanup(s.Shutdown)
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return s, server, dirs
+}
+
+func authRequest(t *testing.T, method, url, key, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServe_Auth(t *testing.T) {
+	var mu sync.Mutex
+	var got []runOptions
+	s, server, dirs := newAuthRunServer(t, func(input string, opts runOptions) (string, error) {
+		mu.Lock()
+		got = append(got, opts)
+		mu.Unlock()
+		return "done", nil
+	})
+
+	assert.Equal(t, http.StatusUnauthorized, authRequest(t, "POST", server.URL+"/v1/runs", "", `{"input": "ls"}`).StatusCode)
+	resp := authRequest(t, "POST", server.URL+"/v1/runs", "wrong-key", `{"input": "ls"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer")
+
+	resp = authRequest(t, "POST", server.URL+"/v1/runs", "alice-key", `{"input": "ls"}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	location := server.URL + resp.Header.Get("Location")
+	resp = authRequest(t, "POST", server.URL+"/v1/runs", "bob-key", `{"input": "ls"}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	s.Wait()
+
+	// Runs are isolated per user
+	assert.Equal(t, http.StatusOK, authRequest(t, "GET", location, "alice-key", "").StatusCode)
+	assert.Equal(t, http.StatusNotFound, authRequest(t, "GET", location, "bob-key", "").StatusCode)
+	assert.Equal(t, http.StatusNotFound, authRequest(t, "GET", location+"/events", "bob-key", "").StatusCode)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, got, 2) {
+		byUser := map[string]runOptions{got[0].User: got[0], got[1].User: got[1]}
+		assert.Equal(t, dirs["alice"], byUser["alice"].Dir)
+		assert.Equal(t, nodes.PolicyRelaxed, byUser["alice"].Policy)
+		assert.Equal(t, dirs["bob"], byUser["bob"].Dir)
+		assert.Equal(t, nodes.PolicyStrict, byUser["bob"].Policy)
+	}
+}
+
+func TestServe_RateLimit(t *testing.T) {
+	s, server, _ := newAuthRunServer(t, func(input string, opts runOptions) (string, error) {
+		return "done", nil
+	})
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusAccepted, authRequest(t, "POST", server.URL+"/v1/runs", "alice-key", `{"input": "ls"}`).StatusCode)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, authRequest(t, "POST", server.URL+"/v1/runs", "alice-key", `{"input": "ls"}`).StatusCode)
+	assert.Equal(t, http.StatusAccepted, authRequest(t, "POST", server.URL+"/v1/runs", "bob-key", `{"input": "ls"}`).StatusCode)
+	s.Wait()
+}
+
+func TestNewServerAuth_Errors(t *testing.T) {
+	auth, err := newServerAuth(config.ServerConfig{}, nodes.PolicyStrict)
+	assert.NoError(t, err)
+	assert.Nil(t, auth, "a server without users is open")
+
+	_, err = newServerAuth(config.ServerConfig{Users: map[string]config.ServerUserConfig{
+		"alice": {APIKeyEnv: "AIAGENT_TEST_UNSET_KEY", Directory: t.TempDir()},
+	}}, nodes.PolicyStrict)
+	assert.ErrorContains(t, err, "AIAGENT_TEST_UNSET_KEY")
+
+	t.Setenv("ALICE_KEY", "alice-key")
+	_, err = newServerAuth(config.ServerConfig{Users: map[string]config.ServerUserConfig{
+		"alice": {APIKeyEnv: "ALICE_KEY", Directory: t.TempDir() + "/missing"},
+	}}, nodes.PolicyStrict)
+	assert.ErrorContains(t, err, "does not exist")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"aiagent/pkg/ci"
+	"aiagent/pkg/github"
+	"aiagent/pkg/nodes"
+)
+
+// maxBuildLog is the maximum size of a build log read by "ci"
+const maxBuildLog = 64 << 20
+
+// runCICommand implements the "ci" subcommand: it diagnoses a failed build from its log and
+// prints the report, optionally posting it as a comment of the pull request
+func runCICommand(args []string, llm nodes.LLM, opts runOptions, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("ci", flag.ContinueOnError)
+	logFile := fs.String("log", "-", "Build log to diagnose, - for stdin")
+	format := fs.String("format", "markdown", "Report format: markdown or json")
+	patch := fs.Bool("patch", false, "Include a patch fixing the failure in the report")
+	comment := fs.Bool("comment", false, "Post the report as a comment of the pull request (needs GITHUB_TOKEN)")
+	repo := fs.String("repo", os.Getenv("GITHUB_REPOSITORY"), "Repository of the pull request, as owner/name")
+	pr := fs.Int("pr", 0, "Number of the pull request; defaults to the one of the GitHub Actions event")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected markdown or json", *format)
+	}
+
+	log, err := readBuildLog(*logFile, stdin)
+	if err != nil {
+		return err
+	}
+	dir, err := workingDir(opts)
+	if err != nil {
+		return err
+	}
+
+	// Build logs may hold personal data, e.g. the emails of test fixtures
+	guarded, err := guardFrontend(llm, opts)
+	if err != nil {
+		return err
+	}
+	report, err := ci.Diagnose(guarded, opts.Prompts, dir, log, *patch)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprint(stdout, report.Markdown())
+	}
+
+	if !*comment {
+		return nil
+	}
+	if opts.Offline {
+		return fmt.Errorf("--comment posts to GitHub and cannot be used with --offline")
+	}
+	number := *pr
+	if number == 0 {
+		eventPath := os.Getenv("GITHUB_EVENT_PATH")
+		if eventPath == "" {
+			return fmt.Errorf("--pr is required outside of GitHub Actions")
+		}
+		if number, err = github.EventNumber(eventPath); err != nil {
+			return err
+		}
+	}
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return fmt.Errorf("GITHUB_TOKEN must be set to post a comment")
+	}
+	client := github.NewClient(token)
+	if baseURL := os.Getenv("GITHUB_API_URL"); baseURL != "" {
+		client.BaseURL = baseURL
+	}
+	posted, err := client.CreateComment(context.Background(), *repo, number, report.Markdown())
+	if err != nil {
+		return fmt.Errorf("failed to post the report to #%d: %v", number, err)
+	}
+	fmt.Fprintf(os.Stderr, "Posted the report: %s\n", posted.HTMLURL)
+	return nil
+}
+
+// readBuildLog reads a build log from a file, or from stdin for "-"
+func readBuildLog(path string, stdin io.Reader) (string, error) {
+	var reader io.Reader = stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to open build log: %v", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, maxBuildLog))
+	if err != nil {
+		return "", fmt.Errorf("failed to read build log: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/ci"
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/pii"
+)
+
+const ciDiagnosis = `{"summary": "A test fails", "root_cause": "sum returns the wrong value", "files": ["sum.go"], "fix": "Add instead of subtracting"}`
+
+func TestCICommand(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "sum.go"), []byte("package sum\n\nfunc Sum(a, b int) int { return a - b }\n"), 0644)
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains("sum_test.go:9").Respond(ciDiagnosis)
+	opts := runOptions{Dir: dir}
+	log := "--- FAIL: TestSum (0.00s)\n    sum_test.go:9: expected 3, got -1\nFAIL\n"
+
+	var stdout bytes.Buffer
+	assert.NoError(t, runCICommand(nil, llm, opts, strings.NewReader(log), &stdout))
+	assert.Contains(t, stdout.String(), "**Summary:** A test fails")
+
+	logFile := filepath.Join(t.TempDir(), "build.log")
+	os.WriteFile(logFile, []byte(log), 0644)
+	stdout.Reset()
+	assert.NoError(t, runCICommand([]string{"--log", logFile, "--format", "json"}, llm, opts, nil, &stdout))
+	var report ci.Report
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, "sum returns the wrong value", report.RootCause)
+
+	assert.EqualError(t, runCICommand([]string{"--format", "xml"}, llm, opts, nil, &stdout), `unknown format "xml", expected markdown or json`)
+}
+
+func TestCICommand_RedactsPersonalData(t *testing.T) {
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains("TestNotify").Respond(ciDiagnosis)
+	cfg := config.Default()
+	cfg.PII.Mode = pii.ModeRedact
+	log := "--- FAIL: TestNotify (0.00s)\n    notify_test.go:9: no mail sent to jane@example.com\nFAIL\n"
+
+	var stdout bytes.Buffer
+	assert.NoError(t, runCICommand(nil, llm, runOptions{Dir: t.TempDir(), Config: cfg}, strings.NewReader(log), &stdout))
+	assert.Contains(t, llm.Calls()[0], "no mail sent to [EMAIL]")
+	assert.NotContains(t, llm.Calls()[0], "jane@example.com")
+}
+
+func TestCICommand_Comment(t *testing.T) {
+	var posted string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/owner/repo/issues/12/comments", r.URL.Path)
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		posted = request["body"]
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": 1, "html_url": "https://github.com/owner/repo/pull/12#issuecomment-1"}`)
+	}))
+	defer api.Close()
+
+	eventPath := filepath.Join(t.TempDir(), "event.json")
+	os.WriteFile(eventPath, []byte(`{"pull_request": {"number": 12}}`), 0644)
+	t.Setenv("GITHUB_API_URL", api.URL)
+	t.Setenv("GITHUB_REPOSITORY", "owner/repo")
+	t.Setenv("GITHUB_EVENT_PATH", eventPath)
+	t.Setenv("GITHUB_TOKEN", "")
+
+	llm := nodes.NewScriptedLLM()
+	llm.OnAny().Respond(ciDiagnosis)
+	opts := runOptions{Dir: t.TempDir()}
+
+	var stdout bytes.Buffer
+	err := runCICommand([]string{"--comment"}, llm, opts, strings.NewReader("FAIL\n"), &stdout)
+	assert.EqualError(t, err, "GITHUB_TOKEN must be set to post a comment")
+
+	t.Setenv("GITHUB_TOKEN", "token")
+	stdout.Reset()
+	assert.NoError(t, runCICommand([]string{"--comment"}, llm, opts, strings.NewReader("FAIL\n"), &stdout))
+	assert.Equal(t, stdout.String(), posted)
+}
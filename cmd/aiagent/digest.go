@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/email"
+	"aiagent/pkg/htmlreport"
+	"aiagent/pkg/transcript"
+)
+
+// maxSubjectRequest is the maximum length of the request quoted in the default subject
+const maxSubjectRequest = 80
+
+// emailDigest emails the report of finished runs, e.g. of a run scheduled with cron
+type emailDigest struct {
+	name   string
+	config config.EmailDigestConfig
+	from   string
+	sender *email.Sender
+}
+
+// newEmailDigest creates the email digest with the given name of the config
+func newEmailDigest(cfg *config.Config, name string) (*emailDigest, error) {
+	digest, ok := cfg.EmailDigests[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email digest: %s", name)
+	}
+	password := ""
+	if cfg.SMTP.PasswordEnv != "" {
+		password = os.Getenv(cfg.SMTP.PasswordEnv)
+		if password == "" {
+			return nil, fmt.Errorf("email digest %s: %s is not set", name, cfg.SMTP.PasswordEnv)
+		}
+	}
+	return &emailDigest{
+		name:   name,
+		config: digest,
+		from:   cfg.SMTP.From,
+		sender: email.NewSender(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, password),
+	}, nil
+}
+
+// Send emails the report of the finished run t unless the digest skips it
+func (d *emailDigest) Send(t *transcript.Transcript) error {
+	if d.config.OnlyFailures && t.Status != transcript.StatusFailed {
+		return nil
+	}
+	msg, err := d.message(t)
+	if err != nil {
+		return err
+	}
+	return d.sender.Send(msg)
+}
+
+// message builds the email of a run: the result and the execution report as plain text,
+// and the HTML page of the report command; secrets are redacted from both
+func (d *emailDigest) message(t *transcript.Transcript) (*email.Message, error) {
+	var page strings.Builder
+	if err := htmlreport.Render(&page, t, "aiagent "+buildVersion()); err != nil {
+		return nil, err
+	}
+
+	t = t.Redacted()
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s\n\nStatus: %s\nRun: %s\n\n", t.Input, t.Status, t.RunID)
+	if t.Error != "" {
+		fmt.Fprintf(&text, "Error: %s\n", t.Error)
+	} else {
+		text.WriteString(strings.TrimRight(t.Result, "\n") + "\n")
+	}
+	if t.Report != nil {
+		text.WriteString("\n")
+		if err := t.Report.Write(&text); err != nil {
+			return nil, err
+		}
+	}
+
+	subject := d.config.Subject
+	if subject == "" {
+		request := []rune(strings.Join(strings.Fields(t.Input), " "))
+		if len(request) > maxSubjectRequest {
+			request = append(request[:maxSubjectRequest], '…')
+		}
+		subject = "aiagent: " + string(request)
+	}
+	if t.Status == transcript.StatusFailed {
+		subject = "[failed] " + subject
+	}
+
+	return &email.Message{
+		From:    d.from,
+		To:      d.config.To,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    page.String(),
+	}, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/report"
+	"aiagent/pkg/transcript"
+)
+
+func TestEmailDigest(t *testing.T) {
+	cfg := config.Default()
+	cfg.SMTP = config.SMTPConfig{Host: "127.0.0.1", Port: 1, From: "aiagent <bot@example.com>", PasswordEnv: "TEST_SMTP_PASSWORD"}
+	cfg.EmailDigests = map[string]config.EmailDigestConfig{
+		"nightly":  {To: []string{"team@example.com"}},
+		"failures": {To: []string{"oncall@example.com"}, Subject: "Nightly check", OnlyFailures: true},
+	}
+
+	t.Setenv("TEST_SMTP_PASSWORD", "")
+	_, err := newEmailDigest(cfg, "nightly")
+	assert.EqualError(t, err, "email digest nightly: TEST_SMTP_PASSWORD is not set")
+	t.Setenv("TEST_SMTP_PASSWORD", "secret")
+	_, err = newEmailDigest(cfg, "weekly")
+	assert.EqualError(t, err, "unknown email digest: weekly")
+
+	nightly, err := newEmailDigest(cfg, "nightly")
+	require.NoError(t, err)
+	run := transcript.New("run-1", "find TODOs\nin pkg/storage")
+	run.Report = &report.Report{Model: "gpt-4o-mini", Visits: []report.NodeVisit{{Node: "bash", Duration: time.Second}}}
+	run.Finish("2 TODOs, token sk-abcdefghijklmnopqrstuvwxyz", nil)
+
+	msg, err := nightly.message(run)
+	require.NoError(t, err)
+	assert.Equal(t, "aiagent: find TODOs in pkg/storage", msg.Subject)
+	assert.Equal(t, []string{"team@example.com"}, msg.To)
+	assert.True(t, strings.HasPrefix(msg.Text, "find TODOs\nin pkg/storage\n\nStatus: completed\nRun: run-1\n\n2 TODOs, token [REDACTED]\n\n"), msg.Text)
+	assert.Contains(t, msg.Text, "bash")
+	assert.Contains(t, msg.HTML, "<h1>find TODOs\nin pkg/storage</h1>")
+	assert.NotContains(t, msg.HTML+msg.Text, "sk-abcdefghijklmnopqrstuvwxyz")
+
+	// A digest of failures skips successful runs without connecting to the server
+	failures, err := newEmailDigest(cfg, "failures")
+	require.NoError(t, err)
+	assert.NoError(t, failures.Send(run))
+
+	failed := transcript.New("run-2", "check the backups")
+	failed.Finish("", errors.New("error in node bash"))
+	msg, err = failures.message(failed)
+	require.NoError(t, err)
+	assert.Equal(t, "[failed] Nightly check", msg.Subject)
+	assert.Contains(t, msg.Text, "Error: error in node bash\n")
+	assert.ErrorContains(t, failures.Send(failed), "failed to connect")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"aiagent/pkg/stats"
+)
+
+// runDuplicatesCommand implements the "duplicates" subcommand: it reports the blocks of code
+// copied across the source files of the working directory
+func runDuplicatesCommand(args []string, opts runOptions, stdout io.Writer) error {
+	fs := flag.NewFlagSet("duplicates", flag.ContinueOnError)
+	format := fs.String("format", "markdown", "Report format: markdown or json")
+	minTokens := fs.Int("min-tokens", stats.DefaultMinTokens, "Size of the smallest duplicated block reported, in tokens")
+	normalize := fs.Bool("normalize", false, "Also find copies with renamed identifiers or changed literals")
+	tests := fs.Bool("tests", false, "Include the test files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected markdown or json", *format)
+	}
+	if *minTokens < 1 {
+		return fmt.Errorf("--min-tokens must be positive")
+	}
+
+	dir, err := workingDir(opts)
+	if err != nil {
+		return err
+	}
+	duplicates, err := stats.FindDuplicates(dir, stats.DuplicateOptions{MinTokens: *minTokens, Normalize: *normalize, Tests: *tests})
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(duplicates)
+	}
+	_, err = fmt.Fprint(stdout, stats.DuplicatesMarkdown(duplicates, *minTokens))
+	return err
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/history"
+	"aiagent/pkg/jsonrpc"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/prompts"
+	"aiagent/pkg/transcript"
+)
+
+// Methods of the editor protocol
+const (
+	editorMethodInitialize = "initialize"
+	editorMethodShutdown   = "shutdown"
+	editorMethodExit       = "exit"
+	editorMethodCancel     = "$/cancelRequest"
+	editorMethodExplain    = "aiagent/explain"
+	editorMethodFix        = "aiagent/fix"
+	editorMethodRun        = "aiagent/run"
+
+	// editorMethodProgress is the notification streaming the progress of a request
+	editorMethodProgress = "aiagent/progress"
+)
+
+// maxEditorCode is the maximum size of the code sent with a request
+const maxEditorCode = 64 * 1024
+
+// editorServer answers the requests of editor extensions over JSON-RPC; requests run
+// concurrently and stream their progress as notifications until they are answered
+type editorServer struct {
+	llm nodes.LLM
+
+	// guarded is llm behind the scan of the prompts for personal data; runs guard their own
+	guarded nodes.LLM
+
+	opts runOptions
+	conn *jsonrpc.Conn
+
+	mu       sync.Mutex
+	cancels  map[string]context.CancelFunc
+	shutdown bool
+	wg       sync.WaitGroup
+}
+
+// newEditorServer creates a server exchanging messages over r and w
+func newEditorServer(llm nodes.LLM, opts runOptions, r io.Reader, w io.Writer) (*editorServer, error) {
+	guarded, err := guardFrontend(llm, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &editorServer{
+		llm:     llm,
+		guarded: guarded,
+		opts:    opts,
+		conn:    jsonrpc.NewConn(r, w),
+		cancels: make(map[string]context.CancelFunc),
+	}, nil
+}
+
+// editorProgress is the parameter of a progress notification; ID is the ID of the request
+type editorProgress struct {
+	ID    json.RawMessage `json:"id"`
+	Text  string          `json:"text,omitempty"`
+	Type  events.Type     `json:"type,omitempty"`
+	Event events.Event    `json:"event,omitempty"`
+}
+
+// editorSelection is code selected in an editor; lines are numbered from 1
+type editorSelection struct {
+	File      string `json:"file"`
+	Language  string `json:"language,omitempty"`
+	Code      string `json:"code"`
+	StartLine int    `json:"start_line,omitempty"`
+}
+
+// editorEdit replaces lines StartLine to EndLine of a file with NewText
+type editorEdit struct {
+	File      string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	NewText   string `json:"new_text"`
+}
+
+// Serve answers requests until the client sends exit, the input ends or ctx is done,
+// then cancels the requests still running and waits for them
+func (s *editorServer) Serve(ctx context.Context) error {
+	defer s.wg.Wait()
+	defer s.cancelAll()
+
+	for ctx.Err() == nil {
+		message, err := s.conn.Read()
+		var rpcErr *jsonrpc.Error
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case errors.As(err, &rpcErr):
+			s.conn.Reply(nil, nil, rpcErr)
+			continue
+		case err != nil:
+			return err
+		}
+		if message.Method == "" {
+			continue // responses are not expected from the client
+		}
+		if message.Method == editorMethodExit {
+			return nil
+		}
+		s.handle(ctx, message)
+	}
+	return ctx.Err()
+}
+
+func (s *editorServer) handle(ctx context.Context, message *jsonrpc.Message) {
+	switch message.Method {
+	case editorMethodInitialize:
+		s.reply(message, map[string]any{
+			"serverInfo":   map[string]string{"name": "aiagent", "version": buildVersion()},
+			"capabilities": map[string]any{"methods": []string{editorMethodExplain, editorMethodFix, editorMethodRun}},
+		}, nil)
+	case editorMethodShutdown:
+		s.mu.Lock()
+		s.shutdown = true
+		s.mu.Unlock()
+		s.cancelAll()
+		s.reply(message, nil, nil)
+	case editorMethodCancel:
+		var params struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if json.Unmarshal(message.Params, &params) == nil {
+			s.mu.Lock()
+			if cancel, ok := s.cancels[string(params.ID)]; ok {
+				cancel()
+			}
+			s.mu.Unlock()
+		}
+	case editorMethodExplain, editorMethodFix, editorMethodRun:
+		s.start(ctx, message)
+	default:
+		s.reply(message, nil, jsonrpc.Errorf(jsonrpc.CodeMethodNotFound, "method not found: %s", message.Method))
+	}
+}
+
+// start runs a request in its own goroutine, so it can stream progress and be canceled
+// while other requests are read
+func (s *editorServer) start(ctx context.Context, message *jsonrpc.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		s.reply(message, nil, jsonrpc.Errorf(jsonrpc.CodeInvalidRequest, "the server is shutting down"))
+		return
+	}
+
+	requestCtx, cancel := context.WithCancel(ctx)
+	key := string(message.ID)
+	if !message.IsNotification() {
+		s.cancels[key] = cancel
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.cancels, key)
+			s.mu.Unlock()
+			cancel()
+		}()
+
+		var result any
+		var err error
+		switch message.Method {
+		case editorMethodExplain:
+			result, err = s.explain(message.Params)
+		case editorMethodFix:
+			result, err = s.fix(message.Params)
+		case editorMethodRun:
+			result, err = s.run(requestCtx, message.ID, message.Params)
+		}
+		if requestCtx.Err() != nil && ctx.Err() == nil {
+			s.reply(message, nil, jsonrpc.Errorf(jsonrpc.CodeRequestCancelled, "request canceled"))
+			return
+		}
+		s.reply(message, result, editorError(err))
+	}()
+}
+
+// editorError converts the error of a request to the error of its response
+func editorError(err error) *jsonrpc.Error {
+	var rpcErr *jsonrpc.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	default:
+		return jsonrpc.Errorf(jsonrpc.CodeInternalError, "%v", err)
+	}
+}
+
+func (s *editorServer) reply(message *jsonrpc.Message, result any, rpcErr *jsonrpc.Error) {
+	if message.IsNotification() {
+		return
+	}
+	if err := s.conn.Reply(message.ID, result, rpcErr); err != nil {
+		slog.Warn("failed to write editor response", "method", message.Method, "error", err)
+	}
+}
+
+func (s *editorServer) progress(progress editorProgress) {
+	if err := s.conn.Notify(editorMethodProgress, progress); err != nil {
+		slog.Warn("failed to write editor progress", "error", err)
+	}
+}
+
+func (s *editorServer) cancelAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cancel := range s.cancels {
+		cancel()
+	}
+}
+
+// decodeSelection decodes and checks the selection of an explain or fix request
+func decodeSelection(params json.RawMessage, v any, selection *editorSelection) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return jsonrpc.Errorf(jsonrpc.CodeInvalidParams, "invalid parameters: %v", err)
+	}
+	if strings.TrimSpace(selection.Code) == "" {
+		return jsonrpc.Errorf(jsonrpc.CodeInvalidParams, "code is required")
+	}
+	if len(selection.Code) > maxEditorCode {
+		return jsonrpc.Errorf(jsonrpc.CodeInvalidParams, "code too long (max %d bytes)", maxEditorCode)
+	}
+	if selection.StartLine < 1 {
+		selection.StartLine = 1
+	}
+	return nil
+}
+
+// explain answers "explain this selection"
+func (s *editorServer) explain(params json.RawMessage) (any, error) {
+	var selection editorSelection
+	if err := decodeSelection(params, &selection, &selection); err != nil {
+		return nil, err
+	}
+
+	prompt, err := s.prompts().Render(prompts.EditorExplain, prompts.Vars{
+		"File":     selection.File,
+		"Language": selection.Language,
+		"Code":     selection.Code,
+	})
+	if err != nil {
+		return nil, err
+	}
+	explanation, err := s.guarded.Complete(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", nodes.ErrLLM, err)
+	}
+	return map[string]string{"text": strings.TrimSpace(explanation)}, nil
+}
+
+// fix answers "fix this diagnostic" with an edit replacing the selected lines
+func (s *editorServer) fix(params json.RawMessage) (any, error) {
+	var request struct {
+		editorSelection
+		Diagnostic string `json:"diagnostic"`
+	}
+	if err := decodeSelection(params, &request, &request.editorSelection); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(request.Diagnostic) == "" {
+		return nil, jsonrpc.Errorf(jsonrpc.CodeInvalidParams, "diagnostic is required")
+	}
+
+	endLine := request.StartLine + strings.Count(strings.TrimSuffix(request.Code, "\n"), "\n")
+	prompt, err := s.prompts().Render(prompts.EditorFix, prompts.Vars{
+		"File":       request.File,
+		"Language":   request.Language,
+		"Diagnostic": request.Diagnostic,
+		"StartLine":  request.StartLine,
+		"EndLine":    endLine,
+		"Code":       request.Code,
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.guarded.Complete(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", nodes.ErrLLM, err)
+	}
+	var fix struct {
+		Explanation string `json:"explanation"`
+		Replacement string `json:"replacement"`
+	}
+	if err := nodes.ParseLLMJSONWithRepair(s.guarded, response, &fix); err != nil {
+		return nil, fmt.Errorf("failed to parse fix: %w", err)
+	}
+
+	return map[string]any{
+		"explanation": fix.Explanation,
+		"edit": editorEdit{
+			File:      request.File,
+			StartLine: request.StartLine,
+			EndLine:   endLine,
+			NewText:   fix.Replacement,
+		},
+	}, nil
+}
+
+// run answers "run this task" by running the graph, streaming the events of the run
+func (s *editorServer) run(ctx context.Context, id json.RawMessage, params json.RawMessage) (any, error) {
+	var request struct {
+		Task     string `json:"task"`
+		Session  string `json:"session"`
+		Continue bool   `json:"continue"`
+	}
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, jsonrpc.Errorf(jsonrpc.CodeInvalidParams, "invalid parameters: %v", err)
+	}
+	input, err := validateAndSanitizeInput([]string{request.Task})
+	if err != nil {
+		return nil, jsonrpc.Errorf(jsonrpc.CodeInvalidParams, "invalid task: %v", err)
+	}
+
+	opts := s.opts
+	opts.Context = ctx
+	opts.Continue = request.Continue
+	opts.RunID = transcript.NewRunID()
+	if request.Session != "" {
+		if err := history.ValidateSessionName(request.Session); err != nil {
+			return nil, jsonrpc.Errorf(jsonrpc.CodeInvalidParams, "%v", err)
+		}
+		opts.Session = request.Session
+	}
+
+	if opts.Events != nil {
+		unsubscribe := opts.Events.Subscribe(events.SubscriberFunc(func(event events.Event) {
+			if events.RunID(event) == opts.RunID {
+				s.progress(editorProgress{ID: id, Text: activity(event), Type: event.Type(), Event: event})
+			}
+		}))
+		defer unsubscribe()
+	}
+
+	result, err := runLangGraph(input, s.llm, opts)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"run_id": opts.RunID, "text": result}, nil
+}
+
+func (s *editorServer) prompts() *prompts.Registry {
+	if s.opts.Prompts == nil {
+		return prompts.Builtin()
+	}
+	return s.opts.Prompts
+}
+
+// runEditorCommand implements the "editor" subcommand: it answers the requests of editor
+// extensions over stdin and stdout until the editor exits; logs go to standard error
+func runEditorCommand(args []string, llm nodes.LLM, opts runOptions) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: aiagent editor")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	server, err := newEditorServer(llm, opts, os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+	return server.Serve(ctx)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/events"
+	"aiagent/pkg/jsonrpc"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/pii"
+)
+
+// editorClient talks to an editor server over pipes
+type editorClient struct {
+	t      *testing.T
+	conn   *jsonrpc.Conn
+	done   chan error
+	nextID int
+}
+
+func newEditorClient(t *testing.T, llm nodes.LLM, opts runOptions) *editorClient {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	server, err := newEditorServer(llm, opts, serverIn, serverOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &editorClient{t: t, conn: jsonrpc.NewConn(clientIn, clientOut), done: make(chan error, 1)}
+	go func() {
+		c.done <- server.Serve(context.Background())
+		serverOut.Close()
+	}()
+	t.Cleanup(func() {
+		clientOut.Close()
+		select {
+		case <-c.done:
+		case <-time.After(5 * time.Second):
+			t.Error("the editor server did not stop")
+		}
+	})
+	return c
+}
+
+// request sends a request and returns its ID
+func (c *editorClient) request(method string, params any) json.RawMessage {
+	c.t.Helper()
+	c.nextID++
+	id, _ := json.Marshal(c.nextID)
+	data, _ := json.Marshal(params)
+	if err := c.conn.Write(&jsonrpc.Message{ID: id, Method: method, Params: data}); err != nil {
+		c.t.Fatal(err)
+	}
+	return id
+}
+
+// read returns the messages up to the response of the request id
+func (c *editorClient) read(id json.RawMessage) (notifications []*jsonrpc.Message, response *jsonrpc.Message) {
+	c.t.Helper()
+	for {
+		message, err := c.conn.Read()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if message.Method != "" {
+			notifications = append(notifications, message)
+			continue
+		}
+		if string(message.ID) == string(id) {
+			return notifications, message
+		}
+	}
+}
+
+func TestEditor_Initialize(t *testing.T) {
+	c := newEditorClient(t, nodes.NewScriptedLLM(), runOptions{})
+
+	_, response := c.read(c.request("initialize", map[string]any{}))
+	var result struct {
+		Capabilities struct {
+			Methods []string `json:"methods"`
+		} `json:"capabilities"`
+	}
+	assert.NoError(t, json.Unmarshal(response.Result, &result))
+	assert.Equal(t, []string{"aiagent/explain", "aiagent/fix", "aiagent/run"}, result.Capabilities.Methods)
+
+	_, response = c.read(c.request("textDocument/hover", map[string]any{}))
+	assert.Equal(t, jsonrpc.CodeMethodNotFound, response.Error.Code)
+
+	_, response = c.read(c.request("aiagent/explain", map[string]any{"file": "main.go"}))
+	assert.Equal(t, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: "code is required"}, response.Error)
+
+	_, response = c.read(c.request("shutdown", nil))
+	assert.Nil(t, response.Error)
+	_, response = c.read(c.request("aiagent/explain", map[string]any{"file": "main.go", "code": "x := 1"}))
+	assert.Equal(t, "the server is shutting down", response.Error.Message)
+}
+
+func TestEditor_Explain(t *testing.T) {
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains("for i := range 10").Respond("It counts to ten.\n")
+	c := newEditorClient(t, llm, runOptions{})
+
+	_, response := c.read(c.request("aiagent/explain", map[string]any{"file": "main.go", "language": "go", "code": "for i := range 10 {}"}))
+	assert.Nil(t, response.Error)
+	assert.JSONEq(t, `{"text": "It counts to ten."}`, string(response.Result))
+	assert.Contains(t, llm.Calls()[0], "Language: go")
+}
+
+func TestEditor_ExplainRedactsPersonalData(t *testing.T) {
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains("notify(").Respond("It notifies the owner.")
+	cfg := config.Default()
+	cfg.PII.Mode = pii.ModeRedact
+	c := newEditorClient(t, llm, runOptions{Config: cfg})
+
+	_, response := c.read(c.request("aiagent/explain", map[string]any{"file": "main.go", "code": `notify("jane@example.com")`}))
+	assert.Nil(t, response.Error)
+	assert.Contains(t, llm.Calls()[0], `notify("[EMAIL]")`)
+	assert.NotContains(t, llm.Calls()[0], "jane@example.com")
+}
+
+func TestEditor_Fix(t *testing.T) {
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains("undefined: fmt").Respond(`{"explanation": "fmt is not imported", "replacement": "import \"fmt\"\n\nfunc main() {\n\tfmt.Println()\n}\n"}`)
+	c := newEditorClient(t, llm, runOptions{})
+
+	_, response := c.read(c.request("aiagent/fix", map[string]any{
+		"file":       "main.go",
+		"code":       "func main() {\n\tfmt.Println()\n}\n",
+		"start_line": 3,
+		"diagnostic": "undefined: fmt",
+	}))
+	assert.Nil(t, response.Error)
+	assert.JSONEq(t, `{
+		"explanation": "fmt is not imported",
+		"edit": {"file": "main.go", "start_line": 3, "end_line": 5, "new_text": "import \"fmt\"\n\nfunc main() {\n\tfmt.Println()\n}\n"}
+	}`, string(response.Result))
+	assert.Contains(t, llm.Calls()[0], "Code (lines 3 to 5)")
+
+	_, response = c.read(c.request("aiagent/fix", map[string]any{"file": "main.go", "code": "x"}))
+	assert.Equal(t, "diagnostic is required", response.Error.Message)
+}
+
+func TestEditor_Run(t *testing.T) {
+	t.Chdir(t.TempDir())
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains(classifyPrompt).Respond(`{"next_node": "bash", "goal": "list the files"}`)
+	llm.OnContains(bashPrompt).Respond(`{"command": "ls"}`)
+	llm.OnContains(verifyPrompt).Respond(`{"is_task_done": true}`)
+	llm.OnContains(goalMetPrompt).Respond(`{"is_goal_met": true}`)
+	llm.OnAny().Respond("main.go")
+	opts := runOptions{
+		Config:  config.Default(),
+		Policy:  nodes.PolicyStrict,
+		Storage: "file",
+		Events:  events.NewBus(),
+		CommandRunner: func(command, dir string) ([]byte, int, error) {
+			return []byte("main.go\n"), 0, nil
+		},
+	}
+	c := newEditorClient(t, llm, opts)
+
+	notifications, response := c.read(c.request("aiagent/run", map[string]any{"task": "list the files"}))
+	if !assert.Nil(t, response.Error) {
+		return
+	}
+	var result struct {
+		RunID string `json:"run_id"`
+		Text  string `json:"text"`
+	}
+	assert.NoError(t, json.Unmarshal(response.Result, &result))
+	assert.NotEmpty(t, result.RunID)
+
+	var texts []string
+	var types []string
+	for _, notification := range notifications {
+		var progress struct {
+			ID   json.RawMessage `json:"id"`
+			Text string          `json:"text"`
+			Type string          `json:"type"`
+		}
+		assert.NoError(t, json.Unmarshal(notification.Params, &progress))
+		assert.Equal(t, "aiagent/progress", notification.Method)
+		assert.Equal(t, "1", string(progress.ID))
+		types = append(types, progress.Type)
+		if progress.Text != "" {
+			texts = append(texts, progress.Text)
+		}
+	}
+	assert.Contains(t, types, "run_started")
+	assert.Contains(t, types, "run_finished")
+	assert.Equal(t, []string{"> ran `ls` (exit code 0)\n"}, texts)
+
+	_, response = c.read(c.request("aiagent/run", map[string]any{"task": "rm -rf ../"}))
+	assert.Equal(t, jsonrpc.CodeInvalidParams, response.Error.Code)
+}
+
+// blockingLLM answers every prompt once release is closed
+type blockingLLM struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (l *blockingLLM) Complete(prompt string) (string, error) {
+	select {
+	case l.started <- struct{}{}:
+	default:
+	}
+	<-l.release
+	return `{"next_node": "direct_response", "goal": "answer"}`, nil
+}
+
+func TestEditor_Cancel(t *testing.T) {
+	t.Chdir(t.TempDir())
+	llm := &blockingLLM{started: make(chan struct{}, 1), release: make(chan struct{})}
+	opts := runOptions{Config: config.Default(), Policy: nodes.PolicyStrict, Storage: "file", Events: events.NewBus()}
+	c := newEditorClient(t, llm, opts)
+
+	id := c.request("aiagent/run", map[string]any{"task": "say hello"})
+	responses := make(chan *jsonrpc.Message, 1)
+	go func() {
+		_, response := c.read(id)
+		responses <- response
+	}()
+	<-llm.started
+	params, _ := json.Marshal(map[string]json.RawMessage{"id": id})
+	assert.NoError(t, c.conn.Write(&jsonrpc.Message{Method: "$/cancelRequest", Params: params}))
+	time.Sleep(10 * time.Millisecond) // the cancellation is read before the LLM answers
+	close(llm.release)
+
+	response := <-responses
+	assert.Equal(t, &jsonrpc.Error{Code: jsonrpc.CodeRequestCancelled, Message: "request canceled"}, response.Error)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"aiagent/pkg/config"
+)
+
+// flagEnvAliases name the environment variables of the flags whose names say little
+var flagEnvAliases = map[string]string{
+	"y": "AIAGENT_APPROVE",
+	"v": "AIAGENT_VERBOSE",
+	"q": "AIAGENT_QUIET",
+}
+
+// flagEnvName returns the environment variable of a flag, e.g. AIAGENT_LOG_LEVEL for --log-level
+func flagEnvName(name string) string {
+	if alias, ok := flagEnvAliases[name]; ok {
+		return alias
+	}
+	return config.EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyFlagEnv sets the flags that were not given on the command line from their AIAGENT_*
+// environment variables found by lookup, so the command line takes precedence
+func applyFlagEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] {
+			return
+		}
+		name := flagEnvName(f.Name)
+		value, ok := lookup(name)
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, strings.TrimSpace(value)); setErr != nil {
+			err = fmt.Errorf("invalid %s: %v", name, setErr)
+		}
+	})
+	return err
+}
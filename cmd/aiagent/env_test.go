@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyFlagEnv(t *testing.T) {
+	env := map[string]string{
+		"AIAGENT_APPROVE":   "true",
+		"AIAGENT_LOG_LEVEL": "debug",
+		"AIAGENT_SESSION":   "ci",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	approve := fs.Bool("y", false, "")
+	logLevel := fs.String("log-level", "", "")
+	session := fs.String("session", "default", "")
+	assert.NoError(t, fs.Parse([]string{"--session", "review"}))
+
+	assert.NoError(t, applyFlagEnv(fs, lookup))
+	assert.True(t, *approve)
+	assert.Equal(t, "debug", *logLevel)
+	assert.Equal(t, "review", *session, "the command line takes precedence")
+
+	env = map[string]string{"AIAGENT_APPROVE": "sure"}
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("y", false, "")
+	assert.ErrorContains(t, applyFlagEnv(fs, lookup), "invalid AIAGENT_APPROVE")
+}
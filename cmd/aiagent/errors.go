@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/pii"
+)
+
+// Exit codes of a failed run, so scripts can tell failures apart
+const (
+	exitOK            = 0
+	exitFailure       = 1 // Any error without a more specific code
+	exitUsage         = 2 // The request or the flags are invalid; the flag package uses the same code
+	exitLLM           = 3 // The LLM provider failed, refused the quota or the API key, or sent a response that could not be understood
+	exitPolicyDenied  = 4 // A generated command was refused by the command policy
+	exitCommandFailed = 5 // An approved command exited with an error
+	exitCanceled      = 6 // The user declined a command or canceled the run
+	exitTimeout       = 7 // An operation did not finish in time
+)
+
+// errInvalidInput is the kind of the errors caused by the request or the flags of a run
+var errInvalidInput = errors.New("invalid input")
+
+// invalidInput marks err as caused by the request or the flags without changing its message
+func invalidInput(err error) error {
+	return &inputError{err: err}
+}
+
+type inputError struct {
+	err error
+}
+
+func (e *inputError) Error() string {
+	return e.err.Error()
+}
+
+func (e *inputError) Unwrap() []error {
+	return []error{errInvalidInput, e.err}
+}
+
+// errorKinds maps the node error kinds to their exit code and user-facing message
+// The first matching kind wins, so the more specific kinds come first
+var errorKinds = []struct {
+	kind    error
+	code    int
+	message string
+}{
+	{errInvalidInput, exitUsage, ""},
+	{nodes.ErrCanceled, exitCanceled, ""},
+	{context.Canceled, exitCanceled, ""},
+	{nodes.ErrOffline, exitUsage, "A network connection was refused because of --offline."},
+	{nodes.ErrTimeout, exitTimeout, "The operation timed out. Check your network connection or try again later."},
+	{context.DeadlineExceeded, exitTimeout, "The operation timed out. Check your network connection or try again later."},
+	{nodes.ErrLLMQuota, exitLLM, "The LLM provider's rate limit or quota was exceeded. Wait a moment or check your plan."},
+	{nodes.ErrLLMAuth, exitLLM, "The LLM provider rejected the API key. Check OPENAI_API_KEY or the workspace api_key_env."},
+	{nodes.ErrPolicyDenied, exitPolicyDenied, "The generated command was refused by the command policy."},
+	{pii.ErrBlocked, exitPolicyDenied, "The prompt was not sent because it contains personal data (pii.mode is block)."},
+	{nodes.ErrCommandFailed, exitCommandFailed, "The command ran but failed."},
+	{nodes.ErrParse, exitLLM, "The LLM returned a response the agent could not understand. Try rephrasing the request."},
+	{nodes.ErrLLM, exitLLM, "The request to the LLM failed."},
+}
+
+// exitCode returns the process exit code for err
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.kind) {
+			return k.code
+		}
+	}
+	return exitFailure
+}
+
+// userMessage returns a short explanation of err for the user, or an empty string
+// if err is not of a known kind
+func userMessage(err error) string {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.kind) {
+			return k.message
+		}
+	}
+	return ""
+}
+
+// printRunError reports a failed run, preceded by an explanation if the error is of a known kind
+func printRunError(err error) {
+	if message := userMessage(err); message != "" {
+		fmt.Println(message)
+	}
+	fmt.Printf("Error running langgraph: %v\n", err)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/nodes"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, 0},
+		{errors.New("boom"), 1},
+		{invalidInput(errors.New("missing request")), 2},
+		{fmt.Errorf("classify: %w", nodes.ErrLLM), 3},
+		{fmt.Errorf("classify: %w", nodes.ErrLLMQuota), 3},
+		{fmt.Errorf("classify: %w", nodes.ErrLLMAuth), 3},
+		{fmt.Errorf("classify: %w", nodes.ErrParse), 3},
+		{fmt.Errorf("bash: %w", nodes.ErrPolicyDenied), 4},
+		{fmt.Errorf("bash: %w", nodes.ErrCommandFailed), 5},
+		{nodes.ErrCanceled, 6},
+		{context.Canceled, 6},
+		{nodes.ErrTimeout, 7},
+		{context.DeadlineExceeded, 7},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, exitCode(tt.err), "%v", tt.err)
+	}
+}
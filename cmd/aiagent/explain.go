@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"aiagent/pkg/events"
+)
+
+// explanation collects the decisions of a run and why they were made, for --explain
+type explanation struct {
+	runID string
+
+	mu        sync.Mutex
+	decisions []decision
+}
+
+// decision is a decision of a node and the explanation the LLM gave for it
+type decision struct {
+	summary string
+	because string
+}
+
+// newExplanation creates an explanation collecting the decisions of the run runID
+func newExplanation(runID string) *explanation {
+	return &explanation{runID: runID}
+}
+
+// Handle implements the events.Subscriber interface
+func (e *explanation) Handle(event events.Event) {
+	if events.RunID(event) != e.runID {
+		return
+	}
+	var d decision
+	switch ev := event.(type) {
+	case *events.Decision:
+		d = decision{summary: decisionSummary(ev), because: ev.Explanation}
+	case *events.CommandProposed:
+		d = decision{summary: "bash proposed " + ev.Command, because: ev.Explanation}
+	case *events.CommandRejected:
+		d = decision{summary: "the command policy refused " + ev.Command, because: ev.Reason}
+	default:
+		return
+	}
+	e.mu.Lock()
+	e.decisions = append(e.decisions, d)
+	e.mu.Unlock()
+}
+
+// decisionSummary describes what a node decided
+func decisionSummary(d *events.Decision) string {
+	switch d.Kind {
+	case events.DecisionRoute:
+		return "routed to " + d.Choice
+	case events.DecisionTaskDone:
+		return "task " + d.Choice
+	case events.DecisionGoalMet:
+		return "goal " + d.Choice
+	case events.DecisionContentNeeds:
+		return d.Node + ": " + d.Choice
+	case events.DecisionValidation:
+		return "output " + d.Choice
+	case events.DecisionPlan:
+		return "planned " + d.Choice
+	case events.DecisionReview:
+		return "result " + d.Choice
+	}
+	return d.Node + " " + d.Kind + ": " + d.Choice
+}
+
+// Write prints the decisions in the order they were made
+func (e *explanation) Write(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var sb strings.Builder
+	sb.WriteString("Decisions:\n")
+	if len(e.decisions) == 0 {
+		sb.WriteString("  none\n")
+	}
+	for i, d := range e.decisions {
+		fmt.Fprintf(&sb, "  %d. %s\n", i+1, d.summary)
+		if because := strings.Join(strings.Fields(d.because), " "); because != "" {
+			fmt.Fprintf(&sb, "     because %s\n", because)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
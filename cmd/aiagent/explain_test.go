@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/events"
+)
+
+func TestExplanation(t *testing.T) {
+	bus := events.NewBus()
+	decisions := newExplanation("run-1")
+	bus.Subscribe(decisions)
+
+	run := bus.ForRun("run-1")
+	run.Publish(&events.NodeStarted{Node: "classifier"})
+	run.Publish(&events.Decision{Node: "classifier", Kind: events.DecisionRoute, Choice: "bash: list files", Explanation: "the user wants\n  the files"})
+	run.Publish(&events.CommandProposed{Command: "ls -la", Explanation: "lists the files"})
+	run.Publish(&events.CommandRejected{Command: "rm -rf /", Reason: "not allowed by the strict policy"})
+	run.Publish(&events.Decision{Node: "code_analyzer", Kind: events.DecisionContentNeeds, Choice: "read *.go"})
+	run.Publish(&events.Decision{Node: "classifier", Kind: events.DecisionGoalMet, Choice: "met", Explanation: "done"})
+	bus.ForRun("run-2").Publish(&events.Decision{Node: "classifier", Kind: events.DecisionRoute, Choice: "direct_response"})
+
+	var out strings.Builder
+	assert.NoError(t, decisions.Write(&out))
+	assert.Equal(t, `Decisions:
+  1. routed to bash: list files
+     because the user wants the files
+  2. bash proposed ls -la
+     because lists the files
+  3. the command policy refused rm -rf /
+     because not allowed by the strict policy
+  4. code_analyzer: read *.go
+  5. goal met
+     because done
+`, out.String())
+
+	out.Reset()
+	assert.NoError(t, newExplanation("run-3").Write(&out))
+	assert.Equal(t, "Decisions:\n  none\n", out.String())
+}
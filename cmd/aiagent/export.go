@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"aiagent/pkg/transcript"
+)
+
+// recentRunsLimit is the number of runs listed by "export" without a run ID
+const recentRunsLimit = 20
+
+// runExportCommand implements the "export" subcommand
+// Without a run ID it lists recent runs, otherwise it exports the transcript of the run
+func runExportCommand(args []string, opts runOptions) error {
+	// Allow the run ID to come before the flags: aiagent export <run-id> --format markdown
+	runID := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		runID = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", string(transcript.FormatMarkdown), "Export format: openai-jsonl, markdown or html")
+	output := fs.String("output", "", "Write the export to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if runID == "" && fs.NArg() > 0 {
+		runID = fs.Arg(0)
+	}
+
+	store, err := openStorage(opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	transcripts := transcript.NewStore(store)
+
+	if runID == "" {
+		return listRuns(transcripts)
+	}
+
+	t, err := loadTranscript(transcripts, runID)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return transcript.Export(w, t, transcript.Format(*format))
+}
+
+// loadTranscript loads the transcript of a run; "last" selects the most recent run
+func loadTranscript(transcripts *transcript.Store, runID string) (*transcript.Transcript, error) {
+	if runID == "last" {
+		recent, err := transcripts.List(1)
+		if err != nil {
+			return nil, err
+		}
+		if len(recent) == 0 {
+			return nil, fmt.Errorf("no runs recorded yet")
+		}
+		runID = recent[0].RunID
+	}
+	return transcripts.Load(runID)
+}
+
+// listRuns prints the most recent recorded runs
+func listRuns(transcripts *transcript.Store) error {
+	recent, err := transcripts.List(recentRunsLimit)
+	if err != nil {
+		return err
+	}
+	if len(recent) == 0 {
+		fmt.Println("No runs recorded yet")
+		return nil
+	}
+
+	fmt.Printf("%-29s %-10s %-20s %s\n", "RUN ID", "STATUS", "STARTED", "INPUT")
+	for i := len(recent) - 1; i >= 0; i-- {
+		t := recent[i]
+		fmt.Printf("%-29s %-10s %-20s %s\n", t.RunID, t.Status, t.StartedAt.Format(time.DateTime), t.Input)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/transcript"
+)
+
+const (
+	// feedbackRunsLimit is the number of recent runs searched for feedback before a run
+	feedbackRunsLimit = 200
+
+	// maxFeedbackExamples is the maximum number of examples learned from feedback added to
+	// each prompt
+	maxFeedbackExamples = 10
+)
+
+// runFeedbackCommand implements the "feedback" subcommand: it records whether a run went
+// well, optionally with the node or command that should have been used; later runs learn
+// from it
+func runFeedbackCommand(args []string, opts runOptions) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: aiagent feedback good|bad [<run-id>|last] [--node name] [--command cmd] [--note text]")
+	}
+	verdict, err := transcript.ParseVerdict(args[0])
+	if err != nil {
+		return err
+	}
+	args = args[1:]
+
+	// Allow the run ID to come before the flags: aiagent feedback bad <run-id> --node bash
+	runID := "last"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		runID = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("feedback", flag.ContinueOnError)
+	node := fs.String("node", "", "The node that should have handled the request")
+	command := fs.String("command", "", "The command that should have run")
+	note := fs.String("note", "", "A note on the run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		runID = fs.Arg(0)
+	}
+	if verdict == transcript.VerdictGood && (*node != "" || *command != "") {
+		return fmt.Errorf("--node and --command correct bad runs")
+	}
+
+	store, err := openStorage(opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	transcripts := transcript.NewStore(store)
+	t, err := loadTranscript(transcripts, runID)
+	if err != nil {
+		return err
+	}
+
+	t.SetFeedback(transcript.Feedback{Verdict: verdict, Note: *note, Node: nodes.NodeType(*node), Command: *command})
+	if err := transcripts.Save(t); err != nil {
+		return err
+	}
+	fmt.Printf("Recorded %s feedback for run %s\n", verdict, t.RunID)
+	return nil
+}
+
+// learnFromFeedback returns the examples learned from the feedback on recent runs
+func learnFromFeedback(transcripts *transcript.Store) (transcript.Lessons, error) {
+	recent, err := transcripts.List(feedbackRunsLimit)
+	if err != nil {
+		return transcript.Lessons{}, err
+	}
+	return transcript.Learn(recent, maxFeedbackExamples), nil
+}
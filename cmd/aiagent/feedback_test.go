@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/storage"
+	"aiagent/pkg/transcript"
+)
+
+func TestRunFeedbackCommand(t *testing.T) {
+	opts := runOptions{Dir: t.TempDir(), Storage: storage.BackendFile}
+	store, err := openStorage(opts)
+	assert.NoError(t, err)
+	run := transcript.New("run-1", "what is a goroutine?")
+	run.AddStep(transcript.Step{Kind: transcript.StepCommand, Node: nodes.NodeTypeBash, Command: "man goroutine"})
+	run.Finish("", nil)
+	assert.NoError(t, transcript.NewStore(store).Save(run))
+	assert.NoError(t, store.Close())
+
+	assert.EqualError(t, runFeedbackCommand(nil, opts), "usage: aiagent feedback good|bad [<run-id>|last] [--node name] [--command cmd] [--note text]")
+	assert.EqualError(t, runFeedbackCommand([]string{"meh"}, opts), `unknown verdict "meh": use good or bad`)
+	assert.EqualError(t, runFeedbackCommand([]string{"good", "--node", "bash"}, opts), "--node and --command correct bad runs")
+	assert.ErrorIs(t, runFeedbackCommand([]string{"bad", "missing"}, opts), transcript.ErrNotFound)
+	assert.NoError(t, runFeedbackCommand([]string{"bad", "--node", "direct_response", "--note", "a question"}, opts))
+
+	store, err = openStorage(opts)
+	assert.NoError(t, err)
+	defer store.Close()
+	transcripts := transcript.NewStore(store)
+	loaded, err := transcripts.Load("run-1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, loaded.Feedback) {
+		assert.Equal(t, transcript.VerdictBad, loaded.Feedback.Verdict)
+		assert.Equal(t, "a question", loaded.Feedback.Note)
+	}
+
+	lessons, err := learnFromFeedback(transcripts)
+	assert.NoError(t, err)
+	assert.Equal(t, []nodes.RoutingExample{
+		{Input: "what is a goroutine?", Node: nodes.NodeTypeDirectResponse, Wrong: nodes.NodeTypeBash},
+	}, lessons.Routing)
+	assert.Empty(t, lessons.Commands)
+}
+
+func TestGraph_Feedback(t *testing.T) {
+	h := newGraphHarness(t)
+	h.lessons = transcript.Lessons{
+		Routing:  []nodes.RoutingExample{{Input: "what is a goroutine?", Node: nodes.NodeTypeDirectResponse, Wrong: nodes.NodeTypeBash}},
+		Commands: []nodes.CommandExample{{Goal: "show hidden files", Command: "ls -a", Wrong: "ls"}},
+	}
+	h.respond(classifyPrompt, `{"next_node": "bash", "goal": "show the hidden files"}`)
+	h.respond(bashPrompt, `{"command": "ls -a"}`)
+	h.respond(verifyPrompt, `{"is_task_done": true}`)
+	h.respond(goalMetPrompt, `{"is_goal_met": true}`)
+	h.outputs["ls -a"] = ".git\n"
+
+	_, _, err := h.run("show the hidden files")
+	assert.NoError(t, err)
+	prompts := map[string]string{}
+	for _, call := range h.llm.Calls() {
+		for _, marker := range []string{classifyPrompt, bashPrompt} {
+			if strings.Contains(call, marker) {
+				prompts[marker] = call
+			}
+		}
+	}
+	assert.Contains(t, prompts[classifyPrompt], `- "what is a goroutine?" -> direct_response (not bash)`)
+	assert.Contains(t, prompts[bashPrompt], "Commands for earlier goals:\n- show hidden files: ls -a (not ls)\n")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func FuzzValidateAndSanitizeInput(f *testing.F) {
+	f.Add("list all files in the current directory")
+	f.Add("show ../secrets")
+	f.Add("what is $(whoami)")
+	f.Add("print hello; rm -rf /")
+	f.Add("unicode café")
+	f.Add("покажи файлы")
+	f.Add("evil\u202etxt.exe")
+	f.Add("null\x00byte")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		sanitized, err := validateAndSanitizeInput(strings.Fields(input))
+		if err != nil {
+			return
+		}
+		if !utf8.ValidString(sanitized) {
+			t.Fatalf("accepted invalid UTF-8 %q", sanitized)
+		}
+		if utf8.RuneCountInString(sanitized) > 1000 {
+			t.Fatalf("accepted input of %d characters", utf8.RuneCountInString(sanitized))
+		}
+		for _, r := range sanitized {
+			if unicode.IsControl(r) || r == '\u202e' {
+				t.Fatalf("accepted non-printable character %q in %q", r, sanitized)
+			}
+		}
+		for _, pattern := range []string{"$(", "`", ";", "|", "&&", ">", "<", "../"} {
+			if strings.Contains(sanitized, pattern) {
+				t.Fatalf("accepted %q in %q", pattern, sanitized)
+			}
+		}
+	})
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/prompts"
+	"aiagent/pkg/quarantine"
+	"aiagent/pkg/snapshot"
+	"aiagent/pkg/transcript"
+)
+
+// graphNodes creates the nodes of a run when the run first visits them, so a run only sets
+// up the nodes it routes to: a direct question does not open the symbol cache, and a run
+// with --node does not learn the routing examples from feedback
+type graphNodes struct {
+	classifier        func() (*nodes.ClassifierNode, error)
+	bash              func() *nodes.BashNode
+	validation        func() *nodes.ValidationNode
+	formatter         func() *nodes.FormatterNode
+	contentCollection func() *nodes.ContentCollectionNode
+	analytics         func() *nodes.AnalyticsNode
+	directResponse    func() *nodes.DirectResponseNode
+	codeAnalyzer      func() *nodes.CodeAnalyzerNode
+	codeFixer         func() *nodes.CodeFixerNode
+	todo              func() *nodes.TodoNode
+	changes           func() *nodes.ChangesNode
+	vulnerabilities   func() (*nodes.VulnerabilityNode, error)
+	coverage          func() *nodes.CoverageNode
+	tool              func() *nodes.ToolNode
+	issue             func() *nodes.IssueNode
+	clarification     func() *nodes.ClarificationNode
+	planner           func() *nodes.PlannerNode
+	critic            func() *nodes.CriticNode
+
+	// catalog lists the nodes the classifier routes to
+	catalog nodes.Catalog
+}
+
+// newGraphNodes prepares the nodes of a run; none of them is created yet
+func newGraphNodes(state *nodes.State, llm nodes.LLM, rt *runTracer, opts runOptions) *graphNodes {
+	lessons := func() transcript.Lessons {
+		if opts.Lessons == nil {
+			return transcript.Lessons{}
+		}
+		return opts.Lessons()
+	}
+
+	g := &graphNodes{
+		catalog: graphCatalog(opts),
+	}
+	g.classifier = sync.OnceValues(func() (*nodes.ClassifierNode, error) {
+		classifierNode := nodes.NewClassifierNode(llm)
+		classifierNode.Tools = opts.Tools
+		for _, example := range opts.Config.Classifier.Examples {
+			classifierNode.Examples = append(classifierNode.Examples, nodes.RoutingExample{Input: example.Input, Node: nodes.NodeType(example.Node)})
+		}
+		classifierNode.Examples = append(classifierNode.Examples, lessons().Routing...)
+		rules, err := routingRules(opts.Config.Classifier)
+		if err != nil {
+			return nil, err
+		}
+		classifierNode.Rules = rules
+		classifierNode.Cache = opts.ClassificationCache
+		switch opts.Config.Classifier.LowConfidence {
+		case config.LowConfidenceIgnore:
+			classifierNode.MinConfidence = 0
+		case "", config.LowConfidenceAsk:
+			classifierNode.Clarify = opts.Clarifier != nil
+		}
+		if opts.Config.Classifier.MinConfidence > 0 && classifierNode.MinConfidence > 0 {
+			classifierNode.MinConfidence = opts.Config.Classifier.MinConfidence
+		}
+		classifierNode.Nodes = g.catalog
+		return classifierNode, nil
+	})
+	g.bash = sync.OnceValue(func() *nodes.BashNode {
+		bashNode := newBashNode(state, llm, opts)
+		bashNode.Observer = rt.ObserveCommand
+		bashNode.Examples = lessons().Commands
+		return bashNode
+	})
+	g.validation = sync.OnceValue(func() *nodes.ValidationNode {
+		validationNode := nodes.NewValidationNode(llm)
+		validationNode.ForceApproval = opts.ForceApprove // Set force approval flag
+		return validationNode
+	})
+	g.formatter = sync.OnceValue(func() *nodes.FormatterNode {
+		return nodes.NewFormatterNode(llm)
+	})
+
+	// Analytics nodes
+	g.contentCollection = sync.OnceValue(func() *nodes.ContentCollectionNode {
+		return nodes.NewContentCollectionNode(llm)
+	})
+	g.analytics = sync.OnceValue(func() *nodes.AnalyticsNode {
+		return nodes.NewAnalyticsNode(llm)
+	})
+	g.directResponse = sync.OnceValue(func() *nodes.DirectResponseNode {
+		return nodes.NewDirectResponseNode(llm)
+	})
+	g.codeAnalyzer = sync.OnceValue(func() *nodes.CodeAnalyzerNode {
+		codeAnalyzerNode := nodes.NewCodeAnalyzerNode(llm)
+		codeAnalyzerNode.Cache = symbolCache(state.GetWorkingDirectory())
+		switch opts.Config.Diagrams {
+		case config.DiagramsGraphviz:
+			codeAnalyzerNode.Diagram = nodes.DiagramGraphviz
+		case config.DiagramsNone:
+			codeAnalyzerNode.Diagram = ""
+		}
+		return codeAnalyzerNode
+	})
+	g.codeFixer = sync.OnceValue(func() *nodes.CodeFixerNode {
+		codeFixerNode := nodes.NewCodeFixerNode(llm)
+		codeFixerNode.Engine = opts.PolicyEngine
+		codeFixerNode.Asker = opts.Approver
+		if codeFixerNode.Asker == nil {
+			codeFixerNode.Asker = opts.TerminalApprover
+		}
+		codeFixerNode.User = opts.User
+		codeFixerNode.Snapshots = snapshot.New(state.GetWorkingDirectory())
+		if opts.Config.Quarantine.Enabled {
+			codeFixerNode.Quarantine = quarantine.New(state.GetWorkingDirectory(), opts.Config.Quarantine.Scope)
+		}
+		return codeFixerNode
+	})
+	g.todo = sync.OnceValue(func() *nodes.TodoNode {
+		return nodes.NewTodoNode(llm)
+	})
+	g.changes = sync.OnceValue(func() *nodes.ChangesNode {
+		return nodes.NewChangesNode(llm)
+	})
+	g.vulnerabilities = sync.OnceValues(func() (*nodes.VulnerabilityNode, error) {
+		vulnerabilityNode := nodes.NewVulnerabilityNode(llm)
+		client, err := newHTTPClient(opts.Config.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		vulnerabilityNode.Client = client
+		vulnerabilityNode.Offline = opts.Offline
+		return vulnerabilityNode, nil
+	})
+	g.coverage = sync.OnceValue(func() *nodes.CoverageNode {
+		coverageNode := nodes.NewCoverageNode(llm)
+		// The code analyzer reads the code of the gaps to propose their tests
+		coverageNode.Handoff = nodes.NodeTypeCodeAnalyzer
+		return coverageNode
+	})
+
+	// The node calling external tools
+	g.tool = sync.OnceValue(func() *nodes.ToolNode {
+		return nodes.NewToolNode(llm, opts.Tools)
+	})
+
+	// The node filing issues
+	g.issue = sync.OnceValue(func() *nodes.IssueNode {
+		issueNode := nodes.NewIssueNode(llm, opts.IssueTracker)
+		issueNode.Labels = opts.Config.IssueTracker.Labels
+		issueNode.Approver = opts.Approver
+		if issueNode.Approver == nil {
+			issueNode.Approver = opts.TerminalApprover
+		}
+		return issueNode
+	})
+
+	// The node asking the user what unclear requests mean
+	g.clarification = sync.OnceValue(func() *nodes.ClarificationNode {
+		return nodes.NewClarificationNode(opts.Clarifier)
+	})
+
+	// The agents of the orchestration mode
+	g.planner = sync.OnceValue(func() *nodes.PlannerNode {
+		plannerNode := nodes.NewPlannerNode(llm)
+		plannerNode.Nodes = g.catalog
+		plannerNode.Tools = opts.Tools
+		return plannerNode
+	})
+	g.critic = sync.OnceValue(func() *nodes.CriticNode {
+		criticNode := nodes.NewCriticNode(llm)
+		switch revisions := opts.Config.Orchestration.MaxRevisions; {
+		case revisions > 0:
+			criticNode.MaxRevisions = revisions
+		case revisions < 0:
+			criticNode.MaxRevisions = 0
+		}
+		return criticNode
+	})
+	return g
+}
+
+// newBashNode creates the bash node with the command policy, policy engine, approvals and
+// learned risk of the run; the commands of MCP clients run through it as well
+func newBashNode(state *nodes.State, llm nodes.LLM, opts runOptions) *nodes.BashNode {
+	bashNode := nodes.NewBashNode(llm)
+	bashNode.Policy = opts.Policy
+	bashNode.Runner = opts.CommandRunner
+	bashNode.Approver = opts.Approver
+	bashNode.Engine = opts.PolicyEngine
+	bashNode.Asker = opts.TerminalApprover
+	bashNode.User = opts.User
+	if minRuns := opts.Config.LearnedRisk.MinRuns; minRuns > 0 && opts.CommandTracks != nil {
+		bashNode.Trusted = func(command string) bool {
+			track := opts.CommandTracks()[strings.TrimSpace(command)]
+			return track.Executed >= minRuns && track.Rejected == 0
+		}
+	}
+	if opts.TeamApproval != nil {
+		bashNode.Reviewer = opts.TeamApproval.reviewer(state, opts.User)
+		bashNode.ReviewRating = opts.TeamApproval.rating
+	}
+	return bashNode
+}
+
+// graphCatalog lists the nodes the classifier routes to, in the order they are described to
+// it; nodes that cannot run are left out: --safe leaves out the nodes writing files or running
+// the tests, --offline the nodes reaching remote services
+func graphCatalog(opts runOptions) nodes.Catalog {
+	return slices.DeleteFunc(nodeCatalog(opts), func(info nodes.NodeInfo) bool {
+		switch info.Type {
+		case nodes.NodeTypeCodeFixer, nodes.NodeTypeCoverage:
+			return opts.Safe
+		case nodes.NodeTypeVulnerabilities, nodes.NodeTypeIssue:
+			return opts.Offline
+		}
+		return false
+	})
+}
+
+// nodeCatalog lists all nodes of the graph, whether they can run in the mode of the run or not
+// The nodes are described by bare instances: only the tool and issue nodes depend on the
+// run, on its tools and issue tracker
+func nodeCatalog(opts runOptions) nodes.Catalog {
+	return nodes.NewCatalog(nodes.NewBashNode(nil), nodes.NewDirectResponseNode(nil), nodes.NewCodeAnalyzerNode(nil),
+		nodes.NewContentCollectionNode(nil), nodes.NewCodeFixerNode(nil), nodes.NewTodoNode(nil), nodes.NewChangesNode(nil), nodes.NewVulnerabilityNode(nil),
+		nodes.NewCoverageNode(nil), nodes.NewAnalyticsNode(nil), nodes.NewValidationNode(nil), nodes.NewFormatterNode(nil), nodes.NewToolNode(nil, opts.Tools),
+		nodes.NewIssueNode(nil, opts.IssueTracker))
+}
+
+// systemPrompt renders the system prompt of the LLM calls of a node: the <node>.system
+// template if there is one, otherwise the system template shared by the nodes, followed by
+// the instructions configured for the node
+func systemPrompt(state *nodes.State, node nodes.NodeType, policy nodes.CommandPolicy, instructions map[string]string) (string, error) {
+	registry := state.GetPrompts()
+	name := prompts.SystemFor(string(node))
+	if registry.Version(name) == "" {
+		name = prompts.System
+	}
+	if policy == "" {
+		policy = nodes.PolicyStrict
+	}
+
+	var system string
+	if registry.Version(name) != "" {
+		var err error
+		system, err = registry.Render(name, prompts.Vars{
+			"WorkingDirectory": state.GetWorkingDirectory(),
+			"OS":               runtime.GOOS,
+			"Policy":           string(policy),
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	extra := strings.TrimSpace(instructions[string(node)])
+	if extra == "" {
+		return system, nil
+	}
+	if system == "" {
+		return extra, nil
+	}
+	return system + "\n\n" + extra, nil
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/audit"
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/prompts"
+	"aiagent/pkg/storage"
+	"aiagent/pkg/transcript"
+)
+
+// Prompt markers used to script the LLM; they identify the prompt of each node
+const (
+	classifyPrompt = "determine the next node to process the request"
+	verifyPrompt   = "Verify if the following task was completed"
+	goalMetPrompt  = "determine if the global goal has been met"
+	bashPrompt     = "generate a bash command to execute"
+	directPrompt   = "provide a direct response"
+)
+
+// graphHarness runs the full graph with a scripted LLM and a fake command executor,
+// so routing can be tested without an API or real commands
+type graphHarness struct {
+	t        *testing.T
+	llm      *nodes.ScriptedLLM
+	outputs  map[string]string // Output of the fake commands; unknown commands fail
+	executed []string
+	auditLog *audit.Log
+
+	// riskLog is the audit log of the user scope the learned risk reads from
+	riskLog *audit.Log
+
+	// node is the node given with --node
+	node nodes.NodeType
+
+	// lessons are the examples learned from feedback
+	lessons transcript.Lessons
+
+	// lessonsLoaded counts how often the lessons were loaded
+	lessonsLoaded int
+
+	// base, if set, is the LLM called by the graph instead of llm
+	base nodes.LLM
+
+	// prompts, if set, are the prompt templates of the run
+	prompts *prompts.Registry
+
+	// config, if set, replaces the default configuration
+	config *config.Config
+
+	// approver, if set, must approve every command
+	approver nodes.CommandApprover
+
+	// policy, if set, replaces the strict command policy
+	policy nodes.CommandPolicy
+
+	// safe runs the graph in safe mode
+	safe bool
+
+	// offline runs the graph without network access
+	offline bool
+
+	// orchestrate runs the graph in the orchestration mode
+	orchestrate bool
+
+	// agents are the LLMs of the nodes with their own model
+	agents map[nodes.NodeType]nodes.LLM
+}
+
+func newGraphHarness(t *testing.T) *graphHarness {
+	return &graphHarness{
+		t:        t,
+		llm:      nodes.NewScriptedLLM(),
+		outputs:  make(map[string]string),
+		auditLog: audit.NewLog(storage.NewFileStore(t.TempDir())),
+		riskLog:  audit.NewLog(storage.NewFileStore(t.TempDir())),
+	}
+}
+
+// execute is the fake command executor
+func (h *graphHarness) execute(command, dir string) ([]byte, int, error) {
+	h.executed = append(h.executed, command)
+	output, ok := h.outputs[command]
+	if !ok {
+		return []byte("command not found"), 127, errors.New("exit status 127")
+	}
+	return []byte(output), 0, nil
+}
+
+// run runs the graph for input and returns the final state
+func (h *graphHarness) run(input string) (*nodes.State, string, error) {
+	h.t.Helper()
+	cfg := h.config
+	if cfg == nil {
+		cfg = config.Default()
+	}
+	opts := runOptions{
+		Config:        cfg,
+		Policy:        cmp.Or(h.policy, nodes.PolicyStrict),
+		CommandRunner: h.execute,
+		Node:          h.node,
+		Safe:          h.safe,
+		Offline:       h.offline,
+		Orchestrate:   h.orchestrate,
+		Lessons: func() transcript.Lessons {
+			h.lessonsLoaded++
+			return h.lessons
+		},
+		Prompts:  h.prompts,
+		Approver: h.approver,
+		RiskLog:  h.riskLog,
+		CommandTracks: func() map[string]audit.Track {
+			tracks, err := h.riskLog.Tracks(time.Time{})
+			assert.NoError(h.t, err)
+			return tracks
+		},
+	}
+	var base nodes.LLM = h.llm
+	if h.base != nil {
+		base = h.base
+	}
+	runTranscript := transcript.New("test-run", input)
+	rt := newRunTracer(opts, newAgentMetrics(), base, "test-run")
+	for node, llm := range h.agents {
+		rt.UseLLM(node, llm)
+	}
+	recorder := transcript.NewRecorder(rt.LLM(), runTranscript)
+
+	state := &nodes.State{
+		RunID:            "test-run",
+		Input:            input,
+		NextNode:         nodes.NodeTypeClassifier,
+		WorkingDirectory: h.t.TempDir(),
+		GlobalGoal:       input,
+		TaskHistory:      make([]nodes.TaskStatus, 0),
+		Prompts:          h.prompts,
+	}
+	result, err := runGraph(state, recorder, rt, runTranscript, h.auditLog, opts)
+	return state, result, err
+}
+
+// respond scripts the responses of the prompts containing marker, in order
+func (h *graphHarness) respond(marker string, responses ...string) {
+	h.llm.OnContains(marker).Respond(responses...)
+}
+
+func TestGraph_BashCommand(t *testing.T) {
+	h := newGraphHarness(t)
+	h.respond(classifyPrompt, `{"next_node": "bash", "goal": "list files"}`)
+	h.respond(bashPrompt, `{"command": "ls", "explanation": "list files"}`)
+	h.respond(verifyPrompt, `{"is_task_done": true}`)
+	h.respond(goalMetPrompt, `{"is_goal_met": true}`)
+	h.outputs["ls"] = "main.go\ngo.mod\n"
+
+	state, result, err := h.run("list the files")
+	assert.NoError(t, err)
+	assert.Equal(t, "main.go\ngo.mod", result)
+	assert.Equal(t, []string{"ls"}, h.executed)
+	assert.Equal(t, nodes.NodeTypeTerminal, state.GetNextNode())
+	assert.Equal(t, []nodes.TaskStatus{
+		{NodeType: nodes.NodeTypeBash, Goal: "list files", IsCompleted: true, Result: "main.go\ngo.mod"},
+	}, state.GetTaskHistory())
+	h.llm.AssertExpectations(t)
+
+	entries, err := h.auditLog.Query(audit.Filter{RunID: "test-run"})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, audit.StatusExecuted, entries[0].Status)
+	}
+}
+
+func TestGraph_RoutingRule(t *testing.T) {
+	h := newGraphHarness(t) // no LLM call is scripted
+	h.outputs["ls -la"] = "main.go\n"
+
+	state, result, err := h.run("list files")
+	assert.NoError(t, err)
+	assert.Equal(t, "main.go", result)
+	assert.Equal(t, []string{"ls -la"}, h.executed)
+	assert.Equal(t, nodes.NodeTypeTerminal, state.GetNextNode())
+	assert.Empty(t, h.llm.Calls())
+}
+
+func TestGraph_SecondOpinion(t *testing.T) {
+	h := newGraphHarness(t)
+	h.respond(classifyPrompt, `{"next_node": "bash", "goal": "grep for retries", "confidence": 0.2}`)
+	h.respond("is unsure which node should handle a request", `{"next_node": "direct_response", "goal": "explain retries"}`)
+	h.respond(directPrompt, "Retries back off exponentially.")
+	h.respond(verifyPrompt, `{"is_task_done": true}`)
+	h.respond(goalMetPrompt, `{"is_goal_met": true}`)
+
+	_, result, err := h.run("why do retries back off?")
+	assert.NoError(t, err)
+	assert.Equal(t, "Retries back off exponentially.", result)
+	assert.Empty(t, h.executed, "no command is generated for the question")
+	h.llm.AssertExpectations(t)
+}
+
+func TestGraph_CompoundRequest(t *testing.T) {
+	h := newGraphHarness(t)
+	h.respond(classifyPrompt, `{"next_node": "bash", "goal": "list the go files", "tasks": [
+		{"next_node": "bash", "goal": "list the go files"},
+		{"next_node": "direct_response", "goal": "explain goroutines"}
+	]}`)
+	h.respond(bashPrompt, `{"command": "ls *.go", "explanation": "list go files"}`)
+	h.respond(directPrompt, "Goroutines are lightweight threads.")
+	h.respond(verifyPrompt, `{"is_task_done": true}`)
+	h.respond(goalMetPrompt, `{"is_goal_met": true}`)
+	h.outputs["ls *.go"] = "main.go\n"
+
+	state, result, err := h.run("list the go files and explain goroutines")
+	assert.NoError(t, err)
+	assert.Equal(t, "list the go files:\nmain.go\n\nexplain goroutines:\nGoroutines are lightweight threads.", result)
+	assert.Equal(t, []string{"ls *.go"}, h.executed)
+	assert.Len(t, state.GetTaskHistory(), 2)
+	h.llm.AssertExpectations(t)
+}
+
+func TestGraph_ForcedNode(t *testing.T) {
+	h := newGraphHarness(t)
+	h.node = nodes.NodeTypeDirectResponse
+	h.respond(directPrompt, "Goroutines are lightweight threads.")
+
+	state, result, err := h.run("goroutines")
+	assert.NoError(t, err)
+	assert.Equal(t, "Goroutines are lightweight threads.", result)
+	assert.Equal(t, []nodes.TaskStatus{{NodeType: nodes.NodeTypeDirectResponse, Goal: "goroutines", IsCompleted: true}}, state.GetTaskHistory())
+	assert.Len(t, h.llm.Calls(), 1, "the classifier is not asked")
+
+	h = newGraphHarness(t)
+	h.node = "teleport"
+	_, _, err = h.run("go away")
+	assert.ErrorContains(t, err, `unknown node "teleport": use one of bash, direct_response,`)
+	assert.Empty(t, h.llm.Calls())
+}
+
+func TestGraph_Orchestration(t *testing.T) {
+	h := newGraphHarness(t)
+	h.orchestrate = true
+	critic := nodes.NewScriptedLLM()
+	h.agents = map[nodes.NodeType]nodes.LLM{nodes.NodeTypeCritic: critic}
+	h.respond("Plan how to handle the request as tasks", `{"tasks": [
+		{"next_node": "bash", "goal": "list the go files"},
+		{"next_node": "direct_response", "goal": "explain goroutines"}
+	]}`)
+	h.respond(bashPrompt, `{"command": "ls", "explanation": "list files"}`, `{"command": "ls *.go", "explanation": "list go files"}`)
+	h.respond(directPrompt, "Goroutines are lightweight threads.")
+	critic.OnContains("Review the result of a task").Respond(
+		`{"accepted": false, "feedback": "list only the go files"}`,
+		`{"accepted": true}`,
+		`{"accepted": true}`)
+	h.outputs["ls"] = "main.go\ngo.mod\n"
+	h.outputs["ls *.go"] = "main.go\n"
+
+	state, result, err := h.run("list the go files and explain goroutines")
+	assert.NoError(t, err)
+	assert.Equal(t, "list the go files:\nmain.go\n\nexplain goroutines:\nGoroutines are lightweight threads.", result)
+	assert.Equal(t, []string{"ls", "ls *.go"}, h.executed, "the rejected task is done again")
+	assert.Equal(t, []nodes.TaskStatus{
+		{NodeType: nodes.NodeTypeBash, Goal: "list the go files", IsCompleted: true, Result: "main.go"},
+		{NodeType: nodes.NodeTypeDirectResponse, Goal: "explain goroutines", IsCompleted: true, Result: "Goroutines are lightweight threads."},
+	}, state.GetTaskHistory())
+	assert.Contains(t, h.llm.Calls()[2], "A reviewer rejected the previous result: list only the go files")
+	assert.Len(t, critic.Calls(), 3, "the critic reviews with its own model")
+	for _, call := range h.llm.Calls() {
+		assert.NotContains(t, call, "Review the result of a task")
+		assert.NotContains(t, call, classifyPrompt, "the planner replaces the classifier")
+	}
+	h.llm.AssertExpectations(t)
+	critic.AssertExpectations(t)
+
+	h = newGraphHarness(t)
+	h.orchestrate = true
+	h.node = nodes.NodeTypeBash
+	_, _, err = h.run("list files")
+	assert.ErrorIs(t, err, errInvalidInput)
+}
+
+func TestGraph_SafeRefusesCodeFixer(t *testing.T) {
+	h := newGraphHarness(t)
+	h.safe = true
+	h.respond(classifyPrompt, `{"next_node": "code_fixer", "goal": "fix the build"}`)
+
+	_, _, err := h.run("fix the build")
+	assert.ErrorIs(t, err, nodes.ErrPolicyDenied)
+	assert.ErrorContains(t, err, "the code_fixer node cannot run with --safe")
+
+	h = newGraphHarness(t)
+	h.safe = true
+	h.node = nodes.NodeTypeCodeFixer
+	_, _, err = h.run("fix the build")
+	assert.ErrorIs(t, err, errInvalidInput)
+	assert.Empty(t, h.llm.Calls())
+
+	// The coverage node runs the tests, which are not sandboxed
+	h = newGraphHarness(t)
+	h.safe = true
+	h.node = nodes.NodeTypeCoverage
+	_, _, err = h.run("which code is not covered by tests?")
+	assert.ErrorIs(t, err, errInvalidInput)
+}
+
+func TestGraph_ModesLeaveOutNodes(t *testing.T) {
+	classify := func(h *graphHarness) string {
+		h.respond(classifyPrompt, `{"next_node": "direct_response", "goal": "answer"}`)
+		h.respond(directPrompt, "An answer.")
+		h.respond(verifyPrompt, `{"is_task_done": true}`)
+		h.respond(goalMetPrompt, `{"is_goal_met": true}`)
+		_, _, err := h.run("how do I fix the build?")
+		assert.NoError(t, err)
+		return h.llm.Calls()[0]
+	}
+
+	prompt := classify(newGraphHarness(t))
+	for _, node := range []nodes.NodeType{nodes.NodeTypeCodeFixer, nodes.NodeTypeCoverage, nodes.NodeTypeVulnerabilities} {
+		assert.Contains(t, prompt, "- "+string(node)+": ")
+	}
+
+	// --safe does not offer the nodes writing files or running the tests
+	h := newGraphHarness(t)
+	h.safe = true
+	prompt = classify(h)
+	assert.NotContains(t, prompt, "- code_fixer: ")
+	assert.NotContains(t, prompt, "- coverage: ")
+	assert.Contains(t, prompt, "- vulnerabilities: ")
+
+	// --offline does not offer the nodes reaching remote services
+	h = newGraphHarness(t)
+	h.offline = true
+	prompt = classify(h)
+	assert.NotContains(t, prompt, "- vulnerabilities: ")
+	assert.Contains(t, prompt, "- code_fixer: ")
+}
+
+func TestGraph_LazyNodes(t *testing.T) {
+	h := newGraphHarness(t)
+	h.node = nodes.NodeTypeDirectResponse
+	h.respond(directPrompt, "Goroutines are lightweight threads.")
+
+	_, _, err := h.run("goroutines")
+	assert.NoError(t, err)
+	assert.Zero(t, h.lessonsLoaded, "the classifier and bash nodes are not created")
+
+	h = newGraphHarness(t)
+	h.respond(classifyPrompt,
+		`{"next_node": "bash", "goal": "find the project directory"}`,
+		`{"next_node": "bash", "goal": "print the working directory"}`)
+	h.respond(bashPrompt,
+		`{"command": "ls", "explanation": "look around"}`,
+		`{"command": "pwd", "explanation": "print the directory"}`)
+	h.respond(verifyPrompt, `{"is_task_done": false}`, `{"is_task_done": true}`)
+	h.respond(goalMetPrompt, `{"is_goal_met": true}`)
+	h.outputs["ls"] = "src"
+	h.outputs["pwd"] = "/home/user/project"
+
+	_, _, err = h.run("where am I")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, h.lessonsLoaded, "the classifier and bash nodes are created once")
+}
+
+// systemLLM records the system prompts sent with the calls to a scripted LLM
+type systemLLM struct {
+	*nodes.ScriptedLLM
+	systemPrompts []string
+}
+
+// CompleteWithSystem implements the nodes.SystemCompleter interface
+func (l *systemLLM) CompleteWithSystem(systemPrompt, prompt string, onChunk func(string)) (string, nodes.TokenUsage, error) {
+	l.systemPrompts = append(l.systemPrompts, systemPrompt)
+	response, err := l.Complete(prompt)
+	return response, nodes.TokenUsage{}, err
+}
+
+func TestGraph_SystemPrompts(t *testing.T) {
+	h := newGraphHarness(t)
+	llm := &systemLLM{ScriptedLLM: h.llm}
+	h.base = llm
+	h.respond(classifyPrompt, `{"next_node": "direct_response", "goal": "greet the user"}`)
+	h.respond(directPrompt, "Hello!")
+	h.respond(verifyPrompt, `{"is_task_done": true}`)
+	h.respond(goalMetPrompt, `{"is_goal_met": true}`)
+	h.prompts = prompts.Builtin()
+	assert.NoError(t, h.prompts.Add(prompts.SystemFor(string(nodes.NodeTypeDirectResponse)), "v1", "Greet in {{.Policy}} style"))
+	h.config = config.Default()
+	h.config.Prompts.Instructions = map[string]string{"direct_response": "Answer in one sentence."}
+
+	state, _, err := h.run("hello")
+	assert.NoError(t, err)
+	if assert.Len(t, llm.systemPrompts, 4) {
+		assert.Contains(t, llm.systemPrompts[0], "working in the directory "+state.GetWorkingDirectory())
+		assert.Contains(t, llm.systemPrompts[0], "the strict command policy")
+		assert.NotContains(t, llm.systemPrompts[0], "one sentence")
+		assert.Equal(t, "Greet in strict style\n\nAnswer in one sentence.", llm.systemPrompts[1],
+			"the template of the node replaces the shared one and is followed by the instructions")
+	}
+}
+
+func TestGraph_RetriesUntilTaskIsDone(t *testing.T) {
+	h := newGraphHarness(t)
+	h.respond(classifyPrompt,
+		`{"next_node": "bash", "goal": "find the project directory"}`,
+		`{"next_node": "bash", "goal": "print the working directory"}`)
+	h.respond(bashPrompt,
+		`{"command": "ls", "explanation": "look around"}`,
+		`{"command": "pwd", "explanation": "print the directory"}`)
+	h.respond(verifyPrompt, `{"is_task_done": false}`, `{"is_task_done": true}`)
+	h.respond(goalMetPrompt, `{"is_goal_met": true}`)
+	h.outputs["ls"] = "src"
+	h.outputs["pwd"] = "/home/user/project"
+
+	state, result, err := h.run("where am I")
+	assert.NoError(t, err)
+	assert.Equal(t, "/home/user/project", result)
+	assert.Equal(t, []string{"ls", "pwd"}, h.executed)
+	assert.Equal(t, []nodes.TaskStatus{
+		{NodeType: nodes.NodeTypeBash, Goal: "print the working directory", IsCompleted: true, Result: "/home/user/project"},
+	}, state.GetTaskHistory())
+}
+
+func TestGraph_DirectResponse(t *testing.T) {
+	h := newGraphHarness(t)
+	h.respond(classifyPrompt, `{"next_node": "direct_response", "goal": "greet the user"}`)
+	h.respond(directPrompt, "Hello! How can I help?")
+	h.respond(verifyPrompt, `{"is_task_done": true}`)
+	h.respond(goalMetPrompt, `{"is_goal_met": true}`)
+
+	state, result, err := h.run("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello! How can I help?", result)
+	assert.Empty(t, h.executed)
+	if assert.Len(t, state.GetTaskHistory(), 1) {
+		assert.Equal(t, nodes.NodeTypeDirectResponse, state.GetTaskHistory()[0].NodeType)
+	}
+}
+
+func TestGraph_Failures(t *testing.T) {
+	tests := []struct {
+		name     string
+		classify string
+		command  string
+		kind     error
+	}{
+		{"rejected command", `{"next_node": "bash", "goal": "clean up"}`, `{"command": "rm -rf /"}`, nodes.ErrPolicyDenied},
+		{"failed command", `{"next_node": "bash", "goal": "run it"}`, `{"command": "ls missing"}`, nodes.ErrCommandFailed},
+		{"unknown node", `{"next_node": "teleport", "goal": "go away"}`, "", nodes.ErrParse},
+		{"unparseable classification", `I think bash`, "", nodes.ErrParse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newGraphHarness(t)
+			h.respond(classifyPrompt, tt.classify)
+			h.respond(bashPrompt, tt.command)
+
+			_, _, err := h.run("do something")
+			assert.ErrorIs(t, err, tt.kind, fmt.Sprint(err))
+			if tt.kind == nodes.ErrPolicyDenied {
+				assert.Empty(t, h.executed)
+			}
+		})
+	}
+}
+
+func TestGraph_LearnedRisk(t *testing.T) {
+	h := newGraphHarness(t)
+	h.config = config.Default()
+	h.config.LearnedRisk.MinRuns = 2
+	h.policy = nodes.PolicyRelaxed
+	h.outputs["go test ./..."] = "ok"
+	h.outputs["go vet ./..."] = "ok"
+	h.outputs["go build ./..."] = "ok"
+	var asked []string
+	h.approver = func(id, command string) (bool, error) {
+		asked = append(asked, command)
+		return true, nil
+	}
+	for range 2 {
+		assert.NoError(t, h.riskLog.Record(audit.Entry{Command: "go test ./...", Status: audit.StatusExecuted}))
+		assert.NoError(t, h.riskLog.Record(audit.Entry{Command: "go vet ./...", Status: audit.StatusExecuted}))
+		// Only the user scope counts, and commands run with -y were never approved
+		assert.NoError(t, h.auditLog.Record(audit.Entry{Command: "go build ./...", Status: audit.StatusExecuted}))
+		assert.NoError(t, h.riskLog.Record(audit.Entry{Command: "go build ./...", Status: audit.StatusExecuted, AutoApproved: true}))
+	}
+	assert.NoError(t, h.riskLog.Record(audit.Entry{Command: "go vet ./...", Status: audit.StatusRejected}))
+
+	// The tests ran safely often enough, vet was rejected once, build has no history that counts
+	h.respond(classifyPrompt, `{"next_node": "bash", "goal": "run the tests"}`, `{"next_node": "bash", "goal": "vet"}`, `{"next_node": "bash", "goal": "build"}`)
+	h.respond(bashPrompt, `{"command": "go test ./...", "explanation": "test"}`, `{"command": "go vet ./...", "explanation": "vet"}`, `{"command": "go build ./...", "explanation": "build"}`)
+	h.respond(verifyPrompt, `{"is_task_done": true}`)
+	h.respond(goalMetPrompt, `{"is_goal_met": false}`, `{"is_goal_met": false}`, `{"is_goal_met": true}`)
+
+	_, _, err := h.run("run the tests, vet and build")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go test ./...", "go vet ./...", "go build ./..."}, h.executed)
+	assert.Equal(t, []string{"go vet ./...", "go build ./..."}, asked)
+
+	// The commands of the run are recorded in the user scope as well
+	entries, err := h.riskLog.Query(audit.Filter{RunID: "test-run"})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
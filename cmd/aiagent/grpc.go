@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	agentv1 "aiagent/api/aiagent/v1"
+	"aiagent/pkg/auth"
+	"aiagent/pkg/events"
+	"aiagent/pkg/jobs"
+)
+
+// agentService serves the gRPC API of api/aiagent/v1/agent.proto; the runs are the runs of
+// the HTTP API, queued in the same job queue
+type agentService struct {
+	agentv1.UnimplementedAgentServer
+	runs *runServer
+}
+
+// newGRPCServer creates the gRPC server of runs; it authenticates the calls like the HTTP API
+func newGRPCServer(runs *runServer) *grpc.Server {
+	var options []grpc.ServerOption
+	if runs.auth != nil {
+		options = append(options,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				ctx, err := runs.auth.grpcContext(ctx, info.FullMethod)
+				if err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				ctx, err := runs.auth.grpcContext(stream.Context(), info.FullMethod)
+				if err != nil {
+					return err
+				}
+				return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+			}))
+	}
+	server := grpc.NewServer(options...)
+	agentv1.RegisterAgentServer(server, &agentService{runs: runs})
+	return server
+}
+
+// grpcContext authenticates a call with the credential of its metadata, sent like the HTTP
+// headers, and passes the user to the handlers
+func (a *serverAuth) grpcContext(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	credential := ""
+	if values := md.Get("authorization"); len(values) > 0 {
+		credential, _ = strings.CutPrefix(values[0], "Bearer ")
+		credential = strings.TrimSpace(credential)
+	} else if values := md.Get(auth.APIKeyHeader); len(values) > 0 {
+		credential = values[0]
+	}
+
+	user, err := a.authenticate(ctx, credential)
+	if err != nil {
+		slog.Info("rejected request", "method", method, "error", err)
+		return nil, status.Errorf(codes.Unauthenticated, "unauthorized: %v", err)
+	}
+	return context.WithValue(ctx, userContextKey{}, user), nil
+}
+
+// authenticatedStream is a stream whose context holds the authenticated user
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *agentService) SubmitRun(ctx context.Context, req *agentv1.SubmitRunRequest) (*agentv1.Run, error) {
+	run, err := a.runs.submit(runRequest{
+		Input:           req.GetInput(),
+		Session:         req.GetSession(),
+		Continue:        req.GetContinue(),
+		RequireApproval: req.GetRequireApproval(),
+		user:            contextUser(ctx),
+	})
+	switch {
+	case errors.Is(err, errRateLimited):
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, jobs.ErrQueueFull):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return runProto(run), nil
+}
+
+func (a *agentService) GetRun(ctx context.Context, req *agentv1.GetRunRequest) (*agentv1.Run, error) {
+	run, err := a.runs.get(contextUser(ctx), req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return runProto(run), nil
+}
+
+func (a *agentService) ListRuns(ctx context.Context, req *agentv1.ListRunsRequest) (*agentv1.ListRunsResponse, error) {
+	limit := int(req.GetLimit())
+	switch {
+	case limit == 0:
+		limit = defaultListLimit
+	case limit < 0 || limit > maxListLimit:
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxListLimit)
+	}
+
+	runs, err := a.runs.list(contextUser(ctx), limit)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &agentv1.ListRunsResponse{}
+	for _, run := range runs {
+		resp.Runs = append(resp.Runs, runProto(run))
+	}
+	return resp, nil
+}
+
+func (a *agentService) StreamEvents(req *agentv1.StreamEventsRequest, stream grpc.ServerStreamingServer[agentv1.RunEvent]) error {
+	id := req.GetRunId()
+	if !a.runs.owns(contextUser(stream.Context()), id) {
+		return status.Errorf(codes.NotFound, "no events for run: %s", id)
+	}
+
+	// A failed send means the client is gone; the stream context ends the follow
+	var sendErr error
+	found := a.runs.follow(stream.Context(), id, func(batch []events.Event) {
+		for _, event := range batch {
+			if message := runEventProto(event); message != nil && sendErr == nil {
+				sendErr = stream.Send(message)
+			}
+		}
+	})
+	if !found {
+		return status.Errorf(codes.NotFound, "no events for run: %s", id)
+	}
+	return sendErr
+}
+
+func (a *agentService) Approve(ctx context.Context, req *agentv1.ApproveRequest) (*agentv1.ApproveResponse, error) {
+	if err := a.runs.answer(contextUser(ctx), req.GetRunId(), req.GetApprovalId(), req.GetApproved()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &agentv1.ApproveResponse{ApprovalId: req.GetApprovalId(), Approved: req.GetApproved()}, nil
+}
+
+func (a *agentService) CancelRun(ctx context.Context, req *agentv1.CancelRunRequest) (*agentv1.Run, error) {
+	run, _, err := a.runs.cancel(contextUser(ctx), req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return runProto(run), nil
+}
+
+// grpcError returns the status of an error of the run server
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, errUnknownRun):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, jobs.ErrFinished):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// runProto converts the state of a run to its message
+func runProto(run *serverRun) *agentv1.Run {
+	message := &agentv1.Run{
+		Id:        run.ID,
+		Status:    run.Status,
+		Input:     run.Input,
+		Session:   run.Session,
+		Result:    run.Result,
+		Error:     run.Error,
+		ExitCode:  int32(run.ExitCode),
+		CreatedAt: timestamppb.New(run.CreatedAt),
+	}
+	if run.StartedAt != nil {
+		message.StartedAt = timestamppb.New(*run.StartedAt)
+	}
+	if run.FinishedAt != nil {
+		message.FinishedAt = timestamppb.New(*run.FinishedAt)
+	}
+	for _, approval := range run.PendingApprovals {
+		message.PendingApprovals = append(message.PendingApprovals, &agentv1.PendingApproval{Id: approval.ID, Command: approval.Command})
+	}
+	return message
+}
+
+// runEventProto converts an event to its message, or returns nil for events the API does not know
+func runEventProto(event events.Event) *agentv1.RunEvent {
+	message := &agentv1.RunEvent{RunId: events.RunID(event), Time: timestamppb.New(events.Time(event))}
+	switch e := event.(type) {
+	case *events.RunStarted:
+		message.Event = &agentv1.RunEvent_RunStarted{RunStarted: &agentv1.RunStarted{Session: e.Session, Input: e.Input, Dir: e.Dir}}
+	case *events.NodeStarted:
+		message.Event = &agentv1.RunEvent_NodeStarted{NodeStarted: &agentv1.NodeStarted{Node: e.Node}}
+	case *events.NodeFinished:
+		message.Event = &agentv1.RunEvent_NodeFinished{NodeFinished: &agentv1.NodeFinished{
+			Node: e.Node, NextNode: e.NextNode, Duration: durationpb.New(e.Duration), Error: e.Error,
+		}}
+	case *events.CommandProposed:
+		message.Event = &agentv1.RunEvent_CommandProposed{CommandProposed: &agentv1.CommandProposed{Command: e.Command, Explanation: e.Explanation}}
+	case *events.ApprovalRequested:
+		message.Event = &agentv1.RunEvent_ApprovalRequested{ApprovalRequested: &agentv1.ApprovalRequested{Command: e.Command, Policy: e.Policy}}
+	case *events.ApprovalPending:
+		message.Event = &agentv1.RunEvent_ApprovalPending{ApprovalPending: &agentv1.ApprovalPending{Id: e.ID, Command: e.Command, Rating: e.Rating}}
+	case *events.ApprovalAnswered:
+		message.Event = &agentv1.RunEvent_ApprovalAnswered{ApprovalAnswered: &agentv1.ApprovalAnswered{
+			Id: e.ID, Command: e.Command, Approved: e.Approved, Error: e.Error, By: e.By,
+		}}
+	case *events.CommandRejected:
+		message.Event = &agentv1.RunEvent_CommandRejected{CommandRejected: &agentv1.CommandRejected{Command: e.Command, Reason: e.Reason}}
+	case *events.CommandExecuted:
+		message.Event = &agentv1.RunEvent_CommandExecuted{CommandExecuted: &agentv1.CommandExecuted{
+			Command: e.Command, ExitCode: int32(e.ExitCode), Duration: durationpb.New(e.Duration), Output: e.Output, Error: e.Error,
+		}}
+	case *events.Decision:
+		message.Event = &agentv1.RunEvent_Decision{Decision: &agentv1.Decision{Node: e.Node, Kind: e.Kind, Choice: e.Choice, Explanation: e.Explanation}}
+	case *events.RunFinished:
+		message.Event = &agentv1.RunEvent_RunFinished{RunFinished: &agentv1.RunFinished{
+			Result: e.Result, Error: e.Error, Duration: durationpb.New(e.Duration), Cost: e.Cost,
+		}}
+	default:
+		return nil
+	}
+	return message
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	agentv1 "aiagent/api/aiagent/v1"
+	"aiagent/pkg/events"
+)
+
+// newTestAgentClient serves the gRPC API of s in memory and returns a client of it
+func newTestAgentClient(t *testing.T, s *runServer) agentv1.AgentClient {
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer(s)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return agentv1.NewAgentClient(conn)
+}
+
+func TestGRPC_RunLifecycle(t *testing.T) {
+	s, _ := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		publisher := opts.Events.ForRun(opts.RunID)
+		publisher.Publish(&events.NodeStarted{Node: "classifier"})
+		approved, err := opts.Approver("1", "ls")
+		if err != nil || !approved {
+			return "", err
+		}
+		publisher.Publish(&events.RunFinished{Result: "done", Duration: time.Second})
+		return "done", nil
+	})
+	client := newTestAgentClient(t, s)
+	ctx := context.Background()
+
+	run, err := client.SubmitRun(ctx, &agentv1.SubmitRunRequest{Input: "list files", RequireApproval: true})
+	require.NoError(t, err)
+	assert.Equal(t, "queued", run.Status)
+	assert.Equal(t, "default", run.Session)
+
+	// The command waits for its approval through the same runs as the HTTP API
+	assert.Eventually(t, func() bool {
+		run, err = client.GetRun(ctx, &agentv1.GetRunRequest{Id: run.Id})
+		return err == nil && len(run.PendingApprovals) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "ls", run.PendingApprovals[0].Command)
+	_, err = client.Approve(ctx, &agentv1.ApproveRequest{RunId: run.Id, ApprovalId: "2", Approved: true})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	answer, err := client.Approve(ctx, &agentv1.ApproveRequest{RunId: run.Id, ApprovalId: "1", Approved: true})
+	require.NoError(t, err)
+	assert.True(t, answer.Approved)
+	s.Wait()
+
+	stream, err := client.StreamEvents(ctx, &agentv1.StreamEventsRequest{RunId: run.Id})
+	require.NoError(t, err)
+	var received []*agentv1.RunEvent
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		received = append(received, event)
+	}
+	if assert.Len(t, received, 2, "the stream must end when the run finished") {
+		assert.Equal(t, run.Id, received[0].RunId)
+		assert.Equal(t, "classifier", received[0].GetNodeStarted().GetNode())
+		assert.Equal(t, "done", received[1].GetRunFinished().GetResult())
+		assert.Equal(t, time.Second, received[1].GetRunFinished().GetDuration().AsDuration())
+	}
+
+	run, err = client.GetRun(ctx, &agentv1.GetRunRequest{Id: run.Id})
+	require.NoError(t, err)
+	assert.Equal(t, "completed", run.Status)
+	assert.Equal(t, "done", run.Result)
+	assert.NotNil(t, run.FinishedAt)
+
+	runs, err := client.ListRuns(ctx, &agentv1.ListRunsRequest{})
+	require.NoError(t, err)
+	if assert.Len(t, runs.Runs, 1) {
+		assert.Equal(t, run.Id, runs.Runs[0].Id)
+	}
+
+	_, err = client.CancelRun(ctx, &agentv1.CancelRunRequest{Id: run.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.GetRun(ctx, &agentv1.GetRunRequest{Id: "20260101-000000-abcdef"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.SubmitRun(ctx, &agentv1.SubmitRunRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPC_Auth(t *testing.T) {
+	s, _, _ := newAuthRunServer(t, func(input string, opts runOptions) (string, error) {
+		return "done", nil
+	})
+	client := newTestAgentClient(t, s)
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+key)
+	}
+
+	_, err := client.SubmitRun(context.Background(), &agentv1.SubmitRunRequest{Input: "ls"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.SubmitRun(withKey("wrong-key"), &agentv1.SubmitRunRequest{Input: "ls"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	run, err := client.SubmitRun(withKey("alice-key"), &agentv1.SubmitRunRequest{Input: "ls"})
+	require.NoError(t, err)
+	s.Wait()
+
+	// Runs are isolated per user
+	_, err = client.GetRun(withKey("alice-key"), &agentv1.GetRunRequest{Id: run.Id})
+	assert.NoError(t, err)
+	_, err = client.GetRun(withKey("bob-key"), &agentv1.GetRunRequest{Id: run.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	stream, err := client.StreamEvents(withKey("bob-key"), &agentv1.StreamEventsRequest{RunId: run.Id})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/keychain"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/tui"
+)
+
+// selfTestPrompt is sent to the LLM to check the connection
+const selfTestPrompt = "Reply with the single word OK."
+
+// errInputEnded is returned when the input ends before the wizard is complete
+var errInputEnded = errors.New("the input ended before the setup was complete")
+
+// setupWizard asks for the settings of a new config file
+type setupWizard struct {
+	in  io.Reader
+	out io.Writer
+
+	// storeKey stores an API key in the keychain of the operating system; nil when there is
+	// no keychain
+	storeKey func(account, key string) error
+
+	// hideInput stops the terminal from echoing the API key until restore is called; nil
+	// echoes it
+	hideInput func() (restore func())
+
+	// selfTest sends a request to the model and returns the error
+	selfTest func(model config.ModelConfig) error
+}
+
+// initConfig is the config file written by the wizard; only the chosen settings are written
+type initConfig struct {
+	Policy string    `yaml:"policy"`
+	Model  initModel `yaml:"model"`
+}
+
+type initModel struct {
+	Provider       string `yaml:"provider"`
+	Name           string `yaml:"name,omitempty"`
+	URL            string `yaml:"url,omitempty"`
+	APIKeyEnv      string `yaml:"api_key_env,omitempty"`
+	APIKeyKeychain string `yaml:"api_key_keychain,omitempty"`
+}
+
+// runInitCommand handles the "init" subcommand: it creates the config file at path
+// interactively
+func runInitCommand(args []string, path string) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	force := fs.Bool("force", false, "Overwrite an existing config file without asking")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if path == "" {
+		defaultPath, err := config.DefaultPath()
+		if err != nil {
+			return err
+		}
+		path = defaultPath
+	}
+
+	wizard := &setupWizard{
+		in:  os.Stdin,
+		out: os.Stdout,
+		selfTest: func(model config.ModelConfig) error {
+			llm, err := newLLM(model, config.Default().HTTP, nil)
+			if err != nil {
+				return err
+			}
+			_, err = llm.Complete(selfTestPrompt)
+			return err
+		},
+	}
+	if keychain.Available() {
+		wizard.storeKey = keychain.Store
+	}
+	if tui.IsTerminal(os.Stdin) {
+		wizard.hideInput = hideTerminalInput
+	}
+	return wizard.run(path, *force)
+}
+
+// run asks for the settings and writes the config file to path
+func (w *setupWizard) run(path string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		overwrite, err := w.confirm(fmt.Sprintf("The config file %s exists. Overwrite it?", path), false)
+		if err != nil {
+			return err
+		}
+		if !overwrite {
+			fmt.Fprintln(w.out, "Nothing was written")
+			return nil
+		}
+	}
+	fmt.Fprintf(w.out, "Creating the config file %s\n\n", path)
+
+	model, err := w.askModel()
+	if err != nil {
+		return err
+	}
+	policy, err := w.askPolicy()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w.out, "\nTesting the connection to %s... ", model.Provider)
+	if err := w.selfTest(config.ModelConfig(model)); err != nil {
+		fmt.Fprintf(w.out, "failed: %v\n", err)
+		save, err := w.confirm("Save the config anyway?", false)
+		if err != nil {
+			return err
+		}
+		if !save {
+			fmt.Fprintln(w.out, "Nothing was written")
+			return nil
+		}
+	} else {
+		fmt.Fprintln(w.out, "OK")
+	}
+
+	data, err := yaml.Marshal(initConfig{Policy: policy, Model: model})
+	if err != nil {
+		return err
+	}
+	data = append([]byte("# Created by aiagent init; see the README for the other settings\n"), data...)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create the config directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write the config file: %v", err)
+	}
+	fmt.Fprintf(w.out, "Wrote %s. Try: aiagent \"list the files here\"\n", path)
+	return nil
+}
+
+// askModel asks for the provider, the model and where the API key is kept
+func (w *setupWizard) askModel() (initModel, error) {
+	var model initModel
+	providers := []string{nodes.ProviderOpenAI, nodes.ProviderAzure, nodes.ProviderOllama, nodes.ProviderLlamaCpp}
+	provider, err := w.choose("LLM provider", providers, nodes.ProviderOpenAI)
+	if err != nil {
+		return model, err
+	}
+	model.Provider = provider
+
+	switch provider {
+	case nodes.ProviderAzure:
+		for model.URL == "" {
+			if model.URL, err = w.ask("Deployment URL, e.g. https://<resource>.openai.azure.com/openai/deployments/<deployment>/chat/completions?api-version=2024-02-01", ""); err != nil {
+				return model, err
+			}
+		}
+		if model.Name, err = w.ask("Deployment name", ""); err != nil {
+			return model, err
+		}
+	case nodes.ProviderOllama, nodes.ProviderLlamaCpp:
+		question := "Ollama URL (empty for http://localhost:11434)"
+		if provider == nodes.ProviderLlamaCpp {
+			question = "llama.cpp server URL (empty for http://localhost:8080/v1/chat/completions)"
+		}
+		if model.URL, err = w.ask(question, ""); err != nil {
+			return model, err
+		}
+		if model.Name, err = w.ask("Model (empty for the provider default)", ""); err != nil {
+			return model, err
+		}
+		return model, nil
+	default:
+		if model.Name, err = w.ask("Model (empty for the provider default)", ""); err != nil {
+			return model, err
+		}
+	}
+
+	if w.storeKey != nil {
+		useKeychain, err := w.confirm("Store the API key in the keychain of the operating system?", true)
+		if err != nil {
+			return model, err
+		}
+		if useKeychain {
+			key, err := w.askSecret("API key")
+			if err != nil {
+				return model, err
+			}
+			if err := w.storeKey(provider, key); err != nil {
+				return model, err
+			}
+			model.APIKeyKeychain = provider
+			return model, nil
+		}
+	}
+	keyEnv, err := w.ask("Environment variable holding the API key", defaultAPIKeyEnv[provider])
+	if err != nil {
+		return model, err
+	}
+	if keyEnv != defaultAPIKeyEnv[provider] {
+		model.APIKeyEnv = keyEnv
+	}
+	return model, nil
+}
+
+// askPolicy asks for the command policy
+func (w *setupWizard) askPolicy() (string, error) {
+	fmt.Fprintln(w.out, "Command policy:")
+	fmt.Fprintln(w.out, "  strict   only read-only commands from the allow list (recommended)")
+	fmt.Fprintln(w.out, "  relaxed  anything except destructive or privileged commands")
+	return w.choose("Policy", []string{string(nodes.PolicyStrict), string(nodes.PolicyRelaxed)}, string(nodes.PolicyStrict))
+}
+
+// ask asks a question; an empty answer selects def
+func (w *setupWizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	answer, err := readLine(w.in)
+	answer = strings.TrimSpace(answer)
+	if err != nil && answer == "" {
+		fmt.Fprintln(w.out)
+		return "", errInputEnded
+	}
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// choose asks until the answer is one of options
+func (w *setupWizard) choose(question string, options []string, def string) (string, error) {
+	for {
+		answer, err := w.ask(fmt.Sprintf("%s (%s)", question, strings.Join(options, ", ")), def)
+		if err != nil {
+			return "", err
+		}
+		for _, option := range options {
+			if strings.EqualFold(answer, option) {
+				return option, nil
+			}
+		}
+		fmt.Fprintf(w.out, "Please answer one of %s\n", strings.Join(options, ", "))
+	}
+}
+
+// confirm asks a yes/no question
+func (w *setupWizard) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer, err := w.ask(fmt.Sprintf("%s [%s]", question, hint), "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// askSecret asks for a value that must not be empty without echoing it
+func (w *setupWizard) askSecret(question string) (string, error) {
+	if w.hideInput != nil {
+		restore := w.hideInput()
+		defer func() {
+			restore()
+			fmt.Fprintln(w.out)
+		}()
+	}
+	for {
+		secret, err := w.ask(question, "")
+		if err != nil || secret != "" {
+			return secret, err
+		}
+	}
+}
+
+// hideTerminalInput turns off the echo of the terminal on standard input
+func hideTerminalInput() func() {
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	if err := stty("-echo"); err != nil {
+		return func() {}
+	}
+	return func() { stty("echo") }
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/config"
+)
+
+func TestSetupWizard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aiagent", "config.yaml")
+	stored := map[string]string{}
+	var tested config.ModelConfig
+	var out bytes.Buffer
+	wizard := &setupWizard{
+		// provider, model, keychain, API key, policy (an invalid answer first)
+		in:  strings.NewReader("openai\ngpt-4o\n\nsk-test\nyolo\nrelaxed\n"),
+		out: &out,
+		storeKey: func(account, key string) error {
+			stored[account] = key
+			return nil
+		},
+		selfTest: func(model config.ModelConfig) error {
+			tested = model
+			return nil
+		},
+	}
+	require.NoError(t, wizard.run(path, false))
+
+	assert.Equal(t, map[string]string{"openai": "sk-test"}, stored)
+	assert.Equal(t, config.ModelConfig{Provider: "openai", Name: "gpt-4o", APIKeyKeychain: "openai"}, tested)
+	assert.Contains(t, out.String(), "Please answer one of strict, relaxed")
+	assert.Contains(t, out.String(), "Testing the connection to openai... OK")
+
+	cfg, err := config.Load(path, true)
+	require.NoError(t, err)
+	assert.Equal(t, "relaxed", cfg.Policy)
+	assert.Equal(t, tested, cfg.Model)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestSetupWizard_EnvKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	var out bytes.Buffer
+	wizard := &setupWizard{
+		// provider, deployment URL, deployment, key variable, policy, save despite the failed test
+		in:       strings.NewReader("azure\nhttps://example.openai.azure.com/x\ngpt-4o\nCOMPANY_KEY\n\ny\n"),
+		out:      &out,
+		selfTest: func(config.ModelConfig) error { return errors.New("connection refused") },
+	}
+	require.NoError(t, wizard.run(path, false))
+	assert.Contains(t, out.String(), "failed: connection refused")
+
+	cfg, err := config.Load(path, true)
+	require.NoError(t, err)
+	assert.Equal(t, "strict", cfg.Policy)
+	assert.Equal(t, config.ModelConfig{Provider: "azure", Name: "gpt-4o", URL: "https://example.openai.azure.com/x", APIKeyEnv: "COMPANY_KEY"}, cfg.Model)
+}
+
+func TestSetupWizard_KeepsExistingConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("policy: relaxed\n"), 0600))
+
+	var out bytes.Buffer
+	wizard := &setupWizard{in: strings.NewReader("\n"), out: &out}
+	require.NoError(t, wizard.run(path, false))
+	assert.Contains(t, out.String(), "Nothing was written")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "policy: relaxed\n", string(data))
+
+	// The input ends before the wizard is complete
+	wizard = &setupWizard{in: strings.NewReader("ollama\n"), out: &out}
+	assert.ErrorIs(t, wizard.run(path, true), errInputEnded)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/report"
+	"aiagent/pkg/tracedir"
+	"aiagent/pkg/tracing"
+)
+
+// tracingFlushTimeout bounds the time spent exporting spans at the end of a run
+const tracingFlushTimeout = 5 * time.Second
+
+// newTracer creates a tracer exporting over OTLP when an endpoint is configured
+// in the standard OTEL_* environment variables or in the config file
+// It returns nil (tracing disabled) otherwise
+func newTracer(cfg config.TracingConfig) *tracing.Tracer {
+	if exporter := tracing.NewOTLPExporterFromEnv(); exporter != nil {
+		return tracing.NewTracer(exporter)
+	}
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	return tracing.NewTracer(tracing.NewOTLPExporter(tracing.TracesEndpoint(cfg.Endpoint), cfg.Headers, cfg.ServiceName))
+}
+
+// runTracer instruments a single graph run with traces, metrics and the run report
+//
+// The trace has one root span for the run with a child span per node; LLM calls and
+// command executions are children of the node span
+type runTracer struct {
+	tracer  *tracing.Tracer
+	metrics *agentMetrics
+	report  *report.Builder
+	dump    *tracedir.Writer
+	logger  *slog.Logger
+	run     *tracing.Span
+	started time.Time
+	llm     *instrumentedLLM
+
+	mu           sync.Mutex
+	node         *tracing.Span
+	nodeType     nodes.NodeType
+	nodeStarted  time.Time
+	systemPrompt string
+}
+
+// newRunTracer starts the root span of a run
+func newRunTracer(opts runOptions, m *agentMetrics, llm nodes.LLM, runID string) *runTracer {
+	rt := &runTracer{
+		tracer:  opts.Tracer,
+		metrics: m,
+		run: opts.Tracer.Start("aiagent.run",
+			tracing.String("aiagent.run_id", runID),
+			tracing.String("aiagent.session", opts.Session)),
+		started: time.Now(),
+		logger:  slog.Default().With("run_id", runID),
+	}
+	rt.llm = newInstrumentedLLM(llm, rt)
+
+	// Only the latest run is exported, so scraped metrics can be correlated with its logs
+	// without one series per run
+	m.lastRun.Reset()
+	m.lastRun.Set(float64(rt.started.Unix()), runID, opts.Session)
+
+	price, priced := report.LookupPrice(rt.llm.model, opts.Config.Pricing)
+	if nodes.IsLocalProvider(rt.llm.provider) {
+		price, priced = report.Price{}, true // Local models are free
+	}
+	rt.report = report.NewBuilder(runID, rt.llm.model, price, priced)
+	return rt
+}
+
+// SetTraceDir dumps the prompts, responses and node results of the run into dir
+func (rt *runTracer) SetTraceDir(dir, runID string) error {
+	dump, err := tracedir.NewWriter(dir, runID)
+	if err != nil {
+		return err
+	}
+	rt.dump = dump
+	rt.logger.Info("writing trace files", "dir", dump.Dir())
+	return nil
+}
+
+// nodeResult is the outcome of a node written to the trace directory
+type nodeResult struct {
+	Node        nodes.NodeType   `json:"node"`
+	NextNode    nodes.NodeType   `json:"next_node"`
+	Task        nodes.TaskStatus `json:"task"`
+	Command     string           `json:"command,omitempty"`
+	RawOutput   string           `json:"raw_output,omitempty"`
+	FinalResult string           `json:"final_result,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// LLM returns the LLM whose calls are traced as children of the current node span
+func (rt *runTracer) LLM() nodes.LLM {
+	return rt.llm
+}
+
+// UseLLM sends the LLM calls of a node to llm instead of the LLM of the run, e.g. for the
+// agents of the orchestration mode; the calls are traced and reported like the others
+func (rt *runTracer) UseLLM(node nodes.NodeType, llm nodes.LLM) {
+	if rt.llm.agents == nil {
+		rt.llm.agents = make(map[string]*instrumentedLLM)
+	}
+	rt.llm.agents[string(node)] = newInstrumentedLLM(llm, rt)
+}
+
+// StartNode starts the span of a node
+func (rt *runTracer) StartNode(node nodes.NodeType) {
+	span := rt.tracer.StartChild(rt.run, "node "+string(node), tracing.String("aiagent.node.type", string(node)))
+	rt.mu.Lock()
+	rt.node = span
+	rt.nodeType = node
+	rt.nodeStarted = time.Now()
+	rt.mu.Unlock()
+
+	rt.report.StartNode(string(node))
+}
+
+// EndNode ends the span of the current node and records the state it left behind
+func (rt *runTracer) EndNode(state *nodes.State, err error) {
+	rt.mu.Lock()
+	span := rt.node
+	node := rt.nodeType
+	started := rt.nodeStarted
+	rt.node = nil
+	rt.nodeType = ""
+	rt.systemPrompt = ""
+	rt.mu.Unlock()
+
+	span.RecordError(err)
+	span.End()
+
+	duration := time.Since(started)
+	rt.report.EndNode(duration, err)
+	rt.dumpResult(node, state, err)
+	rt.metrics.nodeDuration.Observe(duration.Seconds(), string(node))
+	if err != nil {
+		rt.metrics.nodeErrors.Inc(string(node))
+	}
+}
+
+// dumpResult writes the state a node left behind to the trace directory
+func (rt *runTracer) dumpResult(node nodes.NodeType, state *nodes.State, err error) {
+	if rt.dump == nil {
+		return
+	}
+
+	result := nodeResult{
+		Node:        node,
+		NextNode:    state.GetNextNode(),
+		Task:        state.GetCurrentTask(),
+		Command:     state.GetCommand(),
+		RawOutput:   state.GetRawOutput(),
+		FinalResult: state.GetFinalResult(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if dumpErr := rt.dump.WriteResult(string(node), result); dumpErr != nil {
+		rt.logger.Warn("failed to write trace file", "error", dumpErr)
+	}
+}
+
+// SetSystemPrompt sets the system prompt of the LLM calls of the running node
+func (rt *runTracer) SetSystemPrompt(systemPrompt string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.systemPrompt = systemPrompt
+}
+
+// currentSystemPrompt returns the system prompt of the running node, empty between nodes
+func (rt *runTracer) currentSystemPrompt() string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.systemPrompt
+}
+
+// currentNode returns the type of the running node, or "run" between nodes
+func (rt *runTracer) currentNode() string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.nodeType == "" {
+		return "run"
+	}
+	return string(rt.nodeType)
+}
+
+// currentSpan returns the span of the running node, or the run span between nodes
+func (rt *runTracer) currentSpan() *tracing.Span {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.node != nil {
+		return rt.node
+	}
+	return rt.run
+}
+
+// ObserveCommand records an executed command; it is used as the bash node observer
+func (rt *runTracer) ObserveCommand(command string, started time.Time, duration time.Duration, exitCode int, err error) {
+	span := rt.tracer.StartAt(rt.currentSpan(), "command.execute", started,
+		tracing.String("process.command_line", command),
+		tracing.Int("process.exit.code", exitCode))
+	span.RecordError(err)
+	span.EndAt(started.Add(duration))
+
+	rt.report.AddCommand(command, exitCode, duration)
+}
+
+// Report returns the execution report of the run
+func (rt *runTracer) Report(err error) *report.Report {
+	return rt.report.Finish(err)
+}
+
+// Finish ends the run span and exports the spans of the run
+func (rt *runTracer) Finish(err error) error {
+	rt.run.RecordError(err)
+	rt.run.End()
+
+	status := "completed"
+	if err != nil {
+		status = "failed"
+	}
+	rt.metrics.runs.Inc(status)
+	rt.metrics.runDuration.Observe(time.Since(rt.started).Seconds())
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	defer cancel()
+	return rt.tracer.Flush(ctx)
+}
+
+// instrumentedLLM wraps an LLM and records every call as a span and in the metrics
+type instrumentedLLM struct {
+	next     nodes.LLM
+	rt       *runTracer
+	model    string
+	provider string
+
+	// agents are the LLMs of the nodes with their own model, by node type
+	agents map[string]*instrumentedLLM
+}
+
+// newInstrumentedLLM creates a new instance of instrumentedLLM
+func newInstrumentedLLM(next nodes.LLM, rt *runTracer) *instrumentedLLM {
+	traced := &instrumentedLLM{
+		next:     next,
+		rt:       rt,
+		model:    "mock",
+		provider: "mock",
+	}
+	if llm, ok := next.(*nodes.DefaultLLM); ok {
+		traced.model = llm.ModelId
+		traced.provider = llm.Provider
+		if traced.provider == "" {
+			traced.provider = nodes.ProviderOpenAI
+		}
+	}
+	return traced
+}
+
+// agent returns the LLM of the running node: its own if it has one, otherwise t
+func (t *instrumentedLLM) agent() *instrumentedLLM {
+	if agent, ok := t.agents[t.rt.currentNode()]; ok {
+		return agent
+	}
+	return t
+}
+
+// Complete implements the LLM interface
+func (t *instrumentedLLM) Complete(prompt string) (string, error) {
+	if agent := t.agent(); agent != t {
+		return agent.Complete(prompt)
+	}
+	systemPrompt, system := t.systemCompleter()
+	completer, knowsUsage := t.next.(nodes.UsageCompleter)
+	return t.call(systemPrompt, prompt, func() (string, nodes.TokenUsage, bool, error) {
+		if system != nil {
+			response, usage, err := system.CompleteWithSystem(systemPrompt, prompt, nil)
+			return response, usage, true, err
+		}
+		if knowsUsage {
+			response, usage, err := completer.CompleteWithUsage(prompt)
+			return response, usage, true, err
+		}
+		response, err := t.next.Complete(prompt)
+		return response, nodes.TokenUsage{}, false, err
+	})
+}
+
+// CompleteStream implements the StreamingLLM interface
+func (t *instrumentedLLM) CompleteStream(prompt string, onChunk func(string)) (string, error) {
+	if agent := t.agent(); agent != t {
+		return agent.CompleteStream(prompt, onChunk)
+	}
+	systemPrompt, system := t.systemCompleter()
+	return t.call(systemPrompt, prompt, func() (string, nodes.TokenUsage, bool, error) {
+		if system != nil {
+			response, usage, err := system.CompleteWithSystem(systemPrompt, prompt, onChunk)
+			return response, usage, true, err
+		}
+		response, err := nodes.CompleteStream(t.next, prompt, onChunk)
+		return response, nodes.TokenUsage{}, false, err
+	})
+}
+
+// systemCompleter returns the system prompt of the running node and the LLM sending it; the
+// LLM is nil when the node has no system prompt or the LLM cannot send one
+func (t *instrumentedLLM) systemCompleter() (string, nodes.SystemCompleter) {
+	systemPrompt := t.rt.currentSystemPrompt()
+	completer, ok := t.next.(nodes.SystemCompleter)
+	if systemPrompt == "" || !ok {
+		return "", nil
+	}
+	return systemPrompt, completer
+}
+
+// call traces an LLM call made by complete, which returns the token usage if it knows it
+// systemPrompt is the system prompt sent with the call, if any
+func (t *instrumentedLLM) call(systemPrompt, prompt string, complete func() (string, nodes.TokenUsage, bool, error)) (string, error) {
+	span := t.rt.tracer.StartChild(t.rt.currentSpan(), "llm.complete",
+		tracing.String("gen_ai.system", t.provider),
+		tracing.String("gen_ai.request.model", t.model),
+		tracing.Int("aiagent.prompt.length", len(prompt)))
+	defer span.End()
+
+	started := time.Now()
+	response, usage, knowsUsage, err := complete()
+	t.dumpCall(systemPrompt, prompt, response, err)
+	t.rt.logger.Debug("llm call", "node", t.rt.currentNode(), "model", t.model, "prompt", prompt, "response", response, "error", err)
+	m := t.rt.metrics
+	m.llmLatency.Observe(time.Since(started).Seconds(), t.provider, t.model)
+
+	span.RecordError(err)
+	if err != nil {
+		m.llmRequests.Inc(t.provider, t.model, "error")
+		t.rt.report.AddLLMCall(0, 0)
+		return response, err
+	}
+	m.llmRequests.Inc(t.provider, t.model, "ok")
+
+	if reporter, ok := t.next.(nodes.UsageReporter); ok && !knowsUsage {
+		usage, knowsUsage = reporter.LastUsage(), true
+	}
+	if knowsUsage {
+		span.SetAttributes(
+			tracing.Int("gen_ai.usage.input_tokens", usage.PromptTokens),
+			tracing.Int("gen_ai.usage.output_tokens", usage.CompletionTokens))
+		m.llmTokens.Add(float64(usage.PromptTokens), t.provider, t.model, "prompt")
+		m.llmTokens.Add(float64(usage.CompletionTokens), t.provider, t.model, "completion")
+	}
+	t.rt.report.AddLLMCall(usage.PromptTokens, usage.CompletionTokens)
+	return response, nil
+}
+
+// dumpCall writes the exact prompts and raw response of a call to the trace directory
+func (t *instrumentedLLM) dumpCall(systemPrompt, prompt, response string, err error) {
+	if t.rt.dump == nil {
+		return
+	}
+
+	if prompter, ok := t.next.(nodes.SystemPrompter); ok && systemPrompt == "" {
+		systemPrompt = prompter.SystemPrompt()
+	}
+	if dumpErr := t.rt.dump.WriteLLMCall(t.rt.currentNode(), systemPrompt, prompt, response, err); dumpErr != nil {
+		t.rt.logger.Warn("failed to write trace file", "error", dumpErr)
+	}
+}
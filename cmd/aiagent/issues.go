@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/github"
+	"aiagent/pkg/issues"
+	"aiagent/pkg/nodes"
+)
+
+// defaultIssueTokenEnv is the environment variable holding the token of a tracker type
+var defaultIssueTokenEnv = map[string]string{
+	"github": "GITHUB_TOKEN",
+	"gitlab": "GITLAB_TOKEN",
+	"jira":   "JIRA_API_TOKEN",
+}
+
+// newIssueTracker creates the issue tracker of the config
+func newIssueTracker(cfg config.IssueTrackerConfig) (issues.Tracker, error) {
+	tokenEnv := cfg.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = defaultIssueTokenEnv[cfg.Type]
+	}
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		return nil, fmt.Errorf("issue tracker: %s is not set", tokenEnv)
+	}
+
+	switch cfg.Type {
+	case "github":
+		client := github.NewClient(token)
+		if cfg.URL != "" {
+			client.BaseURL = cfg.URL
+		}
+		return issues.NewGitHub(client, cfg.Project), nil
+	case "gitlab":
+		return issues.NewGitLab(cfg.URL, token, cfg.Project), nil
+	case "jira":
+		return issues.NewJira(cfg.URL, cfg.User, token, cfg.Project, cfg.IssueType), nil
+	}
+	return nil, fmt.Errorf("unsupported issue tracker type %q", cfg.Type)
+}
+
+// terminalApprover shows what is about to happen, e.g. the preview of the issues, on out
+// and reads the answer of the user from in; anything but "y" or "yes" is a denial
+func terminalApprover(in io.Reader, out io.Writer) nodes.CommandApprover {
+	return func(id, subject string) (bool, error) {
+		fmt.Fprintf(out, "%s\nProceed? [y/N] ", strings.TrimRight(subject, "\n"))
+		answer, err := readLine(in)
+		if err != nil && answer == "" {
+			fmt.Fprintln(out)
+			return false, nil
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes", nil
+	}
+}
+
+// terminalClarifier asks the question of the clarification node on out and reads the
+// answer of the user from in
+func terminalClarifier(in io.Reader, out io.Writer) nodes.Clarifier {
+	return func(question string) (string, error) {
+		fmt.Fprintf(out, "%s\n> ", strings.TrimRight(question, "\n"))
+		answer, err := readLine(in)
+		if err != nil && answer == "" {
+			fmt.Fprintln(out)
+			return "", nil
+		}
+		return strings.TrimSpace(answer), nil
+	}
+}
+
+// readLine reads a line byte by byte, so no input after it is consumed, e.g. the next
+// request of the chat
+func readLine(in io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/config"
+)
+
+func TestTerminalApprover(t *testing.T) {
+	tests := []struct {
+		input    string
+		approved bool
+	}{
+		{"y\n", true},
+		{" Yes \nnext request\n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		in := strings.NewReader(tt.input)
+		var out strings.Builder
+		approved, err := terminalApprover(in, &out)("issues-1", "File 1 issue(s) in GitHub owner/name:\n")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.approved, approved, tt.input)
+		assert.True(t, strings.HasPrefix(out.String(), "File 1 issue(s) in GitHub owner/name:\nProceed? [y/N] "))
+	}
+
+	// The answer is read without consuming the next line
+	in := strings.NewReader("y\nnext request\n")
+	terminalApprover(in, &strings.Builder{})("1", "run it")
+	rest, _ := readLine(in)
+	assert.Equal(t, "next request", rest)
+}
+
+func TestTerminalClarifier(t *testing.T) {
+	in := strings.NewReader(" explain it \nnext request\n")
+	var out strings.Builder
+	answer, err := terminalClarifier(in, &out)("Run a command?")
+	assert.NoError(t, err)
+	assert.Equal(t, "explain it", answer)
+	assert.Equal(t, "Run a command?\n> ", out.String())
+
+	answer, err = terminalClarifier(strings.NewReader(""), &out)("Run a command?")
+	assert.NoError(t, err)
+	assert.Empty(t, answer)
+}
+
+func TestNewIssueTracker(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "")
+	_, err := newIssueTracker(config.IssueTrackerConfig{Type: "gitlab", Project: "group/name"})
+	assert.EqualError(t, err, "issue tracker: GITLAB_TOKEN is not set")
+
+	t.Setenv("JIRA_TOKEN", "secret")
+	tracker, err := newIssueTracker(config.IssueTrackerConfig{Type: "jira", URL: "https://jira.example.com", Project: "OPS", TokenEnv: "JIRA_TOKEN"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Jira OPS", tracker.Name())
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"aiagent/pkg/stats"
+)
+
+// runLicensesCommand implements the "licenses" subcommand: it reports the license of the
+// working directory, the licenses of its dependencies and the source files missing a header
+func runLicensesCommand(args []string, opts runOptions, stdout io.Writer) error {
+	fs := flag.NewFlagSet("licenses", flag.ContinueOnError)
+	format := fs.String("format", "markdown", "Report format: markdown or json")
+	header := fs.String("header", "", "Text every source file must contain in its first lines (default: a copyright notice or an SPDX license identifier)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected markdown or json", *format)
+	}
+
+	dir, err := workingDir(opts)
+	if err != nil {
+		return err
+	}
+	report, err := stats.ScanLicenses(dir, stats.LicenseOptions{Header: *header})
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	_, err = fmt.Fprint(stdout, report.Markdown())
+	return err
+}
@@ -1,70 +1,972 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"aiagent/pkg/audit"
+	"aiagent/pkg/clipboard"
+	"aiagent/pkg/config"
+	"aiagent/pkg/events"
+	"aiagent/pkg/history"
+	"aiagent/pkg/issues"
+	"aiagent/pkg/language"
+	"aiagent/pkg/logging"
 	"aiagent/pkg/nodes"
+	"aiagent/pkg/policy"
+	"aiagent/pkg/prompts"
+	"aiagent/pkg/redact"
+	"aiagent/pkg/sandbox"
+	"aiagent/pkg/terminal"
+	"aiagent/pkg/tracing"
+	"aiagent/pkg/transcript"
+	"aiagent/pkg/tui"
+	"aiagent/pkg/webhook"
 )
 
+// clipboardRequest is the request of --from-clipboard when none is given
+const clipboardRequest = "explain the copied text and how to fix the problem it shows"
+
+// maxClipboardSize is the maximum size of the clipboard text passed as context
+const maxClipboardSize = 32 * 1024
+
+// historyContextSize is the number of previous runs summarized as conversation context
+const historyContextSize = 5
+
+// runOptions holds the settings that control a single graph run
+type runOptions struct {
+	Verbosity    int
+	ForceApprove bool
+	Continue     bool
+	Session      string
+	SessionScope string
+	Storage      string
+	Config       *config.Config
+	Workspace    string
+	Policy       nodes.CommandPolicy
+	Tracer       *tracing.Tracer
+	Report       bool
+	TraceDir     string
+	Events       *events.Bus
+	Prompts      *prompts.Registry
+
+	// Replay is the recorded run being replayed; its conversation context is reused
+	// and the replay is not added to the conversation history
+	Replay *transcript.Transcript
+
+	// CommandRunner, if set, replaces the execution of the commands generated by the bash node
+	CommandRunner nodes.CommandRunner
+
+	// RunID, if set, identifies the run instead of a newly generated ID
+	RunID string
+
+	// Approver, if set, must approve every command generated by the bash node
+	Approver nodes.CommandApprover
+
+	// Tools are the external tools, e.g. of MCP servers, the classifier may route to
+	Tools []nodes.Tool
+
+	// ConversationContext, if set, is used instead of the conversation history of the
+	// session, e.g. for clients sending the whole conversation with every request
+	ConversationContext string
+
+	// Dir is the working directory of the run; empty means the current directory
+	Dir string
+
+	// User is the authenticated user starting the run in server mode, recorded in the audit log
+	User string
+
+	// Context cancels the run before its next node; nil means the run cannot be canceled
+	Context context.Context
+
+	// TerminalContext is the terminal output captured with --terminal-context, added to the
+	// conversation context of every run
+	TerminalContext string
+
+	// ClipboardContext is the text of the clipboard read with --from-clipboard, added to the
+	// conversation context of every run
+	ClipboardContext string
+
+	// IssueTracker, if set, is the tracker the issue node files findings in
+	IssueTracker issues.Tracker
+
+	// TerminalApprover approves the issues of the issue node and the actions the policy
+	// engine asks about in runs without an Approver, e.g. by asking on the terminal; without
+	// either no issue is filed and no such action happens
+	TerminalApprover nodes.CommandApprover
+
+	// PolicyEngine, if set, decides about commands and file writes with the rules of the
+	// organization, in addition to the command policy
+	PolicyEngine policy.Engine
+
+	// Clarifier asks the user about requests the classifier is unsure about; without one
+	// the LLM is asked for a second opinion
+	Clarifier nodes.Clarifier
+
+	// EmailDigest, if set, emails the report of every finished run
+	EmailDigest *emailDigest
+
+	// TeamApproval, if set, sends risky commands to another person for approval
+	TeamApproval *teamApproval
+
+	// Offline refuses network access: nodes needing other machines fail instead of
+	// connecting to them
+	Offline bool
+
+	// Safe is the safe mode preset: the code fixer, which writes files, does not run
+	Safe bool
+
+	// Node, if set, handles the request on its own; the classifier is not asked
+	Node nodes.NodeType
+
+	// Explain prints the decisions of every run and why they were made after the result
+	Explain bool
+
+	// Orchestrate runs the requests through the planner, which splits them into tasks for
+	// the nodes, and the critic, which reviews the result of every task
+	Orchestrate bool
+
+	// AgentLLMs are the LLMs of the nodes with their own model in the orchestration mode
+	AgentLLMs map[nodes.NodeType]nodes.LLM
+
+	// ClassificationCache, if set, is shared by the runs of the process, so repeated
+	// requests in chat or to the server are not classified again
+	ClassificationCache *nodes.ClassificationCache
+
+	// Lessons loads the examples learned from the feedback on earlier runs; it is only called
+	// when a node using them is first visited, and nil learns nothing
+	Lessons func() transcript.Lessons
+
+	// CommandTracks loads the outcomes of the audited commands, by command; it is only called
+	// when a command needs an approval, and nil learns nothing
+	CommandTracks func() map[string]audit.Track
+
+	// RiskLog is the audit log of the user scope the learned risk reads the outcomes of the
+	// commands from; the commands are recorded in it as well. nil when learned risk is off
+	RiskLog *audit.Log
+
+	// Language is the language of the answers; empty detects it from the request
+	Language string
+
+	// Output, if set, receives the final result while it is generated; the result is
+	// still returned when the run ends
+	Output io.Writer
+}
+
 func main() {
+	// The sandbox runs the executable as the bridge of a command to its proxy
+	if len(os.Args) > 1 && os.Args[1] == sandbox.BridgeCommand {
+		os.Exit(sandbox.RunBridge(os.Args[2:]))
+	}
+
 	// Define configuration flags
 	useMock := flag.Bool("mock", false, "Use mock LLM instead of real API")
-	verbose := flag.Bool("v", false, "Enable verbose mode (show detailed processing information)")
+	verbose := flag.Bool("v", false, "Verbose: show progress (nodes, timings)")
+	veryVerbose := flag.Bool("vv", false, "More verbose: also show prompts, responses and decisions")
+	traceVerbose := flag.Bool("vvv", false, "Most verbose: also show raw HTTP payloads and file walk details")
 	forceApprove := flag.Bool("y", false, "Auto-approve commands without validation (use with caution)")
+	continueConversation := flag.Bool("continue", false, "Continue the conversation using previous runs in the current session")
+	session := flag.String("session", history.DefaultSession, "Name of the session used for conversation history")
+	sessionScope := flag.String("session-scope", sessionScopeDir, "Where sessions are stored: 'dir' (current directory) or 'user' (home directory)")
+	storageBackend := flag.String("storage", "", "Storage backend for history and audit data (default: file)")
+	configPath := flag.String("config", "", "Path to the config file (default: user config directory)")
+	configProfile := flag.String("config-profile", "", "Name of the profile from the config file whose settings override the others (default: the 'default' profile, if any)")
+	workspaceName := flag.String("workspace", "", "Name of the workspace from the config file (sets directory, command policy and model)")
+	logLevel := flag.String("log-level", "", "Minimum log level: trace, debug, info, warn or error (default: from -v/-vv/-vvv, otherwise warn)")
+	logFormat := flag.String("log-format", logging.FormatText, "Log format: 'text' or 'json'")
+	logFile := flag.String("log-file", "", "Append logs to this file instead of standard error")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on /metrics at this address (e.g. :9090)")
+	debugAddr := flag.String("debug-addr", "", "Serve pprof profiles on /debug/pprof/ and runtime diagnostics on /debug/runtime at this loopback address (e.g. localhost:6060)")
+	profileMode := flag.String("profile", "", "Write a 'cpu' or 'mem' profile of the run (or chat session) into .aiagent/")
+	showReport := flag.Bool("report", false, "Print an execution report (nodes, timings, LLM calls, tokens, commands, cost) after each run")
+	traceDir := flag.String("trace-dir", "", "Write every prompt, raw LLM response and node result of a run as numbered files into this directory")
+	eventsFile := flag.String("events-file", "", "Append lifecycle events (runs, nodes, commands) as JSON lines to this file")
+	fromClipboard := flag.Bool("from-clipboard", false, "Pass the text in the clipboard, e.g. a stack trace, as context of the request")
+	toClipboard := flag.Bool("to-clipboard", false, "Copy the result of the run to the clipboard")
+	terminalContext := flag.String("terminal-context", "", "Pass what the terminal shows as context: 'tmux' for the current tmux pane, or a file with recorded output")
+	terminalLines := flag.Int("terminal-lines", terminal.DefaultLines, "Number of the last lines of the terminal passed with --terminal-context")
+	callbackURL := flag.String("callback-url", "", "Post a JSON payload to this URL when a run finishes (overrides webhook.url of the config)")
+	emailDigestName := flag.String("email-digest", "", "Email the report of the run to the recipients of this digest of the config, e.g. in a cron job")
+	explain := flag.Bool("explain", false, "Print why each decision of the run was made: routing, files read, commands, validation and goal checks")
+	forcedNode := flag.String("node", "", "Route the request to this node, e.g. code_analyzer, without asking the classifier")
+	quiet := flag.Bool("quiet", false, "Write only the final result to standard output; everything else goes to standard error")
+	flag.BoolVar(quiet, "q", false, "Short for --quiet")
+	answerLanguage := flag.String("lang", "", "Answer in this language, e.g. de or German (default: the language of the request)")
+	offline := flag.Bool("offline", false, "Refuse all network access: only LLM providers on this machine (ollama, llamacpp, provider plugins) are used")
+	orchestrate := flag.Bool("orchestrate", false, "Plan the request as tasks for the nodes and have a critic review every result before it is accepted")
+	safe := flag.Bool("safe", false, "Safe mode: read-only commands without network access, no file writes and personal data redacted from the prompts")
 	flag.Parse()
+	flagEnvErr := applyFlagEnv(flag.CommandLine, os.LookupEnv)
+
+	// In quiet mode only the result is written to standard output; everything else that is
+	// printed, e.g. errors, questions and messages of the nodes, goes to standard error
+	resultOut := os.Stdout
+	if *quiet {
+		os.Stdout = os.Stderr
+	}
+
+	// The verbosity flags select the log level unless a level was chosen explicitly
+	verbosity := 0
+	switch {
+	case *traceVerbose:
+		verbosity = 3
+	case *veryVerbose:
+		verbosity = 2
+	case *verbose:
+		verbosity = 1
+	}
+	logOptions := logging.Options{Level: *logLevel, Format: *logFormat, File: *logFile}
+	var logger *slog.Logger
+	var logCloser io.Closer
+	var err error
+	if *logLevel == "" {
+		logger, logCloser, err = logging.NewWithLevel(logOptions, logging.LevelForVerbosity(verbosity))
+	} else {
+		logger, logCloser, err = logging.New(logOptions)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer logCloser.Close()
+	slog.SetDefault(logger)
+
+	if flagEnvErr != nil {
+		fmt.Printf("Error: %v\n", flagEnvErr)
+		os.Exit(exitUsage)
+	}
 
 	// Get input from CLI arguments (combine all args into a single string)
 	args := flag.Args()
+	if len(args) < 1 && *fromClipboard {
+		args = []string{clipboardRequest}
+	}
 	if len(args) < 1 {
 		fmt.Println("Error: Please provide an input argument")
-		fmt.Println("Usage: aiagent [--mock] [-v] [-y] your request here")
-		fmt.Println("  --mock         Use mock LLM instead of real API")
-		fmt.Println("  -v             Enable verbose mode (show detailed processing information)")
-		fmt.Println("  -y             Auto-approve commands without validation (use with caution)")
-		os.Exit(1)
+		printUsage()
+		os.Exit(exitUsage)
 	}
 
-	// Validate and sanitize input
-	input, err := validateAndSanitizeInput(args)
+	if err := history.ValidateSessionName(*session); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// The setup wizard creates the config file, so it runs before the config is loaded
+	if args[0] == "init" {
+		if err := runInitCommand(args[1:], *configPath); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(*configPath, *configProfile)
 	if err != nil {
-		fmt.Printf("Error: Invalid input: %v\n", err)
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Only show verbose output if -v flag is used
-	if *verbose {
-		fmt.Printf("Received input: %s\n", input)
+	if cfg.Profile != "" {
+		slog.Info("using config profile", "profile", cfg.Profile)
+	}
+
+	// Offline mode turns off whatever connects to other machines before it is set up
+	if *offline {
+		if *callbackURL != "" || *emailDigestName != "" {
+			fmt.Println("Error: --callback-url and --email-digest need the network and cannot be used with --offline")
+			os.Exit(exitUsage)
+		}
+		applyOffline(cfg)
+	}
+
+	// Safe mode overrides whatever the config allows before it is set up
+	if *safe {
 		if *forceApprove {
-			fmt.Println("Warning: Force approval mode enabled. Commands will execute without validation.")
+			fmt.Println("Error: -y approves commands without validation and cannot be used with --safe")
+			os.Exit(exitUsage)
+		}
+		applySafe(cfg)
+	}
+
+	// A request starting with @ runs an alias of the config with the remaining arguments
+	if name, ok := strings.CutPrefix(args[0], config.AliasPrefix); ok {
+		request, err := cfg.ExpandAlias(name, args[1:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		slog.Info("expanded alias", "alias", name, "request", request)
+		args = []string{request}
+	}
+
+	// The policy and model of the config apply unless a workspace sets its own
+	policy, err := nodes.ParseCommandPolicy(cfg.Policy)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	model := cfg.Model
+
+	promptRegistry, err := newPromptRegistry(cfg.Prompts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := runOptions{
+		Verbosity:    verbosity,
+		ForceApprove: *forceApprove,
+		Continue:     *continueConversation,
+		Session:      *session,
+		SessionScope: *sessionScope,
+		Storage:      *storageBackend,
+		Config:       cfg,
+		Policy:       policy,
+		Tracer:       newTracer(cfg.Tracing),
+		Report:       *showReport,
+		TraceDir:     *traceDir,
+		Events:       events.NewBus(),
+		Prompts:      promptRegistry,
+		Node:         nodes.NodeType(*forcedNode),
+		Explain:      *explain,
+		Orchestrate:  *orchestrate || cfg.Orchestration.Enabled,
+		Language:     chosenLanguage(*answerLanguage, cfg),
+		Offline:      *offline,
+		Safe:         *safe,
+	}
+
+	if !cfg.Classifier.DisableCache {
+		ttl := cfg.Classifier.CacheTTL
+		if ttl == 0 {
+			ttl = nodes.DefaultCacheTTL
+		}
+		opts.ClassificationCache = nodes.NewClassificationCache(ttl)
+	}
+
+	opts.TeamApproval, err = newTeamApproval(cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts.PolicyEngine, err = newPolicyEngine(cfg.PolicyEngine)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *emailDigestName != "" {
+		opts.EmailDigest, err = newEmailDigest(cfg, *emailDigestName)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// A workspace binds the working directory, command policy and model
+	if *workspaceName != "" {
+		workspace, policy, err := applyWorkspace(cfg, *workspaceName)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Workspace = *workspaceName
+		if workspace.Policy != "" {
+			opts.Policy = policy
+		}
+		if workspace.Model != (config.ModelConfig{}) {
+			model = workspace.Model
 		}
+		slog.Info("using workspace", "workspace", *workspaceName, "dir", workspace.Directory, "policy", string(opts.Policy))
 	}
 
+	// Session management, audit queries and exports do not need an LLM
+	switch args[0] {
+	case "sessions":
+		if err := runSessionsCommand(args[1:], opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "audit":
+		if err := runAuditCommand(args[1:], opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "export":
+		if err := runExportCommand(args[1:], opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "report":
+		if err := runReportCommand(args[1:], opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "feedback":
+		if err := runFeedbackCommand(args[1:], opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "workspaces":
+		if err := runWorkspacesCommand(args[1:], opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "prompts":
+		if err := runPromptsCommand(args[1:], opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "aliases":
+		if err := runAliasesCommand(args[1:], opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "plugins":
+		if err := runPluginsCommand(args[1:], opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "quarantine":
+		if err := runQuarantineCommand(args[1:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "verify":
+		if err := runVerifyCommand(args[1:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "rollback":
+		if err := runRollbackCommand(args[1:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "stats":
+		// The LLM is only created for the summary
+		statsLLM := func() (nodes.LLM, error) {
+			if *useMock {
+				return &MockLLM{}, nil
+			}
+			found := loadPlugins(cfg.Plugins)
+			if opts.Offline {
+				if err := checkOfflineModel(model, found); err != nil {
+					return nil, err
+				}
+			}
+			return newLLM(model, cfg.HTTP, found)
+		}
+		if err := runStatsCommand(args[1:], opts, statsLLM, resultOut); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "duplicates":
+		if err := runDuplicatesCommand(args[1:], opts, resultOut); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "licenses":
+		if err := runLicensesCommand(args[1:], opts, resultOut); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "api":
+		if err := runAPICommand(args[1:], opts, resultOut); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *terminalContext != "" {
+		captured, err := terminal.Capture(*terminalContext, *terminalLines)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.TerminalContext = captured
+		slog.Info("captured terminal output", "source", *terminalContext, "lines", strings.Count(captured, "\n")+1)
+	}
+
+	if *fromClipboard {
+		text, err := clipboard.Read()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if strings.TrimSpace(text) == "" {
+			fmt.Println("Error: the clipboard is empty")
+			os.Exit(exitUsage)
+		}
+		opts.ClipboardContext = clipboardContext(text)
+	}
+
+	// The sandbox runs the generated commands with the egress of the config
+	commandSandbox, err := sandbox.New(sandbox.Options{Egress: cfg.Sandbox.Egress, AllowedHosts: cfg.Sandbox.AllowedHosts})
+	if *safe && errors.Is(err, sandbox.ErrUnsupported) {
+		// The strict policy still refuses the commands reaching the network, e.g. curl
+		slog.Warn("safe: commands run without a network sandbox, which is only supported on Linux")
+		commandSandbox, err = nil, nil
+	} else if *offline && errors.Is(err, sandbox.ErrUnsupported) {
+		slog.Warn("offline: commands run without a network sandbox, which is only supported on Linux; they can still reach the network")
+		commandSandbox, err = nil, nil
+	}
+	if err != nil {
+		fmt.Printf("Error: sandbox: %v\n", err)
+		os.Exit(1)
+	}
+	if commandSandbox != nil {
+		defer commandSandbox.Close()
+		opts.CommandRunner = commandSandbox.Run
+		slog.Info("running commands in a sandbox", "egress", cfg.Sandbox.Egress, "allowed_hosts", cfg.Sandbox.AllowedHosts)
+	}
+	if cfg.Sandbox.User != "" {
+		runner, err := sandbox.NewUser(cfg.Sandbox.User, cfg.Sandbox.Env)
+		if err != nil {
+			fmt.Printf("Error: sandbox: %v\n", err)
+			os.Exit(1)
+		}
+		opts.CommandRunner = runner.Run
+		slog.Info("running commands as another user", "user", runner.Name())
+	}
+	if cfg.Quarantine.Enabled {
+		opts.CommandRunner = quarantineRunner(opts.CommandRunner, cfg.Quarantine.Scope)
+	}
+
+	if *forceApprove {
+		slog.Warn("force approval mode enabled, commands will execute without validation")
+	}
+
+	if *eventsFile != "" {
+		file, err := os.OpenFile(*eventsFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			fmt.Printf("Error: failed to open events file: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		opts.Events.Subscribe(events.JSONLines(file))
+	}
+
+	// The callback URL of the command line takes precedence over the one of the config
+	webhookURL := cfg.Webhook.URL
+	if *callbackURL != "" {
+		webhookURL = *callbackURL
+	}
+	if webhookURL != "" {
+		secret := ""
+		if cfg.Webhook.SecretEnv != "" {
+			secret = os.Getenv(cfg.Webhook.SecretEnv)
+		}
+		opts.Events.Subscribe(webhook.NewNotifier(webhookURL, secret, cfg.Webhook.Timeout))
+	}
+
+	if *metricsAddr != "" {
+		if err := serveMetrics(*metricsAddr, runMetrics); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *debugAddr != "" {
+		if err := serveDebug(*debugAddr); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// A replay answers LLM calls from the recorded run, so it needs no LLM
+	if args[0] == "replay" {
+		result, err := runReplayCommand(args[1:], opts)
+		if err != nil {
+			printRunError(err)
+			os.Exit(exitCode(err))
+		}
+		fmt.Fprint(resultOut, result)
+		return
+	}
+
+	// Plugins add tools, MCP servers and LLM providers to those of the config
+	loadedPlugins := loadPlugins(cfg.Plugins)
+
 	// Choose LLM implementation based on flag
 	var llm nodes.LLM
 	if *useMock {
-		if *verbose {
-			fmt.Println("Using mock LLM")
-		}
+		slog.Info("using mock LLM")
 		llm = &MockLLM{}
 	} else {
-		if *verbose {
-			fmt.Println("Using real LLM API")
+		if opts.Offline {
+			if err := checkOfflineModel(model, loadedPlugins); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitUsage)
+			}
+		}
+		slog.Info("using real LLM API", "provider", model.Provider, "model", model.Name)
+		llm, err = newLLM(model, cfg.HTTP, loadedPlugins)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
-		llm = nodes.NewDefaultLLM()
 	}
 
-	// Initialize and run the langgraph
-	result, err := runLangGraph(input, llm, *verbose, *forceApprove)
+	// External tools are offered to the classifier while the agent runs
+	if servers := pluginMCPServers(cfg.MCPServers, loadedPlugins); len(servers) > 0 {
+		tools, stopTools := startMCPTools(servers)
+		defer stopTools()
+		opts.Tools = tools
+	}
+	opts.Tools = append(opts.Tools, pluginTools(loadedPlugins)...)
+
+	// The issue node files findings in the issue tracker of the config
+	if cfg.IssueTracker.Type != "" {
+		tracker, err := newIssueTracker(cfg.IssueTracker)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.IssueTracker = tracker
+	}
+
+	// The agents of the orchestration mode may use other models than the run
+	if opts.Orchestrate && !*useMock {
+		opts.AgentLLMs, err = newAgentLLMs(cfg, loadedPlugins, opts)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// Server mode runs the requests of the HTTP API until it is interrupted
+	if args[0] == "serve" {
+		if err := runServeCommand(args[1:], llm, opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// CI mode diagnoses a failed build from its log
+	if args[0] == "ci" {
+		if err := runCICommand(args[1:], llm, opts, os.Stdin, resultOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Slack mode answers mentions and direct messages of a Slack app until it is interrupted
+	if args[0] == "slack" {
+		if err := runSlackCommand(args[1:], llm, opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// MCP mode offers the agent as tools to editors and other MCP clients over stdio
+	if args[0] == "mcp" {
+		if err := runMCPCommand(args[1:], llm, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Editor mode answers the requests of editor extensions over stdio
+	if args[0] == "editor" {
+		if err := runEditorCommand(args[1:], llm, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Web mode serves a browser UI backed by the HTTP API
+	if args[0] == "web" {
+		if err := runWebCommand(args[1:], llm, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// TUI mode runs the interactive conversation full-screen
+	if args[0] == "tui" {
+		if err := runTUICommand(args[1:], llm, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// On the command line issues and the actions the policy engine asks about are approved
+	// on the terminal
+	opts.TerminalApprover = terminalApprover(os.Stdin, os.Stderr)
+	if opts.ForceApprove {
+		opts.TerminalApprover = func(id, subject string) (bool, error) { return true, nil }
+	}
+	if tui.IsTerminal(os.Stdin) {
+		opts.Clarifier = terminalClarifier(os.Stdin, os.Stderr)
+	}
+
+	// The profile covers the run, or the whole session in chat mode
+	profileDir, err := workingDir(opts)
 	if err != nil {
-		fmt.Printf("Error running langgraph: %v\n", err)
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	profile, err := startProfile(*profileMode, profileDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Print the final result without any prefix
-	fmt.Print(result)
+	// Interactive chat mode keeps the conversation going until the user exits
+	if args[0] == "chat" && len(args) == 1 {
+		err := runChat(llm, opts)
+		stopProfile(profile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Validate and sanitize input
+	input, err := validateAndSanitizeInput(args)
+	if err != nil {
+		stopProfile(profile)
+		fmt.Printf("Error: Invalid input: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	slog.Debug("received input", "input", input)
+
+	// Initialize and run the langgraph; the result is printed without any prefix as it is
+	// generated, or once it is final in quiet mode
+	printer := newResultPrinter(resultOut)
+	if !*quiet {
+		opts.Output = printer
+	}
+	result, err := runLangGraph(input, llm, opts)
+	stopProfile(profile)
+	if err != nil {
+		printer.Abort()
+		printRunError(err)
+		os.Exit(exitCode(err))
+	}
+	printer.Finish(result)
+
+	if *toClipboard {
+		if err := clipboard.Write(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+}
+
+// withContext adds a titled section, e.g. captured terminal output, to the conversation
+// context passed to the nodes
+func withContext(conversation, title, text string) string {
+	if strings.TrimSpace(text) == "" {
+		return conversation
+	}
+	section := title + ":\n" + text
+	if conversation == "" {
+		return section
+	}
+	return conversation + "\n\n" + section
+}
+
+// clipboardContext prepares the text of the clipboard for the conversation context:
+// secrets are redacted and long text is cut
+func clipboardContext(text string) string {
+	text = redact.Redact(strings.TrimSpace(text))
+	if len(text) > maxClipboardSize {
+		text = strings.ToValidUTF8(text[:maxClipboardSize], "") + "\n... (cut)"
+	}
+	return text
+}
+
+// printUsage prints the command line usage
+func printUsage() {
+	fmt.Println("Usage: aiagent [--mock] [-v|-vv|-vvv] [-y] [--continue] [--session name] [--workspace name] your request here")
+	fmt.Println("       aiagent [flags] @<alias> [arguments]")
+	fmt.Println("       aiagent [--mock] [-v|-vv|-vvv] [-y] [--session name] [--workspace name] chat")
+	fmt.Println("       aiagent [--mock] [-y] [--workspace name] serve [--addr host:port] [--grpc-addr host:port] [--concurrency n] [--queue-size n]")
+	fmt.Println("       aiagent [--mock] [--workspace name] slack [--addr host:port] [--require-approval=false]")
+	fmt.Println("       aiagent [--mock] [--workspace name] mcp")
+	fmt.Println("       aiagent [--mock] [--workspace name] editor")
+	fmt.Println("       aiagent [--mock] [--workspace name] web [--addr host:port] [--concurrency n]")
+	fmt.Println("       aiagent [--mock] ci [--log file] [--format markdown|json] [--patch] [--comment] [--repo owner/name] [--pr n]")
+	fmt.Println("       aiagent init [--force]")
+	fmt.Println("       aiagent sessions list|delete <name>|expire <age>")
+	fmt.Println("       aiagent audit [--since age] [--rating rating] [--status status] [--run run-id] [--user name] [--limit n]")
+	fmt.Println("       aiagent export [<run-id>|last] [--format openai-jsonl|markdown|html] [--output file]")
+	fmt.Println("       aiagent report [<run-id>|last] [--format html|pdf] [--output file]")
+	fmt.Println("       aiagent replay <run-id>|last [--execute] [--strict]")
+	fmt.Println("       aiagent feedback good|bad [<run-id>|last] [--node name] [--command cmd] [--note text]")
+	fmt.Println("       aiagent workspaces list")
+	fmt.Println("       aiagent aliases list")
+	fmt.Println("       aiagent plugins list")
+	fmt.Println("       aiagent prompts list|show <name> [version]")
+	fmt.Println("       aiagent verify <run-id>|last")
+	fmt.Println("       aiagent rollback [--force] <run-id>|last")
+	fmt.Println("       aiagent stats [--format markdown|json] [--summary] [--largest n]")
+	fmt.Println("       aiagent duplicates [--format markdown|json] [--min-tokens n] [--normalize] [--tests]")
+	fmt.Println("       aiagent licenses [--format markdown|json] [--header text]")
+	fmt.Println("       aiagent api [--format markdown|text|json]")
+	fmt.Println("       aiagent quarantine list|show <id>|promote [--force] [--all] <id>...|discard [--all] <id>...")
+	fmt.Println("  --mock           Use mock LLM instead of real API")
+	fmt.Println("  -v, -vv, -vvv    Show progress; also prompts and decisions; also raw HTTP payloads and file walk")
+	fmt.Println("  -q, --quiet      Write only the final result to standard output, everything else to standard error")
+	fmt.Println("  -y               Auto-approve commands without validation (use with caution)")
+	fmt.Println("  --continue       Use previous requests in the session as conversation context")
+	fmt.Println("  --session        Name of the session (default: default)")
+	fmt.Println("  --session-scope  Store sessions and audit data per 'dir' (default) or per 'user'")
+	fmt.Println("  --storage        Storage backend for history and audit data (default: file)")
+	fmt.Println("  --config         Path to the config file (default: <user config dir>/aiagent/config.yaml)")
+	fmt.Println("  --config-profile Apply a profile from the config file (provider, model, policy, limits, ...)")
+	fmt.Println("  --workspace      Use a workspace from the config file (directory, command policy and model)")
+	fmt.Println("  --log-level      Minimum log level: debug, info, warn or error (default: warn, debug with -v)")
+	fmt.Println("  --log-format     Log format: 'text' (default) or 'json'")
+	fmt.Println("  --log-file       Append logs to a file instead of standard error")
+	fmt.Println("  --metrics-addr   Serve Prometheus metrics on /metrics at this address")
+	fmt.Println("  --debug-addr     Serve pprof profiles and runtime diagnostics at this loopback address")
+	fmt.Println("  --profile        Write a 'cpu' or 'mem' profile of the run into .aiagent/")
+	fmt.Println("  --report         Print an execution report after each run")
+	fmt.Println("  --trace-dir      Dump prompts, raw responses and node results of each run into a directory")
+	fmt.Println("  --events-file    Append lifecycle events as JSON lines to a file")
+	fmt.Println("  --from-clipboard Pass the copied text as context (the request defaults to explaining it)")
+	fmt.Println("  --to-clipboard   Copy the result to the clipboard")
+	fmt.Println("  --terminal-context Pass what the terminal shows as context: 'tmux' (current pane) or a file of recorded output")
+	fmt.Println("  --terminal-lines Number of the last terminal lines passed with --terminal-context (default: 200)")
+	fmt.Println("  --callback-url   Post the outcome of every run as JSON to a URL")
+	fmt.Println("  --explain        Print why each decision of the run was made")
+	fmt.Println("  --node           Route the request to a node, e.g. code_analyzer, without asking the classifier")
+	fmt.Println("  --lang           Answer in this language, e.g. de or German (default: the language of the request)")
+	fmt.Println("  --offline        Refuse all network access; only local LLM providers (ollama, llamacpp, plugins) are used")
+	fmt.Println("  --safe           Safe mode: read-only commands without network access, no file writes, personal data redacted")
+	fmt.Println("  chat             Start an interactive conversation")
+	fmt.Println("  tui              Start an interactive conversation full-screen, with command output, approvals and task history")
+	fmt.Println("  serve            Serve the HTTP API: POST /v1/runs starts a run, GET /v1/runs/{id} returns its status")
+	fmt.Println("  web              Serve a web UI with the conversation, command output, approvals and run history")
+	fmt.Println("  mcp              Serve the agent's tools to MCP clients over stdin and stdout")
+	fmt.Println("  init             Create the config file: provider, API key, command policy and a connection test")
+	fmt.Println("  sessions         List, delete or expire sessions")
+	fmt.Println("  audit            Show commands run by the agent")
+	fmt.Println("  export           List recent runs or export the transcript of a run")
+	fmt.Println("  report           Render a recorded run with its execution report as HTML or PDF to share")
+	fmt.Println("  replay           Re-run a recorded run with its recorded LLM responses and command output")
+	fmt.Println("  feedback         Record whether a run went well; later runs learn from it")
+	fmt.Println("  workspaces       List the configured workspaces")
+	fmt.Println("  aliases          List the configured aliases with their requests")
+	fmt.Println("  plugins          List the plugins found in the plugins directory")
+	fmt.Println("  prompts          List the prompt templates (* marks the active version) or print one")
+	fmt.Println("  verify           Check that the files written by a run were not changed since")
+	fmt.Println("  rollback         Restore the files written by a run to their contents before it")
+	fmt.Println("  quarantine       Review the files the agent created outside the approved scope and promote them into the working tree")
+	fmt.Println("  stats            Report the languages, largest files, test ratio and dependencies of the repository")
+	fmt.Println("  duplicates       Find the blocks of code copied across the repository")
+	fmt.Println("  licenses         Report the licenses of the repository and its dependencies and the files missing a header")
+	fmt.Println("  api              Print the exported types, functions and methods of the Go module with their doc comments")
+}
+
+// loadConfig loads the config file given with --config, or the user config file if it exists,
+// and overrides its settings with the AIAGENT_* environment variables
+func loadConfig(path, profile string) (*config.Config, error) {
+	var cfg *config.Config
+	var err error
+	if path != "" {
+		cfg, err = config.LoadProfile(path, true, profile)
+	} else if defaultPath, pathErr := config.DefaultPath(); pathErr == nil {
+		cfg, err = config.LoadProfile(defaultPath, false, profile)
+	} else if profile != "" {
+		err = pathErr
+	} else {
+		cfg = config.Default()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid environment: %v", err)
+	}
+	return cfg, nil
+}
+
+// runChat reads requests from stdin and runs each of them as a follow-up of the previous ones
+func runChat(llm nodes.LLM, opts runOptions) error {
+	opts.Continue = true
+	printer := newResultPrinter(os.Stdout)
+	opts.Output = printer
+
+	fmt.Println("Interactive chat mode. Type 'exit' or 'quit' to leave.")
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			break
+		}
+
+		input, err := validateAndSanitizeInput([]string{line})
+		if err != nil {
+			fmt.Printf("Error: Invalid input: %v\n", err)
+			continue
+		}
+
+		result, err := runLangGraph(input, llm, opts)
+		if err != nil {
+			printer.Abort()
+			printRunError(err)
+			continue
+		}
+		printer.Finish(result)
+		fmt.Println()
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read input: %v", err)
+	}
+	return nil
 }
 
 // validateAndSanitizeInput validates and sanitizes user input
@@ -73,7 +975,10 @@ func validateAndSanitizeInput(args []string) (string, error) {
 	input := strings.Join(args, " ")
 
 	// Check input length
-	if len(input) > 1000 {
+	if !utf8.ValidString(input) {
+		return "", fmt.Errorf("input is not valid UTF-8")
+	}
+	if utf8.RuneCountInString(input) > 1000 {
 		return "", fmt.Errorf("input too long (max 1000 characters)")
 	}
 
@@ -103,9 +1008,9 @@ func validateAndSanitizeInput(args []string) (string, error) {
 		}
 	}
 
-	// Only allow printable ASCII characters
+	// Only allow printable characters, in any language
 	for _, r := range input {
-		if r < 32 || r > 126 {
+		if !printable(r) {
 			return "", fmt.Errorf("input contains invalid character: %q", r)
 		}
 	}
@@ -113,6 +1018,13 @@ func validateAndSanitizeInput(args []string) (string, error) {
 	return input, nil
 }
 
+// printable reports whether a character may appear in user input: control characters and
+// invisible formatting such as bidirectional overrides are rejected, except the joiners
+// some scripts need
+func printable(r rune) bool {
+	return unicode.IsGraphic(r) || r == '\u200c' || r == '\u200d'
+}
+
 // MockLLM implements a simple mock LLM for testing the system
 type MockLLM struct{}
 
@@ -158,101 +1070,440 @@ func (m *MockLLM) Complete(prompt string) (string, error) {
 	return nodes.DefaultMockGenerate(prompt, "")
 }
 
-// runLangGraph orchestrates the flow between nodes
-func runLangGraph(input string, llm nodes.LLM, verbose bool, forceApprove bool) (string, error) {
-	// Create core nodes
-	classifierNode := nodes.NewClassifierNode(llm)
-	bashNode := nodes.NewBashNode(llm)
-	validationNode := nodes.NewValidationNode(llm)
-	validationNode.ForceApproval = forceApprove // Set force approval flag
-	formatterNode := nodes.NewFormatterNode(llm)
-
-	// Create analytics nodes
-	contentCollectionNode := nodes.NewContentCollectionNode(llm, verbose)
-	analyticsNode := nodes.NewAnalyticsNode(llm)
-	directResponseNode := nodes.NewDirectResponseNode(llm)
-	codeAnalyzerNode := nodes.NewCodeAnalyzerNode(llm)
-	codeFixerNode := nodes.NewCodeFixerNode(llm)
-
+// runLangGraph prepares the state for a request, runs the graph and persists the outcome
+func runLangGraph(input string, llm nodes.LLM, opts runOptions) (string, error) {
 	// Get current working directory
-	cwd, err := os.Getwd()
+	cwd, err := workingDir(opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to get current working directory: %v", err)
+		return "", err
 	}
 
-	if verbose {
-		fmt.Printf("Working in directory: %s\n", cwd)
+	// Open persistent storage for the conversation history, audit log and transcripts
+	dataStore, err := openStorage(opts)
+	if err != nil {
+		return "", err
 	}
+	defer dataStore.Close()
+	historyStore := history.NewStore(dataStore)
+	auditLog := audit.NewLog(dataStore)
+	transcriptStore := transcript.NewStore(dataStore)
+
+	// Load previous runs of the session when continuing a conversation
+	conversationContext := ""
+	if opts.Replay != nil {
+		conversationContext = opts.Replay.ConversationContext
+	} else if opts.ConversationContext != "" {
+		conversationContext = opts.ConversationContext
+	} else if opts.Continue {
+		entries, err := historyStore.Load(opts.Session)
+		if err != nil {
+			return "", fmt.Errorf("failed to load conversation history: %v", err)
+		}
+		conversationContext = history.Summarize(entries, historyContextSize)
+		slog.Info("continuing session", "session", opts.Session, "previous_runs", len(entries))
+	}
+	if opts.Replay == nil {
+		conversationContext = withContext(conversationContext, "Terminal output (most recent last)", opts.TerminalContext)
+		conversationContext = withContext(conversationContext, "Copied text", opts.ClipboardContext)
+	}
+
+	// Record every prompt, response and command of this run in a transcript
+	runID := opts.RunID
+	if runID == "" {
+		runID = transcript.NewRunID()
+	}
+	runTranscript := transcript.New(runID, input)
+	runTranscript.Session = opts.Session
+	runTranscript.User = opts.User
+	runTranscript.ConversationContext = conversationContext
+	if opts.Replay != nil {
+		runTranscript.ReplayOf = opts.Replay.RunID
+	}
+	runTranscript.Language = answerLanguage(input, opts)
+	rt := newRunTracer(opts, runMetrics, llm, runID)
+	if opts.TraceDir != "" {
+		if err := rt.SetTraceDir(opts.TraceDir, runID); err != nil {
+			return "", err
+		}
+	}
+	if opts.Replay == nil {
+		for node, agentLLM := range opts.AgentLLMs {
+			rt.UseLLM(node, agentLLM)
+		}
+	}
+	logger := slog.Default().With("run_id", runID)
+
+	// Prompts are scanned for personal data after they were recorded, right before they
+	// leave the machine; a replay sends nothing
+	runLLM := rt.LLM()
+	if opts.Replay == nil {
+		guarded, err := newPIIGuard(runLLM, opts.Config.PII, input, logger)
+		if err != nil {
+			return "", err
+		}
+		runLLM = guarded
+	}
+	recorder := transcript.NewRecorder(runLLM, runTranscript)
+	logger.Info("starting run", "dir", cwd, "session", opts.Session)
 
 	// Create initial state
 	state := &nodes.State{
-		Input:            input,
-		NextNode:         nodes.NodeTypeClassifier,
-		Verbose:          verbose,
-		WorkingDirectory: cwd,
-		FileCountLimit:   50,     // Default to max 50 files
-		FileSizeLimit:    100000, // Default to max 100KB per file
-		GlobalGoal:       input,  // Set the original input as the global goal
-		TaskHistory:      make([]nodes.TaskStatus, 0),
+		RunID:               runID,
+		Input:               input,
+		NextNode:            nodes.NodeTypeClassifier,
+		Verbosity:           opts.Verbosity,
+		WorkingDirectory:    cwd,
+		ConversationContext: conversationContext,
+		Language:            runTranscript.Language,
+		FileCountLimit:      opts.Config.Limits.MaxFiles,
+		FileSizeLimit:       opts.Config.Limits.MaxFileSize,
+		GlobalGoal:          input, // Set the original input as the global goal
+		TaskHistory:         make([]nodes.TaskStatus, 0),
+		Limits: nodes.StateLimits{
+			MaxRawOutputBytes:     opts.Config.Limits.MaxRawOutputBytes,
+			MaxDirectoryEntries:   opts.Config.Limits.MaxDirectoryEntries,
+			MaxFileCacheBytes:     opts.Config.Limits.MaxFileCacheBytes,
+			MaxPromptContentBytes: opts.Config.Limits.MaxPromptContentBytes,
+			MaxTaskHistory:        opts.Config.Limits.MaxTaskHistory,
+			HistorySummaryBatch:   opts.Config.Limits.HistorySummaryBatch,
+		},
+		Context:      opts.Context,
+		Logger:       logger,
+		Events:       opts.Events.ForRun(runID),
+		Prompts:      opts.Prompts,
+		ResultWriter: opts.Output,
+	}
+	runTranscript.Prompts = state.GetPrompts().Active()
+	defer func() {
+		if err := state.ReleaseFiles(); err != nil {
+			logger.Warn("failed to release collected files", "error", err)
+		}
+	}()
+
+	// A replay must render the recorded prompts, so it does not learn from later feedback
+	if opts.Replay == nil {
+		opts.Lessons = sync.OnceValue(func() transcript.Lessons {
+			lessons, err := learnFromFeedback(transcriptStore)
+			if err != nil {
+				logger.Warn("failed to load feedback", "error", err)
+			}
+			return lessons
+		})
+		riskLog, closeRiskLog, err := openRiskLog(opts, dataStore)
+		if err != nil {
+			return "", err
+		}
+		defer closeRiskLog()
+		opts.RiskLog = riskLog
+		opts.CommandTracks = sync.OnceValue(func() map[string]audit.Track {
+			return commandTracks(riskLog)
+		})
+	}
+
+	var decisions *explanation
+	if opts.Explain && opts.Events != nil {
+		decisions = newExplanation(runID)
+		defer opts.Events.Subscribe(decisions)()
+	}
+
+	runStarted := time.Now()
+	state.Publish(&events.RunStarted{Session: opts.Session, Input: input, Dir: cwd})
+
+	result, err := runGraph(state, recorder, rt, runTranscript, auditLog, opts)
+
+	runReport := rt.Report(err)
+	finished := &events.RunFinished{Result: result, Duration: time.Since(runStarted)}
+	if err != nil {
+		finished.Error = err.Error()
+	}
+	if runReport.CostKnown {
+		finished.Cost = &runReport.Cost
+	}
+	state.Publish(finished)
+
+	if traceErr := rt.Finish(err); traceErr != nil {
+		logger.Warn("failed to export trace", "error", traceErr)
+	}
+	if opts.Report {
+		runReport.Write(os.Stderr)
+	}
+	if decisions != nil {
+		decisions.Write(os.Stderr)
+	}
+	runTranscript.Report = runReport
+	runTranscript.Finish(result, err)
+	if saveErr := transcriptStore.Save(runTranscript); saveErr != nil {
+		logger.Warn("failed to save transcript", "error", saveErr)
+	}
+	if opts.EmailDigest != nil {
+		if mailErr := opts.EmailDigest.Send(runTranscript); mailErr != nil {
+			logger.Warn("failed to send email digest", "digest", opts.EmailDigest.name, "error", mailErr)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("run %s: %w", runID, err)
+	}
+
+	// Remember this run so that later invocations can continue the conversation
+	if opts.Replay != nil {
+		return result, nil
+	}
+	if err := historyStore.Append(opts.Session, history.Entry{RunID: runID, Input: input, Result: result}); err != nil {
+		logger.Warn("failed to save conversation history", "error", err)
+	}
+
+	return result, nil
+}
+
+// chosenLanguage returns the language of the answers chosen with --lang, otherwise the one
+// of the config; empty detects it from each request
+func chosenLanguage(flagValue string, cfg *config.Config) string {
+	return language.Name(cmp.Or(flagValue, cfg.Language))
+}
+
+// answerLanguage returns the language the answers of a run are written in: the one given
+// with --lang, the one of the recorded run for a replay, or the one the request is written in
+// English needs no instruction, so it is returned empty
+func answerLanguage(input string, opts runOptions) string {
+	if opts.Replay != nil {
+		return opts.Replay.Language
+	}
+	if opts.Language != "" {
+		return opts.Language
+	}
+	if detected := language.Detect(input); detected != language.English {
+		return detected
+	}
+	return ""
+}
+
+// runGraph orchestrates the flow between nodes
+func runGraph(state *nodes.State, recorder *transcript.Recorder, rt *runTracer, runTranscript *transcript.Transcript, auditLog *audit.Log, opts runOptions) (string, error) {
+	// The nodes are created when they are first visited
+	graph := newGraphNodes(state, recorder, rt, opts)
+
+	// A node given with --node handles the request without the classifier
+	if opts.Node != "" {
+		if opts.Node == nodes.NodeTypeIssue && opts.Offline {
+			return "", invalidInput(fmt.Errorf("the %s node files issues in the issue tracker, which cannot be reached with --offline", opts.Node))
+		}
+		if opts.Node == nodes.NodeTypeVulnerabilities && opts.Offline {
+			return "", invalidInput(fmt.Errorf("the %s node looks up the vulnerability databases, which cannot be reached with --offline", opts.Node))
+		}
+		if opts.Node == nodes.NodeTypeCodeFixer && opts.Safe {
+			return "", invalidInput(fmt.Errorf("the %s node writes files and rebuilds the agent, which --safe does not allow", opts.Node))
+		}
+		if opts.Node == nodes.NodeTypeCoverage && opts.Safe {
+			return "", invalidInput(fmt.Errorf("the %s node runs the tests of the repository, which --safe does not allow", opts.Node))
+		}
+		if !graph.catalog.Has(opts.Node) {
+			return "", invalidInput(fmt.Errorf("unknown node %q: use one of %s", opts.Node, strings.Join(graph.catalog.Types(), ", ")))
+		}
+		if opts.Orchestrate {
+			return "", invalidInput(fmt.Errorf("--node and --orchestrate cannot be combined: the planner chooses the nodes"))
+		}
+		state.SetNextNode(opts.Node)
+		state.SetCurrentTask(nodes.TaskStatus{NodeType: opts.Node, Goal: state.GetInput()})
+	}
+
+	// In the orchestration mode the planner replaces the classifier
+	if opts.Orchestrate {
+		state.SetNextNode(nodes.NodeTypePlanner)
 	}
 
 	// Run the graph until we reach a terminal state
-	for state.NextNode != nodes.NodeTypeTerminal {
+	for state.GetNextNode() != nodes.NodeTypeTerminal {
 		var err error
 		var result string
 
-		switch state.NextNode {
+		if opts.Context != nil && opts.Context.Err() != nil {
+			return "", fmt.Errorf("run canceled: %w", opts.Context.Err())
+		}
+
+		currentNode := state.GetNextNode()
+		recorder.SetNode(currentNode)
+		nodeLogger := state.NodeLogger(currentNode)
+		nodeLogger.Info("node started")
+		started := time.Now()
+		rt.StartNode(currentNode)
+		if system, err := systemPrompt(state, currentNode, opts.Policy, opts.Config.Prompts.Instructions); err != nil {
+			nodeLogger.Warn("failed to render system prompt", "error", err)
+		} else {
+			rt.SetSystemPrompt(system)
+		}
+		state.Publish(&events.NodeStarted{Node: string(currentNode)})
+
+		switch currentNode {
 		// Core nodes
 		case nodes.NodeTypeClassifier:
-			result, err = classifierNode.Process(state)
+			var classifierNode *nodes.ClassifierNode
+			if classifierNode, err = graph.classifier(); err == nil {
+				result, err = classifierNode.Process(state)
+			}
 		case nodes.NodeTypeBash:
-			result, err = bashNode.Process(state)
-			state.CurrentTask.Result = result
-			state.NextNode = nodes.NodeTypeClassifier // Route back to classifier
+			state.SetCommand("")
+			result, err = graph.bash().Process(state)
+			recordCommandStep(runTranscript, state, result, err)
+			if auditErr := recordCommand(auditLog, state, opts, result, err); auditErr != nil {
+				nodeLogger.Warn("failed to record command in audit log", "error", auditErr)
+			}
+			state.SetCurrentTaskResult(result)
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
 		case nodes.NodeTypeValidation:
-			err = validationNode.Process(state)
-			state.CurrentTask.Result = state.RawOutput
-			state.NextNode = nodes.NodeTypeClassifier // Route back to classifier
+			err = graph.validation().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
 		case nodes.NodeTypeFormatter:
-			err = formatterNode.Process(state)
-			state.CurrentTask.Result = state.RawOutput
-			state.NextNode = nodes.NodeTypeClassifier // Route back to classifier
+			err = graph.formatter().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
 
 		// Analytics nodes
 		case nodes.NodeTypeContentCollection:
-			err = contentCollectionNode.Process(state)
-			state.CurrentTask.Result = state.RawOutput
-			state.NextNode = nodes.NodeTypeClassifier // Route back to classifier
+			err = graph.contentCollection().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
 		case nodes.NodeTypeAnalytics:
-			err = analyticsNode.Process(state)
-			state.CurrentTask.Result = state.RawOutput
-			state.NextNode = nodes.NodeTypeClassifier // Route back to classifier
+			err = graph.analytics().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
 		case nodes.NodeTypeDirectResponse:
-			err = directResponseNode.Process(state)
-			state.CurrentTask.Result = state.RawOutput
-			state.NextNode = nodes.NodeTypeClassifier // Route back to classifier
+			err = graph.directResponse().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
 		case nodes.NodeTypeCodeAnalyzer:
-			err = codeAnalyzerNode.Process(state)
-			state.CurrentTask.Result = state.RawOutput
-			state.NextNode = nodes.NodeTypeClassifier // Route back to classifier
+			err = graph.codeAnalyzer().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
 		case nodes.NodeTypeCodeFixer:
-			err = codeFixerNode.Process(state)
-			state.CurrentTask.Result = state.RawOutput
-			state.NextNode = nodes.NodeTypeClassifier // Route back to classifier
+			if opts.Safe {
+				// Besides writing files, the code fixer builds and starts a new version of the agent
+				err = fmt.Errorf("%w: the %s node cannot run with --safe", nodes.ErrPolicyDenied, currentNode)
+				break
+			}
+			err = graph.codeFixer().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
+		case nodes.NodeTypeTodo:
+			err = graph.todo().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
+		case nodes.NodeTypeChanges:
+			err = graph.changes().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
+		case nodes.NodeTypeVulnerabilities:
+			var vulnerabilityNode *nodes.VulnerabilityNode
+			if vulnerabilityNode, err = graph.vulnerabilities(); err == nil {
+				err = vulnerabilityNode.Process(state)
+			}
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
+		case nodes.NodeTypeCoverage:
+			if opts.Safe {
+				// The tests are code of the repository, run outside of the sandbox
+				err = fmt.Errorf("%w: the %s node cannot run with --safe", nodes.ErrPolicyDenied, currentNode)
+				break
+			}
+			err = graph.coverage().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
+
+		// External tools
+		case nodes.NodeTypeTool:
+			err = graph.tool().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
+
+		// Issue tracker
+		case nodes.NodeTypeIssue:
+			err = graph.issue().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
+
+		// Orchestration agents
+		case nodes.NodeTypePlanner:
+			err = graph.planner().Process(state)
+		case nodes.NodeTypeCritic:
+			err = graph.critic().Process(state)
+
+		// Questions to the user
+		case nodes.NodeTypeClarification:
+			err = graph.clarification().Process(state)
+			state.SetCurrentTaskResult(state.GetRawOutput())
+			state.SetNextNode(nodes.NodeTypeClassifier) // Route back to classifier
 
 		default:
-			return "", fmt.Errorf("invalid node type: %s", state.NextNode)
+			err := fmt.Errorf("%w: invalid node type: %s", nodes.ErrParse, currentNode)
+			rt.EndNode(state, err)
+			return "", err
 		}
 
+		rt.EndNode(state, err)
+		nodeFinished := &events.NodeFinished{Node: string(currentNode), NextNode: string(state.GetNextNode()), Duration: time.Since(started)}
+		if err != nil {
+			nodeFinished.Error = err.Error()
+		}
+		state.Publish(nodeFinished)
 		if err != nil {
-			return "", fmt.Errorf("error in node %s: %v", state.NextNode, err)
+			nodeLogger.Error("node failed", "duration", time.Since(started), "error", err)
+			return "", fmt.Errorf("error in node %s: %w", currentNode, err)
+		}
+		nodeLogger.Info("node finished", "duration", time.Since(started))
+
+		// The node given with --node answers the request on its own
+		if opts.Node != "" {
+			state.SetCurrentTaskCompleted(true)
+			state.AppendTaskHistory(state.GetCurrentTask())
+			state.SetNextNode(nodes.NodeTypeTerminal)
+		}
+
+		// In the orchestration mode the result of a task is reviewed instead of classified
+		if opts.Orchestrate && state.GetNextNode() == nodes.NodeTypeClassifier {
+			state.SetNextNode(nodes.NodeTypeCritic)
 		}
 
 		// Update FinalResult with the latest result if available
 		if result != "" {
-			state.FinalResult = result
+			state.SetFinalResult(result)
 		}
 	}
 
-	return state.FinalResult, nil
+	return state.GetFinalResult(), nil
+}
+
+// recordCommandStep adds the command run by the bash node to the run transcript
+func recordCommandStep(runTranscript *transcript.Transcript, state *nodes.State, output string, err error) {
+	if state.GetCommand() == "" {
+		return // No command was generated
+	}
+
+	step := transcript.Step{
+		Kind:    transcript.StepCommand,
+		Node:    nodes.NodeTypeBash,
+		Command: state.GetCommand(),
+		Output:  output,
+	}
+	if err != nil {
+		step.Error = err.Error()
+		step.Rejected = errors.Is(err, nodes.ErrPolicyDenied)
+	}
+	runTranscript.AddStep(step)
+}
+
+// routingRules returns the rules of the classifier: the rules of the config, then the
+// built-in rules unless they are disabled
+func routingRules(cfg config.ClassifierConfig) ([]nodes.RoutingRule, error) {
+	var rules []nodes.RoutingRule
+	for i, rule := range cfg.Rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("classifier rule %d: invalid pattern: %v", i+1, err)
+		}
+		rules = append(rules, nodes.RoutingRule{Pattern: pattern, Node: nodes.NodeType(rule.Node), Command: rule.Command})
+	}
+	if !cfg.DisableBuiltinRules {
+		rules = append(rules, nodes.DefaultRoutingRules()...)
+	}
+	return rules, nil
 }
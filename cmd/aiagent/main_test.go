@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/transcript"
+)
+
+func TestWithContext(t *testing.T) {
+	assert.Equal(t, "earlier runs", withContext("earlier runs", "Copied text", " \n"))
+	assert.Equal(t, "Copied text:\npanic: nil map", withContext("", "Copied text", "panic: nil map"))
+	assert.Equal(t, "earlier runs\n\nCopied text:\npanic: nil map", withContext("earlier runs", "Copied text", "panic: nil map"))
+}
+
+func TestClipboardContext(t *testing.T) {
+	assert.Equal(t, "api_key=[REDACTED]", clipboardContext("\napi_key=sk-abcdefghijklmnopqrstuvwxyz\n"))
+
+	long := clipboardContext(strings.Repeat("é", maxClipboardSize))
+	assert.True(t, strings.HasSuffix(long, "\n... (cut)"))
+	assert.LessOrEqual(t, len(long), maxClipboardSize+len("\n... (cut)"))
+}
+
+func TestChosenLanguage(t *testing.T) {
+	cfg := config.Default()
+	assert.Equal(t, "", chosenLanguage("", cfg))
+	assert.Equal(t, "German", chosenLanguage("de", cfg))
+
+	cfg.Language = "fr"
+	assert.Equal(t, "French", chosenLanguage("", cfg), "the config is used without --lang")
+	assert.Equal(t, "German", chosenLanguage("de", cfg), "--lang wins over the config")
+}
+
+func TestValidateAndSanitizeInput(t *testing.T) {
+	for _, input := range []string{"list files", "покажи все файлы", "列出文件", "zeige die Dateien", "نمایش\u200cها"} {
+		sanitized, err := validateAndSanitizeInput([]string{input})
+		assert.NoError(t, err, input)
+		assert.Equal(t, input, sanitized)
+	}
+
+	_, err := validateAndSanitizeInput([]string{strings.Repeat("я", 1000)})
+	assert.NoError(t, err, "the length is counted in characters")
+	_, err = validateAndSanitizeInput([]string{strings.Repeat("я", 1001)})
+	assert.EqualError(t, err, "input too long (max 1000 characters)")
+	_, err = validateAndSanitizeInput([]string{"readme\u202etxt"})
+	assert.EqualError(t, err, `input contains invalid character: '\u202e'`)
+	_, err = validateAndSanitizeInput([]string{"bad\xffbyte"})
+	assert.EqualError(t, err, "input is not valid UTF-8")
+	_, err = validateAndSanitizeInput([]string{"tab\there"})
+	assert.EqualError(t, err, `input contains invalid character: '\t'`)
+}
+
+func TestAnswerLanguage(t *testing.T) {
+	assert.Equal(t, "", answerLanguage("list all the files", runOptions{}))
+	assert.Equal(t, "Russian", answerLanguage("покажи все файлы", runOptions{}))
+	assert.Equal(t, "German", answerLanguage("покажи все файлы", runOptions{Language: "German"}))
+	assert.Equal(t, "English", answerLanguage("покажи все файлы", runOptions{Language: "English"}), "a chosen language is used even if it is English")
+	assert.Equal(t, "French", answerLanguage("list all the files", runOptions{Replay: &transcript.Transcript{Language: "French"}}))
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"syscall"
+
+	"aiagent/pkg/audit"
+	"aiagent/pkg/history"
+	"aiagent/pkg/mcp"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/transcript"
+)
+
+// Input schemas of the MCP tools
+var (
+	runCommandSchema = json.RawMessage(`{"type":"object","properties":{` +
+		`"command":{"type":"string","description":"Shell command to run in the working directory"}},` +
+		`"required":["command"],"additionalProperties":false}`)
+	runAgentSchema = json.RawMessage(`{"type":"object","properties":{` +
+		`"input":{"type":"string","description":"Request in natural language"},` +
+		`"session":{"type":"string","description":"Session of the conversation history (default: default)"},` +
+		`"continue":{"type":"boolean","description":"Use the previous requests of the session as context"}},` +
+		`"required":["input"],"additionalProperties":false}`)
+	analyzeCodeSchema = json.RawMessage(`{"type":"object","properties":{` +
+		`"request":{"type":"string","description":"What to find out about the code in the working directory"}},` +
+		`"required":["request"],"additionalProperties":false}`)
+	collectContentSchema = json.RawMessage(`{"type":"object","properties":{` +
+		`"patterns":{"type":"array","items":{"type":"string"},"description":"Glob patterns of the file names to collect (default: all files)"},` +
+		`"read_contents":{"type":"boolean","description":"Also return the contents of text files"}},` +
+		`"additionalProperties":false}`)
+)
+
+// newMCPServer creates the MCP server offering the capabilities of the agent as tools
+func newMCPServer(llm nodes.LLM, opts runOptions) (*mcp.Server, error) {
+	guarded, err := guardFrontend(llm, opts)
+	if err != nil {
+		return nil, err
+	}
+	server := mcp.NewServer("aiagent", buildVersion())
+	tools := &mcpTools{llm: llm, guarded: guarded, opts: opts}
+
+	server.AddTool(mcp.Tool{
+		Name:        "run_command",
+		Description: "Run a shell command in the working directory after checking it against the command policy (" + string(tools.policy()) + "), the policy engine and the approvals of the agent; it is recorded in the audit log",
+		InputSchema: runCommandSchema,
+	}, tools.runCommand)
+	server.AddTool(mcp.Tool{
+		Name:        "run_agent",
+		Description: "Run a request through the whole agent: it classifies the request, runs commands, analyzes code and answers",
+		InputSchema: runAgentSchema,
+	}, tools.runAgent)
+	server.AddTool(mcp.Tool{
+		Name:        "analyze_code",
+		Description: "Analyze the code in the working directory: the relevant files are selected and read, then explained",
+		InputSchema: analyzeCodeSchema,
+	}, tools.analyzeCode)
+	server.AddTool(mcp.Tool{
+		Name:        "collect_content",
+		Description: "List the files in the working directory, optionally with the contents of text files",
+		InputSchema: collectContentSchema,
+	}, tools.collectContent)
+	return server, nil
+}
+
+// mcpTools implements the tools of the MCP server
+type mcpTools struct {
+	llm nodes.LLM
+
+	// guarded is llm behind the scan of the prompts for personal data; runs guard their own
+	guarded nodes.LLM
+
+	opts runOptions
+}
+
+func (t *mcpTools) policy() nodes.CommandPolicy {
+	if t.opts.Policy == "" {
+		return nodes.PolicyStrict
+	}
+	return t.opts.Policy
+}
+
+func (t *mcpTools) runCommand(ctx context.Context, arguments json.RawMessage) (*mcp.ToolResult, error) {
+	var args struct {
+		Command string `json:"command"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.Command) == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+
+	// The command goes through the bash node like the commands of a run: the command policy,
+	// the policy engine, the approvals and the audit log apply
+	dataStore, err := openStorage(t.opts)
+	if err != nil {
+		return nil, err
+	}
+	defer dataStore.Close()
+	auditLog := audit.NewLog(dataStore)
+	riskLog, closeRiskLog, err := openRiskLog(t.opts, dataStore)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRiskLog()
+	opts := t.opts
+	opts.RiskLog = riskLog
+	opts.CommandTracks = func() map[string]audit.Track {
+		return commandTracks(riskLog)
+	}
+
+	state, err := t.newState(args.Command)
+	if err != nil {
+		return nil, err
+	}
+	state.RunID = transcript.NewRunID()
+	state.CurrentTask = nodes.TaskStatus{NodeType: nodes.NodeTypeBash, Goal: args.Command, Command: args.Command}
+	state.Events = opts.Events.ForRun(state.RunID)
+	bashNode := newBashNode(state, nil, opts)
+
+	// The client gets the whole output and the exit code, which the bash node trims and drops
+	runner := bashNode.Runner
+	if runner == nil {
+		runner = nodes.RunCommand
+	}
+	var output []byte
+	exitCode := -1
+	bashNode.Runner = func(command, dir string) ([]byte, int, error) {
+		var err error
+		output, exitCode, err = runner(command, dir)
+		return output, exitCode, err
+	}
+	_, err = bashNode.Process(state)
+	if auditErr := recordCommand(auditLog, state, opts, string(output), err); auditErr != nil {
+		slog.Warn("failed to record command in audit log", "error", auditErr)
+	}
+	if err != nil && !errors.Is(err, nodes.ErrCommandFailed) {
+		return nil, err
+	}
+
+	result := mcp.TextResult(fmt.Sprintf("exit code: %d\n%s", exitCode, output))
+	result.IsError = err != nil
+	return result, nil
+}
+
+func (t *mcpTools) runAgent(ctx context.Context, arguments json.RawMessage) (*mcp.ToolResult, error) {
+	var args struct {
+		Input    string `json:"input"`
+		Session  string `json:"session"`
+		Continue bool   `json:"continue"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.Input) == "" {
+		return nil, fmt.Errorf("input is required")
+	}
+	input, err := validateAndSanitizeInput([]string{args.Input})
+	if err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+
+	opts := t.opts
+	opts.Continue = args.Continue
+	if args.Session != "" {
+		if err := history.ValidateSessionName(args.Session); err != nil {
+			return nil, err
+		}
+		opts.Session = args.Session
+	}
+
+	result, err := runLangGraph(input, t.llm, opts)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.TextResult(result), nil
+}
+
+func (t *mcpTools) analyzeCode(ctx context.Context, arguments json.RawMessage) (*mcp.ToolResult, error) {
+	var args struct {
+		Request string `json:"request"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.Request) == "" {
+		return nil, fmt.Errorf("request is required")
+	}
+
+	state, err := t.newState(args.Request)
+	if err != nil {
+		return nil, err
+	}
+	defer state.ReleaseFiles()
+	codeAnalyzerNode := nodes.NewCodeAnalyzerNode(t.guarded)
+	codeAnalyzerNode.Cache = symbolCache(state.GetWorkingDirectory())
+	if err := codeAnalyzerNode.Process(state); err != nil {
+		return nil, err
+	}
+	if state.GetFinalResult() == "" {
+		return mcp.TextResult("No files in the working directory are relevant to the request"), nil
+	}
+	return mcp.TextResult(state.GetFinalResult()), nil
+}
+
+func (t *mcpTools) collectContent(ctx context.Context, arguments json.RawMessage) (*mcp.ToolResult, error) {
+	var args struct {
+		Patterns     []string `json:"patterns"`
+		ReadContents bool     `json:"read_contents"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	state, err := t.newState("collect content")
+	if err != nil {
+		return nil, err
+	}
+	defer state.ReleaseFiles()
+	state.FilePatterns = args.Patterns
+	state.NeedsFileContent = args.ReadContents
+	if err := nodes.NewContentCollectionNode(t.guarded).Process(state); err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	for _, entry := range state.GetDirectoryContents() {
+		content := state.LoadFileContent(entry)
+		switch {
+		case entry.IsDir:
+			fmt.Fprintf(&sb, "%s/\n", entry.Path)
+		case content != "":
+			fmt.Fprintf(&sb, "==> %s (%d bytes) <==\n%s\n", entry.Path, entry.Size, content)
+		default:
+			fmt.Fprintf(&sb, "%s (%d bytes)\n", entry.Path, entry.Size)
+		}
+	}
+	if sb.Len() == 0 {
+		return mcp.TextResult("No files found"), nil
+	}
+	return mcp.TextResult(sb.String()), nil
+}
+
+// newState creates the state a single node runs with for a tool call
+func (t *mcpTools) newState(goal string) (*nodes.State, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %v", err)
+	}
+	return &nodes.State{
+		Input:            goal,
+		GlobalGoal:       goal,
+		CurrentTask:      nodes.TaskStatus{Goal: goal},
+		WorkingDirectory: cwd,
+		FileCountLimit:   t.opts.Config.Limits.MaxFiles,
+		FileSizeLimit:    t.opts.Config.Limits.MaxFileSize,
+		Limits: nodes.StateLimits{
+			MaxRawOutputBytes:     t.opts.Config.Limits.MaxRawOutputBytes,
+			MaxDirectoryEntries:   t.opts.Config.Limits.MaxDirectoryEntries,
+			MaxFileCacheBytes:     t.opts.Config.Limits.MaxFileCacheBytes,
+			MaxPromptContentBytes: t.opts.Config.Limits.MaxPromptContentBytes,
+		},
+		Prompts: t.opts.Prompts,
+	}, nil
+}
+
+// decodeArguments decodes the arguments of a tool call, rejecting unknown ones
+func decodeArguments(arguments json.RawMessage, v any) error {
+	decoder := json.NewDecoder(strings.NewReader(string(arguments)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// buildVersion returns the module version of the binary, or "dev" for local builds
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// runMCPCommand implements the "mcp" subcommand: it serves the MCP tools over stdin and
+// stdout until the client closes stdin; logs go to standard error as usual
+func runMCPCommand(args []string, llm nodes.LLM, opts runOptions) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: aiagent mcp")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	server, err := newMCPServer(llm, opts)
+	if err != nil {
+		return err
+	}
+	return server.Serve(ctx, os.Stdin, os.Stdout)
+}
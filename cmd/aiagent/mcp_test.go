@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/audit"
+	"aiagent/pkg/config"
+	"aiagent/pkg/mcp"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/pii"
+	"aiagent/pkg/policy"
+)
+
+// newTestMCPServer creates the MCP server of the agent
+func newTestMCPServer(t *testing.T, llm nodes.LLM, opts runOptions) *mcp.Server {
+	t.Helper()
+	server, err := newMCPServer(llm, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// callTool calls a tool of the MCP server of the agent and returns its result
+func callTool(t *testing.T, server *mcp.Server, name, arguments string) *mcp.ToolResult {
+	t.Helper()
+	params, _ := json.Marshal(mcp.CallToolParams{Name: name, Arguments: json.RawMessage(arguments)})
+	request, _ := json.Marshal(mcp.Request{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: mcp.MethodToolsCall, Params: params})
+
+	resp := server.Handle(context.Background(), request)
+	if resp.Error != nil {
+		t.Fatalf("tools/call failed: %v", resp.Error)
+	}
+	var result mcp.ToolResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	return &result
+}
+
+func TestMCP_RunCommand(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var ran []string
+	opts := runOptions{
+		Config: config.Default(),
+		Policy: nodes.PolicyStrict,
+		CommandRunner: func(command, dir string) ([]byte, int, error) {
+			ran = append(ran, command)
+			return []byte("hello\n"), 0, nil
+		},
+	}
+	server := newTestMCPServer(t, nodes.NewScriptedLLM(), opts)
+
+	result := callTool(t, server, "run_command", `{"command": "echo hello"}`)
+	assert.False(t, result.IsError)
+	assert.Equal(t, "exit code: 0\nhello\n", result.Text())
+
+	result = callTool(t, server, "run_command", `{"command": "rm -rf /"}`)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text(), "command validation failed")
+
+	result = callTool(t, server, "run_command", `{"cmd": "ls"}`)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text(), "invalid arguments")
+
+	assert.Equal(t, []string{"echo hello"}, ran, "rejected commands must not run")
+}
+
+func TestMCP_RunCommandPolicyEngine(t *testing.T) {
+	t.Chdir(t.TempDir())
+	engine, err := policy.NewRules([]policy.Rule{{Command: "^curl ", Decision: policy.Deny, Reason: "no downloads"}})
+	assert.NoError(t, err)
+	var ran []string
+	opts := runOptions{
+		Config:       config.Default(),
+		Policy:       nodes.PolicyRelaxed,
+		PolicyEngine: engine,
+		CommandRunner: func(command, dir string) ([]byte, int, error) {
+			ran = append(ran, command)
+			return nil, 0, nil
+		},
+	}
+	server := newTestMCPServer(t, nodes.NewScriptedLLM(), opts)
+
+	result := callTool(t, server, "run_command", `{"command": "curl https://example.com"}`)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Text(), "no downloads")
+	assert.Empty(t, ran, "the command denied by the policy engine must not run")
+
+	dataStore, err := openStorage(opts)
+	assert.NoError(t, err)
+	defer dataStore.Close()
+	entries, err := audit.NewLog(dataStore).Query(audit.Filter{})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "curl https://example.com", entries[0].Command)
+		assert.Equal(t, audit.StatusRejected, entries[0].Status)
+	}
+}
+
+func TestMCP_CollectContent(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes\n"), 0600)
+	server := newTestMCPServer(t, nodes.NewScriptedLLM(), runOptions{Config: config.Default()})
+
+	result := callTool(t, server, "collect_content", `{"patterns": ["*.go"], "read_contents": true}`)
+	assert.False(t, result.IsError)
+	assert.Contains(t, result.Text(), "main.go")
+	assert.Contains(t, result.Text(), "package main")
+	assert.NotContains(t, result.Text(), "notes.txt")
+}
+
+func TestMCP_AnalyzeCode(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0600)
+
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains("package main").Respond(`{"analysis": "The package is empty."}`)
+	llm.OnContains("main function").Respond(`{"needs_content": true, "file_patterns": ["*.go"], "explanation": "read the code"}`)
+	server := newTestMCPServer(t, llm, runOptions{Config: config.Default()})
+
+	result := callTool(t, server, "analyze_code", `{"request": "where is the main function"}`)
+	assert.False(t, result.IsError, result.Text())
+	assert.Equal(t, "The package is empty.", result.Text())
+	llm.AssertExpectations(t)
+}
+
+func TestMCP_AnalyzeCodeRedactsPersonalData(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.WriteFile(filepath.Join(dir, "owners.go"), []byte("package main\n\n// Owner: jane@example.com\n"), 0600)
+
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains("owners").Respond(`{"needs_content": true, "file_patterns": ["*.go"], "explanation": "read the code"}`)
+	llm.OnContains("package main").Respond(`{"analysis": "Jane owns the package."}`)
+	cfg := config.Default()
+	cfg.PII.Mode = pii.ModeRedact
+	server := newTestMCPServer(t, llm, runOptions{Config: cfg})
+
+	result := callTool(t, server, "analyze_code", `{"request": "who are the owners"}`)
+	assert.False(t, result.IsError, result.Text())
+	calls := llm.Calls()
+	for _, prompt := range calls {
+		assert.NotContains(t, prompt, "jane@example.com")
+	}
+	assert.Contains(t, calls[len(calls)-1], "Owner: [EMAIL]")
+}
+
+func TestMCP_ListTools(t *testing.T) {
+	server := newTestMCPServer(t, nodes.NewScriptedLLM(), runOptions{Config: config.Default()})
+	resp := server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+
+	var result mcp.ListToolsResult
+	assert.NoError(t, json.Unmarshal(resp.Result, &result))
+	var names []string
+	for _, tool := range result.Tools {
+		names = append(names, tool.Name)
+		assert.True(t, json.Valid(tool.InputSchema), tool.Name)
+	}
+	assert.Equal(t, []string{"run_command", "run_agent", "analyze_code", "collect_content"}, names)
+}
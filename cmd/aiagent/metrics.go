@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"aiagent/pkg/metrics"
+)
+
+// agentMetrics are the Prometheus metrics of the agent
+type agentMetrics struct {
+	registry *metrics.Registry
+
+	runs         *metrics.Counter
+	lastRun      *metrics.Gauge
+	runDuration  *metrics.Histogram
+	nodeDuration *metrics.Histogram
+	nodeErrors   *metrics.Counter
+	llmRequests  *metrics.Counter
+	llmLatency   *metrics.Histogram
+	llmTokens    *metrics.Counter
+	commands     *metrics.Counter
+}
+
+// newAgentMetrics registers the agent metrics in a new registry
+func newAgentMetrics() *agentMetrics {
+	registry := metrics.NewRegistry()
+	return &agentMetrics{
+		registry:     registry,
+		runs:         registry.NewCounter("aiagent_runs_total", "Graph runs by outcome.", "status"),
+		lastRun:      registry.NewGauge("aiagent_last_run_info", "The run ID and session of the most recent run; the value is its start time in Unix seconds.", "run_id", "session"),
+		runDuration:  registry.NewHistogram("aiagent_run_duration_seconds", "Duration of graph runs.", metrics.DefaultBuckets),
+		nodeDuration: registry.NewHistogram("aiagent_node_duration_seconds", "Duration of node processing.", metrics.DefaultBuckets, "node"),
+		nodeErrors:   registry.NewCounter("aiagent_node_errors_total", "Node processing errors.", "node"),
+		llmRequests:  registry.NewCounter("aiagent_llm_requests_total", "LLM requests by outcome.", "provider", "model", "status"),
+		llmLatency:   registry.NewHistogram("aiagent_llm_request_duration_seconds", "Latency of LLM requests.", metrics.DefaultBuckets, "provider", "model"),
+		llmTokens:    registry.NewCounter("aiagent_llm_tokens_total", "Tokens used by LLM requests.", "provider", "model", "type"),
+		commands:     registry.NewCounter("aiagent_commands_total", "Generated commands by outcome: executed and failed commands were approved, rejected ones were blocked.", "status"),
+	}
+}
+
+// runMetrics is the process wide metrics instance
+var runMetrics = newAgentMetrics()
+
+// serveMetrics serves the metrics on /metrics at addr in the background
+// It returns once the listener is open, so a bad address is reported immediately
+func serveMetrics(addr string, m *agentMetrics) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.registry.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	slog.Info("serving metrics", "addr", listener.Addr().String())
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("metrics server stopped", "error", err)
+		}
+	}()
+	return nil
+}
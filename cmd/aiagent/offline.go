@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/plugins"
+	"aiagent/pkg/sandbox"
+)
+
+// applyOffline turns off the features of the config that connect to other machines:
+// webhooks, trace export, the issue tracker and OIDC sign-in; LLM requests are limited to
+// this machine, and the commands run in a sandbox without network access
+func applyOffline(cfg *config.Config) {
+	if cfg.Webhook.URL != "" {
+		slog.Info("offline: webhook disabled", "url", cfg.Webhook.URL)
+		cfg.Webhook.URL = ""
+	}
+	if cfg.Tracing.Endpoint != "" {
+		slog.Info("offline: trace export disabled", "endpoint", cfg.Tracing.Endpoint)
+		cfg.Tracing.Endpoint = ""
+	}
+	if cfg.IssueTracker.Type != "" {
+		slog.Info("offline: issue tracker disabled", "type", cfg.IssueTracker.Type)
+		cfg.IssueTracker = config.IssueTrackerConfig{}
+	}
+	if cfg.Server.OIDC.Issuer != "" {
+		slog.Info("offline: OIDC sign-in disabled", "issuer", cfg.Server.OIDC.Issuer)
+		cfg.Server.OIDC = config.OIDCConfig{}
+	}
+	cfg.HTTP.Offline = true
+
+	// Running as another user needs open egress, like in safe mode
+	if cfg.Sandbox.User != "" {
+		slog.Info("offline: running commands as another user disabled", "user", cfg.Sandbox.User)
+	}
+	cfg.Sandbox = config.SandboxConfig{Egress: sandbox.EgressNone}
+}
+
+// checkOfflineModel returns an error unless the model runs on this machine: a local provider
+// at a loopback address or a provider plugin
+func checkOfflineModel(model config.ModelConfig, found []plugins.Plugin) error {
+	if _, ok := providerPlugin(found, model.Provider); ok {
+		return nil
+	}
+	if !nodes.IsLocalProvider(model.Provider) {
+		provider := model.Provider
+		if provider == "" {
+			provider = nodes.ProviderOpenAI
+		}
+		return fmt.Errorf("--offline: the %s provider is not on this machine; set model.provider to %s, %s or a provider plugin",
+			provider, nodes.ProviderOllama, nodes.ProviderLlamaCpp)
+	}
+	if model.URL != "" && !isLoopbackURL(model.URL) {
+		return fmt.Errorf("--offline: the model URL %s is not on this machine", model.URL)
+	}
+	return nil
+}
+
+// isLoopbackURL reports whether rawURL points to this machine
+func isLoopbackURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/plugins"
+	"aiagent/pkg/sandbox"
+)
+
+func TestCheckOfflineModel(t *testing.T) {
+	found := []plugins.Plugin{{Name: "local-gguf", Kind: plugins.KindProvider}}
+	tests := []struct {
+		name  string
+		model config.ModelConfig
+		err   string
+	}{
+		{"ollama", config.ModelConfig{Provider: "ollama"}, ""},
+		{"llama.cpp on loopback", config.ModelConfig{Provider: "llamacpp", URL: "http://127.0.0.1:8081/v1/chat/completions"}, ""},
+		{"provider plugin", config.ModelConfig{Provider: "local-gguf"}, ""},
+		{"default provider", config.ModelConfig{}, "--offline: the openai provider is not on this machine; set model.provider to ollama, llamacpp or a provider plugin"},
+		{"azure", config.ModelConfig{Provider: "azure"}, "--offline: the azure provider is not on this machine; set model.provider to ollama, llamacpp or a provider plugin"},
+		{"remote ollama", config.ModelConfig{Provider: "ollama", URL: "http://gpu-box:11434"}, "--offline: the model URL http://gpu-box:11434 is not on this machine"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOfflineModel(tt.model, found)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestApplyOffline(t *testing.T) {
+	cfg := config.Default()
+	cfg.Webhook.URL = "https://hooks.example.com/aiagent"
+	cfg.Tracing.Endpoint = "http://collector:4318"
+	cfg.IssueTracker.Type = "github"
+	cfg.Sandbox = config.SandboxConfig{Egress: sandbox.EgressAllowlist, AllowedHosts: []string{"github.com"}}
+	applyOffline(cfg)
+
+	assert.Empty(t, cfg.Webhook.URL)
+	assert.Empty(t, cfg.Tracing.Endpoint)
+	assert.Empty(t, cfg.IssueTracker.Type)
+	assert.True(t, cfg.HTTP.Offline)
+	assert.Equal(t, config.SandboxConfig{Egress: sandbox.EgressNone}, cfg.Sandbox)
+	assert.NoError(t, cfg.Validate())
+}
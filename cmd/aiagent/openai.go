@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/history"
+	"aiagent/pkg/transcript"
+)
+
+const (
+	// agentModel is the model name of the agent on the chat completions endpoint
+	agentModel = "aiagent"
+
+	// chatCompletionsSession is the session of runs started through the chat completions
+	// endpoint without a user; the clients send the conversation with every request
+	chatCompletionsSession = "chat-completions"
+)
+
+// chatCompletionRequest is the body of POST /v1/chat/completions; parameters of the
+// OpenAI API that do not apply to the agent, e.g. temperature, are ignored
+type chatCompletionRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	User     string        `json:"user"`
+}
+
+// chatMessage is a message of a chat completion request
+// The content is a string or, in newer clients, a list of typed parts
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the text content of the message
+func (m chatMessage) text() string {
+	var text string
+	if err := json.Unmarshal(m.Content, &text); err == nil {
+		return text
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(m.Content, &parts)
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// chatCompletion is a response or, when streaming, a chunk of the chat completions endpoint
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+}
+
+type chatChoice struct {
+	Index        int               `json:"index"`
+	Message      *chatReplyMessage `json:"message,omitempty"`
+	Delta        *chatReplyMessage `json:"delta,omitempty"`
+	FinishReason *string           `json:"finish_reason"`
+}
+
+type chatReplyMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// finishStop is the finish reason of every completion of the agent
+var finishStop = "stop"
+
+// handleModels lists the agent as the only model, for clients that let the user pick one
+func (s *runServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data": []map[string]any{
+			{"id": agentModel, "object": "model", "created": 0, "owned_by": agentModel},
+		},
+	})
+}
+
+// handleChatCompletions runs the last user message of the conversation through the agent;
+// the earlier messages are its conversation context. Commands run by the agent are
+// reported in the answer before the result
+func (s *runServer) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != "user" {
+		writeOpenAIError(w, http.StatusBadRequest, fmt.Errorf("the last message must be a user message"))
+		return
+	}
+
+	session := chatCompletionsSession
+	if req.User != "" && history.ValidateSessionName(req.User) == nil {
+		session = req.User
+	}
+	run, err := s.submit(runRequest{
+		Input:        req.Messages[len(req.Messages)-1].text(),
+		Session:      session,
+		conversation: conversationContext(req.Messages[:len(req.Messages)-1]),
+		user:         requestUser(r),
+	})
+	if err != nil {
+		writeOpenAIError(w, submitStatus(w, err), err)
+		return
+	}
+
+	completion := chatCompletion{
+		ID:      "chatcmpl-" + run.ID,
+		Created: run.CreatedAt.Unix(),
+		Model:   agentModel,
+	}
+	if req.Stream {
+		s.streamChatCompletion(w, r, completion, run.ID)
+		return
+	}
+
+	var content strings.Builder
+	s.follow(r.Context(), run.ID, func(batch []events.Event) {
+		for _, event := range batch {
+			content.WriteString(activity(event))
+		}
+	})
+	if r.Context().Err() != nil {
+		return
+	}
+
+	run = s.snapshot(run.ID)
+	if run == nil || run.Status == string(transcript.StatusFailed) {
+		message := "the run was evicted"
+		if run != nil {
+			message = run.Error
+		}
+		writeOpenAIError(w, http.StatusInternalServerError, fmt.Errorf("%s", message))
+		return
+	}
+	if content.Len() > 0 {
+		content.WriteString("\n")
+	}
+	content.WriteString(run.Result)
+
+	completion.Object = "chat.completion"
+	completion.Choices = []chatChoice{{
+		Message:      &chatReplyMessage{Role: "assistant", Content: content.String()},
+		FinishReason: &finishStop,
+	}}
+	completion.Usage = &chatUsage{}
+	writeJSON(w, http.StatusOK, completion)
+}
+
+// streamChatCompletion sends the activity and the result of a run as server-sent chunks
+func (s *runServer) streamChatCompletion(w http.ResponseWriter, r *http.Request, completion chatCompletion, id string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	completion.Object = "chat.completion.chunk"
+	send := func(delta chatReplyMessage, finish *string) {
+		completion.Choices = []chatChoice{{Delta: &delta, FinishReason: finish}}
+		data, _ := json.Marshal(completion)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send(chatReplyMessage{Role: "assistant"}, nil)
+	reported := false
+	s.follow(r.Context(), id, func(batch []events.Event) {
+		for _, event := range batch {
+			if text := activity(event); text != "" {
+				send(chatReplyMessage{Content: text}, nil)
+				reported = true
+			}
+		}
+	})
+	if r.Context().Err() != nil {
+		return
+	}
+
+	content := ""
+	if run := s.snapshot(id); run == nil {
+		content = "Error: the run was evicted"
+	} else if run.Status == string(transcript.StatusFailed) {
+		content = "Error: " + run.Error
+	} else {
+		content = run.Result
+	}
+	if reported {
+		content = "\n" + content
+	}
+	send(chatReplyMessage{Content: content}, nil)
+	send(chatReplyMessage{}, &finishStop)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// conversationContext summarizes the earlier messages of a chat like the conversation history
+// of a session: every user message with the assistant answer that follows it
+func conversationContext(messages []chatMessage) string {
+	var entries []history.Entry
+	for _, message := range messages {
+		switch message.Role {
+		case "user":
+			entries = append(entries, history.Entry{Input: message.text()})
+		case "assistant":
+			if len(entries) > 0 && entries[len(entries)-1].Result == "" {
+				entries[len(entries)-1].Result = message.text()
+			}
+		}
+	}
+	return history.Summarize(entries, historyContextSize)
+}
+
+// activity describes an event of a run for a chat user, or returns an empty string for
+// events that are not shown
+func activity(event events.Event) string {
+	switch e := event.(type) {
+	case *events.CommandExecuted:
+		return fmt.Sprintf("> ran `%s` (exit code %d)\n", e.Command, e.ExitCode)
+	case *events.CommandRejected:
+		return fmt.Sprintf("> rejected `%s`: %s\n", e.Command, e.Reason)
+	}
+	return ""
+}
+
+// writeOpenAIError writes an error in the format of the OpenAI API, which the SDKs understand
+func writeOpenAIError(w http.ResponseWriter, status int, err error) {
+	kind := "invalid_request_error"
+	switch {
+	case status == http.StatusTooManyRequests:
+		kind = "rate_limit_error"
+	case status == http.StatusServiceUnavailable:
+		kind = "server_overloaded"
+	case status >= http.StatusInternalServerError:
+		kind = "server_error"
+	}
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{"message": err.Error(), "type": kind},
+	})
+}
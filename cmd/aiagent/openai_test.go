@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/events"
+)
+
+func postChatCompletion(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestChatCompletions(t *testing.T) {
+	var got runOptions
+	var gotInput string
+	_, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		gotInput, got = input, opts
+		opts.Events.ForRun(opts.RunID).Publish(&events.CommandExecuted{Command: "ls", ExitCode: 0})
+		return "two files", nil
+	})
+
+	resp := postChatCompletion(t, server.URL, `{
+		"model": "aiagent",
+		"temperature": 0.2,
+		"messages": [
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": "where am I?"},
+			{"role": "assistant", "content": "in /tmp"},
+			{"role": "user", "content": [{"type": "text", "text": "list files"}]}
+		]
+	}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var completion chatCompletion
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+	assert.Equal(t, "chat.completion", completion.Object)
+	assert.Equal(t, "aiagent", completion.Model)
+	if assert.Len(t, completion.Choices, 1) {
+		choice := completion.Choices[0]
+		assert.Equal(t, "assistant", choice.Message.Role)
+		assert.Equal(t, "> ran `ls` (exit code 0)\n\ntwo files", choice.Message.Content)
+		assert.Equal(t, "stop", *choice.FinishReason)
+	}
+
+	assert.Equal(t, "list files", gotInput)
+	assert.Equal(t, chatCompletionsSession, got.Session)
+	assert.Contains(t, got.ConversationContext, "where am I?")
+	assert.Contains(t, got.ConversationContext, "in /tmp")
+	assert.NotContains(t, got.ConversationContext, "be brief")
+}
+
+func TestChatCompletions_Stream(t *testing.T) {
+	_, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		opts.Events.ForRun(opts.RunID).Publish(&events.CommandRejected{Command: "rm -rf /", Reason: "denied"})
+		return "done", nil
+	})
+
+	resp := postChatCompletion(t, server.URL, `{"model": "aiagent", "stream": true, "messages": [{"role": "user", "content": "clean up"}]}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var content strings.Builder
+	var finish string
+	var done bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk chatCompletion
+		assert.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		content.WriteString(chunk.Choices[0].Delta.Content)
+		if chunk.Choices[0].FinishReason != nil {
+			finish = *chunk.Choices[0].FinishReason
+		}
+	}
+	assert.True(t, done)
+	assert.Equal(t, "stop", finish)
+	assert.Equal(t, "> rejected `rm -rf /`: denied\n\ndone", content.String())
+}
+
+func TestChatCompletions_Errors(t *testing.T) {
+	_, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		return "", fmt.Errorf("llm unavailable")
+	})
+
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		message string
+	}{
+		{"invalid body", `{`, http.StatusBadRequest, "invalid request body"},
+		{"no messages", `{"messages": []}`, http.StatusBadRequest, "the last message must be a user message"},
+		{"last message not from the user", `{"messages": [{"role": "assistant", "content": "hi"}]}`, http.StatusBadRequest, "the last message must be a user message"},
+		{"failed run", `{"messages": [{"role": "user", "content": "hi"}]}`, http.StatusInternalServerError, "llm unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postChatCompletion(t, server.URL, tt.body)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			var body struct {
+				Error struct {
+					Message string `json:"message"`
+					Type    string `json:"type"`
+				} `json:"error"`
+			}
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Contains(t, body.Error.Message, tt.message)
+			assert.NotEmpty(t, body.Error.Type)
+		})
+	}
+}
+
+func TestModels(t *testing.T) {
+	_, server := newTestRunServer(t, nil)
+	resp, err := http.Get(server.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&models))
+	if assert.Len(t, models.Data, 1) {
+		assert.Equal(t, "aiagent", models.Data[0].ID)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/plugins"
+)
+
+// newAgentLLMs creates the LLMs of the agents of the orchestration mode with a model of their
+// own; an agent is the planner, the critic or a node of the catalog executing the tasks
+func newAgentLLMs(cfg *config.Config, found []plugins.Plugin, opts runOptions) (map[nodes.NodeType]nodes.LLM, error) {
+	// Agents of the nodes left out by --safe or --offline do not make the config invalid
+	catalog := nodeCatalog(opts)
+	names := make([]string, 0, len(cfg.Orchestration.Agents))
+	for name := range cfg.Orchestration.Agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	llms := make(map[nodes.NodeType]nodes.LLM, len(names))
+	for _, name := range names {
+		node := nodes.NodeType(name)
+		if node != nodes.NodeTypePlanner && node != nodes.NodeTypeCritic && !catalog.Has(node) {
+			return nil, fmt.Errorf("orchestration agent %s: unknown node, use planner, critic or one of %s", name, strings.Join(catalog.Types(), ", "))
+		}
+		model := cfg.Orchestration.Agents[name].Model
+		if opts.Offline {
+			if err := checkOfflineModel(model, found); err != nil {
+				return nil, fmt.Errorf("orchestration agent %s: %v", name, err)
+			}
+		}
+		llm, err := newLLM(model, cfg.HTTP, found)
+		if err != nil {
+			return nil, fmt.Errorf("orchestration agent %s: %v", name, err)
+		}
+		slog.Info("using agent model", "agent", name, "provider", model.Provider, "model", model.Name)
+		llms[node] = llm
+	}
+	return llms, nil
+}
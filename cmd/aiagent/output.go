@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// resultPrinter renders the final result of a run while it is generated, so the first
+// part of a long answer is shown before the run ends
+type resultPrinter struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	printed strings.Builder
+}
+
+// newResultPrinter creates a resultPrinter writing to w
+func newResultPrinter(w io.Writer) *resultPrinter {
+	return &resultPrinter{w: w}
+}
+
+// Write implements the io.Writer interface; it receives the chunks of the result
+func (p *resultPrinter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.printed.Write(b)
+	return p.w.Write(b)
+}
+
+// Finish prints the part of the final result that was not rendered yet and resets the
+// printer for the next run. A result that does not continue the rendered text, e.g. the
+// answer of a plan with several tasks, is printed in full after it
+func (p *resultPrinter) Finish(result string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	printed := strings.TrimSpace(p.printed.String())
+	p.printed.Reset()
+	switch {
+	case printed == "":
+		fmt.Fprint(p.w, result)
+	case strings.HasPrefix(result, printed):
+		fmt.Fprint(p.w, result[len(printed):])
+	default:
+		fmt.Fprint(p.w, "\n\n"+result)
+	}
+}
+
+// Abort ends a failed run; the rendered part of the result is ended with a newline, so
+// the error is printed on a line of its own
+func (p *resultPrinter) Abort() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.printed.Len() > 0 {
+		fmt.Fprintln(p.w)
+	}
+	p.printed.Reset()
+}
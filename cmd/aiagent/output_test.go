@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultPrinter(t *testing.T) {
+	var out strings.Builder
+	printer := newResultPrinter(&out)
+
+	// Nothing was streamed
+	printer.Finish("result\n")
+	assert.Equal(t, "result\n", out.String())
+
+	// The streamed text is not printed twice
+	out.Reset()
+	printer.Write([]byte("Hello, "))
+	printer.Write([]byte("world\n"))
+	printer.Finish("Hello, world")
+	assert.Equal(t, "Hello, world\n", out.String())
+
+	out.Reset()
+	printer.Write([]byte("Hello"))
+	printer.Finish("Hello, world")
+	assert.Equal(t, "Hello, world", out.String())
+
+	// A result replacing the streamed text is printed after it
+	out.Reset()
+	printer.Write([]byte("first task"))
+	printer.Finish("1. first task\n2. second task")
+	assert.Equal(t, "first task\n\n1. first task\n2. second task", out.String())
+
+	out.Reset()
+	printer.Write([]byte("partial"))
+	printer.Abort()
+	assert.Equal(t, "partial\n", out.String())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/pii"
+)
+
+// piiGuard is an LLM scanning the prompts for personal data before they leave the machine,
+// and warning, redacting or blocking as configured
+type piiGuard struct {
+	next    nodes.LLM
+	scanner *pii.Scanner
+	mode    string
+	logger  *slog.Logger
+}
+
+// newPIIGuard wraps llm in a guard of the prompts of a run, or returns llm if the scan is off
+// Personal data the user wrote in the request is not reported
+func newPIIGuard(llm nodes.LLM, cfg config.PIIConfig, input string, logger *slog.Logger) (nodes.LLM, error) {
+	if cfg.Mode == "" || cfg.Mode == pii.ModeOff {
+		return llm, nil
+	}
+	scanner, err := pii.NewScanner(cfg.Kinds)
+	if err != nil {
+		return nil, err
+	}
+	scanner.Allowed = input
+	return &piiGuard{next: llm, scanner: scanner, mode: cfg.Mode, logger: logger}, nil
+}
+
+// guardFrontend wraps the LLM of a frontend calling nodes outside of a run, e.g. the editor,
+// the MCP server, ci or stats, in the guard of its prompts; the runs a frontend starts guard
+// their prompts themselves
+func guardFrontend(llm nodes.LLM, opts runOptions) (nodes.LLM, error) {
+	if opts.Config == nil {
+		return llm, nil
+	}
+	return newPIIGuard(llm, opts.Config.PII, "", slog.Default())
+}
+
+// Complete implements the LLM interface
+func (g *piiGuard) Complete(prompt string) (string, error) {
+	prompt, err := g.check(prompt)
+	if err != nil {
+		return "", err
+	}
+	return g.next.Complete(prompt)
+}
+
+// CompleteStream implements the StreamingLLM interface
+func (g *piiGuard) CompleteStream(prompt string, onChunk func(string)) (string, error) {
+	prompt, err := g.check(prompt)
+	if err != nil {
+		return "", err
+	}
+	return nodes.CompleteStream(g.next, prompt, onChunk)
+}
+
+// check returns the prompt to send, or an error if it must not be sent
+// Only the kinds of the personal data are logged, never the values
+func (g *piiGuard) check(prompt string) (string, error) {
+	redacted, findings := g.scanner.Redact(prompt)
+	if len(findings) == 0 {
+		return prompt, nil
+	}
+	summary := pii.Summary(findings)
+	switch g.mode {
+	case pii.ModeBlock:
+		g.logger.Warn("LLM call blocked: the prompt contains personal data", "found", summary)
+		return "", fmt.Errorf("%w in the prompt: %s", pii.ErrBlocked, summary)
+	case pii.ModeRedact:
+		g.logger.Info("redacted personal data from the prompt", "found", summary)
+		return redacted, nil
+	default:
+		g.logger.Warn("the prompt sent to the LLM contains personal data", "found", summary)
+		return prompt, nil
+	}
+}
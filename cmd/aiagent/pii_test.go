@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/pii"
+)
+
+func TestPIIGuard(t *testing.T) {
+	const prompt = "Summarize the file:\nowner: jane@example.com\nsupport: help@example.com"
+	const input = "summarize the file of help@example.com"
+
+	tests := []struct {
+		mode string
+		sent string
+	}{
+		{pii.ModeOff, prompt},
+		{pii.ModeWarn, prompt},
+		{pii.ModeRedact, "Summarize the file:\nowner: [EMAIL]\nsupport: help@example.com"},
+		{pii.ModeBlock, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			scripted := nodes.NewScriptedLLM()
+			scripted.OnAny().Respond("done")
+			llm, err := newPIIGuard(scripted, config.PIIConfig{Mode: tt.mode}, input, slog.Default())
+			require.NoError(t, err)
+
+			response, err := nodes.CompleteStream(llm, prompt, func(string) {})
+			if tt.sent == "" {
+				assert.ErrorIs(t, err, pii.ErrBlocked)
+				assert.EqualError(t, err, "personal data found in the prompt: email (1)")
+				assert.Equal(t, exitPolicyDenied, exitCode(err))
+				assert.Empty(t, scripted.Calls())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "done", response)
+			assert.Equal(t, []string{tt.sent}, scripted.Calls())
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/plugins"
+)
+
+// pluginDir returns the directory the plugins are discovered in: the configured one, or the
+// plugins directory next to the user config file, e.g. ~/.config/aiagent/plugins
+func pluginDir(cfg config.PluginsConfig) (string, error) {
+	if cfg.Dir != "" {
+		return config.ExpandHome(cfg.Dir)
+	}
+	path, err := config.DefaultPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "plugins"), nil
+}
+
+// discoverPlugins returns the plugins of the plugins directory with the errors of the
+// files that are not valid plugins
+func discoverPlugins(cfg config.PluginsConfig) ([]plugins.Plugin, []error) {
+	if cfg.Disabled {
+		return nil, nil
+	}
+	dir, err := pluginDir(cfg)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return plugins.Discover(dir)
+}
+
+// loadPlugins discovers the plugins registered at startup
+// An invalid plugin is skipped with a warning, so it does not break the agent
+func loadPlugins(cfg config.PluginsConfig) []plugins.Plugin {
+	found, errs := discoverPlugins(cfg)
+	for _, err := range errs {
+		slog.Warn("skipping plugin", "error", err)
+	}
+	for _, plugin := range found {
+		slog.Info("loaded plugin", "plugin", plugin.Name, "kind", plugin.Kind, "path", plugin.Path)
+	}
+	return found
+}
+
+// pluginTools wraps the tool plugins for the tool node
+func pluginTools(found []plugins.Plugin) []nodes.Tool {
+	var tools []nodes.Tool
+	for _, plugin := range found {
+		if plugin.Kind != plugins.KindTool {
+			continue
+		}
+		tools = append(tools, nodes.Tool{
+			Name:        plugin.Name,
+			Description: plugin.Description,
+			InputSchema: plugin.Schema(),
+			Call: func(arguments json.RawMessage) (string, error) {
+				output, err := plugin.Run(arguments)
+				return string(output), err
+			},
+		})
+	}
+	return tools
+}
+
+// pluginMCPServers adds the MCP server plugins to the servers of the config; a server of the
+// config takes precedence over a plugin of the same name
+func pluginMCPServers(servers map[string]config.MCPServerConfig, found []plugins.Plugin) map[string]config.MCPServerConfig {
+	merged := make(map[string]config.MCPServerConfig, len(servers))
+	for name, server := range servers {
+		merged[name] = server
+	}
+	for _, plugin := range found {
+		if _, ok := merged[plugin.Name]; plugin.Kind != plugins.KindMCP || ok {
+			continue
+		}
+		merged[plugin.Name] = config.MCPServerConfig{
+			Command: plugin.Command,
+			Args:    plugin.Args,
+			Env:     plugin.Env,
+			Timeout: plugin.Timeout,
+		}
+	}
+	return merged
+}
+
+// providerPlugin returns the provider plugin selected by the provider of a model
+func providerPlugin(found []plugins.Plugin, provider string) (plugins.Plugin, bool) {
+	for _, plugin := range found {
+		if plugin.Kind == plugins.KindProvider && plugin.Name == provider {
+			return plugin, true
+		}
+	}
+	return plugins.Plugin{}, false
+}
+
+// runPluginsCommand lists the plugins with the files that are not valid plugins
+func runPluginsCommand(args []string, opts runOptions) error {
+	if len(args) > 0 && args[0] != "list" {
+		return fmt.Errorf("unknown plugins command: %s (expected list)", args[0])
+	}
+
+	dir, err := pluginDir(opts.Config.Plugins)
+	if err != nil {
+		return err
+	}
+	if opts.Config.Plugins.Disabled {
+		fmt.Println("Plugins are disabled")
+		return nil
+	}
+	found, errs := discoverPlugins(opts.Config.Plugins)
+	if len(found) == 0 && len(errs) == 0 {
+		fmt.Printf("No plugins found in %s\n", dir)
+		return nil
+	}
+
+	for _, plugin := range found {
+		fmt.Printf("%-16s %-9s %s\n", plugin.Name, plugin.Kind, plugin.Path)
+		if plugin.Description != "" {
+			fmt.Printf("%-16s %-9s %s\n", "", "", plugin.Description)
+		}
+	}
+	for _, err := range errs {
+		fmt.Printf("invalid: %v\n", err)
+	}
+	return nil
+}
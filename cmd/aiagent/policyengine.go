@@ -0,0 +1,44 @@
+package main
+
+import (
+	"aiagent/pkg/config"
+	"aiagent/pkg/policy"
+)
+
+// defaultOPAQuery selects the decision of a Rego policy
+const defaultOPAQuery = "data.aiagent.decision"
+
+// newPolicyEngine creates the policy engine of the config, or returns nil if it has no rules
+// and no Rego policy
+func newPolicyEngine(cfg config.PolicyEngineConfig) (policy.Engine, error) {
+	var engines []policy.Engine
+	if len(cfg.Rules) > 0 {
+		rules, err := policy.NewRules(cfg.Rules)
+		if err != nil {
+			return nil, err
+		}
+		engines = append(engines, rules)
+	}
+	if len(cfg.OPA.Paths) > 0 {
+		opa := &policy.OPA{Query: cfg.OPA.Query, Timeout: cfg.OPA.Timeout}
+		if opa.Query == "" {
+			opa.Query = defaultOPAQuery
+		}
+		for _, path := range cfg.OPA.Paths {
+			expanded, err := config.ExpandHome(path)
+			if err != nil {
+				return nil, err
+			}
+			opa.Paths = append(opa.Paths, expanded)
+		}
+		engines = append(engines, opa)
+	}
+
+	switch len(engines) {
+	case 0:
+		return nil, nil
+	case 1:
+		return engines[0], nil
+	}
+	return policy.Chain(engines...), nil
+}
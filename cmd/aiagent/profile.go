@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+
+	"aiagent/pkg/history"
+)
+
+const (
+	// profileCPU records where the CPU time of a run is spent
+	profileCPU = "cpu"
+
+	// profileMem records the heap allocations when a run ends
+	profileMem = "mem"
+)
+
+// profiler writes the profile of a CLI run selected with --profile
+type profiler struct {
+	mode string
+	path string
+	file *os.File
+}
+
+// startProfile starts the profile mode of a run, written to a file in the .aiagent directory
+// of dir; an empty mode profiles nothing and returns a nil profiler
+func startProfile(mode, dir string) (*profiler, error) {
+	if mode == "" {
+		return nil, nil
+	}
+	if mode != profileCPU && mode != profileMem {
+		return nil, fmt.Errorf("invalid profile %q (expected %q or %q)", mode, profileCPU, profileMem)
+	}
+
+	dataDir := history.DataDir(dir)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory: %v", err)
+	}
+	p := &profiler{
+		mode: mode,
+		path: filepath.Join(dataDir, fmt.Sprintf("profile-%s-%s.pprof", mode, time.Now().Format("20060102-150405"))),
+	}
+	file, err := os.Create(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create profile: %v", err)
+	}
+	p.file = file
+
+	if mode == profileCPU {
+		if err := rpprof.StartCPUProfile(file); err != nil {
+			file.Close()
+			os.Remove(p.path)
+			return nil, fmt.Errorf("failed to start CPU profile: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// Stop writes the profile and returns the path of its file; it does nothing on a nil profiler
+func (p *profiler) Stop() (string, error) {
+	if p == nil {
+		return "", nil
+	}
+
+	switch p.mode {
+	case profileCPU:
+		rpprof.StopCPUProfile()
+	case profileMem:
+		runtime.GC() // Up-to-date statistics of the allocations still in use
+		if err := rpprof.WriteHeapProfile(p.file); err != nil {
+			p.file.Close()
+			return "", fmt.Errorf("failed to write memory profile: %v", err)
+		}
+	}
+	if err := p.file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write profile: %v", err)
+	}
+	return p.path, nil
+}
+
+// stopProfile stops the profile of a run and tells where it was written
+func stopProfile(p *profiler) {
+	path, err := p.Stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else if path != "" {
+		fmt.Fprintf(os.Stderr, "Profile written to %s (inspect it with: go tool pprof %s)\n", path, path)
+	}
+}
+
+// runtimeStats are the runtime diagnostics served on /debug/runtime
+type runtimeStats struct {
+	Goroutines   int    `json:"goroutines"`
+	HeapAlloc    uint64 `json:"heap_alloc_bytes"`
+	HeapInuse    uint64 `json:"heap_inuse_bytes"`
+	Sys          uint64 `json:"sys_bytes"`
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"gc_pause_total_ns"`
+	GoVersion    string `json:"go_version"`
+	Uptime       string `json:"uptime"`
+}
+
+// processStarted is the start time reported as the uptime on /debug/runtime
+var processStarted = time.Now()
+
+// debugHandler serves the pprof profiles on /debug/pprof/ and the runtime diagnostics on
+// /debug/runtime
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/runtime", func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runtimeStats{
+			Goroutines:   runtime.NumGoroutine(),
+			HeapAlloc:    mem.HeapAlloc,
+			HeapInuse:    mem.HeapInuse,
+			Sys:          mem.Sys,
+			NumGC:        mem.NumGC,
+			PauseTotalNs: mem.PauseTotalNs,
+			GoVersion:    runtime.Version(),
+			Uptime:       time.Since(processStarted).Round(time.Second).String(),
+		})
+	})
+	return mux
+}
+
+// checkDebugAddr guards the debug endpoints, which expose the command line and the memory of
+// the process: they only listen on a loopback address
+func checkDebugAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid debug address %q: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("debug endpoints only listen on a loopback address, e.g. localhost%s, not %q", addr[len(host):], addr)
+}
+
+// serveDebug serves the debug endpoints at addr in the background
+// It returns once the listener is open, so a bad address is reported immediately
+func serveDebug(addr string) error {
+	if err := checkDebugAddr(addr); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for debug endpoints: %v", err)
+	}
+
+	server := &http.Server{Handler: debugHandler(), ReadHeaderTimeout: 5 * time.Second}
+
+	slog.Info("serving debug endpoints", "addr", listener.Addr().String())
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("debug server stopped", "error", err)
+		}
+	}()
+	return nil
+}
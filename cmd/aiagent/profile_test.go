@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartProfile(t *testing.T) {
+	for _, mode := range []string{profileCPU, profileMem} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			p, err := startProfile(mode, dir)
+			assert.NoError(t, err)
+
+			path, err := p.Stop()
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(dir, ".aiagent"), filepath.Dir(path))
+			assert.True(t, strings.HasPrefix(filepath.Base(path), "profile-"+mode+"-"))
+			info, err := os.Stat(path)
+			assert.NoError(t, err)
+			assert.NotZero(t, info.Size())
+		})
+	}
+
+	p, err := startProfile("", t.TempDir())
+	assert.NoError(t, err)
+	path, err := p.Stop()
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+
+	_, err = startProfile("block", t.TempDir())
+	assert.ErrorContains(t, err, "invalid profile")
+}
+
+func TestCheckDebugAddr(t *testing.T) {
+	for _, addr := range []string{"localhost:6060", "127.0.0.1:6060", "[::1]:6060"} {
+		assert.NoError(t, checkDebugAddr(addr), addr)
+	}
+	for _, addr := range []string{":6060", "0.0.0.0:6060", "example.com:6060", "6060"} {
+		assert.Error(t, checkDebugAddr(addr), addr)
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	server := httptest.NewServer(debugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/runtime")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var stats runtimeStats
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	assert.Positive(t, stats.Goroutines)
+	assert.NotZero(t, stats.HeapAlloc)
+
+	resp, err = http.Get(server.URL + "/debug/pprof/goroutine?debug=1")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
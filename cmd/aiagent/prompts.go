@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/prompts"
+)
+
+// newPromptRegistry creates the prompt templates of the runs: the built-in templates, the
+// templates of the configured directory, or of the default one, and the configured versions
+func newPromptRegistry(cfg config.PromptsConfig) (*prompts.Registry, error) {
+	registry := prompts.Builtin()
+
+	if cfg.Dir == "" {
+		cfg.Dir = defaultPromptDir()
+	}
+	if cfg.Dir != "" {
+		dir, err := config.ExpandHome(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.LoadDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, version := range cfg.Versions {
+		if err := registry.Use(name, version); err != nil {
+			return nil, fmt.Errorf("invalid prompt version in config: %v", err)
+		}
+	}
+	return registry, nil
+}
+
+// defaultPromptDir returns the prompts directory next to the user config file, e.g.
+// ~/.config/aiagent/prompts, or an empty string if it does not exist
+func defaultPromptDir() string {
+	path, err := config.DefaultPath()
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Join(filepath.Dir(path), "prompts")
+	if _, err := os.Stat(dir); err != nil {
+		return ""
+	}
+	return dir
+}
+
+// runPromptsCommand lists the prompt templates or prints one of them
+func runPromptsCommand(args []string, opts runOptions) error {
+	registry := opts.Prompts
+	if len(args) == 0 || args[0] == "list" {
+		for _, name := range registry.Names() {
+			active := registry.Version(name)
+			var versions []string
+			for _, version := range registry.Versions(name) {
+				if version == active {
+					version += "*"
+				}
+				versions = append(versions, version)
+			}
+			fmt.Printf("%-32s %s\n", name, strings.Join(versions, " "))
+		}
+		return nil
+	}
+
+	if args[0] != "show" || len(args) < 2 || len(args) > 3 {
+		return fmt.Errorf("usage: aiagent prompts list|show <name> [version]")
+	}
+	name := args[1]
+	version := registry.Version(name)
+	if len(args) == 3 {
+		version = args[2]
+	}
+	source, err := registry.Source(name, version)
+	if err != nil {
+		return err
+	}
+	fmt.Println(source)
+	return nil
+}
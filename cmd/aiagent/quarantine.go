@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/quarantine"
+)
+
+// quarantineRunner runs commands with run and quarantines the files they create outside of
+// scope; a command is not run when the files of its directory cannot be recorded
+func quarantineRunner(run nodes.CommandRunner, scope []string) nodes.CommandRunner {
+	if run == nil {
+		run = nodes.RunCommand
+	}
+	return func(command, dir string) ([]byte, int, error) {
+		q := quarantine.New(dir, scope)
+		before, err := q.Snapshot()
+		if err != nil {
+			return nil, -1, fmt.Errorf("quarantine: %v", err)
+		}
+
+		output, exitCode, err := run(command, dir)
+
+		entries, collectErr := q.Collect(before, quarantine.Entry{Source: quarantine.SourceCommand, Command: command})
+		if len(entries) > 0 {
+			slog.Warn("quarantined the files created by a command", "command", command, "files", len(entries))
+			output = append(output, "\n"+quarantine.Summary(entries)+"\n"...)
+		}
+		if collectErr != nil && err == nil {
+			err = fmt.Errorf("quarantine: %v", collectErr)
+		}
+		return output, exitCode, err
+	}
+}
+
+// runQuarantineCommand lists, shows, promotes or discards the quarantined files of the
+// current directory
+func runQuarantineCommand(args []string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %v", err)
+	}
+	q := quarantine.New(dir, nil)
+
+	if len(args) == 0 || args[0] == "list" {
+		entries, err := q.List()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Println("No quarantined files")
+			return nil
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s  %s  %-10s %8d  %s\n", entry.ID, entry.Created.Format(time.RFC3339), entry.Source, entry.Size, entry.Path)
+			if entry.Command != "" {
+				fmt.Printf("    command: %s\n", entry.Command)
+			}
+		}
+		return nil
+	}
+
+	fs := flag.NewFlagSet("quarantine "+args[0], flag.ContinueOnError)
+	force := fs.Bool("force", false, "Overwrite files created or changed since they were quarantined")
+	all := fs.Bool("all", false, "Apply to all quarantined files")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	ids := fs.Args()
+	if *all {
+		entries, err := q.List()
+		if err != nil {
+			return err
+		}
+		ids = nil
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+	}
+
+	switch args[0] {
+	case "show":
+		if len(ids) != 1 {
+			return fmt.Errorf("usage: aiagent quarantine show <id>")
+		}
+		content, err := q.Content(ids[0])
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(content)
+		return nil
+	case "promote", "discard":
+		if len(ids) == 0 && !*all {
+			return fmt.Errorf("usage: aiagent quarantine %s [--all] <id>...", args[0])
+		}
+		for _, id := range ids {
+			if args[0] == "promote" {
+				entry, err := q.Promote(id, *force)
+				if err != nil {
+					return fmt.Errorf("%s: %w", id, err)
+				}
+				fmt.Printf("Promoted %s\n", entry.Path)
+			} else {
+				entry, err := q.Discard(id)
+				if err != nil {
+					return fmt.Errorf("%s: %w", id, err)
+				}
+				fmt.Printf("Discarded %s\n", entry.Path)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown quarantine command: %s (expected list, show, promote or discard)", args[0])
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"aiagent/pkg/transcript"
+)
+
+// runReplayCommand implements the "replay" subcommand
+// It re-runs the graph of a recorded run with the recorded LLM responses, so a reported
+// problem can be reproduced exactly; by default commands are not executed either
+func runReplayCommand(args []string, opts runOptions) (string, error) {
+	// Allow the run ID to come before the flags: aiagent replay <run-id> --strict
+	runID := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		runID = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	execute := fs.Bool("execute", false, "Execute the generated commands instead of returning their recorded output")
+	strict := fs.Bool("strict", false, "Fail as soon as a prompt or command differs from the recorded run")
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if runID == "" && fs.NArg() > 0 {
+		runID = fs.Arg(0)
+	}
+	if runID == "" {
+		return "", fmt.Errorf("usage: aiagent replay <run-id|last> [--execute] [--strict]")
+	}
+
+	// Storage is opened again by the run, so it is closed before replaying
+	store, err := openStorage(opts)
+	if err != nil {
+		return "", err
+	}
+	recorded, err := loadTranscript(transcript.NewStore(store), runID)
+	store.Close()
+	if err != nil {
+		return "", err
+	}
+
+	// Render the prompts with the template versions of the recorded run
+	for name, version := range recorded.Prompts {
+		if opts.Prompts == nil {
+			break
+		}
+		if err := opts.Prompts.Use(name, version); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	player := transcript.NewPlayer(recorded)
+	player.Strict = *strict
+	opts.Replay = recorded
+	opts.Continue = false
+	if !*execute {
+		opts.CommandRunner = player.RunCommand
+	}
+
+	fmt.Fprintf(os.Stderr, "Replaying run %s: %s\n", recorded.RunID, recorded.Input)
+	result, err := runLangGraph(recorded.Input, player, opts)
+	printReplaySummary(recorded, player, result, err)
+	return result, err
+}
+
+// printReplaySummary reports on standard error how the replay compares to the recorded run
+func printReplaySummary(recorded *transcript.Transcript, player *transcript.Player, result string, err error) {
+	for _, d := range player.Divergences() {
+		recordedLine, actualLine := firstDifference(d.Recorded, d.Actual)
+		fmt.Fprintf(os.Stderr, "Diverged at %s step %d (%s):\n  recorded: %s\n  actual:   %s\n",
+			d.Kind, d.Index+1, d.Node, recordedLine, actualLine)
+	}
+	if llmCalls, commands := player.Remaining(); llmCalls > 0 || commands > 0 {
+		fmt.Fprintf(os.Stderr, "The replay stopped early: %d recorded LLM responses and %d commands were not used\n", llmCalls, commands)
+	}
+
+	switch {
+	case err != nil && recorded.Status == transcript.StatusFailed:
+		fmt.Fprintf(os.Stderr, "The replay failed like the recorded run (recorded error: %s)\n", recorded.Error)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "The replay failed but the recorded run completed\n")
+	case recorded.Status == transcript.StatusFailed:
+		fmt.Fprintf(os.Stderr, "The replay completed but the recorded run failed: %s\n", recorded.Error)
+	case result == recorded.Result:
+		fmt.Fprintf(os.Stderr, "The replay result matches the recorded run\n")
+	default:
+		fmt.Fprintf(os.Stderr, "The replay result differs from the recorded run\n")
+	}
+}
+
+// firstDifference returns the first line that differs between a and b
+func firstDifference(a, b string) (string, string) {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+	for i := 0; i < len(aLines) || i < len(bLines); i++ {
+		var aLine, bLine string
+		if i < len(aLines) {
+			aLine = aLines[i]
+		}
+		if i < len(bLines) {
+			bLine = bLines[i]
+		}
+		if aLine != bLine {
+			return aLine, bLine
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"aiagent/pkg/htmlreport"
+	"aiagent/pkg/transcript"
+)
+
+// runReportCommand implements the "report" subcommand: it renders a recorded run, e.g. an
+// analysis, with its execution report as a standalone HTML page or a PDF to share
+func runReportCommand(args []string, opts runOptions) error {
+	// Allow the run ID to come before the flags: aiagent report <run-id> --format pdf
+	runID := "last"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		runID = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := fs.String("format", "html", "Report format: html or pdf")
+	output := fs.String("output", "", "Write the report to this file instead of stdout (required for pdf)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		runID = fs.Arg(0)
+	}
+	if *format != "html" && *format != "pdf" {
+		return fmt.Errorf("unsupported report format %q (supported: html, pdf)", *format)
+	}
+	if *format == "pdf" && *output == "" {
+		return fmt.Errorf("--output is required for pdf reports")
+	}
+
+	store, err := openStorage(opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	t, err := loadTranscript(transcript.NewStore(store), runID)
+	if err != nil {
+		return err
+	}
+
+	var page bytes.Buffer
+	if err := htmlreport.Render(&page, t, "aiagent "+buildVersion()); err != nil {
+		return err
+	}
+	switch {
+	case *format == "pdf":
+		return htmlreport.PDF(page.Bytes(), *output)
+	case *output != "":
+		if err := os.WriteFile(*output, page.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+		return nil
+	default:
+		_, err := os.Stdout.Write(page.Bytes())
+		return err
+	}
+}
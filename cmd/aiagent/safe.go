@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log/slog"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/pii"
+	"aiagent/pkg/policy"
+	"aiagent/pkg/sandbox"
+)
+
+// safeReason is the reason of the policy rule refusing file writes in safe mode
+const safeReason = "files are never written with --safe"
+
+// applySafe turns the config into the safe mode preset: read-only commands with the strict
+// policy in every workspace and an approval for each of them, no network access for the
+// commands, no file writes and personal data redacted from the prompts
+func applySafe(cfg *config.Config) {
+	cfg.Policy = string(nodes.PolicyStrict)
+	for name, workspace := range cfg.Workspaces {
+		if workspace.Policy != "" && workspace.Policy != string(nodes.PolicyStrict) {
+			slog.Info("safe: workspace policy overridden", "workspace", name, "policy", workspace.Policy)
+			workspace.Policy = string(nodes.PolicyStrict)
+			cfg.Workspaces[name] = workspace
+		}
+	}
+
+	// Running as another user needs open egress, and the sandbox is the stronger isolation
+	cfg.Sandbox = config.SandboxConfig{Egress: sandbox.EgressNone}
+
+	// The first matching rule decides, so this one wins over the rules of the config
+	deny := policy.Rule{Action: policy.ActionFileWrite, Decision: policy.Deny, Reason: safeReason}
+	cfg.PolicyEngine.Rules = append([]policy.Rule{deny}, cfg.PolicyEngine.Rules...)
+
+	// Commands are approved one by one, not by their history
+	cfg.LearnedRisk.MinRuns = 0
+
+	if cfg.PII.Mode != pii.ModeBlock {
+		cfg.PII.Mode = pii.ModeRedact
+	}
+}
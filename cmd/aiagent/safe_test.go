@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/pii"
+	"aiagent/pkg/policy"
+	"aiagent/pkg/sandbox"
+)
+
+func TestApplySafe(t *testing.T) {
+	cfg := config.Default()
+	cfg.Policy = "relaxed"
+	cfg.Workspaces = map[string]config.WorkspaceConfig{"infra": {Directory: "/srv/infra", Policy: "relaxed"}}
+	cfg.Sandbox = config.SandboxConfig{Egress: sandbox.EgressAllowlist, AllowedHosts: []string{"github.com"}}
+	cfg.PolicyEngine.Rules = []policy.Rule{{Action: policy.ActionFileWrite, Decision: policy.Allow}}
+	cfg.LearnedRisk.MinRuns = 3
+	applySafe(cfg)
+
+	assert.Equal(t, "strict", cfg.Policy)
+	assert.Equal(t, "strict", cfg.Workspaces["infra"].Policy)
+	assert.Equal(t, config.SandboxConfig{Egress: sandbox.EgressNone}, cfg.Sandbox)
+	assert.Zero(t, cfg.LearnedRisk.MinRuns)
+	assert.Equal(t, pii.ModeRedact, cfg.PII.Mode)
+	assert.NoError(t, cfg.Validate())
+
+	// The deny rule comes first, so it wins over the allow rule of the config
+	engine, err := newPolicyEngine(cfg.PolicyEngine)
+	assert.NoError(t, err)
+	result, err := engine.Evaluate(context.Background(), policy.Input{Action: policy.ActionFileWrite, Path: "main.go"})
+	assert.NoError(t, err)
+	assert.Equal(t, policy.Result{Decision: policy.Deny, Reason: safeReason}, result)
+
+	// Blocking personal data is stricter than redacting it
+	cfg = config.Default()
+	cfg.PII.Mode = pii.ModeBlock
+	applySafe(cfg)
+	assert.Equal(t, pii.ModeBlock, cfg.PII.Mode)
+}
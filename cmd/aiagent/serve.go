@@ -0,0 +1,921 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/history"
+	"aiagent/pkg/jobs"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/transcript"
+)
+
+const (
+	// maxRequestBody is the maximum size of a request body of the HTTP API
+	maxRequestBody = 1 << 20
+
+	// maxServerRuns is the number of runs kept in memory; older finished runs are
+	// still available from their transcripts
+	maxServerRuns = 1000
+
+	// runStatusQueued is the status of a run waiting for a free worker
+	runStatusQueued = string(jobs.StatusQueued)
+
+	// runStatusCanceled is the status of a run canceled through the API
+	runStatusCanceled = string(jobs.StatusCanceled)
+
+	// defaultQueueSize is the number of runs that may wait for a worker
+	defaultQueueSize = 100
+
+	// defaultListLimit and maxListLimit are the default and maximum number of runs listed
+	// by GET /v1/runs
+	defaultListLimit = 50
+	maxListLimit     = 500
+
+	// defaultApprovalTimeout is how long a command waits for its approval before it is rejected
+	defaultApprovalTimeout = 10 * time.Minute
+)
+
+// errUnknownRun is returned for runs that do not exist or belong to another user
+var errUnknownRun = errors.New("unknown run")
+
+// runRequest is the body of POST /v1/runs
+type runRequest struct {
+	Input    string `json:"input"`
+	Session  string `json:"session,omitempty"`
+	Continue bool   `json:"continue,omitempty"`
+
+	// RequireApproval makes every command wait for an answer to POST /v1/runs/{id}/approvals/{approval}
+	RequireApproval bool `json:"require_approval,omitempty"`
+
+	// conversation is the conversation context sent by clients of the chat completions endpoint
+	conversation string
+
+	// user is the authenticated user starting the run
+	user *serverUser
+}
+
+// queuedRun is the payload of the job of a run; it holds everything needed to start
+// the run after a restart of the server
+type queuedRun struct {
+	Input           string `json:"input"`
+	Session         string `json:"session"`
+	Continue        bool   `json:"continue,omitempty"`
+	RequireApproval bool   `json:"require_approval,omitempty"`
+	Conversation    string `json:"conversation,omitempty"`
+	User            string `json:"user,omitempty"`
+}
+
+// approvalRequest is the body of POST /v1/runs/{id}/approvals/{approval}
+type approvalRequest struct {
+	Approved *bool `json:"approved"`
+}
+
+// pendingApproval is a command of a run waiting for its approval
+type pendingApproval struct {
+	ID      string `json:"id"`
+	Command string `json:"command"`
+}
+
+// serverRun is the state of a run started through the HTTP API
+type serverRun struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Input      string     `json:"input"`
+	Session    string     `json:"session"`
+	User       string     `json:"user,omitempty"`
+	Result     string     `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	ExitCode   int        `json:"exit_code,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	// PendingApprovals are the commands waiting for an approval
+	PendingApprovals []pendingApproval `json:"pending_approvals,omitempty"`
+}
+
+// runServer serves the HTTP API; every run gets its own state. Runs wait in a persistent
+// job queue until one of a fixed number of workers executes them
+type runServer struct {
+	opts  runOptions
+	run   func(input string, opts runOptions) (string, error)
+	queue *jobs.Queue
+
+	// approvalTimeout is how long a command waits for its approval
+	approvalTimeout time.Duration
+
+	// auth authenticates the requests; nil if the server is open to everyone
+	auth *serverAuth
+
+	mu        sync.Mutex
+	runs      map[string]*serverRun
+	order     []string
+	events    map[string]*runEvents
+	approvals map[string]chan bool
+
+	// active counts the runs that have not finished; workers counts the running workers
+	active  sync.WaitGroup
+	workers sync.WaitGroup
+
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+// runEvents holds the events of a run kept in memory for its event streams
+type runEvents struct {
+	events []events.Event
+
+	// changed is closed and replaced when an event is added or the run finished
+	changed chan struct{}
+	done    bool
+}
+
+// newRunServer creates a server executing the runs of queue with llm; Start starts the workers
+func newRunServer(llm nodes.LLM, opts runOptions, queue *jobs.Queue) *runServer {
+	if opts.Events == nil {
+		opts.Events = events.NewBus()
+	}
+	s := &runServer{
+		opts: opts,
+		run: func(input string, opts runOptions) (string, error) {
+			return runLangGraph(input, llm, opts)
+		},
+		queue:           queue,
+		approvalTimeout: defaultApprovalTimeout,
+		runs:            make(map[string]*serverRun),
+		events:          make(map[string]*runEvents),
+		approvals:       make(map[string]chan bool),
+		stopping:        make(chan struct{}),
+	}
+	opts.Events.Subscribe(events.SubscriberFunc(s.record))
+	return s
+}
+
+// Handler returns the routes of the HTTP API
+func (s *runServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/runs", s.handleCreateRun)
+	mux.HandleFunc("GET /v1/runs", s.handleListRuns)
+	mux.HandleFunc("GET /v1/runs/{id}", s.handleGetRun)
+	mux.HandleFunc("GET /v1/runs/{id}/events", s.handleRunEvents)
+	mux.HandleFunc("POST /v1/runs/{id}/approvals/{approval}", s.handleApproval)
+	mux.HandleFunc("POST /v1/runs/{id}/cancel", s.handleCancel)
+	mux.HandleFunc("GET /v1/ws", s.handleWebSocket)
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	if s.auth != nil {
+		return s.auth.middleware(mux)
+	}
+	return mux
+}
+
+func (s *runServer) handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	var req runRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+
+	req.user = requestUser(r)
+	run, err := s.submit(req)
+	if err != nil {
+		writeError(w, submitStatus(w, err), err)
+		return
+	}
+
+	w.Header().Set("Location", "/v1/runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// submit validates a run request and queues the run
+func (s *runServer) submit(req runRequest) (*serverRun, error) {
+	if strings.TrimSpace(req.Input) == "" {
+		return nil, fmt.Errorf("input is required")
+	}
+	input, err := validateAndSanitizeInput([]string{req.Input})
+	if err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	if req.Session == "" {
+		req.Session = history.DefaultSession
+	}
+	if err := history.ValidateSessionName(req.Session); err != nil {
+		return nil, err
+	}
+
+	if req.user != nil && !req.user.limiter.Allow(req.user.Name) {
+		return nil, fmt.Errorf("%w: user %s started too many runs", errRateLimited, req.user.Name)
+	}
+
+	queued := queuedRun{
+		Input:           input,
+		Session:         req.Session,
+		Continue:        req.Continue,
+		RequireApproval: req.RequireApproval,
+		Conversation:    req.conversation,
+		User:            userName(req.user),
+	}
+	run := &serverRun{
+		ID:        transcript.NewRunID(),
+		Status:    runStatusQueued,
+		Input:     input,
+		Session:   req.Session,
+		User:      queued.User,
+		CreatedAt: time.Now(),
+	}
+
+	// The run is known before a worker can take its job
+	s.add(run)
+	s.active.Add(1)
+	if _, err := s.queue.Enqueue(run.ID, queued); err != nil {
+		s.remove(run.ID)
+		s.active.Done()
+		return nil, err
+	}
+	return s.snapshot(run.ID), nil
+}
+
+// submitStatus returns the HTTP status of an error of submit
+func submitStatus(w http.ResponseWriter, err error) int {
+	switch {
+	case errors.Is(err, errRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, jobs.ErrQueueFull):
+		w.Header().Set("Retry-After", "60")
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// handleListRuns lists the runs of the user, newest first: the runs kept in memory and the
+// finished runs recorded in transcripts
+func (s *runServer) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	limit := defaultListLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxListLimit {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxListLimit))
+			return
+		}
+		limit = n
+	}
+
+	user := requestUser(r)
+	runs, err := s.list(user, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"runs": runs})
+}
+
+// list returns the last limit runs of user, newest first
+func (s *runServer) list(user *serverUser, limit int) ([]*serverRun, error) {
+	runs := make([]*serverRun, 0)
+	seen := make(map[string]bool)
+	s.mu.Lock()
+	for _, id := range s.order {
+		if run := s.runs[id]; run.User == userName(user) {
+			copied := *run
+			copied.PendingApprovals = slices.Clone(run.PendingApprovals)
+			runs = append(runs, &copied)
+			seen[id] = true
+		}
+	}
+	s.mu.Unlock()
+
+	opts := s.opts
+	if user != nil {
+		opts.Dir = user.Dir
+	}
+	store, err := openStorage(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	transcripts, err := transcript.NewStore(store).List(limit + len(seen))
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range transcripts {
+		if !seen[t.RunID] && t.User == userName(user) {
+			runs = append(runs, transcriptRun(t))
+		}
+	}
+
+	slices.SortStableFunc(runs, func(a, b *serverRun) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (s *runServer) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, err := s.get(requestUser(r), r.PathValue("id"))
+	switch {
+	case errors.Is(err, errUnknownRun):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, run)
+	}
+}
+
+// get returns the state of a run of user
+func (s *runServer) get(user *serverUser, id string) (*serverRun, error) {
+	if run := s.snapshot(id); run != nil {
+		if run.User != userName(user) {
+			return nil, fmt.Errorf("%w: %s", errUnknownRun, id)
+		}
+		return run, nil
+	}
+
+	// Runs evicted from memory or started by an earlier server are read from their transcript,
+	// runs that never started from their job
+	run, err := s.loadRun(id, user)
+	if errors.Is(err, transcript.ErrNotFound) {
+		run, err = s.loadJob(id, user)
+	}
+	if errors.Is(err, transcript.ErrNotFound) || errors.Is(err, jobs.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", errUnknownRun, id)
+	}
+	return run, err
+}
+
+func (s *runServer) handleRunEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	_, ok := s.events[id]
+	s.mu.Unlock()
+	if !ok || !s.owns(requestUser(r), id) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no events for run: %s", id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := events.JSONLines(w)
+
+	s.follow(r.Context(), id, func(batch []events.Event) {
+		for _, event := range batch {
+			encoder.Handle(event)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+}
+
+// follow passes the events of a run to handle, starting with the ones published so far,
+// until the run finished, ctx is done or the server stops; it reports whether the run is known
+func (s *runServer) follow(ctx context.Context, id string, handle func(batch []events.Event)) bool {
+	s.mu.Lock()
+	log, ok := s.events[id]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	for next := 0; ; {
+		s.mu.Lock()
+		pending := log.events[next:]
+		changed, done := log.changed, log.done
+		s.mu.Unlock()
+
+		if len(pending) > 0 || done {
+			handle(pending)
+		}
+		next += len(pending)
+		if done {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return true
+		case <-s.stopping:
+			return true
+		}
+	}
+}
+
+func (s *runServer) handleApproval(w http.ResponseWriter, r *http.Request) {
+	runID, id := r.PathValue("id"), r.PathValue("approval")
+
+	var req approvalRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if req.Approved == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("approved is required"))
+		return
+	}
+
+	if err := s.answer(requestUser(r), runID, id, *req.Approved); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "approved": *req.Approved})
+}
+
+// answer answers a pending approval of a run of user
+func (s *runServer) answer(user *serverUser, runID, id string, approved bool) error {
+	s.mu.Lock()
+	answer, ok := s.approvals[approvalKey(runID, id)]
+	s.mu.Unlock()
+	if !ok || !s.owns(user, runID) || !s.removeApproval(runID, id) {
+		return fmt.Errorf("no pending approval %s for run %s", id, runID)
+	}
+	answer <- approved
+	return nil
+}
+
+func (s *runServer) handleCancel(w http.ResponseWriter, r *http.Request) {
+	run, running, err := s.cancel(requestUser(r), r.PathValue("id"))
+	switch {
+	case errors.Is(err, errUnknownRun):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, jobs.ErrFinished):
+		writeError(w, http.StatusConflict, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	case running:
+		writeJSON(w, http.StatusAccepted, run)
+	default:
+		writeJSON(w, http.StatusOK, run)
+	}
+}
+
+// cancel cancels a run of user: a queued run is removed from the queue, a running run stops
+// before its next node, which running reports
+func (s *runServer) cancel(user *serverUser, id string) (run *serverRun, running bool, err error) {
+	if !s.owns(user, id) {
+		// Runs not kept in memory have finished, if they exist
+		if _, err := s.loadJob(id, user); err == nil {
+			return nil, false, fmt.Errorf("run %s: %w", id, jobs.ErrFinished)
+		}
+		return nil, false, fmt.Errorf("%w: %s", errUnknownRun, id)
+	}
+
+	job, err := s.queue.Cancel(id)
+	switch {
+	case errors.Is(err, jobs.ErrFinished):
+		return nil, false, fmt.Errorf("run %s: %w", id, err)
+	case err != nil:
+		return nil, false, err
+	}
+
+	if job.Status == jobs.StatusRunning {
+		return s.snapshot(id), true, nil
+	}
+	s.finish(id, "", fmt.Errorf("run canceled: %w", context.Canceled))
+	return s.snapshot(id), false, nil
+}
+
+// approver returns the CommandApprover of a run, which waits for the answer to the approval
+// through the API until ctx is canceled
+func (s *runServer) approver(ctx context.Context, runID string) nodes.CommandApprover {
+	return func(id, command string) (bool, error) {
+		answer := make(chan bool, 1)
+		s.mu.Lock()
+		s.approvals[approvalKey(runID, id)] = answer
+		if run, ok := s.runs[runID]; ok {
+			run.PendingApprovals = append(run.PendingApprovals, pendingApproval{ID: id, Command: command})
+		}
+		s.mu.Unlock()
+		defer s.removeApproval(runID, id)
+
+		timer := time.NewTimer(s.approvalTimeout)
+		defer timer.Stop()
+		select {
+		case approved := <-answer:
+			return approved, nil
+		case <-timer.C:
+			return false, fmt.Errorf("no answer within %s", s.approvalTimeout)
+		case <-ctx.Done():
+			return false, fmt.Errorf("run canceled")
+		case <-s.stopping:
+			return false, fmt.Errorf("server is shutting down")
+		}
+	}
+}
+
+// removeApproval removes a pending approval and reports whether it was still pending
+func (s *runServer) removeApproval(runID, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := approvalKey(runID, id)
+	if _, ok := s.approvals[key]; !ok {
+		return false
+	}
+	delete(s.approvals, key)
+	if run, ok := s.runs[runID]; ok {
+		run.PendingApprovals = slices.DeleteFunc(slices.Clone(run.PendingApprovals), func(a pendingApproval) bool {
+			return a.ID == id
+		})
+	}
+	return true
+}
+
+func approvalKey(runID, id string) string {
+	return runID + "/" + id
+}
+
+// record keeps the events of the runs started by the server
+func (s *runServer) record(event events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if log, ok := s.events[events.RunID(event)]; ok && !log.done {
+		log.events = append(log.events, event)
+		close(log.changed)
+		log.changed = make(chan struct{})
+	}
+}
+
+// Start resumes the runs left in the queue by an earlier server and starts the workers
+func (s *runServer) Start(workers int) {
+	for _, id := range s.queue.Pending() {
+		if s.snapshot(id) != nil {
+			continue // submitted before the start
+		}
+		job, err := s.queue.Get(id)
+		if err != nil {
+			slog.Warn("failed to resume queued run", "run_id", id, "error", err)
+			continue
+		}
+		var queued queuedRun
+		json.Unmarshal(job.Payload, &queued)
+		s.add(&serverRun{
+			ID:        id,
+			Status:    runStatusQueued,
+			Input:     queued.Input,
+			Session:   queued.Session,
+			User:      queued.User,
+			CreatedAt: job.CreatedAt,
+		})
+		s.active.Add(1)
+	}
+
+	for i := 0; i < workers; i++ {
+		s.workers.Add(1)
+		go s.work()
+	}
+}
+
+// work executes queued runs one at a time until the queue is closed
+func (s *runServer) work() {
+	defer s.workers.Done()
+	for {
+		job, ctx, err := s.queue.Next(context.Background())
+		if errors.Is(err, jobs.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("failed to take a run from the queue", "error", err)
+			continue
+		}
+		s.execute(ctx, job)
+	}
+}
+
+// execute runs the graph for the job of a run; canceling ctx stops the run before its next node
+func (s *runServer) execute(ctx context.Context, job *jobs.Job) {
+	started := time.Now()
+	s.update(job.ID, func(run *serverRun) {
+		run.Status = string(transcript.StatusRunning)
+		run.StartedAt = &started
+	})
+
+	var result string
+	var queued queuedRun
+	opts, err := s.options(ctx, job.ID, job.Payload, &queued)
+	if err == nil {
+		result, err = s.run(queued.Input, opts)
+	}
+
+	if finishErr := s.queue.Finish(job.ID, result, err); finishErr != nil {
+		slog.Warn("failed to record the outcome of a run", "run_id", job.ID, "error", finishErr)
+	}
+	s.finish(job.ID, result, err)
+}
+
+// options returns the options of the run of a job
+func (s *runServer) options(ctx context.Context, id string, payload []byte, queued *queuedRun) (runOptions, error) {
+	if err := json.Unmarshal(payload, queued); err != nil {
+		return runOptions{}, fmt.Errorf("invalid job: %v", err)
+	}
+
+	opts := s.opts
+	if queued.User != "" {
+		if s.auth == nil || s.auth.byName[queued.User] == nil {
+			return runOptions{}, fmt.Errorf("unknown user: %s", queued.User)
+		}
+		user := s.auth.byName[queued.User]
+		opts.Dir = user.Dir
+		opts.Policy = user.Policy
+		opts.User = user.Name
+	}
+	opts.Context = ctx
+	opts.RunID = id
+	opts.Session = queued.Session
+	opts.Continue = queued.Continue
+	opts.ConversationContext = queued.Conversation
+	if queued.RequireApproval {
+		opts.Approver = s.approver(ctx, id)
+	}
+	return opts, nil
+}
+
+// finish records the outcome of a run and ends its event streams
+func (s *runServer) finish(id, result string, err error) {
+	finished := time.Now()
+	s.update(id, func(run *serverRun) {
+		if log, ok := s.events[id]; ok && !log.done {
+			log.done = true
+			close(log.changed)
+		}
+		run.FinishedAt = &finished
+		run.Result = result
+		run.Status = string(transcript.StatusCompleted)
+		if err != nil {
+			run.Status = string(transcript.StatusFailed)
+			if errors.Is(err, context.Canceled) {
+				run.Status = runStatusCanceled
+			}
+			run.Error = err.Error()
+			run.ExitCode = exitCode(err)
+		}
+	})
+	s.active.Done()
+}
+
+// add registers a new run, evicting the oldest finished runs beyond maxServerRuns
+func (s *runServer) add(run *serverRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[run.ID] = run
+	s.order = append(s.order, run.ID)
+	s.events[run.ID] = &runEvents{changed: make(chan struct{})}
+
+	for i := 0; len(s.runs) > maxServerRuns && i < len(s.order); {
+		old := s.runs[s.order[i]]
+		if old.FinishedAt == nil {
+			i++
+			continue
+		}
+		delete(s.runs, old.ID)
+		delete(s.events, old.ID)
+		s.order = append(s.order[:i], s.order[i+1:]...)
+	}
+}
+
+// remove forgets a run that could not be queued
+func (s *runServer) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.runs, id)
+	delete(s.events, id)
+	s.order = slices.DeleteFunc(s.order, func(other string) bool { return other == id })
+}
+
+func (s *runServer) update(id string, change func(run *serverRun)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if run, ok := s.runs[id]; ok {
+		change(run)
+	}
+}
+
+// owns reports whether a run kept in memory was started by user
+func (s *runServer) owns(user *serverUser, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	return ok && run.User == userName(user)
+}
+
+// snapshot returns a copy of a run kept in memory, or nil
+func (s *runServer) snapshot(id string) *serverRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return nil
+	}
+	copied := *run
+	copied.PendingApprovals = slices.Clone(run.PendingApprovals)
+	return &copied
+}
+
+// loadRun builds the state of a finished run of user from its transcript
+func (s *runServer) loadRun(id string, user *serverUser) (*serverRun, error) {
+	opts := s.opts
+	if user != nil {
+		opts.Dir = user.Dir
+	}
+	store, err := openStorage(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	t, err := transcript.NewStore(store).Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.User != userName(user) {
+		return nil, transcript.ErrNotFound
+	}
+	return transcriptRun(t), nil
+}
+
+// transcriptRun builds the state of a finished run from its transcript
+func transcriptRun(t *transcript.Transcript) *serverRun {
+	run := &serverRun{
+		ID:        t.RunID,
+		Status:    string(t.Status),
+		Input:     t.Input,
+		Session:   t.Session,
+		User:      t.User,
+		Result:    t.Result,
+		Error:     t.Error,
+		CreatedAt: t.StartedAt,
+		StartedAt: &t.StartedAt,
+	}
+	if !t.FinishedAt.IsZero() {
+		run.FinishedAt = &t.FinishedAt
+	}
+	return run
+}
+
+// loadJob builds the state of a run of user from its job, for runs that never started
+func (s *runServer) loadJob(id string, user *serverUser) (*serverRun, error) {
+	job, err := s.queue.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	var queued queuedRun
+	json.Unmarshal(job.Payload, &queued)
+	if queued.User != userName(user) {
+		return nil, jobs.ErrNotFound
+	}
+
+	run := &serverRun{
+		ID:        job.ID,
+		Status:    string(job.Status),
+		Input:     queued.Input,
+		Session:   queued.Session,
+		User:      queued.User,
+		Result:    job.Result,
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt,
+	}
+	if !job.StartedAt.IsZero() {
+		run.StartedAt = &job.StartedAt
+	}
+	if !job.FinishedAt.IsZero() {
+		run.FinishedAt = &job.FinishedAt
+	}
+	return run, nil
+}
+
+// Wait blocks until all queued runs have finished
+func (s *runServer) Wait() {
+	s.active.Wait()
+}
+
+// Stop rejects the pending approvals, ends the event streams and stops the workers once
+// their current run finished, so the server can shut down; queued runs stay in the queue
+func (s *runServer) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+		s.queue.Close()
+	})
+}
+
+// Shutdown stops the server and waits for the running runs to finish
+func (s *runServer) Shutdown() {
+	s.Stop()
+	s.workers.Wait()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// runServeCommand implements the "serve" subcommand: it serves the HTTP API until
+// the process is interrupted, then waits for the running runs to finish
+func runServeCommand(args []string, llm nodes.LLM, opts runOptions) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "Address to listen on")
+	grpcAddr := fs.String("grpc-addr", "", "Address to serve the gRPC API on (default: no gRPC API)")
+	concurrency := fs.Int("concurrency", 1, "Number of workers executing runs at the same time")
+	queueSize := fs.Int("queue-size", defaultQueueSize, "Maximum number of runs waiting for a worker (0: no limit)")
+	approvalTimeout := fs.Duration("approval-timeout", defaultApprovalTimeout, "Time a command waits for its approval before it is rejected")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+	if *queueSize < 0 {
+		return fmt.Errorf("queue size must not be negative")
+	}
+
+	serverAuth, err := newServerAuth(opts.Config.Server, opts.Policy)
+	if err != nil {
+		return err
+	}
+
+	// Queued runs are kept with the server's data, so they survive a restart
+	store, err := openStorage(opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	queue, err := jobs.Open(store, *queueSize)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+	var grpcListener net.Listener
+	if *grpcAddr != "" {
+		if grpcListener, err = net.Listen("tcp", *grpcAddr); err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to listen: %v", err)
+		}
+	}
+
+	runs := newRunServer(llm, opts, queue)
+	runs.approvalTimeout = *approvalTimeout
+	runs.auth = serverAuth
+	runs.Start(*concurrency)
+
+	if grpcListener != nil {
+		grpcServer := newGRPCServer(runs)
+		go grpcServer.Serve(grpcListener)
+		defer grpcServer.GracefulStop()
+		slog.Info("serving gRPC API", "addr", grpcListener.Addr().String())
+		fmt.Printf("Serving the gRPC API on %s\n", grpcListener.Addr())
+	}
+
+	slog.Info("serving HTTP API", "addr", listener.Addr().String())
+	fmt.Printf("Serving the HTTP API on http://%s\n", listener.Addr())
+	return serveRuns(listener, runs.Handler(), runs)
+}
+
+// serveRuns serves handler until the process is interrupted, then stops runs and waits for
+// the running runs to finish
+func serveRuns(listener net.Listener, handler http.Handler, runs *runServer) error {
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		runs.Stop()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	runs.Shutdown()
+	return nil
+}
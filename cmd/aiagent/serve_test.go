@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/jobs"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/storage"
+	"aiagent/pkg/transcript"
+)
+
+// newTestRunServer creates a server whose runs are answered by run instead of the graph
+func newTestRunServer(t *testing.T, run func(input string, opts runOptions) (string, error)) (*runServer, *httptest.Server) {
+	t.Chdir(t.TempDir()) // unknown runs are looked up in the storage of the working directory
+	s := newRunServer(nil, runOptions{Storage: "file"}, newTestQueue(t))
+	s.run = run
+	s.Start(1)
+	t.Cleanup(s.Shutdown)
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func newTestQueue(t *testing.T) *jobs.Queue {
+	queue, err := jobs.Open(storage.NewFileStore(t.TempDir()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queue
+}
+
+func postRun(t *testing.T, server *httptest.Server, body string) (*http.Response, serverRun) {
+	t.Helper()
+	resp, err := http.Post(server.URL+"/v1/runs", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var run serverRun
+	json.NewDecoder(resp.Body).Decode(&run)
+	return resp, run
+}
+
+func getRun(t *testing.T, server *httptest.Server, id string) (int, serverRun) {
+	t.Helper()
+	resp, err := http.Get(server.URL + "/v1/runs/" + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var run serverRun
+	json.NewDecoder(resp.Body).Decode(&run)
+	return resp.StatusCode, run
+}
+
+func TestServe_RunLifecycle(t *testing.T) {
+	release := make(chan struct{})
+	var gotOpts runOptions
+	s, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		gotOpts = opts
+		<-release
+		return "result of " + input, nil
+	})
+
+	resp, run := postRun(t, server, `{"input": "list files", "session": "work", "continue": true}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "/v1/runs/"+run.ID, resp.Header.Get("Location"))
+	assert.NotEmpty(t, run.ID)
+	assert.Equal(t, "list files", run.Input)
+
+	status, run := getRun(t, server, run.ID)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, []string{runStatusQueued, "running"}, run.Status)
+
+	close(release)
+	s.Wait()
+
+	status, run = getRun(t, server, run.ID)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "completed", run.Status)
+	assert.Equal(t, "result of list files", run.Result)
+	assert.NotNil(t, run.FinishedAt)
+
+	// Every run gets its own options and run ID
+	assert.Equal(t, run.ID, gotOpts.RunID)
+	assert.Equal(t, "work", gotOpts.Session)
+	assert.True(t, gotOpts.Continue)
+}
+
+func TestServe_FailedRun(t *testing.T) {
+	s, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		return "", fmt.Errorf("error in node classifier: %w", nodes.ErrParse)
+	})
+
+	_, run := postRun(t, server, `{"input": "list files"}`)
+	s.Wait()
+
+	_, run = getRun(t, server, run.ID)
+	assert.Equal(t, "failed", run.Status)
+	assert.Equal(t, "default", run.Session)
+	assert.Contains(t, run.Error, "classifier")
+	assert.Equal(t, exitLLM, run.ExitCode)
+}
+
+func TestServe_RunsOneAtATime(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	s, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		started <- input
+		<-release
+		return "", nil
+	})
+
+	postRun(t, server, `{"input": "first"}`)
+	_, second := postRun(t, server, `{"input": "second"}`)
+
+	<-started
+	select {
+	case input := <-started:
+		t.Fatalf("run %q started while another run was running", input)
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, run := getRun(t, server, second.ID)
+	assert.Equal(t, runStatusQueued, run.Status)
+
+	close(release)
+	s.Wait()
+}
+
+func TestServe_BadRequests(t *testing.T) {
+	_, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		t.Error("no run expected")
+		return "", nil
+	})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed", `{"input": `},
+		{"unknown field", `{"input": "ls", "force_approve": true}`},
+		{"empty input", `{"input": ""}`},
+		{"invalid session", `{"input": "ls", "session": "../etc"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := postRun(t, server, tt.body)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+
+	status, _ := getRun(t, server, "20260101-000000-abcdef")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestServe_RunEvents(t *testing.T) {
+	s, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		publisher := opts.Events.ForRun(opts.RunID)
+		publisher.Publish(&events.NodeStarted{Node: "classifier"})
+		publisher.Publish(&events.RunFinished{Result: "done"})
+		return "done", nil
+	})
+
+	_, run := postRun(t, server, `{"input": "list files"}`)
+	s.Wait()
+
+	resp, err := http.Get(server.URL + "/v1/runs/" + run.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	var types []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line struct {
+			Type  string          `json:"type"`
+			Event json.RawMessage `json:"event"`
+		}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		assert.Contains(t, string(line.Event), run.ID)
+		types = append(types, line.Type)
+	}
+	assert.Equal(t, []string{"node_started", "run_finished"}, types, "the stream must end when the run finished")
+
+	resp, err = http.Get(server.URL + "/v1/runs/unknown/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServe_Approvals(t *testing.T) {
+	s, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		if opts.Approver == nil {
+			return "no approval required", nil
+		}
+		approved, err := opts.Approver("1", "ls")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("approved: %v", approved), nil
+	})
+
+	approve := func(runID, id, body string) int {
+		resp, err := http.Post(server.URL+"/v1/runs/"+runID+"/approvals/"+id, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	_, run := postRun(t, server, `{"input": "list files", "require_approval": true}`)
+	assert.Eventually(t, func() bool {
+		_, run = getRun(t, server, run.ID)
+		return len(run.PendingApprovals) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, pendingApproval{ID: "1", Command: "ls"}, run.PendingApprovals[0])
+
+	assert.Equal(t, http.StatusBadRequest, approve(run.ID, "1", `{}`))
+	assert.Equal(t, http.StatusNotFound, approve(run.ID, "2", `{"approved": true}`))
+	assert.Equal(t, http.StatusOK, approve(run.ID, "1", `{"approved": false}`))
+	assert.Equal(t, http.StatusNotFound, approve(run.ID, "1", `{"approved": true}`), "an approval is answered once")
+	s.Wait()
+
+	_, run = getRun(t, server, run.ID)
+	assert.Equal(t, "approved: false", run.Result)
+	assert.Empty(t, run.PendingApprovals)
+
+	_, run = postRun(t, server, `{"input": "list files"}`)
+	s.Wait()
+	_, run = getRun(t, server, run.ID)
+	assert.Equal(t, "no approval required", run.Result)
+}
+
+func TestServe_ApprovalTimeout(t *testing.T) {
+	s, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		_, err := opts.Approver("1", "ls")
+		return "", err
+	})
+	s.approvalTimeout = 10 * time.Millisecond
+
+	_, run := postRun(t, server, `{"input": "list files", "require_approval": true}`)
+	s.Wait()
+
+	_, run = getRun(t, server, run.ID)
+	assert.Equal(t, "failed", run.Status)
+	assert.Contains(t, run.Error, "no answer within")
+	assert.Empty(t, run.PendingApprovals)
+}
+
+func postCancel(t *testing.T, server *httptest.Server, id string) (int, serverRun) {
+	t.Helper()
+	resp, err := http.Post(server.URL+"/v1/runs/"+id+"/cancel", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var run serverRun
+	json.NewDecoder(resp.Body).Decode(&run)
+	return resp.StatusCode, run
+}
+
+func TestServe_Cancel(t *testing.T) {
+	started := make(chan struct{})
+	s, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		close(started)
+		<-opts.Context.Done()
+		return "", fmt.Errorf("run canceled: %w", opts.Context.Err())
+	})
+
+	_, running := postRun(t, server, `{"input": "first"}`)
+	_, queued := postRun(t, server, `{"input": "second"}`)
+	<-started
+
+	status, run := postCancel(t, server, queued.ID)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, runStatusCanceled, run.Status)
+
+	status, _ = postCancel(t, server, running.ID)
+	assert.Equal(t, http.StatusAccepted, status)
+	s.Wait()
+	_, run = getRun(t, server, running.ID)
+	assert.Equal(t, runStatusCanceled, run.Status)
+
+	status, _ = postCancel(t, server, running.ID)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = postCancel(t, server, "unknown")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestServe_QueueFull(t *testing.T) {
+	release := make(chan struct{})
+	t.Chdir(t.TempDir())
+	queue, err := jobs.Open(storage.NewFileStore(t.TempDir()), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newRunServer(nil, runOptions{Storage: "file"}, queue)
+	s.run = func(input string, opts runOptions) (string, error) {
+		<-release
+		return "", nil
+	}
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	// Without workers every run waits in the queue
+	resp, _ := postRun(t, server, `{"input": "first"}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp, _ = postRun(t, server, `{"input": "second"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	close(release)
+	s.Start(1)
+	s.Wait()
+	s.Shutdown()
+}
+
+func TestServe_ResumesQueuedRuns(t *testing.T) {
+	t.Chdir(t.TempDir())
+	store := storage.NewFileStore(t.TempDir())
+	queue, err := jobs.Open(store, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Enqueue("20260101-120000-a1b2c3", queuedRun{Input: "list files", Session: "work"})
+
+	// A new server picks up the runs its predecessor left in the queue
+	queue, err = jobs.Open(store, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got runOptions
+	s := newRunServer(nil, runOptions{Storage: "file"}, queue)
+	s.run = func(input string, opts runOptions) (string, error) {
+		got = opts
+		return "result of " + input, nil
+	}
+	s.Start(1)
+	defer s.Shutdown()
+	s.Wait()
+
+	run := s.snapshot("20260101-120000-a1b2c3")
+	if assert.NotNil(t, run) {
+		assert.Equal(t, "completed", run.Status)
+		assert.Equal(t, "result of list files", run.Result)
+	}
+	assert.Equal(t, "work", got.Session)
+}
+
+func TestServe_ListRuns(t *testing.T) {
+	s, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		return "result of " + input, nil
+	})
+
+	// A run of an earlier server is only known from its transcript
+	store, err := openStorage(runOptions{Storage: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := transcript.New("20200101-120000-a1b2c3", "show disk usage")
+	old.StartedAt = time.Now().Add(-time.Hour)
+	old.Finish("10G free", nil)
+	if err := transcript.NewStore(store).Save(old); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	postRun(t, server, `{"input": "list files"}`)
+	s.Wait()
+	postRun(t, server, `{"input": "print the date"}`)
+	s.Wait()
+
+	list := func(query string) (int, []serverRun) {
+		resp, err := http.Get(server.URL + "/v1/runs" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Runs []serverRun `json:"runs"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Runs
+	}
+
+	status, runs := list("")
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, runs, 3) {
+		assert.Equal(t, "print the date", runs[0].Input)
+		assert.Equal(t, "list files", runs[1].Input)
+		assert.Equal(t, "show disk usage", runs[2].Input)
+		assert.Equal(t, "10G free", runs[2].Result)
+	}
+
+	_, runs = list("?limit=1")
+	assert.Len(t, runs, 1)
+
+	status, _ = list("?limit=0")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"aiagent/pkg/history"
+)
+
+// runSessionsCommand implements the "sessions" subcommand
+func runSessionsCommand(args []string, opts runOptions) error {
+	dataStore, err := openStorage(opts)
+	if err != nil {
+		return err
+	}
+	defer dataStore.Close()
+	store := history.NewStore(dataStore)
+
+	if len(args) == 0 {
+		return fmt.Errorf("missing sessions command (expected list, delete or expire)")
+	}
+
+	switch args[0] {
+	case "list":
+		sessions, err := store.List()
+		if err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No sessions found")
+			return nil
+		}
+		fmt.Printf("%-20s %-16s %-6s %s\n", "NAME", "ID", "RUNS", "UPDATED")
+		for _, session := range sessions {
+			fmt.Printf("%-20s %-16s %-6d %s\n", session.Name, session.ID, len(session.Entries), session.UpdatedAt.Format(time.RFC3339))
+		}
+		return nil
+
+	case "delete":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: aiagent sessions delete <name>")
+		}
+		if err := store.Delete(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted session %s\n", args[1])
+		return nil
+
+	case "expire":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: aiagent sessions expire <age> (e.g. 7d, 12h)")
+		}
+		maxAge, err := parseAge(args[1])
+		if err != nil {
+			return err
+		}
+		expired, err := store.Expire(maxAge)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Expired %d session(s)\n", len(expired))
+		for _, name := range expired {
+			fmt.Printf("- %s\n", name)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown sessions command: %s", args[0])
+	}
+}
+
+// parseAge parses a duration that may also be expressed in days (e.g. "7d")
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age: %s", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age: %s", value)
+	}
+	return age, nil
+}
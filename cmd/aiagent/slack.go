@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/jobs"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/slack"
+	"aiagent/pkg/truncate"
+)
+
+const (
+	// slackMaxResult is the maximum length of a result posted to Slack; longer results are cut
+	slackMaxResult = 3500
+
+	// slackEventTTL is how long event IDs are remembered to ignore the retries of Slack
+	slackEventTTL = time.Hour
+
+	// Action IDs of the approval buttons; the value of a button is <run id>/<approval id>
+	slackActionApprove = "approve"
+	slackActionReject  = "reject"
+)
+
+// slackMention matches the mentions of users and of the bot in the text of a message
+var slackMention = regexp.MustCompile(`<@[A-Z0-9]+(\|[^>]*)?>`)
+
+// slackBot answers mentions and direct messages in Slack by running the graph, and asks
+// the user who sent the message to approve the commands with buttons
+type slackBot struct {
+	runs            *runServer
+	client          *slack.Client
+	secret          string
+	requireApproval bool
+	now             func() time.Time
+
+	mu         sync.Mutex
+	seen       map[string]time.Time
+	requesters map[string]string
+	commands   map[string]string
+	wg         sync.WaitGroup
+}
+
+// newSlackBot creates a bot running the requests with runs and posting with client
+func newSlackBot(runs *runServer, client *slack.Client, secret string) *slackBot {
+	return &slackBot{
+		runs:            runs,
+		client:          client,
+		secret:          secret,
+		requireApproval: true,
+		now:             time.Now,
+		seen:            make(map[string]time.Time),
+		requesters:      make(map[string]string),
+		commands:        make(map[string]string),
+	}
+}
+
+// Handler returns the request URLs of the Slack app: the Events API and the interactivity endpoint
+func (b *slackBot) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /slack/events", b.handleEvents)
+	mux.HandleFunc("POST /slack/interactions", b.handleInteraction)
+	return mux
+}
+
+// readSigned reads the body of a request and checks that Slack signed it
+func (b *slackBot) readSigned(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read request: %v", err))
+		return nil, false
+	}
+	if err := slack.Verify(b.secret, r.Header, body, b.now()); err != nil {
+		slog.Warn("rejected Slack request", "error", err)
+		writeError(w, http.StatusUnauthorized, err)
+		return nil, false
+	}
+	return body, true
+}
+
+func (b *slackBot) handleEvents(w http.ResponseWriter, r *http.Request) {
+	body, ok := b.readSigned(w, r)
+	if !ok {
+		return
+	}
+
+	var envelope slack.Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid event: %v", err))
+		return
+	}
+	switch envelope.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, envelope.Challenge)
+		return
+	case "event_callback":
+		// Slack retries events not acknowledged within 3 seconds, so runs are started
+		// in the background and every event is handled once
+		if b.firstDelivery(envelope.EventID) {
+			b.wg.Add(1)
+			go func() {
+				defer b.wg.Done()
+				b.handleMessage(envelope.Event)
+			}()
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// firstDelivery reports whether an event is seen for the first time
+func (b *slackBot) firstDelivery(eventID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	for id, seen := range b.seen {
+		if now.Sub(seen) > slackEventTTL {
+			delete(b.seen, id)
+		}
+	}
+	if _, ok := b.seen[eventID]; ok && eventID != "" {
+		return false
+	}
+	b.seen[eventID] = now
+	return true
+}
+
+// handleMessage runs the request of a mention or a direct message and replies in its thread;
+// a reply in a thread continues the conversation of the thread
+func (b *slackBot) handleMessage(event slack.Event) {
+	direct := event.Type == "message" && event.ChannelType == "im"
+	if event.Type != "app_mention" && !direct {
+		return
+	}
+	if event.BotID != "" || event.Subtype != "" {
+		return // messages of bots, including our own replies, and edits
+	}
+
+	thread := event.ThreadTS
+	if thread == "" {
+		thread = event.TS
+	}
+	ctx := context.Background()
+	reply := func(text string, blocks ...slack.Block) string {
+		ts, err := b.client.PostMessage(ctx, slack.Message{Channel: event.Channel, ThreadTS: thread, Text: text, Blocks: blocks})
+		if err != nil {
+			slog.Warn("failed to post to Slack", "channel", event.Channel, "error", err)
+		}
+		return ts
+	}
+
+	input := strings.TrimSpace(html.UnescapeString(slackMention.ReplaceAllString(event.Text, "")))
+	run, err := b.runs.submit(runRequest{
+		Input:           input,
+		Session:         slackSession(event.Channel, thread),
+		Continue:        event.ThreadTS != "",
+		RequireApproval: b.requireApproval,
+	})
+	if err != nil {
+		reply(":warning: " + err.Error())
+		return
+	}
+	b.mu.Lock()
+	b.requesters[run.ID] = event.User
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.requesters, run.ID)
+		b.mu.Unlock()
+	}()
+
+	var activities strings.Builder
+	b.runs.follow(ctx, run.ID, func(batch []events.Event) {
+		for _, e := range batch {
+			activities.WriteString(activity(e))
+			if pending, ok := e.(*events.ApprovalPending); ok {
+				b.mu.Lock()
+				b.commands[approvalKey(run.ID, pending.ID)] = pending.Command
+				b.mu.Unlock()
+				text := fmt.Sprintf("<@%s>, may I run `%s`?", event.User, pending.Command)
+				value := approvalKey(run.ID, pending.ID)
+				reply(text, slack.Section(text), slack.Actions(
+					slack.Button{ActionID: slackActionApprove, Text: "Approve", Value: value, Style: "primary"},
+					slack.Button{ActionID: slackActionReject, Text: "Reject", Value: value, Style: "danger"},
+				))
+			}
+		}
+	})
+
+	reply(slackResult(b.runs.snapshot(run.ID), activities.String()))
+}
+
+func (b *slackBot) handleInteraction(w http.ResponseWriter, r *http.Request) {
+	body, ok := b.readSigned(w, r)
+	if !ok {
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid interaction: %v", err))
+		return
+	}
+	var interaction slack.Interaction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid interaction: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	for _, action := range interaction.Actions {
+		if action.ActionID != slackActionApprove && action.ActionID != slackActionReject {
+			continue
+		}
+		b.answer(interaction, action)
+	}
+}
+
+// answer passes the click on an approval button to the run and replaces the buttons
+// with the answer; only the user who sent the request may answer
+func (b *slackBot) answer(interaction slack.Interaction, action slack.Action) {
+	ctx := context.Background()
+	runID, approvalID, _ := strings.Cut(action.Value, "/")
+	user := interaction.User.ID
+
+	b.mu.Lock()
+	requester := b.requesters[runID]
+	command := b.commands[action.Value]
+	b.mu.Unlock()
+
+	thread := interaction.Message.ThreadTS
+	if thread == "" {
+		thread = interaction.Message.TS
+	}
+	if requester != "" && requester != user {
+		b.client.PostMessage(ctx, slack.Message{
+			Channel:  interaction.Channel.ID,
+			ThreadTS: thread,
+			Text:     fmt.Sprintf("<@%s>, only <@%s> can answer this approval.", user, requester),
+		})
+		return
+	}
+
+	approved := action.ActionID == slackActionApprove
+	text := fmt.Sprintf(":white_check_mark: <@%s> approved `%s`", user, command)
+	if !approved {
+		text = fmt.Sprintf(":no_entry: <@%s> rejected `%s`", user, command)
+	}
+	if err := b.runs.answer(nil, runID, approvalID, approved); err != nil {
+		text = fmt.Sprintf(":hourglass: `%s` is no longer waiting for an answer", command)
+	}
+	b.mu.Lock()
+	delete(b.commands, action.Value)
+	b.mu.Unlock()
+
+	// Replacing the message removes the buttons
+	err := b.client.UpdateMessage(ctx, slack.Message{
+		Channel: interaction.Channel.ID,
+		TS:      interaction.Message.TS,
+		Text:    text,
+		Blocks:  []slack.Block{slack.Section(text)},
+	})
+	if err != nil {
+		slog.Warn("failed to update Slack message", "channel", interaction.Channel.ID, "error", err)
+	}
+}
+
+// Wait blocks until the requests being handled are answered
+func (b *slackBot) Wait() {
+	b.wg.Wait()
+}
+
+// slackSession returns the session of a Slack thread
+func slackSession(channel, thread string) string {
+	return "slack-" + channel + "-" + strings.ReplaceAll(thread, ".", "_")
+}
+
+// slackResult formats the outcome of a run as the reply to its request
+func slackResult(run *serverRun, activities string) string {
+	if run == nil {
+		return ":x: The run was lost"
+	}
+	if run.Status != string(jobs.StatusCompleted) {
+		return fmt.Sprintf("%s:x: Run %s %s: %s", activities, run.ID, run.Status, run.Error)
+	}
+
+	result := strings.TrimSpace(run.Result)
+	if len(result) > slackMaxResult {
+		result = truncate.Tail(result, slackMaxResult) + fmt.Sprintf("\n... (cut, see run %s)", run.ID)
+	}
+	// A code block must not end early at backticks of the result
+	result = strings.ReplaceAll(result, "```", "` ` `")
+	return fmt.Sprintf("%s```\n%s\n```", activities, result)
+}
+
+// runSlackCommand implements the "slack" subcommand: it serves the request URLs of a
+// Slack app until the process is interrupted
+func runSlackCommand(args []string, llm nodes.LLM, opts runOptions) error {
+	fs := flag.NewFlagSet("slack", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:3000", "Address to listen on for the Events API and interactivity requests")
+	requireApproval := fs.Bool("require-approval", true, "Ask the requesting user to approve every command with buttons")
+	concurrency := fs.Int("concurrency", 1, "Number of workers executing runs at the same time")
+	approvalTimeout := fs.Duration("approval-timeout", defaultApprovalTimeout, "Time a command waits for its approval before it is rejected")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.Offline {
+		return fmt.Errorf("the Slack app needs the network and cannot run with --offline")
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	token := os.Getenv("SLACK_BOT_TOKEN")
+	secret := os.Getenv("SLACK_SIGNING_SECRET")
+	if token == "" || secret == "" {
+		return fmt.Errorf("SLACK_BOT_TOKEN and SLACK_SIGNING_SECRET must be set")
+	}
+
+	store, err := openStorage(opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	queue, err := jobs.Open(store, defaultQueueSize)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	runs := newRunServer(llm, opts, queue)
+	runs.approvalTimeout = *approvalTimeout
+	runs.Start(*concurrency)
+	bot := newSlackBot(runs, slack.NewClient(token), secret)
+	bot.requireApproval = *requireApproval
+	server := &http.Server{Handler: bot.Handler(), ReadHeaderTimeout: 5 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		runs.Stop()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("serving Slack app", "addr", listener.Addr().String())
+	fmt.Printf("Serving the Slack app on http://%s/slack/events and /slack/interactions\n", listener.Addr())
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	runs.Shutdown()
+	bot.Wait()
+	return nil
+}
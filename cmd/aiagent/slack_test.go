@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/slack"
+)
+
+// fakeSlack records the messages posted to the Web API
+type fakeSlack struct {
+	mu       sync.Mutex
+	messages []slack.Message
+	updates  []slack.Message
+}
+
+func (f *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var message slack.Message
+	json.NewDecoder(r.Body).Decode(&message)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if strings.HasSuffix(r.URL.Path, "chat.update") {
+		f.updates = append(f.updates, message)
+	} else {
+		f.messages = append(f.messages, message)
+	}
+	fmt.Fprintf(w, `{"ok": true, "ts": "1700000000.%06d"}`, len(f.messages))
+}
+
+func (f *fakeSlack) posted() []slack.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slack.Message(nil), f.messages...)
+}
+
+func newTestSlackBot(t *testing.T, run func(input string, opts runOptions) (string, error)) (*slackBot, *httptest.Server, *fakeSlack) {
+	runs, _ := newTestRunServer(t, run)
+	api := &fakeSlack{}
+	apiServer := httptest.NewServer(api)
+	t.Cleanup(apiServer.Close)
+
+	client := slack.NewClient("xoxb-token")
+	client.BaseURL = apiServer.URL
+	bot := newSlackBot(runs, client, "secret")
+	server := httptest.NewServer(bot.Handler())
+	t.Cleanup(server.Close)
+	return bot, server, api
+}
+
+func postSlack(t *testing.T, server *httptest.Server, path, contentType, body string) *http.Response {
+	t.Helper()
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func postEvent(t *testing.T, server *httptest.Server, eventID, event string) *http.Response {
+	t.Helper()
+	return postSlack(t, server, "/slack/events", "application/json",
+		fmt.Sprintf(`{"type": "event_callback", "event_id": %q, "event": %s}`, eventID, event))
+}
+
+func clickButton(t *testing.T, server *httptest.Server, user, actionID, value string) {
+	t.Helper()
+	payload := fmt.Sprintf(`{"type": "block_actions", "user": {"id": %q}, "channel": {"id": "C1"},
+		"message": {"ts": "1700000000.000002", "thread_ts": "1.1"}, "actions": [{"action_id": %q, "value": %q}]}`, user, actionID, value)
+	resp := postSlack(t, server, "/slack/interactions", "application/x-www-form-urlencoded", "payload="+url.QueryEscape(payload))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestSlack_URLVerification(t *testing.T) {
+	_, server, _ := newTestSlackBot(t, nil)
+
+	body := `{"type": "url_verification", "challenge": "abc"}`
+	resp := postSlack(t, server, "/slack/events", "application/json", body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/slack/events", strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "unsigned requests are rejected")
+}
+
+func TestSlack_Mention(t *testing.T) {
+	var inputs []string
+	bot, server, api := newTestSlackBot(t, func(input string, opts runOptions) (string, error) {
+		inputs = append(inputs, input)
+		return "file1\nfile2", nil
+	})
+
+	event := `{"type": "app_mention", "user": "U1", "text": "<@UBOT> list files &amp; dirs", "channel": "C1", "ts": "1.1"}`
+	assert.Equal(t, http.StatusOK, postEvent(t, server, "Ev1", event).StatusCode)
+	assert.Equal(t, http.StatusOK, postEvent(t, server, "Ev1", event).StatusCode, "retries are acknowledged")
+	bot.Wait()
+
+	// Messages of bots are ignored, so the bot does not answer itself
+	postEvent(t, server, "Ev2", `{"type": "message", "channel_type": "im", "bot_id": "B1", "text": "hi", "channel": "D1", "ts": "1.2"}`)
+	bot.Wait()
+
+	assert.Equal(t, []string{"list files & dirs"}, inputs)
+	messages := api.posted()
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "C1", messages[0].Channel)
+		assert.Equal(t, "1.1", messages[0].ThreadTS)
+		assert.Equal(t, "```\nfile1\nfile2\n```", messages[0].Text)
+	}
+}
+
+func TestSlack_Approvals(t *testing.T) {
+	bot, server, api := newTestSlackBot(t, func(input string, opts runOptions) (string, error) {
+		publisher := opts.Events.ForRun(opts.RunID)
+		publisher.Publish(&events.ApprovalPending{ID: "1", Command: "ls"})
+		approved, err := opts.Approver("1", "ls")
+		if err != nil {
+			return "", err
+		}
+		publisher.Publish(&events.CommandRejected{Command: "ls", Reason: "rejected by the user"})
+		return fmt.Sprintf("approved: %v", approved), nil
+	})
+
+	postEvent(t, server, "Ev1", `{"type": "message", "channel_type": "im", "user": "U1", "text": "list files", "channel": "C1", "ts": "1.1"}`)
+
+	var prompt slack.Message
+	assert.Eventually(t, func() bool {
+		messages := api.posted()
+		if len(messages) == 0 {
+			return false
+		}
+		prompt = messages[0]
+		return true
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "<@U1>, may I run `ls`?", prompt.Text)
+	assert.Len(t, prompt.Blocks, 2)
+
+	var runID string
+	bot.mu.Lock()
+	for id := range bot.requesters {
+		runID = id
+	}
+	bot.mu.Unlock()
+	value := runID + "/1"
+
+	// Only the user who sent the request may answer
+	clickButton(t, server, "U2", slackActionApprove, value)
+	assert.Eventually(t, func() bool { return len(api.posted()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "<@U2>, only <@U1> can answer this approval.", api.posted()[1].Text)
+
+	clickButton(t, server, "U1", slackActionReject, value)
+	bot.Wait()
+
+	messages := api.posted()
+	assert.Len(t, messages, 3)
+	assert.Equal(t, "> rejected `ls`: rejected by the user\n```\napproved: false\n```", messages[2].Text)
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	assert.Equal(t, []slack.Message{{
+		Channel: "C1",
+		TS:      "1700000000.000002",
+		Text:    ":no_entry: <@U1> rejected `ls`",
+		Blocks:  []slack.Block{{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": ":no_entry: <@U1> rejected `ls`"}}},
+	}}, api.updates)
+}
+
+func TestSlackResult(t *testing.T) {
+	assert.Equal(t, "```\nok\n```", slackResult(&serverRun{ID: "r1", Status: "completed", Result: "ok\n"}, ""))
+	assert.Equal(t, "> ran `ls`\n```\na` ` `b\n```", slackResult(&serverRun{ID: "r1", Status: "completed", Result: "a```b"}, "> ran `ls`\n"))
+	assert.Equal(t, ":x: Run r1 failed: boom", slackResult(&serverRun{ID: "r1", Status: "failed", Error: "boom"}, ""))
+
+	long := slackResult(&serverRun{ID: "r1", Status: "completed", Result: strings.Repeat("x", slackMaxResult+10)}, "")
+	assert.Contains(t, long, "(cut, see run r1)")
+	assert.Less(t, len(long), slackMaxResult+50)
+	long = slackResult(&serverRun{ID: "r1", Status: "completed", Result: "x" + strings.Repeat("é", slackMaxResult)}, "")
+	assert.True(t, utf8.ValidString(long), "a character is not cut in half")
+
+	assert.Equal(t, "slack-C1-1700000000_000100", slackSession("C1", "1700000000.000100"))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"aiagent/pkg/snapshot"
+)
+
+// snapshotRun returns the snapshot store of the current directory and resolves runID;
+// "last" selects the most recent run with a snapshot
+func snapshotRun(runID string) (*snapshot.Store, string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get working directory: %v", err)
+	}
+	store := snapshot.New(dir)
+	if runID == "last" {
+		runs, err := store.Runs()
+		if err != nil {
+			return nil, "", err
+		}
+		if len(runs) == 0 {
+			return nil, "", fmt.Errorf("no run wrote files in this directory yet")
+		}
+		runID = runs[len(runs)-1]
+	}
+	return store, runID, nil
+}
+
+// runVerifyCommand checks that the files written by a run still have the content the run
+// left behind
+func runVerifyCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: aiagent verify <run-id>|last")
+	}
+	store, runID, err := snapshotRun(args[0])
+	if err != nil {
+		return err
+	}
+	mismatches, err := store.Verify(runID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", runID, err)
+	}
+	for _, m := range mismatches {
+		state := "modified"
+		if m.Actual == "" {
+			state = "missing"
+		}
+		fmt.Printf("%-9s %s\n", state, m.Path)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d file(s) changed since run %s", len(mismatches), runID)
+	}
+	fmt.Printf("The working tree matches run %s\n", runID)
+	return nil
+}
+
+// runRollbackCommand restores the files written by a run to their contents before the run
+func runRollbackCommand(args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	force := fs.Bool("force", false, "Roll back even if the files changed since the run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: aiagent rollback [--force] <run-id>|last")
+	}
+	store, runID, err := snapshotRun(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	files, err := store.Restore(runID, *force)
+	if err != nil {
+		return fmt.Errorf("%s: %w", runID, err)
+	}
+	for _, file := range files {
+		if file.Before == "" {
+			fmt.Printf("removed   %s\n", file.Path)
+		} else {
+			fmt.Printf("restored  %s\n", file.Path)
+		}
+	}
+	return nil
+}
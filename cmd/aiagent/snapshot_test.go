@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/snapshot"
+)
+
+func TestVerifyAndRollbackCommands(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile("main.go", []byte("original"), 0644))
+	require.NoError(t, snapshot.New(dir).Record("20260101-120000-a1b2c3", "main.go", []byte("fixed"), func() error {
+		return os.WriteFile("main.go", []byte("fixed"), 0644)
+	}))
+
+	assert.NoError(t, runVerifyCommand([]string{"last"}))
+
+	require.NoError(t, os.WriteFile("main.go", []byte("edited"), 0644))
+	assert.ErrorContains(t, runVerifyCommand([]string{"20260101-120000-a1b2c3"}), "1 file(s) changed since run 20260101-120000-a1b2c3")
+	assert.ErrorContains(t, runRollbackCommand([]string{"last"}), "files changed since the run: main.go")
+
+	require.NoError(t, runRollbackCommand([]string{"--force", "last"}))
+	data, err := os.ReadFile(filepath.Join(dir, "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/stats"
+)
+
+// runStatsCommand implements the "stats" subcommand: it prints the statistics of the working
+// directory, optionally followed by an executive summary of the LLM; newLLM is only called
+// for the summary, so the statistics need no API key
+func runStatsCommand(args []string, opts runOptions, newLLM func() (nodes.LLM, error), stdout io.Writer) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	format := fs.String("format", "markdown", "Report format: markdown or json")
+	summary := fs.Bool("summary", false, "Add an executive summary written by the LLM")
+	largest := fs.Int("largest", stats.DefaultLargest, "Number of the largest files listed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected markdown or json", *format)
+	}
+	if *largest < 0 {
+		return fmt.Errorf("--largest must not be negative")
+	}
+
+	dir, err := workingDir(opts)
+	if err != nil {
+		return err
+	}
+	report, err := stats.Collect(dir, *largest)
+	if err != nil {
+		return err
+	}
+	if *summary {
+		llm, err := newLLM()
+		if err != nil {
+			return err
+		}
+		if llm, err = guardFrontend(llm, opts); err != nil {
+			return err
+		}
+		if report.Summary, err = stats.Summarize(llm, opts.Prompts, dir, report); err != nil {
+			return err
+		}
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	_, err = fmt.Fprint(stdout, report.Markdown())
+	return err
+}
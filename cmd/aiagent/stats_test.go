@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/pii"
+)
+
+func TestStatsCommand_SummaryRedactsPersonalData(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "jane@example.com.csv"), []byte("name,team\n"), 0644)
+	llm := nodes.NewScriptedLLM()
+	llm.OnAny().Respond("A small Go project.")
+	cfg := config.Default()
+	cfg.PII.Mode = pii.ModeRedact
+
+	var stdout bytes.Buffer
+	newLLM := func() (nodes.LLM, error) { return llm, nil }
+	assert.NoError(t, runStatsCommand([]string{"--summary"}, runOptions{Dir: dir, Config: cfg}, newLLM, &stdout))
+	assert.Contains(t, stdout.String(), "A small Go project.")
+	assert.Contains(t, llm.Calls()[0], "`[EMAIL]`")
+	assert.NotContains(t, llm.Calls()[0], "jane@example.com")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"aiagent/pkg/audit"
+	"aiagent/pkg/history"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/storage"
+)
+
+const (
+	// sessionScopeDir stores data in the current working directory
+	sessionScopeDir = "dir"
+
+	// sessionScopeUser stores data in the user's home directory
+	sessionScopeUser = "user"
+)
+
+// openStorage opens the storage backend in the data directory selected by the session scope option
+func openStorage(opts runOptions) (storage.Store, error) {
+	var dataDir string
+	switch opts.SessionScope {
+	case sessionScopeDir, "":
+		cwd, err := workingDir(opts)
+		if err != nil {
+			return nil, err
+		}
+		dataDir = history.DataDir(cwd)
+	case sessionScopeUser:
+		dir, err := history.UserDataDir()
+		if err != nil {
+			return nil, err
+		}
+		dataDir = dir
+	default:
+		return nil, fmt.Errorf("invalid session scope %q (expected %q or %q)", opts.SessionScope, sessionScopeDir, sessionScopeUser)
+	}
+
+	return storage.Open(opts.Storage, dataDir)
+}
+
+// openRiskLog opens the audit log the learned risk reads the outcomes of the commands from.
+// It is the log of the user scope whatever the session scope, since the .aiagent directory of a
+// cloned repository could come with a made-up history; the log is nil when learned risk is off
+func openRiskLog(opts runOptions, dataStore storage.Store) (*audit.Log, func(), error) {
+	if opts.Config == nil || opts.Config.LearnedRisk.MinRuns <= 0 {
+		return nil, func() {}, nil
+	}
+	if opts.SessionScope == sessionScopeUser {
+		return audit.NewLog(dataStore), func() {}, nil
+	}
+
+	dataDir, err := history.UserDataDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := storage.Open(opts.Storage, dataDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open the learned risk history: %v", err)
+	}
+	return audit.NewLog(store), func() { store.Close() }, nil
+}
+
+// commandTracks loads the outcomes of the commands in the learned risk log
+func commandTracks(riskLog *audit.Log) map[string]audit.Track {
+	if riskLog == nil {
+		return nil
+	}
+	tracks, err := riskLog.Tracks(time.Time{})
+	if err != nil {
+		slog.Warn("failed to load the command history", "error", err)
+	}
+	return tracks
+}
+
+// symbolCache returns the cache of the symbols extracted by the code analyzer
+// It is kept as files in .aiagent/cache of dir whatever the storage backend, so the runs in
+// the same repository share it
+func symbolCache(dir string) *nodes.SymbolCache {
+	return nodes.NewSymbolCache(storage.NewFileStore(history.DataDir(dir)))
+}
+
+// workingDir returns the working directory of a run
+func workingDir(opts runOptions) (string, error) {
+	if opts.Dir != "" {
+		return opts.Dir, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current working directory: %v", err)
+	}
+	return cwd, nil
+}
+
+// recordCommand adds the command run by the bash node to the audit log, the learned risk log
+// and the command metrics
+func recordCommand(auditLog *audit.Log, state *nodes.State, opts runOptions, output string, err error) error {
+	if state.GetCommand() == "" {
+		return nil // No command was generated
+	}
+
+	entry := audit.Entry{
+		RunID:    state.GetRunID(),
+		Input:    state.GetInput(),
+		Command:  state.GetCommand(),
+		Rating:   string(nodes.RateCommand(state.GetCommand())),
+		Status:   audit.StatusExecuted,
+		Output:   output,
+		User:     opts.User,
+		Reviewer: state.GetCommandReviewer(),
+
+		AutoApproved: opts.ForceApprove,
+	}
+	if err != nil {
+		entry.Status = audit.StatusFailed
+		if errors.Is(err, nodes.ErrPolicyDenied) {
+			entry.Status = audit.StatusRejected
+		}
+		entry.Error = err.Error()
+	}
+
+	runMetrics.commands.Inc(string(entry.Status))
+	if err := auditLog.Record(entry); err != nil {
+		return err
+	}
+	if opts.RiskLog != nil && opts.RiskLog != auditLog {
+		return opts.RiskLog.Record(entry)
+	}
+	return nil
+}
+
+// runAuditCommand implements the "audit" subcommand which queries the command audit log
+func runAuditCommand(args []string, opts runOptions) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	since := fs.String("since", "", "Only show commands run within this age (e.g. 30d, 12h)")
+	rating := fs.String("rating", "", "Only show commands with this safety rating (e.g. DANGEROUS)")
+	status := fs.String("status", "", "Only show commands with this status (executed, failed, rejected)")
+	run := fs.String("run", "", "Only show commands of this run ID")
+	user := fs.String("user", "", "Only show commands of runs started by this server user")
+	limit := fs.Int("limit", 0, "Maximum number of entries to show (most recent)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := audit.Filter{
+		Rating: *rating,
+		Status: audit.Status(*status),
+		RunID:  *run,
+		User:   *user,
+		Limit:  *limit,
+	}
+	if *since != "" {
+		age, err := parseAge(*since)
+		if err != nil {
+			return err
+		}
+		filter.Since = time.Now().Add(-age)
+	}
+
+	store, err := openStorage(opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	entries, err := audit.NewLog(store).Query(filter)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No audit entries found")
+		return nil
+	}
+
+	for _, entry := range entries {
+		rating := entry.Rating
+		if rating == "" {
+			rating = "-"
+		}
+		runID := entry.RunID
+		if runID == "" {
+			runID = "-"
+		}
+		fmt.Printf("%s  %-22s %-9s %-10s %s\n", entry.Time.Format(time.RFC3339), runID, entry.Status, rating, entry.Command)
+		if entry.User != "" {
+			fmt.Printf("    user: %s\n", entry.User)
+		}
+		if entry.Reviewer != "" {
+			fmt.Printf("    reviewer: %s\n", entry.Reviewer)
+		}
+		if entry.Error != "" {
+			fmt.Printf("    error: %s\n", entry.Error)
+		}
+	}
+	return nil
+}
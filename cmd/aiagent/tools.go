@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/mcp"
+	"aiagent/pkg/nodes"
+)
+
+const (
+	// defaultToolTimeout limits a call of an MCP tool if the server has no timeout configured
+	defaultToolTimeout = 60 * time.Second
+
+	// mcpStartTimeout limits the start and handshake of an MCP server
+	mcpStartTimeout = 30 * time.Second
+)
+
+// startMCPTools starts the configured MCP servers and returns their tools, named
+// <server>.<tool>, and a function stopping the servers
+// A server that fails to start is skipped with a warning, so it does not break the agent
+func startMCPTools(servers map[string]config.MCPServerConfig) ([]nodes.Tool, func()) {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tools []nodes.Tool
+	var clients []*mcp.Client
+	for _, name := range names {
+		client, serverTools, err := startMCPServer(servers[name])
+		if err != nil {
+			slog.Warn("skipping MCP server", "server", name, "error", err)
+			continue
+		}
+		clients = append(clients, client)
+		slog.Info("started MCP server", "server", name, "tools", len(serverTools))
+		tools = append(tools, wrapMCPTools(name, client, servers[name].Timeout, serverTools)...)
+	}
+
+	stop := func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}
+	return tools, stop
+}
+
+func startMCPServer(server config.MCPServerConfig) (*mcp.Client, []mcp.Tool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mcpStartTimeout)
+	defer cancel()
+
+	client, err := mcp.StartClient(ctx, server.Command, server.Args, server.Env)
+	if err != nil {
+		return nil, nil, err
+	}
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return client, tools, nil
+}
+
+// wrapMCPTools wraps the tools of an MCP server for the tool node
+func wrapMCPTools(server string, client *mcp.Client, timeout time.Duration, tools []mcp.Tool) []nodes.Tool {
+	if timeout == 0 {
+		timeout = defaultToolTimeout
+	}
+
+	wrapped := make([]nodes.Tool, 0, len(tools))
+	for _, tool := range tools {
+		name := tool.Name
+		wrapped = append(wrapped, nodes.Tool{
+			Name:        server + "." + name,
+			Description: tool.Description,
+			InputSchema: string(tool.InputSchema),
+			Call: func(arguments json.RawMessage) (string, error) {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				result, err := client.CallTool(ctx, name, arguments)
+				if err != nil {
+					return "", err
+				}
+				if result.IsError {
+					return "", fmt.Errorf("%s", result.Text())
+				}
+				return result.Text(), nil
+			},
+		})
+	}
+	return wrapped
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/logging"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/transcript"
+	"aiagent/pkg/tui"
+)
+
+// Minimum size of the terminal for the TUI
+const (
+	tuiMinWidth  = 40
+	tuiMinHeight = 12
+)
+
+// Messages passed to the TUI model besides keys and window sizes
+type (
+	// tuiEventMsg is an event of the running run
+	tuiEventMsg struct{ event events.Event }
+
+	// tuiDoneMsg is sent when a run finished
+	tuiDoneMsg struct {
+		result string
+		err    error
+	}
+
+	// tuiApprovalMsg asks the user to approve a command; the answer is sent to answer
+	tuiApprovalMsg struct {
+		id      string
+		command string
+		answer  chan<- bool
+	}
+
+	// tuiLogMsg is a log line written while the TUI is shown
+	tuiLogMsg string
+)
+
+// tuiModel is the state of the full-screen TUI: the conversation, the output of the
+// commands, the pending approvals and the history of the nodes the runs went through
+type tuiModel struct {
+	width  int
+	height int
+	input  []rune
+
+	conversation []string
+	output       []string
+	approvals    []tuiApprovalMsg
+	tasks        []string
+	scroll       int
+
+	// run runs a request; it is called in its own goroutine
+	run     func(ctx context.Context, input string) (string, error)
+	running bool
+	cancel  context.CancelFunc
+}
+
+func newTUIModel(run func(ctx context.Context, input string) (string, error)) *tuiModel {
+	return &tuiModel{
+		width:  tui.DefaultWidth,
+		height: tui.DefaultHeight,
+		run:    run,
+	}
+}
+
+// Update implements the tui.Model interface
+func (m *tuiModel) Update(msg tui.Msg) (tui.Model, tui.Cmd) {
+	switch msg := msg.(type) {
+	case tui.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tui.KeyMsg:
+		return m, m.key(msg)
+	case tuiEventMsg:
+		m.event(msg.event)
+	case tuiApprovalMsg:
+		m.approvals = append(m.approvals, msg)
+	case tuiDoneMsg:
+		m.running = false
+		m.cancel = nil
+		if msg.err != nil {
+			if message := userMessage(msg.err); message != "" {
+				m.conversation = append(m.conversation, message)
+			}
+			m.conversation = append(m.conversation, fmt.Sprintf("Error: %v", msg.err))
+		} else {
+			m.conversation = append(m.conversation, msg.result)
+		}
+		m.conversation = append(m.conversation, "")
+	case tuiLogMsg:
+		m.output = append(m.output, "log: "+string(msg))
+	}
+	return m, nil
+}
+
+func (m *tuiModel) key(key tui.KeyMsg) tui.Cmd {
+	switch key.Type {
+	case tui.KeyCtrlC:
+		if m.running {
+			m.cancel()
+			m.answerAll(false)
+			m.output = append(m.output, "canceling the run...")
+			return nil
+		}
+		return tui.Quit
+	case tui.KeyCtrlD:
+		if !m.running && len(m.input) == 0 {
+			return tui.Quit
+		}
+	case tui.KeyPgUp:
+		m.scroll += m.conversationHeight() / 2
+	case tui.KeyPgDown:
+		m.scroll = max(m.scroll-m.conversationHeight()/2, 0)
+	}
+
+	// While a command waits for its approval, y and n answer it
+	if len(m.approvals) > 0 {
+		if key.Type == tui.KeyRunes && len(key.Runes) == 1 {
+			switch key.Runes[0] {
+			case 'y', 'Y':
+				m.answer(true)
+			case 'n', 'N':
+				m.answer(false)
+			}
+		}
+		return nil
+	}
+
+	switch key.Type {
+	case tui.KeyRunes:
+		m.input = append(m.input, key.Runes...)
+	case tui.KeyBackspace:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case tui.KeyEsc, tui.KeyCtrlU:
+		m.input = nil
+	case tui.KeyEnter:
+		return m.submit()
+	}
+	return nil
+}
+
+// submit starts a run for the typed request
+func (m *tuiModel) submit() tui.Cmd {
+	line := strings.TrimSpace(string(m.input))
+	if line == "" || m.running {
+		return nil
+	}
+	m.input = nil
+	m.scroll = 0
+	m.conversation = append(m.conversation, "> "+line)
+
+	input, err := validateAndSanitizeInput([]string{line})
+	if err != nil {
+		m.conversation = append(m.conversation, fmt.Sprintf("Error: Invalid input: %v", err), "")
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.running = true
+	m.cancel = cancel
+	return func() tui.Msg {
+		defer cancel()
+		result, err := m.run(ctx, input)
+		return tuiDoneMsg{result: result, err: err}
+	}
+}
+
+// answer answers the oldest pending approval
+func (m *tuiModel) answer(approved bool) {
+	approval := m.approvals[0]
+	m.approvals = m.approvals[1:]
+	approval.answer <- approved
+}
+
+func (m *tuiModel) answerAll(approved bool) {
+	for len(m.approvals) > 0 {
+		m.answer(approved)
+	}
+}
+
+// event adds an event of the running run to the panes
+func (m *tuiModel) event(event events.Event) {
+	switch e := event.(type) {
+	case *events.RunStarted:
+		m.tasks = append(m.tasks, fmt.Sprintf("%s: %s", e.RunID, e.Input))
+	case *events.NodeFinished:
+		if e.Error != "" {
+			m.tasks = append(m.tasks, fmt.Sprintf("  ✗ %s: %s", e.Node, e.Error))
+		} else if e.NextNode != "" {
+			m.tasks = append(m.tasks, fmt.Sprintf("  ✓ %s → %s (%s)", e.Node, e.NextNode, e.Duration.Round(time.Millisecond)))
+		} else {
+			m.tasks = append(m.tasks, fmt.Sprintf("  ✓ %s (%s)", e.Node, e.Duration.Round(time.Millisecond)))
+		}
+	case *events.RunFinished:
+		m.tasks = append(m.tasks, fmt.Sprintf("  finished in %s", e.Duration.Round(time.Millisecond)))
+	case *events.CommandProposed:
+		m.output = append(m.output, "$ "+e.Command)
+	case *events.CommandRejected:
+		m.output = append(m.output, fmt.Sprintf("rejected: %s", e.Reason))
+	case *events.CommandExecuted:
+		if output := strings.TrimRight(e.Output, "\n"); output != "" {
+			m.output = append(m.output, output)
+		}
+		m.output = append(m.output, fmt.Sprintf("exit code %d (%s)", e.ExitCode, e.Duration.Round(time.Millisecond)))
+	}
+}
+
+// Layout of the screen: the panes, then the input line and the help line
+func (m *tuiModel) leftWidth() int          { return m.width * 3 / 5 }
+func (m *tuiModel) paneHeight() int         { return m.height - 2 }
+func (m *tuiModel) conversationHeight() int { return m.paneHeight() * 3 / 5 }
+func (m *tuiModel) approvalsHeight() int    { return max(m.paneHeight()/3, 4) }
+
+// View implements the tui.Model interface
+func (m *tuiModel) View() string {
+	if m.width < tuiMinWidth || m.height < tuiMinHeight {
+		return fmt.Sprintf("The terminal is too small (at least %dx%d)", tuiMinWidth, tuiMinHeight)
+	}
+
+	leftWidth := m.leftWidth()
+	rightWidth := m.width - leftWidth
+	conversationHeight := m.conversationHeight()
+	approvalsHeight := m.approvalsHeight()
+
+	conversation := wrapAll(m.conversation, leftWidth-2)
+	m.scroll = min(m.scroll, max(len(conversation)-(conversationHeight-2), 0))
+	conversationTitle := "Conversation"
+	if m.scroll > 0 {
+		conversationTitle = fmt.Sprintf("Conversation (+%d lines below)", m.scroll)
+	}
+
+	var approvals []string
+	for _, approval := range m.approvals {
+		approvals = append(approvals, tui.Wrap("? "+approval.command, rightWidth-2)...)
+	}
+
+	left := append(
+		tui.Box(conversationTitle, conversation, leftWidth, conversationHeight, m.scroll),
+		tui.Box("Command output", wrapAll(m.output, leftWidth-2), leftWidth, m.paneHeight()-conversationHeight, 0)...)
+	right := append(
+		tui.Box("Pending approvals", approvals, rightWidth, approvalsHeight, 0),
+		tui.Box("Task history", wrapAll(m.tasks, rightWidth-2), rightWidth, m.paneHeight()-approvalsHeight, 0)...)
+
+	lines := tui.JoinHorizontal(left, right)
+	lines = append(lines, m.inputLine(), tui.Fit(m.help(), m.width))
+	return strings.Join(lines, "\n")
+}
+
+func (m *tuiModel) inputLine() string {
+	if len(m.approvals) > 0 {
+		return tui.Fit(fmt.Sprintf("Run %s? [y/n]", m.approvals[0].command), m.width)
+	}
+	if m.running {
+		return tui.Fit("Running...", m.width)
+	}
+	// The end of a long input is shown, where the cursor is
+	input := []rune("> " + string(m.input))
+	if len(input) > m.width-1 {
+		input = input[len(input)-(m.width-1):]
+	}
+	return tui.Fit(string(input)+"█", m.width)
+}
+
+func (m *tuiModel) help() string {
+	if m.running {
+		return "ctrl+c cancel the run · pgup/pgdn scroll"
+	}
+	return "enter run · esc clear · pgup/pgdn scroll · ctrl+c quit"
+}
+
+// wrapAll wraps the entries of a pane, each of which may span several lines
+func wrapAll(entries []string, width int) []string {
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, tui.Wrap(entry, width)...)
+	}
+	return lines
+}
+
+// tuiLogWriter passes the lines logged while the TUI is shown to its output pane, since
+// writing them to the terminal would mess up the screen
+type tuiLogWriter struct {
+	program *tui.Program
+}
+
+func (w tuiLogWriter) Write(p []byte) (int, error) {
+	w.program.Send(tuiLogMsg(strings.TrimRight(string(p), "\n")))
+	return len(p), nil
+}
+
+// minLevel returns the lowest level a logger writes
+func minLevel(logger *slog.Logger) slog.Level {
+	for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn} {
+		if logger.Enabled(context.Background(), level) {
+			return level
+		}
+	}
+	return slog.LevelError
+}
+
+// runTUICommand implements the "tui" subcommand: an interactive conversation like chat,
+// shown full-screen with the output of the commands, their approvals and the task history
+func runTUICommand(args []string, llm nodes.LLM, opts runOptions) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	requireApproval := fs.Bool("require-approval", true, "Ask for the approval of every command")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !tui.IsTerminal(os.Stdin) {
+		return errors.New("the TUI needs a terminal; use chat instead")
+	}
+
+	opts.Continue = true
+	if opts.Events == nil {
+		opts.Events = events.NewBus()
+	}
+
+	var program *tui.Program
+	model := newTUIModel(func(ctx context.Context, input string) (string, error) {
+		runOpts := opts
+		runOpts.Context = ctx
+		runOpts.RunID = transcript.NewRunID()
+		if *requireApproval {
+			runOpts.Approver = func(id, command string) (bool, error) {
+				answer := make(chan bool, 1)
+				program.Send(tuiApprovalMsg{id: id, command: command, answer: answer})
+				select {
+				case approved := <-answer:
+					return approved, nil
+				case <-ctx.Done():
+					return false, ctx.Err()
+				}
+			}
+		}
+		return runLangGraph(input, llm, runOpts)
+	})
+	program = tui.NewProgram(model, os.Stdin, os.Stdout)
+
+	unsubscribe := opts.Events.Subscribe(events.SubscriberFunc(func(event events.Event) {
+		program.Send(tuiEventMsg{event: event})
+	}))
+	defer unsubscribe()
+
+	previous := slog.Default()
+	handler, err := logging.NewHandler(tuiLogWriter{program: program}, logging.FormatText, minLevel(previous))
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+	defer slog.SetDefault(previous)
+
+	_, err = program.Run()
+	return err
+}
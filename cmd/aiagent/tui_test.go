@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/tui"
+)
+
+func typeKeys(m *tuiModel, text string) tui.Cmd {
+	var cmd tui.Cmd
+	for _, key := range tui.ParseKeys([]byte(text)) {
+		_, cmd = m.Update(key)
+	}
+	return cmd
+}
+
+func TestTUI_Run(t *testing.T) {
+	var got string
+	m := newTUIModel(func(ctx context.Context, input string) (string, error) {
+		got = input
+		return "There are 3 files", nil
+	})
+
+	cmd := typeKeys(m, "how many files\r")
+	require.NotNil(t, cmd)
+	assert.True(t, m.running)
+	assert.Empty(t, m.input)
+	assert.Contains(t, m.View(), "Running...")
+
+	m.Update(cmd())
+	assert.Equal(t, "how many files", got)
+	assert.False(t, m.running)
+	assert.Equal(t, []string{"> how many files", "There are 3 files", ""}, m.conversation)
+	assert.Contains(t, m.View(), "There are 3 files")
+
+	// Another request is not started while one is running
+	m.running = true
+	assert.Nil(t, typeKeys(m, "again\r"))
+}
+
+func TestTUI_InvalidInput(t *testing.T) {
+	m := newTUIModel(func(ctx context.Context, input string) (string, error) {
+		t.Fatal("invalid input must not run")
+		return "", nil
+	})
+	assert.Nil(t, typeKeys(m, "ls; rm -rf /\r"))
+	assert.False(t, m.running)
+	assert.Contains(t, m.conversation[1], "Invalid input")
+}
+
+func TestTUI_Approvals(t *testing.T) {
+	m := newTUIModel(nil)
+	first := make(chan bool, 1)
+	second := make(chan bool, 1)
+	m.Update(tuiApprovalMsg{id: "1", command: "ls -la", answer: first})
+	m.Update(tuiApprovalMsg{id: "2", command: "df -h", answer: second})
+	assert.Contains(t, m.View(), "Run ls -la? [y/n]")
+	assert.Contains(t, m.View(), "? df -h")
+
+	// Other keys do not go to the input while an approval is pending
+	typeKeys(m, "x")
+	assert.Empty(t, m.input)
+
+	typeKeys(m, "y")
+	assert.True(t, <-first)
+	typeKeys(m, "n")
+	assert.False(t, <-second)
+	assert.Empty(t, m.approvals)
+}
+
+func TestTUI_CtrlC(t *testing.T) {
+	started := make(chan struct{})
+	m := newTUIModel(func(ctx context.Context, input string) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	cmd := typeKeys(m, "uptime\r")
+	done := make(chan tui.Msg, 1)
+	go func() { done <- cmd() }()
+	<-started
+
+	answer := make(chan bool, 1)
+	m.Update(tuiApprovalMsg{id: "1", command: "uptime", answer: answer})
+
+	// Ctrl+C cancels the run and rejects its approvals instead of quitting
+	assert.Nil(t, typeKeys(m, "\x03"))
+	assert.False(t, <-answer)
+	select {
+	case msg := <-done:
+		m.Update(msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run was not canceled")
+	}
+	assert.False(t, m.running)
+	assert.Contains(t, strings.Join(m.conversation, "\n"), "context canceled")
+
+	// When idle, Ctrl+C quits
+	cmd = typeKeys(m, "\x03")
+	require.NotNil(t, cmd)
+	assert.Equal(t, tui.QuitMsg{}, cmd())
+}
+
+func TestTUI_Events(t *testing.T) {
+	m := newTUIModel(nil)
+	m.Update(tuiEventMsg{event: &events.RunStarted{Header: events.Header{RunID: "r1"}, Input: "list files"}})
+	m.Update(tuiEventMsg{event: &events.NodeFinished{Node: "classify", NextNode: "bash", Duration: 1500 * time.Millisecond}})
+	m.Update(tuiEventMsg{event: &events.CommandProposed{Command: "ls"}})
+	m.Update(tuiEventMsg{event: &events.CommandExecuted{Command: "ls", Output: "a.go\nb.go\n", ExitCode: 0}})
+	m.Update(tuiEventMsg{event: &events.CommandRejected{Command: "rm x", Reason: "not allowed"}})
+	m.Update(tuiLogMsg("level=WARN msg=slow"))
+
+	assert.Equal(t, []string{"r1: list files", "  ✓ classify → bash (1.5s)"}, m.tasks)
+	assert.Equal(t, []string{"$ ls", "a.go\nb.go", "exit code 0 (0s)", "rejected: not allowed", "log: level=WARN msg=slow"}, m.output)
+
+	view := m.View()
+	assert.Contains(t, view, "b.go")
+	assert.Contains(t, view, "classify → bash")
+}
+
+func TestTUI_View(t *testing.T) {
+	m := newTUIModel(nil)
+	m.Update(tui.WindowSizeMsg{Width: 60, Height: 20})
+	for i := 0; i < 50; i++ {
+		m.conversation = append(m.conversation, strings.Repeat("word ", 30))
+	}
+	typeKeys(m, strings.Repeat("x", 100))
+
+	lines := strings.Split(m.View(), "\n")
+	assert.Len(t, lines, 20)
+	for _, line := range lines {
+		assert.Equal(t, 60, utf8.RuneCountInString(line), line)
+	}
+	assert.True(t, strings.HasSuffix(strings.TrimRight(lines[18], " "), "x█"))
+
+	// Scrolling is limited to the conversation
+	typeKeys(m, "\x1b[5~")
+	assert.Contains(t, m.View(), "lines below")
+	m.scroll = 10000
+	m.View()
+	assert.Less(t, m.scroll, 10000)
+
+	m.Update(tui.WindowSizeMsg{Width: 20, Height: 5})
+	assert.Contains(t, m.View(), "too small")
+}
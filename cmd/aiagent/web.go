@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"aiagent/pkg/auth"
+	"aiagent/pkg/jobs"
+	"aiagent/pkg/nodes"
+)
+
+// webIndex is the single page of the web UI; it talks to the HTTP and WebSocket API
+//
+//go:embed web/index.html
+var webIndex []byte
+
+// webHandler serves the web UI and the API; API requests must carry token, so other
+// websites opened in the browser cannot start runs on the local server
+func webHandler(api http.Handler, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Write(webIndex)
+	})
+	mux.Handle("/v1/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.Equal(auth.Credential(r), token) {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized: invalid token"))
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	return mux
+}
+
+// newWebToken returns a random token for the API of the web UI
+func newWebToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// runWebCommand implements the "web" subcommand: it serves a web UI for the conversation,
+// the output of the commands, their approvals and the history of the runs
+func runWebCommand(args []string, llm nodes.LLM, opts runOptions) error {
+	fs := flag.NewFlagSet("web", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8081", "Address to listen on")
+	concurrency := fs.Int("concurrency", 1, "Number of runs executed at the same time")
+	approvalTimeout := fs.Duration("approval-timeout", defaultApprovalTimeout, "Time a command waits for its approval before it is rejected")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	token, err := newWebToken()
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	queue, err := jobs.Open(store, defaultQueueSize)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	runs := newRunServer(llm, opts, queue)
+	runs.approvalTimeout = *approvalTimeout
+	runs.Start(*concurrency)
+
+	// The token is passed in the fragment of the URL, which browsers do not send to servers
+	slog.Info("serving web UI", "addr", listener.Addr().String())
+	fmt.Printf("Open the web UI at http://%s/#token=%s\n", listener.Addr(), token)
+	return serveRuns(listener, webHandler(runs.Handler(), token), runs)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeb_Handler(t *testing.T) {
+	s, _ := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		return "result of " + input, nil
+	})
+	server := httptest.NewServer(webHandler(s.Handler(), "secret"))
+	defer server.Close()
+
+	// The page itself needs no token
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "frame-ancestors 'none'")
+
+	resp, err = http.Get(server.URL + "/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	request := func(method, path, token string) int {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(`{"input": "list files"}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Without the token other websites cannot start runs
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/v1/runs", ""))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/v1/runs", "guess"))
+	assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "/v1/runs", "secret"))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/v1/runs?access_token=secret", ""))
+}
+
+func TestWeb_Token(t *testing.T) {
+	first, err := newWebToken()
+	assert.NoError(t, err)
+	second, _ := newWebToken()
+	assert.Len(t, first, 32)
+	assert.NotEqual(t, first, second)
+}
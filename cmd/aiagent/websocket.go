@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/websocket"
+)
+
+// Types of the messages exchanged over the WebSocket endpoint; the events of a run are
+// sent with their event type, e.g. node_started
+const (
+	wsTypeRun        = "run"
+	wsTypeApproval   = "approval"
+	wsTypeRunCreated = "run_created"
+	wsTypeRunStatus  = "run_status"
+	wsTypeError      = "error"
+)
+
+// wsRequest is a message sent by a WebSocket client: a run to start, or the answer to
+// a pending approval
+type wsRequest struct {
+	Type string `json:"type"`
+	runRequest
+
+	RunID      string `json:"run_id,omitempty"`
+	ApprovalID string `json:"approval_id,omitempty"`
+	Approved   *bool  `json:"approved,omitempty"`
+}
+
+// wsMessage is a message sent to a WebSocket client
+type wsMessage struct {
+	Type  string       `json:"type"`
+	Run   *serverRun   `json:"run,omitempty"`
+	Event events.Event `json:"event,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// handleWebSocket serves an interactive client: it starts the runs the client asks for,
+// streams their events and final status, and passes on the answers to approvals
+func (s *runServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		slog.Debug("websocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+	user := requestUser(r)
+
+	var streams sync.WaitGroup
+	defer streams.Wait()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The blocking read is ended by closing the connection
+	go func() {
+		select {
+		case <-s.stopping:
+			conn.Close()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, websocket.ErrClosed) {
+				slog.Debug("websocket read failed", "error", err)
+			}
+			return
+		}
+
+		var req wsRequest
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			conn.WriteJSON(wsMessage{Type: wsTypeError, Error: fmt.Sprintf("invalid message: %v", err)})
+			continue
+		}
+
+		switch req.Type {
+		case wsTypeRun:
+			req.runRequest.user = user
+			run, err := s.submit(req.runRequest)
+			if err != nil {
+				conn.WriteJSON(wsMessage{Type: wsTypeError, Error: err.Error()})
+				continue
+			}
+			conn.WriteJSON(wsMessage{Type: wsTypeRunCreated, Run: run})
+
+			streams.Add(1)
+			go func() {
+				defer streams.Done()
+				s.streamRun(ctx, conn, run.ID)
+			}()
+		case wsTypeApproval:
+			if req.Approved == nil {
+				conn.WriteJSON(wsMessage{Type: wsTypeError, Error: "approved is required"})
+				continue
+			}
+			if err := s.answer(user, req.RunID, req.ApprovalID, *req.Approved); err != nil {
+				conn.WriteJSON(wsMessage{Type: wsTypeError, Error: err.Error()})
+			}
+		default:
+			conn.WriteJSON(wsMessage{Type: wsTypeError, Error: fmt.Sprintf("unknown message type: %q", req.Type)})
+		}
+	}
+}
+
+// streamRun sends the events of a run and, once it finished, its final status
+func (s *runServer) streamRun(ctx context.Context, conn *websocket.Conn, id string) {
+	s.follow(ctx, id, func(batch []events.Event) {
+		for _, event := range batch {
+			conn.WriteJSON(wsMessage{Type: string(event.Type()), Event: event})
+		}
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if run := s.snapshot(id); run != nil && run.FinishedAt != nil {
+		conn.WriteJSON(wsMessage{Type: wsTypeRunStatus, Run: run})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/websocket"
+)
+
+// wsReceived is a message received by a test client; events are kept undecoded
+type wsReceived struct {
+	Type  string          `json:"type"`
+	Run   *serverRun      `json:"run"`
+	Event json.RawMessage `json:"event"`
+	Error string          `json:"error"`
+}
+
+func dialRunServer(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, err := websocket.Dial("ws" + strings.TrimPrefix(url, "http") + "/v1/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func receive(t *testing.T, conn *websocket.Conn) wsReceived {
+	t.Helper()
+	var message wsReceived
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestWebSocket_RunWithApproval(t *testing.T) {
+	_, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		publisher := opts.Events.ForRun(opts.RunID)
+		publisher.Publish(&events.NodeStarted{Node: "bash"})
+		publisher.Publish(&events.ApprovalPending{ID: "1", Command: "ls"})
+		approved, err := opts.Approver("1", "ls")
+		if err != nil {
+			return "", err
+		}
+		publisher.Publish(&events.ApprovalAnswered{ID: "1", Command: "ls", Approved: approved})
+		return "listed", nil
+	})
+	conn := dialRunServer(t, server.URL)
+
+	assert.NoError(t, conn.WriteJSON(map[string]any{"type": "run", "input": "list files", "require_approval": true}))
+	created := receive(t, conn)
+	assert.Equal(t, "run_created", created.Type)
+	if !assert.NotNil(t, created.Run) {
+		return
+	}
+	runID := created.Run.ID
+
+	assert.Equal(t, "node_started", receive(t, conn).Type)
+	pending := receive(t, conn)
+	assert.Equal(t, "approval_pending", pending.Type)
+	assert.Contains(t, string(pending.Event), `"command":"ls"`)
+
+	// Wait until the run blocks on the approval
+	assert.Eventually(t, func() bool {
+		_, run := getRun(t, server, runID)
+		return len(run.PendingApprovals) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.NoError(t, conn.WriteJSON(map[string]any{"type": "approval", "run_id": runID, "approval_id": "1", "approved": true}))
+
+	answered := receive(t, conn)
+	assert.Equal(t, "approval_answered", answered.Type)
+	assert.Contains(t, string(answered.Event), `"approved":true`)
+
+	status := receive(t, conn)
+	assert.Equal(t, "run_status", status.Type)
+	if assert.NotNil(t, status.Run) {
+		assert.Equal(t, "completed", status.Run.Status)
+		assert.Equal(t, "listed", status.Run.Result)
+	}
+}
+
+func TestWebSocket_BadMessages(t *testing.T) {
+	_, server := newTestRunServer(t, func(input string, opts runOptions) (string, error) {
+		t.Error("no run expected")
+		return "", nil
+	})
+	conn := dialRunServer(t, server.URL)
+
+	tests := []struct {
+		name    string
+		message string
+		error   string
+	}{
+		{"malformed", `{"type": `, "invalid message"},
+		{"unknown field", `{"type": "run", "input": "ls", "force_approve": true}`, "invalid message"},
+		{"unknown type", `{"type": "cancel"}`, "unknown message type"},
+		{"empty input", `{"type": "run", "input": ""}`, "input is required"},
+		{"approval without answer", `{"type": "approval", "run_id": "r", "approval_id": "1"}`, "approved is required"},
+		{"unknown approval", `{"type": "approval", "run_id": "r", "approval_id": "1", "approved": true}`, "no pending approval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, conn.WriteMessage([]byte(tt.message)))
+			got := receive(t, conn)
+			assert.Equal(t, "error", got.Type)
+			assert.Contains(t, got.Error, tt.error)
+		})
+	}
+}
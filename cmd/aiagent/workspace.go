@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"aiagent/pkg/config"
+	"aiagent/pkg/keychain"
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/plugins"
+)
+
+// defaultAPIKeyEnv maps each provider to the environment variable holding its API key
+var defaultAPIKeyEnv = map[string]string{
+	"":                   "OPENAI_API_KEY",
+	nodes.ProviderOpenAI: "OPENAI_API_KEY",
+	nodes.ProviderAzure:  "AZURE_OPENAI_API_KEY",
+}
+
+// applyWorkspace switches to the directory of the named workspace and returns its settings
+func applyWorkspace(cfg *config.Config, name string) (config.WorkspaceConfig, nodes.CommandPolicy, error) {
+	workspace, err := cfg.Workspace(name)
+	if err != nil {
+		return config.WorkspaceConfig{}, "", err
+	}
+
+	policy, err := nodes.ParseCommandPolicy(workspace.Policy)
+	if err != nil {
+		return config.WorkspaceConfig{}, "", fmt.Errorf("workspace %s: %v", name, err)
+	}
+
+	if err := os.Chdir(workspace.Directory); err != nil {
+		return config.WorkspaceConfig{}, "", fmt.Errorf("workspace %s: failed to change directory: %v", name, err)
+	}
+
+	return workspace, policy, nil
+}
+
+// newLLM creates the LLM described by the model configuration, connecting as configured
+// An empty model configuration selects the default OpenAI model, and a provider named after
+// a provider plugin answers with the plugin
+func newLLM(model config.ModelConfig, httpConfig config.HTTPConfig, found []plugins.Plugin) (nodes.LLM, error) {
+	if plugin, ok := providerPlugin(found, model.Provider); ok {
+		return plugins.NewLLM(plugin, model.Name), nil
+	}
+
+	client, err := newHTTPClient(httpConfig)
+	if err != nil {
+		return nil, err
+	}
+	if model == (config.ModelConfig{}) {
+		llm := nodes.NewDefaultLLM()
+		llm.Client = client
+		llm.Timeout = httpConfig.Timeout
+		return llm, nil
+	}
+
+	keyEnv := model.APIKeyEnv
+	if keyEnv == "" {
+		keyEnv = defaultAPIKeyEnv[model.Provider]
+	}
+	var apiKey string
+	if keyEnv != "" {
+		apiKey = os.Getenv(keyEnv)
+	}
+	if model.APIKeyKeychain != "" {
+		key, err := keychain.Lookup(model.APIKeyKeychain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the API key: %v", err)
+		}
+		apiKey, keyEnv = key, ""
+	}
+
+	llm, err := nodes.NewProviderLLM(model.Provider, model.Name, model.URL, apiKey)
+	if err != nil {
+		if keyEnv != "" && apiKey == "" {
+			return nil, fmt.Errorf("%v (is %s set?)", err, keyEnv)
+		}
+		return nil, err
+	}
+	llm.Client = client
+	llm.Timeout = httpConfig.Timeout
+	return llm, nil
+}
+
+// newHTTPClient creates the HTTP client of the LLM providers
+// Without settings it returns nil, so the LLM uses the client shared by all LLMs
+func newHTTPClient(cfg config.HTTPConfig) (*http.Client, error) {
+	if cfg.ConnectTimeout == 0 && cfg.Proxy == "" && cfg.CACertFile == "" && !cfg.Offline {
+		return nil, nil
+	}
+	caCertFile, err := config.ExpandHome(cfg.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+	client, err := nodes.NewHTTPClient(nodes.HTTPClientOptions{
+		ConnectTimeout: cfg.ConnectTimeout,
+		Proxy:          cfg.Proxy,
+		CACertFile:     caCertFile,
+		LoopbackOnly:   cfg.Offline,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("http: %v", err)
+	}
+	return client, nil
+}
+
+// runWorkspacesCommand lists the workspaces defined in the config file
+func runWorkspacesCommand(args []string, opts runOptions) error {
+	if len(args) > 0 && args[0] != "list" {
+		return fmt.Errorf("unknown workspaces command: %s (expected list)", args[0])
+	}
+
+	names := opts.Config.WorkspaceNames()
+	if len(names) == 0 {
+		fmt.Println("No workspaces configured")
+		return nil
+	}
+
+	for _, name := range names {
+		workspace := opts.Config.Workspaces[name]
+		policy := workspace.Policy
+		if policy == "" {
+			policy = string(nodes.PolicyStrict)
+		}
+		provider := workspace.Model.Provider
+		if provider == "" {
+			provider = nodes.ProviderOpenAI
+		}
+		model := provider
+		if workspace.Model.Name != "" {
+			model += "/" + workspace.Model.Name
+		}
+		fmt.Printf("%-16s %-40s policy=%-8s model=%s\n", name, workspace.Directory, policy, model)
+	}
+	return nil
+}
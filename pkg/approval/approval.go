@@ -0,0 +1,260 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"aiagent/pkg/slack"
+	"aiagent/pkg/webhook"
+)
+
+const (
+	// DefaultTimeout is how long a request waits for a decision before it is denied
+	DefaultTimeout = 10 * time.Minute
+
+	// defaultPollInterval is how often a pending decision is checked
+	defaultPollInterval = 5 * time.Second
+
+	// Reactions approving or rejecting a request posted to Slack
+	approveReaction = "white_check_mark"
+	rejectReaction  = "x"
+)
+
+// ErrTimeout is returned when no decision arrived in time
+var ErrTimeout = errors.New("no decision within the approval timeout")
+
+// Request asks another person to approve a command
+type Request struct {
+	ID          string `json:"id"`
+	RunID       string `json:"run_id,omitempty"`
+	Command     string `json:"command"`
+	Rating      string `json:"rating"`
+	RequestedBy string `json:"requested_by"`
+	Directory   string `json:"directory,omitempty"`
+
+	// RequesterSlackID is the Slack user ID of the requester, whose reactions do not count
+	RequesterSlackID string `json:"requester_slack_id,omitempty"`
+}
+
+// Decision is the answer to a Request
+type Decision struct {
+	Approved bool   `json:"approved"`
+	Approver string `json:"approver"`
+}
+
+// Channel delivers requests to the people who may approve them and waits for a decision
+type Channel interface {
+	// Ask blocks until the request was decided or ctx is done
+	Ask(ctx context.Context, request Request) (Decision, error)
+}
+
+// Approvers checks who may decide a request
+type Approvers struct {
+	// Names, if set, are the only people whose decisions count
+	Names []string
+}
+
+// Check returns an error unless the decision was made by another person than the requester
+// who may approve commands
+func (a Approvers) Check(request Request, decision Decision) error {
+	switch {
+	case decision.Approver == "":
+		return fmt.Errorf("the decision does not name the approver")
+	case strings.EqualFold(decision.Approver, request.RequestedBy), decision.Approver == request.RequesterSlackID:
+		return fmt.Errorf("%s cannot decide their own request", decision.Approver)
+	case len(a.Names) > 0 && !slices.Contains(a.Names, decision.Approver):
+		return fmt.Errorf("%s is not one of the approvers", decision.Approver)
+	}
+	return nil
+}
+
+// Webhook posts requests to a URL; the receiver answers with the Decision, or with
+// 202 Accepted and a Location header naming where the decision can be fetched once it was made
+type Webhook struct {
+	URL    string
+	Secret string
+
+	// PollInterval is how often a pending decision is fetched (default: 5s)
+	PollInterval time.Duration
+
+	client *http.Client
+}
+
+// NewWebhook creates a new instance of Webhook; the requests are signed when secret is not empty
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{URL: url, Secret: secret, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Ask implements the Channel interface
+func (w *Webhook) Ask(ctx context.Context, request Request) (Decision, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to encode approval request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to create approval request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(w.Secret, body))
+	}
+
+	decision, location, err := w.send(req)
+	if err != nil || location == "" {
+		return decision, err
+	}
+	status, err := url.Parse(w.URL)
+	if err == nil {
+		status, err = status.Parse(location)
+	}
+	if err != nil {
+		return Decision{}, fmt.Errorf("invalid approval location %q: %v", location, err)
+	}
+
+	// The decision is fetched until a person made it
+	return poll(ctx, w.PollInterval, func() (*Decision, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, status.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create approval status request: %v", err)
+		}
+		decision, pending, err := w.send(req)
+		if err != nil || pending != "" {
+			return nil, err
+		}
+		return &decision, nil
+	})
+}
+
+// send sends a request and returns the decision, or the location of a pending decision
+func (w *Webhook) send(req *http.Request) (Decision, string, error) {
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return Decision{}, "", fmt.Errorf("failed to send approval request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var decision Decision
+		if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+			return Decision{}, "", fmt.Errorf("failed to decode decision: %v", err)
+		}
+		return decision, "", nil
+	case http.StatusAccepted:
+		location := resp.Header.Get("Location")
+		if location == "" {
+			location = req.URL.String()
+		}
+		return Decision{}, location, nil
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Decision{}, "", fmt.Errorf("approval webhook returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+}
+
+// Slack posts requests to a Slack channel; the approvers decide by reacting with
+// :white_check_mark: or :x:
+type Slack struct {
+	Client  *slack.Client
+	Channel string
+
+	// Approvers are the Slack user IDs whose reactions count
+	Approvers []string
+
+	// PollInterval is how often the reactions are checked (default: 5s)
+	PollInterval time.Duration
+}
+
+// Ask implements the Channel interface
+// Slack user IDs are not the names of the requesters, so the request must name the Slack user
+// ID of the requester; otherwise a requester among the approvers could approve their own command
+func (s *Slack) Ask(ctx context.Context, request Request) (Decision, error) {
+	if request.RequesterSlackID == "" {
+		return Decision{}, fmt.Errorf("the Slack user ID of %s is unknown, so their own reactions cannot be told apart", request.RequestedBy)
+	}
+	text := fmt.Sprintf("*Approval needed* for a %s command of %s", request.Rating, request.RequestedBy)
+	if request.RunID != "" {
+		text += fmt.Sprintf(" (run %s)", request.RunID)
+	}
+	text += fmt.Sprintf(":\n```%s```\nReact with :%s: to approve or :%s: to reject.", request.Command, approveReaction, rejectReaction)
+	ts, err := s.Client.PostMessage(ctx, slack.Message{Channel: s.Channel, Text: text})
+	if err != nil {
+		return Decision{}, err
+	}
+
+	decision, err := poll(ctx, s.PollInterval, func() (*Decision, error) {
+		reactions, err := s.Client.Reactions(ctx, s.Channel, ts)
+		if err != nil {
+			return nil, err
+		}
+		for _, reaction := range reactions {
+			if reaction.Name != approveReaction && reaction.Name != rejectReaction {
+				continue
+			}
+			for _, user := range reaction.Users {
+				if user != request.RequesterSlackID && slices.Contains(s.Approvers, user) {
+					return &Decision{Approved: reaction.Name == approveReaction, Approver: user}, nil
+				}
+			}
+		}
+		return nil, nil
+	})
+
+	// The message tells the channel that the request is closed
+	outcome := "timed out"
+	switch {
+	case err == nil && decision.Approved:
+		outcome = fmt.Sprintf("approved by <@%s>", decision.Approver)
+	case err == nil:
+		outcome = fmt.Sprintf("rejected by <@%s>", decision.Approver)
+	case !errors.Is(err, ErrTimeout):
+		outcome = "failed"
+	}
+	update := slack.Message{Channel: s.Channel, TS: ts, Text: fmt.Sprintf("%s command of %s %s:\n```%s```", request.Rating, request.RequestedBy, outcome, request.Command)}
+	s.Client.UpdateMessage(context.WithoutCancel(ctx), update)
+	return decision, err
+}
+
+// poll calls check every interval until it returns a decision or an error, or ctx is done
+func poll(ctx context.Context, interval time.Duration, check func() (*Decision, error)) (Decision, error) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		decision, err := check()
+		if err != nil {
+			if ctx.Err() != nil {
+				return Decision{}, contextError(ctx)
+			}
+			return Decision{}, err
+		}
+		if decision != nil {
+			return *decision, nil
+		}
+		select {
+		case <-ctx.Done():
+			return Decision{}, contextError(ctx)
+		case <-ticker.C:
+		}
+	}
+}
+
+// contextError returns ErrTimeout when the deadline of ctx passed
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return ctx.Err()
+}
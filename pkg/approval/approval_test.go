@@ -0,0 +1,145 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/slack"
+	"aiagent/pkg/webhook"
+)
+
+var request = Request{ID: "run-1-1", RunID: "run-1", Command: "rm build.log", Rating: "DANGEROUS", RequestedBy: "alice", RequesterSlackID: "UALICE"}
+
+func TestWebhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got Request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		assert.Equal(t, request, got)
+		body, _ := json.Marshal(got)
+		assert.Equal(t, webhook.Sign("secret", body), r.Header.Get(webhook.SignatureHeader))
+		fmt.Fprint(w, `{"approved": true, "approver": "bob"}`)
+	}))
+	defer server.Close()
+
+	decision, err := NewWebhook(server.URL, "secret").Ask(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Approved: true, Approver: "bob"}, decision)
+}
+
+func TestWebhook_Pending(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost:
+			w.Header().Set("Location", "/approvals/run-1-1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/approvals/run-1-1" && polls.Add(1) < 3:
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			fmt.Fprint(w, `{"approved": false, "approver": "carol"}`)
+		}
+	}))
+	defer server.Close()
+
+	hook := NewWebhook(server.URL+"/approvals", "")
+	hook.PollInterval = time.Millisecond
+	decision, err := hook.Ask(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Approved: false, Approver: "carol"}, decision)
+	assert.Equal(t, int32(3), polls.Load())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	polls.Store(-1000)
+	_, err = hook.Ask(ctx, request)
+	assert.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestSlack(t *testing.T) {
+	var posted, updated string
+	var checks atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message slack.Message
+		json.NewDecoder(r.Body).Decode(&message)
+		switch r.URL.Path {
+		case "/chat.postMessage":
+			posted = message.Text
+			fmt.Fprint(w, `{"ok": true, "ts": "1.1"}`)
+		case "/chat.update":
+			updated = message.Text
+			fmt.Fprint(w, `{"ok": true}`)
+		case "/reactions.get":
+			assert.Equal(t, "C1", r.URL.Query().Get("channel"))
+			assert.Equal(t, "1.1", r.URL.Query().Get("timestamp"))
+			if checks.Add(1) == 1 {
+				// Only the reactions of approvers count
+				fmt.Fprint(w, `{"ok": true, "message": {"reactions": [{"name": "white_check_mark", "users": ["UALICE"]}]}}`)
+				return
+			}
+			fmt.Fprint(w, `{"ok": true, "message": {"reactions": [{"name": "eyes", "users": ["UBOB"]}, {"name": "white_check_mark", "users": ["UALICE", "UBOB"]}]}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := slack.NewClient("xoxb-token")
+	client.BaseURL = server.URL
+	channel := &Slack{Client: client, Channel: "C1", Approvers: []string{"UBOB"}, PollInterval: time.Millisecond}
+	decision, err := channel.Ask(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Approved: true, Approver: "UBOB"}, decision)
+	assert.Equal(t, int32(2), checks.Load())
+	assert.Contains(t, posted, "*Approval needed* for a DANGEROUS command of alice (run run-1)")
+	assert.Contains(t, updated, "approved by <@UBOB>")
+}
+
+func TestSlack_RequesterReacts(t *testing.T) {
+	var checks atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chat.postMessage":
+			fmt.Fprint(w, `{"ok": true, "ts": "1.1"}`)
+		case "/reactions.get":
+			if checks.Add(1) == 1 {
+				// alice is an approver, but cannot approve her own command
+				fmt.Fprint(w, `{"ok": true, "message": {"reactions": [{"name": "white_check_mark", "users": ["UALICE"]}]}}`)
+				return
+			}
+			fmt.Fprint(w, `{"ok": true, "message": {"reactions": [{"name": "white_check_mark", "users": ["UALICE"]}, {"name": "x", "users": ["UBOB"]}]}}`)
+		default:
+			fmt.Fprint(w, `{"ok": true}`)
+		}
+	}))
+	defer server.Close()
+
+	client := slack.NewClient("xoxb-token")
+	client.BaseURL = server.URL
+	channel := &Slack{Client: client, Channel: "C1", Approvers: []string{"UALICE", "UBOB"}, PollInterval: time.Millisecond}
+	decision, err := channel.Ask(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Approved: false, Approver: "UBOB"}, decision)
+	assert.Equal(t, int32(2), checks.Load())
+
+	// Without the Slack user ID of the requester, nothing is posted
+	unknown := request
+	unknown.RequesterSlackID = ""
+	_, err = channel.Ask(context.Background(), unknown)
+	assert.EqualError(t, err, "the Slack user ID of alice is unknown, so their own reactions cannot be told apart")
+	assert.Equal(t, int32(2), checks.Load())
+}
+
+func TestApprovers_Check(t *testing.T) {
+	assert.NoError(t, Approvers{}.Check(request, Decision{Approver: "bob"}))
+	assert.EqualError(t, Approvers{}.Check(request, Decision{Approved: true, Approver: "Alice"}), "Alice cannot decide their own request")
+	assert.EqualError(t, Approvers{}.Check(request, Decision{Approved: true, Approver: "UALICE"}), "UALICE cannot decide their own request")
+	assert.EqualError(t, Approvers{}.Check(request, Decision{Approved: true}), "the decision does not name the approver")
+	assert.EqualError(t, Approvers{Names: []string{"carol"}}.Check(request, Decision{Approver: "bob"}), "bob is not one of the approvers")
+}
@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"aiagent/pkg/schema"
+	"aiagent/pkg/storage"
+	"aiagent/pkg/truncate"
+)
+
+const (
+	// Collection is the storage collection holding audit entries
+	Collection = "audit"
+
+	// SchemaVersion is the current schema version of persisted audit entries
+	SchemaVersion = 1
+)
+
+// Migrations upgrades audit entries written by older versions of the agent
+// Register a migration here whenever SchemaVersion is increased
+var Migrations = schema.NewMigrator("audit entry", SchemaVersion)
+
+// Status describes what happened to an audited command
+type Status string
+
+const (
+	StatusExecuted Status = "executed"
+	StatusFailed   Status = "failed"
+	StatusRejected Status = "rejected"
+)
+
+// maxOutputLength is the maximum length of command output kept in an audit entry
+const maxOutputLength = 2000
+
+// Entry records a single command proposed or executed by the agent
+type Entry struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            string    `json:"id"`
+	Time          time.Time `json:"time"`
+	RunID         string    `json:"run_id,omitempty"`
+	Input         string    `json:"input"`
+	Command       string    `json:"command"`
+	Rating        string    `json:"rating,omitempty"`
+	Status        Status    `json:"status"`
+	Output        string    `json:"output,omitempty"`
+	Error         string    `json:"error,omitempty"`
+
+	// User is the authenticated user whose run proposed the command in server mode
+	User string `json:"user,omitempty"`
+
+	// Reviewer is the person who approved or rejected a risky command in a team review
+	Reviewer string `json:"reviewer,omitempty"`
+
+	// AutoApproved marks the commands of runs with -y, which ran without any approval
+	AutoApproved bool `json:"auto_approved,omitempty"`
+}
+
+// Filter selects audit entries
+// Zero values mean "no restriction"
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Rating string
+	Status Status
+	RunID  string
+	User   string
+	Limit  int
+}
+
+// Log records and queries audit entries
+type Log struct {
+	store storage.Store
+}
+
+// NewLog creates a new audit log on top of the given storage
+func NewLog(store storage.Store) *Log {
+	return &Log{
+		store: store,
+	}
+}
+
+// Record adds an entry to the audit log
+func (l *Log) Record(entry Entry) error {
+	entry.SchemaVersion = SchemaVersion
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.ID == "" {
+		// Time-ordered keys keep entries sorted even in backends that sort by key
+		entry.ID = entry.Time.UTC().Format("20060102T150405.000000000")
+	}
+	if len(entry.Output) > maxOutputLength {
+		entry.Output = truncate.Tail(entry.Output, maxOutputLength) + "... [truncated]"
+	}
+
+	if err := l.store.Put(Collection, entry.ID, entry); err != nil {
+		return fmt.Errorf("failed to record audit entry: %v", err)
+	}
+	return nil
+}
+
+// Query returns the entries matching the filter, oldest first
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	records, err := l.store.List(Collection, storage.Query{Since: filter.Since, Until: filter.Until})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %v", err)
+	}
+
+	entries := []Entry{}
+	for _, record := range records {
+		var entry Entry
+		if err := Migrations.Decode(record.Value, &entry); err != nil {
+			return nil, fmt.Errorf("failed to load audit entry %s: %v", record.Key, err)
+		}
+		if filter.Rating != "" && !strings.EqualFold(entry.Rating, filter.Rating) {
+			continue
+		}
+		if filter.Status != "" && entry.Status != filter.Status {
+			continue
+		}
+		if filter.RunID != "" && entry.RunID != filter.RunID {
+			continue
+		}
+		if filter.User != "" && entry.User != filter.User {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+
+	return entries, nil
+}
+
+// Track sums up the outcomes of the audited runs of a command
+type Track struct {
+	Executed int
+	Failed   int
+	Rejected int
+}
+
+// Tracks returns the track of every audited command since a time, by command; leading and
+// trailing spaces of the commands are ignored, and so are the auto-approved commands, which
+// say nothing about how safe they are
+func (l *Log) Tracks(since time.Time) (map[string]Track, error) {
+	entries, err := l.Query(Filter{Since: since})
+	if err != nil {
+		return nil, err
+	}
+	tracks := make(map[string]Track)
+	for _, entry := range entries {
+		if entry.AutoApproved {
+			continue
+		}
+		command := strings.TrimSpace(entry.Command)
+		track := tracks[command]
+		switch entry.Status {
+		case StatusExecuted:
+			track.Executed++
+		case StatusFailed:
+			track.Failed++
+		case StatusRejected:
+			track.Rejected++
+		}
+		tracks[command] = track
+	}
+	return tracks, nil
+}
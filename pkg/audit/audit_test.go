@@ -0,0 +1,23 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/storage"
+)
+
+func TestLog_RecordTruncatesOutput(t *testing.T) {
+	log := NewLog(storage.NewFileStore(t.TempDir()))
+	require.NoError(t, log.Record(Entry{Command: "cat notes.txt", Status: StatusExecuted, Output: "x" + strings.Repeat("ü", maxOutputLength)}))
+
+	entries, err := log.Query(Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.True(t, utf8.ValidString(entries[0].Output), "a character is not cut in half")
+	assert.Equal(t, "x"+strings.Repeat("ü", (maxOutputLength-1)/2)+"... [truncated]", entries[0].Output)
+}
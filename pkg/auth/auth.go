@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader is an alternative to the Authorization header for clients sending a plain API key
+const APIKeyHeader = "X-API-Key"
+
+// Credential returns the bearer token or API key of a request, or an empty string
+// Browsers cannot set headers on WebSocket connections, so the access_token query
+// parameter is accepted as well
+func Credential(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// Equal compares a credential with a secret in constant time
+func Equal(credential, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(credential), []byte(secret)) == 1
+}
+
+// RateLimiter allows a fixed number of events per key within a sliding window
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	events map[string][]time.Time
+}
+
+// NewRateLimiter creates a new instance of RateLimiter allowing limit events per window and key
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit
+// A limit of zero or less allows every event
+func (l *RateLimiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	recent := l.events[key][:0]
+	for _, t := range l.events[key] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.events[key] = recent
+		return false
+	}
+	l.events[key] = append(recent, now)
+	return true
+}
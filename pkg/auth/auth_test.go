@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredential(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/runs/1", nil)
+	assert.Equal(t, "", Credential(r))
+
+	r.Header.Set("Authorization", "Bearer token")
+	assert.Equal(t, "token", Credential(r))
+
+	r = httptest.NewRequest("GET", "/v1/runs/1", nil)
+	r.Header.Set(APIKeyHeader, "key")
+	assert.Equal(t, "key", Credential(r))
+
+	r = httptest.NewRequest("GET", "/v1/ws?access_token=query", nil)
+	assert.Equal(t, "query", Credential(r))
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	assert.True(t, limiter.Allow("alice"))
+	assert.True(t, limiter.Allow("alice"))
+	assert.False(t, limiter.Allow("alice"))
+	assert.True(t, limiter.Allow("bob"), "every key has its own limit")
+
+	now = now.Add(time.Minute)
+	assert.True(t, limiter.Allow("alice"), "old events leave the window")
+
+	unlimited := NewRateLimiter(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		assert.True(t, unlimited.Allow("alice"))
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// provider is a fake OpenID Connect provider signing tokens with a single key
+type provider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+}
+
+func newProvider(t *testing.T) *provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &provider{key: key, kid: "key-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": p.server.URL, "jwks_uri": p.server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *provider) sign(t *testing.T, kid string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCVerifier(t *testing.T) {
+	p := newProvider(t)
+	verifier := NewOIDCVerifier(p.server.URL, "aiagent")
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	claims, err := verifier.Verify(context.Background(), p.sign(t, p.kid, map[string]any{
+		"iss": p.server.URL, "aud": []string{"other", "aiagent"}, "exp": exp, "email": "alice@example.com",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice@example.com", claims.String("email"))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", p.sign(t, p.kid, map[string]any{"iss": p.server.URL, "aud": "aiagent", "exp": float64(time.Now().Add(-time.Hour).Unix())})},
+		{"missing exp", p.sign(t, p.kid, map[string]any{"iss": p.server.URL, "aud": "aiagent"})},
+		{"not valid yet", p.sign(t, p.kid, map[string]any{"iss": p.server.URL, "aud": "aiagent", "exp": exp, "nbf": exp})},
+		{"other audience", p.sign(t, p.kid, map[string]any{"iss": p.server.URL, "aud": "other", "exp": exp})},
+		{"other issuer", p.sign(t, p.kid, map[string]any{"iss": "https://evil.example.com", "aud": "aiagent", "exp": exp})},
+		{"unknown key", p.sign(t, "key-2", map[string]any{"iss": p.server.URL, "aud": "aiagent", "exp": exp})},
+		{"tampered", p.sign(t, p.kid, map[string]any{"iss": p.server.URL, "aud": "aiagent", "exp": exp}) + "x"},
+		{"not a JWT", "api-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), tt.token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package cassette
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RecordEnv is the environment variable that switches Open to recording mode;
+// set it to "1" to run the tests against the real LLM and rewrite their cassettes
+const RecordEnv = "AIAGENT_RECORD_CASSETTES"
+
+// ErrInteractionNotFound is returned by a ReplayingLLM for a prompt that is not on the cassette
+var ErrInteractionNotFound = errors.New("no recorded interaction for prompt")
+
+// LLM is the interface of the language models that can be recorded
+// It matches nodes.LLM
+type LLM interface {
+	Complete(prompt string) (string, error)
+}
+
+// Interaction is a single prompt and the response (or error) of the LLM
+type Interaction struct {
+	Prompt   string `yaml:"prompt"`
+	Response string `yaml:"response,omitempty"`
+	Error    string `yaml:"error,omitempty"`
+}
+
+// Cassette is the list of interactions stored in a cassette file
+type Cassette struct {
+	Interactions []Interaction `yaml:"interactions"`
+}
+
+// Load reads a cassette file
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %v", err)
+	}
+	var c Cassette
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path, creating the directory if needed
+func (c *Cassette) Save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette: %v", err)
+	}
+	return nil
+}
+
+// RecordingLLM wraps an LLM and records every interaction; Save writes them to the cassette file
+type RecordingLLM struct {
+	llm  LLM
+	path string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecordingLLM creates a new recording wrapper around llm that saves to path
+func NewRecordingLLM(llm LLM, path string) *RecordingLLM {
+	return &RecordingLLM{
+		llm:  llm,
+		path: path,
+	}
+}
+
+// Complete implements the LLM interface
+func (r *RecordingLLM) Complete(prompt string) (string, error) {
+	response, err := r.llm.Complete(prompt)
+
+	interaction := Interaction{Prompt: prompt, Response: response}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	return response, err
+}
+
+// Save writes the recorded interactions to the cassette file
+func (r *RecordingLLM) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.path)
+}
+
+// ReplayingLLM serves the interactions of a cassette
+// Responses are looked up by prompt; a prompt recorded several times gets its
+// responses in the recorded order, the last one being repeated
+type ReplayingLLM struct {
+	mu        sync.Mutex
+	responses map[string][]Interaction
+	served    map[string]int
+}
+
+// NewReplayingLLM creates a new instance of ReplayingLLM serving the cassette
+func NewReplayingLLM(c *Cassette) *ReplayingLLM {
+	r := &ReplayingLLM{
+		responses: make(map[string][]Interaction),
+		served:    make(map[string]int),
+	}
+	for _, interaction := range c.Interactions {
+		r.responses[interaction.Prompt] = append(r.responses[interaction.Prompt], interaction)
+	}
+	return r
+}
+
+// Complete implements the LLM interface
+func (r *ReplayingLLM) Complete(prompt string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interactions := r.responses[prompt]
+	if len(interactions) == 0 {
+		return "", fmt.Errorf("%w: %q", ErrInteractionNotFound, truncate(prompt, 200))
+	}
+	i := r.served[prompt]
+	if i >= len(interactions) {
+		i = len(interactions) - 1
+	}
+	r.served[prompt]++
+
+	interaction := interactions[i]
+	if interaction.Error != "" {
+		return interaction.Response, errors.New(interaction.Error)
+	}
+	return interaction.Response, nil
+}
+
+// Open returns the LLM for a test using the cassette at path
+// Normally the cassette is replayed; with RecordEnv set to "1" the LLM returned by
+// newLLM is used and recorded instead. The returned function must be called when the
+// test is done: it saves the cassette in recording mode and does nothing otherwise
+func Open(path string, newLLM func() (LLM, error)) (LLM, func() error, error) {
+	if os.Getenv(RecordEnv) != "1" {
+		c, err := Load(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewReplayingLLM(c), func() error { return nil }, nil
+	}
+
+	llm, err := newLLM()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create LLM for recording: %v", err)
+	}
+	recorder := NewRecordingLLM(llm, path)
+	return recorder, recorder.Save, nil
+}
+
+// truncate shortens s to at most n bytes for error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,80 @@
+package cassette
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLLM answers prompts from a map
+type fakeLLM map[string]string
+
+func (f fakeLLM) Complete(prompt string) (string, error) {
+	if response, ok := f[prompt]; ok {
+		return response, nil
+	}
+	return "", errors.New("quota exceeded")
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "greeting.yaml")
+	recorder := NewRecordingLLM(fakeLLM{"say hi": "hi\nthere"}, path)
+
+	response, err := recorder.Complete("say hi")
+	assert.NoError(t, err)
+	assert.Equal(t, "hi\nthere", response)
+	_, err = recorder.Complete("say bye")
+	assert.Error(t, err)
+	assert.NoError(t, recorder.Save())
+
+	c, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []Interaction{
+		{Prompt: "say hi", Response: "hi\nthere"},
+		{Prompt: "say bye", Error: "quota exceeded"},
+	}, c.Interactions)
+
+	player := NewReplayingLLM(c)
+	response, err = player.Complete("say hi")
+	assert.NoError(t, err)
+	assert.Equal(t, "hi\nthere", response)
+
+	_, err = player.Complete("say bye")
+	assert.EqualError(t, err, "quota exceeded")
+
+	_, err = player.Complete("say something else")
+	assert.ErrorIs(t, err, ErrInteractionNotFound)
+}
+
+func TestReplayingLLM_RepeatedPrompt(t *testing.T) {
+	player := NewReplayingLLM(&Cassette{Interactions: []Interaction{
+		{Prompt: "is it done?", Response: "no"},
+		{Prompt: "is it done?", Response: "yes"},
+	}})
+
+	for _, expected := range []string{"no", "yes", "yes"} {
+		response, err := player.Complete("is it done?")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, response)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "open.yaml")
+	assert.NoError(t, (&Cassette{Interactions: []Interaction{{Prompt: "ping", Response: "pong"}}}).Save(path))
+	newLLM := func() (LLM, error) { return nil, errors.New("no API key in tests") }
+
+	t.Setenv(RecordEnv, "")
+	llm, done, err := Open(path, newLLM)
+	assert.NoError(t, err)
+	response, err := llm.Complete("ping")
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", response)
+	assert.NoError(t, done())
+
+	t.Setenv(RecordEnv, "1")
+	_, _, err = Open(path, newLLM)
+	assert.Error(t, err)
+}
@@ -0,0 +1,275 @@
+package ci
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/prompts"
+)
+
+const (
+	// MaxLogBytes is the size of the end of a build log sent to the LLM; failures are
+	// reported at the end of a log
+	MaxLogBytes = 16 * 1024
+
+	// MaxFiles is the maximum number of source files named in a log that are read
+	MaxFiles = 10
+
+	// contextLines is the number of lines shown around a line named in a log
+	contextLines = 10
+)
+
+// referencePattern matches the file:line references of compilers, linters and test runners
+var referencePattern = regexp.MustCompile(`([A-Za-z0-9_.@/\\-]+\.[A-Za-z0-9]+):(\d+)`)
+
+// Reference is a source file and line named in a build log
+type Reference struct {
+	Path string
+	Line int
+}
+
+// FindReferences returns the references of a log to the files of dir, in the order of the
+// log, covering at most limit files; paths are relative to dir
+// References to files outside dir or that do not exist are skipped
+func FindReferences(log, dir string, limit int) []Reference {
+	var refs []Reference
+	seen := make(map[Reference]bool)
+	files := make(map[string]bool)
+	index := &fileIndex{dir: dir}
+	for _, match := range referencePattern.FindAllStringSubmatch(log, -1) {
+		path, ok := index.resolve(match[1])
+		if !ok {
+			continue
+		}
+		line, err := strconv.Atoi(match[2])
+		if err != nil || line < 1 {
+			continue
+		}
+		ref := Reference{Path: path, Line: line}
+		if seen[ref] {
+			continue
+		}
+		if !files[path] && len(files) >= limit {
+			continue
+		}
+		seen[ref] = true
+		files[path] = true
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// skippedDirs are not searched for the files named in a log
+var skippedDirs = map[string]bool{".git": true, "node_modules": true, "vendor": true}
+
+// fileIndex resolves the paths of a log to the regular files of dir
+type fileIndex struct {
+	dir   string
+	files []string
+}
+
+// resolve returns the path of a regular file of dir relative to dir
+// Test runners print paths relative to the package, so a path not found in dir is
+// looked up as the suffix of a single file below dir
+func (x *fileIndex) resolve(path string) (string, bool) {
+	path = filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(x.dir, path)
+		if err != nil {
+			return "", false
+		}
+		path = rel
+	}
+	if path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if isFile(filepath.Join(x.dir, path)) {
+		return filepath.ToSlash(path), true
+	}
+
+	if x.files == nil {
+		x.files = []string{}
+		filepath.WalkDir(x.dir, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			if d.Type().IsRegular() {
+				rel, _ := filepath.Rel(x.dir, p)
+				x.files = append(x.files, rel)
+			}
+			return nil
+		})
+	}
+	found := ""
+	for _, file := range x.files {
+		if strings.HasSuffix(file, string(filepath.Separator)+path) {
+			if found != "" {
+				return "", false // ambiguous
+			}
+			found = file
+		}
+	}
+	return filepath.ToSlash(found), found != ""
+}
+
+func isFile(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Excerpts returns the lines around the references, grouped by file, numbered like
+// "  12| code"; the referenced lines are marked with ">"
+func Excerpts(dir string, refs []Reference) (string, error) {
+	byFile := make(map[string][]int)
+	var paths []string
+	for _, ref := range refs {
+		if _, ok := byFile[ref.Path]; !ok {
+			paths = append(paths, ref.Path)
+		}
+		byFile[ref.Path] = append(byFile[ref.Path], ref.Line)
+	}
+
+	var sb strings.Builder
+	for _, path := range paths {
+		lines, err := readLines(filepath.Join(dir, path))
+		if err != nil {
+			return "", err
+		}
+		marked := make(map[int]bool)
+		shown := make(map[int]bool)
+		for _, line := range byFile[path] {
+			marked[line] = true
+			for n := max(1, line-contextLines); n <= min(len(lines), line+contextLines); n++ {
+				shown[n] = true
+			}
+		}
+		numbers := make([]int, 0, len(shown))
+		for n := range shown {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+
+		fmt.Fprintf(&sb, "=== %s ===\n", path)
+		for i, n := range numbers {
+			if i > 0 && numbers[i-1] != n-1 {
+				sb.WriteString("...\n")
+			}
+			mark := " "
+			if marked[n] {
+				mark = ">"
+			}
+			fmt.Fprintf(&sb, "%s%4d| %s\n", mark, n, lines[n-1])
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return lines, nil
+}
+
+// TrimLog returns the end of a log of at most maxBytes bytes, starting at a line
+func TrimLog(log string, maxBytes int) string {
+	if len(log) <= maxBytes {
+		return log
+	}
+	cut := len(log) - maxBytes
+	if i := strings.IndexByte(log[cut:], '\n'); i >= 0 {
+		cut += i + 1
+	}
+	return fmt.Sprintf("... (%d bytes cut)\n%s", cut, log[cut:])
+}
+
+// Report is the diagnosis of a failed build
+type Report struct {
+	Summary   string   `json:"summary"`
+	RootCause string   `json:"root_cause"`
+	Files     []string `json:"files,omitempty"`
+	Fix       string   `json:"fix"`
+	Patch     string   `json:"patch,omitempty"`
+}
+
+// Markdown formats the report, for example as the comment of a pull request
+func (r *Report) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("## Build failure diagnosis\n\n")
+	fmt.Fprintf(&sb, "**Summary:** %s\n\n", r.Summary)
+	fmt.Fprintf(&sb, "### Root cause\n\n%s\n\n", r.RootCause)
+	if len(r.Files) > 0 {
+		sb.WriteString("### Files\n\n")
+		for _, file := range r.Files {
+			fmt.Fprintf(&sb, "- `%s`\n", file)
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "### Suggested fix\n\n%s\n", r.Fix)
+	if r.Patch != "" {
+		fmt.Fprintf(&sb, "\n<details><summary>Patch</summary>\n\n```diff\n%s\n```\n\n</details>\n", strings.TrimRight(r.Patch, "\n"))
+	}
+	return sb.String()
+}
+
+// Diagnose asks the LLM for the cause of a failed build, showing it the end of the log
+// and the source lines the log names; with patch, the report includes a patch
+func Diagnose(llm nodes.LLM, templates *prompts.Registry, dir, log string, patch bool) (*Report, error) {
+	if strings.TrimSpace(log) == "" {
+		return nil, fmt.Errorf("the build log is empty")
+	}
+	if templates == nil {
+		templates = prompts.Builtin()
+	}
+
+	log = TrimLog(log, MaxLogBytes)
+	sources, err := Excerpts(dir, FindReferences(log, dir, MaxFiles))
+	if err != nil {
+		return nil, err
+	}
+	prompt, err := templates.Render(prompts.CIDiagnose, prompts.Vars{
+		"WorkingDirectory": dir,
+		"Log":              log,
+		"Sources":          sources,
+		"Patch":            patch,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := llm.Complete(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", nodes.ErrLLM, err)
+	}
+	var report Report
+	if err := nodes.ParseLLMJSONWithRepair(llm, response, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse diagnosis: %w", err)
+	}
+	if !patch {
+		report.Patch = ""
+	}
+	return &report, nil
+}
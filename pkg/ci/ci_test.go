@@ -0,0 +1,130 @@
+package ci
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/nodes"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func numberedLines(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		sb.WriteString("line " + strings.Repeat("x", i%3) + "\n")
+	}
+	return sb.String()
+}
+
+func TestFindReferences(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "pkg/store/store.go"), numberedLines(50))
+	writeFile(t, filepath.Join(dir, "pkg/store/store_test.go"), numberedLines(50))
+	writeFile(t, filepath.Join(dir, "a/util.go"), "")
+	writeFile(t, filepath.Join(dir, "b/util.go"), "")
+
+	log := strings.Join([]string{
+		"# aiagent/pkg/store",
+		"pkg/store/store.go:12:2: undefined: missing",
+		"./pkg/store/store.go:12:2: undefined: missing",
+		"    store_test.go:40: expected 1, got 2",
+		filepath.Join(dir, "pkg/store/store.go") + ":30: absolute",
+		"util.go:3: ambiguous",
+		"/etc/passwd:1: outside",
+		"../outside.go:1: outside",
+		"README.md:0: no line",
+	}, "\n")
+
+	assert.Equal(t, []Reference{
+		{Path: "pkg/store/store.go", Line: 12},
+		{Path: "pkg/store/store_test.go", Line: 40},
+		{Path: "pkg/store/store.go", Line: 30},
+	}, FindReferences(log, dir, MaxFiles))
+
+	assert.Equal(t, []Reference{
+		{Path: "pkg/store/store.go", Line: 12},
+		{Path: "pkg/store/store.go", Line: 30},
+	}, FindReferences(log, dir, 1), "the references to files beyond the limit are skipped")
+}
+
+func TestExcerpts(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc main() {\n\tundefined()\n}\n")
+
+	excerpts, err := Excerpts(dir, []Reference{{Path: "main.go", Line: 4}})
+	assert.NoError(t, err)
+	assert.Equal(t, "=== main.go ===\n"+
+		"    1| package main\n"+
+		"    2| \n"+
+		"    3| func main() {\n"+
+		">   4| \tundefined()\n"+
+		"    5| }\n\n", excerpts)
+
+	writeFile(t, filepath.Join(dir, "long.go"), numberedLines(100))
+	excerpts, err = Excerpts(dir, []Reference{{Path: "long.go", Line: 20}, {Path: "long.go", Line: 80}})
+	assert.NoError(t, err)
+	assert.Contains(t, excerpts, "   30| line")
+	assert.Contains(t, excerpts, "...\n   70| line")
+	assert.NotContains(t, excerpts, "   50| line")
+}
+
+func TestTrimLog(t *testing.T) {
+	assert.Equal(t, "short", TrimLog("short", 10))
+	assert.Equal(t, "... (12 bytes cut)\nline3\n", TrimLog("line1\nline2\nline3\n", 8))
+}
+
+func TestDiagnose(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc main() {\n\tundefined()\n}\n")
+
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains("./main.go:4:2: undefined: undefined").Respond("```json\n" + `{
+		"summary": "The build fails on an undefined function",
+		"root_cause": "main.go:4 calls undefined, which is not declared",
+		"files": ["main.go"],
+		"fix": "Declare undefined or remove the call",
+		"patch": "--- a/main.go\n+++ b/main.go"
+	}` + "\n```")
+
+	report, err := Diagnose(llm, nil, dir, "# example\n./main.go:4:2: undefined: undefined\n", false)
+	assert.NoError(t, err)
+	assert.Equal(t, &Report{
+		Summary:   "The build fails on an undefined function",
+		RootCause: "main.go:4 calls undefined, which is not declared",
+		Files:     []string{"main.go"},
+		Fix:       "Declare undefined or remove the call",
+	}, report, "the patch is dropped unless it was asked for")
+	assert.Contains(t, llm.Calls()[0], ">   4| \tundefined()")
+	assert.NotContains(t, llm.Calls()[0], `"patch"`)
+
+	report, err = Diagnose(llm, nil, dir, "./main.go:4:2: undefined: undefined\n", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "--- a/main.go\n+++ b/main.go", report.Patch)
+	assert.Contains(t, llm.Calls()[1], `"patch"`)
+	assert.Contains(t, report.Markdown(), "```diff\n--- a/main.go\n+++ b/main.go\n```")
+
+	_, err = Diagnose(llm, nil, dir, "  \n", false)
+	assert.EqualError(t, err, "the build log is empty")
+}
+
+func TestReport_Markdown(t *testing.T) {
+	report := &Report{Summary: "Tests fail", RootCause: "A nil map", Files: []string{"a.go"}, Fix: "Initialize the map"}
+	assert.Equal(t, "## Build failure diagnosis\n\n"+
+		"**Summary:** Tests fail\n\n"+
+		"### Root cause\n\nA nil map\n\n"+
+		"### Files\n\n- `a.go`\n\n"+
+		"### Suggested fix\n\nInitialize the map\n", report.Markdown())
+}
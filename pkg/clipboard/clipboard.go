@@ -0,0 +1,90 @@
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnavailable is returned when no clipboard tool is installed
+var ErrUnavailable = errors.New("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+
+// tool is a command line tool reading and writing the clipboard
+type tool struct {
+	read  []string
+	write []string
+}
+
+// lookPath finds the executable of a tool, replaced in tests
+var lookPath = exec.LookPath
+
+// tools returns the clipboard tools of an operating system, in the order they are tried
+func tools(goos string, getenv func(string) string) []tool {
+	switch goos {
+	case "darwin":
+		return []tool{{read: []string{"pbpaste"}, write: []string{"pbcopy"}}}
+	case "windows":
+		return []tool{{
+			read:  []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+			write: []string{"clip"},
+		}}
+	}
+	var found []tool
+	if getenv("WAYLAND_DISPLAY") != "" {
+		found = append(found, tool{read: []string{"wl-paste", "--no-newline"}, write: []string{"wl-copy"}})
+	}
+	return append(found,
+		tool{read: []string{"xclip", "-selection", "clipboard", "-o"}, write: []string{"xclip", "-selection", "clipboard", "-i"}},
+		tool{read: []string{"xsel", "--clipboard", "--output"}, write: []string{"xsel", "--clipboard", "--input"}},
+	)
+}
+
+// find returns the command of the first installed tool; read selects the reading command
+func find(read bool) ([]string, error) {
+	for _, t := range tools(runtime.GOOS, os.Getenv) {
+		command := t.write
+		if read {
+			command = t.read
+		}
+		if _, err := lookPath(command[0]); err == nil {
+			return command, nil
+		}
+	}
+	return nil, ErrUnavailable
+}
+
+// Read returns the text in the clipboard
+func Read() (string, error) {
+	command, err := find(true)
+	if err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the clipboard with %s: %v: %s", command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// Write replaces the content of the clipboard with text
+func Write(text string) error {
+	command, err := find(false)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write the clipboard with %s: %v: %s", command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package clipboard
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTools(t *testing.T) {
+	noEnv := func(string) string { return "" }
+	wayland := func(name string) string {
+		if name == "WAYLAND_DISPLAY" {
+			return "wayland-0"
+		}
+		return ""
+	}
+
+	assert.Equal(t, []string{"pbpaste"}, tools("darwin", noEnv)[0].read)
+	assert.Equal(t, []string{"clip"}, tools("windows", noEnv)[0].write)
+	assert.Equal(t, "xclip", tools("linux", noEnv)[0].read[0])
+	assert.Equal(t, "wl-paste", tools("linux", wayland)[0].read[0])
+	assert.Len(t, tools("freebsd", noEnv), 2)
+}
+
+func TestReadWrite(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("needs /bin/sh")
+	}
+
+	// Fake tools keep the clipboard in a file
+	dir := t.TempDir()
+	store := filepath.Join(dir, "clipboard")
+	script := "#!/bin/sh\ncase \"$*\" in\n*-o*|*--output*|*--no-newline*) cat " + store + " ;;\n*) cat > " + store + " ;;\nesac\n"
+	for _, name := range []string{"pbpaste", "pbcopy", "xclip", "xsel", "wl-paste", "wl-copy"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0700))
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("WAYLAND_DISPLAY", "")
+
+	require.NoError(t, Write("panic: runtime error\n"))
+	text, err := Read()
+	require.NoError(t, err)
+	assert.Equal(t, "panic: runtime error\n", text)
+}
+
+func TestUnavailable(t *testing.T) {
+	original := lookPath
+	t.Cleanup(func() { lookPath = original })
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+
+	_, err := Read()
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, Write("x"), ErrUnavailable)
+}
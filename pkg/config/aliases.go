@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AliasPrefix marks a request as the name of an alias, e.g. aiagent @todo-scan
+const AliasPrefix = "@"
+
+// aliasParam matches the placeholders of an alias: $1 to $9 for an argument, $@ for all
+// arguments and $$ for a dollar sign
+var aliasParam = regexp.MustCompile(`\$([1-9@$])`)
+
+// ExpandAlias returns the request of the named alias with its placeholders replaced by args
+// An alias without placeholders gets the arguments appended, so
+// "@todo-scan in pkg/nodes" extends the request of todo-scan
+func (c *Config) ExpandAlias(name string, args []string) (string, error) {
+	request, ok := c.Aliases[name]
+	if !ok {
+		if len(c.Aliases) == 0 {
+			return "", fmt.Errorf("unknown alias %s%s: no aliases are configured", AliasPrefix, name)
+		}
+		return "", fmt.Errorf("unknown alias %s%s (available: %s)", AliasPrefix, name, strings.Join(c.AliasNames(), ", "))
+	}
+
+	if !aliasParam.MatchString(request) {
+		return strings.TrimSpace(strings.Join(append([]string{request}, args...), " ")), nil
+	}
+
+	missing := false
+	expanded := aliasParam.ReplaceAllStringFunc(request, func(param string) string {
+		switch param[1] {
+		case '$':
+			return "$"
+		case '@':
+			return strings.Join(args, " ")
+		}
+		n, _ := strconv.Atoi(param[1:])
+		if n > len(args) {
+			missing = true
+			return param
+		}
+		return args[n-1]
+	})
+	if missing {
+		return "", fmt.Errorf("alias %s%s is missing argument $%d", AliasPrefix, name, len(args)+1)
+	}
+	return strings.TrimSpace(expanded), nil
+}
+
+// AliasNames returns the names of all configured aliases in sorted order
+func (c *Config) AliasNames() []string {
+	names := make([]string, 0, len(c.Aliases))
+	for name := range c.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
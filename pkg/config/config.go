@@ -0,0 +1,845 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"aiagent/pkg/pii"
+	"aiagent/pkg/policy"
+	"aiagent/pkg/quarantine"
+	"aiagent/pkg/report"
+	"aiagent/pkg/sandbox"
+)
+
+// envNamePattern matches the names of environment variables
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Config contains the user configuration loaded from the config file
+type Config struct {
+	// Model selects the LLM used outside of workspaces; empty uses the default OpenAI model
+	Model ModelConfig `yaml:"model"`
+
+	// Policy is the command policy outside of workspaces: "strict" (default) or "relaxed"
+	Policy string `yaml:"policy"`
+
+	// Language is the language of the answers, by name or ISO 639-1 code, e.g. de; empty
+	// answers in the language of the request. --lang takes precedence
+	Language string `yaml:"language"`
+
+	// Diagrams is the format of the package diagrams added to the answers about the
+	// architecture of a Go module: "mermaid" (default), "graphviz" or "none"
+	Diagrams string `yaml:"diagrams"`
+
+	// Profiles are named sets of settings that override the others, selected with
+	// --config-profile; a profile may extend another one, and the "default" profile is
+	// applied when none is selected
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+
+	// Profile is the name of the applied profile; empty when none was applied
+	Profile string `yaml:"-"`
+
+	// Aliases are frequently used requests by name, run as aiagent @<name>; $1 to $9 in a
+	// request are replaced by the arguments after the name and $@ by all of them
+	Aliases map[string]string `yaml:"aliases"`
+
+	// Limits caps the amount of data kept in memory during a run
+	Limits LimitsConfig `yaml:"limits"`
+
+	// Workspaces are named profiles selected with --workspace
+	Workspaces map[string]WorkspaceConfig `yaml:"workspaces"`
+
+	// Tracing configures the export of run traces to an OpenTelemetry collector
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// Pricing overrides the model prices used for the cost in run reports
+	Pricing map[string]report.Price `yaml:"pricing"`
+
+	// Prompts adds and selects versions of the prompt templates
+	Prompts PromptsConfig `yaml:"prompts"`
+
+	// MCPServers are external MCP servers whose tools the agent can use, by name
+	MCPServers map[string]MCPServerConfig `yaml:"mcp_servers"`
+
+	// Plugins configures the discovery of plugins adding tools and LLM providers
+	Plugins PluginsConfig `yaml:"plugins"`
+
+	// PII configures the scan of the prompts for personal data before they are sent
+	PII PIIConfig `yaml:"pii"`
+
+	// Webhook receives a callback when a run finishes
+	Webhook WebhookConfig `yaml:"webhook"`
+
+	// Approval makes another person approve risky commands
+	Approval ApprovalConfig `yaml:"approval"`
+
+	// PolicyEngine decides about commands and file writes with the rules of the organization
+	PolicyEngine PolicyEngineConfig `yaml:"policy_engine"`
+
+	// LearnedRisk approves commands with a good history without asking
+	LearnedRisk LearnedRiskConfig `yaml:"learned_risk"`
+
+	// Sandbox restricts the network access of the generated commands
+	Sandbox SandboxConfig `yaml:"sandbox"`
+
+	// Quarantine holds the files the agent creates outside the approved scope for review
+	Quarantine QuarantineConfig `yaml:"quarantine"`
+
+	// Server configures the authentication and the users of server mode
+	Server ServerConfig `yaml:"server"`
+
+	// IssueTracker configures the tracker the issue node files findings in
+	IssueTracker IssueTrackerConfig `yaml:"issue_tracker"`
+
+	// SMTP is the mail server the email digests are sent through
+	SMTP SMTPConfig `yaml:"smtp"`
+
+	// EmailDigests email the report of a run to a list of recipients, by name; a scheduled
+	// run, e.g. a cron job, selects its digest with --email-digest
+	EmailDigests map[string]EmailDigestConfig `yaml:"email_digests"`
+
+	// Classifier customizes how requests are routed to the nodes
+	Classifier ClassifierConfig `yaml:"classifier"`
+
+	// HTTP configures the connections to the LLM providers
+	HTTP HTTPConfig `yaml:"http"`
+
+	// Orchestration configures the mode where a planner splits a request into tasks and a
+	// critic reviews their results
+	Orchestration OrchestrationConfig `yaml:"orchestration"`
+}
+
+// OrchestrationConfig configures the planner, the nodes executing its tasks and the critic
+type OrchestrationConfig struct {
+	// Enabled runs every request through the planner, like --orchestrate
+	Enabled bool `yaml:"enabled"`
+
+	// MaxRevisions is how often the critic sends a task back to its node before accepting
+	// the result (default: 1); -1 accepts every result after its review
+	MaxRevisions int `yaml:"max_revisions"`
+
+	// Agents are the models of the agents by node name, e.g. "planner", "critic" or "bash";
+	// an agent without one uses the model of the run
+	Agents map[string]AgentConfig `yaml:"agents"`
+}
+
+// AgentConfig configures an agent of the orchestration mode
+type AgentConfig struct {
+	Model ModelConfig `yaml:"model"`
+}
+
+// HTTPConfig configures the HTTP client the LLM providers are called with
+type HTTPConfig struct {
+	// Timeout limits an LLM request including reading the response (default: 30s)
+	Timeout time.Duration `yaml:"timeout"`
+
+	// ConnectTimeout limits establishing a connection, including the TLS handshake (default: 10s)
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+
+	// Proxy is the URL of the proxy the requests go through; empty uses the HTTPS_PROXY,
+	// HTTP_PROXY and NO_PROXY environment variables
+	Proxy string `yaml:"proxy"`
+
+	// CACertFile is a PEM file of CA certificates trusted in addition to the system ones,
+	// e.g. of a corporate proxy. "~" is expanded to the home directory
+	CACertFile string `yaml:"ca_cert_file"`
+
+	// Offline limits the requests to addresses on this machine; set by --offline
+	Offline bool `yaml:"-"`
+}
+
+// ClassifierConfig customizes the routing of the classifier
+type ClassifierConfig struct {
+	// Examples are added to the classifier prompt, so domain-specific phrasing is routed
+	// to the right node
+	Examples []RoutingExample `yaml:"examples"`
+
+	// Rules route matching requests without asking the LLM; they are evaluated in order,
+	// before the built-in rules
+	Rules []RoutingRule `yaml:"rules"`
+
+	// DisableBuiltinRules routes "ls", "list files" and "pwd" through the LLM as well
+	DisableBuiltinRules bool `yaml:"disable_builtin_rules"`
+
+	// MinConfidence is the confidence, from 0 to 1, below which a routing decision of the
+	// LLM is double-checked (default: 0.5)
+	MinConfidence float64 `yaml:"min_confidence"`
+
+	// LowConfidence is what happens to a decision below MinConfidence: "ask" the user
+	// (default; a second opinion when nobody can be asked), get a "second_opinion" from the
+	// LLM, or "ignore" the confidence
+	LowConfidence string `yaml:"low_confidence"`
+
+	// CacheTTL is how long the routing of a request is reused when the same request is
+	// repeated, e.g. in chat or by clients of the server (default: 5m)
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	// DisableCache classifies every request, even a repeated one
+	DisableCache bool `yaml:"disable_cache"`
+}
+
+// Values of Config.Diagrams
+const (
+	DiagramsMermaid  = "mermaid"
+	DiagramsGraphviz = "graphviz"
+	DiagramsNone     = "none"
+)
+
+// Values of ClassifierConfig.LowConfidence
+const (
+	LowConfidenceAsk           = "ask"
+	LowConfidenceSecondOpinion = "second_opinion"
+	LowConfidenceIgnore        = "ignore"
+)
+
+// RoutingRule routes the requests matching a regular expression to a node
+type RoutingRule struct {
+	// Pattern is a regular expression matched against the request, e.g. (?i)^git status$
+	Pattern string `yaml:"pattern"`
+
+	// Node is the node handling matching requests
+	Node string `yaml:"node"`
+
+	// Command, for the bash node, is run instead of asking the LLM for a command; its
+	// output is the result of the run
+	Command string `yaml:"command"`
+}
+
+// RoutingExample is a request and the node it should be routed to
+type RoutingExample struct {
+	// Input is an example request, e.g. "is staging healthy?"
+	Input string `yaml:"input"`
+
+	// Node is the node handling it, e.g. "bash" or "code_analyzer"
+	Node string `yaml:"node"`
+}
+
+// SMTPConfig configures the mail server used to send email
+type SMTPConfig struct {
+	// Host is the name of the mail server
+	Host string `yaml:"host"`
+
+	// Port is the port of the mail server (default: 587); port 465 uses implicit TLS
+	Port int `yaml:"port"`
+
+	// Username authenticates with the server; empty sends without authentication
+	Username string `yaml:"username"`
+
+	// PasswordEnv is the environment variable holding the password of Username
+	PasswordEnv string `yaml:"password_env"`
+
+	// From is the sender of the email, e.g. "aiagent <aiagent@example.com>"
+	From string `yaml:"from"`
+}
+
+// EmailDigestConfig describes who receives the report of a run by email
+type EmailDigestConfig struct {
+	// To are the recipients of the digest
+	To []string `yaml:"to"`
+
+	// Subject is the subject of the email (default: "aiagent: " followed by the request)
+	Subject string `yaml:"subject"`
+
+	// OnlyFailures sends the digest only when the run failed
+	OnlyFailures bool `yaml:"only_failures"`
+}
+
+// IssueTrackerConfig selects the issue tracker and the project issues are filed in
+type IssueTrackerConfig struct {
+	// Type is "github", "gitlab" or "jira"; empty disables the issue node
+	Type string `yaml:"type"`
+
+	// URL is the base URL of the tracker (default: https://api.github.com for github,
+	// https://gitlab.com for gitlab); required for jira
+	URL string `yaml:"url"`
+
+	// Project is the repository ("owner/name") on GitHub, the project path or ID on
+	// GitLab and the project key on Jira
+	Project string `yaml:"project"`
+
+	// TokenEnv is the environment variable holding the token (default: GITHUB_TOKEN,
+	// GITLAB_TOKEN or JIRA_API_TOKEN)
+	TokenEnv string `yaml:"token_env"`
+
+	// User is the Jira user, e.g. an email address, the API token belongs to; without
+	// it the token is used as a personal access token
+	User string `yaml:"user"`
+
+	// IssueType is the type of the issues created on Jira (default: Task)
+	IssueType string `yaml:"issue_type"`
+
+	// Labels are added to every filed issue
+	Labels []string `yaml:"labels"`
+}
+
+// ServerConfig configures who may use the HTTP API of server mode
+// Without users the API is open to everyone who can reach it
+type ServerConfig struct {
+	// Users are the users of the server by name; once a user is configured every
+	// request must authenticate as one of them
+	Users map[string]ServerUserConfig `yaml:"users"`
+
+	// OIDC lets the users authenticate with tokens of an OpenID Connect provider
+	OIDC OIDCConfig `yaml:"oidc"`
+}
+
+// ServerUserConfig isolates the runs of a user of the server
+type ServerUserConfig struct {
+	// APIKeyEnv is the environment variable holding the API key of the user
+	APIKeyEnv string `yaml:"api_key_env"`
+
+	// Directory is the directory the runs of the user work in; it also holds the
+	// sessions and the audit log of the user. "~" is expanded to the home directory
+	Directory string `yaml:"directory"`
+
+	// Policy is the command policy of the user: "strict" or "relaxed" (default: the policy of the server)
+	Policy string `yaml:"policy"`
+
+	// RateLimit is the maximum number of runs the user may start per minute (0: no limit)
+	RateLimit int `yaml:"rate_limit"`
+
+	// SlackID is the Slack user ID of the user; with approvals in Slack, the commands of a
+	// user without one are denied, as their own reactions cannot be told apart
+	SlackID string `yaml:"slack_id"`
+}
+
+// OIDCConfig configures the verification of OpenID Connect tokens
+type OIDCConfig struct {
+	// Issuer is the URL of the provider; its signing keys are discovered from it
+	Issuer string `yaml:"issuer"`
+
+	// Audience must be among the audiences of a token, usually the client ID
+	Audience string `yaml:"audience"`
+
+	// UserClaim is the claim holding the name of the user in Users (default: email)
+	UserClaim string `yaml:"user_claim"`
+}
+
+// WebhookConfig configures the callback posted when a run finishes
+type WebhookConfig struct {
+	// URL receives the JSON payload of every finished run; empty disables the callback
+	URL string `yaml:"url"`
+
+	// SecretEnv is the environment variable holding the secret used to sign the payload
+	SecretEnv string `yaml:"secret_env"`
+
+	// Timeout limits a single delivery attempt (default: 10s)
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// ApprovalConfig sends risky commands to the team for approval instead of running them
+type ApprovalConfig struct {
+	// Rating is the lowest command rating needing approval: caution or dangerous; empty
+	// disables team approval
+	Rating string `yaml:"rating"`
+
+	// WebhookURL receives the approval requests and answers with the decision
+	WebhookURL string `yaml:"webhook_url"`
+
+	// SecretEnv is the environment variable holding the secret used to sign the requests
+	SecretEnv string `yaml:"secret_env"`
+
+	// SlackChannel receives the approval requests; the approvers react to decide. The bot
+	// token is read from SLACK_BOT_TOKEN
+	SlackChannel string `yaml:"slack_channel"`
+
+	// Approvers are the people who may approve, as named by the webhook or as Slack user IDs;
+	// required with Slack, otherwise empty allows anyone but the requester
+	Approvers []string `yaml:"approvers"`
+
+	// RequesterSlackID is the Slack user ID of the user running the agent, whose reactions
+	// do not count; the IDs of server users are their slack_id. Required with Slack
+	RequesterSlackID string `yaml:"requester_slack_id"`
+
+	// Timeout is how long a command waits for its approval before it is denied (default: 10m)
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// PolicyEngineConfig configures the rules deciding about commands and file writes in addition
+// to the command policy
+type PolicyEngineConfig struct {
+	// Rules are evaluated in order; the first matching rule decides
+	Rules []policy.Rule `yaml:"rules"`
+
+	// OPA evaluates a Rego policy with the opa command line tool
+	OPA OPAConfig `yaml:"opa"`
+}
+
+// OPAConfig configures the evaluation of a Rego policy
+type OPAConfig struct {
+	// Paths are the Rego files and directories of the policy; "~" is expanded to the home
+	// directory. Empty disables OPA
+	Paths []string `yaml:"paths"`
+
+	// Query selects the decision (default: data.aiagent.decision)
+	Query string `yaml:"query"`
+
+	// Timeout limits an evaluation (default: 10s)
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// LearnedRiskConfig rates commands with the outcomes of their earlier runs in the audit log
+type LearnedRiskConfig struct {
+	// MinRuns is how often a command must have run successfully, and never been rejected,
+	// to run without an approval; 0 disables it. DANGEROUS commands are always asked about
+	MinRuns int `yaml:"min_runs"`
+}
+
+// SandboxConfig restricts what the generated commands can reach
+type SandboxConfig struct {
+	// Egress is the network access of the commands: open (default), none or allowlist.
+	// Restrictions are only supported on Linux
+	Egress string `yaml:"egress"`
+
+	// AllowedHosts are the hosts reachable with the allowlist egress, e.g. github.com or
+	// *.golang.org for its subdomains
+	AllowedHosts []string `yaml:"allowed_hosts"`
+
+	// User is an unprivileged user the commands run as, e.g. aiagent-runner. The agent
+	// switches to it when it runs as root, otherwise it uses sudo -n -u. It cannot be combined
+	// with egress restrictions yet
+	User string `yaml:"user"`
+
+	// Env names the variables of the agent's environment the commands of the user see, on
+	// top of PATH, LANG and TERM, e.g. GOPATH; the rest are not passed on
+	Env []string `yaml:"env"`
+}
+
+// QuarantineConfig holds the files created by the agent outside of the approved scope in
+// .aiagent/quarantine, until they are promoted into the working tree with aiagent quarantine
+type QuarantineConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Scope are the approved paths the agent writes directly: a pattern without a slash
+	// matches file names, e.g. *.go; a pattern with one matches paths and directories,
+	// e.g. docs/ or cmd/*/main.go
+	Scope []string `yaml:"scope"`
+}
+
+// MCPServerConfig describes how to start an external MCP server speaking over stdio
+type MCPServerConfig struct {
+	// Command is the executable of the server
+	Command string `yaml:"command"`
+
+	// Args are the arguments of the command
+	Args []string `yaml:"args"`
+
+	// Env adds environment variables to the environment of the agent
+	Env map[string]string `yaml:"env"`
+
+	// Timeout limits every tool call (default: 60s)
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// PromptsConfig customizes the prompt templates sent to the LLM
+type PromptsConfig struct {
+	// Dir contains additional templates as <name>/<version>.tmpl; a template with the
+	// name and version of a built-in one replaces it. "~" is expanded to the home directory
+	Dir string `yaml:"dir"`
+
+	// Versions selects the version of a template by name, e.g. bash.command: v2;
+	// templates not listed use their latest built-in version
+	Versions map[string]string `yaml:"versions"`
+
+	// Instructions are appended to the system prompt of a node by its name, e.g.
+	// bash: "always prefer ripgrep over grep"
+	Instructions map[string]string `yaml:"instructions"`
+}
+
+// PluginsConfig configures the discovery of plugins
+type PluginsConfig struct {
+	// Dir contains the plugin manifests and executables; empty uses the plugins directory
+	// next to the config file. "~" is expanded to the home directory
+	Dir string `yaml:"dir"`
+
+	// Disabled turns off plugin discovery
+	Disabled bool `yaml:"disabled"`
+}
+
+// PIIConfig configures the scan of the prompts for personal data, e.g. of collected files
+// and command output, before they are sent to the LLM
+type PIIConfig struct {
+	// Mode is off (default), warn, redact or block
+	Mode string `yaml:"mode"`
+
+	// Kinds are the kinds of personal data scanned for: email, phone, national_id and
+	// credit_card; empty scans for all of them
+	Kinds []string `yaml:"kinds"`
+}
+
+// TracingConfig configures OTLP trace export
+// The standard OTEL_EXPORTER_OTLP_* environment variables take precedence
+type TracingConfig struct {
+	// Endpoint is the base OTLP/HTTP endpoint, e.g. http://localhost:4318; empty disables tracing
+	Endpoint string `yaml:"endpoint"`
+
+	// Headers are sent with every export request (e.g. for authentication)
+	Headers map[string]string `yaml:"headers"`
+
+	// ServiceName is the service.name resource attribute (default: aiagent)
+	ServiceName string `yaml:"service_name"`
+}
+
+// WorkspaceConfig binds a working directory, a command policy and a model together
+type WorkspaceConfig struct {
+	// Directory is the directory the agent runs in; "~" is expanded to the home directory
+	Directory string `yaml:"directory"`
+
+	// Policy is the command policy: "strict" (default) or "relaxed"
+	Policy string `yaml:"policy"`
+
+	// Model selects the LLM used in the workspace
+	Model ModelConfig `yaml:"model"`
+}
+
+// ModelConfig describes the LLM provider and model to use
+type ModelConfig struct {
+	// Provider is "openai" (default), "azure" or "ollama"
+	Provider string `yaml:"provider"`
+
+	// Name is the model (or Azure deployment) name
+	Name string `yaml:"name"`
+
+	// URL overrides the chat completions endpoint of the provider
+	URL string `yaml:"url"`
+
+	// APIKeyEnv is the environment variable holding the API key
+	APIKeyEnv string `yaml:"api_key_env"`
+
+	// APIKeyKeychain is the account the API key is stored under in the keychain of the
+	// operating system, e.g. by aiagent init; it takes precedence over APIKeyEnv
+	APIKeyKeychain string `yaml:"api_key_keychain"`
+}
+
+// LimitsConfig contains the size limits applied to the state of a run
+// A value of zero disables the state caps and restores the built-in file limits
+type LimitsConfig struct {
+	// MaxFiles is the maximum number of files read by the content collection
+	MaxFiles int `yaml:"max_files"`
+
+	// MaxFileSize is the maximum size (in bytes) of a single file read into the state
+	MaxFileSize int64 `yaml:"max_file_size"`
+
+	// MaxRawOutputBytes is the maximum size of the raw output kept in the state;
+	// the oldest output is dropped first
+	MaxRawOutputBytes int `yaml:"max_raw_output_bytes"`
+
+	// MaxDirectoryEntries is the maximum number of collected files and directories kept in the state
+	MaxDirectoryEntries int `yaml:"max_directory_entries"`
+
+	// MaxFileCacheBytes is the maximum size of the file contents kept in memory;
+	// larger contents are spilled to temporary files
+	MaxFileCacheBytes int64 `yaml:"max_file_cache_bytes"`
+
+	// MaxPromptContentBytes is the maximum size of the file contents sent to the LLM in one
+	// prompt; larger contents are packed into several prompts. The default of about 12k tokens
+	// leaves room for the answer in the context of smaller models
+	MaxPromptContentBytes int `yaml:"max_prompt_content_bytes"`
+
+	// MaxTaskHistory is the maximum number of completed tasks kept verbatim;
+	// older tasks are evicted and summarized
+	MaxTaskHistory int `yaml:"max_task_history"`
+
+	// HistorySummaryBatch is the number of evicted tasks after which the LLM
+	// condenses the summary of older tasks
+	HistorySummaryBatch int `yaml:"history_summary_batch"`
+}
+
+// Default returns the configuration used when no config file exists
+func Default() *Config {
+	return &Config{
+		Limits: LimitsConfig{
+			MaxFiles:              50,
+			MaxFileSize:           100000,
+			MaxRawOutputBytes:     200000,
+			MaxDirectoryEntries:   500,
+			MaxFileCacheBytes:     10 * 1024 * 1024,
+			MaxPromptContentBytes: 48000,
+			MaxTaskHistory:        20,
+			HistorySummaryBatch:   5,
+		},
+	}
+}
+
+// DefaultPath returns the location of the user config file
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %v", err)
+	}
+	return filepath.Join(dir, "aiagent", "config.yaml"), nil
+}
+
+// Load reads the config file at path on top of the defaults and applies the default profile
+// A missing file is not an error unless required is set
+func Load(path string, required bool) (*Config, error) {
+	return LoadProfile(path, required, "")
+}
+
+// load reads the config file at path on top of the defaults without validating it
+func load(path string, required bool) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate checks that the configuration values are consistent
+func (c *Config) Validate() error {
+	limits := c.Limits
+	if limits.MaxFiles < 0 || limits.MaxFileSize < 0 || limits.MaxRawOutputBytes < 0 ||
+		limits.MaxDirectoryEntries < 0 || limits.MaxFileCacheBytes < 0 ||
+		limits.MaxPromptContentBytes < 0 || limits.MaxTaskHistory < 0 || limits.HistorySummaryBatch < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	switch strings.ToLower(strings.TrimSpace(c.Policy)) {
+	case "", "strict", "relaxed":
+	default:
+		return fmt.Errorf("unknown command policy %q (expected strict or relaxed)", c.Policy)
+	}
+	switch c.PII.Mode {
+	case "", pii.ModeOff, pii.ModeWarn, pii.ModeRedact, pii.ModeBlock:
+	default:
+		return fmt.Errorf("unsupported pii mode %q: use off, warn, redact or block", c.PII.Mode)
+	}
+	if _, err := pii.NewScanner(c.PII.Kinds); err != nil {
+		return fmt.Errorf("pii: %v", err)
+	}
+	if c.HTTP.Timeout < 0 || c.HTTP.ConnectTimeout < 0 {
+		return fmt.Errorf("http timeouts must not be negative")
+	}
+
+	for name, request := range c.Aliases {
+		if name == "" || strings.ContainsAny(name, " \t"+AliasPrefix) {
+			return fmt.Errorf("invalid alias name %q: must not contain spaces or %s", name, AliasPrefix)
+		}
+		if strings.TrimSpace(request) == "" {
+			return fmt.Errorf("alias %s: request is required", name)
+		}
+	}
+
+	for name, workspace := range c.Workspaces {
+		if workspace.Directory == "" {
+			return fmt.Errorf("workspace %s: directory is required", name)
+		}
+	}
+
+	for name, server := range c.MCPServers {
+		// Tools are named <server>.<tool>
+		if name == "" || strings.ContainsAny(name, ". ") {
+			return fmt.Errorf("invalid MCP server name %q: must not contain dots or spaces", name)
+		}
+		if server.Command == "" {
+			return fmt.Errorf("MCP server %s: command is required", name)
+		}
+		if server.Timeout < 0 {
+			return fmt.Errorf("MCP server %s: timeout must not be negative", name)
+		}
+	}
+	if c.Webhook.URL != "" && !strings.HasPrefix(c.Webhook.URL, "http://") && !strings.HasPrefix(c.Webhook.URL, "https://") {
+		return fmt.Errorf("webhook url must be an http or https URL")
+	}
+	if c.Webhook.Timeout < 0 {
+		return fmt.Errorf("webhook timeout must not be negative")
+	}
+	if err := c.Approval.validate(); err != nil {
+		return fmt.Errorf("approval: %v", err)
+	}
+	if _, err := policy.NewRules(c.PolicyEngine.Rules); err != nil {
+		return fmt.Errorf("policy_engine: %v", err)
+	}
+	if c.PolicyEngine.OPA.Timeout < 0 {
+		return fmt.Errorf("policy_engine: opa timeout must not be negative")
+	}
+	switch c.Sandbox.Egress {
+	case "", "open", "none":
+		if len(c.Sandbox.AllowedHosts) > 0 {
+			return fmt.Errorf("sandbox: allowed_hosts requires the allowlist egress")
+		}
+	case "allowlist":
+		if err := sandbox.ValidateHosts(c.Sandbox.AllowedHosts); err != nil {
+			return fmt.Errorf("sandbox: %v", err)
+		}
+	default:
+		return fmt.Errorf("sandbox: unknown egress %q (expected open, none or allowlist)", c.Sandbox.Egress)
+	}
+	if c.LearnedRisk.MinRuns < 0 {
+		return fmt.Errorf("learned_risk: min_runs must not be negative")
+	}
+	if c.Sandbox.User != "" && c.Sandbox.Egress != "" && c.Sandbox.Egress != "open" {
+		return fmt.Errorf("sandbox: user cannot be combined with the %s egress", c.Sandbox.Egress)
+	}
+	if len(c.Sandbox.Env) > 0 && c.Sandbox.User == "" {
+		return fmt.Errorf("sandbox: env requires a user")
+	}
+	for _, name := range c.Sandbox.Env {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("sandbox: invalid environment variable name %q", name)
+		}
+	}
+	if err := quarantine.ValidateScope(c.Quarantine.Scope); err != nil {
+		return fmt.Errorf("quarantine: %v", err)
+	}
+
+	for name, user := range c.Server.Users {
+		if user.Directory == "" {
+			return fmt.Errorf("server user %s: directory is required", name)
+		}
+		if user.APIKeyEnv == "" && c.Server.OIDC.Issuer == "" {
+			return fmt.Errorf("server user %s: api_key_env is required without oidc", name)
+		}
+		if user.RateLimit < 0 {
+			return fmt.Errorf("server user %s: rate_limit must not be negative", name)
+		}
+	}
+	if c.Server.OIDC.Issuer != "" && len(c.Server.Users) == 0 {
+		return fmt.Errorf("server oidc requires users")
+	}
+
+	if tracker := c.IssueTracker; tracker.Type != "" {
+		switch tracker.Type {
+		case "github", "gitlab", "jira":
+		default:
+			return fmt.Errorf("unsupported issue tracker type %q (supported: github, gitlab, jira)", tracker.Type)
+		}
+		if tracker.Project == "" {
+			return fmt.Errorf("issue tracker: project is required")
+		}
+		if tracker.Type == "jira" && tracker.URL == "" {
+			return fmt.Errorf("issue tracker: url is required for jira")
+		}
+	}
+
+	for name, digest := range c.EmailDigests {
+		if len(digest.To) == 0 {
+			return fmt.Errorf("email digest %s: to is required", name)
+		}
+		if c.SMTP.Host == "" || c.SMTP.From == "" {
+			return fmt.Errorf("email digest %s: smtp host and from are required", name)
+		}
+	}
+	if c.SMTP.Port < 0 {
+		return fmt.Errorf("smtp port must not be negative")
+	}
+
+	for i, example := range c.Classifier.Examples {
+		if strings.TrimSpace(example.Input) == "" || strings.TrimSpace(example.Node) == "" {
+			return fmt.Errorf("classifier example %d: input and node are required", i+1)
+		}
+	}
+	for i, rule := range c.Classifier.Rules {
+		if rule.Pattern == "" || rule.Node == "" {
+			return fmt.Errorf("classifier rule %d: pattern and node are required", i+1)
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("classifier rule %d: invalid pattern: %v", i+1, err)
+		}
+		if rule.Command != "" && rule.Node != "bash" {
+			return fmt.Errorf("classifier rule %d: command requires node bash", i+1)
+		}
+	}
+	if c.Classifier.MinConfidence < 0 || c.Classifier.MinConfidence > 1 {
+		return fmt.Errorf("classifier min_confidence must be between 0 and 1")
+	}
+	if c.Classifier.CacheTTL < 0 {
+		return fmt.Errorf("classifier cache_ttl must not be negative")
+	}
+	if c.Orchestration.MaxRevisions < -1 {
+		return fmt.Errorf("orchestration max_revisions must be -1 or more")
+	}
+	for name, agent := range c.Orchestration.Agents {
+		if agent.Model.Name == "" {
+			return fmt.Errorf("orchestration agent %s: model name is required", name)
+		}
+	}
+	switch c.Diagrams {
+	case "", DiagramsMermaid, DiagramsGraphviz, DiagramsNone:
+	default:
+		return fmt.Errorf("unsupported diagrams %q: use mermaid, graphviz or none", c.Diagrams)
+	}
+	switch c.Classifier.LowConfidence {
+	case "", LowConfidenceAsk, LowConfidenceSecondOpinion, LowConfidenceIgnore:
+	default:
+		return fmt.Errorf("unsupported classifier low_confidence %q: use ask, second_opinion or ignore", c.Classifier.LowConfidence)
+	}
+	return nil
+}
+
+// Workspace returns the workspace with the given name with its directory expanded
+func (c *Config) Workspace(name string) (WorkspaceConfig, error) {
+	workspace, ok := c.Workspaces[name]
+	if !ok {
+		return WorkspaceConfig{}, fmt.Errorf("unknown workspace: %s", name)
+	}
+
+	dir, err := ExpandHome(workspace.Directory)
+	if err != nil {
+		return WorkspaceConfig{}, err
+	}
+	workspace.Directory = dir
+	return workspace, nil
+}
+
+// WorkspaceNames returns the names of all configured workspaces in sorted order
+func (c *Config) WorkspaceNames() []string {
+	names := make([]string, 0, len(c.Workspaces))
+	for name := range c.Workspaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpandHome replaces a leading "~" in path with the home directory of the user
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// validate checks the approval settings
+func (a ApprovalConfig) validate() error {
+	switch strings.ToLower(a.Rating) {
+	case "":
+		return nil
+	case "caution", "dangerous":
+	default:
+		return fmt.Errorf("unknown rating %q (expected caution or dangerous)", a.Rating)
+	}
+	switch {
+	case (a.WebhookURL == "") == (a.SlackChannel == ""):
+		return fmt.Errorf("set either webhook_url or slack_channel")
+	case a.WebhookURL != "" && !strings.HasPrefix(a.WebhookURL, "http://") && !strings.HasPrefix(a.WebhookURL, "https://"):
+		return fmt.Errorf("webhook_url must be an http or https URL")
+	case a.SlackChannel != "" && len(a.Approvers) == 0:
+		return fmt.Errorf("approvers are required with slack_channel, so nobody approves their own commands")
+	case a.SlackChannel != "" && a.RequesterSlackID == "":
+		return fmt.Errorf("requester_slack_id is required with slack_channel, so nobody approves their own commands")
+	case a.Timeout < 0:
+		return fmt.Errorf("timeout must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,555 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/policy"
+)
+
+func TestLoad_MissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	cfg, err := Load(path, false)
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+
+	_, err = Load(path, true)
+	assert.Error(t, err)
+}
+
+func TestLoad_OverridesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "limits:\n  max_raw_output_bytes: 1000\n  max_task_history: 5\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, cfg.Limits.MaxRawOutputBytes)
+	assert.Equal(t, 5, cfg.Limits.MaxTaskHistory)
+	// Values not present in the file keep their defaults
+	assert.Equal(t, Default().Limits.MaxDirectoryEntries, cfg.Limits.MaxDirectoryEntries)
+	assert.Equal(t, Default().Limits.MaxFiles, cfg.Limits.MaxFiles)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	negative := filepath.Join(dir, "negative.yaml")
+	assert.NoError(t, os.WriteFile(negative, []byte("limits:\n  max_task_history: -1\n"), 0644))
+	_, err := Load(negative, true)
+	assert.Error(t, err)
+
+	malformed := filepath.Join(dir, "malformed.yaml")
+	assert.NoError(t, os.WriteFile(malformed, []byte("limits: [\n"), 0644))
+	_, err = Load(malformed, true)
+	assert.Error(t, err)
+}
+
+func TestLoad_Workspaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `workspaces:
+  work:
+    directory: /src/company
+    policy: strict
+    model:
+      provider: azure
+      name: gpt-4o
+      url: https://company.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-02-01
+  home:
+    directory: ~/code
+    policy: relaxed
+    model:
+      provider: ollama
+`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"home", "work"}, cfg.WorkspaceNames())
+
+	work, err := cfg.Workspace("work")
+	assert.NoError(t, err)
+	assert.Equal(t, "/src/company", work.Directory)
+	assert.Equal(t, "azure", work.Model.Provider)
+
+	home, err := cfg.Workspace("home")
+	assert.NoError(t, err)
+	homeDir, _ := os.UserHomeDir()
+	assert.Equal(t, filepath.Join(homeDir, "code"), home.Directory)
+	assert.Equal(t, "relaxed", home.Policy)
+
+	_, err = cfg.Workspace("missing")
+	assert.Error(t, err)
+}
+
+func TestLoad_WorkspaceWithoutDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("workspaces:\n  work:\n    policy: strict\n"), 0644))
+
+	_, err := Load(path, true)
+	assert.Error(t, err)
+}
+
+func TestLoad_Prompts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "prompts:\n  dir: ~/prompts\n  versions:\n    bash.command: v2\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "~/prompts", cfg.Prompts.Dir)
+	assert.Equal(t, map[string]string{"bash.command": "v2"}, cfg.Prompts.Versions)
+}
+
+func TestLoad_MCPServers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "mcp_servers:\n  files:\n    command: mcp-server-filesystem\n    args: [/src]\n    env:\n      LOG: debug\n    timeout: 30s\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, MCPServerConfig{
+		Command: "mcp-server-filesystem",
+		Args:    []string{"/src"},
+		Env:     map[string]string{"LOG": "debug"},
+		Timeout: 30 * time.Second,
+	}, cfg.MCPServers["files"])
+
+	for _, invalid := range []string{
+		"mcp_servers:\n  files:\n    args: [/src]\n",
+		"mcp_servers:\n  my.files:\n    command: mcp-server-filesystem\n",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := Load(path, true)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLoad_Webhook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "webhook:\n  url: https://ci.example.com/hooks/aiagent\n  secret_env: AIAGENT_WEBHOOK_SECRET\n  timeout: 5s\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, WebhookConfig{
+		URL:       "https://ci.example.com/hooks/aiagent",
+		SecretEnv: "AIAGENT_WEBHOOK_SECRET",
+		Timeout:   5 * time.Second,
+	}, cfg.Webhook)
+
+	for _, invalid := range []string{
+		"webhook:\n  url: ci.example.com/hooks\n",
+		"webhook:\n  url: https://ci.example.com\n  timeout: -1s\n",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := Load(path, true)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLoad_IssueTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "issue_tracker:\n  type: jira\n  url: https://company.atlassian.net\n  project: OPS\n  user: me@example.com\n  labels: [aiagent]\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, IssueTrackerConfig{
+		Type:    "jira",
+		URL:     "https://company.atlassian.net",
+		Project: "OPS",
+		User:    "me@example.com",
+		Labels:  []string{"aiagent"},
+	}, cfg.IssueTracker)
+
+	for _, invalid := range []string{
+		"issue_tracker:\n  type: trello\n  project: board\n",
+		"issue_tracker:\n  type: github\n",
+		"issue_tracker:\n  type: jira\n  project: OPS\n",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := Load(path, true)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLoad_EmailDigests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `smtp:
+  host: smtp.example.com
+  username: aiagent@example.com
+  password_env: SMTP_PASSWORD
+  from: aiagent <aiagent@example.com>
+email_digests:
+  nightly:
+    to: [team@example.com]
+    subject: Nightly findings
+`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "smtp.example.com", cfg.SMTP.Host)
+	assert.Equal(t, EmailDigestConfig{To: []string{"team@example.com"}, Subject: "Nightly findings"}, cfg.EmailDigests["nightly"])
+
+	for _, invalid := range []string{
+		"smtp:\n  host: smtp.example.com\n  from: a@example.com\nemail_digests:\n  nightly:\n    subject: x\n",
+		"email_digests:\n  nightly:\n    to: [team@example.com]\n",
+		"smtp:\n  port: -1\n",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := Load(path, true)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLoad_ClassifierExamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "classifier:\n  examples:\n    - input: is staging healthy?\n      node: bash\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []RoutingExample{{Input: "is staging healthy?", Node: "bash"}}, cfg.Classifier.Examples)
+
+	assert.NoError(t, os.WriteFile(path, []byte("classifier:\n  examples:\n    - input: is staging healthy?\n"), 0644))
+	_, err = Load(path, true)
+	assert.EqualError(t, err, "invalid config file "+path+": classifier example 1: input and node are required")
+}
+
+func TestLoad_ClassifierRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "classifier:\n  rules:\n    - pattern: (?i)^git status$\n      node: bash\n      command: git status\n  disable_builtin_rules: true\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []RoutingRule{{Pattern: "(?i)^git status$", Node: "bash", Command: "git status"}}, cfg.Classifier.Rules)
+	assert.True(t, cfg.Classifier.DisableBuiltinRules)
+
+	for _, invalid := range []string{
+		"classifier:\n  rules:\n    - pattern: ^ls$\n",
+		"classifier:\n  rules:\n    - pattern: ^(ls$\n      node: bash\n",
+		"classifier:\n  rules:\n    - pattern: ^ls$\n      node: direct_response\n      command: ls\n",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := Load(path, true)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLoad_ClassifierConfidence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("classifier:\n  min_confidence: 0.7\n  low_confidence: second_opinion\n"), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.7, cfg.Classifier.MinConfidence)
+	assert.Equal(t, LowConfidenceSecondOpinion, cfg.Classifier.LowConfidence)
+
+	for _, invalid := range []string{
+		"classifier:\n  min_confidence: 1.5\n",
+		"classifier:\n  low_confidence: guess\n",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := Load(path, true)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLoad_Diagrams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("diagrams: graphviz\n"), 0644))
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, DiagramsGraphviz, cfg.Diagrams)
+
+	assert.NoError(t, os.WriteFile(path, []byte("diagrams: plantuml\n"), 0644))
+	_, err = Load(path, true)
+	assert.ErrorContains(t, err, `unsupported diagrams "plantuml"`)
+}
+
+func TestLoad_Orchestration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`orchestration:
+  enabled: true
+  max_revisions: 2
+  agents:
+    critic:
+      model:
+        provider: ollama
+        name: llama3
+`), 0644))
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.True(t, cfg.Orchestration.Enabled)
+	assert.Equal(t, 2, cfg.Orchestration.MaxRevisions)
+	assert.Equal(t, ModelConfig{Provider: "ollama", Name: "llama3"}, cfg.Orchestration.Agents["critic"].Model)
+
+	assert.NoError(t, os.WriteFile(path, []byte("orchestration:\n  agents:\n    planner:\n      model:\n        provider: openai\n"), 0644))
+	_, err = Load(path, true)
+	assert.ErrorContains(t, err, "orchestration agent planner: model name is required")
+
+	assert.NoError(t, os.WriteFile(path, []byte("orchestration:\n  max_revisions: -2\n"), 0644))
+	_, err = Load(path, true)
+	assert.ErrorContains(t, err, "orchestration max_revisions must be -1 or more")
+}
+
+func TestLoad_ClassifierCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("classifier:\n  cache_ttl: 30s\n"), 0644))
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.Classifier.CacheTTL)
+
+	assert.NoError(t, os.WriteFile(path, []byte("classifier:\n  cache_ttl: -1s\n"), 0644))
+	_, err = Load(path, true)
+	assert.ErrorContains(t, err, "classifier cache_ttl must not be negative")
+}
+
+const profilesConfig = `
+policy: strict
+model:
+  name: gpt-4o
+limits:
+  max_files: 30
+profiles:
+  default:
+    limits:
+      max_task_history: 10
+  offline:
+    model:
+      provider: ollama
+      name: llama3
+    limits:
+      max_file_size: 5000
+  tiny:
+    extends: offline
+    policy: relaxed
+    limits:
+      max_files: 5
+`
+
+func TestLoadProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(profilesConfig), 0644))
+
+	// Without a profile the default profile applies
+	cfg, err := LoadProfile(path, true, "")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultProfile, cfg.Profile)
+	assert.Equal(t, 10, cfg.Limits.MaxTaskHistory)
+	assert.Equal(t, ModelConfig{Name: "gpt-4o"}, cfg.Model)
+
+	cfg, err = LoadProfile(path, true, "tiny")
+	assert.NoError(t, err)
+	assert.Equal(t, "tiny", cfg.Profile)
+	assert.Equal(t, "relaxed", cfg.Policy)
+	assert.Equal(t, ModelConfig{Provider: "ollama", Name: "llama3"}, cfg.Model)
+	assert.Equal(t, 5, cfg.Limits.MaxFiles)
+	assert.Equal(t, int64(5000), cfg.Limits.MaxFileSize, "inherited from offline")
+	assert.Equal(t, Default().Limits.MaxTaskHistory, cfg.Limits.MaxTaskHistory, "the default profile is not applied")
+
+	_, err = LoadProfile(path, true, "online")
+	assert.ErrorContains(t, err, `unknown profile "online" (available: default, offline, tiny)`)
+
+	_, err = LoadProfile(filepath.Join(t.TempDir(), "missing.yaml"), false, "offline")
+	assert.ErrorContains(t, err, "no profiles are configured")
+}
+
+func TestLoadProfile_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		data    string
+		err     string
+	}{
+		{"cycle", "a", "profiles:\n  a:\n    extends: b\n  b:\n    extends: a\n", "profiles extend each other in a cycle: a -> b -> a"},
+		{"unknown base", "a", "profiles:\n  a:\n    extends: b\n", "profile a extends unknown profile b"},
+		{"nested", "a", "profiles:\n  a:\n    profiles:\n      b: {}\n", "profile a: profiles cannot be nested"},
+		{"not a mapping", "a", "profiles:\n  a: strict\n", "profile a: settings must be a mapping"},
+		{"invalid setting", "a", "profiles:\n  a:\n    limits:\n      max_files: -1\n", "limits must not be negative"},
+		{"invalid policy", "a", "profiles:\n  a:\n    policy: yolo\n", `unknown command policy "yolo"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.data), 0644))
+			_, err := LoadProfile(path, true, tt.profile)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"AIAGENT_MODEL":                     "llama3",
+		"AIAGENT_MODEL_PROVIDER":            "ollama",
+		"AIAGENT_PROVIDER":                  "azure", // the full name takes precedence
+		"AIAGENT_POLICY":                    "relaxed",
+		"AIAGENT_LIMITS_MAX_FILES":          "7",
+		"AIAGENT_HTTP_TIMEOUT":              "45s",
+		"AIAGENT_CLASSIFIER_MIN_CONFIDENCE": "0.8",
+		"AIAGENT_CLASSIFIER_DISABLE_CACHE":  "true",
+		"AIAGENT_ISSUE_TRACKER_LABELS":      "bot, triage",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	cfg := Default()
+	assert.NoError(t, cfg.ApplyEnv(lookup))
+	assert.Equal(t, ModelConfig{Provider: "ollama", Name: "llama3"}, cfg.Model)
+	assert.Equal(t, "relaxed", cfg.Policy)
+	assert.Equal(t, 7, cfg.Limits.MaxFiles)
+	assert.Equal(t, Default().Limits.MaxFileSize, cfg.Limits.MaxFileSize)
+	assert.Equal(t, 45*time.Second, cfg.HTTP.Timeout)
+	assert.Equal(t, 0.8, cfg.Classifier.MinConfidence)
+	assert.True(t, cfg.Classifier.DisableCache)
+	assert.Equal(t, []string{"bot", "triage"}, cfg.IssueTracker.Labels)
+
+	env = map[string]string{"AIAGENT_LIMITS_MAX_FILES": "many"}
+	assert.ErrorContains(t, Default().ApplyEnv(lookup), "invalid AIAGENT_LIMITS_MAX_FILES")
+}
+
+func TestExpandAlias(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "aliases:\n" +
+		"  todo-scan: find and summarize all TODO comments\n" +
+		"  callers: find the callers of $1 in $2\n" +
+		"  ask: 'explain $@ (costs in $$)'\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ask", "callers", "todo-scan"}, cfg.AliasNames())
+
+	tests := []struct {
+		name    string
+		args    []string
+		request string
+		err     string
+	}{
+		{"todo-scan", nil, "find and summarize all TODO comments", ""},
+		{"todo-scan", []string{"in pkg/nodes"}, "find and summarize all TODO comments in pkg/nodes", ""},
+		{"callers", []string{"Process", "pkg/nodes"}, "find the callers of Process in pkg/nodes", ""},
+		{"callers", []string{"Process"}, "", "alias @callers is missing argument $2"},
+		{"ask", []string{"the", "cloud", "bill"}, "explain the cloud bill (costs in $)", ""},
+		{"scan", nil, "", "unknown alias @scan (available: ask, callers, todo-scan)"},
+	}
+	for _, tt := range tests {
+		request, err := cfg.ExpandAlias(tt.name, tt.args)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.request, request)
+	}
+
+	for _, invalid := range []string{
+		"aliases:\n  todo scan: find TODOs\n",
+		"aliases:\n  '@todo': find TODOs\n",
+		"aliases:\n  todo: ''\n",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := Load(path, true)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLoad_PII(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("pii:\n  mode: redact\n  kinds: [email, credit_card]\n"), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, PIIConfig{Mode: "redact", Kinds: []string{"email", "credit_card"}}, cfg.PII)
+
+	for _, invalid := range []string{
+		"pii:\n  mode: encrypt\n",
+		"pii:\n  mode: warn\n  kinds: [passport]\n",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := Load(path, true)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLoad_Approval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("approval:\n  rating: dangerous\n  slack_channel: C1\n  approvers: [U1, U2]\n  requester_slack_id: U3\n  timeout: 5m\n"), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, ApprovalConfig{Rating: "dangerous", SlackChannel: "C1", Approvers: []string{"U1", "U2"}, RequesterSlackID: "U3", Timeout: 5 * time.Minute}, cfg.Approval)
+
+	for invalid, message := range map[string]string{
+		"approval:\n  rating: risky\n  webhook_url: https://approvals.example.com\n": `unknown rating "risky"`,
+		"approval:\n  rating: caution\n":                                             "set either webhook_url or slack_channel",
+		"approval:\n  rating: caution\n  webhook_url: approvals.example.com\n":       "must be an http or https URL",
+		"approval:\n  rating: dangerous\n  slack_channel: C1\n":                      "approvers are required",
+		"approval:\n  rating: dangerous\n  slack_channel: C1\n  approvers: [U1]\n":   "requester_slack_id is required",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := Load(path, true)
+		assert.ErrorContains(t, err, message, invalid)
+	}
+}
+
+func TestLoad_PolicyEngine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "policy_engine:\n  rules:\n    - action: command\n      command: '^git push'\n      decision: ask\n  opa:\n    paths: [~/policies]\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []policy.Rule{{Action: "command", Command: "^git push", Decision: "ask"}}, cfg.PolicyEngine.Rules)
+	assert.Equal(t, []string{"~/policies"}, cfg.PolicyEngine.OPA.Paths)
+
+	assert.NoError(t, os.WriteFile(path, []byte("policy_engine:\n  rules:\n    - command: rm\n"), 0644))
+	_, err = Load(path, true)
+	assert.ErrorContains(t, err, `policy_engine: policy rule 1: unknown decision ""`)
+}
+
+func TestLoad_Sandbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "sandbox:\n  egress: allowlist\n  allowed_hosts: [github.com, '*.golang.org']\n"
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, SandboxConfig{Egress: "allowlist", AllowedHosts: []string{"github.com", "*.golang.org"}}, cfg.Sandbox)
+
+	for data, want := range map[string]string{
+		"sandbox:\n  egress: allowlist\n":                           "sandbox: the allowlist egress requires allowed_hosts",
+		"sandbox:\n  egress: none\n  allowed_hosts: [github.com]\n": "sandbox: allowed_hosts requires the allowlist egress",
+		"sandbox:\n  egress: firewall\n":                            `sandbox: unknown egress "firewall"`,
+		"sandbox:\n  env: [GOPATH]\n":                               "sandbox: env requires a user",
+		"sandbox:\n  user: runner\n  env: [GO-PATH]\n":              `sandbox: invalid environment variable name "GO-PATH"`,
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+		_, err = Load(path, true)
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestLoad_Quarantine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("quarantine:\n  enabled: true\n  scope: ['*.go', docs/]\n"), 0644))
+
+	cfg, err := Load(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, QuarantineConfig{Enabled: true, Scope: []string{"*.go", "docs/"}}, cfg.Quarantine)
+
+	assert.NoError(t, os.WriteFile(path, []byte("quarantine:\n  scope: ['[a-']\n"), 0644))
+	_, err = Load(path, true)
+	assert.ErrorContains(t, err, `quarantine: invalid scope pattern "[a-"`)
+}
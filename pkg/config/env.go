@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the names of the environment variables that override settings
+const EnvPrefix = "AIAGENT_"
+
+// envAliases are the short names of frequently set settings by the name of the setting
+// The full name takes precedence when both are set
+var envAliases = map[string]string{
+	"AIAGENT_MODEL_NAME":     "AIAGENT_MODEL",
+	"AIAGENT_MODEL_PROVIDER": "AIAGENT_PROVIDER",
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ApplyEnv overrides the settings of the config with the AIAGENT_* environment variables
+// found by lookup, e.g. os.LookupEnv
+// A variable is named after the path of the setting in the config file: limits.max_files
+// is AIAGENT_LIMITS_MAX_FILES. Lists are separated by commas and durations are written as
+// in the file, e.g. 30s. Named entries, such as workspaces, and lists of entries, such as
+// the routing rules, are only read from the file
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, lookup)
+}
+
+// applyEnv sets the fields of the struct v from the variables starting with prefix
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		key, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, name+"_", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := lookup(name)
+		if alias := envAliases[name]; !ok && alias != "" {
+			value, ok = lookup(alias)
+		}
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(field, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// setEnvValue parses the value of a variable into a setting; settings of other kinds, e.g.
+// maps, cannot be set from the environment and are left unchanged
+func setEnvValue(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	}
+	return nil
+}
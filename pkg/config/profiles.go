@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultProfile is the profile applied when no profile is selected, if the config defines it
+const DefaultProfile = "default"
+
+// profileHeader holds the keys of a profile that are not settings
+type profileHeader struct {
+	// Extends is the profile whose settings the profile overrides
+	Extends string `yaml:"extends"`
+}
+
+// LoadProfile reads the config file at path on top of the defaults and applies the named
+// profile; an empty name applies the default profile if there is one
+// A missing file is not an error unless required is set or a profile is named
+func LoadProfile(path string, required bool, profile string) (*Config, error) {
+	cfg, err := load(path, required)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.applyProfile(profile); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// applyProfile overrides the settings of the config with the settings of a profile and of
+// the profiles it extends, the base profile first
+func (c *Config) applyProfile(name string) error {
+	if name == "" {
+		if _, ok := c.Profiles[DefaultProfile]; !ok {
+			return nil
+		}
+		name = DefaultProfile
+	}
+
+	chain, err := c.profileChain(name)
+	if err != nil {
+		return err
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		profile := c.Profiles[chain[i]]
+		if err := profile.Decode(c); err != nil {
+			return fmt.Errorf("profile %s: %v", chain[i], err)
+		}
+	}
+	c.Profile = name
+	return nil
+}
+
+// profileChain returns the named profile followed by the profiles it extends
+func (c *Config) profileChain(name string) ([]string, error) {
+	var chain []string
+	for name != "" {
+		for _, seen := range chain {
+			if seen == name {
+				return nil, fmt.Errorf("profiles extend each other in a cycle: %s", strings.Join(append(chain, name), " -> "))
+			}
+		}
+		profile, ok := c.Profiles[name]
+		if !ok {
+			if len(chain) > 0 {
+				return nil, fmt.Errorf("profile %s extends unknown profile %s", chain[len(chain)-1], name)
+			}
+			if len(c.Profiles) == 0 {
+				return nil, fmt.Errorf("unknown profile %q: no profiles are configured", name)
+			}
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(c.ProfileNames(), ", "))
+		}
+		if profile.Kind != yaml.MappingNode && profile.Tag != "!!null" {
+			return nil, fmt.Errorf("profile %s: settings must be a mapping", name)
+		}
+
+		var header profileHeader
+		if err := profile.Decode(&header); err != nil {
+			return nil, fmt.Errorf("profile %s: %v", name, err)
+		}
+		for i := 0; i+1 < len(profile.Content); i += 2 {
+			if profile.Content[i].Value == "profiles" {
+				return nil, fmt.Errorf("profile %s: profiles cannot be nested", name)
+			}
+		}
+
+		chain = append(chain, name)
+		name = header.Extends
+	}
+	return chain, nil
+}
+
+// ProfileNames returns the names of all configured profiles in sorted order
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,178 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the SMTP submission port, used with STARTTLS
+const DefaultPort = 587
+
+// implicitTLSPort is the SMTP port speaking TLS from the start
+const implicitTLSPort = 465
+
+// Message is an email with a plain text and an HTML body
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+
+	// Date is the date of the message; zero means now
+	Date time.Time
+}
+
+// Bytes encodes the message as multipart/alternative MIME message
+func (m *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	header := []string{
+		"From: " + m.From,
+		"To: " + strings.Join(m.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date: " + date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/alternative; boundary="` + body.Boundary() + `"`,
+	}
+	var message bytes.Buffer
+	message.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	// The last part is the preferred one
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	message.Write(buf.Bytes())
+	return message.Bytes(), nil
+}
+
+// Sender sends messages through an SMTP server
+type Sender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	// Timeout limits connecting to the server
+	Timeout time.Duration
+}
+
+// NewSender creates a new sender for the SMTP server at host:port; a port of 0 is the
+// submission port. Port 465 speaks TLS from the start, other ports upgrade the connection
+// with STARTTLS when the server offers it. Credentials are only sent over TLS
+func NewSender(host string, port int, username, password string) *Sender {
+	if port == 0 {
+		port = DefaultPort
+	}
+	return &Sender{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		Timeout:  30 * time.Second,
+	}
+}
+
+// Send delivers msg to its recipients
+func (s *Sender) Send(msg *Message) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %v", msg.From, err)
+	}
+	if len(msg.To) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+	recipients := make([]string, len(msg.To))
+	for i, to := range msg.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %v", to, err)
+		}
+		recipients[i] = address.Address
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %v", err)
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	conn, err := net.DialTimeout("tcp", addr, s.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	tlsConfig := &tls.Config{ServerName: s.Host}
+	if s.Port == implicitTLSPort {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && s.Port != implicitTLSPort {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %v", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("RCPT TO %s failed: %v", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA failed: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	return client.Quit()
+}
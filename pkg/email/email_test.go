@@ -0,0 +1,127 @@
+package email
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := &Message{
+		From:    "aiagent <bot@example.com>",
+		To:      []string{"team@example.com", "ops@example.com"},
+		Subject: "Nightly findings – 2 TODOs",
+		Text:    "Found 2 TODOs\n",
+		HTML:    "<p>Found 2 TODOs</p>",
+		Date:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	data, err := msg.Bytes()
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	assert.Equal(t, "team@example.com, ops@example.com", parsed.Header.Get("To"))
+	assert.Equal(t, "Fri, 02 Jan 2026 03:04:05 +0000", parsed.Header.Get("Date"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, msg.Subject, subject)
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, _ := io.ReadAll(part) // quoted-printable is decoded by the reader
+		parts = append(parts, part.Header.Get("Content-Type")+": "+string(content))
+	}
+	assert.Equal(t, []string{
+		"text/plain; charset=utf-8: Found 2 TODOs\r\n",
+		"text/html; charset=utf-8: <p>Found 2 TODOs</p>",
+	}, parts)
+}
+
+// fakeSMTP accepts one message and returns the envelope and the data it received
+func fakeSMTP(t *testing.T) (port int, received chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	received = make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		var transcript strings.Builder
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch command := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); command {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL", "RCPT":
+				transcript.WriteString(line + "\n")
+				reply("250 OK")
+			case "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+					transcript.WriteString(data)
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSend(t *testing.T) {
+	port, received := fakeSMTP(t)
+	sender := NewSender("127.0.0.1", port, "", "")
+	msg := &Message{From: "aiagent <bot@example.com>", To: []string{"Team <team@example.com>"}, Subject: "findings", Text: "text", HTML: "<p>html</p>"}
+
+	require.NoError(t, sender.Send(msg))
+	transcript := <-received
+	assert.True(t, strings.HasPrefix(transcript, "MAIL FROM:<bot@example.com>\nRCPT TO:<team@example.com>\n"), transcript)
+	assert.Contains(t, transcript, "Subject: findings\r\n")
+	assert.Contains(t, transcript, "<p>html</p>")
+}
+
+func TestSend_Invalid(t *testing.T) {
+	sender := NewSender("127.0.0.1", 1, "", "")
+	assert.ErrorContains(t, sender.Send(&Message{From: "not an address", To: []string{"team@example.com"}}), "invalid sender")
+	assert.EqualError(t, sender.Send(&Message{From: "bot@example.com"}), "no recipients")
+	assert.ErrorContains(t, sender.Send(&Message{From: "bot@example.com", To: []string{"team"}}), "invalid recipient")
+	assert.ErrorContains(t, sender.Send(&Message{From: "bot@example.com", To: []string{"team@example.com"}}), "failed to connect to 127.0.0.1:1")
+}
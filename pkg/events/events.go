@@ -0,0 +1,304 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Type identifies the kind of an event
+type Type string
+
+const (
+	TypeRunStarted        Type = "run_started"
+	TypeNodeStarted       Type = "node_started"
+	TypeNodeFinished      Type = "node_finished"
+	TypeCommandProposed   Type = "command_proposed"
+	TypeApprovalRequested Type = "approval_requested"
+	TypeApprovalPending   Type = "approval_pending"
+	TypeApprovalAnswered  Type = "approval_answered"
+	TypeCommandRejected   Type = "command_rejected"
+	TypeCommandExecuted   Type = "command_executed"
+	TypeDecision          Type = "decision"
+	TypeRunFinished       Type = "run_finished"
+)
+
+// Event is a lifecycle event published on the bus
+// Events are passed as pointers to the structs below
+type Event interface {
+	// Type returns the kind of the event
+	Type() Type
+
+	header() *Header
+}
+
+// Header contains the fields shared by all events; they are filled in by Publisher
+type Header struct {
+	RunID string    `json:"run_id"`
+	Time  time.Time `json:"time"`
+}
+
+func (h *Header) header() *Header { return h }
+
+// RunStarted is published when a run begins
+type RunStarted struct {
+	Header
+	Session string `json:"session"`
+	Input   string `json:"input"`
+	Dir     string `json:"dir"`
+}
+
+// NodeStarted is published before a node processes the state
+type NodeStarted struct {
+	Header
+	Node string `json:"node"`
+}
+
+// NodeFinished is published after a node processed the state
+type NodeFinished struct {
+	Header
+	Node     string        `json:"node"`
+	NextNode string        `json:"next_node"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// CommandProposed is published when the LLM generated a command
+type CommandProposed struct {
+	Header
+	Command     string `json:"command"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// ApprovalRequested is published when a proposed command is checked before execution
+type ApprovalRequested struct {
+	Header
+	Command string `json:"command"`
+	Policy  string `json:"policy"`
+}
+
+// ApprovalPending is published when an allowed command waits for an approval
+// The approval is answered with its ID, which is unique within the run
+type ApprovalPending struct {
+	Header
+	ID      string `json:"id"`
+	Command string `json:"command"`
+
+	// Rating is set when a risky command waits for the review of another person
+	Rating string `json:"rating,omitempty"`
+}
+
+// ApprovalAnswered is published when a pending approval was answered
+type ApprovalAnswered struct {
+	Header
+	ID       string `json:"id"`
+	Command  string `json:"command"`
+	Approved bool   `json:"approved"`
+	Error    string `json:"error,omitempty"`
+
+	// By names the person who reviewed a risky command
+	By string `json:"by,omitempty"`
+}
+
+// CommandRejected is published when a proposed command is not allowed to run
+type CommandRejected struct {
+	Header
+	Command string `json:"command"`
+	Reason  string `json:"reason"`
+}
+
+// CommandExecuted is published after a command ran
+type CommandExecuted struct {
+	Header
+	Command  string        `json:"command"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Decision is published when a node made a decision with the LLM, e.g. the classifier
+// chose the next node, with the explanation the LLM gave for it
+type Decision struct {
+	Header
+	Node string `json:"node"`
+
+	// Kind is what was decided, one of the Decision* constants
+	Kind        string `json:"kind"`
+	Choice      string `json:"choice"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// Kinds of decisions
+const (
+	DecisionRoute        = "route"
+	DecisionTaskDone     = "task_done"
+	DecisionGoalMet      = "goal_met"
+	DecisionContentNeeds = "content_needs"
+	DecisionValidation   = "validation"
+	DecisionPlan         = "plan"
+	DecisionReview       = "review"
+)
+
+// RunFinished is published when a run ends
+type RunFinished struct {
+	Header
+	Result   string        `json:"result,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+
+	// Cost is the cost of the run in USD; it is nil when the price of the model is unknown
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+func (*RunStarted) Type() Type        { return TypeRunStarted }
+func (*NodeStarted) Type() Type       { return TypeNodeStarted }
+func (*NodeFinished) Type() Type      { return TypeNodeFinished }
+func (*CommandProposed) Type() Type   { return TypeCommandProposed }
+func (*ApprovalRequested) Type() Type { return TypeApprovalRequested }
+func (*ApprovalPending) Type() Type   { return TypeApprovalPending }
+func (*ApprovalAnswered) Type() Type  { return TypeApprovalAnswered }
+func (*CommandRejected) Type() Type   { return TypeCommandRejected }
+func (*CommandExecuted) Type() Type   { return TypeCommandExecuted }
+func (*Decision) Type() Type          { return TypeDecision }
+func (*RunFinished) Type() Type       { return TypeRunFinished }
+
+// RunID returns the ID of the run an event belongs to
+func RunID(event Event) string {
+	return event.header().RunID
+}
+
+// Time returns the time an event was published
+func Time(event Event) time.Time {
+	return event.header().Time
+}
+
+// Subscriber receives the events published on a bus
+type Subscriber interface {
+	Handle(event Event)
+}
+
+// SubscriberFunc adapts a function to the Subscriber interface
+type SubscriberFunc func(event Event)
+
+// Handle implements the Subscriber interface
+func (f SubscriberFunc) Handle(event Event) { f(event) }
+
+// Bus delivers events to its subscribers
+//
+// Delivery is synchronous and in subscription order, so subscribers see the events of
+// a run in the order they happened; slow subscribers should hand events off to their
+// own goroutine. A panicking subscriber is logged and does not affect the run
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[int]Subscriber
+	order       []int
+	nextID      int
+}
+
+// NewBus creates a new instance of Bus
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[int]Subscriber),
+	}
+}
+
+// Subscribe adds a subscriber and returns a function that removes it
+func (b *Bus) Subscribe(subscriber Subscriber) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = subscriber
+	b.order = append(b.order, id)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+		for i, existing := range b.order {
+			if existing == id {
+				b.order = append(b.order[:i], b.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Publish delivers an event to all subscribers
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	subscribers := make([]Subscriber, 0, len(b.order))
+	for _, id := range b.order {
+		subscribers = append(subscribers, b.subscribers[id])
+	}
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		deliver(subscriber, event)
+	}
+}
+
+// deliver calls a subscriber, recovering from panics
+func deliver(subscriber Subscriber, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Warn("event subscriber panicked", "event", string(event.Type()), "panic", fmt.Sprint(r))
+		}
+	}()
+	subscriber.Handle(event)
+}
+
+// ForRun returns a publisher that stamps events with the run ID
+func (b *Bus) ForRun(runID string) *Publisher {
+	return &Publisher{bus: b, runID: runID}
+}
+
+// Publisher publishes the events of a single run
+// A nil *Publisher drops all events
+type Publisher struct {
+	bus   *Bus
+	runID string
+}
+
+// Publish fills in the event header and publishes the event on the bus
+func (p *Publisher) Publish(event Event) {
+	if p == nil {
+		return
+	}
+
+	h := event.header()
+	if h.RunID == "" {
+		h.RunID = p.runID
+	}
+	if h.Time.IsZero() {
+		h.Time = time.Now()
+	}
+	p.bus.Publish(event)
+}
+
+// jsonLine is the encoding of an event written by JSONLines
+type jsonLine struct {
+	Type  Type  `json:"type"`
+	Event Event `json:"event"`
+}
+
+// JSONLines returns a subscriber writing every event as one JSON object per line
+func JSONLines(w io.Writer) Subscriber {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+	return SubscriberFunc(func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := encoder.Encode(jsonLine{Type: event.Type(), Event: event}); err != nil {
+			slog.Warn("failed to write event", "event", string(event.Type()), "error", err)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus_PublishAndUnsubscribe(t *testing.T) {
+	bus := NewBus()
+
+	var received []Type
+	unsubscribe := bus.Subscribe(SubscriberFunc(func(event Event) {
+		received = append(received, event.Type())
+	}))
+	var second []Type
+	bus.Subscribe(SubscriberFunc(func(event Event) {
+		second = append(second, event.Type())
+	}))
+
+	publisher := bus.ForRun("run-1")
+	publisher.Publish(&RunStarted{Input: "list files"})
+	unsubscribe()
+	publisher.Publish(&RunFinished{Result: "main.go"})
+
+	assert.Equal(t, []Type{TypeRunStarted}, received)
+	assert.Equal(t, []Type{TypeRunStarted, TypeRunFinished}, second)
+}
+
+func TestPublisher_FillsHeader(t *testing.T) {
+	bus := NewBus()
+	var event Event
+	bus.Subscribe(SubscriberFunc(func(e Event) { event = e }))
+
+	bus.ForRun("run-1").Publish(&CommandProposed{Command: "ls"})
+
+	proposed, ok := event.(*CommandProposed)
+	assert.True(t, ok)
+	assert.Equal(t, "run-1", proposed.RunID)
+	assert.False(t, proposed.Time.IsZero())
+	assert.Equal(t, "ls", proposed.Command)
+}
+
+func TestBus_SubscriberPanic(t *testing.T) {
+	bus := NewBus()
+	delivered := false
+	bus.Subscribe(SubscriberFunc(func(event Event) { panic("broken subscriber") }))
+	bus.Subscribe(SubscriberFunc(func(event Event) { delivered = true }))
+
+	assert.NotPanics(t, func() { bus.ForRun("run-1").Publish(&NodeStarted{Node: "bash"}) })
+	assert.True(t, delivered)
+}
+
+func TestPublisher_Nil(t *testing.T) {
+	var publisher *Publisher
+	assert.NotPanics(t, func() { publisher.Publish(&NodeStarted{Node: "bash"}) })
+
+	var bus *Bus
+	assert.NotPanics(t, func() { bus.ForRun("run-1").Publish(&NodeStarted{Node: "bash"}) })
+}
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	bus := NewBus()
+	bus.Subscribe(JSONLines(&buf))
+
+	publisher := bus.ForRun("run-1")
+	publisher.Publish(&ApprovalRequested{Command: "rm -rf /", Policy: "strict"})
+	publisher.Publish(&CommandRejected{Command: "rm -rf /", Reason: "dangerous"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var line struct {
+		Type  Type `json:"type"`
+		Event struct {
+			RunID   string `json:"run_id"`
+			Command string `json:"command"`
+			Policy  string `json:"policy"`
+		} `json:"event"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, TypeApprovalRequested, line.Type)
+	assert.Equal(t, "run-1", line.Event.RunID)
+	assert.Equal(t, "rm -rf /", line.Event.Command)
+	assert.Equal(t, "strict", line.Event.Policy)
+}
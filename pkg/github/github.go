@@ -0,0 +1,188 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the base URL of the GitHub REST API
+const DefaultBaseURL = "https://api.github.com"
+
+// Client calls the GitHub REST API with a token
+type Client struct {
+	Token   string
+	BaseURL string
+	client  *http.Client
+}
+
+// NewClient creates a new instance of Client
+func NewClient(token string) *Client {
+	return &Client{
+		Token:   token,
+		BaseURL: DefaultBaseURL,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Comment is a comment of an issue or pull request
+type Comment struct {
+	ID      int64  `json:"id"`
+	HTMLURL string `json:"html_url"`
+	Body    string `json:"body"`
+}
+
+// CreateComment adds a comment to an issue or pull request of repo ("owner/name")
+func (c *Client) CreateComment(ctx context.Context, repo string, number int, body string) (*Comment, error) {
+	if !strings.Contains(repo, "/") {
+		return nil, fmt.Errorf("invalid repository %q, expected owner/name", repo)
+	}
+	var comment Comment
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number)
+	if err := c.do(ctx, http.MethodPost, path, map[string]string{"body": body}, &comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// Issue is an issue of a repository
+type Issue struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Labels  []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+
+	// PullRequest is set when the issue is a pull request
+	PullRequest *struct{} `json:"pull_request,omitempty"`
+}
+
+// IssueRequest holds the fields of an issue to create or update
+type IssueRequest struct {
+	Title  string   `json:"title,omitempty"`
+	Body   string   `json:"body,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// CreateIssue opens an issue in repo ("owner/name")
+func (c *Client) CreateIssue(ctx context.Context, repo string, request IssueRequest) (*Issue, error) {
+	if !strings.Contains(repo, "/") {
+		return nil, fmt.Errorf("invalid repository %q, expected owner/name", repo)
+	}
+	var issue Issue
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues", repo), request, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+// UpdateIssue changes the fields of request that are set on an issue of repo
+func (c *Client) UpdateIssue(ctx context.Context, repo string, number int, request IssueRequest) (*Issue, error) {
+	if !strings.Contains(repo, "/") {
+		return nil, fmt.Errorf("invalid repository %q, expected owner/name", repo)
+	}
+	var issue Issue
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%d", repo, number), request, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+// OpenIssues returns the most recently updated open issues of repo, up to 100, without
+// pull requests
+func (c *Client) OpenIssues(ctx context.Context, repo string) ([]Issue, error) {
+	if !strings.Contains(repo, "/") {
+		return nil, fmt.Errorf("invalid repository %q, expected owner/name", repo)
+	}
+	query := url.Values{"state": {"open"}, "sort": {"updated"}, "per_page": {"100"}}
+	var all []Issue
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/issues?%s", repo, query.Encode()), nil, &all); err != nil {
+		return nil, err
+	}
+	issues := make([]Issue, 0, len(all))
+	for _, issue := range all {
+		if issue.PullRequest == nil {
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, request, response any) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseURL, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		json.Unmarshal(data, &apiError)
+		return fmt.Errorf("%s %s returned %d: %s", method, path, resp.StatusCode, apiError.Message)
+	}
+	if response != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			return fmt.Errorf("failed to decode response: %v", err)
+		}
+	}
+	return nil
+}
+
+// EventNumber returns the number of the pull request or issue of the event that started a
+// workflow, read from the event file GitHub Actions names in GITHUB_EVENT_PATH
+func EventNumber(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read event: %v", err)
+	}
+	var event struct {
+		Number      int `json:"number"`
+		PullRequest struct {
+			Number int `json:"number"`
+		} `json:"pull_request"`
+		Issue struct {
+			Number int `json:"number"`
+		} `json:"issue"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return 0, fmt.Errorf("failed to decode event: %v", err)
+	}
+	for _, number := range []int{event.PullRequest.Number, event.Issue.Number, event.Number} {
+		if number > 0 {
+			return number, nil
+		}
+	}
+	return 0, fmt.Errorf("the event is not about a pull request or issue")
+}
@@ -0,0 +1,70 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateComment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		if r.URL.Path != "/repos/owner/repo/issues/7/comments" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+			return
+		}
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id": 1, "html_url": "https://github.com/owner/repo/pull/7#issuecomment-1", "body": %q}`, request["body"])
+	}))
+	defer server.Close()
+
+	client := NewClient("token")
+	client.BaseURL = server.URL
+
+	comment, err := client.CreateComment(context.Background(), "owner/repo", 7, "report")
+	assert.NoError(t, err)
+	assert.Equal(t, &Comment{ID: 1, HTMLURL: "https://github.com/owner/repo/pull/7#issuecomment-1", Body: "report"}, comment)
+
+	_, err = client.CreateComment(context.Background(), "owner/other", 7, "report")
+	assert.EqualError(t, err, "POST /repos/owner/other/issues/7/comments returned 404: Not Found")
+
+	_, err = client.CreateComment(context.Background(), "repo", 7, "report")
+	assert.EqualError(t, err, `invalid repository "repo", expected owner/name`)
+}
+
+func TestEventNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   string
+		want    int
+		wantErr bool
+	}{
+		{name: "pull request", event: `{"number": 3, "pull_request": {"number": 3}}`, want: 3},
+		{name: "issue comment", event: `{"issue": {"number": 5}}`, want: 5},
+		{name: "push", event: `{"ref": "refs/heads/main"}`, wantErr: true},
+		{name: "invalid", event: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "event.json")
+			os.WriteFile(path, []byte(tt.event), 0644)
+			got, err := EventNumber(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
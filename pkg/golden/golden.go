@@ -0,0 +1,55 @@
+package golden
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// update rewrites the golden files instead of comparing against them:
+//
+//	go test ./pkg/nodes -update
+var update = flag.Bool("update", false, "Rewrite golden files with the actual output")
+
+// ansiEscape matches ANSI escape sequences such as colors and cursor movements
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// Path returns the golden file of a test: testdata/golden/<name>.golden
+func Path(name string) string {
+	return filepath.Join("testdata", "golden", name+".golden")
+}
+
+// Assert compares got with the golden file of name after applying the transforms,
+// e.g. StripANSI; with -update the golden file is written instead
+func Assert(t testing.TB, name, got string, transforms ...func(string) string) bool {
+	t.Helper()
+	for _, transform := range transforms {
+		got = transform(got)
+	}
+
+	path := Path(name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return true
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run the test with -update to create it): %v", err)
+	}
+	return assert.Equal(t, string(want), got, "output differs from %s (run the test with -update to accept it)", path)
+}
+
+// StripANSI removes ANSI escape sequences, so colored terminal output can be compared
+func StripANSI(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
@@ -0,0 +1,34 @@
+package golden
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripANSI(t *testing.T) {
+	assert.Equal(t, "error: failed\n", StripANSI("\x1b[1;31merror:\x1b[0m failed\n"))
+	assert.Equal(t, "plain", StripANSI("plain"))
+}
+
+func TestAssert(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join("testdata", "golden"), 0755))
+	assert.NoError(t, os.WriteFile(Path("greeting"), []byte("HELLO\n"), 0644))
+	assert.True(t, Assert(t, "greeting", "\x1b[32mhello\x1b[0m\n", StripANSI, strings.ToUpper))
+
+	*update = true
+	defer func() { *update = false }()
+	assert.True(t, Assert(t, "created", "new output"))
+	written, err := os.ReadFile(Path("created"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new output", string(written))
+}
@@ -0,0 +1,248 @@
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"aiagent/pkg/schema"
+	"aiagent/pkg/storage"
+	"aiagent/pkg/truncate"
+)
+
+const (
+	// DirName is the folder where the agent keeps its local data
+	DirName = ".aiagent"
+
+	// SessionsCollection is the storage collection holding sessions
+	SessionsCollection = "sessions"
+
+	// DefaultSession is the name of the session used when none is specified
+	DefaultSession = "default"
+
+	// SessionSchemaVersion is the current schema version of persisted sessions
+	SessionSchemaVersion = 1
+
+	// maxResultLength is the maximum length of a result included in a summary
+	maxResultLength = 500
+)
+
+// sessionNamePattern restricts session names to safe storage keys
+var sessionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Migrations upgrades sessions written by older versions of the agent
+// Register a migration here whenever SessionSchemaVersion is increased
+var Migrations = schema.NewMigrator("session", SessionSchemaVersion)
+
+// Entry represents a single completed run of the agent
+type Entry struct {
+	RunID  string    `json:"run_id,omitempty"`
+	Input  string    `json:"input"`
+	Result string    `json:"result"`
+	Time   time.Time `json:"time"`
+}
+
+// Session represents a named conversation made of consecutive runs
+type Session struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Entries       []Entry   `json:"entries"`
+}
+
+// Store persists sessions in a storage backend
+type Store struct {
+	store storage.Store
+}
+
+// NewStore creates a new session store on top of the given storage
+func NewStore(store storage.Store) *Store {
+	return &Store{
+		store: store,
+	}
+}
+
+// DataDir returns the directory holding the agent's data for the given root
+// The root is either a working directory (per-directory data)
+// or the user's home directory (per-user data)
+func DataDir(rootDir string) string {
+	return filepath.Join(rootDir, DirName)
+}
+
+// UserDataDir returns the data directory shared by all directories of the current user
+func UserDataDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return DataDir(home), nil
+}
+
+// ValidateSessionName checks that a session name can be safely used as a storage key
+func ValidateSessionName(name string) error {
+	if !sessionNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid session name %q (use letters, digits, '-' and '_', up to 64 characters)", name)
+	}
+	return nil
+}
+
+// Get loads the named session
+// A session that does not exist yet is returned empty, without an ID
+func (s *Store) Get(name string) (*Session, error) {
+	if err := ValidateSessionName(name); err != nil {
+		return nil, err
+	}
+
+	var raw json.RawMessage
+	if err := s.store.Get(SessionsCollection, name, &raw); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return &Session{SchemaVersion: SessionSchemaVersion, Name: name, Entries: []Entry{}}, nil
+		}
+		return nil, fmt.Errorf("failed to load session %s: %v", name, err)
+	}
+
+	var session Session
+	if err := Migrations.Decode(raw, &session); err != nil {
+		return nil, fmt.Errorf("failed to load session %s: %v", name, err)
+	}
+
+	return &session, nil
+}
+
+// Load reads all entries of the named session, oldest first
+func (s *Store) Load(name string) ([]Entry, error) {
+	session, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return session.Entries, nil
+}
+
+// Append adds an entry to the named session, creating the session if needed
+func (s *Store) Append(name string, entry Entry) error {
+	session, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if session.ID == "" {
+		session.ID = newSessionID()
+		session.CreatedAt = entry.Time
+	}
+	session.SchemaVersion = SessionSchemaVersion
+	session.UpdatedAt = entry.Time
+	session.Entries = append(session.Entries, entry)
+
+	if err := s.store.Put(SessionsCollection, name, session); err != nil {
+		return fmt.Errorf("failed to save session %s: %v", name, err)
+	}
+	return nil
+}
+
+// List returns all stored sessions, most recently updated first
+func (s *Store) List() ([]*Session, error) {
+	records, err := s.store.List(SessionsCollection, storage.Query{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+
+	sessions := make([]*Session, 0, len(records))
+	for _, record := range records {
+		var session Session
+		if err := Migrations.Decode(record.Value, &session); err != nil {
+			return nil, fmt.Errorf("failed to load session %s: %v", record.Key, err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+// Delete removes the named session
+func (s *Store) Delete(name string) error {
+	if err := ValidateSessionName(name); err != nil {
+		return err
+	}
+
+	if err := s.store.Delete(SessionsCollection, name); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("session %s does not exist", name)
+		}
+		return fmt.Errorf("failed to delete session %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// Expire deletes all sessions that have not been updated within maxAge
+// It returns the names of the deleted sessions
+func (s *Store) Expire(maxAge time.Duration) ([]string, error) {
+	sessions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	expired := []string{}
+	for _, session := range sessions {
+		if session.UpdatedAt.After(cutoff) {
+			continue
+		}
+		if err := s.Delete(session.Name); err != nil {
+			return expired, err
+		}
+		expired = append(expired, session.Name)
+	}
+
+	return expired, nil
+}
+
+// newSessionID generates a random session identifier
+func newSessionID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Summarize builds a compact description of the most recent entries
+// suitable for injecting into a prompt as conversation context
+func Summarize(entries []Entry, maxEntries int) string {
+	if len(entries) == 0 {
+		return ""
+	}
+
+	if maxEntries > 0 && len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Previous requests in this session (oldest first):\n")
+	for i, entry := range entries {
+		result := strings.TrimSpace(entry.Result)
+		if len(result) > maxResultLength {
+			result = truncate.Tail(result, maxResultLength) + "... [truncated]"
+		}
+		sb.WriteString(fmt.Sprintf("%d. Request: %s\n   Result: %s\n", i+1, entry.Input, result))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,119 @@
+package history
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/storage"
+)
+
+func TestStore_AppendAndLoad(t *testing.T) {
+	store := NewStore(storage.NewFileStore(t.TempDir()))
+
+	entries, err := store.Load(DefaultSession)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.NoError(t, store.Append(DefaultSession, Entry{Input: "list go files", Result: "main.go"}))
+	assert.NoError(t, store.Append(DefaultSession, Entry{Input: "now do the same for the tests directory", Result: "main_test.go"}))
+
+	entries, err = store.Load(DefaultSession)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "list go files", entries[0].Input)
+	assert.Equal(t, "main_test.go", entries[1].Result)
+	assert.False(t, entries[0].Time.IsZero())
+
+	session, err := store.Get(DefaultSession)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, session.ID)
+	assert.Equal(t, DefaultSession, session.Name)
+}
+
+func TestStore_Sessions(t *testing.T) {
+	store := NewStore(storage.NewFileStore(t.TempDir()))
+	old := time.Now().Add(-48 * time.Hour)
+
+	assert.NoError(t, store.Append("work", Entry{Input: "build", Result: "ok"}))
+	assert.NoError(t, store.Append("stale", Entry{Input: "old request", Result: "done", Time: old}))
+
+	// Sessions are independent of each other
+	entries, err := store.Load("work")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "build", entries[0].Input)
+
+	sessions, err := store.List()
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, "work", sessions[0].Name)
+	assert.Equal(t, "stale", sessions[1].Name)
+
+	expired, err := store.Expire(24 * time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stale"}, expired)
+
+	assert.NoError(t, store.Delete("work"))
+	assert.Error(t, store.Delete("work"))
+
+	sessions, err = store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestValidateSessionName(t *testing.T) {
+	assert.NoError(t, ValidateSessionName("feature-42_x"))
+	assert.Error(t, ValidateSessionName(""))
+	assert.Error(t, ValidateSessionName("../escape"))
+	assert.Error(t, ValidateSessionName("with space"))
+}
+
+func TestSummarize(t *testing.T) {
+	assert.Equal(t, "", Summarize(nil, 5))
+
+	entries := []Entry{
+		{Input: "first", Result: "one"},
+		{Input: "second", Result: "two"},
+		{Input: "third", Result: strings.Repeat("x", maxResultLength+10)},
+	}
+
+	summary := Summarize(entries, 2)
+	assert.NotContains(t, summary, "Request: first")
+	assert.Contains(t, summary, "1. Request: second")
+	assert.Contains(t, summary, "2. Request: third")
+	assert.Contains(t, summary, "... [truncated]")
+
+	// Results are not cut in the middle of a character
+	entries = []Entry{{Input: "translate", Result: "x" + strings.Repeat("ü", maxResultLength)}}
+	summary = Summarize(entries, 1)
+	assert.True(t, utf8.ValidString(summary))
+	assert.Contains(t, summary, "x"+strings.Repeat("ü", (maxResultLength-1)/2)+"... [truncated]")
+}
+
+func TestStore_LegacySession(t *testing.T) {
+	backend := storage.NewFileStore(t.TempDir())
+	store := NewStore(backend)
+
+	// Sessions written before schema versioning have no schema_version field
+	legacy := map[string]any{
+		"id":      "abc",
+		"name":    "legacy",
+		"entries": []map[string]any{{"input": "list files", "result": "main.go"}},
+	}
+	assert.NoError(t, backend.Put(SessionsCollection, "legacy", legacy))
+
+	session, err := store.Get("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, SessionSchemaVersion, session.SchemaVersion)
+	assert.Equal(t, "abc", session.ID)
+	assert.Len(t, session.Entries, 1)
+
+	// Sessions written by a newer version of the agent are not silently misread
+	assert.NoError(t, backend.Put(SessionsCollection, "future", map[string]any{"schema_version": SessionSchemaVersion + 1}))
+	_, err = store.Get("future")
+	assert.Error(t, err)
+}
@@ -0,0 +1,202 @@
+package htmlreport
+
+import (
+	"html"
+	"html/template"
+	"strings"
+	"unicode"
+)
+
+// language describes the tokens of a programming language for highlighting
+type language struct {
+	keywords     map[string]bool
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+
+	// multilineQuotes are the quotes of strings that may span lines, e.g. Go raw strings
+	multilineQuotes string
+}
+
+func words(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(list) {
+		set[word] = true
+	}
+	return set
+}
+
+var (
+	goLanguage = &language{
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var nil true false iota
+			string int int64 int32 uint byte rune bool error float64 any`),
+		lineComments:    []string{"//"},
+		blockComment:    [2]string{"/*", "*/"},
+		quotes:          `"'`,
+		multilineQuotes: "`",
+	}
+	pythonLanguage = &language{
+		keywords: words(`and as assert async await break class continue def del elif else except finally
+			for from global if import in is lambda nonlocal not or pass raise return try while with yield
+			None True False self`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	}
+	jsLanguage = &language{
+		keywords: words(`async await break case catch class const continue default delete do else export
+			extends finally for function if import in instanceof let new of return switch this throw try
+			typeof var void while yield null undefined true false interface type`),
+		lineComments:    []string{"//"},
+		blockComment:    [2]string{"/*", "*/"},
+		quotes:          `"'`,
+		multilineQuotes: "`",
+	}
+	shellLanguage = &language{
+		keywords: words(`if then else elif fi for while until do done case esac in function return export
+			local sudo cd echo cat grep sed awk find ls rm cp mv mkdir git go make docker kubectl`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	}
+	jsonLanguage = &language{
+		keywords: words(`true false null`),
+		quotes:   `"`,
+	}
+	yamlLanguage = &language{
+		keywords:     words(`true false null yes no`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	}
+	sqlLanguage = &language{
+		keywords: words(`select from where and or not insert into values update set delete create table
+			drop alter index join left right inner outer on group by order having limit as null is in
+			SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER
+			INDEX JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT AS NULL IS IN`),
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `'"`,
+	}
+)
+
+// languages maps the names used in code fences to languages
+var languages = map[string]*language{
+	"go":         goLanguage,
+	"golang":     goLanguage,
+	"python":     pythonLanguage,
+	"py":         pythonLanguage,
+	"javascript": jsLanguage,
+	"js":         jsLanguage,
+	"typescript": jsLanguage,
+	"ts":         jsLanguage,
+	"bash":       shellLanguage,
+	"sh":         shellLanguage,
+	"shell":      shellLanguage,
+	"console":    shellLanguage,
+	"json":       jsonLanguage,
+	"yaml":       yamlLanguage,
+	"yml":        yamlLanguage,
+	"sql":        sqlLanguage,
+}
+
+// Highlight renders code as HTML with spans for keywords (kw), strings (str), comments
+// (com) and numbers (num); code of an unknown language is only escaped
+func Highlight(code, lang string) template.HTML {
+	spec, ok := languages[strings.ToLower(lang)]
+	if !ok {
+		return template.HTML(html.EscapeString(code))
+	}
+
+	var sb strings.Builder
+	span := func(class, text string) {
+		sb.WriteString(`<span class="` + class + `">` + html.EscapeString(text) + `</span>`)
+	}
+	for i := 0; i < len(code); {
+		rest := code[i:]
+
+		if n := spec.comment(rest, i == 0 || isSpace(code[i-1])); n > 0 {
+			span("com", rest[:n])
+			i += n
+			continue
+		}
+		if n := spec.quoted(rest); n > 0 {
+			span("str", rest[:n])
+			i += n
+			continue
+		}
+		if c := rune(rest[0]); c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+			n := strings.IndexFunc(rest, func(r rune) bool { return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+			if n < 0 {
+				n = len(rest)
+			}
+			word := rest[:n]
+			// Words after a dot are fields or file extensions, e.g. "main.go"
+			wordStart := i == 0 || !isWordByte(code[i-1]) && code[i-1] != '.'
+			switch {
+			case wordStart && spec.keywords[word]:
+				span("kw", word)
+			case wordStart && unicode.IsDigit(c):
+				span("num", word)
+			default:
+				sb.WriteString(html.EscapeString(word))
+			}
+			i += n
+			continue
+		}
+
+		n := 1
+		for n < len(rest) && rest[n]&0xc0 == 0x80 {
+			n++ // keep multi-byte characters together
+		}
+		sb.WriteString(html.EscapeString(rest[:n]))
+		i += n
+	}
+	return template.HTML(sb.String())
+}
+
+// comment returns the length of the comment at the start of text, or 0
+func (l *language) comment(text string, afterSpace bool) int {
+	for _, prefix := range l.lineComments {
+		// "#" starts a comment only after a space, unlike in "$#" or "a#b"
+		if strings.HasPrefix(text, prefix) && (prefix != "#" || afterSpace) {
+			if end := strings.IndexByte(text, '\n'); end >= 0 {
+				return end
+			}
+			return len(text)
+		}
+	}
+	if open := l.blockComment[0]; open != "" && strings.HasPrefix(text, open) {
+		if end := strings.Index(text[len(open):], l.blockComment[1]); end >= 0 {
+			return len(open) + end + len(l.blockComment[1])
+		}
+		return len(text)
+	}
+	return 0
+}
+
+// quoted returns the length of the string literal at the start of text, or 0
+func (l *language) quoted(text string) int {
+	quote := text[0]
+	multiline := strings.IndexByte(l.multilineQuotes, quote) >= 0
+	if !multiline && strings.IndexByte(l.quotes, quote) < 0 {
+		return 0
+	}
+	for i := 1; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && !multiline:
+			i++
+		case text[i] == quote:
+			return i + 1
+		case text[i] == '\n' && !multiline:
+			return i
+		}
+	}
+	return len(text)
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n'
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= 0x80 || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
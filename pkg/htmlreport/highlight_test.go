@@ -0,0 +1,31 @@
+package htmlreport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		lang string
+		want string
+	}{
+		{"go", `if x := 42; x > "a" { // done`, "go",
+			`<span class="kw">if</span> x := <span class="num">42</span>; x &gt; <span class="str">&#34;a&#34;</span> { <span class="com">// done</span>`},
+		{"keywords inside words", "format(ifx)", "go", "format(ifx)"},
+		{"raw string", "`a\nb`", "go", "<span class=\"str\">`a\nb`</span>"},
+		{"block comment", "/* a */ b", "js", `<span class="com">/* a */</span> b`},
+		{"escaped quote", `"a\"b" c`, "python", `<span class="str">&#34;a\&#34;b&#34;</span> c`},
+		{"shell comment", "echo $# # count", "bash", `<span class="kw">echo</span> $# <span class="com"># count</span>`},
+		{"unknown language", "<x> if", "cobol", "&lt;x&gt; if"},
+		{"unicode", "x := \"é\" // ü", "go", `x := <span class="str">&#34;é&#34;</span> <span class="com">// ü</span>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(Highlight(tt.code, tt.lang)))
+		})
+	}
+}
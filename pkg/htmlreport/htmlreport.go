@@ -0,0 +1,190 @@
+package htmlreport
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"aiagent/pkg/report"
+	"aiagent/pkg/transcript"
+)
+
+// command is a command of the run shown in the report
+type command struct {
+	Node     string
+	Command  string
+	Output   string
+	Error    string
+	Rejected bool
+}
+
+// document is the data of the report template
+type document struct {
+	*transcript.Transcript
+	Duration  time.Duration
+	Commands  []command
+	Generator string
+}
+
+// Render writes a run as a standalone HTML page to share: the request, the result, e.g.
+// an analysis, rendered from Markdown, the execution report and the commands with their
+// output; secrets are redacted. generator names the program in the footer
+func Render(w io.Writer, t *transcript.Transcript, generator string) error {
+	t = t.Redacted()
+	doc := document{Transcript: t, Generator: generator}
+	if !t.FinishedAt.IsZero() {
+		doc.Duration = t.FinishedAt.Sub(t.StartedAt)
+	}
+	for _, step := range t.Steps {
+		if step.Kind == transcript.StepCommand {
+			doc.Commands = append(doc.Commands, command{
+				Node:     string(step.Node),
+				Command:  step.Command,
+				Output:   step.Output,
+				Error:    step.Error,
+				Rejected: step.Rejected,
+			})
+		}
+	}
+	if err := pageTemplate.Execute(w, doc); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	return nil
+}
+
+// duration rounds durations to a readable precision
+func duration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	default:
+		return d.Round(time.Millisecond).String()
+	}
+}
+
+// tokens formats the tokens of a node visit
+func tokens(visit report.NodeVisit) string {
+	if visit.InputTokens == 0 && visit.OutputTokens == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d / %d", visit.InputTokens, visit.OutputTokens)
+}
+
+var pageTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"markdown":  Markdown,
+	"highlight": Highlight,
+	"duration":  duration,
+	"tokens":    tokens,
+	"inc":       func(i int) int { return i + 1 },
+	"totals": func(r *report.Report) string {
+		input, output := r.Tokens()
+		return fmt.Sprintf("%d LLM call(s), %d / %d tokens", r.LLMCalls(), input, output)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="Content-Security-Policy" content="default-src 'none'; style-src 'unsafe-inline'">
+<title>aiagent report: {{.Input}}</title>
+<style>
+body { font: 15px/1.6 system-ui, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+h1 { font-size: 1.6em; margin-bottom: 0.2em; }
+.meta { color: #656d76; margin: 0 0 2em; padding: 0; list-style: none; }
+.meta li { display: inline; margin-right: 1.5em; }
+.status-completed { color: #1a7f37; }
+.status-failed { color: #cf222e; }
+.request { background: #f6f8fa; border-left: 4px solid #0969da; padding: 0.5em 1em; white-space: pre-wrap; }
+pre { background: #f6f8fa; border: 1px solid #d0d7de; border-radius: 6px; padding: 0.8em 1em; overflow-x: auto; white-space: pre-wrap; word-wrap: break-word; font-size: 13px; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; }
+p code, li code, td code { background: #eff1f3; padding: 0.1em 0.3em; border-radius: 4px; }
+table { border-collapse: collapse; width: 100%; margin: 1em 0; font-size: 14px; }
+th, td { border: 1px solid #d0d7de; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+td.number { text-align: right; white-space: nowrap; }
+blockquote { border-left: 4px solid #d0d7de; margin: 0; padding: 0 1em; color: #656d76; }
+.error { color: #cf222e; white-space: pre-wrap; }
+.command h3 { font-size: 1em; margin-bottom: 0.3em; }
+.rejected { color: #9a6700; }
+.kw { color: #cf222e; }
+.str { color: #0a3069; }
+.com { color: #6e7781; font-style: italic; }
+.num { color: #0550ae; }
+footer { margin-top: 3em; color: #656d76; font-size: 13px; }
+@media print {
+  body { margin: 0; max-width: none; }
+  pre { page-break-inside: avoid; }
+}
+</style>
+</head>
+<body>
+<h1>{{.Input}}</h1>
+<ul class="meta">
+<li class="status-{{.Status}}">{{.Status}}</li>
+<li>Run {{.RunID}}</li>
+<li>{{.StartedAt.Format "2006-01-02 15:04:05 MST"}}</li>
+{{- if .Duration}}
+<li>{{duration .Duration}}</li>
+{{- end}}
+{{- with .Report}}
+<li>Model {{.Model}}</li>
+{{- if .CostKnown}}
+<li>Cost ${{printf "%.4f" .Cost}}</li>
+{{- end}}
+{{- end}}
+</ul>
+
+<h2>Request</h2>
+<div class="request">{{.Input}}</div>
+
+<h2>Result</h2>
+{{- if .Error}}
+<p class="error">{{.Error}}</p>
+{{- else}}
+{{markdown .Result}}
+{{- end}}
+
+{{- with .Report}}
+<h2>Execution report</h2>
+<table>
+<thead><tr><th>#</th><th>Node</th><th>Time</th><th>LLM calls</th><th>Tokens in / out</th><th>Commands</th></tr></thead>
+<tbody>
+{{- range $i, $visit := .Visits}}
+<tr>
+<td class="number">{{inc $i}}</td>
+<td>{{$visit.Node}}</td>
+<td class="number">{{duration $visit.Duration}}</td>
+<td class="number">{{$visit.LLMCalls}}</td>
+<td class="number">{{tokens $visit}}</td>
+<td>
+{{- range $visit.Commands}}<code>{{.Command}}</code> (exit {{.ExitCode}}, {{duration .Duration}})<br>{{end}}
+{{- if $visit.Error}}<span class="error">{{$visit.Error}}</span>{{end -}}
+</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+<p>{{len .Visits}} node(s), {{totals .}}</p>
+{{- end}}
+
+{{- if .Commands}}
+<h2>Commands</h2>
+{{- range .Commands}}
+<div class="command">
+<h3>{{.Node}}{{if .Rejected}} <span class="rejected">(rejected)</span>{{end}}</h3>
+<pre><code class="language-bash">{{highlight .Command "bash"}}</code></pre>
+{{- if .Output}}
+<pre>{{.Output}}</pre>
+{{- end}}
+{{- if .Error}}
+<p class="error">{{.Error}}</p>
+{{- end}}
+</div>
+{{- end}}
+{{- end}}
+
+<footer>Generated by {{.Generator}}</footer>
+</body>
+</html>
+`))
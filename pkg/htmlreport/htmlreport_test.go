@@ -0,0 +1,82 @@
+package htmlreport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/report"
+	"aiagent/pkg/transcript"
+)
+
+func testTranscript() *transcript.Transcript {
+	t := transcript.New("20260101-120000-a1b2c3", "analyze <main.go>")
+	t.StartedAt = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	t.AddStep(transcript.Step{Kind: transcript.StepCommand, Node: nodes.NodeTypeBash, Command: "cat main.go", Output: "package main\n"})
+	t.AddStep(transcript.Step{Kind: transcript.StepCommand, Node: nodes.NodeTypeBash, Command: "rm -rf /", Rejected: true, Error: "not allowed"})
+	t.Finish("## Findings\n\n- uses `os.Exit`\n\n```go\nfunc main() {}\n```\n\nkey sk-abcdefghijklmnopqrstuvwxyz", nil)
+	t.FinishedAt = t.StartedAt.Add(2 * time.Second)
+	t.Report = &report.Report{
+		Model: "gpt-4o-mini",
+		Visits: []report.NodeVisit{
+			{Node: "bash", Duration: 1500 * time.Millisecond, LLMCalls: 1, InputTokens: 100, OutputTokens: 20,
+				Commands: []report.Command{{Command: "cat main.go", Duration: 5 * time.Millisecond}}},
+		},
+		Cost:      0.0012,
+		CostKnown: true,
+	}
+	return t
+}
+
+func TestRender(t *testing.T) {
+	var sb strings.Builder
+	require.NoError(t, Render(&sb, testTranscript(), "aiagent test"))
+	page := sb.String()
+
+	assert.Contains(t, page, "<h1>analyze &lt;main.go&gt;</h1>")
+	assert.Contains(t, page, "<li>2s</li>")
+	assert.Contains(t, page, "<li>Cost $0.0012</li>")
+	assert.Contains(t, page, "<h2>Findings</h2>")
+	assert.Contains(t, page, `<span class="kw">func</span> main()`)
+	assert.Contains(t, page, "<td>bash</td>")
+	assert.Contains(t, page, "<td class=\"number\">100 / 20</td>")
+	assert.Contains(t, page, "1 node(s), 1 LLM call(s), 100 / 20 tokens")
+	assert.Contains(t, page, `<span class="kw">cat</span> main.go`)
+	assert.Contains(t, page, "<pre>package main\n</pre>")
+	assert.Contains(t, page, `<span class="rejected">(rejected)</span>`)
+	assert.Contains(t, page, "Generated by aiagent test")
+	assert.NotContains(t, page, "sk-abcdefghijklmnopqrstuvwxyz")
+}
+
+func TestRender_Failed(t *testing.T) {
+	tr := transcript.New("run-1", "list files")
+	tr.Finish("", errors.New("error in node bash"))
+
+	var sb strings.Builder
+	require.NoError(t, Render(&sb, tr, "aiagent"))
+	assert.Contains(t, sb.String(), `<p class="error">error in node bash</p>`)
+	assert.NotContains(t, sb.String(), "Execution report")
+	assert.NotContains(t, sb.String(), "<h2>Commands</h2>")
+}
+
+func TestPDF(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	output := filepath.Join(t.TempDir(), "report.pdf")
+	assert.ErrorIs(t, PDF([]byte("<html></html>"), output), ErrNoConverter)
+
+	// A fake wkhtmltopdf copies the page to the output
+	script := "#!/bin/sh\nread -r line < \"$3\"\nprintf '%s\\n' \"$line\" > \"$4\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "wkhtmltopdf"), []byte(script), 0700))
+	require.NoError(t, PDF([]byte("<html></html>"), output))
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "<html></html>\n", string(data))
+}
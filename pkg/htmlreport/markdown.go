@@ -0,0 +1,156 @@
+package htmlreport
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// Inline Markdown applied to escaped text
+var (
+	boldPattern = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	linkPattern = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^\s)]+)\)`)
+
+	headingPattern  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	listPattern     = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+(.*)$`)
+	ruleLine        = regexp.MustCompile(`^\s*([-*_])(\s*([-*_])){2,}\s*$`)
+	tableSeparator  = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+	orderedListItem = regexp.MustCompile(`^\s*\d+[.)]`)
+)
+
+// Markdown renders the Markdown written by the LLM as HTML: headings, paragraphs, lists,
+// block quotes, tables and code blocks, which are highlighted; all text is escaped, so
+// the output is safe to embed
+func Markdown(text string) template.HTML {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var sb strings.Builder
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			sb.WriteString("<p>" + inline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			fence := trimmed[:3]
+			lang := strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1]))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			sb.WriteString(codeBlock(strings.Join(code, "\n"), lang))
+
+		case headingPattern.MatchString(trimmed):
+			flush()
+			match := headingPattern.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(match[1])))
+			sb.WriteString("<h" + level + ">" + inline(strings.TrimRight(match[2], "# ")) + "</h" + level + ">\n")
+
+		case ruleLine.MatchString(trimmed):
+			flush()
+			sb.WriteString("<hr>\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+			}
+			i--
+			sb.WriteString("<blockquote>" + string(Markdown(strings.Join(quote, "\n"))) + "</blockquote>\n")
+
+		case listPattern.MatchString(line):
+			flush()
+			tag := "ul"
+			if orderedListItem.MatchString(line) {
+				tag = "ol"
+			}
+			sb.WriteString("<" + tag + ">\n")
+			for ; i < len(lines) && listPattern.MatchString(lines[i]); i++ {
+				sb.WriteString("<li>" + inline(listPattern.FindStringSubmatch(lines[i])[2]) + "</li>\n")
+			}
+			i--
+			sb.WriteString("</" + tag + ">\n")
+
+		case strings.Contains(trimmed, "|") && i+1 < len(lines) && tableSeparator.MatchString(lines[i+1]):
+			flush()
+			sb.WriteString("<table>\n<thead><tr>")
+			for _, cell := range tableCells(trimmed) {
+				sb.WriteString("<th>" + inline(cell) + "</th>")
+			}
+			sb.WriteString("</tr></thead>\n<tbody>\n")
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|"); i++ {
+				sb.WriteString("<tr>")
+				for _, cell := range tableCells(lines[i]) {
+					sb.WriteString("<td>" + inline(cell) + "</td>")
+				}
+				sb.WriteString("</tr>\n")
+			}
+			i--
+			sb.WriteString("</tbody>\n</table>\n")
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return template.HTML(sb.String())
+}
+
+// codeBlock renders a highlighted code block
+func codeBlock(code, lang string) string {
+	class := ""
+	if lang != "" {
+		class = ` class="language-` + html.EscapeString(lang) + `"`
+	}
+	return "<pre><code" + class + ">" + string(Highlight(code, lang)) + "</code></pre>\n"
+}
+
+// tableCells splits a table row into its cells
+func tableCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+	cells := strings.Split(row, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// inline renders code spans, bold text and links; the rest of the text is escaped
+func inline(text string) string {
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(text, '`')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start+1:], '`')
+		if end < 0 {
+			break
+		}
+		sb.WriteString(inlineText(text[:start]))
+		sb.WriteString("<code>" + html.EscapeString(text[start+1:start+1+end]) + "</code>")
+		text = text[start+end+2:]
+	}
+	sb.WriteString(inlineText(text))
+	return sb.String()
+}
+
+func inlineText(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = boldPattern.ReplaceAllString(escaped, "<strong>$1</strong>")
+	escaped = linkPattern.ReplaceAllString(escaped, `<a href="$2">$1</a>`)
+	return strings.ReplaceAll(escaped, "\n", "<br>\n")
+}
@@ -0,0 +1,34 @@
+package htmlreport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"heading", "## Summary ##", "<h2>Summary</h2>\n"},
+		{"paragraph", "first line\nsecond line\n\nnext", "<p>first line<br>\nsecond line</p>\n<p>next</p>\n"},
+		{"inline", "run `go test` **now**, see [docs](https://go.dev/doc)",
+			`<p>run <code>go test</code> <strong>now</strong>, see <a href="https://go.dev/doc">docs</a></p>` + "\n"},
+		{"escaping", "<script>alert(1)</script> `<b>`", "<p>&lt;script&gt;alert(1)&lt;/script&gt; <code>&lt;b&gt;</code></p>\n"},
+		{"unsafe link", "[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>\n"},
+		{"lists", "- a\n- b\n\n1. one\n2. two", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n"},
+		{"rule", "---", "<hr>\n"},
+		{"quote", "> quoted", "<blockquote><p>quoted</p>\n</blockquote>\n"},
+		{"table", "| File | Lines |\n|---|---:|\n| main.go | 10 |",
+			"<table>\n<thead><tr><th>File</th><th>Lines</th></tr></thead>\n<tbody>\n<tr><td>main.go</td><td>10</td></tr>\n</tbody>\n</table>\n"},
+		{"code", "```go\nreturn nil\n```", `<pre><code class="language-go"><span class="kw">return</span> <span class="kw">nil</span></code></pre>` + "\n"},
+		{"unclosed code", "```\n<x>", "<pre><code>&lt;x&gt;</code></pre>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(Markdown(tt.markdown)))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package htmlreport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNoConverter is returned by PDF when no tool converting HTML to PDF is installed
+var ErrNoConverter = errors.New("no PDF converter found (install chromium, google-chrome or wkhtmltopdf)")
+
+// pdfTimeout is the maximum time a conversion may take
+const pdfTimeout = time.Minute
+
+// converter converts an HTML file to a PDF file
+type converter struct {
+	name string
+	args func(input, output string) []string
+}
+
+// browserArgs are the arguments of a headless Chrome or Chromium printing a page
+func browserArgs(input, output string) []string {
+	return []string{"--headless", "--disable-gpu", "--no-sandbox", "--no-pdf-header-footer",
+		"--print-to-pdf=" + output, "file://" + input}
+}
+
+// converters are the supported tools, in the order they are tried
+var converters = []converter{
+	{name: "chromium", args: browserArgs},
+	{name: "chromium-browser", args: browserArgs},
+	{name: "google-chrome", args: browserArgs},
+	{name: "google-chrome-stable", args: browserArgs},
+	{name: "wkhtmltopdf", args: func(input, output string) []string {
+		return []string{"--quiet", "--enable-local-file-access", input, output}
+	}},
+}
+
+// PDF converts an HTML page to a PDF file at output with the first installed converter
+func PDF(page []byte, output string) error {
+	var found *converter
+	var path string
+	for i := range converters {
+		if p, err := exec.LookPath(converters[i].name); err == nil {
+			found, path = &converters[i], p
+			break
+		}
+	}
+	if found == nil {
+		return ErrNoConverter
+	}
+
+	dir, err := os.MkdirTemp("", "aiagent-report-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "report.html")
+	if err := os.WriteFile(input, page, 0600); err != nil {
+		return fmt.Errorf("failed to write temporary page: %v", err)
+	}
+	output, err = filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, found.args(input, output)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed to convert the report: %v: %s", found.name, err, strings.TrimSpace(stderr.String()))
+	}
+	if _, err := os.Stat(output); err != nil {
+		return fmt.Errorf("%s did not write the PDF: %s", found.name, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
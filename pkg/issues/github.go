@@ -0,0 +1,78 @@
+package issues
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"aiagent/pkg/github"
+)
+
+// GitHub files issues in a GitHub repository
+type GitHub struct {
+	client *github.Client
+	repo   string
+}
+
+// NewGitHub creates a new tracker for the issues of repo ("owner/name")
+func NewGitHub(client *github.Client, repo string) *GitHub {
+	return &GitHub{
+		client: client,
+		repo:   repo,
+	}
+}
+
+// Name implements Tracker
+func (g *GitHub) Name() string {
+	return "GitHub " + g.repo
+}
+
+// Find implements Tracker; it looks at the 100 most recently updated open issues
+func (g *GitHub) Find(ctx context.Context, title string) (*Issue, error) {
+	open, err := g.client.OpenIssues(ctx, g.repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range open {
+		if strings.EqualFold(strings.TrimSpace(issue.Title), strings.TrimSpace(title)) {
+			return fromGitHub(&issue), nil
+		}
+	}
+	return nil, nil
+}
+
+// Create implements Tracker
+func (g *GitHub) Create(ctx context.Context, issue Issue) (*Issue, error) {
+	created, err := g.client.CreateIssue(ctx, g.repo, github.IssueRequest{Title: issue.Title, Body: issue.Body, Labels: issue.Labels})
+	if err != nil {
+		return nil, err
+	}
+	return fromGitHub(created), nil
+}
+
+// Update implements Tracker
+func (g *GitHub) Update(ctx context.Context, id string, issue Issue) (*Issue, error) {
+	number, err := strconv.Atoi(strings.TrimPrefix(id, "#"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub issue number %q", id)
+	}
+	updated, err := g.client.UpdateIssue(ctx, g.repo, number, github.IssueRequest{Title: issue.Title, Body: issue.Body, Labels: issue.Labels})
+	if err != nil {
+		return nil, err
+	}
+	return fromGitHub(updated), nil
+}
+
+func fromGitHub(issue *github.Issue) *Issue {
+	converted := &Issue{
+		ID:    strconv.Itoa(issue.Number),
+		Title: issue.Title,
+		Body:  issue.Body,
+		URL:   issue.HTMLURL,
+	}
+	for _, label := range issue.Labels {
+		converted.Labels = append(converted.Labels, label.Name)
+	}
+	return converted
+}
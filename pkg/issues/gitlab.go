@@ -0,0 +1,107 @@
+package issues
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultGitLabURL is the base URL of gitlab.com
+const DefaultGitLabURL = "https://gitlab.com"
+
+// GitLab files issues in a GitLab project
+type GitLab struct {
+	api     *apiClient
+	project string
+}
+
+// NewGitLab creates a new tracker for the issues of project, its path ("group/name") or
+// ID, on the GitLab instance at baseURL, authenticating with a personal access token
+func NewGitLab(baseURL, token, project string) *GitLab {
+	if baseURL == "" {
+		baseURL = DefaultGitLabURL
+	}
+	header := http.Header{}
+	if token != "" {
+		header.Set("PRIVATE-TOKEN", token)
+	}
+	return &GitLab{
+		api:     newAPIClient(strings.TrimRight(baseURL, "/")+"/api/v4", header),
+		project: project,
+	}
+}
+
+type gitlabIssue struct {
+	IID         int      `json:"iid"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Labels      []string `json:"labels"`
+	WebURL      string   `json:"web_url"`
+}
+
+func (i *gitlabIssue) issue() *Issue {
+	return &Issue{
+		ID:     strconv.Itoa(i.IID),
+		Title:  i.Title,
+		Body:   i.Description,
+		Labels: i.Labels,
+		URL:    i.WebURL,
+	}
+}
+
+// Name implements Tracker
+func (g *GitLab) Name() string {
+	return "GitLab " + g.project
+}
+
+func (g *GitLab) issuesPath() string {
+	return "/projects/" + url.PathEscape(g.project) + "/issues"
+}
+
+// Find implements Tracker
+func (g *GitLab) Find(ctx context.Context, title string) (*Issue, error) {
+	query := url.Values{"state": {"opened"}, "search": {title}, "in": {"title"}, "per_page": {"100"}}
+	var found []gitlabIssue
+	if err := g.api.do(ctx, http.MethodGet, g.issuesPath()+"?"+query.Encode(), nil, &found); err != nil {
+		return nil, err
+	}
+	for _, issue := range found {
+		if strings.EqualFold(strings.TrimSpace(issue.Title), strings.TrimSpace(title)) {
+			return issue.issue(), nil
+		}
+	}
+	return nil, nil
+}
+
+// Create implements Tracker
+func (g *GitLab) Create(ctx context.Context, issue Issue) (*Issue, error) {
+	var created gitlabIssue
+	if err := g.api.do(ctx, http.MethodPost, g.issuesPath(), gitlabRequest(issue), &created); err != nil {
+		return nil, err
+	}
+	return created.issue(), nil
+}
+
+// Update implements Tracker
+func (g *GitLab) Update(ctx context.Context, id string, issue Issue) (*Issue, error) {
+	iid, err := strconv.Atoi(strings.TrimPrefix(id, "#"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitLab issue number %q", id)
+	}
+	var updated gitlabIssue
+	if err := g.api.do(ctx, http.MethodPut, g.issuesPath()+"/"+strconv.Itoa(iid), gitlabRequest(issue), &updated); err != nil {
+		return nil, err
+	}
+	return updated.issue(), nil
+}
+
+func gitlabRequest(issue Issue) map[string]string {
+	request := map[string]string{"title": issue.Title, "description": issue.Body}
+	if len(issue.Labels) > 0 {
+		request["labels"] = strings.Join(issue.Labels, ",")
+	}
+	return request
+}
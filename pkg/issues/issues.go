@@ -0,0 +1,120 @@
+package issues
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Issue is an issue of a tracker
+type Issue struct {
+	// ID identifies the issue in the tracker: the number on GitHub and GitLab, the key on Jira
+	ID string
+
+	Title  string
+	Body   string
+	Labels []string
+
+	// URL is the web page of the issue; it is set on issues returned by a tracker
+	URL string
+}
+
+// Tracker creates and updates the issues of a project
+type Tracker interface {
+	// Name describes the tracker and project, e.g. "GitHub owner/name"
+	Name() string
+
+	// Find returns the open issue titled title, or nil if there is none
+	Find(ctx context.Context, title string) (*Issue, error)
+
+	// Create opens a new issue
+	Create(ctx context.Context, issue Issue) (*Issue, error)
+
+	// Update replaces the title, body and labels of the issue id
+	Update(ctx context.Context, id string, issue Issue) (*Issue, error)
+}
+
+// requestTimeout limits every request to a tracker
+const requestTimeout = 30 * time.Second
+
+// apiClient sends JSON requests to the REST API of GitLab or Jira
+type apiClient struct {
+	baseURL string
+	header  http.Header
+	client  *http.Client
+}
+
+func newAPIClient(baseURL string, header http.Header) *apiClient {
+	return &apiClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		header:  header,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (c *apiClient) do(ctx context.Context, method, path string, request, response any) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return fmt.Errorf("%s %s returned %d: %s", method, path, resp.StatusCode, apiMessage(data))
+	}
+	if response != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			return fmt.Errorf("failed to decode response: %v", err)
+		}
+	}
+	return nil
+}
+
+// apiMessage extracts the error message of a GitLab or Jira error response
+func apiMessage(data []byte) string {
+	var apiError struct {
+		Message       any      `json:"message"`
+		Error         string   `json:"error"`
+		ErrorMessages []string `json:"errorMessages"`
+		Errors        any      `json:"errors"`
+	}
+	if json.Unmarshal(data, &apiError) != nil {
+		return strings.TrimSpace(string(data))
+	}
+	switch {
+	case apiError.Message != nil:
+		return fmt.Sprint(apiError.Message)
+	case apiError.Error != "":
+		return apiError.Error
+	case len(apiError.ErrorMessages) > 0:
+		return strings.Join(apiError.ErrorMessages, "; ")
+	case apiError.Errors != nil:
+		return fmt.Sprint(apiError.Errors)
+	}
+	return strings.TrimSpace(string(data))
+}
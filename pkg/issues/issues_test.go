@@ -0,0 +1,148 @@
+package issues
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/github"
+)
+
+// request is a request received by a fake tracker
+type request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   map[string]any
+}
+
+// fakeAPI records the requests and answers them with the response for "METHOD /path"
+func fakeAPI(t *testing.T, responses map[string]string) (*httptest.Server, *[]request) {
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received := request{Method: r.Method, Path: r.URL.EscapedPath(), Query: r.URL.RawQuery}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			require.NoError(t, json.Unmarshal(data, &received.Body))
+		}
+		requests = append(requests, received)
+		response, ok := responses[r.Method+" "+received.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "404 Not Found"}`)
+			return
+		}
+		if response == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fmt.Fprint(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestGitHub(t *testing.T) {
+	server, requests := fakeAPI(t, map[string]string{
+		"GET /repos/owner/name/issues": `[
+			{"number": 3, "title": "Fix the build", "html_url": "https://github.com/owner/name/pull/3", "pull_request": {}},
+			{"number": 4, "title": "Fix the build", "html_url": "https://github.com/owner/name/issues/4", "labels": [{"name": "ci"}]}
+		]`,
+		"POST /repos/owner/name/issues":    `{"number": 5, "title": "Remove the hack", "html_url": "https://github.com/owner/name/issues/5"}`,
+		"PATCH /repos/owner/name/issues/4": `{"number": 4, "title": "Fix the build", "html_url": "https://github.com/owner/name/issues/4"}`,
+	})
+	client := github.NewClient("token")
+	client.BaseURL = server.URL
+	tracker := NewGitHub(client, "owner/name")
+	ctx := context.Background()
+
+	found, err := tracker.Find(ctx, "fix the build")
+	assert.NoError(t, err)
+	assert.Equal(t, &Issue{ID: "4", Title: "Fix the build", Labels: []string{"ci"}, URL: "https://github.com/owner/name/issues/4"}, found, "pull requests are skipped")
+
+	found, err = tracker.Find(ctx, "Remove the hack")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	created, err := tracker.Create(ctx, Issue{Title: "Remove the hack", Body: "client.go:40", Labels: []string{"todo"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "5", created.ID)
+
+	updated, err := tracker.Update(ctx, "#4", Issue{Title: "Fix the build", Body: "still failing"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/owner/name/issues/4", updated.URL)
+
+	assert.Equal(t, map[string]any{"title": "Remove the hack", "body": "client.go:40", "labels": []any{"todo"}}, (*requests)[2].Body)
+	assert.Equal(t, map[string]any{"title": "Fix the build", "body": "still failing"}, (*requests)[3].Body)
+
+	_, err = tracker.Update(ctx, "PROJ-1", Issue{Title: "x"})
+	assert.EqualError(t, err, `invalid GitHub issue number "PROJ-1"`)
+}
+
+func TestGitLab(t *testing.T) {
+	server, requests := fakeAPI(t, map[string]string{
+		"GET /api/v4/projects/group%2Fname/issues":   `[{"iid": 8, "title": "Fix the build now", "web_url": "https://gitlab.com/group/name/-/issues/8"}]`,
+		"POST /api/v4/projects/group%2Fname/issues":  `{"iid": 9, "title": "Fix the build", "web_url": "https://gitlab.com/group/name/-/issues/9"}`,
+		"PUT /api/v4/projects/group%2Fname/issues/9": `{"iid": 9, "title": "Fix the build", "labels": ["ci"], "web_url": "https://gitlab.com/group/name/-/issues/9"}`,
+	})
+	tracker := NewGitLab(server.URL, "token", "group/name")
+	ctx := context.Background()
+
+	found, err := tracker.Find(ctx, "Fix the build")
+	assert.NoError(t, err)
+	assert.Nil(t, found, "only exact titles match")
+	assert.Equal(t, "in=title&per_page=100&search=Fix+the+build&state=opened", (*requests)[0].Query)
+
+	created, err := tracker.Create(ctx, Issue{Title: "Fix the build", Body: "it fails", Labels: []string{"ci", "aiagent"}})
+	assert.NoError(t, err)
+	assert.Equal(t, &Issue{ID: "9", Title: "Fix the build", URL: "https://gitlab.com/group/name/-/issues/9"}, created)
+	assert.Equal(t, map[string]any{"title": "Fix the build", "description": "it fails", "labels": "ci,aiagent"}, (*requests)[1].Body)
+
+	updated, err := tracker.Update(ctx, "9", Issue{Title: "Fix the build", Labels: []string{"ci"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ci"}, updated.Labels)
+
+	_, err = NewGitLab(server.URL, "token", "other").Create(ctx, Issue{Title: "x"})
+	assert.EqualError(t, err, "POST /projects/other/issues returned 404: 404 Not Found")
+}
+
+func TestJira(t *testing.T) {
+	server, requests := fakeAPI(t, map[string]string{
+		"GET /rest/api/2/search":      `{"issues": [{"key": "OPS-3", "fields": {"summary": "Fix the \"build\"", "labels": ["ci"]}}]}`,
+		"POST /rest/api/2/issue":      `{"id": "10001", "key": "OPS-4"}`,
+		"PUT /rest/api/2/issue/OPS-3": "",
+	})
+	tracker := NewJira(server.URL+"/", "me@example.com", "token", "OPS", "")
+	ctx := context.Background()
+
+	found, err := tracker.Find(ctx, `Fix the "build"`)
+	assert.NoError(t, err)
+	assert.Equal(t, &Issue{ID: "OPS-3", Title: `Fix the "build"`, Labels: []string{"ci"}, URL: server.URL + "/browse/OPS-3"}, found)
+
+	created, err := tracker.Create(ctx, Issue{Title: "Remove the hack", Body: "client.go:40", Labels: []string{"tech debt"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "OPS-4", created.ID)
+	assert.Equal(t, server.URL+"/browse/OPS-4", created.URL)
+	assert.Equal(t, map[string]any{"fields": map[string]any{
+		"project":     map[string]any{"key": "OPS"},
+		"issuetype":   map[string]any{"name": "Task"},
+		"summary":     "Remove the hack",
+		"description": "client.go:40",
+		"labels":      []any{"tech-debt"},
+	}}, (*requests)[1].Body)
+
+	updated, err := tracker.Update(ctx, "OPS-3", Issue{Title: "Fix the build", Body: "still failing"})
+	assert.NoError(t, err)
+	assert.Equal(t, "OPS-3", updated.ID)
+}
+
+func TestJQLString(t *testing.T) {
+	assert.Equal(t, `"OPS"`, jqlString("OPS"))
+	assert.Equal(t, `"\"a\\b\""`, jqlString(`"a\b"`))
+}
@@ -0,0 +1,125 @@
+package issues
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultJiraIssueType is the type of the issues created on Jira
+const DefaultJiraIssueType = "Task"
+
+// Jira files issues in a Jira project
+type Jira struct {
+	api       *apiClient
+	baseURL   string
+	project   string
+	issueType string
+}
+
+// NewJira creates a new tracker for the issues of the project with key project on the Jira
+// site at baseURL. With a user, e.g. an email address on Jira Cloud, token is an API token
+// sent with basic authentication; without, it is a personal access token
+func NewJira(baseURL, user, token, project, issueType string) *Jira {
+	if issueType == "" {
+		issueType = DefaultJiraIssueType
+	}
+	header := http.Header{}
+	switch {
+	case user != "":
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+token)))
+	case token != "":
+		header.Set("Authorization", "Bearer "+token)
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &Jira{
+		api:       newAPIClient(baseURL+"/rest/api/2", header),
+		baseURL:   baseURL,
+		project:   project,
+		issueType: issueType,
+	}
+}
+
+// Name implements Tracker
+func (j *Jira) Name() string {
+	return "Jira " + j.project
+}
+
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string   `json:"summary"`
+		Description string   `json:"description"`
+		Labels      []string `json:"labels"`
+	} `json:"fields"`
+}
+
+// Find implements Tracker; it looks for unresolved issues of the project
+func (j *Jira) Find(ctx context.Context, title string) (*Issue, error) {
+	jql := "project = " + jqlString(j.project) + " AND statusCategory != Done AND summary ~ " + jqlString(`"`+title+`"`)
+	query := url.Values{"jql": {jql}, "fields": {"summary,description,labels"}, "maxResults": {"50"}}
+	var result struct {
+		Issues []jiraIssue `json:"issues"`
+	}
+	if err := j.api.do(ctx, http.MethodGet, "/search?"+query.Encode(), nil, &result); err != nil {
+		return nil, err
+	}
+	for _, found := range result.Issues {
+		if strings.EqualFold(strings.TrimSpace(found.Fields.Summary), strings.TrimSpace(title)) {
+			return &Issue{
+				ID:     found.Key,
+				Title:  found.Fields.Summary,
+				Body:   found.Fields.Description,
+				Labels: found.Fields.Labels,
+				URL:    j.baseURL + "/browse/" + found.Key,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Create implements Tracker
+func (j *Jira) Create(ctx context.Context, issue Issue) (*Issue, error) {
+	fields := j.fields(issue)
+	fields["project"] = map[string]string{"key": j.project}
+	fields["issuetype"] = map[string]string{"name": j.issueType}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := j.api.do(ctx, http.MethodPost, "/issue", map[string]any{"fields": fields}, &created); err != nil {
+		return nil, err
+	}
+	issue.ID = created.Key
+	issue.URL = j.baseURL + "/browse/" + created.Key
+	return &issue, nil
+}
+
+// Update implements Tracker
+func (j *Jira) Update(ctx context.Context, id string, issue Issue) (*Issue, error) {
+	if err := j.api.do(ctx, http.MethodPut, "/issue/"+url.PathEscape(id), map[string]any{"fields": j.fields(issue)}, nil); err != nil {
+		return nil, err
+	}
+	issue.ID = id
+	issue.URL = j.baseURL + "/browse/" + id
+	return &issue, nil
+}
+
+func (j *Jira) fields(issue Issue) map[string]any {
+	fields := map[string]any{"summary": issue.Title, "description": issue.Body}
+	if len(issue.Labels) > 0 {
+		// Jira labels must not contain spaces
+		labels := make([]string, len(issue.Labels))
+		for i, label := range issue.Labels {
+			labels[i] = strings.Join(strings.Fields(label), "-")
+		}
+		fields["labels"] = labels
+	}
+	return fields
+}
+
+// jqlString quotes s as a JQL string literal
+func jqlString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,296 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"aiagent/pkg/schema"
+	"aiagent/pkg/storage"
+)
+
+const (
+	// Collection is the storage collection holding jobs
+	Collection = "jobs"
+
+	// SchemaVersion is the current schema version of persisted jobs
+	SchemaVersion = 1
+
+	// Retention is how long finished jobs are kept in the storage
+	Retention = 7 * 24 * time.Hour
+)
+
+// Migrations upgrades jobs written by older versions of the agent
+// Register a migration here whenever SchemaVersion is increased
+var Migrations = schema.NewMigrator("job", SchemaVersion)
+
+var (
+	// ErrQueueFull is returned when the queue holds its maximum number of waiting jobs
+	ErrQueueFull = errors.New("job queue is full")
+
+	// ErrNotFound is returned for unknown jobs
+	ErrNotFound = errors.New("job not found")
+
+	// ErrFinished is returned when a finished job is canceled
+	ErrFinished = errors.New("job already finished")
+
+	// ErrClosed is returned by Next once the queue is closed
+	ErrClosed = errors.New("job queue is closed")
+)
+
+// Status is the state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Done reports whether a job in this state has finished
+func (s Status) Done() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCanceled
+}
+
+// Job is a unit of work waiting in the queue, running or finished
+type Job struct {
+	SchemaVersion int             `json:"schema_version"`
+	ID            string          `json:"id"`
+	Status        Status          `json:"status"`
+	Payload       json.RawMessage `json:"payload"`
+	Result        string          `json:"result,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	StartedAt     time.Time       `json:"started_at,omitempty"`
+	FinishedAt    time.Time       `json:"finished_at,omitempty"`
+}
+
+// Queue is a FIFO job queue persisted in a store, so waiting jobs survive a restart
+// Workers take jobs with Next and report their outcome with Finish
+type Queue struct {
+	store    storage.Store
+	capacity int
+
+	mu      sync.Mutex
+	pending []string
+	cancels map[string]context.CancelFunc
+	notify  chan struct{}
+	closed  bool
+}
+
+// Open loads the queue persisted in store; at most capacity jobs may wait (0: no limit)
+// Jobs that were running when the process stopped are failed, since their commands may
+// have run already; finished jobs beyond the retention are deleted
+func Open(store storage.Store, capacity int) (*Queue, error) {
+	q := &Queue{
+		store:    store,
+		capacity: capacity,
+		cancels:  make(map[string]context.CancelFunc),
+		notify:   make(chan struct{}),
+	}
+
+	// Jobs are listed by update time, which is the creation time of waiting jobs
+	records, err := store.List(Collection, storage.Query{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jobs: %v", err)
+	}
+	for _, record := range records {
+		var job Job
+		if err := Migrations.Decode(record.Value, &job); err != nil {
+			return nil, fmt.Errorf("failed to load job %s: %v", record.Key, err)
+		}
+		switch {
+		case job.Status == StatusQueued:
+			q.pending = append(q.pending, job.ID)
+		case job.Status == StatusRunning:
+			job.Status = StatusFailed
+			job.Error = "interrupted by a restart of the server"
+			job.FinishedAt = time.Now()
+			if err := q.save(&job); err != nil {
+				return nil, err
+			}
+		case time.Since(job.FinishedAt) > Retention:
+			if err := store.Delete(Collection, job.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return nil, fmt.Errorf("failed to delete job %s: %v", job.ID, err)
+			}
+		}
+	}
+	return q, nil
+}
+
+// Enqueue adds a job with the payload encoded as JSON
+func (q *Queue) Enqueue(id string, payload any) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %v", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.capacity > 0 && len(q.pending) >= q.capacity {
+		return nil, ErrQueueFull
+	}
+
+	job := &Job{ID: id, Status: StatusQueued, Payload: data, CreatedAt: time.Now()}
+	if err := q.save(job); err != nil {
+		return nil, err
+	}
+	q.pending = append(q.pending, id)
+	q.wake()
+	return job, nil
+}
+
+// Pending returns the IDs of the waiting jobs in queue order
+func (q *Queue) Pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.pending...)
+}
+
+// Next blocks until a job is waiting, marks it running and returns it with a context
+// that is canceled when the job is canceled
+// It returns ErrClosed once the queue is closed and ctx.Err() when ctx is done
+func (q *Queue) Next(ctx context.Context) (*Job, context.Context, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, nil, ErrClosed
+		}
+		if len(q.pending) > 0 {
+			id := q.pending[0]
+			q.pending = q.pending[1:]
+			job, err := q.get(id)
+			if err != nil {
+				q.mu.Unlock()
+				return nil, nil, err
+			}
+			job.Status = StatusRunning
+			job.StartedAt = time.Now()
+			if err := q.save(job); err != nil {
+				q.mu.Unlock()
+				return nil, nil, err
+			}
+			jobCtx, cancel := context.WithCancel(context.Background())
+			q.cancels[id] = cancel
+			q.mu.Unlock()
+			return job, jobCtx, nil
+		}
+		notify := q.notify
+		q.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// Finish records the outcome of a running job; a job whose context was canceled is
+// recorded as canceled
+func (q *Queue) Finish(id, result string, runErr error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.get(id)
+	if err != nil {
+		return err
+	}
+	job.Status = StatusCompleted
+	job.Result = result
+	job.FinishedAt = time.Now()
+	if runErr != nil {
+		job.Status = StatusFailed
+		if errors.Is(runErr, context.Canceled) {
+			job.Status = StatusCanceled
+		}
+		job.Error = runErr.Error()
+	}
+	if cancel, ok := q.cancels[id]; ok {
+		cancel()
+		delete(q.cancels, id)
+	}
+	return q.save(job)
+}
+
+// Cancel removes a waiting job from the queue, or cancels the context of a running job
+// It returns the job as it is after the cancellation
+func (q *Queue) Cancel(id string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.get(id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case job.Status.Done():
+		return job, ErrFinished
+	case job.Status == StatusRunning:
+		if cancel, ok := q.cancels[id]; ok {
+			cancel()
+		}
+		return job, nil
+	}
+
+	for i, pending := range q.pending {
+		if pending == id {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+	job.Status = StatusCanceled
+	job.FinishedAt = time.Now()
+	return job, q.save(job)
+}
+
+// Get returns a job by ID
+func (q *Queue) Get(id string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.get(id)
+}
+
+// Close wakes up the workers waiting in Next, which return ErrClosed
+// Waiting jobs stay in the storage and are picked up when the queue is opened again
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.wake()
+}
+
+func (q *Queue) get(id string) (*Job, error) {
+	var raw json.RawMessage
+	if err := q.store.Get(Collection, id, &raw); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to load job %s: %v", id, err)
+	}
+	var job Job
+	if err := Migrations.Decode(raw, &job); err != nil {
+		return nil, fmt.Errorf("failed to load job %s: %v", id, err)
+	}
+	return &job, nil
+}
+
+func (q *Queue) save(job *Job) error {
+	job.SchemaVersion = SchemaVersion
+	if err := q.store.Put(Collection, job.ID, job); err != nil {
+		return fmt.Errorf("failed to save job %s: %v", job.ID, err)
+	}
+	return nil
+}
+
+// wake wakes up the workers waiting in Next; the caller holds the lock
+func (q *Queue) wake() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/storage"
+)
+
+func openQueue(t *testing.T, store storage.Store, capacity int) *Queue {
+	t.Helper()
+	q, err := Open(store, capacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestQueue(t *testing.T) {
+	q := openQueue(t, storage.NewFileStore(t.TempDir()), 0)
+
+	_, err := q.Enqueue("job-1", map[string]string{"input": "first"})
+	assert.NoError(t, err)
+	_, err = q.Enqueue("job-2", map[string]string{"input": "second"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"job-1", "job-2"}, q.Pending())
+
+	job, _, err := q.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "job-1", job.ID)
+	assert.Equal(t, StatusRunning, job.Status)
+	assert.JSONEq(t, `{"input": "first"}`, string(job.Payload))
+
+	assert.NoError(t, q.Finish("job-1", "done", nil))
+	job, err = q.Get("job-1")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCompleted, job.Status)
+	assert.Equal(t, "done", job.Result)
+
+	job, _, err = q.Next(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, q.Finish(job.ID, "", fmt.Errorf("llm unavailable")))
+	job, _ = q.Get("job-2")
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, "llm unavailable", job.Error)
+
+	_, err = q.Get("job-3")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestQueue_NextWaits(t *testing.T) {
+	q := openQueue(t, storage.NewFileStore(t.TempDir()), 0)
+
+	next := make(chan string)
+	go func() {
+		job, _, err := q.Next(context.Background())
+		if err == nil {
+			next <- job.ID
+		}
+	}()
+	q.Enqueue("job-1", nil)
+	select {
+	case id := <-next:
+		assert.Equal(t, "job-1", id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next did not return the queued job")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := q.Next(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	q.Close()
+	_, _, err = q.Next(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestQueue_Capacity(t *testing.T) {
+	q := openQueue(t, storage.NewFileStore(t.TempDir()), 1)
+
+	_, err := q.Enqueue("job-1", nil)
+	assert.NoError(t, err)
+	_, err = q.Enqueue("job-2", nil)
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	// A running job no longer takes a place in the queue
+	q.Next(context.Background())
+	_, err = q.Enqueue("job-2", nil)
+	assert.NoError(t, err)
+}
+
+func TestQueue_Cancel(t *testing.T) {
+	q := openQueue(t, storage.NewFileStore(t.TempDir()), 0)
+	q.Enqueue("job-1", nil)
+	q.Enqueue("job-2", nil)
+
+	_, ctx, err := q.Next(context.Background())
+	assert.NoError(t, err)
+	job, err := q.Cancel("job-1")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRunning, job.Status, "a running job stops on its own")
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.NoError(t, q.Finish("job-1", "", fmt.Errorf("run canceled: %w", ctx.Err())))
+	job, _ = q.Get("job-1")
+	assert.Equal(t, StatusCanceled, job.Status)
+
+	job, err = q.Cancel("job-2")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCanceled, job.Status)
+	assert.Empty(t, q.Pending())
+
+	_, err = q.Cancel("job-2")
+	assert.ErrorIs(t, err, ErrFinished)
+	_, err = q.Cancel("job-3")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestOpen_Restart(t *testing.T) {
+	store := storage.NewFileStore(t.TempDir())
+	q := openQueue(t, store, 0)
+	q.Enqueue("job-1", nil)
+	q.Enqueue("job-2", nil)
+	q.Next(context.Background())
+
+	old := &Job{ID: "job-0", Status: StatusCompleted, FinishedAt: time.Now().Add(-Retention - time.Hour)}
+	assert.NoError(t, q.save(old))
+
+	q = openQueue(t, store, 0)
+	assert.Equal(t, []string{"job-2"}, q.Pending(), "waiting jobs are resumed")
+	job, err := q.Get("job-1")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusFailed, job.Status, "interrupted jobs are not run twice")
+	_, err = q.Get("job-0")
+	assert.ErrorIs(t, err, ErrNotFound, "old jobs are deleted")
+}
@@ -0,0 +1,144 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version is the JSON-RPC version of every message
+const Version = "2.0"
+
+// MaxMessageSize is the maximum size of the content of a message read by Conn
+const MaxMessageSize = 10 << 20
+
+// Error codes of JSON-RPC 2.0, and the one of the Language Server Protocol for canceled requests
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeRequestCancelled = -32800
+)
+
+// Message is a request, a notification (a request without ID) or a response
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// IsNotification reports whether the message is a request expecting no response
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// Error is the error of a response
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Errorf creates an error with a code and a formatted message
+func Errorf(code int, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Conn exchanges messages framed like the base protocol of the Language Server Protocol:
+// every message is a Content-Length header, an empty line and the JSON content
+// Writes are serialized, so responses and notifications may be sent from several goroutines
+type Conn struct {
+	reader *bufio.Reader
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewConn creates a new instance of Conn reading from r and writing to w
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{reader: bufio.NewReader(r), w: w}
+}
+
+// Read reads the next message; it returns io.EOF when the input ends between messages
+// Content that is not valid JSON is reported as an *Error with CodeParseError, after which
+// the next message can be read
+func (c *Conn) Read() (*Message, error) {
+	header, err := textproto.NewReader(c.reader).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read message header: %v", err)
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length header %q", header.Get("Content-Length"))
+	}
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", length, MaxMessageSize)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, content); err != nil {
+		return nil, fmt.Errorf("failed to read message content: %v", err)
+	}
+	var message Message
+	if err := json.Unmarshal(content, &message); err != nil {
+		return nil, Errorf(CodeParseError, "invalid JSON: %v", err)
+	}
+	return &message, nil
+}
+
+// Write sends a message
+func (c *Conn) Write(message *Message) error {
+	message.JSONRPC = Version
+	content, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(content)
+	return err
+}
+
+// Reply answers the request with the ID id, with result or rpcErr
+func (c *Conn) Reply(id json.RawMessage, result any, rpcErr *Error) error {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	if rpcErr != nil {
+		return c.Write(&Message{ID: id, Error: rpcErr})
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return c.Write(&Message{ID: id, Error: Errorf(CodeInternalError, "failed to encode result: %v", err)})
+	}
+	return c.Write(&Message{ID: id, Result: data})
+}
+
+// Notify sends a notification
+func (c *Conn) Notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s parameters: %v", method, err)
+	}
+	return c.Write(&Message{Method: method, Params: data})
+}
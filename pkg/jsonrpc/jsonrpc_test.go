@@ -0,0 +1,90 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func frame(content string) string {
+	return "Content-Length: " + strconv.Itoa(len(content)) + "\r\n\r\n" + content
+}
+
+func TestConn_Read(t *testing.T) {
+	input := frame(`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}`) +
+		"Content-Type: application/vscode-jsonrpc; charset=utf-8\r\n" + frame(`{"jsonrpc": "2.0", "method": "exit"}`) +
+		frame(`{not json`) +
+		frame(`{"jsonrpc": "2.0", "method": "last"}`)
+	conn := NewConn(strings.NewReader(input), io.Discard)
+
+	message, err := conn.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "initialize", message.Method)
+	assert.Equal(t, json.RawMessage("1"), message.ID)
+	assert.False(t, message.IsNotification())
+
+	message, err = conn.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "exit", message.Method)
+	assert.True(t, message.IsNotification())
+
+	_, err = conn.Read()
+	var rpcErr *Error
+	if assert.True(t, errors.As(err, &rpcErr)) {
+		assert.Equal(t, CodeParseError, rpcErr.Code)
+	}
+
+	message, err = conn.Read()
+	assert.NoError(t, err, "reading continues after invalid JSON")
+	assert.Equal(t, "last", message.Method)
+
+	_, err = conn.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestConn_ReadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "missing length", input: "\r\n{}", want: `invalid Content-Length header ""`},
+		{name: "too large", input: "Content-Length: 999999999\r\n\r\n", want: "message of 999999999 bytes exceeds the limit of 10485760 bytes"},
+		{name: "short content", input: "Content-Length: 10\r\n\r\n{}", want: "failed to read message content: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewConn(strings.NewReader(tt.input), io.Discard).Read()
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
+
+func TestConn_Write(t *testing.T) {
+	var out bytes.Buffer
+	conn := NewConn(strings.NewReader(""), &out)
+
+	assert.NoError(t, conn.Reply(json.RawMessage("1"), map[string]string{"text": "ok"}, nil))
+	assert.NoError(t, conn.Reply(json.RawMessage(`"a"`), nil, Errorf(CodeMethodNotFound, "method not found: %s", "x")))
+	assert.NoError(t, conn.Notify("progress", map[string]int{"done": 1}))
+
+	reader := NewConn(&out, io.Discard)
+	message, err := reader.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &Message{JSONRPC: Version, ID: json.RawMessage("1"), Result: json.RawMessage(`{"text":"ok"}`)}, message)
+
+	message, err = reader.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, &Error{Code: CodeMethodNotFound, Message: "method not found: x"}, message.Error)
+
+	message, err = reader.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "progress", message.Method)
+	assert.JSONEq(t, `{"done": 1}`, string(message.Params))
+}
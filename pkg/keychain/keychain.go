@@ -0,0 +1,114 @@
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Service is the service the secrets of the agent are stored under
+const Service = "aiagent"
+
+// ErrUnavailable is returned when the keychain of the operating system cannot be used
+var ErrUnavailable = errors.New("no keychain tool found (the keychain needs macOS or secret-tool of libsecret)")
+
+// tool is a command line tool storing and looking up secrets
+// The secret is stored through standard input, so it does not show up in the process list
+type tool struct {
+	// store returns the command storing secret under account and its standard input
+	store  func(account, secret string) ([]string, string)
+	lookup func(account string) []string
+}
+
+// lookPath finds the executable of a tool, replaced in tests
+var lookPath = exec.LookPath
+
+// tools returns the keychain tool of an operating system, if there is one
+func tools(goos string) []tool {
+	switch goos {
+	case "darwin":
+		// In interactive mode security reads its commands from standard input
+		return []tool{{
+			store: func(account, secret string) ([]string, string) {
+				input := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", quote(Service), quote(account), quote(secret))
+				return []string{"security", "-i"}, input
+			},
+			lookup: func(account string) []string {
+				return []string{"security", "find-generic-password", "-s", Service, "-a", account, "-w"}
+			},
+		}}
+	case "windows":
+		return nil
+	}
+	return []tool{{
+		store: func(account, secret string) ([]string, string) {
+			return []string{"secret-tool", "store", "--label", Service + " " + account, "service", Service, "account", account}, secret
+		},
+		lookup: func(account string) []string {
+			return []string{"secret-tool", "lookup", "service", Service, "account", account}
+		},
+	}}
+}
+
+// quote quotes s for the command line of security
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// find returns the first installed tool
+func find() (tool, error) {
+	for _, t := range tools(runtime.GOOS) {
+		if _, err := lookPath(t.lookup("")[0]); err == nil {
+			return t, nil
+		}
+	}
+	return tool{}, ErrUnavailable
+}
+
+// Available reports whether secrets can be stored in the keychain
+func Available() bool {
+	_, err := find()
+	return err == nil
+}
+
+// Store saves secret in the keychain under account, replacing the previous secret
+func Store(account, secret string) error {
+	t, err := find()
+	if err != nil {
+		return err
+	}
+	command, input := t.store(account, secret)
+	var stderr bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to store the secret with %s: %v: %s", command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Lookup returns the secret stored in the keychain under account
+func Lookup(account string) (string, error) {
+	t, err := find()
+	if err != nil {
+		return "", err
+	}
+	command := t.lookup(account)
+	var stderr bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	// secret-tool fails without a message if nothing is stored
+	if err != nil && strings.TrimSpace(stderr.String()) != "" {
+		return "", fmt.Errorf("failed to look up %s in the keychain with %s: %v: %s", account, command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	secret := strings.TrimSpace(string(output))
+	if err != nil || secret == "" {
+		return "", fmt.Errorf("no secret is stored in the keychain for %s", account)
+	}
+	return secret, nil
+}
@@ -0,0 +1,57 @@
+package keychain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTools(t *testing.T) {
+	command, input := tools("darwin")[0].store("openai", "it's-secret")
+	assert.Equal(t, []string{"security", "-i"}, command)
+	assert.Equal(t, `add-generic-password -U -s 'aiagent' -a 'openai' -w 'it'"'"'s-secret'`+"\n", input)
+
+	command, input = tools("linux")[0].store("openai", "sk-1")
+	assert.Equal(t, "secret-tool", command[0])
+	assert.Equal(t, "sk-1", input)
+	assert.Equal(t, []string{"secret-tool", "lookup", "service", "aiagent", "account", "openai"}, tools("linux")[0].lookup("openai"))
+	assert.Empty(t, tools("windows"))
+}
+
+func TestStoreLookup(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fakes secret-tool")
+	}
+
+	// The fake secret-tool keeps the secret in a file
+	dir := t.TempDir()
+	store := filepath.Join(dir, "secret")
+	script := "#!/bin/sh\ncase \"$1\" in\nstore) cat > " + store + " ;;\nlookup) cat " + store + " 2>/dev/null ;;\nesac\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	assert.True(t, Available())
+	_, err := Lookup("openai")
+	assert.EqualError(t, err, "no secret is stored in the keychain for openai")
+
+	require.NoError(t, Store("openai", "sk-test"))
+	secret, err := Lookup("openai")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-test", secret)
+}
+
+func TestUnavailable(t *testing.T) {
+	original := lookPath
+	t.Cleanup(func() { lookPath = original })
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+
+	assert.False(t, Available())
+	assert.ErrorIs(t, Store("openai", "sk-test"), ErrUnavailable)
+	_, err := Lookup("openai")
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
@@ -0,0 +1,151 @@
+package language
+
+import (
+	"strings"
+	"unicode"
+)
+
+// English is the language the prompts are written in
+const English = "English"
+
+// codes maps the ISO 639-1 codes of common languages to their English names
+var codes = map[string]string{
+	"ar": "Arabic",
+	"de": "German",
+	"el": "Greek",
+	"en": English,
+	"es": "Spanish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"th": "Thai",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// scripts maps the writing systems used by a single common language to that language
+var scripts = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hangul, "Korean"},
+	{unicode.Hiragana, "Japanese"},
+	{unicode.Katakana, "Japanese"},
+	{unicode.Han, "Chinese"},
+	{unicode.Arabic, "Arabic"},
+	{unicode.Hebrew, "Hebrew"},
+	{unicode.Greek, "Greek"},
+	{unicode.Devanagari, "Hindi"},
+	{unicode.Thai, "Thai"},
+}
+
+// stopwords are frequent words of the languages written in the Latin script, including
+// the words requests to the agent usually start with
+var stopwords = []struct {
+	language string
+	words    []string
+}{
+	{English, []string{"the", "is", "are", "what", "how", "why", "which", "and", "of", "to", "in", "this", "my", "all", "show", "list", "find", "explain", "files", "does", "me"}},
+	{"Spanish", []string{"el", "los", "las", "que", "qué", "es", "cómo", "por", "archivos", "muestra", "lista", "explica", "una", "del", "y", "mis", "este"}},
+	{"French", []string{"le", "les", "des", "est", "quoi", "comment", "pourquoi", "fichiers", "affiche", "liste", "explique", "du", "une", "dans", "et", "mes", "ce", "quels"}},
+	{"German", []string{"der", "die", "das", "und", "ist", "wie", "warum", "was", "nicht", "dateien", "zeige", "liste", "erkläre", "ein", "eine", "mit", "im", "alle"}},
+	{"Portuguese", []string{"os", "as", "que", "é", "como", "arquivos", "mostre", "liste", "explique", "não", "um", "uma", "do", "da", "meus", "este"}},
+	{"Italian", []string{"il", "gli", "che", "è", "come", "perché", "mostra", "elenca", "spiega", "una", "della", "non", "di", "questo", "tutti"}},
+}
+
+// Name returns the English name of a language given by its ISO 639-1 code or its name
+func Name(language string) string {
+	language = strings.TrimSpace(language)
+	if name, ok := codes[strings.ToLower(language)]; ok {
+		return name
+	}
+	for _, name := range codes {
+		if strings.EqualFold(name, language) {
+			return name
+		}
+	}
+	return language
+}
+
+// Detect returns the English name of the language text is written in, or "" when it
+// cannot tell
+// Languages with a script of their own are recognized by their letters, the languages
+// written in the Latin script by their frequent words
+func Detect(text string) string {
+	counts := make(map[string]int)
+	latin, cyrillic, ukrainian := 0, 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				ukrainian++
+			}
+		default:
+			for _, script := range scripts {
+				if unicode.Is(script.table, r) {
+					counts[script.language]++
+					break
+				}
+			}
+		}
+	}
+	// Japanese is written with Han characters too, so any kana makes it Japanese
+	if counts["Japanese"] > 0 {
+		counts["Japanese"] += counts["Chinese"]
+		delete(counts, "Chinese")
+	}
+	if cyrillic > 0 {
+		counts["Russian"] = cyrillic
+		if ukrainian > 0 {
+			counts["Ukrainian"] = cyrillic
+			delete(counts, "Russian")
+		}
+	}
+
+	best, bestCount := "", 0
+	for language, count := range counts {
+		if count > bestCount || count == bestCount && language < best {
+			best, bestCount = language, count
+		}
+	}
+	if bestCount > latin {
+		return best
+	}
+	if latin == 0 {
+		return ""
+	}
+	return detectLatin(text)
+}
+
+// detectLatin returns the language of a text in the Latin script with the most frequent
+// words in it, or "" when it has none
+func detectLatin(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	best, bestCount := "", 0
+	for _, language := range stopwords {
+		count := 0
+		for _, word := range words {
+			for _, stopword := range language.words {
+				if word == stopword {
+					count++
+					break
+				}
+			}
+		}
+		if count > bestCount {
+			best, bestCount = language.language, count
+		}
+	}
+	return best
+}
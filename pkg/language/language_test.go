@@ -0,0 +1,41 @@
+package language
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"list all files in the current directory", English},
+		{"muestra los archivos del proyecto", "Spanish"},
+		{"pourquoi les tests échouent dans ce dossier", "French"},
+		{"zeige alle Dateien im Verzeichnis", "German"},
+		{"покажи все файлы в папке", "Russian"},
+		{"покажи всі файли в папці", "Ukrainian"},
+		{"列出当前目录中的文件", "Chinese"},
+		{"このディレクトリのファイルを一覧表示", "Japanese"},
+		{"현재 디렉터리의 파일 목록", "Korean"},
+		{"Τι είναι το Go", "Greek"},
+		{"ls -la", ""},
+		{"12345", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Detect(tt.text))
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "German", Name("de"))
+	assert.Equal(t, "German", Name("german"))
+	assert.Equal(t, "Japanese", Name(" JA "))
+	assert.Equal(t, "Esperanto", Name("Esperanto"))
+}
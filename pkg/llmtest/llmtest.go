@@ -0,0 +1,291 @@
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/nodes"
+)
+
+// Options are the settings the contract creates a backend with
+type Options struct {
+	// SystemPrompt must be sent as the system message of every request
+	SystemPrompt string
+
+	// Timeout must limit every request
+	Timeout time.Duration
+}
+
+// Backend describes how the contract creates the LLM backend under test
+type Backend struct {
+	// New creates the backend talking to the chat completions endpoint at url
+	New func(url string, opts Options) (nodes.LLM, error)
+
+	// CheckRequest optionally verifies provider specific details of a request, e.g. the auth header
+	CheckRequest func(r *Request) error
+}
+
+// Request is a request received by the Server
+type Request struct {
+	Header http.Header
+	Body   nodes.ChatCompletionRequest
+}
+
+// Message returns the content of the first message with the given role
+func (r *Request) Message(role string) (string, bool) {
+	for _, message := range r.Body.Messages {
+		if message.Role == role {
+			return message.Content, true
+		}
+	}
+	return "", false
+}
+
+// response is the answer of the Server to the next requests
+type response struct {
+	status int
+	body   string
+	delay  time.Duration
+}
+
+// Server is a fake OpenAI compatible chat completions endpoint
+// It answers every request with the configured response, a completion by default
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	response response
+	requests []Request
+}
+
+// NewServer starts a Server that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{}
+	s.Respond("ok")
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// URL returns the chat completions endpoint of the server
+func (s *Server) URL() string {
+	return s.Server.URL + "/v1/chat/completions"
+}
+
+// Respond answers the next requests with a completion of content
+func (s *Server) Respond(content string) {
+	body, _ := json.Marshal(map[string]any{
+		"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": content}}},
+		"usage":   nodes.TokenUsage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15},
+	})
+	s.RespondRaw(http.StatusOK, string(body))
+}
+
+// RespondError answers the next requests with an API error
+func (s *Server) RespondError(status int, message string) {
+	body, _ := json.Marshal(map[string]any{"error": map[string]string{"message": message}})
+	s.RespondRaw(status, string(body))
+}
+
+// RespondRaw answers the next requests with a status code and body
+func (s *Server) RespondRaw(status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.response = response{status: status, body: body, delay: s.response.delay}
+}
+
+// Delay delays the next responses, e.g. to trigger timeouts
+func (s *Server) Delay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.response.delay = d
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	request := Request{Header: r.Header.Clone()}
+	data, _ := io.ReadAll(r.Body)
+	json.Unmarshal(data, &request.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	resp := s.response
+	s.mu.Unlock()
+
+	if resp.delay > 0 {
+		select {
+		case <-time.After(resp.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	io.WriteString(w, resp.body)
+}
+
+// RunContract runs the behaviour every LLM backend must share as subtests of t:
+//   - a completion returns the trimmed message content and reports the token usage
+//   - the prompt and system prompt are sent as user and system messages
+//   - API errors are returned with the error kinds of the nodes package
+//   - a slow server fails with ErrTimeout after the configured timeout
+func RunContract(t *testing.T, backend Backend) {
+	const systemPrompt = "You are a contract test."
+
+	newLLM := func(t *testing.T, opts Options) (*Server, nodes.LLM) {
+		t.Helper()
+		server := NewServer(t)
+		if opts.Timeout == 0 {
+			opts.Timeout = 5 * time.Second
+		}
+		llm, err := backend.New(server.URL(), opts)
+		if err != nil {
+			t.Fatalf("failed to create backend: %v", err)
+		}
+		return server, llm
+	}
+
+	t.Run("completion", func(t *testing.T) {
+		server, llm := newLLM(t, Options{})
+		server.Respond("  the answer\n")
+
+		got, err := llm.Complete("the question")
+		assert.NoError(t, err)
+		assert.Equal(t, "the answer", got, "the content must be trimmed")
+
+		requests := server.Requests()
+		if assert.Len(t, requests, 1) {
+			prompt, ok := requests[0].Message("user")
+			assert.True(t, ok, "the prompt must be sent as a user message")
+			assert.Equal(t, "the question", prompt)
+			if backend.CheckRequest != nil {
+				assert.NoError(t, backend.CheckRequest(&requests[0]))
+			}
+		}
+
+		if reporter, ok := llm.(nodes.UsageReporter); ok {
+			assert.Equal(t, 15, reporter.LastUsage().TotalTokens)
+		}
+		if completer, ok := llm.(nodes.UsageCompleter); ok {
+			got, usage, err := completer.CompleteWithUsage("the question")
+			assert.NoError(t, err)
+			assert.Equal(t, "the answer", got)
+			assert.Equal(t, 15, usage.TotalTokens)
+		}
+	})
+
+	t.Run("system prompt", func(t *testing.T) {
+		server, llm := newLLM(t, Options{SystemPrompt: systemPrompt})
+
+		_, err := llm.Complete("the question")
+		assert.NoError(t, err)
+
+		requests := server.Requests()
+		if assert.Len(t, requests, 1) {
+			got, ok := requests[0].Message("system")
+			assert.True(t, ok, "the system prompt must be sent as a system message")
+			assert.Equal(t, systemPrompt, got)
+			assert.Equal(t, "system", requests[0].Body.Messages[0].Role, "the system message must come first")
+		}
+		if prompter, ok := llm.(nodes.SystemPrompter); ok {
+			assert.Equal(t, systemPrompt, prompter.SystemPrompt())
+		}
+	})
+
+	t.Run("no system prompt", func(t *testing.T) {
+		server, llm := newLLM(t, Options{})
+
+		_, err := llm.Complete("the question")
+		assert.NoError(t, err)
+
+		requests := server.Requests()
+		if assert.Len(t, requests, 1) {
+			_, ok := requests[0].Message("system")
+			assert.False(t, ok, "no system message must be sent without a system prompt")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			respond func(s *Server)
+			kind    error
+			message string
+		}{
+			{"server error", func(s *Server) { s.RespondError(http.StatusInternalServerError, "boom") }, nodes.ErrLLM, "boom"},
+			{"rate limit", func(s *Server) { s.RespondError(http.StatusTooManyRequests, "slow down") }, nodes.ErrLLMQuota, "slow down"},
+			{"unauthorized", func(s *Server) { s.RespondError(http.StatusUnauthorized, "bad key") }, nodes.ErrLLMAuth, "bad key"},
+			{"gateway timeout", func(s *Server) { s.RespondRaw(http.StatusGatewayTimeout, "<html>timeout</html>") }, nodes.ErrTimeout, ""},
+			{"malformed body", func(s *Server) { s.RespondRaw(http.StatusOK, "{") }, nodes.ErrLLM, ""},
+			{"no choices", func(s *Server) { s.RespondRaw(http.StatusOK, `{"choices": []}`) }, nodes.ErrLLM, ""},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				server, llm := newLLM(t, Options{})
+				tt.respond(server)
+
+				got, err := llm.Complete("the question")
+				assert.Empty(t, got)
+				assert.ErrorIs(t, err, tt.kind)
+				if tt.message != "" {
+					assert.ErrorContains(t, err, tt.message, "the message of the API must be surfaced")
+				}
+			})
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		server, llm := newLLM(t, Options{})
+		server.Close()
+
+		_, err := llm.Complete("the question")
+		assert.ErrorIs(t, err, nodes.ErrLLM)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		timeout := 100 * time.Millisecond
+		server, llm := newLLM(t, Options{Timeout: timeout})
+		server.Delay(5 * time.Second)
+
+		started := time.Now()
+		_, err := llm.Complete("the question")
+		elapsed := time.Since(started)
+
+		assert.ErrorIs(t, err, nodes.ErrTimeout)
+		assert.Less(t, elapsed, 2*time.Second, "the request must be cancelled after the timeout")
+	})
+}
+
+// CheckBearerToken returns a CheckRequest function that expects key as bearer token
+func CheckBearerToken(key string) func(r *Request) error {
+	return func(r *Request) error {
+		if got := r.Header.Get("Authorization"); got != "Bearer "+key {
+			return fmt.Errorf("expected bearer token, got Authorization: %q", got)
+		}
+		return nil
+	}
+}
+
+// CheckHeader returns a CheckRequest function that expects a header value
+func CheckHeader(name, value string) func(r *Request) error {
+	return func(r *Request) error {
+		if got := r.Header.Get(name); got != value {
+			return fmt.Errorf("expected header %s: %q, got %q", name, value, got)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	// FormatText writes human readable key=value lines
+	FormatText = "text"
+
+	// FormatJSON writes one JSON object per line
+	FormatJSON = "json"
+)
+
+// LevelTrace is below debug and is used for raw payloads and other very detailed output
+const LevelTrace = slog.Level(-8)
+
+// Options configures the logger created by New
+type Options struct {
+	// Level is the minimum level written: trace, debug, info, warn or error
+	Level string
+
+	// Format is FormatText (default) or FormatJSON
+	Format string
+
+	// File is the file the logs are appended to; empty means standard error
+	File string
+}
+
+// ParseLevel converts a level name into a slog.Level
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q (expected trace, debug, info, warn or error)", name)
+	}
+}
+
+// LevelForVerbosity maps the number of -v flags to a log level:
+// none shows warnings, -v progress (info), -vv prompts and decisions (debug)
+// and -vvv raw payloads (trace)
+func LevelForVerbosity(verbosity int) slog.Level {
+	switch {
+	case verbosity <= 0:
+		return slog.LevelWarn
+	case verbosity == 1:
+		return slog.LevelInfo
+	case verbosity == 2:
+		return slog.LevelDebug
+	default:
+		return LevelTrace
+	}
+}
+
+// New creates a logger from the options
+// The returned closer must be closed when logging is done (it is a no-op for standard error)
+func New(opts Options) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewWithLevel(opts, level)
+}
+
+// NewWithLevel creates a logger from the options using level instead of opts.Level
+func NewWithLevel(opts Options, level slog.Level) (*slog.Logger, io.Closer, error) {
+	var w io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %v", err)
+		}
+		w = file
+		closer = file
+	}
+
+	handler, err := NewHandler(w, opts.Format, level)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+	return slog.New(handler), closer, nil
+}
+
+// NewHandler creates a text or JSON handler writing to w
+func NewHandler(w io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevelName}
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		return slog.NewTextHandler(w, handlerOpts), nil
+	case FormatJSON:
+		return slog.NewJSONHandler(w, handlerOpts), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (expected %q or %q)", format, FormatText, FormatJSON)
+	}
+}
+
+// replaceLevelName prints LevelTrace as TRACE instead of DEBUG-4
+func replaceLevelName(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := attr.Value.Any().(slog.Level); ok && level <= LevelTrace {
+			attr.Value = slog.StringValue("TRACE")
+		}
+	}
+	return attr
+}
+
+// Discard returns a logger that drops all records
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// nopCloser is the closer returned when logging to standard error
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected slog.Level
+		wantErr  bool
+	}{
+		{"trace", LevelTrace, false},
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"", slog.LevelInfo, false},
+		{"warning", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+
+	for _, tt := range tests {
+		level, err := ParseLevel(tt.name)
+		if tt.wantErr {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.expected, level, tt.name)
+	}
+}
+
+func TestNewHandler_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := NewHandler(&buf, FormatJSON, slog.LevelInfo)
+	assert.NoError(t, err)
+
+	logger := slog.New(handler).With("node", "bash")
+	logger.Debug("hidden")
+	logger.Info("executing command", "command", "ls")
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "executing command", record["msg"])
+	assert.Equal(t, "bash", record["node"])
+	assert.Equal(t, "ls", record["command"])
+
+	_, err = NewHandler(&buf, "xml", slog.LevelInfo)
+	assert.Error(t, err)
+}
+
+func TestNew_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aiagent.log")
+	logger, closer, err := New(Options{Level: "warn", File: path})
+	assert.NoError(t, err)
+
+	logger.Info("hidden")
+	logger.Warn("failed to save transcript")
+	assert.NoError(t, closer.Close())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(data), "hidden"))
+	assert.Contains(t, string(data), `msg="failed to save transcript"`)
+}
+
+func TestLevelForVerbosity(t *testing.T) {
+	assert.Equal(t, slog.LevelWarn, LevelForVerbosity(0))
+	assert.Equal(t, slog.LevelInfo, LevelForVerbosity(1))
+	assert.Equal(t, slog.LevelDebug, LevelForVerbosity(2))
+	assert.Equal(t, LevelTrace, LevelForVerbosity(3))
+	assert.Equal(t, LevelTrace, LevelForVerbosity(5))
+}
+
+func TestNewHandler_TraceLevelName(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := NewHandler(&buf, FormatText, LevelTrace)
+	assert.NoError(t, err)
+
+	slog.New(handler).Log(context.Background(), LevelTrace, "llm request")
+	assert.Contains(t, buf.String(), "level=TRACE")
+}
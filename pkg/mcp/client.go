@@ -0,0 +1,245 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// shutdownGrace is how long Close waits for a server process to exit before killing it
+const shutdownGrace = 2 * time.Second
+
+// ErrClientClosed is returned for calls on a client whose connection ended
+var ErrClientClosed = errors.New("MCP connection closed")
+
+// Client calls the tools of an MCP server
+type Client struct {
+	w   io.WriteCloser
+	cmd *exec.Cmd
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[string]chan *Response
+	err     error
+	done    chan struct{}
+}
+
+// message is a message received by the client: a response, or a request of the server
+type message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// NewClient creates a client exchanging newline delimited JSON-RPC messages over r and w
+// Initialize must be called before the tools are used
+func NewClient(r io.Reader, w io.WriteCloser) *Client {
+	c := &Client{
+		w:       w,
+		pending: make(map[string]chan *Response),
+		done:    make(chan struct{}),
+	}
+	go c.read(r)
+	return c
+}
+
+// StartClient starts an MCP server process and initializes the client talking to it over
+// stdio; env is added to the environment of the current process
+func StartClient(ctx context.Context, command string, args []string, env map[string]string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for name, value := range env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %v", command, err)
+	}
+
+	c := NewClient(stdout, stdin)
+	c.cmd = cmd
+	if _, err := c.Initialize(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Initialize performs the handshake with the server
+func (c *Client) Initialize(ctx context.Context) (*InitializeResult, error) {
+	var result InitializeResult
+	params := InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: "aiagent", Version: "1.0"},
+	}
+	if err := c.call(ctx, MethodInitialize, params, &result); err != nil {
+		return nil, fmt.Errorf("failed to initialize MCP session: %w", err)
+	}
+	if err := c.send(&Request{JSONRPC: jsonRPCVersion, Method: MethodInitialized}); err != nil {
+		return nil, fmt.Errorf("failed to initialize MCP session: %w", err)
+	}
+	return &result, nil
+}
+
+// ListTools returns the tools offered by the server
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var result ListToolsResult
+	if err := c.call(ctx, MethodToolsList, struct{}{}, &result); err != nil {
+		return nil, fmt.Errorf("failed to list MCP tools: %w", err)
+	}
+	return result.Tools, nil
+}
+
+// CallTool calls a tool of the server; a failed tool is reported by the IsError field of
+// the result, not as an error
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*ToolResult, error) {
+	var result ToolResult
+	if err := c.call(ctx, MethodToolsCall, CallToolParams{Name: name, Arguments: arguments}, &result); err != nil {
+		return nil, fmt.Errorf("failed to call MCP tool %s: %w", name, err)
+	}
+	return &result, nil
+}
+
+// Close ends the connection and stops the server process, if the client started it
+func (c *Client) Close() error {
+	err := c.w.Close()
+	if c.cmd != nil {
+		// Servers exit when stdin is closed; the process is killed if it does not
+		select {
+		case <-c.done:
+		case <-time.After(shutdownGrace):
+		}
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	}
+	return err
+}
+
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode parameters: %v", err)
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := strconv.Itoa(c.nextID)
+	answer := make(chan *Response, 1)
+	c.pending[id] = answer
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(&Request{JSONRPC: jsonRPCVersion, ID: json.RawMessage(id), Method: method, Params: data}); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-answer:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("invalid result: %v", err)
+		}
+		return nil
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) send(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%w: %v", ErrClientClosed, err)
+	}
+	return nil
+}
+
+// read delivers the responses of the server until the connection ends
+func (c *Client) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			slog.Warn("ignoring invalid MCP message", "error", err)
+			continue
+		}
+
+		if msg.Method != "" {
+			c.answerServer(&msg)
+			continue
+		}
+
+		c.mu.Lock()
+		answer, ok := c.pending[string(msg.ID)]
+		c.mu.Unlock()
+		if ok {
+			answer <- &Response{JSONRPC: jsonRPCVersion, ID: msg.ID, Result: msg.Result, Error: msg.Error}
+		}
+	}
+
+	err := ErrClientClosed
+	if scanErr := scanner.Err(); scanErr != nil {
+		err = fmt.Errorf("%w: %v", ErrClientClosed, scanErr)
+	}
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// answerServer answers requests of the server; only ping is supported
+func (c *Client) answerServer(msg *message) {
+	if len(msg.ID) == 0 {
+		return // Notifications, e.g. of changed tools, are ignored
+	}
+	resp := &Response{JSONRPC: jsonRPCVersion, ID: msg.ID}
+	if msg.Method == MethodPing {
+		resp.Result = json.RawMessage("{}")
+	} else {
+		resp.Error = &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+	}
+	if err := c.send(resp); err != nil {
+		slog.Warn("failed to answer MCP request", "method", msg.Method, "error", err)
+	}
+}
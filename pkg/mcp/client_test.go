@@ -0,0 +1,70 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// connect returns a client talking to server over pipes
+func connect(t *testing.T, server *Server) *Client {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	go func() {
+		server.Serve(context.Background(), serverReader, serverWriter)
+		serverWriter.Close()
+	}()
+
+	client := NewClient(clientReader, clientWriter)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClient(t *testing.T) {
+	client := connect(t, newEchoServer())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := client.Initialize(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, Implementation{Name: "test", Version: "1.0"}, info.ServerInfo)
+
+	tools, err := client.ListTools(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, tools, 1) {
+		assert.Equal(t, "echo", tools[0].Name)
+	}
+
+	result, err := client.CallTool(ctx, "echo", json.RawMessage(`{"text": "hi"}`))
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Equal(t, "hi", result.Text())
+
+	result, err = client.CallTool(ctx, "echo", json.RawMessage(`{}`))
+	assert.NoError(t, err, "a failing tool is a result, not an error")
+	assert.True(t, result.IsError)
+	assert.Equal(t, "text is required", result.Text())
+
+	_, err = client.CallTool(ctx, "missing", nil)
+	var rpcErr *Error
+	if assert.ErrorAs(t, err, &rpcErr) {
+		assert.Equal(t, CodeInvalidParams, rpcErr.Code)
+	}
+}
+
+func TestClient_ConnectionClosed(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	go io.Copy(io.Discard, serverReader)
+	client := NewClient(clientReader, clientWriter)
+	serverWriter.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.ListTools(ctx)
+	assert.ErrorIs(t, err, ErrClientClosed)
+}
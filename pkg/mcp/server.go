@@ -0,0 +1,149 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// maxMessageSize is the maximum size of a message read by Serve
+const maxMessageSize = 10 << 20
+
+// ToolHandler runs a tool with the arguments sent by the client
+// An error is reported to the client as a failed tool result
+type ToolHandler func(ctx context.Context, arguments json.RawMessage) (*ToolResult, error)
+
+// Server answers the requests of an MCP client, offering its tools
+type Server struct {
+	info     Implementation
+	tools    []Tool
+	handlers map[string]ToolHandler
+}
+
+// NewServer creates a new instance of Server
+func NewServer(name, version string) *Server {
+	return &Server{
+		info:     Implementation{Name: name, Version: version},
+		handlers: make(map[string]ToolHandler),
+	}
+}
+
+// AddTool offers a tool to the clients, replacing a tool with the same name
+func (s *Server) AddTool(tool Tool, handler ToolHandler) {
+	if _, ok := s.handlers[tool.Name]; !ok {
+		s.tools = append(s.tools, tool)
+	} else {
+		for i := range s.tools {
+			if s.tools[i].Name == tool.Name {
+				s.tools[i] = tool
+			}
+		}
+	}
+	s.handlers[tool.Name] = handler
+}
+
+// Serve reads newline delimited JSON-RPC messages from r and writes the responses to w,
+// the stdio transport of the protocol, until r ends or ctx is done
+// Requests are answered one at a time in the order they arrive
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if resp := s.Handle(ctx, line); resp != nil {
+			if err := encoder.Encode(resp); err != nil {
+				slog.Warn("failed to write MCP response", "error", err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read MCP message: %v", err)
+	}
+	return nil
+}
+
+// Handle answers a single JSON-RPC message; notifications get no response
+func (s *Server) Handle(ctx context.Context, message []byte) *Response {
+	var req Request
+	if err := json.Unmarshal(message, &req); err != nil {
+		return errorResponse(nil, CodeParseError, fmt.Sprintf("invalid JSON: %v", err))
+	}
+	if req.JSONRPC != jsonRPCVersion || req.Method == "" {
+		if req.IsNotification() {
+			return nil
+		}
+		return errorResponse(req.ID, CodeInvalidRequest, "invalid JSON-RPC request")
+	}
+
+	result, rpcErr := s.dispatch(ctx, &req)
+	if req.IsNotification() {
+		return nil
+	}
+	if rpcErr != nil {
+		return errorResponse(req.ID, rpcErr.Code, rpcErr.Message)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, CodeInternalError, fmt.Sprintf("failed to encode result: %v", err))
+	}
+	return &Response{JSONRPC: jsonRPCVersion, ID: req.ID, Result: data}
+}
+
+func (s *Server) dispatch(ctx context.Context, req *Request) (any, *Error) {
+	switch req.Method {
+	case MethodInitialize:
+		return InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]any{"tools": map[string]any{}},
+			ServerInfo:      s.info,
+		}, nil
+	case MethodInitialized:
+		return nil, nil
+	case MethodPing:
+		return struct{}{}, nil
+	case MethodToolsList:
+		tools := s.tools
+		if tools == nil {
+			tools = []Tool{}
+		}
+		return ListToolsResult{Tools: tools}, nil
+	case MethodToolsCall:
+		var params CallToolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid parameters: %v", err)}
+		}
+		handler, ok := s.handlers[params.Name]
+		if !ok {
+			return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("unknown tool: %s", params.Name)}
+		}
+		arguments := params.Arguments
+		if len(arguments) == 0 {
+			arguments = json.RawMessage("{}")
+		}
+		result, err := handler(ctx, arguments)
+		if err != nil {
+			return ErrorResult(err), nil
+		}
+		return result, nil
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+	}
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *Response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &Response{JSONRPC: jsonRPCVersion, ID: id, Error: &Error{Code: code, Message: message}}
+}
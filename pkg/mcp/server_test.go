@@ -0,0 +1,97 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newEchoServer() *Server {
+	server := NewServer("test", "1.0")
+	server.AddTool(Tool{Name: "echo", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, arguments json.RawMessage) (*ToolResult, error) {
+			var args struct {
+				Text string `json:"text"`
+			}
+			json.Unmarshal(arguments, &args)
+			if args.Text == "" {
+				return nil, errors.New("text is required")
+			}
+			return TextResult(args.Text), nil
+		})
+	return server
+}
+
+func TestServer_Handle(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		result  string
+		code    int
+	}{
+		{"initialize", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+			`{"protocolVersion":"2024-11-05","capabilities":{"tools":{}},"serverInfo":{"name":"test","version":"1.0"}}`, 0},
+		{"ping", `{"jsonrpc":"2.0","id":"a","method":"ping"}`, `{}`, 0},
+		{"list tools", `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+			`{"tools":[{"name":"echo","inputSchema":{"type":"object"}}]}`, 0},
+		{"call tool", `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+			`{"content":[{"type":"text","text":"hi"}]}`, 0},
+		{"failing tool", `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"echo"}}`,
+			`{"content":[{"type":"text","text":"text is required"}],"isError":true}`, 0},
+		{"unknown tool", `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"rm"}}`, "", CodeInvalidParams},
+		{"unknown method", `{"jsonrpc":"2.0","id":6,"method":"resources/list"}`, "", CodeMethodNotFound},
+		{"invalid JSON", `{"jsonrpc":`, "", CodeParseError},
+		{"not JSON-RPC 2.0", `{"id":7,"method":"ping"}`, "", CodeInvalidRequest},
+	}
+
+	server := newEchoServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := server.Handle(context.Background(), []byte(tt.message))
+			if !assert.NotNil(t, resp) {
+				return
+			}
+			assert.Equal(t, "2.0", resp.JSONRPC)
+			if tt.code != 0 {
+				if assert.NotNil(t, resp.Error) {
+					assert.Equal(t, tt.code, resp.Error.Code)
+				}
+				return
+			}
+			assert.Nil(t, resp.Error)
+			assert.JSONEq(t, tt.result, string(resp.Result))
+		})
+	}
+}
+
+func TestServer_Notifications(t *testing.T) {
+	server := newEchoServer()
+	assert.Nil(t, server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)))
+	assert.Nil(t, server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{}}`)),
+		"unknown notifications must be ignored")
+}
+
+func TestServer_Serve(t *testing.T) {
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		``,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+	}, "\n")
+	var output bytes.Buffer
+
+	assert.NoError(t, newEchoServer().Serve(context.Background(), strings.NewReader(input), &output))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if assert.Len(t, lines, 2, "one response per request, none for notifications") {
+		var resp Response
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &resp))
+		assert.Equal(t, "2", string(resp.ID))
+		assert.JSONEq(t, `{"content":[{"type":"text","text":"hi"}]}`, string(resp.Result))
+	}
+}
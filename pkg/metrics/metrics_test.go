@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	registry := NewRegistry()
+	runs := registry.NewCounter("aiagent_runs_total", "Graph runs by outcome.", "status")
+	duration := registry.NewHistogram("aiagent_node_duration_seconds", "Duration of node processing.", []float64{1, 0.1}, "node")
+
+	runs.Inc("completed")
+	runs.Inc("completed")
+	runs.Add(-1, "completed") // Counters never decrease
+	runs.Inc("failed")
+	duration.Observe(0.05, "bash")
+	duration.Observe(0.5, "bash")
+	duration.Observe(5, "bash")
+
+	assert.Equal(t, float64(2), runs.Value("completed"))
+	assert.Equal(t, uint64(3), duration.Count("bash"))
+
+	var sb strings.Builder
+	_, err := registry.WriteTo(&sb)
+	assert.NoError(t, err)
+
+	expected := `# HELP aiagent_runs_total Graph runs by outcome.
+# TYPE aiagent_runs_total counter
+aiagent_runs_total{status="completed"} 2
+aiagent_runs_total{status="failed"} 1
+# HELP aiagent_node_duration_seconds Duration of node processing.
+# TYPE aiagent_node_duration_seconds histogram
+aiagent_node_duration_seconds_bucket{node="bash",le="0.1"} 1
+aiagent_node_duration_seconds_bucket{node="bash",le="1"} 2
+aiagent_node_duration_seconds_bucket{node="bash",le="+Inf"} 3
+aiagent_node_duration_seconds_sum{node="bash"} 5.55
+aiagent_node_duration_seconds_count{node="bash"} 3
+`
+	assert.Equal(t, expected, sb.String())
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("aiagent_commands_total", "Generated commands.", "status")
+	counter.Inc("rejected \"quoted\"\n")
+	registry.NewHistogram("aiagent_run_duration_seconds", "Duration of graph runs.", DefaultBuckets).Observe(2)
+
+	recorder := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := io.ReadAll(recorder.Body)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "version=0.0.4")
+	assert.Contains(t, string(body), `aiagent_commands_total{status="rejected \"quoted\"\n"} 1`)
+	assert.Contains(t, string(body), `aiagent_run_duration_seconds_bucket{le="2.5"} 1`)
+	assert.Contains(t, string(body), "aiagent_run_duration_seconds_count 1")
+}
+
+func TestRegistry_Misuse(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("aiagent_runs_total", "Graph runs.", "status")
+
+	assert.Panics(t, func() { registry.NewCounter("aiagent_runs_total", "Duplicate.") })
+	assert.Panics(t, func() { counter.Inc() })
+}
+
+func TestGauge(t *testing.T) {
+	registry := NewRegistry()
+	lastRun := registry.NewGauge("aiagent_last_run_info", "Most recent run.", "run_id")
+
+	lastRun.Set(1, "run-1")
+	lastRun.Reset()
+	lastRun.Set(2, "run-2")
+
+	assert.Equal(t, float64(0), lastRun.Value("run-1"))
+	assert.Equal(t, float64(2), lastRun.Value("run-2"))
+
+	var sb strings.Builder
+	_, err := registry.WriteTo(&sb)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP aiagent_last_run_info Most recent run.
+# TYPE aiagent_last_run_info gauge
+aiagent_last_run_info{run_id="run-2"} 2
+`, sb.String())
+}
@@ -1,9 +1,10 @@
 package nodes
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
+
+	"aiagent/pkg/prompts"
 )
 
 // AnalyticsNodeInterface defines the operations for an analytics node
@@ -21,33 +22,47 @@ type AnalyticsNodeInterface interface {
 // AnalyticsNode implements the analytics node logic
 type AnalyticsNode struct {
 	llm LLM
+
+	// MaxHotspots is the number of the most complex functions of the working directory
+	// added to the answers about maintainability; 0 adds none
+	MaxHotspots int
 }
 
 // NewAnalyticsNode creates a new analytics node
 func NewAnalyticsNode(llm LLM) *AnalyticsNode {
 	return &AnalyticsNode{
-		llm: llm,
+		llm:         llm,
+		MaxHotspots: maxHotspots,
 	}
 }
 
 // Process implements the Node interface for AnalyticsNode
 func (n *AnalyticsNode) Process(state *State) error {
+	// Questions about maintainability are answered with the most complex functions
+	var complexity string
+	if n.MaxHotspots > 0 && (maintainabilityPattern.MatchString(state.GetGlobalGoal()) || maintainabilityPattern.MatchString(state.GetCurrentTask().Goal)) {
+		report, err := MeasureComplexity(state.GetWorkingDirectory())
+		if err != nil {
+			state.NodeLogger(NodeTypeAnalytics).Warn("no complexity metrics", "error", err)
+		} else {
+			complexity = report.String(n.MaxHotspots)
+		}
+	}
+
 	// Analyze task history and state
-	prompt := fmt.Sprintf(`Analyze the task history and current state to provide insights:
-Global Goal: %s
-Task History: %v
-Current State: %s
-
-Return JSON response with:
-{
-    "insights": ["insight1", "insight2"],
-    "recommendations": ["recommendation1", "recommendation2"],
-    "explanation": "explanation of the analysis"
-}`, state.GlobalGoal, state.TaskHistory, state.CurrentTask.Result)
+	prompt, err := state.RenderPrompt(prompts.AnalyticsAnalyze, prompts.Vars{
+		"GlobalGoal":  state.GetGlobalGoal(),
+		"TaskHistory": state.GetTaskHistory(),
+		"Result":      state.GetCurrentTask().Result,
+		"Complexity":  complexity,
+	})
+	if err != nil {
+		return err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return fmt.Errorf("LLM error: %v", err)
+		return fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
@@ -55,8 +70,8 @@ Return JSON response with:
 		Recommendations []string `json:"recommendations"`
 		Explanation     string   `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return fmt.Errorf("failed to parse analytics response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return fmt.Errorf("failed to parse analytics response: %w", withKind(ErrParse, err))
 	}
 
 	// Format insights
@@ -70,12 +85,15 @@ Return JSON response with:
 		output += fmt.Sprintf("- %s\n", rec)
 	}
 	output += "\n" + result.Explanation
+	if complexity != "" {
+		output += "\n\nComplexity hotspots:\n" + complexity
+	}
 
-	state.RawOutput = output
-	state.FinalResult = output
+	state.SetRawOutput(output)
+	state.SetFinalResult(output)
 
 	// The analytics response should go directly to the terminal
-	state.NextNode = NodeTypeTerminal
+	state.SetNextNode(NodeTypeTerminal)
 
 	return nil
 }
@@ -85,7 +103,8 @@ func (n *AnalyticsNode) Type() NodeType {
 }
 
 // prepareDirectoryInfo formats directory information for the LLM
-func (n *AnalyticsNode) prepareDirectoryInfo(contents []FileContent) (string, string) {
+// File contents are loaded as they are included, so the files beyond the limit are never read
+func (n *AnalyticsNode) prepareDirectoryInfo(state *State, contents []FileContent) (string, string) {
 	var dirStructure strings.Builder
 	var fileContents strings.Builder
 
@@ -106,14 +125,17 @@ func (n *AnalyticsNode) prepareDirectoryInfo(contents []FileContent) (string, st
 	maxContentSize := 100000 // Limit total content to ~100KB to avoid overwhelming the LLM
 
 	for _, item := range contents {
-		if !item.IsDir && len(item.Content) > 0 {
+		if !item.IsDir && (item.Readable || len(item.Content) > 0) {
 			// Skip if we've already included too much content
 			if totalContentSize > maxContentSize {
 				continue
 			}
 
 			// Truncate very large files
-			content := item.Content
+			content := state.LoadFileContent(item)
+			if content == "" {
+				continue
+			}
 			if len(content) > 10000 {
 				content = content[:10000] + "... [truncated]"
 			}
@@ -128,3 +150,11 @@ func (n *AnalyticsNode) prepareDirectoryInfo(contents []FileContent) (string, st
 
 	return dirStructure.String(), fileContents.String()
 }
+
+// Describe implements the Describer interface for AnalyticsNode
+func (n *AnalyticsNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeAnalytics,
+		Description: "draws insights from the results of the tasks done so far, and finds the code that is hardest to maintain by its complexity",
+	}
+}
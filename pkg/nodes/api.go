@@ -0,0 +1,223 @@
+package nodes
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxAPIPromptBytes caps the API reference added to a prompt
+const maxAPIPromptBytes = 20000
+
+// apiPattern matches goals asking about the exported API of the code, which are answered
+// with its API reference
+var apiPattern = regexp.MustCompile(`(?i)\b(public api|api surface|api reference|api docs?|exported (types|functions|methods|symbols|identifiers|api)|public (interface|functions|types|methods))\b`)
+
+// APIDecl is an exported declaration of a package
+type APIDecl struct {
+	// Kind is const, var, func, type or method
+	Kind string `json:"kind"`
+
+	// Name is the name of the declaration, Type.Method for a method and the names separated
+	// by commas for a group of constants or variables
+	Name string `json:"name"`
+
+	// Signature is the declaration without its doc comment and function body
+	Signature string `json:"signature"`
+
+	Doc string `json:"doc,omitempty"`
+}
+
+// APIPackage is the exported API of a package
+type APIPackage struct {
+	ImportPath string    `json:"import_path"`
+	Name       string    `json:"name"`
+	Doc        string    `json:"doc,omitempty"`
+	Decls      []APIDecl `json:"decls"`
+}
+
+// APIReference is the exported API of the packages of a Go module
+type APIReference struct {
+	Module   string       `json:"module"`
+	Packages []APIPackage `json:"packages"`
+}
+
+// ExtractAPI reads the exported declarations of the packages of the Go module in dir with
+// their doc comments; main packages, internal packages, tests, hidden directories, vendor
+// and testdata are skipped. Packages are sorted by import path, the declarations are in
+// the order of go doc: constants, variables, functions, then types with their constructors
+// and methods
+func ExtractAPI(dir string) (*APIReference, error) {
+	module, err := modulePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	files := make(map[string][]*ast.File)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata" || name == "internal") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, p, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil // A file that does not parse adds no declarations
+		}
+		if file.Name.Name != "main" {
+			files[filepath.Dir(p)] = append(files[filepath.Dir(p)], file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the packages: %v", err)
+	}
+
+	ref := &APIReference{Module: module}
+	for pkgDir, pkgFiles := range files {
+		rel, err := filepath.Rel(dir, pkgDir)
+		if err != nil {
+			return nil, err
+		}
+		importPath := path.Join(module, filepath.ToSlash(rel))
+		pkg, err := doc.NewFromFiles(fset, pkgFiles, importPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the documentation of %s: %v", importPath, err)
+		}
+		ref.Packages = append(ref.Packages, apiPackage(fset, pkg))
+	}
+	sort.Slice(ref.Packages, func(i, j int) bool { return ref.Packages[i].ImportPath < ref.Packages[j].ImportPath })
+	return ref, nil
+}
+
+// apiPackage returns the exported declarations of the documentation of a package
+func apiPackage(fset *token.FileSet, pkg *doc.Package) APIPackage {
+	p := APIPackage{ImportPath: pkg.ImportPath, Name: pkg.Name, Doc: strings.TrimSpace(pkg.Doc)}
+	values := func(kind string, values []*doc.Value) {
+		for _, v := range values {
+			p.Decls = append(p.Decls, APIDecl{Kind: kind, Name: strings.Join(v.Names, ", "), Signature: signature(fset, v.Decl), Doc: strings.TrimSpace(v.Doc)})
+		}
+	}
+	funcs := func(funcs []*doc.Func) {
+		for _, f := range funcs {
+			decl := APIDecl{Kind: "func", Name: f.Name, Signature: signature(fset, f.Decl), Doc: strings.TrimSpace(f.Doc)}
+			if f.Recv != "" {
+				decl.Kind = "method"
+				decl.Name = strings.TrimPrefix(f.Recv, "*") + "." + f.Name
+			}
+			p.Decls = append(p.Decls, decl)
+		}
+	}
+
+	values("const", pkg.Consts)
+	values("var", pkg.Vars)
+	funcs(pkg.Funcs)
+	for _, t := range pkg.Types {
+		p.Decls = append(p.Decls, APIDecl{Kind: "type", Name: t.Name, Signature: signature(fset, t.Decl), Doc: strings.TrimSpace(t.Doc)})
+		values("const", t.Consts)
+		values("var", t.Vars)
+		funcs(t.Funcs)
+		funcs(t.Methods)
+	}
+	return p
+}
+
+// signature prints a declaration without its doc comment and, for a function, its body
+func signature(fset *token.FileSet, decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		copied := *d
+		copied.Doc, copied.Body = nil, nil
+		decl = &copied
+	case *ast.GenDecl:
+		copied := *d
+		copied.Doc = nil
+		decl = &copied
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, decl); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// String lists the declarations of the packages with the first line of their doc comments,
+// one declaration per line; the fields of the structs and interfaces are left out
+func (r *APIReference) String() string {
+	var sb strings.Builder
+	for _, pkg := range r.Packages {
+		fmt.Fprintf(&sb, "package %s%s\n", pkg.ImportPath, docSummary(pkg.Doc))
+		for _, decl := range pkg.Decls {
+			line, _, multiline := strings.Cut(decl.Signature, "\n")
+			switch {
+			case !multiline:
+			case decl.Kind == "const" || decl.Kind == "var":
+				line = fmt.Sprintf("%s ( %s )", decl.Kind, decl.Name)
+			case strings.HasSuffix(line, "{"):
+				line += " ... }"
+			}
+			fmt.Fprintf(&sb, "  %s%s\n", line, docSummary(decl.Doc))
+		}
+	}
+	return sb.String()
+}
+
+// docSummary returns the first line of a doc comment as a line comment, empty without one
+func docSummary(doc string) string {
+	line, _, _ := strings.Cut(doc, "\n")
+	if line == "" {
+		return ""
+	}
+	return " // " + line
+}
+
+// Summary is String cut at the last whole line within limit bytes
+func (r *APIReference) Summary(limit int) string {
+	summary := r.String()
+	if len(summary) <= limit {
+		return summary
+	}
+	cut := strings.LastIndex(summary[:limit], "\n") + 1
+	return summary[:cut] + "... (truncated)\n"
+}
+
+// Markdown renders the reference with a section per package and the full signature and doc
+// comment of every declaration
+func (r *APIReference) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# API of %s\n", r.Module)
+	if len(r.Packages) == 0 {
+		sb.WriteString("\nNo exported packages found.\n")
+	}
+	for _, pkg := range r.Packages {
+		fmt.Fprintf(&sb, "\n## package %s\n", pkg.ImportPath)
+		if pkg.Doc != "" {
+			fmt.Fprintf(&sb, "\n%s\n", pkg.Doc)
+		}
+		for _, decl := range pkg.Decls {
+			fmt.Fprintf(&sb, "\n### %s %s\n\n```go\n%s\n```\n", decl.Kind, decl.Name, decl.Signature)
+			if decl.Doc != "" {
+				fmt.Fprintf(&sb, "\n%s\n", decl.Doc)
+			}
+		}
+	}
+	return sb.String()
+}
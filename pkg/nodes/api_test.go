@@ -0,0 +1,101 @@
+package nodes
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const storeGo = `// Package store keeps the orders
+// in a file
+package store
+
+// ErrNotFound is returned for unknown orders
+var ErrNotFound = errors.New("not found")
+
+const (
+	// Version of the file format
+	Version = 2
+	internalVersion = 1
+)
+
+// DB is an open store
+type DB struct {
+	// Path is the file of the store
+	Path string
+	orders map[string]int
+}
+
+// Open opens the store in path
+func Open(path string) (*DB, error) {
+	return &DB{Path: path}, nil
+}
+
+// Get returns an order
+func (db *DB) Get(id string) (int, error) { return db.orders[id], nil }
+
+func (db *DB) load() {}
+
+func helper() {}
+`
+
+func TestExtractAPI(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{
+		"go.mod":                  "module example.com/shop\n",
+		"main.go":                 "package main\n\nfunc Run() {}\n",
+		"store/store.go":          storeGo,
+		"store/store_test.go":     "package store\n\nfunc TestHelper() {}\n",
+		"internal/cache/cache.go": "package cache\n\nfunc Get() {}\n",
+	})
+
+	ref, err := ExtractAPI(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/shop", ref.Module)
+	require.Len(t, ref.Packages, 1, "main and internal packages are not part of the API")
+
+	pkg := ref.Packages[0]
+	assert.Equal(t, "example.com/shop/store", pkg.ImportPath)
+	assert.Equal(t, "store", pkg.Name)
+	assert.Equal(t, "Package store keeps the orders\nin a file", pkg.Doc)
+	assert.Equal(t, []APIDecl{
+		{Kind: "const", Name: "Version", Signature: "const (\n\t// Version of the file format\n\tVersion = 2\n)"},
+		{Kind: "var", Name: "ErrNotFound", Signature: "var ErrNotFound = errors.New(\"not found\")", Doc: "ErrNotFound is returned for unknown orders"},
+		{Kind: "type", Name: "DB", Signature: "type DB struct {\n\t// Path is the file of the store\n\tPath string\n\t// contains filtered or unexported fields\n}", Doc: "DB is an open store"},
+		{Kind: "func", Name: "Open", Signature: "func Open(path string) (*DB, error)", Doc: "Open opens the store in path"},
+		{Kind: "method", Name: "DB.Get", Signature: "func (db *DB) Get(id string) (int, error)", Doc: "Get returns an order"},
+	}, pkg.Decls)
+
+	assert.Equal(t, "package example.com/shop/store // Package store keeps the orders\n"+
+		"  const ( Version )\n"+
+		"  var ErrNotFound = errors.New(\"not found\") // ErrNotFound is returned for unknown orders\n"+
+		"  type DB struct { ... } // DB is an open store\n"+
+		"  func Open(path string) (*DB, error) // Open opens the store in path\n"+
+		"  func (db *DB) Get(id string) (int, error) // Get returns an order\n", ref.String())
+	assert.Equal(t, "package example.com/shop/store // Package store keeps the orders\n"+
+		"  const ( Version )\n... (truncated)\n", ref.Summary(100))
+
+	markdown := ref.Markdown()
+	assert.Contains(t, markdown, "# API of example.com/shop\n\n## package example.com/shop/store\n\nPackage store keeps the orders\nin a file\n")
+	assert.Contains(t, markdown, "\n### method DB.Get\n\n```go\nfunc (db *DB) Get(id string) (int, error)\n```\n\nGet returns an order\n")
+
+	_, err = ExtractAPI(t.TempDir())
+	assert.Error(t, err, "not a Go module")
+}
+
+func TestCodeAnalyzerNode_APIReference(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{"go.mod": "module example.com/shop\n", "store/store.go": storeGo})
+
+	llm := NewScriptedLLM()
+	llm.OnContains("determine if code content analysis is needed").Respond(`{"needs_content": true, "file_patterns": [` + strconv.Quote(filepath.Join(dir, "store/*.go")) + `]}`)
+	llm.OnContains("Exported API of the module, by package:\npackage example.com/shop/store").Respond(`{"analysis": "The store exposes Open and DB.Get."}`)
+	state := &State{WorkingDirectory: dir, FileSizeLimit: 4096, CurrentTask: TaskStatus{NodeType: NodeTypeCodeAnalyzer, Goal: "review the public API of the store"}}
+
+	require.NoError(t, NewCodeAnalyzerNode(llm).Process(state))
+	assert.True(t, llm.AssertExpectations(t))
+	assert.Equal(t, "The store exposes Open and DB.Get.", state.GetFinalResult())
+}
@@ -0,0 +1,227 @@
+package nodes
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formats of the architecture diagrams
+const (
+	DiagramMermaid  = "mermaid"
+	DiagramGraphviz = "graphviz"
+)
+
+// maxDiagramPackages is the number of packages above which the packages of a diagram are
+// merged by their parent directories, so the picture stays readable
+const maxDiagramPackages = 30
+
+// architecturePattern matches goals asking about the architecture of the code, which are
+// answered with a diagram of the packages
+var architecturePattern = regexp.MustCompile(`(?i)\b(architecture|diagram|dependency graph|package structure|layers|how .* fit together)\b`)
+
+// PackageGraph is the import graph of the packages of a Go module
+type PackageGraph struct {
+	Module string
+
+	// Packages are the directories of the packages relative to the module root, "." for the
+	// root package, sorted
+	Packages []string
+
+	// Imports are the packages of the module a package imports, sorted
+	Imports map[string][]string
+}
+
+// BuildPackageGraph reads the imports of the non-test Go files of the module in dir; hidden
+// directories, vendor and testdata are skipped
+func BuildPackageGraph(dir string) (*PackageGraph, error) {
+	module, err := modulePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	g := &PackageGraph{Module: module, Imports: make(map[string][]string)}
+	imports := make(map[string]map[string]bool)
+	fset := token.NewFileSet()
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, p, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil // A file that does not parse adds no imports
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		pkg := filepath.ToSlash(rel)
+		if imports[pkg] == nil {
+			imports[pkg] = make(map[string]bool)
+		}
+		for _, spec := range file.Imports {
+			target, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			switch {
+			case target == module:
+				target = "."
+			case strings.HasPrefix(target, module+"/"):
+				target = strings.TrimPrefix(target, module+"/")
+			default:
+				continue // Not a package of the module
+			}
+			if target != pkg {
+				imports[pkg][target] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the imports: %v", err)
+	}
+
+	for pkg, targets := range imports {
+		g.Packages = append(g.Packages, pkg)
+		for target := range targets {
+			// Packages with only test files, or in skipped directories, are not drawn
+			if _, ok := imports[target]; ok {
+				g.Imports[pkg] = append(g.Imports[pkg], target)
+			}
+		}
+		sort.Strings(g.Imports[pkg])
+	}
+	sort.Strings(g.Packages)
+	return g, nil
+}
+
+// Collapse merges the packages into their parent directories, deepest first, until there
+// are at most limit of them; an import between two merged packages is dropped
+func (g *PackageGraph) Collapse(limit int) *PackageGraph {
+	depth := 0
+	for _, pkg := range g.Packages {
+		depth = max(depth, strings.Count(pkg, "/")+1)
+	}
+	collapsed := g
+	for len(collapsed.Packages) > limit && depth > 1 {
+		depth--
+		collapsed = g.truncate(depth)
+	}
+	return collapsed
+}
+
+// truncate merges the packages into their directories of at most depth elements
+func (g *PackageGraph) truncate(depth int) *PackageGraph {
+	parent := func(pkg string) string {
+		parts := strings.Split(pkg, "/")
+		return strings.Join(parts[:min(depth, len(parts))], "/")
+	}
+	packages := make(map[string]bool)
+	imports := make(map[string]map[string]bool)
+	for _, pkg := range g.Packages {
+		from := parent(pkg)
+		packages[from] = true
+		for _, target := range g.Imports[pkg] {
+			if to := parent(target); to != from {
+				if imports[from] == nil {
+					imports[from] = make(map[string]bool)
+				}
+				imports[from][to] = true
+			}
+		}
+	}
+	t := &PackageGraph{Module: g.Module, Imports: make(map[string][]string)}
+	for pkg := range packages {
+		t.Packages = append(t.Packages, pkg)
+		for target := range imports[pkg] {
+			t.Imports[pkg] = append(t.Imports[pkg], target)
+		}
+		sort.Strings(t.Imports[pkg])
+	}
+	sort.Strings(t.Packages)
+	return t
+}
+
+// label returns the name of a package in a diagram; the root package is named by the module
+func (g *PackageGraph) label(pkg string) string {
+	if pkg == "." {
+		return path.Base(g.Module)
+	}
+	return pkg
+}
+
+// String lists the packages with the packages they import, one package per line
+func (g *PackageGraph) String() string {
+	var sb strings.Builder
+	for _, pkg := range g.Packages {
+		sb.WriteString(g.label(pkg))
+		if imports := g.Imports[pkg]; len(imports) > 0 {
+			labels := make([]string, len(imports))
+			for i, target := range imports {
+				labels[i] = g.label(target)
+			}
+			fmt.Fprintf(&sb, " -> %s", strings.Join(labels, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart, importers above the packages they import
+func (g *PackageGraph) Mermaid() string {
+	ids := make(map[string]string, len(g.Packages))
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+	for i, pkg := range g.Packages {
+		ids[pkg] = fmt.Sprintf("p%d", i)
+		fmt.Fprintf(&sb, "    %s[\"%s\"]\n", ids[pkg], g.label(pkg))
+	}
+	for _, pkg := range g.Packages {
+		for _, target := range g.Imports[pkg] {
+			fmt.Fprintf(&sb, "    %s --> %s\n", ids[pkg], ids[target])
+		}
+	}
+	return sb.String()
+}
+
+// DOT renders the graph in the Graphviz DOT language
+func (g *PackageGraph) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph architecture {\n    node [shape=box];\n")
+	for _, pkg := range g.Packages {
+		fmt.Fprintf(&sb, "    %q;\n", g.label(pkg))
+	}
+	for _, pkg := range g.Packages {
+		for _, target := range g.Imports[pkg] {
+			fmt.Fprintf(&sb, "    %q -> %q;\n", g.label(pkg), g.label(target))
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Diagram renders the graph as a fenced Markdown code block in format, DiagramMermaid or
+// DiagramGraphviz
+func (g *PackageGraph) Diagram(format string) string {
+	if format == DiagramGraphviz {
+		return "```dot\n" + g.DOT() + "```\n"
+	}
+	return "```mermaid\n" + g.Mermaid() + "```\n"
+}
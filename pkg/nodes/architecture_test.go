@@ -0,0 +1,91 @@
+package nodes
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeModule writes the files of a Go module, by path relative to dir
+func writeModule(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestBuildPackageGraph(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{
+		"go.mod":                   "module example.com/shop\n\ngo 1.24\n",
+		"main.go":                  "package main\n\nimport (\n\t\"fmt\"\n\t\"example.com/shop/internal/api\"\n)\n",
+		"internal/api/api.go":      "package api\n\nimport \"example.com/shop/internal/store\"\n",
+		"internal/api/api_test.go": "package api\n\nimport \"example.com/shop/internal/testutil\"\n",
+		"internal/store/store.go":  "package store\n\nimport \"example.com/shop\"\n",
+		"internal/testutil/t.go_":  "not go",
+		"vendor/x/x.go":            "package x\n",
+		"testdata/y.go":            "package y\n",
+	})
+
+	g, err := BuildPackageGraph(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/shop", g.Module)
+	assert.Equal(t, []string{".", "internal/api", "internal/store"}, g.Packages)
+	assert.Equal(t, "shop -> internal/api\ninternal/api -> internal/store\ninternal/store -> shop\n", g.String())
+
+	assert.Equal(t, "graph TD\n"+
+		"    p0[\"shop\"]\n    p1[\"internal/api\"]\n    p2[\"internal/store\"]\n"+
+		"    p0 --> p1\n    p1 --> p2\n    p2 --> p0\n", g.Mermaid())
+	assert.Equal(t, "digraph architecture {\n    node [shape=box];\n"+
+		"    \"shop\";\n    \"internal/api\";\n    \"internal/store\";\n"+
+		"    \"shop\" -> \"internal/api\";\n    \"internal/api\" -> \"internal/store\";\n    \"internal/store\" -> \"shop\";\n}\n", g.DOT())
+	assert.Equal(t, "```dot\n"+g.DOT()+"```\n", g.Diagram(DiagramGraphviz))
+	assert.Equal(t, "```mermaid\n"+g.Mermaid()+"```\n", g.Diagram(DiagramMermaid))
+
+	_, err = BuildPackageGraph(t.TempDir())
+	assert.Error(t, err, "not a Go module")
+}
+
+func TestPackageGraph_Collapse(t *testing.T) {
+	g := &PackageGraph{
+		Module:   "example.com/app",
+		Packages: []string{"cmd/app", "pkg/a/x", "pkg/a/y", "pkg/b"},
+		Imports: map[string][]string{
+			"cmd/app": {"pkg/a/x", "pkg/b"},
+			"pkg/a/x": {"pkg/a/y", "pkg/b"},
+		},
+	}
+	assert.Same(t, g, g.Collapse(4))
+
+	collapsed := g.Collapse(3)
+	assert.Equal(t, []string{"cmd/app", "pkg/a", "pkg/b"}, collapsed.Packages)
+	assert.Equal(t, map[string][]string{"cmd/app": {"pkg/a", "pkg/b"}, "pkg/a": {"pkg/b"}}, collapsed.Imports)
+
+	collapsed = g.Collapse(1)
+	assert.Equal(t, []string{"cmd", "pkg"}, collapsed.Packages, "the top-level directories are kept")
+	assert.Equal(t, "cmd -> pkg\npkg\n", collapsed.String())
+}
+
+func TestCodeAnalyzerNode_ArchitectureDiagram(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{
+		"go.mod":          "module example.com/app\n",
+		"cmd/app/main.go": "package main\n\nimport \"example.com/app/pkg/store\"\n",
+		"pkg/store/db.go": "package store\n",
+	})
+
+	llm := NewScriptedLLM()
+	llm.OnContains("determine if code content analysis is needed").Respond(`{"needs_content": true, "file_patterns": [` + strconv.Quote(filepath.Join(dir, "cmd/app/*.go")) + `]}`)
+	llm.OnContains("cmd/app -> pkg/store").Respond(`{"analysis": "The command uses the store."}`)
+	state := &State{WorkingDirectory: dir, FileSizeLimit: 1024, CurrentTask: TaskStatus{NodeType: NodeTypeCodeAnalyzer, Goal: "describe the architecture"}}
+
+	require.NoError(t, NewCodeAnalyzerNode(llm).Process(state))
+	assert.Equal(t, "The command uses the store.\n\n```mermaid\ngraph TD\n"+
+		"    p0[\"cmd/app\"]\n    p1[\"pkg/store\"]\n    p0 --> p1\n```\n", state.GetFinalResult())
+}
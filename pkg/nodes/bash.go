@@ -1,10 +1,16 @@
 package nodes
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/policy"
+	"aiagent/pkg/prompts"
 )
 
 // BashNodeInterface defines the operations for a bash node
@@ -20,63 +26,268 @@ type BashNodeInterface interface {
 	Process(state *State) (string, error)
 }
 
+// CommandObserver is called after the bash node ran a command
+// exitCode is -1 when the command could not be started
+type CommandObserver func(command string, started time.Time, duration time.Duration, exitCode int, err error)
+
+// CommandRunner runs a command in dir and returns its combined output and exit code
+// exitCode is -1 when the command could not be started
+type CommandRunner func(command, dir string) (output []byte, exitCode int, err error)
+
+// CommandApprover decides whether a command allowed by the policy may run, e.g. by asking a user
+// It may block until the approval id is answered; an error counts as a denial
+type CommandApprover func(id, command string) (bool, error)
+
+// CommandReviewer asks another person to review a risky command, e.g. a member of the team
+// It may block until the review is answered; an error counts as a denial
+type CommandReviewer func(id, command string, rating Rating) (Review, error)
+
+// Review is the answer of a CommandReviewer
+type Review struct {
+	Approved bool
+
+	// Reviewer names the person who answered
+	Reviewer string
+}
+
+// RunCommand runs command with bash in dir; it is the default CommandRunner
+func RunCommand(command, dir string) ([]byte, int, error) {
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	return output, exitCode, err
+}
+
 // BashNode implements the bash command generation logic
 type BashNode struct {
-	llm LLM
+	llm    LLM
+	Policy CommandPolicy
+
+	// Observer, if set, is notified about every executed command
+	Observer CommandObserver
+
+	// Runner, if set, replaces RunCommand, e.g. to replay recorded output
+	Runner CommandRunner
+
+	// Approver, if set, must approve every command before it runs
+	Approver CommandApprover
+
+	// Reviewer, if set, must approve the commands rated ReviewRating or riskier instead of
+	// the Approver
+	Reviewer     CommandReviewer
+	ReviewRating Rating
+
+	// Engine, if set, decides about the commands allowed by Policy, e.g. with the rules of
+	// the organization
+	Engine policy.Engine
+
+	// Asker asks the user about the commands the Engine wants approved when there is no
+	// Approver; without either such commands are denied
+	Asker CommandApprover
+
+	// User is the user the commands run for, passed to the Engine
+	User string
+
+	// Trusted, if set, reports whether a command ran safely often enough to run without the
+	// Approver; DANGEROUS commands and the commands the Engine wants approved are still asked
+	Trusted func(command string) bool
+
+	// Examples show the LLM the commands that were right or wrong for earlier goals
+	Examples []CommandExample
+
+	approvals int
+}
+
+// CommandExample is a goal and the command that achieves it
+type CommandExample struct {
+	Goal    string
+	Command string
+
+	// Wrong is a command that did not achieve the goal; without a Command, the example
+	// only tells the LLM to avoid it
+	Wrong string
 }
 
 // NewBashNode creates a new bash node
 func NewBashNode(llm LLM) *BashNode {
 	return &BashNode{
-		llm: llm,
+		llm:    llm,
+		Policy: PolicyStrict,
 	}
 }
 
 // Process implements the Node interface for BashNode
 func (n *BashNode) Process(state *State) (string, error) {
-	// Get command from LLM
-	prompt := fmt.Sprintf(`Based on the goal, generate a bash command to execute:
-Goal: %s
-Current State: %s
-
-Return JSON response with:
-{
-    "command": "the bash command to execute",
-    "explanation": "why this command was chosen"
-}`, state.CurrentTask.Goal, state.Input)
-
-	response, err := n.llm.Complete(prompt)
-	if err != nil {
-		return "", fmt.Errorf("failed to get command from LLM: %v", err)
-	}
-
-	// Parse response
+	// The command of a routing rule needs no LLM call
 	var result struct {
 		Command     string `json:"command"`
 		Explanation string `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return "", fmt.Errorf("failed to parse LLM response: %v", err)
+	if command := state.GetCurrentTask().Command; command != "" {
+		result.Command = command
+		result.Explanation = "chosen by a routing rule"
+	} else {
+		// Get command from LLM
+		prompt, err := state.RenderPrompt(prompts.BashCommand, prompts.Vars{
+			"ConversationContext": state.GetConversationContext(),
+			"Examples":            n.Examples,
+			"Goal":                state.GetCurrentTask().Goal,
+			"Input":               state.GetInput(),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		response, err := n.llm.Complete(prompt)
+		if err != nil {
+			return "", fmt.Errorf("failed to get command from LLM: %w", withKind(ErrLLM, err))
+		}
+
+		// Parse response
+		if err := parseResponse(state, n.llm, response, &result); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrParse, err)
+		}
 	}
 
-	// Sanitize command
-	if err := validateCommand(result.Command); err != nil {
-		return "", fmt.Errorf("command validation failed: %v", err)
+	state.SetCommand(result.Command)
+	logger := state.NodeLogger(NodeTypeBash)
+	state.Publish(&events.CommandProposed{Command: result.Command, Explanation: result.Explanation})
+
+	// The command policy and the policy engine of the organization decide about the command
+	commandPolicy := n.Policy
+	if commandPolicy == "" {
+		commandPolicy = PolicyStrict
+	}
+	var engine policy.Engine = commandPolicy
+	if n.Engine != nil {
+		engine = policy.Chain(commandPolicy, n.Engine)
+	}
+	state.Publish(&events.ApprovalRequested{Command: result.Command, Policy: string(commandPolicy)})
+	ask, err := checkPolicy(state, engine, policy.Input{
+		Action:  policy.ActionCommand,
+		Command: result.Command,
+		Rating:  string(RateCommand(result.Command)),
+		User:    n.User,
+	})
+	if err != nil {
+		logger.Warn("command rejected", "command", result.Command, "policy", string(commandPolicy), "reason", err)
+		state.Publish(&events.CommandRejected{Command: result.Command, Reason: err.Error()})
+		return "", fmt.Errorf("%w: %v", ErrPolicyDenied, err)
+	}
+	if err := n.approve(state, result.Command, ask); err != nil {
+		logger.Warn("command rejected", "command", result.Command, "reason", err)
+		state.Publish(&events.CommandRejected{Command: result.Command, Reason: err.Error()})
+		return "", fmt.Errorf("%w: %w", ErrPolicyDenied, err)
 	}
 
+	logger.Debug("executing command", "command", result.Command, "dir", state.GetWorkingDirectory())
+
 	// Execute command
-	cmd := exec.Command("bash", "-c", result.Command)
-	cmd.Dir = state.WorkingDirectory // Set working directory
-	output, err := cmd.CombinedOutput()
+	runner := n.Runner
+	if runner == nil {
+		runner = RunCommand
+	}
+	started := time.Now()
+	output, exitCode, err := runner(result.Command, state.GetWorkingDirectory())
+	duration := time.Since(started)
+	if n.Observer != nil {
+		n.Observer(result.Command, started, duration, exitCode, err)
+	}
+	executed := &events.CommandExecuted{Command: result.Command, ExitCode: exitCode, Duration: duration, Output: string(output)}
+	if err != nil {
+		executed.Error = err.Error()
+	}
+	state.Publish(executed)
 	if err != nil {
-		return string(output), fmt.Errorf("command execution failed: %v", err)
+		return string(output), fmt.Errorf("%w: %v", ErrCommandFailed, err)
 	}
 
 	// Set result and next node
-	state.CurrentTask.Result = strings.TrimSpace(string(output))
-	state.NextNode = NodeTypeClassifier
+	state.SetCurrentTaskResult(strings.TrimSpace(string(output)))
+	state.SetNextNode(NodeTypeClassifier)
+
+	return state.GetCurrentTask().Result, nil
+}
+
+// approve asks the reviewer of risky commands or the approver, if any, whether command may run
+// ask is set when the policy engine wants the command approved
+func (n *BashNode) approve(state *State, command string, ask bool) error {
+	if rating := RateCommand(command); n.Reviewer != nil && rating.AtLeast(n.ReviewRating) {
+		return n.review(state, command, rating)
+	}
+	approver := n.Approver
+	if approver != nil && !ask && n.trusted(command) {
+		state.NodeLogger(NodeTypeBash).Info("command approved by its history", "command", command)
+		return nil
+	}
+	if approver == nil && ask {
+		if n.Asker == nil {
+			return errors.New("the policy requires an approval, but nobody can be asked")
+		}
+		approver = n.Asker
+	}
+	if approver == nil {
+		return nil
+	}
+
+	n.approvals++
+	approved, err := requestApproval(state, approver, strconv.Itoa(n.approvals), command)
+	switch {
+	case err != nil:
+		return fmt.Errorf("command approval failed: %v", err)
+	case !approved:
+		return withKind(ErrCanceled, errors.New("command was not approved"))
+	}
+	return nil
+}
+
+// trusted reports whether command may skip the approver because of its history
+func (n *BashNode) trusted(command string) bool {
+	return n.Trusted != nil && RateCommand(command) != RatingDangerous && n.Trusted(command)
+}
+
+// review asks the reviewer whether command may run and records who answered in the state
+func (n *BashNode) review(state *State, command string, rating Rating) error {
+	n.approvals++
+	id := strconv.Itoa(n.approvals)
+	state.Publish(&events.ApprovalPending{ID: id, Command: command, Rating: string(rating)})
+	review, err := n.Reviewer(id, command, rating)
+
+	answered := &events.ApprovalAnswered{ID: id, Command: command, Approved: review.Approved && err == nil, By: review.Reviewer}
+	if err != nil {
+		answered.Error = err.Error()
+	}
+	state.Publish(answered)
+	state.SetCommandReviewer(review.Reviewer)
 
-	return state.CurrentTask.Result, nil
+	switch {
+	case err != nil:
+		return fmt.Errorf("command review failed: %v", err)
+	case !review.Approved:
+		if review.Reviewer == "" {
+			return withKind(ErrCanceled, errors.New("command was rejected in the review"))
+		}
+		return withKind(ErrCanceled, fmt.Errorf("command was rejected by %s", review.Reviewer))
+	}
+	return nil
+}
+
+// requestApproval asks approver to approve subject, e.g. a command, publishing the
+// approval events of the run
+func requestApproval(state *State, approver CommandApprover, id, subject string) (bool, error) {
+	state.Publish(&events.ApprovalPending{ID: id, Command: subject})
+	approved, err := approver(id, subject)
+
+	answered := &events.ApprovalAnswered{ID: id, Command: subject, Approved: approved && err == nil}
+	if err != nil {
+		answered.Error = err.Error()
+	}
+	state.Publish(answered)
+	return approved, err
 }
 
 // validateCommand checks if a command is safe to execute
@@ -118,6 +329,13 @@ func validateCommand(cmd string) error {
 		}
 	}
 
+	// A newline starts another command that would bypass the allow list below
+	for _, r := range cmd {
+		if (r < 32 && r != '\t') || r == 127 {
+			return fmt.Errorf("command contains control character: %q", r)
+		}
+	}
+
 	// Only allow specific safe commands
 	allowedCommands := []string{
 		"ls",
@@ -165,3 +383,12 @@ func validateCommand(cmd string) error {
 func (n *BashNode) Type() NodeType {
 	return NodeTypeBash
 }
+
+// Describe implements the Describer interface for BashNode
+func (n *BashNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeBash,
+		Description: "runs a shell command to do or inspect something on the system",
+		Examples:    []string{"list the files", "how much disk space is left?"},
+	}
+}
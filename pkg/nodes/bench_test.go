@@ -0,0 +1,113 @@
+package nodes
+
+import (
+	"path/filepath"
+	"testing"
+
+	"aiagent/pkg/logging"
+	"aiagent/pkg/testrepo"
+)
+
+// benchmarkRepos are the synthetic repositories the file walking benchmarks run against
+var benchmarkRepos = []struct {
+	name string
+	spec testrepo.Spec
+}{
+	{"small", testrepo.Small},
+	{"medium", testrepo.Medium},
+	{"large", testrepo.Large},
+}
+
+// generateRepo creates a synthetic repository in a temporary directory
+func generateRepo(b *testing.B, spec testrepo.Spec) string {
+	b.Helper()
+	dir := b.TempDir()
+	if _, err := testrepo.Generate(dir, spec); err != nil {
+		b.Fatalf("failed to generate repository: %v", err)
+	}
+	return dir
+}
+
+func BenchmarkCollectDirectoryContents(b *testing.B) {
+	node := NewContentCollectionNode(nil)
+	logger := logging.Discard()
+
+	for _, repo := range benchmarkRepos {
+		dir := generateRepo(b, repo.spec)
+		cases := []struct {
+			name         string
+			patterns     []string
+			readContents bool
+		}{
+			{"names", nil, false},
+			{"contents", nil, true},
+			{"patterns", []string{"*.go", "*.md"}, true},
+		}
+		for _, tc := range cases {
+			b.Run(repo.name+"/"+tc.name, func(b *testing.B) {
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := node.collectDirectoryContents(logger, dir, tc.patterns, tc.readContents); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkFindMatchingFiles(b *testing.B) {
+	node := NewCodeAnalyzerNode(nil)
+
+	for _, repo := range benchmarkRepos {
+		dir := generateRepo(b, repo.spec)
+		patterns := []string{
+			filepath.Join(dir, "*.go"),
+			filepath.Join(dir, "*", "*.go"),
+			filepath.Join(dir, "*", "*", "*.md"),
+		}
+		b.Run(repo.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := node.findMatchingFiles(patterns); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadFiles(b *testing.B) {
+	node := NewCodeAnalyzerNode(nil)
+
+	for _, repo := range benchmarkRepos {
+		dir := generateRepo(b, repo.spec)
+		files, err := node.findMatchingFiles([]string{
+			filepath.Join(dir, "*.go"),
+			filepath.Join(dir, "*", "*.go"),
+			filepath.Join(dir, "*", "*", "*.go"),
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(repo.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := node.readFiles(logging.Discard(), files, dir, maxCollectedFileSize); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkIsTextFile(b *testing.B) {
+	names := []string{"main.go", "README.md", "config.yaml", "asset.bin", "image.png", "Makefile"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		isTextFile(names[i%len(names)])
+	}
+}
@@ -0,0 +1,42 @@
+package nodes
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/cassette"
+)
+
+// openCassette returns the LLM for a test replaying testdata/cassettes/<name>.yaml
+// Run the tests with AIAGENT_RECORD_CASSETTES=1 and OPENAI_API_KEY set to record them again
+func openCassette(t *testing.T, name string) LLM {
+	llm, done, err := cassette.Open("testdata/cassettes/"+name+".yaml", func() (cassette.LLM, error) {
+		return NewProviderLLM(ProviderOpenAI, "", "", os.Getenv("OPENAI_API_KEY"))
+	})
+	if err != nil {
+		t.Fatalf("failed to open cassette: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := done(); err != nil {
+			t.Errorf("failed to save cassette: %v", err)
+		}
+	})
+	return llm
+}
+
+func TestBashNode_Cassette(t *testing.T) {
+	node := NewBashNode(openCassette(t, "bash_print_greeting"))
+	state := &State{
+		Input:            "say hello",
+		WorkingDirectory: t.TempDir(),
+		CurrentTask:      TaskStatus{NodeType: NodeTypeBash, Goal: "print a greeting"},
+	}
+
+	result, err := node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo hello", state.GetCommand())
+	assert.Equal(t, "hello", result)
+	assert.Equal(t, NodeTypeClassifier, state.GetNextNode())
+}
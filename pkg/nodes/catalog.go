@@ -0,0 +1,49 @@
+package nodes
+
+// NodeInfo describes a node to the classifier, so requests can be routed to it
+type NodeInfo struct {
+	Type        NodeType
+	Description string
+
+	// Examples are requests the node handles
+	Examples []string
+}
+
+// Describer is implemented by the nodes the classifier can route to
+type Describer interface {
+	Describe() NodeInfo
+}
+
+// Catalog lists the nodes the classifier can route to
+type Catalog []NodeInfo
+
+// NewCatalog describes nodes in the given order; a node that cannot run, e.g. the issue
+// node without a tracker, describes itself with an empty NodeInfo and is left out
+func NewCatalog(nodes ...Describer) Catalog {
+	var catalog Catalog
+	for _, node := range nodes {
+		if info := node.Describe(); info.Type != "" {
+			catalog = append(catalog, info)
+		}
+	}
+	return catalog
+}
+
+// Has reports whether the catalog lists the node type t
+func (c Catalog) Has(t NodeType) bool {
+	for _, info := range c {
+		if info.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Types returns the names of the node types in the catalog
+func (c Catalog) Types() []string {
+	types := make([]string, len(c))
+	for i, info := range c {
+		types[i] = string(info.Type)
+	}
+	return types
+}
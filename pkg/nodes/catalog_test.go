@@ -0,0 +1,38 @@
+package nodes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCatalog(t *testing.T) {
+	llm := NewScriptedLLM()
+	catalog := NewCatalog(NewBashNode(llm), NewDirectResponseNode(llm), NewToolNode(llm, nil), NewIssueNode(llm, nil))
+	assert.Equal(t, Catalog{NewBashNode(llm).Describe(), NewDirectResponseNode(llm).Describe()}, catalog, "nodes that cannot run are left out")
+
+	catalog = NewCatalog(NewToolNode(llm, []Tool{{Name: "files.read"}}), NewIssueNode(llm, &fakeTracker{}))
+	assert.Equal(t, Catalog{
+		{Type: NodeTypeTool, Description: "calls one of the external tools listed below"},
+		{Type: NodeTypeIssue, Description: "files findings as issues in GitHub owner/name", Examples: []string{"file the TODOs as issues"}},
+	}, catalog)
+}
+
+func TestClassifierNode_Catalog(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnAny().Respond(`{"next_node": "deploy", "goal": "deploy staging"}`)
+	node := NewClassifierNode(llm)
+	node.Nodes = Catalog{
+		NewBashNode(llm).Describe(),
+		{Type: "deploy", Description: "deploys a service", Examples: []string{"deploy staging", "roll back prod"}},
+	}
+	state := &State{Input: "ship it to staging"}
+
+	_, err := node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, NodeType("deploy"), state.GetNextNode())
+	assert.Contains(t, llm.Calls()[0], "determine the next node to process the request:\nNodes:\n"+
+		"- bash: runs a shell command to do or inspect something on the system (e.g. \"list the files\", \"how much disk space is left?\")\n"+
+		"- deploy: deploys a service (e.g. \"deploy staging\", \"roll back prod\")\n"+
+		"Input: ship it to staging\n")
+}
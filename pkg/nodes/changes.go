@@ -0,0 +1,381 @@
+package nodes
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"aiagent/pkg/prompts"
+)
+
+const (
+	// DefaultMaxCommits is the maximum number of commits read for a period of time
+	DefaultMaxCommits = 500
+
+	// defaultChunkBytes is the size of a chunk of commits summarized in one prompt when the
+	// state has no prompt content limit
+	defaultChunkBytes = 60000
+
+	// maxCommitDiffBytes caps the diff of a commit shown to the LLM
+	maxCommitDiffBytes = 4000
+
+	// maxNotable is the number of the most changed files and the most active authors listed
+	maxNotable = 10
+
+	// commitSeparator starts a commit and fieldSeparator separates its fields in the output
+	// of gitLog; metaEnd ends the message, which the changed files and the diff follow
+	commitSeparator = "\x1e"
+	fieldSeparator  = "\x1f"
+	metaEnd         = "\x1d"
+)
+
+var (
+	// lastCommitsPattern matches "the last 20 commits"
+	lastCommitsPattern = regexp.MustCompile(`(?i)\b(?:last|past|latest|recent)\s+(\d+)\s+commits?\b`)
+
+	// lastPeriodPattern matches "the last week" and "the past 3 days"
+	lastPeriodPattern = regexp.MustCompile(`(?i)\b(?:last|past)\s+(?:(\d+)\s+)?(day|week|month|year)s?\b`)
+
+	// lastDayPattern matches "since yesterday" and "today"
+	lastDayPattern = regexp.MustCompile(`(?i)\b(yesterday|today)\b`)
+)
+
+// HistoryRange selects the commits to summarize: the last Commits commits, or those since a
+// date git understands, e.g. "2 weeks ago"
+type HistoryRange struct {
+	Commits int
+	Since   string
+
+	// Label describes the range in the answer, e.g. "the last 2 weeks"
+	Label string
+}
+
+// ParseHistoryRange reads the range of the commits a request asks about; without one it is
+// the last week
+func ParseHistoryRange(goal string) HistoryRange {
+	if match := lastCommitsPattern.FindStringSubmatch(goal); match != nil {
+		if n, err := strconv.Atoi(match[1]); err == nil && n > 0 {
+			return HistoryRange{Commits: n, Label: fmt.Sprintf("the last %d commits", n)}
+		}
+	}
+	if match := lastPeriodPattern.FindStringSubmatch(goal); match != nil {
+		n, unit := 1, strings.ToLower(match[2])
+		if match[1] != "" {
+			n, _ = strconv.Atoi(match[1])
+		}
+		if n > 1 {
+			return HistoryRange{Since: fmt.Sprintf("%d %ss ago", n, unit), Label: fmt.Sprintf("the last %d %ss", n, unit)}
+		}
+		return HistoryRange{Since: "1 " + unit + " ago", Label: "the last " + unit}
+	}
+	if lastDayPattern.MatchString(goal) {
+		return HistoryRange{Since: "1 day ago", Label: "the last day"}
+	}
+	return HistoryRange{Since: "1 week ago", Label: "the last week"}
+}
+
+// FileChange is the number of lines a commit added to and deleted from a file; binary files
+// have none
+type FileChange struct {
+	Path    string
+	Added   int
+	Deleted int
+}
+
+// Commit is a commit of the history with its changes
+type Commit struct {
+	Hash    string
+	Author  string
+	Date    string
+	Subject string
+	Body    string
+	Files   []FileChange
+
+	// Diff is the patch of the commit, cut at maxCommitDiffBytes
+	Diff string
+}
+
+func (c Commit) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "commit %s\nAuthor: %s\nDate: %s\n\n%s\n", c.Hash[:min(len(c.Hash), 12)], c.Author, c.Date, c.Subject)
+	if c.Body != "" {
+		fmt.Fprintf(&sb, "\n%s\n", c.Body)
+	}
+	if len(c.Files) > 0 {
+		sb.WriteString("\n")
+		for _, f := range c.Files {
+			fmt.Fprintf(&sb, "%s +%d -%d\n", f.Path, f.Added, f.Deleted)
+		}
+	}
+	if c.Diff != "" {
+		fmt.Fprintf(&sb, "\n%s\n", c.Diff)
+	}
+	return sb.String()
+}
+
+// ChangeStat sums the changes of a file or an author
+type ChangeStat struct {
+	Name    string
+	Commits int
+	Added   int
+	Deleted int
+}
+
+func (s ChangeStat) String() string {
+	return fmt.Sprintf("%s: %d commits, +%d -%d", s.Name, s.Commits, s.Added, s.Deleted)
+}
+
+// ChangesNode summarizes the commits of the git repository in the working directory as a
+// changelog, with the notable files and authors; long histories are summarized in chunks
+// first
+type ChangesNode struct {
+	llm LLM
+
+	// Log returns the output of gitLog for dir and the arguments selecting the commits; nil
+	// runs git
+	Log func(dir string, args ...string) ([]byte, error)
+
+	// MaxCommits caps the commits read for a period of time
+	MaxCommits int
+
+	// ChunkBytes is the size of the commits summarized in one prompt; 0 uses the prompt
+	// content limit of the state
+	ChunkBytes int
+}
+
+// NewChangesNode creates a new changes node
+func NewChangesNode(llm LLM) *ChangesNode {
+	return &ChangesNode{
+		llm:        llm,
+		MaxCommits: DefaultMaxCommits,
+	}
+}
+
+// Process implements the Node interface for ChangesNode
+func (n *ChangesNode) Process(state *State) error {
+	goal := state.GetCurrentTask().Goal
+	historyRange := ParseHistoryRange(goal)
+	args := []string{"-n", strconv.Itoa(historyRange.Commits)}
+	if historyRange.Commits == 0 {
+		args = []string{"--since=" + historyRange.Since, "-n", strconv.Itoa(n.MaxCommits)}
+	}
+	log := n.Log
+	if log == nil {
+		log = gitLog
+	}
+	output, err := log(state.GetWorkingDirectory(), args...)
+	if err != nil {
+		return err
+	}
+	commits := ParseGitLog(output)
+	if len(commits) == 0 {
+		result := fmt.Sprintf("No commits in %s.", historyRange.Label)
+		state.SetRawOutput(result)
+		state.SetFinalResult(result)
+		return nil
+	}
+
+	// Histories that do not fit in one prompt are summarized chunk by chunk, at the same time
+	vars := prompts.Vars{
+		"Goal":      goal,
+		"Range":     historyRange.Label,
+		"Total":     len(commits),
+		"Files":     changeStats(commits, func(c Commit, f FileChange) string { return f.Path }),
+		"Authors":   changeStats(commits, func(c Commit, f FileChange) string { return c.Author }),
+		"Commits":   "",
+		"Summaries": []string(nil),
+	}
+	chunks := chunkCommits(commits, n.chunkBytes(state))
+	if len(chunks) == 1 {
+		vars["Commits"] = chunks[0]
+	} else {
+		summaries, err := n.summarizeChunks(state, goal, chunks)
+		if err != nil {
+			return err
+		}
+		vars["Summaries"] = summaries
+	}
+
+	prompt, err := state.RenderPrompt(prompts.ChangesChangelog, vars)
+	if err != nil {
+		return err
+	}
+	changelog, err := completeResult(state, n.llm, prompt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+
+	state.SetRawOutput(changelog)
+	state.SetFinalResult(changelog)
+	return nil
+}
+
+// chunkBytes returns the size of the commits summarized in one prompt
+func (n *ChangesNode) chunkBytes(state *State) int {
+	if n.ChunkBytes > 0 {
+		return n.ChunkBytes
+	}
+	if limit := state.GetLimits().MaxPromptContentBytes; limit > 0 {
+		return limit
+	}
+	return defaultChunkBytes
+}
+
+// summarizeChunks summarizes the chunks of commits concurrently, in the order of the chunks
+func (n *ChangesNode) summarizeChunks(state *State, goal string, chunks []string) ([]string, error) {
+	chunkPrompts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		prompt, err := state.RenderPrompt(prompts.ChangesSummarizeChunk, prompts.Vars{
+			"Goal":    goal,
+			"Chunk":   i + 1,
+			"Chunks":  len(chunks),
+			"Commits": chunk,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chunkPrompts[i] = prompt
+	}
+	calls, err := completeAll(state.GetContext(), n.llm, chunkPrompts...)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]string, len(calls))
+	for i, call := range calls {
+		if call.err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrLLM, call.err)
+		}
+		summaries[i] = strings.TrimSpace(call.response)
+	}
+	return summaries, nil
+}
+
+// chunkCommits joins consecutive commits into chunks of at most limit bytes; a commit
+// larger than limit gets a chunk of its own
+func chunkCommits(commits []Commit, limit int) []string {
+	var chunks []string
+	var chunk strings.Builder
+	for _, commit := range commits {
+		text := commit.String() + "\n"
+		if chunk.Len() > 0 && chunk.Len()+len(text) > limit {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+		}
+		chunk.WriteString(text)
+	}
+	return append(chunks, chunk.String())
+}
+
+// changeStats sums the changes of the commits by key, the most commits first and, at the
+// same number of commits, the most changed lines; at most maxNotable are returned
+func changeStats(commits []Commit, key func(Commit, FileChange) string) []ChangeStat {
+	byKey := make(map[string]*ChangeStat)
+	var stats []*ChangeStat
+	for _, commit := range commits {
+		counted := make(map[string]bool)
+		files := commit.Files
+		if len(files) == 0 {
+			files = []FileChange{{}} // A commit without files still counts for its author
+		}
+		for _, file := range files {
+			name := key(commit, file)
+			if name == "" {
+				continue
+			}
+			stat, ok := byKey[name]
+			if !ok {
+				stat = &ChangeStat{Name: name}
+				byKey[name] = stat
+				stats = append(stats, stat)
+			}
+			if !counted[name] {
+				stat.Commits++
+				counted[name] = true
+			}
+			stat.Added += file.Added
+			stat.Deleted += file.Deleted
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Commits != stats[j].Commits {
+			return stats[i].Commits > stats[j].Commits
+		}
+		return stats[i].Added+stats[i].Deleted > stats[j].Added+stats[j].Deleted
+	})
+	result := make([]ChangeStat, 0, min(len(stats), maxNotable))
+	for _, stat := range stats[:min(len(stats), maxNotable)] {
+		result = append(result, *stat)
+	}
+	return result
+}
+
+// gitLog runs git log in dir without merge commits, with the changed files and the diff of
+// every commit, in the format ParseGitLog reads
+func gitLog(dir string, args ...string) ([]byte, error) {
+	format := "--format=" + commitSeparator + "%H" + fieldSeparator + "%an" + fieldSeparator + "%ad" + fieldSeparator + "%s" + fieldSeparator + "%b" + metaEnd
+	cmd := exec.Command("git", append([]string{"-C", dir, "log", "--no-merges", "--date=short", "--numstat", "--patch", format}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// ParseGitLog reads the commits from the output of gitLog, newest first
+func ParseGitLog(output []byte) []Commit {
+	var commits []Commit
+	for _, record := range strings.Split(string(output), commitSeparator) {
+		meta, changes, ok := strings.Cut(record, metaEnd)
+		fields := strings.SplitN(meta, fieldSeparator, 5)
+		if !ok || len(fields) < 5 {
+			continue
+		}
+		commit := Commit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Date:    fields[2],
+			Subject: fields[3],
+			Body:    strings.TrimSpace(fields[4]),
+		}
+
+		stat, diff, _ := strings.Cut(changes, "\ndiff ")
+		for _, line := range strings.Split(stat, "\n") {
+			parts := strings.SplitN(line, "\t", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			// Binary files have "-" instead of the numbers of lines
+			added, _ := strconv.Atoi(parts[0])
+			deleted, _ := strconv.Atoi(parts[1])
+			commit.Files = append(commit.Files, FileChange{Path: parts[2], Added: added, Deleted: deleted})
+		}
+		if diff != "" {
+			diff = strings.TrimSpace("diff " + diff)
+			if len(diff) > maxCommitDiffBytes {
+				diff = diff[:strings.LastIndex(diff[:maxCommitDiffBytes], "\n")+1] + "... (diff truncated)"
+			}
+			commit.Diff = diff
+		}
+		commits = append(commits, commit)
+	}
+	return commits
+}
+
+func (n *ChangesNode) Type() NodeType {
+	return NodeTypeChanges
+}
+
+// Describe implements the Describer interface for ChangesNode
+func (n *ChangesNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeChanges,
+		Description: "summarizes the recent commits of the git repository as a changelog with the notable files and authors",
+		Examples:    []string{"what changed in the last week?", "summarize the last 20 commits"},
+	}
+}
@@ -0,0 +1,136 @@
+package nodes
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gitLogOutput is the output of gitLog for two commits, the newest changing a binary file
+const gitLogOutput = "\x1eb2c3d4e5f6a7b8\x1fBob\x1f2026-10-15\x1fFix the retry of failed uploads\x1fThe delay was never reset.\n\x1d\n\n" +
+	"3\t1\tpkg/upload/retry.go\n-\t-\tdocs/logo.png\n\n" +
+	"diff --git a/pkg/upload/retry.go b/pkg/upload/retry.go\n--- a/pkg/upload/retry.go\n+++ b/pkg/upload/retry.go\n@@ -1 +1,3 @@\n-delay := 0\n+delay = 0\n" +
+	"\x1ea1b2c3d4e5f6a7b8\x1fAlice\x1f2026-10-14\x1fAdd resumable uploads\x1f\x1d\n\n" +
+	"120\t0\tpkg/upload/resume.go\n10\t2\tpkg/upload/retry.go\n"
+
+func TestParseGitLog(t *testing.T) {
+	commits := ParseGitLog([]byte(gitLogOutput))
+	require.Len(t, commits, 2)
+	assert.Equal(t, Commit{
+		Hash: "b2c3d4e5f6a7b8", Author: "Bob", Date: "2026-10-15", Subject: "Fix the retry of failed uploads", Body: "The delay was never reset.",
+		Files: []FileChange{{Path: "pkg/upload/retry.go", Added: 3, Deleted: 1}, {Path: "docs/logo.png"}},
+		Diff:  "diff --git a/pkg/upload/retry.go b/pkg/upload/retry.go\n--- a/pkg/upload/retry.go\n+++ b/pkg/upload/retry.go\n@@ -1 +1,3 @@\n-delay := 0\n+delay = 0",
+	}, commits[0])
+	assert.Equal(t, Commit{
+		Hash: "a1b2c3d4e5f6a7b8", Author: "Alice", Date: "2026-10-14", Subject: "Add resumable uploads",
+		Files: []FileChange{{Path: "pkg/upload/resume.go", Added: 120}, {Path: "pkg/upload/retry.go", Added: 10, Deleted: 2}},
+	}, commits[1])
+	assert.Equal(t, "commit a1b2c3d4e5f6\nAuthor: Alice\nDate: 2026-10-14\n\nAdd resumable uploads\n\n"+
+		"pkg/upload/resume.go +120 -0\npkg/upload/retry.go +10 -2\n", commits[1].String())
+
+	long := ParseGitLog([]byte("\x1eabc\x1fA\x1f2026-10-14\x1fs\x1f\x1d\n\ndiff --git a b\n" + strings.Repeat("+line\n", 1000)))
+	assert.LessOrEqual(t, len(long[0].Diff), maxCommitDiffBytes+len("... (diff truncated)"))
+	assert.True(t, strings.HasSuffix(long[0].Diff, "+line\n... (diff truncated)"))
+
+	assert.Empty(t, ParseGitLog(nil))
+}
+
+func TestParseHistoryRange(t *testing.T) {
+	for goal, want := range map[string]HistoryRange{
+		"what changed in the last 20 commits?": {Commits: 20, Label: "the last 20 commits"},
+		"summarize the recent 5 commits":       {Commits: 5, Label: "the last 5 commits"},
+		"what changed in the last week?":       {Since: "1 week ago", Label: "the last week"},
+		"what happened over the past 3 days":   {Since: "3 days ago", Label: "the last 3 days"},
+		"changelog for the last 2 months":      {Since: "2 months ago", Label: "the last 2 months"},
+		"what was committed since yesterday?":  {Since: "1 day ago", Label: "the last day"},
+		"what did the team work on?":           {Since: "1 week ago", Label: "the last week"},
+		"what changed in the last 0 commits?":  {Since: "1 week ago", Label: "the last week"},
+	} {
+		assert.Equal(t, want, ParseHistoryRange(goal), goal)
+	}
+}
+
+func TestChangesNode(t *testing.T) {
+	var logArgs []string
+	llm := NewScriptedLLM()
+	llm.OnContains("Write a changelog of the commits of a git repository in the last 2 commits").Respond("### Features\n- Resumable uploads (Alice)\n")
+	node := NewChangesNode(llm)
+	node.Log = func(dir string, args ...string) ([]byte, error) {
+		logArgs = args
+		return []byte(gitLogOutput), nil
+	}
+	state := &State{CurrentTask: TaskStatus{NodeType: NodeTypeChanges, Goal: "what changed in the last 2 commits?"}}
+
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, []string{"-n", "2"}, logArgs)
+	prompt := llm.Calls()[0]
+	assert.Contains(t, prompt, "Most changed files:\n- pkg/upload/retry.go: 2 commits, +13 -3\n- pkg/upload/resume.go: 1 commits, +120 -0\n- docs/logo.png: 1 commits, +0 -0\n")
+	assert.Contains(t, prompt, "Most active authors:\n- Alice: 1 commits, +130 -2\n- Bob: 1 commits, +3 -1\n")
+	assert.Contains(t, prompt, "Commits, newest first:\ncommit b2c3d4e5f6a7\nAuthor: Bob")
+	assert.Equal(t, "### Features\n- Resumable uploads (Alice)\n", state.GetFinalResult())
+}
+
+func TestChangesNode_Chunks(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnContains("part 1 of 2").Respond("- fixed the upload retry (Bob)\n")
+	llm.OnContains("part 2 of 2").Respond("- added resumable uploads (Alice)\n")
+	llm.OnContains("Summaries of the commits").Respond("### Features\n- Resumable uploads\n### Fixes\n- Upload retry\n")
+	node := NewChangesNode(llm)
+	node.ChunkBytes = 300
+	var logArgs []string
+	node.Log = func(dir string, args ...string) ([]byte, error) {
+		logArgs = args
+		return []byte(gitLogOutput), nil
+	}
+	state := &State{CurrentTask: TaskStatus{NodeType: NodeTypeChanges, Goal: "what changed in the last month?"}}
+
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, []string{"--since=1 month ago", "-n", "500"}, logArgs)
+	assert.True(t, llm.AssertExpectations(t))
+	assert.Contains(t, llm.Calls()[2], "Summaries of the commits, newest first:\n- fixed the upload retry (Bob)\n\n- added resumable uploads (Alice)\n\n")
+	assert.Equal(t, "### Features\n- Resumable uploads\n### Fixes\n- Upload retry\n", state.GetFinalResult())
+}
+
+func TestChangesNode_NoCommits(t *testing.T) {
+	llm := NewScriptedLLM()
+	node := NewChangesNode(llm)
+	node.Log = func(string, ...string) ([]byte, error) { return nil, nil }
+	state := &State{CurrentTask: TaskStatus{Goal: "what changed since yesterday?"}}
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, "No commits in the last day.", state.GetFinalResult())
+	assert.Empty(t, llm.Calls())
+}
+
+func TestGitLog(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	writeTodoFile(t, filepath.Join(dir, "main.go"), "package main\n")
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "main.go"},
+		{"-c", "user.name=Dana", "-c", "user.email=dana@example.com", "commit", "-q", "-m", "Add main", "-m", "The entry point."},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	output, err := gitLog(dir, "-n", "1")
+	require.NoError(t, err)
+	commits := ParseGitLog(output)
+	require.Len(t, commits, 1)
+	assert.Equal(t, "Dana", commits[0].Author)
+	assert.Equal(t, "Add main", commits[0].Subject)
+	assert.Equal(t, "The entry point.", commits[0].Body)
+	assert.Equal(t, []FileChange{{Path: "main.go", Added: 1}}, commits[0].Files)
+	assert.Contains(t, commits[0].Diff, "+package main")
+
+	_, err = gitLog(t.TempDir())
+	assert.ErrorContains(t, err, "git log failed")
+}
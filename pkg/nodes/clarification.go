@@ -0,0 +1,47 @@
+package nodes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Clarifier asks the user question and returns the answer, e.g. read from the terminal
+type Clarifier func(question string) (string, error)
+
+// ClarificationNode asks the user what a request means when the classifier is unsure
+// which node handles it; the answer is the result of the task, so the classifier sees it
+// when it classifies the request again
+type ClarificationNode struct {
+	// Ask asks the user; without it the request is classified without an answer
+	Ask Clarifier
+}
+
+// NewClarificationNode creates a new clarification node asking the user with ask
+func NewClarificationNode(ask Clarifier) *ClarificationNode {
+	return &ClarificationNode{Ask: ask}
+}
+
+// Process implements the Node interface for ClarificationNode
+func (n *ClarificationNode) Process(state *State) error {
+	question := state.GetCurrentTask().Goal
+	if n.Ask == nil {
+		state.SetRawOutput("The user could not be asked: " + question)
+		return nil
+	}
+
+	answer, err := n.Ask(question)
+	if err != nil {
+		return fmt.Errorf("failed to ask the user: %v", err)
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		answer = "(no answer)"
+	}
+	state.NodeLogger(NodeTypeClarification).Debug("user answered", "question", question, "answer", answer)
+	state.SetRawOutput(fmt.Sprintf("Asked the user: %s\nThe user answered: %s", question, answer))
+	return nil
+}
+
+func (n *ClarificationNode) Type() NodeType {
+	return NodeTypeClarification
+}
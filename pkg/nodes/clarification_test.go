@@ -0,0 +1,27 @@
+package nodes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClarificationNode(t *testing.T) {
+	var asked string
+	node := NewClarificationNode(func(question string) (string, error) {
+		asked = question
+		return " explain it \n", nil
+	})
+	state := &State{CurrentTask: TaskStatus{NodeType: NodeTypeClarification, Goal: "Run a command?"}}
+
+	assert.NoError(t, node.Process(state))
+	assert.Equal(t, "Run a command?", asked)
+	assert.Equal(t, "Asked the user: Run a command?\nThe user answered: explain it", state.GetRawOutput())
+
+	assert.NoError(t, NewClarificationNode(nil).Process(state))
+	assert.Equal(t, "The user could not be asked: Run a command?", state.GetRawOutput())
+
+	node.Ask = func(question string) (string, error) { return "", errors.New("closed") }
+	assert.EqualError(t, node.Process(state), "failed to ask the user: closed")
+}
@@ -0,0 +1,93 @@
+package nodes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a classification is reused for the same request
+const DefaultCacheTTL = 5 * time.Minute
+
+// maxCacheEntries caps the number of cached classifications
+const maxCacheEntries = 1000
+
+// ClassificationCache remembers how the classifier routed the requests, so a repeated
+// request, e.g. in chat or from clients of the server, skips the LLM call
+// Only the first task of a request is cached; it is safe for concurrent use
+type ClassificationCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedClassification
+
+	// now returns the current time; tests replace it
+	now func() time.Time
+}
+
+// cachedClassification is the routing of a request, with the plan of a compound request
+type cachedClassification struct {
+	node    NodeType
+	goal    string
+	plan    []TaskStatus
+	expires time.Time
+}
+
+// NewClassificationCache creates a cache keeping classifications for ttl
+func NewClassificationCache(ttl time.Duration) *ClassificationCache {
+	return &ClassificationCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedClassification),
+		now:     time.Now,
+	}
+}
+
+// get returns the classification of the request input made in dir after the conversation
+// summed up by conversation, if it didn't expire
+func (c *ClassificationCache) get(dir, conversation, input string) (cachedClassification, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := cacheKey(dir, conversation, input)
+	entry, ok := c.entries[key]
+	if !ok {
+		return cachedClassification{}, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return cachedClassification{}, false
+	}
+	return entry, true
+}
+
+// put caches the classification of the request input made in dir after the conversation
+// summed up by conversation
+func (c *ClassificationCache) put(dir, conversation, input string, node NodeType, goal string, plan []TaskStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.entries) >= maxCacheEntries {
+		// Drop the expired entries, then the one expiring first
+		var oldest string
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			} else if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+				oldest = key
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[cacheKey(dir, conversation, input)] = cachedClassification{node: node, goal: goal, plan: plan, expires: now.Add(c.ttl)}
+}
+
+// cacheKey normalizes a request, so requests differing only in case, spacing or the final
+// punctuation share a classification; the conversation is part of the prompt, so the same
+// request in another conversation, e.g. "fix it", is classified again
+func cacheKey(dir, conversation, input string) string {
+	input = strings.Join(strings.Fields(strings.ToLower(input)), " ")
+	hash := sha256.Sum256([]byte(conversation))
+	return dir + "\x00" + hex.EncodeToString(hash[:8]) + "\x00" + strings.TrimRight(input, ".?! ")
+}
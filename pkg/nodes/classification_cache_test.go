@@ -0,0 +1,81 @@
+package nodes
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassificationCache(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewClassificationCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.put("/src", "", "List the  Go files?", NodeTypeBash, "list go files", nil)
+	entry, ok := cache.get("/src", "", "list the go files")
+	assert.True(t, ok, "case, spacing and final punctuation are ignored")
+	assert.Equal(t, NodeTypeBash, entry.node)
+	assert.Equal(t, "list go files", entry.goal)
+
+	_, ok = cache.get("/other", "", "list the go files")
+	assert.False(t, ok, "requests in other directories are classified again")
+	_, ok = cache.get("/src", "Previously: renamed main.go", "list the go files")
+	assert.False(t, ok, "requests in another conversation are classified again")
+
+	now = now.Add(time.Minute)
+	_, ok = cache.get("/src", "", "list the go files")
+	assert.False(t, ok, "expired")
+	assert.Empty(t, cache.entries)
+}
+
+func TestClassificationCache_Full(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewClassificationCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < maxCacheEntries; i++ {
+		cache.put("/src", "", fmt.Sprintf("request %d", i), NodeTypeBash, "", nil)
+		now = now.Add(time.Millisecond)
+	}
+	cache.put("/src", "", "one more", NodeTypeBash, "", nil)
+	assert.Len(t, cache.entries, maxCacheEntries)
+	_, ok := cache.get("/src", "", "request 0")
+	assert.False(t, ok, "the entry expiring first is dropped")
+	_, ok = cache.get("/src", "", "one more")
+	assert.True(t, ok)
+}
+
+func TestClassifierNode_Cache(t *testing.T) {
+	llm := NewScriptedLLM()
+	classify := llm.OnContains("determine the next node").Respond(
+		`{"next_node": "code_analyzer", "goal": "explain main.go"}`,
+		`{"next_node": "code_analyzer", "goal": "explain the renamed main.go"}`,
+		`{"next_node": "bash", "goal": "count lines"}`)
+	node := NewClassifierNode(llm)
+	node.Cache = NewClassificationCache(time.Minute)
+
+	for _, input := range []string{"Explain main.go", "explain main.go."} {
+		state := &State{Input: input, WorkingDirectory: "/src"}
+		goal, err := node.Process(state)
+		assert.NoError(t, err)
+		assert.Equal(t, "explain main.go", goal)
+		assert.Equal(t, NodeTypeCodeAnalyzer, state.GetNextNode())
+	}
+	assert.Equal(t, 1, classify.CallCount())
+
+	// The same request continuing a conversation is classified again
+	state := &State{Input: "explain main.go", WorkingDirectory: "/src", ConversationContext: "Previously: renamed cmd.go to main.go"}
+	goal, err := node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, "explain the renamed main.go", goal)
+	assert.Equal(t, 2, classify.CallCount())
+
+	// Later tasks of a run are always classified
+	state = &State{Input: "explain main.go", WorkingDirectory: "/src", TaskHistory: []TaskStatus{{NodeType: NodeTypeCodeAnalyzer, IsCompleted: true}}}
+	goal, err = node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, "count lines", goal)
+	assert.Equal(t, 3, classify.CallCount())
+}
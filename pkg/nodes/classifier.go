@@ -1,8 +1,12 @@
 package nodes
 
 import (
-	"encoding/json"
 	"fmt"
+	"regexp"
+	"strings"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/prompts"
 )
 
 // ClassifierNodeInterface defines the operations for a classifier node
@@ -19,13 +23,80 @@ type ClassifierNodeInterface interface {
 
 // ClassifierNode is responsible for determining which node should process the state next
 type ClassifierNode struct {
-	llm LLM
+	llm        LLM
+	summarizer *HistorySummarizer
+
+	// Tools are the external tools the classifier may route to the tool node
+	Tools []Tool
+
+	// Nodes are the nodes the classifier routes to, listed in the prompt
+	Nodes Catalog
+
+	// Examples show the LLM how requests phrased in the words of the user are routed
+	Examples []RoutingExample
+
+	// Rules route the request without asking the LLM; the first matching rule wins
+	Rules []RoutingRule
+
+	// MinConfidence is the confidence below which a decision of the LLM is not trusted;
+	// 0 trusts every decision
+	MinConfidence float64
+
+	// Clarify routes requests the LLM is unsure about to the clarification node, which asks
+	// the user once per run; otherwise a second prompt decides
+	Clarify bool
+
+	// Cache, if set, reuses the routing of repeated requests across runs
+	Cache *ClassificationCache
+}
+
+// DefaultMinConfidence is the confidence below which the classifier double-checks a decision
+const DefaultMinConfidence = 0.5
+
+// MaxPlanTasks is the maximum number of tasks a compound request is split into
+const MaxPlanTasks = 5
+
+// defaultQuestion asks the user about a request when the LLM has no question of its own
+const defaultQuestion = "Should I run a command for this, or answer or analyze it without running anything?"
+
+// RoutingRule routes the requests matching Pattern to Node without an LLM call
+type RoutingRule struct {
+	// Pattern is matched against the whole request without surrounding spaces
+	Pattern *regexp.Regexp
+
+	Node NodeType
+
+	// Command, for the bash node, answers the request: it runs without asking the LLM for
+	// a command, and its output ends the run
+	Command string
+}
+
+// DefaultRoutingRules returns the built-in rules for requests that are commands already
+func DefaultRoutingRules() []RoutingRule {
+	return []RoutingRule{
+		{Pattern: regexp.MustCompile(`(?i)^ls$`), Node: NodeTypeBash, Command: "ls"},
+		{Pattern: regexp.MustCompile(`(?i)^list files$`), Node: NodeTypeBash, Command: "ls -la"},
+		{Pattern: regexp.MustCompile(`(?i)^pwd$`), Node: NodeTypeBash, Command: "pwd"},
+	}
+}
+
+// RoutingExample is a request and the node the classifier should route it to
+type RoutingExample struct {
+	Input string
+	Node  NodeType
+
+	// Wrong is a node the request was routed to by mistake; without a Node, the example
+	// only tells the LLM to avoid it
+	Wrong NodeType
 }
 
 // NewClassifierNode creates a new instance of ClassifierNode
 func NewClassifierNode(llm LLM) *ClassifierNode {
 	return &ClassifierNode{
-		llm: llm,
+		llm:           llm,
+		summarizer:    NewHistorySummarizer(llm),
+		Rules:         DefaultRoutingRules(),
+		MinConfidence: DefaultMinConfidence,
 	}
 }
 
@@ -37,124 +108,356 @@ type classifierResponse struct {
 	Explanation string   `json:"explanation"`
 }
 
+// classification is the decision of the LLM about the next node
+type classification struct {
+	NextNode    string `json:"next_node"`
+	Goal        string `json:"goal"`
+	Explanation string `json:"explanation"`
+
+	// Confidence is how sure the LLM is of NextNode, from 0 to 1; nil if it didn't say
+	Confidence *float64 `json:"confidence"`
+
+	// Question asks the user what the request means when the LLM is unsure
+	Question string `json:"question"`
+
+	// Tasks split a compound request into tasks run in order; the first one is NextNode
+	Tasks []struct {
+		NextNode string `json:"next_node"`
+		Goal     string `json:"goal"`
+	} `json:"tasks"`
+}
+
 // Process implements the Node interface for ClassifierNode
 func (n *ClassifierNode) Process(state *State) (string, error) {
-	// If there's a current task, verify if it's completed
-	if state.CurrentTask.NodeType != "" {
+	// The command of a routing rule answers the request; it needs no verification
+	if task := state.GetCurrentTask(); task.NodeType != "" && task.Command != "" {
+		state.SetCurrentTaskCompleted(true)
+		state.AppendTaskHistory(state.GetCurrentTask())
+		state.SetNextNode(NodeTypeTerminal)
+		state.SetCurrentTask(TaskStatus{})
+		return "", nil
+	}
+
+	// Obvious requests are routed by the rules before anything was done, repeated requests
+	// like they were routed before
+	first := state.GetCurrentTask().NodeType == "" && len(state.GetTaskHistory()) == 0
+	if first {
+		if rule, ok := n.matchRule(state.GetInput()); ok {
+			goal := strings.TrimSpace(state.GetInput())
+			state.NodeLogger(NodeTypeClassifier).Debug("routed by rule", "pattern", rule.Pattern.String(), "next_node", string(rule.Node))
+			state.SetNextNode(rule.Node)
+			state.SetCurrentTask(TaskStatus{NodeType: rule.Node, Goal: goal, Command: rule.Command})
+			explainRoute(state, rule.Node, goal, "the request matches the routing rule "+rule.Pattern.String())
+			return goal, nil
+		}
+		if n.Cache != nil {
+			if cached, ok := n.Cache.get(state.GetWorkingDirectory(), state.GetConversationContext(), state.GetInput()); ok {
+				state.NodeLogger(NodeTypeClassifier).Debug("routed like before", "next_node", string(cached.node), "goal", cached.goal)
+				state.SetPlan(append([]TaskStatus(nil), cached.plan...))
+				state.SetNextNode(cached.node)
+				state.SetCurrentTask(TaskStatus{NodeType: cached.node, Goal: cached.goal})
+				explainRoute(state, cached.node, cached.goal, "the same request was routed this way a moment ago")
+				return cached.goal, nil
+			}
+		}
+	}
+
+	// The answer of the user is the result of a clarification; the request is classified again
+	if state.GetCurrentTask().NodeType == NodeTypeClarification {
+		state.SetCurrentTaskCompleted(true)
+		state.AppendTaskHistory(state.GetCurrentTask())
+	} else if state.GetCurrentTask().NodeType != "" {
+		// If there's a current task, verify if it's completed
 		completed, err := n.verifyTaskCompletion(state)
 		if err != nil {
-			return "", fmt.Errorf("failed to verify task completion: %v", err)
+			return "", fmt.Errorf("failed to verify task completion: %w", err)
 		}
 
-		state.CurrentTask.IsCompleted = completed
+		state.SetCurrentTaskCompleted(completed)
 
 		if completed {
 			// Add completed task to history
-			state.TaskHistory = append(state.TaskHistory, state.CurrentTask)
+			state.AppendTaskHistory(state.GetCurrentTask())
+
+			// Condense the evicted tasks; the plain summary is kept if this fails
+			if err := n.summarizer.Summarize(state); err != nil {
+				state.NodeLogger(NodeTypeClassifier).Warn("keeping plain task history summary", "error", err)
+			}
+
+			// The next task of a compound request runs without classifying the request again
+			if next, ok := advancePlan(state, state.GetCurrentTask().Result); ok {
+				state.NodeLogger(NodeTypeClassifier).Debug("next planned task", "next_node", string(next.NodeType), "goal", next.Goal)
+				state.SetNextNode(next.NodeType)
+				state.SetCurrentTask(TaskStatus{NodeType: next.NodeType, Goal: next.Goal})
+				explainRoute(state, next.NodeType, next.Goal, "next task of the compound request")
+				return next.Goal, nil
+			}
 
 			// Check if global goal is met
 			goalMet, err := n.isGlobalGoalMet(state)
 			if err != nil {
-				return "", fmt.Errorf("failed to check global goal: %v", err)
+				return "", fmt.Errorf("failed to check global goal: %w", err)
 			}
 
 			if goalMet {
-				state.NextNode = NodeTypeTerminal
-				state.CurrentTask = TaskStatus{}
+				if answer := planAnswer(state); answer != "" {
+					state.SetFinalResult(answer)
+				}
+				state.SetNextNode(NodeTypeTerminal)
+				state.SetCurrentTask(TaskStatus{})
 				return "", nil
 			}
 		}
 	}
 
 	// Get next node and goal
-	nextNode, goal, err := n.classifyRequest(state)
+	result, err := n.classifyRequest(state)
 	if err != nil {
-		return "", fmt.Errorf("failed to classify request: %v", err)
+		return "", fmt.Errorf("failed to classify request: %w", err)
+	}
+	nextNode, goal, explanation := NodeType(result.NextNode), result.Goal, result.Explanation
+
+	// A decision the LLM is unsure about is not trusted, e.g. a command generated for an
+	// analytical question; the user is asked, or a second prompt decides
+	if result.Confidence != nil && *result.Confidence < n.MinConfidence {
+		logger := state.NodeLogger(NodeTypeClassifier)
+		logger.Info("classifier is unsure", "next_node", result.NextNode, "confidence", *result.Confidence)
+		unsure := fmt.Sprintf("the classifier was only %.0f%% sure of %s", *result.Confidence*100, result.NextNode)
+		if n.Clarify && !clarified(state) {
+			nextNode, goal = NodeTypeClarification, strings.TrimSpace(result.Question)
+			if goal == "" {
+				goal = defaultQuestion
+			}
+			explanation = unsure + ", so the user is asked"
+		} else {
+			second, err := n.secondOpinion(state, result)
+			if err != nil {
+				return "", fmt.Errorf("failed to get a second opinion: %w", err)
+			}
+			nextNode, goal = NodeType(second.NextNode), second.Goal
+			explanation = unsure + "; second opinion: " + second.Explanation
+			logger.Info("second opinion", "next_node", string(nextNode))
+		}
+	}
+
+	// A compound request is split into tasks before anything was done, unless the decision
+	// was not trusted
+	if len(result.Tasks) > 1 && nextNode == NodeType(result.NextNode) && len(state.GetTaskHistory()) == 0 && len(state.GetPlan()) == 0 {
+		var plan []TaskStatus
+		for _, task := range result.Tasks[:min(len(result.Tasks), MaxPlanTasks)] {
+			plan = append(plan, TaskStatus{NodeType: NodeType(task.NextNode), Goal: task.Goal})
+		}
+		nextNode, goal = plan[0].NodeType, plan[0].Goal
+		state.SetPlan(plan)
+		state.NodeLogger(NodeTypeClassifier).Debug("split request", "tasks", len(plan))
+		explanation = strings.TrimSpace(fmt.Sprintf("%s (first of %d tasks)", explanation, len(plan)))
+	}
+
+	state.NodeLogger(NodeTypeClassifier).Debug("classified request", "next_node", string(nextNode), "goal", goal)
+
+	// Questions to the user depend on the run; everything else can be reused
+	if first && n.Cache != nil && nextNode != NodeTypeClarification {
+		n.Cache.put(state.GetWorkingDirectory(), state.GetConversationContext(), state.GetInput(), nextNode, goal, state.GetPlan())
 	}
 
 	// Update state
-	state.NextNode = nextNode
-	state.CurrentTask = TaskStatus{
+	state.SetNextNode(nextNode)
+	state.SetCurrentTask(TaskStatus{
 		NodeType: nextNode,
 		Goal:     goal,
-	}
+	})
+	explainRoute(state, nextNode, goal, explanation)
 
 	return goal, nil
 }
 
+// matchRule returns the first rule matching input
+func (n *ClassifierNode) matchRule(input string) (RoutingRule, bool) {
+	input = strings.TrimSpace(input)
+	for _, rule := range n.Rules {
+		if rule.Pattern.MatchString(input) {
+			return rule, true
+		}
+	}
+	return RoutingRule{}, false
+}
+
+// verifyTaskCompletion asks the LLM whether the current task is done
 func (n *ClassifierNode) verifyTaskCompletion(state *State) (bool, error) {
-	prompt := fmt.Sprintf(`Verify if the following task was completed successfully:
-Task Goal: %s
-Node Type: %s
-Result: %s
-
-Please analyze if the task goal was achieved based on the result.
-Return JSON response with:
-{
-    "is_task_done": boolean,
-    "explanation": "why the task is considered done or not"
-}`, state.CurrentTask.Goal, state.CurrentTask.NodeType, state.CurrentTask.Result)
+	task := state.GetCurrentTask()
+	prompt, err := state.RenderPrompt(prompts.ClassifierVerifyTask, prompts.Vars{
+		"Goal":     task.Goal,
+		"NodeType": task.NodeType,
+		"Result":   task.Result,
+	})
+	if err != nil {
+		return false, err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return false, fmt.Errorf("LLM error: %v", err)
+		return false, fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
 		IsTaskDone  bool   `json:"is_task_done"`
 		Explanation string `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return false, fmt.Errorf("failed to parse LLM response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrParse, err)
+	}
+	choice := "done"
+	if !result.IsTaskDone {
+		choice = "not done"
 	}
+	state.Publish(&events.Decision{Node: string(NodeTypeClassifier), Kind: events.DecisionTaskDone, Choice: choice, Explanation: result.Explanation})
 
 	return result.IsTaskDone, nil
 }
 
+// isGlobalGoalMet asks the LLM whether the global goal is met
 func (n *ClassifierNode) isGlobalGoalMet(state *State) (bool, error) {
-	prompt := fmt.Sprintf(`Based on the completed tasks and current state, determine if the global goal has been met:
-Global Goal: %s
-Completed Tasks: %v
-Current State: `, state.GlobalGoal, state.TaskHistory)
+	prompt, err := state.RenderPrompt(prompts.ClassifierGoalMet, prompts.Vars{
+		"GlobalGoal":     state.GetGlobalGoal(),
+		"HistorySummary": state.GetEvictedHistorySummary(),
+		"TaskHistory":    state.GetTaskHistory(),
+	})
+	if err != nil {
+		return false, err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return false, fmt.Errorf("LLM error: %v", err)
+		return false, fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
 		IsGoalMet   bool   `json:"is_goal_met"`
 		Explanation string `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return false, fmt.Errorf("failed to parse LLM response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrParse, err)
+	}
+	choice := "met"
+	if !result.IsGoalMet {
+		choice = "not met"
 	}
+	state.Publish(&events.Decision{Node: string(NodeTypeClassifier), Kind: events.DecisionGoalMet, Choice: choice, Explanation: result.Explanation})
 
 	return result.IsGoalMet, nil
 }
 
-func (n *ClassifierNode) classifyRequest(state *State) (NodeType, string, error) {
-	prompt := fmt.Sprintf(`Based on the current state and task history, determine the next node to process the request:
-Input: %s
-Global Goal: %s
-Task History: %v
-Current State: `, state.Input, state.GlobalGoal, state.TaskHistory)
+func (n *ClassifierNode) classifyRequest(state *State) (classification, error) {
+	prompt, err := state.RenderPrompt(prompts.ClassifierClassify, prompts.Vars{
+		"ConversationContext": state.GetConversationContext(),
+		"Input":               state.GetInput(),
+		"GlobalGoal":          state.GetGlobalGoal(),
+		"HistorySummary":      state.GetEvictedHistorySummary(),
+		"TaskHistory":         state.GetTaskHistory(),
+		"Tools":               n.Tools,
+		"Nodes":               n.Nodes,
+		"Examples":            n.Examples,
+		"Clarify":             n.Clarify,
+	})
+	if err != nil {
+		return classification{}, err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return "", "", fmt.Errorf("LLM error: %v", err)
+		return classification{}, fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
-	var result struct {
-		NextNode    string `json:"next_node"`
-		Goal        string `json:"goal"`
-		Explanation string `json:"explanation"`
+	var result classification
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return classification{}, fmt.Errorf("%w: %v", ErrParse, err)
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return "", "", fmt.Errorf("failed to parse LLM response: %v", err)
+
+	return result, nil
+}
+
+// secondOpinion asks the LLM again, without the history of the run, which node handles a
+// request the first decision was unsure about
+func (n *ClassifierNode) secondOpinion(state *State, first classification) (classification, error) {
+	prompt, err := state.RenderPrompt(prompts.ClassifierSecondOpinion, prompts.Vars{
+		"ConversationContext": state.GetConversationContext(),
+		"Input":               state.GetInput(),
+		"NextNode":            first.NextNode,
+		"Goal":                first.Goal,
+		"Explanation":         first.Explanation,
+		"Nodes":               n.Nodes,
+	})
+	if err != nil {
+		return classification{}, err
 	}
 
-	return NodeType(result.NextNode), result.Goal, nil
+	response, err := n.llm.Complete(prompt)
+	if err != nil {
+		return classification{}, fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+
+	var result classification
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return classification{}, fmt.Errorf("%w: %v", ErrParse, err)
+	}
+
+	return result, nil
+}
+
+// advancePlan records result as the result of the running task of the plan and returns
+// the next task of the plan, if any; nodes answering directly leave their answer in the
+// final result only
+func advancePlan(state *State, result string) (TaskStatus, bool) {
+	if result == "" {
+		result = state.GetFinalResult()
+	}
+	plan := state.GetPlan()
+	for i := range plan {
+		if plan[i].IsCompleted {
+			continue
+		}
+		plan[i].IsCompleted = true
+		plan[i].Result = result
+		state.SetPlan(plan)
+		if i+1 < len(plan) {
+			return plan[i+1], true
+		}
+		break
+	}
+	return TaskStatus{}, false
+}
+
+// planAnswer combines the results of the tasks of a compound request into one answer;
+// it is empty if the request was not split
+func planAnswer(state *State) string {
+	plan := state.GetPlan()
+	if len(plan) < 2 {
+		return ""
+	}
+	parts := make([]string, len(plan))
+	for i, task := range plan {
+		parts[i] = fmt.Sprintf("%s:\n%s", task.Goal, strings.TrimSpace(task.Result))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// explainRoute publishes why the classifier routed the request to node
+func explainRoute(state *State, node NodeType, goal, explanation string) {
+	choice := string(node)
+	if goal != "" {
+		choice += ": " + goal
+	}
+	state.Publish(&events.Decision{Node: string(NodeTypeClassifier), Kind: events.DecisionRoute, Choice: choice, Explanation: explanation})
+}
+
+// clarified reports whether the user was already asked about the request in this run
+func clarified(state *State) bool {
+	for _, task := range state.GetTaskHistory() {
+		if task.NodeType == NodeTypeClarification {
+			return true
+		}
+	}
+	return false
 }
 
 func (n *ClassifierNode) Type() NodeType {
@@ -1,17 +1,21 @@
 package nodes
 
 import (
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/events"
 )
 
 func TestClassifierNode_Process(t *testing.T) {
 	mockLLM := &MockLLMForTesting{
 		Responses: map[string]string{
-			"Verify if the following task was completed successfully:\nTask Goal: analyze code in this directory\nNode Type: code_analyzer\nResult: \n\nPlease analyze if the task goal was achieved based on the result.\nReturn JSON response with:\n{\n    \"is_task_done\": boolean,\n    \"explanation\": \"why the task is considered done or not\"\n}": `{"is_task_done": true, "explanation": "Task completed successfully"}`,
-			"Based on the completed tasks and current state, determine if the global goal has been met:\nGlobal Goal: analyze code\nCompleted Tasks: [{NodeType:code_analyzer Goal:analyze code in this directory IsCompleted:false Result:} {NodeType:code_analyzer Goal:analyze code in this directory IsCompleted:true Result:}]\nCurrent State: ":         `{"is_goal_met": true, "explanation": "Global goal has been met"}`,
-			"Based on the current state and task history, determine the next node to process the request:\nInput: analyze code in this directory\nGlobal Goal: analyze code\nTask History: [{NodeType:code_analyzer Goal:analyze code in this directory IsCompleted:true Result:}]\nCurrent State: ":                                                          `{"next_node": "terminal", "goal": "", "explanation": "All tasks completed"}`,
+			"Verify if the following task was completed successfully:\nTask Goal: analyze code in this directory\nNode Type: code_analyzer\nResult: \n\nPlease analyze if the task goal was achieved based on the result.\nReturn JSON response with:\n{\n    \"is_task_done\": boolean,\n    \"explanation\": \"why the task is considered done or not\"\n}":                                                                                                                                                                                              `{"is_task_done": true, "explanation": "Task completed successfully"}`,
+			"Based on the completed tasks and current state, determine if the global goal has been met:\nGlobal Goal: analyze code\nCompleted Tasks: [{NodeType:code_analyzer Goal:analyze code in this directory IsCompleted:false Result:} {NodeType:code_analyzer Goal:analyze code in this directory IsCompleted:true Result:}]\nCurrent State: ":                                                                                                                                                                                                      `{"is_goal_met": true, "explanation": "Global goal has been met"}`,
+			"Based on the current state and task history, determine the next node to process the request:\nInput: analyze code in this directory\nGlobal Goal: analyze code\nTask History: [{NodeType:code_analyzer Goal:analyze code in this directory IsCompleted:true Result:}]\nIf the input asks for several separate things, also return them in order as \"tasks\", a list of objects with next_node and goal; next_node and goal are those of the first task.\nRate how sure you are of next_node from 0 to 1 as \"confidence\".\nCurrent State: ": `{"next_node": "terminal", "goal": "", "explanation": "All tasks completed"}`,
 		},
 	}
 
@@ -40,8 +44,8 @@ func TestClassifierNode_Process(t *testing.T) {
 	// Test verify task completion
 	mockLLM = &MockLLMForTesting{
 		Responses: map[string]string{
-			"Verify if the following task was completed successfully:\nTask Goal: list files in current directory\nNode Type: code_analyzer\nResult: \n\nPlease analyze if the task goal was achieved based on the result.\nReturn JSON response with:\n{\n    \"is_task_done\": boolean,\n    \"explanation\": \"why the task is considered done or not\"\n}": `{"is_task_done": false, "explanation": "Task not completed yet"}`,
-			"Based on the current state and task history, determine the next node to process the request:\nInput: list files\nGlobal Goal: list all files\nTask History: [{NodeType:code_analyzer Goal:list files in current directory IsCompleted:false Result:}]\nCurrent State: ":                                                                           `{"next_node": "code_analyzer", "goal": "retry listing files", "explanation": "Retrying task"}`,
+			"Verify if the following task was completed successfully:\nTask Goal: list files in current directory\nNode Type: code_analyzer\nResult: \n\nPlease analyze if the task goal was achieved based on the result.\nReturn JSON response with:\n{\n    \"is_task_done\": boolean,\n    \"explanation\": \"why the task is considered done or not\"\n}":                                                                                                                                                                             `{"is_task_done": false, "explanation": "Task not completed yet"}`,
+			"Based on the current state and task history, determine the next node to process the request:\nInput: list files\nGlobal Goal: list all files\nTask History: [{NodeType:code_analyzer Goal:list files in current directory IsCompleted:false Result:}]\nIf the input asks for several separate things, also return them in order as \"tasks\", a list of objects with next_node and goal; next_node and goal are those of the first task.\nRate how sure you are of next_node from 0 to 1 as \"confidence\".\nCurrent State: ": `{"next_node": "code_analyzer", "goal": "retry listing files", "explanation": "Retrying task"}`,
 		},
 	}
 
@@ -70,8 +74,8 @@ func TestClassifierNode_Process(t *testing.T) {
 	// Test code analyzer case
 	mockLLM = &MockLLMForTesting{
 		Responses: map[string]string{
-			"Verify if the following task was completed successfully:\nTask Goal: list files in current directory\nNode Type: code_analyzer\nResult: \n\nPlease analyze if the task goal was achieved based on the result.\nReturn JSON response with:\n{\n    \"is_task_done\": boolean,\n    \"explanation\": \"why the task is considered done or not\"\n}": `{"is_task_done": false, "explanation": "Task not completed yet"}`,
-			"Based on the current state and task history, determine the next node to process the request:\nInput: analyze code\nGlobal Goal: analyze code\nTask History: []\nCurrent State: ":                                                                                                                                                                  `{"next_node": "code_analyzer", "goal": "retry with sudo", "explanation": "Need to analyze code"}`,
+			"Verify if the following task was completed successfully:\nTask Goal: list files in current directory\nNode Type: code_analyzer\nResult: \n\nPlease analyze if the task goal was achieved based on the result.\nReturn JSON response with:\n{\n    \"is_task_done\": boolean,\n    \"explanation\": \"why the task is considered done or not\"\n}":                                                                                      `{"is_task_done": false, "explanation": "Task not completed yet"}`,
+			"Based on the current state and task history, determine the next node to process the request:\nInput: analyze code\nGlobal Goal: analyze code\nTask History: []\nIf the input asks for several separate things, also return them in order as \"tasks\", a list of objects with next_node and goal; next_node and goal are those of the first task.\nRate how sure you are of next_node from 0 to 1 as \"confidence\".\nCurrent State: ": `{"next_node": "code_analyzer", "goal": "retry with sudo", "explanation": "Need to analyze code"}`,
 		},
 	}
 
@@ -92,3 +96,230 @@ func TestClassifierNode_Process(t *testing.T) {
 	assert.Equal(t, NodeTypeCodeAnalyzer, state.NextNode)
 	assert.Equal(t, "retry with sudo", state.CurrentTask.Goal)
 }
+
+func TestClassifierNode_Examples(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnContains("determine the next node to process the request:\n" +
+		"Examples of requests and the node that handles them:\n" +
+		"- \"is staging healthy?\" -> bash\n" +
+		"- \"why is \\\"Process\\\" slow\" -> code_analyzer\n" +
+		"Input: is prod healthy?").
+		Respond(`{"next_node": "bash", "goal": "check the health of prod"}`)
+
+	node := NewClassifierNode(llm)
+	node.Examples = []RoutingExample{
+		{Input: "is staging healthy?", Node: NodeTypeBash},
+		{Input: `why is "Process" slow`, Node: NodeTypeCodeAnalyzer},
+	}
+	state := &State{Input: "is prod healthy?", GlobalGoal: "is prod healthy?"}
+
+	goal, err := node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, "check the health of prod", goal)
+	assert.Equal(t, NodeTypeBash, state.GetNextNode())
+	llm.AssertExpectations(t)
+}
+
+func TestClassifierNode_Rules(t *testing.T) {
+	tests := []struct {
+		input   string
+		node    NodeType
+		command string
+	}{
+		{" LS ", NodeTypeBash, "ls"},
+		{"list files", NodeTypeBash, "ls -la"},
+		{"git status", NodeTypeBash, "git status"},
+		{"explain main.go", NodeTypeCodeAnalyzer, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node := NewClassifierNode(NewScriptedLLM()) // any LLM call fails
+			node.Rules = append([]RoutingRule{
+				{Pattern: regexp.MustCompile(`^git status$`), Node: NodeTypeBash, Command: "git status"},
+				{Pattern: regexp.MustCompile(`^explain \S+\.go$`), Node: NodeTypeCodeAnalyzer},
+			}, node.Rules...)
+			state := &State{Input: tt.input}
+
+			goal, err := node.Process(state)
+			assert.NoError(t, err)
+			assert.Equal(t, strings.TrimSpace(tt.input), goal)
+			assert.Equal(t, tt.node, state.GetNextNode())
+			assert.Equal(t, tt.command, state.GetCurrentTask().Command)
+		})
+	}
+
+	// Once the command of a rule ran, the run ends without verification
+	node := NewClassifierNode(NewScriptedLLM())
+	state := &State{Input: "pwd", CurrentTask: TaskStatus{NodeType: NodeTypeBash, Goal: "pwd", Command: "pwd", Result: "/src"}}
+	_, err := node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, NodeTypeTerminal, state.GetNextNode())
+	assert.Equal(t, []TaskStatus{{NodeType: NodeTypeBash, Goal: "pwd", Command: "pwd", Result: "/src", IsCompleted: true}}, state.GetTaskHistory())
+
+	// Rules only route the request before any task ran
+	llm := NewScriptedLLM()
+	llm.OnContains("determine the next node").Respond(`{"next_node": "bash", "goal": "print the directory"}`)
+	state = &State{Input: "pwd", TaskHistory: []TaskStatus{{NodeType: NodeTypeBash, Goal: "ls", IsCompleted: true}}}
+	goal, err := NewClassifierNode(llm).Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, "print the directory", goal)
+}
+
+func TestClassifierNode_LowConfidence(t *testing.T) {
+	const classify = "determine the next node to process the request"
+	const secondOpinion = "is unsure which node should handle a request"
+
+	t.Run("confident", func(t *testing.T) {
+		llm := NewScriptedLLM()
+		llm.OnContains(classify).Respond(`{"next_node": "bash", "goal": "list files", "confidence": 0.9}`)
+		state := &State{Input: "list the files"}
+
+		_, err := NewClassifierNode(llm).Process(state)
+		assert.NoError(t, err)
+		assert.Equal(t, NodeTypeBash, state.GetNextNode())
+		llm.AssertExpectations(t)
+	})
+
+	t.Run("second opinion", func(t *testing.T) {
+		llm := NewScriptedLLM()
+		llm.OnContains(classify).Respond(`{"next_node": "bash", "goal": "grep for retries", "explanation": "maybe a search", "confidence": 0.3}`)
+		llm.OnContains(secondOpinion).Respond(`{"next_node": "code_analyzer", "goal": "explain the retries"}`)
+		state := &State{Input: "why does the job retry so often?"}
+
+		goal, err := NewClassifierNode(llm).Process(state)
+		assert.NoError(t, err)
+		assert.Equal(t, "explain the retries", goal)
+		assert.Equal(t, NodeTypeCodeAnalyzer, state.GetNextNode())
+		assert.Contains(t, llm.Calls()[1], `First choice: bash with the goal "grep for retries" (maybe a search)`)
+	})
+
+	t.Run("ignored", func(t *testing.T) {
+		llm := NewScriptedLLM()
+		llm.OnContains(classify).Respond(`{"next_node": "bash", "goal": "grep for retries", "confidence": 0.3}`)
+		node := NewClassifierNode(llm)
+		node.MinConfidence = 0
+		state := &State{Input: "why does the job retry so often?"}
+
+		_, err := node.Process(state)
+		assert.NoError(t, err)
+		assert.Equal(t, NodeTypeBash, state.GetNextNode())
+		assert.Len(t, llm.Calls(), 1)
+	})
+
+	t.Run("clarification", func(t *testing.T) {
+		llm := NewScriptedLLM()
+		llm.OnContains(classify).Respond(
+			`{"next_node": "bash", "goal": "restart the job", "confidence": 0.2, "question": "Do you want me to restart the job?"}`,
+			`{"next_node": "bash", "goal": "restart the job", "confidence": 0.4}`)
+		llm.OnContains(secondOpinion).Respond(`{"next_node": "direct_response", "goal": "explain the retries"}`)
+		node := NewClassifierNode(llm)
+		node.Clarify = true
+		state := &State{Input: "the job retries"}
+
+		goal, err := node.Process(state)
+		assert.NoError(t, err)
+		assert.Equal(t, "Do you want me to restart the job?", goal)
+		assert.Equal(t, NodeTypeClarification, state.GetNextNode())
+		assert.Contains(t, llm.Calls()[0], `add a "question" asking the user`)
+
+		// The answer is classified without verification; the user is only asked once
+		state.SetCurrentTaskResult("Asked the user: Do you want me to restart the job?\nThe user answered: no, why does it retry")
+		goal, err = node.Process(state)
+		assert.NoError(t, err)
+		assert.Equal(t, "explain the retries", goal)
+		assert.Equal(t, NodeTypeDirectResponse, state.GetNextNode())
+		if assert.Len(t, state.GetTaskHistory(), 1) {
+			assert.Equal(t, NodeTypeClarification, state.GetTaskHistory()[0].NodeType)
+		}
+		assert.Contains(t, llm.Calls()[1], "The user answered: no, why does it retry")
+		assert.Len(t, llm.Calls(), 3)
+	})
+}
+
+func TestClassifierNode_CompoundRequest(t *testing.T) {
+	llm := NewScriptedLLM()
+	classify := llm.OnContains("determine the next node to process the request").Respond(`{
+		"next_node": "bash", "goal": "list the go files",
+		"tasks": [
+			{"next_node": "bash", "goal": "list the go files"},
+			{"next_node": "code_analyzer", "goal": "explain what main.go does"}
+		]}`)
+	llm.OnContains("Verify if the following task").Respond(`{"is_task_done": true}`)
+	goalMet := llm.OnContains("determine if the global goal has been met").Respond(`{"is_goal_met": true}`)
+	node := NewClassifierNode(llm)
+	state := &State{Input: "list the go files and explain what main.go does"}
+
+	goal, err := node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, "list the go files", goal)
+	assert.Equal(t, NodeTypeBash, state.GetNextNode())
+	assert.Len(t, state.GetPlan(), 2)
+
+	// The second task runs without classifying the request again
+	state.SetCurrentTaskResult("main.go\nutil.go\n")
+	goal, err = node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, "explain what main.go does", goal)
+	assert.Equal(t, NodeTypeCodeAnalyzer, state.GetNextNode())
+	assert.Equal(t, 1, classify.CallCount())
+	assert.Equal(t, 0, goalMet.CallCount(), "the goal is only checked after the last task")
+
+	// The results of both tasks make up the answer
+	state.SetCurrentTaskResult("main.go starts the CLI.")
+	_, err = node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, NodeTypeTerminal, state.GetNextNode())
+	assert.Equal(t, "list the go files:\nmain.go\nutil.go\n\nexplain what main.go does:\nmain.go starts the CLI.", state.GetFinalResult())
+}
+
+func TestClassifierNode_PublishesDecisions(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnContains("Verify if the following task").Respond(`{"is_task_done": true, "explanation": "the files were listed"}`)
+	llm.OnContains("global goal has been met").Respond(`{"is_goal_met": false, "explanation": "main.go is not explained yet"}`)
+	llm.OnContains("determine the next node").Respond(`{"next_node": "code_analyzer", "goal": "explain main.go", "explanation": "needs the code"}`)
+	bus := events.NewBus()
+	var decisions []events.Decision
+	bus.Subscribe(events.SubscriberFunc(func(event events.Event) {
+		if d, ok := event.(*events.Decision); ok {
+			decisions = append(decisions, events.Decision{Node: d.Node, Kind: d.Kind, Choice: d.Choice, Explanation: d.Explanation})
+		}
+	}))
+	state := &State{
+		Input:       "list the files and explain main.go",
+		CurrentTask: TaskStatus{NodeType: NodeTypeBash, Goal: "list files", Result: "main.go"},
+		Events:      bus.ForRun("run"),
+	}
+
+	_, err := NewClassifierNode(llm).Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, []events.Decision{
+		{Node: "classifier", Kind: events.DecisionTaskDone, Choice: "done", Explanation: "the files were listed"},
+		{Node: "classifier", Kind: events.DecisionGoalMet, Choice: "not met", Explanation: "main.go is not explained yet"},
+		{Node: "classifier", Kind: events.DecisionRoute, Choice: "code_analyzer: explain main.go", Explanation: "needs the code"},
+	}, decisions)
+}
+
+func TestClassifierNode_GoalCheck(t *testing.T) {
+	task := TaskStatus{NodeType: NodeTypeBash, Goal: "list files", Result: "main.go"}
+
+	// The goal is only checked once the task is known to be done
+	llm := NewScriptedLLM()
+	llm.OnContains("Verify if the following task was completed").Respond(`{"is_task_done": false}`)
+	goalMet := llm.OnContains("determine if the global goal has been met").Respond(`{"is_goal_met": true}`)
+	llm.OnContains("determine the next node").Respond(`{"next_node": "bash", "goal": "list all files"}`)
+	state := &State{Input: "list files", GlobalGoal: "list files", CurrentTask: task}
+	goal, err := NewClassifierNode(llm).Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, "list all files", goal)
+	assert.Zero(t, goalMet.CallCount())
+
+	// A planned task follows, so the goal is not checked either
+	llm = NewScriptedLLM()
+	llm.OnContains("Verify if the following task was completed").Respond(`{"is_task_done": true}`)
+	state = &State{Input: "list files", GlobalGoal: "list files", CurrentTask: task,
+		Plan: []TaskStatus{{NodeType: NodeTypeBash, Goal: "list files"}, {NodeType: NodeTypeDirectResponse, Goal: "explain"}}}
+	_, err = NewClassifierNode(llm).Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, NodeTypeDirectResponse, state.GetNextNode())
+	assert.Len(t, llm.Calls(), 1)
+}
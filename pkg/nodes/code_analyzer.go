@@ -1,11 +1,34 @@
 package nodes
 
 import (
-	"encoding/json"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/prompts"
+	"aiagent/pkg/truncate"
+)
+
+const (
+	// maxSubjectTerms caps the related terms the code is searched for
+	maxSubjectTerms = 10
+
+	// maxSubjectMentions caps the lines mentioning the subject that are sent with it
+	maxSubjectMentions = 50
+
+	// maxMentionLength caps the length of a line mentioning the subject
+	maxMentionLength = 200
+
+	// minMentionTermLength is the length below which a term is not searched for
+	minMentionTermLength = 3
 )
 
 // CodeAnalyzerNodeInterface defines the operations for a code analyzer node
@@ -23,87 +46,161 @@ type CodeAnalyzerNodeInterface interface {
 // CodeAnalyzerNode implements code analysis logic
 type CodeAnalyzerNode struct {
 	llm LLM
+
+	// Cache, if set, keeps the symbols extracted from the files across runs; nil extracts
+	// them on every run
+	Cache *SymbolCache
+
+	// Diagram is the format of the package diagram added to the answers about the
+	// architecture of a Go module, DiagramMermaid or DiagramGraphviz; empty adds none
+	Diagram string
 }
 
 // NewCodeAnalyzerNode creates a new code analyzer node
 func NewCodeAnalyzerNode(llm LLM) *CodeAnalyzerNode {
 	return &CodeAnalyzerNode{
-		llm: llm,
+		llm:     llm,
+		Diagram: DiagramMermaid,
 	}
 }
 
 // Process implements the Node interface for CodeAnalyzerNode
 func (n *CodeAnalyzerNode) Process(state *State) error {
-	// Get file patterns to analyze
-	needsContent, patterns, err := n.determineContentNeeds(state)
+	// Get file patterns to analyze, with the subject of the task and the terms naming it
+	plan, err := n.planAnalysis(state)
 	if err != nil {
-		return fmt.Errorf("failed to determine content needs: %v", err)
+		return fmt.Errorf("failed to determine content needs: %w", err)
 	}
 
-	if !needsContent {
-		return nil
+	// Find matching files
+	var files []string
+	if plan.needsContent {
+		files, err = n.findMatchingFiles(plan.patterns)
+		if err != nil {
+			return fmt.Errorf("failed to find matching files: %v", err)
+		}
 	}
 
-	// Find matching files
-	files, err := n.findMatchingFiles(patterns)
-	if err != nil {
-		return fmt.Errorf("failed to find matching files: %v", err)
+	// Without files to read, the subject is analyzed with the lines of the code mentioning it
+	if len(files) == 0 {
+		return n.processSubject(state, plan)
 	}
 
 	// Read file contents with safety checks
-	contents := make(map[string]string)
-	for _, file := range files {
-		// Validate file path
-		if err := validateFilePath(file, state.WorkingDirectory); err != nil {
-			return fmt.Errorf("invalid file path: %v", err)
-		}
+	_, fileSizeLimit := state.GetFileLimits()
+	contents, symbols, err := n.readFiles(state.NodeLogger(NodeTypeCodeAnalyzer), files, state.GetWorkingDirectory(), fileSizeLimit)
+	if err != nil {
+		return err
+	}
 
-		// Check file size
-		info, err := os.Stat(file)
-		if err != nil {
-			return fmt.Errorf("failed to stat file %s: %v", file, err)
-		}
+	// Questions about the architecture are answered with the imports between the packages
+	// and a diagram of them
+	var architecture *PackageGraph
+	if n.Diagram != "" && architecturePattern.MatchString(state.GetCurrentTask().Goal) {
+		architecture = n.packageGraph(state)
+	}
 
-		if info.Size() > state.FileSizeLimit {
-			return fmt.Errorf("file %s exceeds size limit of %d bytes", file, state.FileSizeLimit)
-		}
+	var imports string
+	if architecture != nil {
+		imports = architecture.String()
+	}
 
-		// Read file with size limit
-		content, err := readFileWithLimit(file, state.FileSizeLimit)
-		if err != nil {
-			return fmt.Errorf("failed to read file %s: %v", file, err)
+	// Questions about the exported API are answered with its reference
+	var api string
+	if apiPattern.MatchString(state.GetCurrentTask().Goal) {
+		if ref, err := ExtractAPI(state.GetWorkingDirectory()); err != nil {
+			state.NodeLogger(NodeTypeCodeAnalyzer).Debug("no API reference", "error", err)
+		} else if len(ref.Packages) > 0 {
+			api = ref.Summary(maxAPIPromptBytes)
 		}
-		contents[file] = content
 	}
 
 	// Analyze contents
-	analysis, err := n.analyzeContents(state, contents)
+	analysis, err := n.analyzeContents(state, contents, symbols, imports, api)
 	if err != nil {
-		return fmt.Errorf("failed to analyze contents: %v", err)
+		return fmt.Errorf("failed to analyze contents: %w", err)
+	}
+	if architecture != nil {
+		analysis = strings.TrimSpace(analysis) + "\n\n" + architecture.Diagram(n.Diagram)
 	}
 
 	// Store the result
-	state.FinalResult = analysis
-	state.NextNode = NodeTypeTerminal
+	state.SetFinalResult(analysis)
+	state.SetNextNode(NodeTypeTerminal)
 
 	return nil
 }
 
-func (n *CodeAnalyzerNode) determineContentNeeds(state *State) (bool, []string, error) {
-	prompt := fmt.Sprintf(`Based on the current task, determine if code content analysis is needed:
-Task Goal: %s
-Working Directory: %s
+// packageGraph returns the import graph of the packages of the working directory, nil if it
+// is not a Go module of several packages
+func (n *CodeAnalyzerNode) packageGraph(state *State) *PackageGraph {
+	g, err := BuildPackageGraph(state.GetWorkingDirectory())
+	if err != nil {
+		state.NodeLogger(NodeTypeCodeAnalyzer).Debug("no package diagram", "error", err)
+		return nil
+	}
+	if len(g.Packages) < 2 {
+		return nil
+	}
+	return g.Collapse(maxDiagramPackages)
+}
 
-Return JSON response with:
-{
-    "needs_content": boolean,
-    "file_patterns": ["pattern1", "pattern2"],
-    "explanation": "why content is needed or not"
-}`, state.CurrentTask.Goal, state.WorkingDirectory)
+// analysisPlan is what the code analyzer reads to answer a task: the files matching the
+// patterns if the task needs their contents, otherwise the lines of the code mentioning its
+// subject or the terms related to it
+type analysisPlan struct {
+	needsContent bool
+	patterns     []string
+	subject      string
+	terms        []string
+}
 
-	response, err := n.llm.Complete(prompt)
+// planAnalysis asks the LLM whether the task needs file contents, what its subject is and
+// which terms name it; the three prompts are independent, so they are sent at the same time
+// The subject and the terms only matter when no file is read, so failing to get them is logged
+// rather than returned
+func (n *CodeAnalyzerNode) planAnalysis(state *State) (analysisPlan, error) {
+	vars := prompts.Vars{
+		"Goal":             state.GetCurrentTask().Goal,
+		"WorkingDirectory": state.GetWorkingDirectory(),
+	}
+	var requests []string
+	for _, name := range []string{prompts.CodeAnalyzerContentNeeds, prompts.CodeAnalyzerExtractSubject, prompts.CodeAnalyzerRelatedTerms} {
+		prompt, err := state.RenderPrompt(name, vars)
+		if err != nil {
+			return analysisPlan{}, err
+		}
+		requests = append(requests, prompt)
+	}
+
+	calls, err := completeAll(state.GetContext(), n.llm, requests...)
+	if err != nil {
+		return analysisPlan{}, fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+
+	var plan analysisPlan
+	plan.needsContent, plan.patterns, err = n.parseContentNeeds(state, calls[0])
 	if err != nil {
-		return false, nil, fmt.Errorf("LLM error: %v", err)
+		return analysisPlan{}, err
+	}
+	logger := state.NodeLogger(NodeTypeCodeAnalyzer)
+	if calls[1].err != nil {
+		logger.Warn("failed to extract the subject", "error", calls[1].err)
+	} else {
+		plan.subject = parseSubject(calls[1].response)
+	}
+	if calls[2].err != nil {
+		logger.Warn("failed to generate related terms", "error", calls[2].err)
+	} else {
+		plan.terms = parseTerms(calls[2].response)
+	}
+	return plan, nil
+}
+
+// parseContentNeeds returns whether the task needs file contents, and the patterns of the files
+func (n *CodeAnalyzerNode) parseContentNeeds(state *State, call llmCall) (bool, []string, error) {
+	if call.err != nil {
+		return false, nil, fmt.Errorf("%w: %w", ErrLLM, call.err)
 	}
 
 	var result struct {
@@ -111,13 +208,126 @@ Return JSON response with:
 		FilePatterns []string `json:"file_patterns"`
 		Explanation  string   `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return false, nil, fmt.Errorf("failed to parse content need response: %v", err)
+	if err := parseResponse(state, n.llm, call.response, &result); err != nil {
+		return false, nil, fmt.Errorf("failed to parse content need response: %w", withKind(ErrParse, err))
+	}
+	choice := "no file contents needed"
+	if result.NeedsContent {
+		choice = "read " + strings.Join(result.FilePatterns, ", ")
 	}
+	state.Publish(&events.Decision{Node: string(NodeTypeCodeAnalyzer), Kind: events.DecisionContentNeeds, Choice: choice, Explanation: result.Explanation})
 
 	return result.NeedsContent, result.FilePatterns, nil
 }
 
+// parseSubject returns the subject named by an extract_subject response: its first line,
+// without quotes or the final period
+func parseSubject(response string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(response), "\n")
+	return strings.Trim(strings.TrimSpace(subject), "\"'`.")
+}
+
+// parseTerms returns the terms listed by a related_terms response, separated by commas or
+// lines, without duplicates and at most maxSubjectTerms of them
+func parseTerms(response string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, term := range strings.FieldsFunc(response, func(r rune) bool { return r == ',' || r == '\n' }) {
+		term = strings.Trim(strings.TrimSpace(term), "-*\"'`.")
+		key := strings.ToLower(strings.TrimSpace(term))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		terms = append(terms, strings.TrimSpace(term))
+		if len(terms) == maxSubjectTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// processSubject analyzes the subject of the task with the lines of the working directory
+// mentioning it or its related terms; without a subject there is nothing to analyze
+func (n *CodeAnalyzerNode) processSubject(state *State, plan analysisPlan) error {
+	if plan.subject == "" {
+		return nil
+	}
+
+	dir := state.GetWorkingDirectory()
+	mentions, err := findMentions(dir, append([]string{plan.subject}, plan.terms...), maxSubjectMentions)
+	if err != nil {
+		state.NodeLogger(NodeTypeCodeAnalyzer).Warn("failed to search the code", "error", err)
+	}
+	analysis, err := n.analyzeSubject(state, plan.subject, strings.Join(mentions, "\n"), dir)
+	if err != nil {
+		return fmt.Errorf("failed to analyze subject: %w", err)
+	}
+
+	state.SetFinalResult(analysis)
+	state.SetNextNode(NodeTypeTerminal)
+	return nil
+}
+
+// findMentions returns the lines of the text files below dir containing one of the terms,
+// ignoring case, as "file:line: text", at most limit of them in the order of the files; hidden
+// directories and dependencies are skipped like by FindTodos, and so are terms shorter than
+// minMentionTermLength, which would match almost every line
+func findMentions(dir string, terms []string, limit int) ([]string, error) {
+	var needles []string
+	for _, term := range terms {
+		if term = strings.ToLower(strings.TrimSpace(term)); len(term) >= minMentionTermLength {
+			needles = append(needles, term)
+		}
+	}
+	if len(needles) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	var mentions []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip what cannot be read
+		}
+		if path != dir && (strings.HasPrefix(d.Name(), ".") || d.IsDir() && todoSkippedDirs[d.Name()]) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !isTextFile(d.Name()) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxTodoFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+
+		for i, line := range strings.Split(string(data), "\n") {
+			lower := strings.ToLower(line)
+			if !slices.ContainsFunc(needles, func(needle string) bool { return strings.Contains(lower, needle) }) {
+				continue
+			}
+			mentions = append(mentions, fmt.Sprintf("%s:%d: %s", filepath.ToSlash(rel), i+1, truncate.Tail(strings.TrimSpace(line), maxMentionLength)))
+			if len(mentions) == limit {
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for %s: %v", strings.Join(terms, ", "), err)
+	}
+	return mentions, nil
+}
+
 func (n *CodeAnalyzerNode) findMatchingFiles(patterns []string) ([]string, error) {
 	var matches []string
 	for _, pattern := range patterns {
@@ -130,61 +340,179 @@ func (n *CodeAnalyzerNode) findMatchingFiles(patterns []string) ([]string, error
 	return matches, nil
 }
 
-func (n *CodeAnalyzerNode) analyzeContents(state *State, contents map[string]string) (string, error) {
-	// Build content string
-	var contentStr strings.Builder
-	for file, content := range contents {
-		contentStr.WriteString(fmt.Sprintf("=== %s ===\n%s\n\n", file, content))
+// readFiles reads the files with safety checks and extracts their symbols, sharding them
+// across a pool of workers
+// The error of the first failing file in the order of files is returned, so the outcome does
+// not depend on which worker finishes first
+func (n *CodeAnalyzerNode) readFiles(logger *slog.Logger, files []string, workingDir string, sizeLimit int64) (map[string]string, map[string][]Symbol, error) {
+	type fileResult struct {
+		content string
+		symbols []Symbol
+		err     error
+	}
+	results := make([]fileResult, len(files))
+
+	workers := min(runtime.GOMAXPROCS(0), len(files))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				content, err := readCheckedFile(files[i], workingDir, sizeLimit)
+				if err != nil {
+					results[i] = fileResult{err: err}
+					continue
+				}
+				symbols, cacheErr := n.Cache.symbols(files[i], content)
+				if cacheErr != nil {
+					logger.Warn("symbol cache failed", "error", cacheErr)
+				}
+				results[i] = fileResult{content: content, symbols: symbols}
+			}
+		}()
 	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	contents := make(map[string]string, len(files))
+	symbols := make(map[string][]Symbol, len(files))
+	for i, file := range files {
+		if results[i].err != nil {
+			return nil, nil, results[i].err
+		}
+		contents[file] = results[i].content
+		symbols[file] = results[i].symbols
+	}
+	return contents, symbols, nil
+}
 
-	prompt := fmt.Sprintf(`Analyze the following code contents based on the task goal:
-Task Goal: %s
+// readCheckedFile reads a file after checking that it is inside the working directory and
+// within the size limit
+func readCheckedFile(file string, workingDir string, sizeLimit int64) (string, error) {
+	// Validate file path
+	if err := validateFilePath(file, workingDir); err != nil {
+		return "", fmt.Errorf("invalid file path: %v", err)
+	}
 
-Code Contents:
-%s
+	// Check file size
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file %s: %v", file, err)
+	}
 
-Return JSON response with:
-{
-    "analysis": "detailed analysis of the code",
-    "recommendations": ["recommendation1", "recommendation2"],
-    "explanation": "explanation of the analysis"
-}`, state.CurrentTask.Goal, contentStr.String())
+	if info.Size() > sizeLimit {
+		return "", fmt.Errorf("file %s exceeds size limit of %d bytes", file, sizeLimit)
+	}
 
-	response, err := n.llm.Complete(prompt)
+	// Read file with size limit
+	content, err := readFileWithLimit(file, sizeLimit)
 	if err != nil {
-		return "", fmt.Errorf("LLM error: %v", err)
+		return "", fmt.Errorf("failed to read file %s: %v", file, err)
+	}
+	return content, nil
+}
+
+func (n *CodeAnalyzerNode) analyzeContents(state *State, contents map[string]string, symbols map[string][]Symbol, imports, api string) (string, error) {
+	// Build content string; files are sorted so the prompt does not depend on map order
+	files := make([]string, 0, len(contents))
+	for file := range contents {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	sections := make([]string, len(files))
+	sizes := make([]int, len(files))
+	for i, file := range files {
+		sections[i] = fmt.Sprintf("=== %s ===\n%s\n\n", file, contents[file])
+		sizes[i] = len(sections[i])
+	}
+
+	// Files that do not fit in one prompt are packed into as few prompts as possible,
+	// which are analyzed at the same time
+	batches := packBatches(sizes, state.GetLimits().MaxPromptContentBytes)
+	if len(batches) == 0 {
+		batches = [][]int{nil}
+	}
+	batchPrompts := make([]string, len(batches))
+	for b, batch := range batches {
+		var contentStr strings.Builder
+		batchFiles := make([]string, 0, len(batch))
+		for _, i := range batch {
+			contentStr.WriteString(sections[i])
+			batchFiles = append(batchFiles, files[i])
+		}
+
+		prompt, err := state.RenderPrompt(prompts.CodeAnalyzerAnalyzeContents, prompts.Vars{
+			"Goal":     state.GetCurrentTask().Goal,
+			"Contents": contentStr.String(),
+			"Symbols":  formatSymbols(batchFiles, symbols),
+			"Imports":  imports,
+			"API":      api,
+		})
+		if err != nil {
+			return "", err
+		}
+		batchPrompts[b] = prompt
+	}
+
+	if len(batchPrompts) == 1 {
+		response, err := n.llm.Complete(batchPrompts[0])
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrLLM, err)
+		}
+		return n.parseAnalysis(state, response)
 	}
 
+	calls, err := completeAll(state.GetContext(), n.llm, batchPrompts...)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+	analyses := make([]string, 0, len(calls))
+	for _, call := range calls {
+		if call.err != nil {
+			return "", fmt.Errorf("%w: %w", ErrLLM, call.err)
+		}
+		analysis, err := n.parseAnalysis(state, call.response)
+		if err != nil {
+			return "", err
+		}
+		analyses = append(analyses, analysis)
+	}
+	return strings.Join(analyses, "\n\n"), nil
+}
+
+// parseAnalysis returns the analysis of an analyze_contents response
+func (n *CodeAnalyzerNode) parseAnalysis(state *State, response string) (string, error) {
 	var result struct {
 		Analysis        string   `json:"analysis"`
 		Recommendations []string `json:"recommendations"`
 		Explanation     string   `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return "", fmt.Errorf("failed to parse analysis response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return "", fmt.Errorf("failed to parse analysis response: %w", withKind(ErrParse, err))
 	}
 
 	return result.Analysis, nil
 }
 
-func (n *CodeAnalyzerNode) analyzeSubject(subject string, codeContext string, workingDir string) (string, error) {
-	prompt := fmt.Sprintf(`Analyze the following code subject:
-Subject: %s
-Working Directory: %s
-
-Code Context:
-%s
-
-Return JSON response with:
-{
-    "analysis": "detailed analysis of the subject",
-    "recommendations": ["recommendation1", "recommendation2"],
-    "explanation": "explanation of the analysis"
-}`, subject, workingDir, codeContext)
+func (n *CodeAnalyzerNode) analyzeSubject(state *State, subject string, codeContext string, workingDir string) (string, error) {
+	prompt, err := state.RenderPrompt(prompts.CodeAnalyzerAnalyzeSubject, prompts.Vars{
+		"Subject":          subject,
+		"WorkingDirectory": workingDir,
+		"CodeContext":      codeContext,
+	})
+	if err != nil {
+		return "", err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return "", fmt.Errorf("LLM error: %v", err)
+		return "", fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
@@ -192,8 +520,8 @@ Return JSON response with:
 		Recommendations []string `json:"recommendations"`
 		Explanation     string   `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return "", fmt.Errorf("failed to parse analysis response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return "", fmt.Errorf("failed to parse analysis response: %w", withKind(ErrParse, err))
 	}
 
 	return result.Analysis, nil
@@ -263,3 +591,12 @@ func readFileWithLimit(path string, limit int64) (string, error) {
 
 	return string(content), nil
 }
+
+// Describe implements the Describer interface for CodeAnalyzerNode
+func (n *CodeAnalyzerNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeCodeAnalyzer,
+		Description: "reads and explains the source code in the working directory",
+		Examples:    []string{"explain how the config is loaded"},
+	}
+}
@@ -0,0 +1,118 @@
+package nodes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/logging"
+	"aiagent/pkg/storage"
+)
+
+func TestCodeAnalyzerNode_ReadFiles(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i := range 20 {
+		file := filepath.Join(dir, fmt.Sprintf("file%02d.go", i))
+		assert.NoError(t, os.WriteFile(file, []byte(fmt.Sprintf("package p%d", i)), 0644))
+		files = append(files, file)
+	}
+
+	node := NewCodeAnalyzerNode(nil)
+	contents, _, err := node.readFiles(logging.Discard(), files, dir, 1000)
+	assert.NoError(t, err)
+	assert.Len(t, contents, 20)
+	assert.Equal(t, "package p7", contents[files[7]])
+
+	// The first failing file in order is reported, whichever worker reads it
+	large := filepath.Join(dir, "large.go")
+	assert.NoError(t, os.WriteFile(large, make([]byte, 2000), 0644))
+	missing := filepath.Join(dir, "missing.go")
+	for range 5 {
+		_, _, err = node.readFiles(logging.Discard(), append(append([]string{}, files...), missing, large), dir, 1000)
+		assert.ErrorContains(t, err, missing)
+	}
+
+	_, _, err = node.readFiles(logging.Discard(), []string{filepath.Join(t.TempDir(), "outside.go")}, dir, 1000)
+	assert.ErrorContains(t, err, "invalid file path")
+
+	contents, _, err = node.readFiles(logging.Discard(), nil, dir, 1000)
+	assert.NoError(t, err)
+	assert.Empty(t, contents)
+}
+
+func TestExtractSymbols(t *testing.T) {
+	goSource := `package store
+
+const Version = 1
+
+type Store struct{}
+
+func New() *Store { return &Store{} }
+
+func (s *Store) Get(key string) string { return key }
+`
+	assert.Equal(t, []Symbol{
+		{Kind: "const", Name: "Version", Line: 3},
+		{Kind: "type", Name: "Store", Line: 5},
+		{Kind: "func", Name: "New", Line: 7},
+		{Kind: "method", Name: "Store.Get", Line: 9},
+	}, extractSymbols("store.go", goSource))
+
+	pySource := "import os\n\nclass Store:\n    def get(self, key):\n        return key\n"
+	assert.Equal(t, []Symbol{
+		{Kind: "class", Name: "Store", Line: 3},
+		{Kind: "func", Name: "get", Line: 4},
+	}, extractSymbols("store.py", pySource))
+
+	assert.Nil(t, extractSymbols("broken.go", "package"))
+	assert.Nil(t, extractSymbols("README.md", "# Store"))
+}
+
+func TestSymbolCache(t *testing.T) {
+	store := storage.NewFileStore(t.TempDir())
+	cache := NewSymbolCache(store)
+	source := "package main\n\nfunc main() {}\n"
+
+	symbols, err := cache.symbols("main.go", source)
+	assert.NoError(t, err)
+	assert.Equal(t, []Symbol{{Kind: "func", Name: "main", Line: 3}}, symbols)
+
+	// An unchanged file is not parsed again
+	key := symbolCacheKey("main.go", source)
+	assert.NoError(t, store.Put(SymbolCacheCollection, key, cachedSymbols{Version: symbolsVersion, Symbols: []Symbol{{Kind: "func", Name: "cached", Line: 1}}}))
+	symbols, err = cache.symbols("main.go", source)
+	assert.NoError(t, err)
+	assert.Equal(t, "cached", symbols[0].Name)
+
+	// Symbols cached by another version are extracted again
+	assert.NoError(t, store.Put(SymbolCacheCollection, key, cachedSymbols{Version: symbolsVersion - 1}))
+	symbols, err = cache.symbols("main.go", source)
+	assert.NoError(t, err)
+	assert.Equal(t, "main", symbols[0].Name)
+
+	symbols, err = (*SymbolCache)(nil).symbols("main.go", source)
+	assert.NoError(t, err)
+	assert.Equal(t, "main", symbols[0].Name)
+}
+
+func TestCodeAnalyzerNode_AnalyzeContentsInBatches(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnContains("=== a.go ===").Respond(`{"analysis": "a and b"}`)
+	llm.OnContains("=== c.go ===").Respond(`{"analysis": "c"}`)
+	state := &State{CurrentTask: TaskStatus{Goal: "explain"}, Limits: StateLimits{MaxPromptContentBytes: 60}}
+
+	analysis, err := NewCodeAnalyzerNode(llm).analyzeContents(state, map[string]string{
+		"a.go": "package a",
+		"b.go": "package b",
+		"c.go": strings.Repeat("c", 50),
+	}, nil, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "a and b\n\nc", analysis)
+	assert.Len(t, llm.Calls(), 2)
+	assert.True(t, llm.AssertExpectations(t))
+}
@@ -1,12 +1,17 @@
 package nodes
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 	"time"
+
+	"aiagent/pkg/policy"
+	"aiagent/pkg/prompts"
+	"aiagent/pkg/quarantine"
+	"aiagent/pkg/snapshot"
 )
 
 // CodeFixerNodeInterface defines the operations for a code fixer node
@@ -24,6 +29,21 @@ type CodeFixerNodeInterface interface {
 // CodeFixerNode implements code fixing and testing logic
 type CodeFixerNode struct {
 	llm LLM
+
+	// Engine, if set, decides whether files may be written
+	Engine policy.Engine
+
+	// Asker asks the user about the writes the Engine wants approved; without one they are denied
+	Asker CommandApprover
+
+	// User is the user the files are written for, passed to the Engine
+	User string
+
+	// Quarantine, if set, receives the writes outside of its scope instead of the working tree
+	Quarantine *quarantine.Quarantine
+
+	// Snapshots, if set, back up the files before they are written, so the run can be rolled back
+	Snapshots *snapshot.Store
 }
 
 // NewCodeFixerNode creates a new code fixer node
@@ -33,34 +53,23 @@ func NewCodeFixerNode(llm LLM) *CodeFixerNode {
 	}
 }
 
+// Steps of the sub-graph of the code fixer
+const (
+	codeFixerPlan   NodeType = "plan"
+	codeFixerBuild  NodeType = "build"
+	codeFixerTest   NodeType = "test"
+	codeFixerReview NodeType = "review"
+)
+
 // Process implements the Node interface for CodeFixerNode
 func (n *CodeFixerNode) Process(state *State) error {
-	// First, analyze the current state and codebase
-	analysis, err := n.analyzeCodebase(state)
+	// Plan, fix the build, fix the tests and review run as a sub-graph; its result is the
+	// next goal
+	goal, err := n.subGraph(state).Run(state, state.GetGlobalGoal())
 	if err != nil {
-		return fmt.Errorf("failed to analyze codebase: %v", err)
-	}
-
-	// Check if codebase is buildable
-	if err := n.checkBuildability(state); err != nil {
-		// If not buildable, try to fix the issues
-		if err := n.fixBuildIssues(state, err.Error()); err != nil {
-			return fmt.Errorf("failed to fix build issues: %v", err)
-		}
-	}
-
-	// Run tests
-	if err := n.runTests(state); err != nil {
-		// If tests fail, try to fix the issues
-		if err := n.fixTestIssues(state, err.Error()); err != nil {
-			return fmt.Errorf("failed to fix test issues: %v", err)
-		}
-	}
-
-	// Update the goal based on the analysis
-	if err := n.updateGoal(state, analysis); err != nil {
-		return fmt.Errorf("failed to update goal: %v", err)
+		return err
 	}
+	state.SetGlobalGoal(goal)
 
 	// Build the new version
 	if err := n.buildNewVersion(state); err != nil {
@@ -77,24 +86,63 @@ func (n *CodeFixerNode) Process(state *State) error {
 	return nil
 }
 
+// subGraph returns the steps fixing the code; the plan and the review read the tasks of the
+// run from state, the others work on the state of the sub-graph
+func (n *CodeFixerNode) subGraph(state *State) *SubGraph {
+	var analysis string
+	return &SubGraph{
+		Name: string(NodeTypeCodeFixer),
+		Steps: []SubGraphStep{
+			{Type: codeFixerPlan, Step: StepFunc(func(child *State) error {
+				var err error
+				if analysis, err = n.analyzeCodebase(state); err != nil {
+					return fmt.Errorf("failed to analyze codebase: %w", err)
+				}
+				child.SetRawOutput(analysis)
+				return nil
+			})},
+			{Type: codeFixerBuild, Step: StepFunc(func(child *State) error {
+				if err := n.checkBuildability(child); err != nil {
+					if err := n.fixBuildIssues(child, err.Error()); err != nil {
+						return fmt.Errorf("failed to fix build issues: %w", err)
+					}
+				}
+				return nil
+			})},
+			{Type: codeFixerTest, Step: StepFunc(func(child *State) error {
+				if err := n.runTests(child); err != nil {
+					if err := n.fixTestIssues(child, err.Error()); err != nil {
+						return fmt.Errorf("failed to fix test issues: %w", err)
+					}
+				}
+				return nil
+			})},
+			{Type: codeFixerReview, Step: StepFunc(func(child *State) error {
+				goal, err := n.nextGoal(state, analysis)
+				if err != nil {
+					return fmt.Errorf("failed to update goal: %w", err)
+				}
+				child.SetFinalResult(goal)
+				return nil
+			})},
+		},
+	}
+}
+
 // analyzeCodebase analyzes the current codebase state
 func (n *CodeFixerNode) analyzeCodebase(state *State) (string, error) {
-	prompt := fmt.Sprintf(`Analyze the current codebase state:
-Working Directory: %s
-Current Goal: %s
-Task History: %v
-
-Return JSON response with:
-{
-    "issues": ["issue1", "issue2"],
-    "suggestions": ["suggestion1", "suggestion2"],
-    "next_steps": ["step1", "step2"],
-    "analysis": "detailed analysis of the codebase"
-}`, state.WorkingDirectory, state.GlobalGoal, state.TaskHistory)
+	prompt, err := state.RenderPrompt(prompts.CodeFixerAnalyze, prompts.Vars{
+		"WorkingDirectory": state.GetWorkingDirectory(),
+		"GlobalGoal":       state.GetGlobalGoal(),
+		"TaskHistory":      state.GetTaskHistory(),
+	})
+	if err != nil {
+		return "", err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return "", fmt.Errorf("LLM error: %v", err)
+		return "", fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
@@ -103,8 +151,8 @@ Return JSON response with:
 		NextSteps   []string `json:"next_steps"`
 		Analysis    string   `json:"analysis"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return "", fmt.Errorf("failed to parse analysis response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return "", fmt.Errorf("failed to parse analysis response: %w", withKind(ErrParse, err))
 	}
 
 	return result.Analysis, nil
@@ -113,7 +161,7 @@ Return JSON response with:
 // checkBuildability checks if the codebase can be built
 func (n *CodeFixerNode) checkBuildability(state *State) error {
 	cmd := exec.Command("go", "build", "./...")
-	cmd.Dir = state.WorkingDirectory
+	cmd.Dir = state.GetWorkingDirectory()
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("build failed: %s", string(output))
@@ -124,7 +172,7 @@ func (n *CodeFixerNode) checkBuildability(state *State) error {
 // runTests runs the test suite
 func (n *CodeFixerNode) runTests(state *State) error {
 	cmd := exec.Command("go", "test", "./...", "-v")
-	cmd.Dir = state.WorkingDirectory
+	cmd.Dir = state.GetWorkingDirectory()
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("tests failed: %s", string(output))
@@ -134,21 +182,18 @@ func (n *CodeFixerNode) runTests(state *State) error {
 
 // fixBuildIssues attempts to fix build issues
 func (n *CodeFixerNode) fixBuildIssues(state *State, errorMsg string) error {
-	prompt := fmt.Sprintf(`Fix the following build issues:
-Error: %s
-Working Directory: %s
-Current Goal: %s
-
-Return JSON response with:
-{
-    "fixes": ["fix1", "fix2"],
-    "explanation": "explanation of the fixes",
-    "files_to_modify": ["file1", "file2"]
-}`, errorMsg, state.WorkingDirectory, state.GlobalGoal)
+	prompt, err := state.RenderPrompt(prompts.CodeFixerFixBuild, prompts.Vars{
+		"Error":            errorMsg,
+		"WorkingDirectory": state.GetWorkingDirectory(),
+		"GlobalGoal":       state.GetGlobalGoal(),
+	})
+	if err != nil {
+		return err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return fmt.Errorf("LLM error: %v", err)
+		return fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
@@ -156,14 +201,14 @@ Return JSON response with:
 		Explanation   string   `json:"explanation"`
 		FilesToModify []string `json:"files_to_modify"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return fmt.Errorf("failed to parse fix response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return fmt.Errorf("failed to parse fix response: %w", withKind(ErrParse, err))
 	}
 
 	// Apply the fixes
 	for _, file := range result.FilesToModify {
-		if err := n.applyFix(file, result.Fixes); err != nil {
-			return fmt.Errorf("failed to apply fix to %s: %v", file, err)
+		if err := n.applyFix(state, file, result.Fixes); err != nil {
+			return fmt.Errorf("failed to apply fix to %s: %w", file, err)
 		}
 	}
 
@@ -172,21 +217,18 @@ Return JSON response with:
 
 // fixTestIssues attempts to fix test issues
 func (n *CodeFixerNode) fixTestIssues(state *State, errorMsg string) error {
-	prompt := fmt.Sprintf(`Fix the following test issues:
-Error: %s
-Working Directory: %s
-Current Goal: %s
-
-Return JSON response with:
-{
-    "fixes": ["fix1", "fix2"],
-    "explanation": "explanation of the fixes",
-    "files_to_modify": ["file1", "file2"]
-}`, errorMsg, state.WorkingDirectory, state.GlobalGoal)
+	prompt, err := state.RenderPrompt(prompts.CodeFixerFixTests, prompts.Vars{
+		"Error":            errorMsg,
+		"WorkingDirectory": state.GetWorkingDirectory(),
+		"GlobalGoal":       state.GetGlobalGoal(),
+	})
+	if err != nil {
+		return err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return fmt.Errorf("LLM error: %v", err)
+		return fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
@@ -194,14 +236,14 @@ Return JSON response with:
 		Explanation   string   `json:"explanation"`
 		FilesToModify []string `json:"files_to_modify"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return fmt.Errorf("failed to parse fix response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return fmt.Errorf("failed to parse fix response: %w", withKind(ErrParse, err))
 	}
 
 	// Apply the fixes
 	for _, file := range result.FilesToModify {
-		if err := n.applyFix(file, result.Fixes); err != nil {
-			return fmt.Errorf("failed to apply fix to %s: %v", file, err)
+		if err := n.applyFix(state, file, result.Fixes); err != nil {
+			return fmt.Errorf("failed to apply fix to %s: %w", file, err)
 		}
 	}
 
@@ -209,7 +251,11 @@ Return JSON response with:
 }
 
 // applyFix applies a fix to a file
-func (n *CodeFixerNode) applyFix(file string, fixes []string) error {
+func (n *CodeFixerNode) applyFix(state *State, file string, fixes []string) error {
+	if err := n.checkWrite(state, file); err != nil {
+		return err
+	}
+
 	// Read the file
 	content, err := os.ReadFile(file)
 	if err != nil {
@@ -224,50 +270,86 @@ func (n *CodeFixerNode) applyFix(file string, fixes []string) error {
 		fmt.Printf("Applying fix to %s: %s\n", file, fix)
 	}
 
+	// Files outside of the approved scope are written to the quarantine for review
+	if n.Quarantine != nil && !n.Quarantine.InScope(file) {
+		entry, err := n.Quarantine.Add(file, content, 0644, quarantine.Entry{Source: quarantine.SourceCodeFixer, RunID: state.GetRunID()})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Quarantined the fix of %s as %s\n", file, entry.ID)
+		return nil
+	}
+
 	// Write the modified content back to the file
-	if err := os.WriteFile(file, content, 0644); err != nil {
-		return fmt.Errorf("failed to write file: %v", err)
+	write := func() error {
+		if err := os.WriteFile(file, content, 0644); err != nil {
+			return fmt.Errorf("failed to write file: %v", err)
+		}
+		return nil
+	}
+	if n.Snapshots != nil {
+		return n.Snapshots.Record(state.GetRunID(), file, content, write)
 	}
+	return write()
+}
 
+// checkWrite asks the policy engine, if any, whether file may be written
+func (n *CodeFixerNode) checkWrite(state *State, file string) error {
+	if n.Engine == nil {
+		return nil
+	}
+	ask, err := checkPolicy(state, n.Engine, policy.Input{Action: policy.ActionFileWrite, Path: file, User: n.User})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPolicyDenied, err)
+	}
+	if !ask {
+		return nil
+	}
+	if n.Asker == nil {
+		return fmt.Errorf("%w: the policy requires an approval to write %s, but nobody can be asked", ErrPolicyDenied, file)
+	}
+	approved, err := requestApproval(state, n.Asker, "write "+file, "Write "+file)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: approval failed: %v", ErrPolicyDenied, err)
+	case !approved:
+		return withKind(ErrCanceled, fmt.Errorf("writing %s was not approved", file))
+	}
 	return nil
 }
 
-// updateGoal updates the goal based on the analysis
-func (n *CodeFixerNode) updateGoal(state *State, analysis string) error {
-	prompt := fmt.Sprintf(`Based on the following analysis, determine the next goal:
-Analysis: %s
-Current Goal: %s
-Task History: %v
-
-Return JSON response with:
-{
-    "next_goal": "the next goal to achieve",
-    "explanation": "why this goal was chosen"
-}`, analysis, state.GlobalGoal, state.TaskHistory)
+// nextGoal returns the goal following from the analysis
+func (n *CodeFixerNode) nextGoal(state *State, analysis string) (string, error) {
+	prompt, err := state.RenderPrompt(prompts.CodeFixerNextGoal, prompts.Vars{
+		"Analysis":    analysis,
+		"GlobalGoal":  state.GetGlobalGoal(),
+		"TaskHistory": state.GetTaskHistory(),
+	})
+	if err != nil {
+		return "", err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return fmt.Errorf("LLM error: %v", err)
+		return "", fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
 		NextGoal    string `json:"next_goal"`
 		Explanation string `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return fmt.Errorf("failed to parse goal response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return "", fmt.Errorf("failed to parse goal response: %w", withKind(ErrParse, err))
 	}
 
-	// Update the global goal
-	state.GlobalGoal = result.NextGoal
-	return nil
+	return result.NextGoal, nil
 }
 
 // buildNewVersion builds the new version of the application
 func (n *CodeFixerNode) buildNewVersion(state *State) error {
 	// Build the application
 	cmd := exec.Command("go", "build", "-o", "aiagent_new", "cmd/aiagent/main.go")
-	cmd.Dir = state.WorkingDirectory
+	cmd.Dir = state.GetWorkingDirectory()
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("build failed: %s", string(output))
@@ -285,17 +367,17 @@ func (n *CodeFixerNode) buildNewVersion(state *State) error {
 func (n *CodeFixerNode) startNewVersion(state *State) error {
 	// Prepare command arguments
 	args := []string{}
-	if state.Verbose {
-		args = append(args, "-v")
+	if verbosity := state.GetVerbosity(); verbosity > 0 {
+		args = append(args, "-"+strings.Repeat("v", min(verbosity, 3))) // -v, -vv or -vvv
 	}
-	if state.GlobalGoal != "" {
-		args = append(args, state.GlobalGoal)
+	if state.GetGlobalGoal() != "" {
+		args = append(args, state.GetGlobalGoal())
 	}
 
 	// Create a new process group
 	cmd := exec.Command("nohup", "./aiagent_new")
 	cmd.Args = append(cmd.Args, args...)
-	cmd.Dir = state.WorkingDirectory
+	cmd.Dir = state.GetWorkingDirectory()
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 		Pgid:    0,
@@ -330,3 +412,12 @@ func (n *CodeFixerNode) startNewVersion(state *State) error {
 func (n *CodeFixerNode) Type() NodeType {
 	return NodeTypeCodeFixer
 }
+
+// Describe implements the Describer interface for CodeFixerNode
+func (n *CodeFixerNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeCodeFixer,
+		Description: "fixes the code until it builds and its tests pass",
+		Examples:    []string{"fix the failing tests"},
+	}
+}
@@ -0,0 +1,227 @@
+package nodes
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxHotspots is the number of the most complex functions shown by default
+	maxHotspots = 10
+
+	// complexityThreshold is the cyclomatic complexity above which a function is counted as
+	// hard to maintain
+	complexityThreshold = 10
+
+	// maxComplexityFileSize skips larger files, which are generated or data more often than not
+	maxComplexityFileSize = 1 << 20
+)
+
+// maintainabilityPattern matches goals asking which code is hard to maintain, which are
+// answered with the complexity of the functions
+var maintainabilityPattern = regexp.MustCompile(`(?i)\b(maintain\w*|complex\w*|hotspots?|refactor\w*|tech(nical)? debt|hard(est)? to (read|understand|change|test))\b`)
+
+// decisionPatterns match the branches of a function in the languages without a parser by
+// extension; each match adds one to the cyclomatic complexity
+var decisionPatterns = map[string]*regexp.Regexp{
+	".py": regexp.MustCompile(`\b(if|elif|for|while|except|and|or)\b`),
+	".js": jsDecisionPattern,
+	".ts": jsDecisionPattern,
+}
+
+var jsDecisionPattern = regexp.MustCompile(`\b(if|for|while|case|catch)\b|&&|\|\||\?\?`)
+
+// FunctionComplexity is the size and the cyclomatic complexity of a function
+type FunctionComplexity struct {
+	File string
+	Name string
+	Line int
+
+	// Lines is the number of lines of the function, from its declaration to its end
+	Lines int
+
+	// Complexity is the number of independent paths through the function: one plus the
+	// number of its branches and boolean operators
+	Complexity int
+}
+
+func (f FunctionComplexity) String() string {
+	return fmt.Sprintf("%s:%d %s: complexity %d, %d lines", f.File, f.Line, f.Name, f.Complexity, f.Lines)
+}
+
+// ComplexityReport is the complexity of the functions of a directory
+type ComplexityReport struct {
+	Functions []FunctionComplexity
+}
+
+// Hotspots returns at most limit functions, the most complex first and, at the same
+// complexity, the longest
+func (r *ComplexityReport) Hotspots(limit int) []FunctionComplexity {
+	hotspots := append([]FunctionComplexity(nil), r.Functions...)
+	sort.SliceStable(hotspots, func(i, j int) bool {
+		if hotspots[i].Complexity != hotspots[j].Complexity {
+			return hotspots[i].Complexity > hotspots[j].Complexity
+		}
+		return hotspots[i].Lines > hotspots[j].Lines
+	})
+	return hotspots[:min(len(hotspots), limit)]
+}
+
+// String summarizes the report with its limit most complex functions
+func (r *ComplexityReport) String(limit int) string {
+	if len(r.Functions) == 0 {
+		return ""
+	}
+	total, above := 0, 0
+	for _, f := range r.Functions {
+		total += f.Complexity
+		if f.Complexity > complexityThreshold {
+			above++
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d functions, average complexity %.1f, %d above %d\n", len(r.Functions),
+		float64(total)/float64(len(r.Functions)), above, complexityThreshold)
+	for _, f := range r.Hotspots(limit) {
+		fmt.Fprintf(&sb, "- %s\n", f)
+	}
+	return sb.String()
+}
+
+// MeasureComplexity measures the functions of the source files below dir, skipping hidden
+// directories, dependencies, tests and generated Go files; the file paths are relative to dir
+// Go files are parsed; in the other languages symbols are found for, a function ends where
+// the next declaration starts and its branches are counted by keyword
+func MeasureComplexity(dir string) (*ComplexityReport, error) {
+	report := &ComplexityReport{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip what cannot be read
+		}
+		name := d.Name()
+		if path != dir && (strings.HasPrefix(name, ".") || d.IsDir() && (todoSkippedDirs[name] || name == "testdata")) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(name)
+		if !d.Type().IsRegular() || ext != ".go" && decisionPatterns[ext] == nil || isTestFile(name) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxComplexityFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		report.Functions = append(report.Functions, measureFile(filepath.ToSlash(rel), data)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure the complexity: %v", err)
+	}
+	return report, nil
+}
+
+// isTestFile reports whether a file holds tests by the conventions of its language
+func isTestFile(name string) bool {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.HasSuffix(base, "_test") || strings.HasPrefix(base, "test_") ||
+		strings.HasSuffix(base, ".test") || strings.HasSuffix(base, ".spec")
+}
+
+// measureFile returns the complexity of the functions of a file in the order they appear
+func measureFile(file string, data []byte) []FunctionComplexity {
+	if filepath.Ext(file) == ".go" {
+		return measureGoFile(file, data)
+	}
+	pattern := decisionPatterns[filepath.Ext(file)]
+	lines := strings.Split(string(data), "\n")
+	symbols := extractSymbols(file, string(data))
+	var functions []FunctionComplexity
+	for i, symbol := range symbols {
+		if symbol.Kind != "func" {
+			continue
+		}
+		end := len(lines)
+		if i+1 < len(symbols) {
+			end = symbols[i+1].Line - 1
+		}
+		// Blank lines before the next declaration are not part of the function
+		for end > symbol.Line && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		complexity := 1
+		for _, line := range lines[symbol.Line-1 : end] {
+			if code := strings.TrimSpace(line); !strings.HasPrefix(code, "#") && !strings.HasPrefix(code, "//") {
+				complexity += len(pattern.FindAllString(code, -1))
+			}
+		}
+		functions = append(functions, FunctionComplexity{
+			File: file, Name: symbol.Name, Line: symbol.Line, Lines: end - symbol.Line + 1, Complexity: complexity,
+		})
+	}
+	return functions
+}
+
+// measureGoFile returns the complexity of the functions and methods of a Go file; the
+// branches of function literals count for the function they are in
+func measureGoFile(file string, data []byte) []FunctionComplexity {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, data, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil || ast.IsGenerated(f) {
+		return nil
+	}
+	var functions []FunctionComplexity
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		start, end := fset.Position(fn.Pos()).Line, fset.Position(fn.End()).Line
+		functions = append(functions, FunctionComplexity{
+			File: file, Name: functionName(fn), Line: start, Lines: end - start + 1, Complexity: cyclomaticComplexity(fn.Body),
+		})
+	}
+	return functions
+}
+
+// cyclomaticComplexity returns one plus the number of conditions, loops, cases other than
+// the default and && or || operators of a function body
+func cyclomaticComplexity(body *ast.BlockStmt) int {
+	complexity := 1
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if node.List != nil {
+				complexity++
+			}
+		case *ast.CommClause:
+			if node.Comm != nil {
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if node.Op == token.LAND || node.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+	return complexity
+}
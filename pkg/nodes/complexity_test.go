@@ -0,0 +1,92 @@
+package nodes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const complexGo = `package shop
+
+func Price(items []int, member bool) (total int) {
+	for _, item := range items {
+		if item > 100 && member {
+			total += item * 9 / 10
+		} else {
+			total += item
+		}
+	}
+	return total
+}
+
+type Cart struct{}
+
+func (c *Cart) Checkout(ch chan int) {
+	select {
+	case <-ch:
+	default:
+	}
+	switch {
+	case c == nil:
+	case true || false:
+	}
+	go func() {
+		if c != nil {
+		}
+	}()
+}
+`
+
+func TestMeasureComplexity(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{
+		"shop.go":                   complexGo,
+		"shop_test.go":              "package shop\n\nfunc TestPrice(t *testing.T) { if true {} }\n",
+		"gen.go":                    "// Code generated by stringer. DO NOT EDIT.\n\npackage shop\n\nfunc generated() { if true {} }\n",
+		"app.py":                    "import os\n\ndef load(path):\n    if not path or path == '-':\n        return None\n    for line in open(path):\n        pass\n\n\nclass Store:\n    def get(self, key):\n        # if this is cached\n        return self.data[key]\n",
+		"web/app.js":                "function render(a) {\n  if (a?.b ?? a.c) {\n    return a && a.d\n  }\n}\n",
+		"node_modules/lib/index.js": "function vendored() { if (a) {} }\n",
+		"README.md":                 "if and or",
+	})
+
+	report, err := MeasureComplexity(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []FunctionComplexity{
+		{File: "app.py", Name: "load", Line: 3, Lines: 5, Complexity: 4},
+		{File: "app.py", Name: "get", Line: 11, Lines: 3, Complexity: 1},
+		{File: "shop.go", Name: "Price", Line: 3, Lines: 10, Complexity: 4},
+		{File: "shop.go", Name: "(*Cart).Checkout", Line: 16, Lines: 14, Complexity: 6},
+		{File: "web/app.js", Name: "render", Line: 1, Lines: 5, Complexity: 4},
+	}, report.Functions)
+
+	assert.Equal(t, []string{"(*Cart).Checkout", "Price", "load"}, []string{
+		report.Hotspots(3)[0].Name, report.Hotspots(3)[1].Name, report.Hotspots(3)[2].Name,
+	}, "the most complex first, then the longest")
+	assert.Equal(t, "5 functions, average complexity 3.8, 0 above 10\n"+
+		"- shop.go:16 (*Cart).Checkout: complexity 6, 14 lines\n", report.String(1))
+	assert.Empty(t, (&ComplexityReport{}).String(10))
+}
+
+func TestAnalyticsNode_ComplexityHotspots(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{"shop.go": complexGo})
+
+	llm := NewScriptedLLM()
+	llm.OnContains("shop.go:16 (*Cart).Checkout: complexity 6, 14 lines").
+		Respond(`{"insights": ["Checkout branches the most"], "recommendations": ["split Checkout"], "explanation": "Checkout is the hotspot."}`)
+	state := &State{WorkingDirectory: dir, GlobalGoal: "which parts of this codebase are hardest to maintain?"}
+
+	require.NoError(t, NewAnalyticsNode(llm).Process(state))
+	assert.True(t, llm.AssertExpectations(t))
+	assert.Equal(t, "Insights:\n- Checkout branches the most\n\nRecommendations:\n- split Checkout\n\nCheckout is the hotspot.\n\n"+
+		"Complexity hotspots:\n2 functions, average complexity 5.0, 0 above 10\n"+
+		"- shop.go:16 (*Cart).Checkout: complexity 6, 14 lines\n- shop.go:3 Price: complexity 4, 10 lines\n", state.GetFinalResult())
+
+	llm = NewScriptedLLM()
+	llm.OnContains("Analyze the task history").Respond(`{"insights": [], "recommendations": [], "explanation": "ok"}`)
+	state = &State{WorkingDirectory: dir, GlobalGoal: "why is the build slow?"}
+	require.NoError(t, NewAnalyticsNode(llm).Process(state))
+	assert.NotContains(t, llm.Calls()[0], "complexity")
+	assert.NotContains(t, state.GetFinalResult(), "Complexity hotspots")
+}
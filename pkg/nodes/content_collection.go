@@ -1,13 +1,22 @@
 package nodes
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
-	"os"
+	"log/slog"
 	"path/filepath"
 	"strings"
+
+	"aiagent/pkg/logging"
 )
 
+// maxCollectedFileSize is the size of the largest file whose content is collected
+const maxCollectedFileSize = 100 * 1024
+
+// maxCollectedEntries is the maximum number of files and directories collected
+const maxCollectedEntries = 500
+
 // ContentCollectionNodeInterface defines the operations for a content collection node
 type ContentCollectionNodeInterface interface {
 	// Process collects directory content and optionally reads file contents
@@ -22,73 +31,82 @@ type ContentCollectionNodeInterface interface {
 
 // ContentCollectionNode implements content collection logic
 type ContentCollectionNode struct {
-	LLM     LLM
-	Verbose bool
+	LLM LLM
 }
 
 // NewContentCollectionNode creates a new content collection node
-func NewContentCollectionNode(llm LLM, verbose bool) *ContentCollectionNode {
+func NewContentCollectionNode(llm LLM) *ContentCollectionNode {
 	return &ContentCollectionNode{
-		LLM:     llm,
-		Verbose: verbose,
+		LLM: llm,
 	}
 }
 
 // Process implements the Node interface for ContentCollectionNode
 func (n *ContentCollectionNode) Process(state *State) error {
-	if n.Verbose {
-		fmt.Println("Content collection node gathering information...")
-		fmt.Printf("Working directory: %s\n", state.WorkingDirectory)
-		if state.NeedsFileContent {
-			fmt.Println("File content collection required")
-			if len(state.FilePatterns) > 0 {
-				fmt.Printf("File patterns: %v\n", state.FilePatterns)
-			}
-		} else {
-			fmt.Println("Only collecting directory structure (no file contents)")
-		}
-	}
+	logger := state.NodeLogger(NodeTypeContentCollection)
+	logger.Debug("gathering information",
+		"dir", state.GetWorkingDirectory(),
+		"read_contents", state.GetNeedsFileContent(),
+		"patterns", state.GetFilePatterns())
 
 	// Set default limits if not provided
-	if state.FileCountLimit <= 0 {
-		state.FileCountLimit = 50 // Maximum number of files to read
+	fileCountLimit, fileSizeLimit := state.GetFileLimits()
+	if fileCountLimit <= 0 {
+		fileCountLimit = 50 // Maximum number of files to read
 	}
-	if state.FileSizeLimit <= 0 {
-		state.FileSizeLimit = 100 * 1024 // 100 KB maximum file size
+	if fileSizeLimit <= 0 {
+		fileSizeLimit = 100 * 1024 // 100 KB maximum file size
 	}
+	state.SetFileLimits(fileCountLimit, fileSizeLimit)
 
-	// First, collect the directory structure
-	dirContents, err := n.collectDirectoryContents(state.WorkingDirectory, state.FilePatterns, state.NeedsFileContent)
+	// First, collect the directory structure; the walk stops at the entries the state keeps
+	maxCount := maxCollectedEntries
+	if max := state.GetLimits().MaxDirectoryEntries; max > 0 && max < maxCount {
+		maxCount = max
+	}
+	var dirContents []FileContent
+	err := n.walkDirectory(logger, state.GetWorkingDirectory(), state.GetFilePatterns(), state.GetNeedsFileContent(), maxCount, func(file FileContent) error {
+		dirContents = append(dirContents, file)
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to collect directory contents: %v", err)
 	}
 
-	state.DirectoryContents = dirContents
+	state.SetDirectoryContents(dirContents)
 
-	if n.Verbose {
-		fmt.Printf("Collected %d files/directories\n", len(state.DirectoryContents))
-	}
+	logger.Debug("collected directory contents", "entries", len(dirContents))
 
 	// Move to the analytics node next
-	state.NextNode = NodeTypeAnalytics
+	state.SetNextNode(NodeTypeAnalytics)
 	return nil
 }
 
 // collectDirectoryContents walks the directory tree and collects file information
-func (n *ContentCollectionNode) collectDirectoryContents(rootDir string, patterns []string, readContents bool) ([]FileContent, error) {
+func (n *ContentCollectionNode) collectDirectoryContents(logger *slog.Logger, rootDir string, patterns []string, readContents bool) ([]FileContent, error) {
 	var contents []FileContent
+	err := n.walkDirectory(logger, rootDir, patterns, readContents, maxCollectedEntries, func(file FileContent) error {
+		contents = append(contents, file)
+		return nil
+	})
+	return contents, err
+}
+
+// walkDirectory streams the files and directories of the tree to visit as they are found, up
+// to maxCount entries; file contents are never read, so memory does not grow with the tree
+func (n *ContentCollectionNode) walkDirectory(logger *slog.Logger, rootDir string, patterns []string, readContents bool, maxCount int, visit func(FileContent) error) error {
 	count := 0
-	maxCount := 500 // Maximum number of files to track
 
 	// Create a filepath.WalkDir function to collect directory contents
-	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
+	return filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
+			logger.Log(context.Background(), logging.LevelTrace, "skipping inaccessible path", "path", path, "error", err)
 			return nil // Skip directories we can't access
 		}
 
-		// Early return if we've collected enough files
+		// Stop the walk once we've collected enough files
 		if count >= maxCount {
-			return filepath.SkipDir
+			return filepath.SkipAll
 		}
 
 		// Skip hidden files and directories (starting with .)
@@ -101,7 +119,7 @@ func (n *ContentCollectionNode) collectDirectoryContents(rootDir string, pattern
 		}
 
 		isDir := d.IsDir()
-		
+
 		// Include all directories but only matching files if patterns are provided
 		if !isDir && len(patterns) > 0 {
 			matched := false
@@ -116,6 +134,7 @@ func (n *ContentCollectionNode) collectDirectoryContents(rootDir string, pattern
 				}
 			}
 			if !matched {
+				logger.Log(context.Background(), logging.LevelTrace, "skipping file not matching patterns", "path", path)
 				return nil // Skip non-matching files
 			}
 		}
@@ -133,28 +152,22 @@ func (n *ContentCollectionNode) collectDirectoryContents(rootDir string, pattern
 			IsDir: isDir,
 		}
 
-		// Read file content if necessary and file is not too large
-		if readContents && !isDir && info.Size() <= int64(100*1024) { // 100KB limit
+		// Mark the file content as readable if necessary and file is not too large; it is only
+		// read when a node includes it in a prompt
+		if readContents && !isDir && info.Size() <= maxCollectedFileSize {
 			// Skip binary files and only read text files
 			// This is a simple heuristic and might need improvement
 			if !isTextFile(d.Name()) {
 				fileContent.Content = "[binary file]"
 			} else {
-				content, err := os.ReadFile(path)
-				if err != nil {
-					fileContent.Content = fmt.Sprintf("[error reading file: %v]", err)
-				} else {
-					fileContent.Content = string(content)
-				}
+				fileContent.Readable = true
 			}
 		}
 
-		contents = append(contents, fileContent)
+		logger.Log(context.Background(), logging.LevelTrace, "collected path", "path", path, "dir", isDir, "size", info.Size(), "readable", fileContent.Readable)
 		count++
-		return nil
+		return visit(fileContent)
 	})
-
-	return contents, err
 }
 
 // isTextFile tries to determine if a file is a text file based on extension
@@ -173,4 +186,13 @@ func isTextFile(filename string) bool {
 	}
 
 	return false
-}
\ No newline at end of file
+}
+
+// Describe implements the Describer interface for ContentCollectionNode
+func (n *ContentCollectionNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeContentCollection,
+		Description: "reads the files of the working directory to summarize or compare them",
+		Examples:    []string{"summarize the docs"},
+	}
+}
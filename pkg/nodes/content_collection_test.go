@@ -0,0 +1,91 @@
+package nodes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/logging"
+)
+
+func TestContentCollectionNode_LazyContents(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "logo.png"), []byte{0x89, 'P', 'N', 'G'}, 0644))
+
+	contents, err := NewContentCollectionNode(nil).collectDirectoryContents(logging.Discard(), dir, nil, true)
+	assert.NoError(t, err)
+	files := make(map[string]FileContent)
+	for _, file := range contents {
+		files[filepath.Base(file.Path)] = file
+	}
+	assert.Equal(t, FileContent{Path: filepath.Join(dir, "main.go"), Size: 12, Readable: true}, files["main.go"], "the content is not read yet")
+	assert.Equal(t, "[binary file]", files["logo.png"].Content)
+	assert.False(t, files["logo.png"].Readable)
+
+	state := &State{}
+	assert.Equal(t, "package main", state.LoadFileContent(files["main.go"]))
+
+	// The content is read once per run
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package changed"), 0644))
+	assert.Equal(t, "package main", state.LoadFileContent(files["main.go"]))
+	assert.Equal(t, "package changed", (&State{}).LoadFileContent(files["main.go"]))
+
+	assert.Equal(t, "[binary file]", state.LoadFileContent(files["logo.png"]))
+	assert.Contains(t, state.LoadFileContent(FileContent{Path: filepath.Join(dir, "missing.go"), Readable: true}), "[error reading file: ")
+}
+
+func TestAnalyticsNode_PrepareDirectoryInfo(t *testing.T) {
+	dir := t.TempDir()
+	readme := filepath.Join(dir, "README.md")
+	assert.NoError(t, os.WriteFile(readme, []byte("# Project"), 0644))
+
+	state := &State{}
+	structure, contents := NewAnalyticsNode(nil).prepareDirectoryInfo(state, []FileContent{
+		{Path: dir, IsDir: true},
+		{Path: readme, Size: 9, Readable: true},
+		{Path: filepath.Join(dir, "empty.txt")},
+	})
+	assert.Equal(t, "```\n"+dir+"/ (0 bytes)\n"+readme+" (9 bytes)\n"+filepath.Join(dir, "empty.txt")+" (0 bytes)\n```\n", structure)
+	assert.Equal(t, "--- "+readme+" ---\n# Project\n\n", contents)
+}
+
+func TestContentCollectionNode_WalkStopsAtLimit(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.go", "d.go"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("package main"), 0644))
+	}
+
+	var visited []FileContent
+	err := NewContentCollectionNode(nil).walkDirectory(logging.Discard(), dir, nil, true, 3, func(file FileContent) error {
+		visited = append(visited, file)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, visited, 3)
+}
+
+func TestState_LoadFileContent_Spills(t *testing.T) {
+	dir := t.TempDir()
+	small := FileContent{Path: filepath.Join(dir, "small.go"), Readable: true}
+	large := FileContent{Path: filepath.Join(dir, "large.go"), Readable: true}
+	assert.NoError(t, os.WriteFile(small.Path, []byte("package small"), 0644))
+	assert.NoError(t, os.WriteFile(large.Path, []byte("package large"), 0644))
+
+	state := &State{Limits: StateLimits{MaxFileCacheBytes: 20}}
+	assert.Equal(t, "package small", state.LoadFileContent(small))
+	assert.Equal(t, "package large", state.LoadFileContent(large))
+	assert.NotContains(t, state.fileContents, large.Path, "the content beyond the limit is not kept in memory")
+	spillDir := state.spillDir
+	assert.DirExists(t, spillDir)
+
+	// The spilled content is read from the temporary file, not from the changed original
+	assert.NoError(t, os.WriteFile(large.Path, []byte("package changed"), 0644))
+	assert.Equal(t, "package large", state.LoadFileContent(large))
+
+	assert.NoError(t, state.ReleaseFiles())
+	assert.NoDirExists(t, spillDir)
+	assert.Equal(t, "package changed", state.LoadFileContent(large))
+}
@@ -0,0 +1,382 @@
+package nodes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"aiagent/pkg/prompts"
+)
+
+const (
+	// DefaultMaxGaps is the number of least covered packages and functions reported
+	DefaultMaxGaps = 10
+
+	// coverageTimeout limits the test run measuring the coverage
+	coverageTimeout = 10 * time.Minute
+
+	// maxTestOutput limits the output of failing tests shown to the LLM
+	maxTestOutput = 4000
+)
+
+// proposeTestsPattern matches goals asking for tests to be written for the gaps
+var proposeTestsPattern = regexp.MustCompile(`(?i)\b(propose|suggest|write|generate|add|create)\b.*\btests?\b`)
+
+// Coverage is the statement coverage of a package or a function
+type Coverage struct {
+	// Name is the import path of a package, or the file and name of a function, e.g.
+	// pkg/nodes/coverage.go:(*CoverageNode).Process
+	Name       string
+	Statements int
+	Covered    int
+}
+
+// Percent returns the share of the statements that were run, in percent
+func (c Coverage) Percent() float64 {
+	if c.Statements == 0 {
+		return 100
+	}
+	return float64(c.Covered) * 100 / float64(c.Statements)
+}
+
+func (c Coverage) String() string {
+	return fmt.Sprintf("%s: %.1f%% (%d of %d statements)", c.Name, c.Percent(), c.Covered, c.Statements)
+}
+
+// CoverageReport is the coverage of a Go module measured by its tests
+type CoverageReport struct {
+	Total     Coverage
+	Packages  []Coverage
+	Functions []Coverage
+}
+
+// CoverageNode measures the test coverage of the Go module in the working directory,
+// points out the least covered packages and functions, and asks the LLM which gaps matter
+// When the goal asks for tests, a task proposing tests for the gaps is handed off to the
+// Handoff node
+type CoverageNode struct {
+	llm LLM
+
+	// RunTests runs the tests of the module in dir writing the coverage profile to profile;
+	// nil runs go test -coverprofile. The profile is used even if some tests fail
+	RunTests func(dir, profile string) ([]byte, error)
+
+	// MaxGaps is the number of least covered packages and functions reported
+	MaxGaps int
+
+	// Handoff is the node proposing tests for the gaps; empty does not hand off
+	Handoff NodeType
+}
+
+// NewCoverageNode creates a new coverage node
+func NewCoverageNode(llm LLM) *CoverageNode {
+	return &CoverageNode{
+		llm:     llm,
+		MaxGaps: DefaultMaxGaps,
+	}
+}
+
+// Process implements the Node interface for CoverageNode
+func (n *CoverageNode) Process(state *State) error {
+	dir := state.GetWorkingDirectory()
+	module, err := modulePath(dir)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "aiagent-coverage-")
+	if err != nil {
+		return fmt.Errorf("failed to create the coverage profile: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	profile := filepath.Join(tmp, "coverage.out")
+
+	run := n.RunTests
+	if run == nil {
+		run = func(dir, profile string) ([]byte, error) { return goTestCover(state.GetContext(), dir, profile) }
+	}
+	output, testErr := run(dir, profile)
+	data, err := os.ReadFile(profile)
+	if err != nil {
+		if testErr != nil {
+			return fmt.Errorf("go test failed: %v: %s", testErr, tail(string(output), maxTestOutput))
+		}
+		return fmt.Errorf("go test wrote no coverage profile: %v", err)
+	}
+	report, err := ParseCoverProfile(data, dir, module)
+	if err != nil {
+		return err
+	}
+
+	maxGaps := n.MaxGaps
+	if maxGaps <= 0 {
+		maxGaps = DefaultMaxGaps
+	}
+	packages := leastCovered(report.Packages, maxGaps)
+	functions := leastCovered(report.Functions, maxGaps)
+	var failures string
+	if testErr != nil {
+		failures = tail(string(output), maxTestOutput)
+	}
+
+	goal := state.GetCurrentTask().Goal
+	prompt, err := state.RenderPrompt(prompts.CoverageAnalyze, prompts.Vars{
+		"Goal":      goal,
+		"Total":     report.Total,
+		"Packages":  packages,
+		"Functions": functions,
+		"Failures":  failures,
+	})
+	if err != nil {
+		return err
+	}
+	analysis, err := completeResult(state, n.llm, prompt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+	state.SetRawOutput(analysis)
+	state.SetFinalResult(analysis)
+
+	if n.Handoff != "" && len(functions) > 0 && proposeTestsPattern.MatchString(goal) {
+		n.handOff(state, functions)
+	}
+	return nil
+}
+
+// handOff plans a task proposing tests for the least covered functions right after the
+// running task, so the classifier runs it next
+func (n *CoverageNode) handOff(state *State, functions []Coverage) {
+	var sb strings.Builder
+	sb.WriteString("Propose tests for the least covered functions:")
+	for _, f := range functions {
+		fmt.Fprintf(&sb, "\n- %s", f)
+	}
+	next := TaskStatus{NodeType: n.Handoff, Goal: sb.String()}
+
+	plan := state.GetPlan()
+	if len(plan) == 0 {
+		plan = []TaskStatus{state.GetCurrentTask()}
+	}
+	for i, task := range plan {
+		if !task.IsCompleted {
+			plan = append(plan[:i+1], append([]TaskStatus{next}, plan[i+1:]...)...)
+			break
+		}
+	}
+	state.SetPlan(plan)
+	state.NodeLogger(NodeTypeCoverage).Debug("handing off", "next_node", string(n.Handoff), "functions", len(functions))
+}
+
+// goTestCover runs the tests of the module in dir with coverage
+func goTestCover(ctx context.Context, dir, profile string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, coverageTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "test", "-coverprofile="+profile, "./...")
+	cmd.Dir = dir
+	return cmd.CombinedOutput()
+}
+
+// modulePath returns the module path of the go.mod in dir
+func modulePath(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("the coverage is measured for Go modules, and there is no go.mod in %s", dir)
+	} else if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`), nil
+		}
+	}
+	return "", fmt.Errorf("%w: no module directive in go.mod", ErrParse)
+}
+
+// profileBlock is a block of statements of a coverage profile
+type profileBlock struct {
+	startLine, endLine int
+	statements, count  int
+}
+
+// ParseCoverProfile reads a coverage profile written by go test -coverprofile and sums the
+// statements by package and by function; the functions are found in the source files of
+// the module in dir, whose module path is module
+func ParseCoverProfile(data []byte, dir, module string) (*CoverageReport, error) {
+	// The same block is listed once for every test binary covering it
+	blocks := make(map[string]map[string]profileBlock)
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// e.g. example/pkg/file.go:12.34,15.2 3 1
+		colon := strings.LastIndex(line, ":")
+		fields := strings.Fields(line[colon+1:])
+		if colon < 0 || len(fields) != 3 {
+			return nil, fmt.Errorf("%w: invalid coverage profile line %q", ErrParse, line)
+		}
+		file := line[:colon]
+		start, end, _ := strings.Cut(fields[0], ",")
+		startLine, err1 := strconv.Atoi(strings.Split(start, ".")[0])
+		endLine, err2 := strconv.Atoi(strings.Split(end, ".")[0])
+		statements, err3 := strconv.Atoi(fields[1])
+		count, err4 := strconv.Atoi(fields[2])
+		if err := errors.Join(err1, err2, err3, err4); err != nil {
+			return nil, fmt.Errorf("%w: invalid coverage profile line %q", ErrParse, line)
+		}
+		if blocks[file] == nil {
+			blocks[file] = make(map[string]profileBlock)
+			files = append(files, file)
+		}
+		b := blocks[file][fields[0]]
+		blocks[file][fields[0]] = profileBlock{startLine: startLine, endLine: endLine, statements: statements, count: max(b.count, count)}
+	}
+	sort.Strings(files)
+
+	report := &CoverageReport{Total: Coverage{Name: "total"}}
+	byPackage := make(map[string]*Coverage)
+	var packages []string
+	for _, file := range files {
+		pkg := path.Dir(file)
+		c := byPackage[pkg]
+		if c == nil {
+			c = &Coverage{Name: pkg}
+			byPackage[pkg] = c
+			packages = append(packages, pkg)
+		}
+		for _, b := range blocks[file] {
+			c.Statements += b.statements
+			report.Total.Statements += b.statements
+			if b.count > 0 {
+				c.Covered += b.statements
+				report.Total.Covered += b.statements
+			}
+		}
+
+		rel, ok := strings.CutPrefix(file, module+"/")
+		if !ok {
+			continue // Not a file of the module
+		}
+		functions, err := functionCoverage(filepath.Join(dir, filepath.FromSlash(rel)), rel, blocks[file])
+		if err != nil {
+			return nil, err
+		}
+		report.Functions = append(report.Functions, functions...)
+	}
+	for _, pkg := range packages {
+		report.Packages = append(report.Packages, *byPackage[pkg])
+	}
+	return report, nil
+}
+
+// functionCoverage sums the statements of the blocks of a source file by function
+func functionCoverage(filename, rel string, blocks map[string]profileBlock) ([]Coverage, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", rel, err)
+	}
+	var functions []Coverage
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		start, end := fset.Position(fn.Pos()).Line, fset.Position(fn.End()).Line
+		c := Coverage{Name: rel + ":" + functionName(fn)}
+		for _, b := range blocks {
+			if b.startLine >= start && b.endLine <= end {
+				c.Statements += b.statements
+				if b.count > 0 {
+					c.Covered += b.statements
+				}
+			}
+		}
+		functions = append(functions, c)
+	}
+	return functions, nil
+}
+
+// functionName returns the name of a function as go tool cover shows it, with the receiver
+// of a method, e.g. (*CoverageNode).Process
+func functionName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	recv := fn.Recv.List[0].Type
+	if index, ok := recv.(*ast.IndexExpr); ok {
+		recv = index.X
+	}
+	if index, ok := recv.(*ast.IndexListExpr); ok {
+		recv = index.X
+	}
+	switch t := recv.(type) {
+	case *ast.StarExpr:
+		name := t.X
+		if index, ok := name.(*ast.IndexExpr); ok {
+			name = index.X
+		}
+		if ident, ok := name.(*ast.Ident); ok {
+			return "(*" + ident.Name + ")." + fn.Name.Name
+		}
+	case *ast.Ident:
+		return t.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// leastCovered returns at most limit of the incompletely covered items, least covered first
+// and, at the same coverage, those with the most statements
+func leastCovered(items []Coverage, limit int) []Coverage {
+	var gaps []Coverage
+	for _, c := range items {
+		if c.Covered < c.Statements {
+			gaps = append(gaps, c)
+		}
+	}
+	sort.SliceStable(gaps, func(i, j int) bool {
+		if gaps[i].Percent() != gaps[j].Percent() {
+			return gaps[i].Percent() < gaps[j].Percent()
+		}
+		return gaps[i].Statements > gaps[j].Statements
+	})
+	return gaps[:min(len(gaps), limit)]
+}
+
+// tail returns the last limit bytes of s
+func tail(s string, limit int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= limit {
+		return s
+	}
+	return "..." + s[len(s)-limit:]
+}
+
+func (n *CoverageNode) Type() NodeType {
+	return NodeTypeCoverage
+}
+
+// Describe implements the Describer interface for CoverageNode
+func (n *CoverageNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeCoverage,
+		Description: "measures the test coverage of the Go module with go test -coverprofile and points out the least covered packages and functions; when asked, tests for the gaps are proposed next",
+		Examples:    []string{"which code is not covered by tests?", "find the coverage gaps and propose tests for them"},
+	}
+}
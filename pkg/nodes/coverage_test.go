@@ -0,0 +1,127 @@
+package nodes
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const coverageSource = `package calc
+
+type Stack[T any] struct{ items []T }
+
+func (s *Stack[T]) Push(v T) {
+	s.items = append(s.items, v)
+}
+
+func Div(a, b int) (int, error) {
+	if b == 0 {
+		return 0, errDivByZero
+	}
+	return a / b, nil
+}
+
+func Unused() int {
+	x := 1
+	return x
+}
+`
+
+// coverageProfile covers Push and the happy path of Div; the blocks of calc.go are listed
+// twice, as by two test binaries, with only one of them covering Push
+const coverageProfile = `mode: set
+example.com/calc/calc.go:5.30,7.2 1 0
+example.com/calc/calc.go:5.30,7.2 1 1
+example.com/calc/calc.go:9.33,10.12 1 1
+example.com/calc/calc.go:10.12,12.3 1 0
+example.com/calc/calc.go:13.2,13.18 1 1
+example.com/calc/calc.go:16.18,19.2 2 0
+example.com/calc/util/util.go:3.20,5.2 2 1
+`
+
+func coverageModule(t *testing.T) string {
+	dir := t.TempDir()
+	writeTodoFile(t, filepath.Join(dir, "go.mod"), "module example.com/calc\n\ngo 1.24\n")
+	writeTodoFile(t, filepath.Join(dir, "calc.go"), coverageSource)
+	writeTodoFile(t, filepath.Join(dir, "util", "util.go"), "package util\n\nfunc Twice() int {\n\tx := 2\n\treturn x\n}\n")
+	return dir
+}
+
+func TestParseCoverProfile(t *testing.T) {
+	dir := coverageModule(t)
+	report, err := ParseCoverProfile([]byte(coverageProfile), dir, "example.com/calc")
+	require.NoError(t, err)
+	assert.Equal(t, Coverage{Name: "total", Statements: 8, Covered: 5}, report.Total)
+	assert.Equal(t, []Coverage{
+		{Name: "example.com/calc", Statements: 6, Covered: 3},
+		{Name: "example.com/calc/util", Statements: 2, Covered: 2},
+	}, report.Packages)
+	assert.Equal(t, []Coverage{
+		{Name: "calc.go:(*Stack).Push", Statements: 1, Covered: 1},
+		{Name: "calc.go:Div", Statements: 3, Covered: 2},
+		{Name: "calc.go:Unused", Statements: 2, Covered: 0},
+		{Name: "util/util.go:Twice", Statements: 2, Covered: 2},
+	}, report.Functions)
+
+	assert.Equal(t, []Coverage{{Name: "calc.go:Unused", Statements: 2}, {Name: "calc.go:Div", Statements: 3, Covered: 2}}, leastCovered(report.Functions, 5))
+	assert.Equal(t, "calc.go:Div: 66.7% (2 of 3 statements)", report.Functions[1].String())
+
+	_, err = ParseCoverProfile([]byte("mode: set\nexample.com/calc/calc.go:5.30,7.2 1\n"), dir, "example.com/calc")
+	assert.ErrorIs(t, err, ErrParse)
+}
+
+func TestCoverageNode(t *testing.T) {
+	dir := coverageModule(t)
+	runTests := func(dir, profile string) ([]byte, error) {
+		return []byte("--- FAIL: TestDiv\nFAIL\texample.com/calc"), errors.Join(errors.New("exit status 1"), os.WriteFile(profile, []byte(coverageProfile), 0644))
+	}
+
+	llm := NewScriptedLLM()
+	llm.OnContains("Analyze the test coverage").Respond("Unused is never run and TestDiv fails.")
+	node := NewCoverageNode(llm)
+	node.RunTests = runTests
+	node.Handoff = NodeTypeCodeAnalyzer
+	state := &State{WorkingDirectory: dir, CurrentTask: TaskStatus{NodeType: NodeTypeCoverage, Goal: "which code is not covered by tests?"}}
+
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, "Unused is never run and TestDiv fails.", state.GetFinalResult())
+	prompt := llm.Calls()[0]
+	assert.Contains(t, prompt, "Statement coverage of the module: total: 62.5% (5 of 8 statements)")
+	assert.Contains(t, prompt, "Some tests failed, so the coverage is lower than it should be:\n--- FAIL: TestDiv")
+	assert.Contains(t, prompt, "Least covered packages:\n- example.com/calc: 50.0% (3 of 6 statements)\n\n")
+	assert.Contains(t, prompt, "Least covered functions:\n- calc.go:Unused: 0.0% (0 of 2 statements)\n- calc.go:Div: 66.7% (2 of 3 statements)\n")
+	assert.Empty(t, state.GetPlan(), "tests were not asked for")
+
+	// Asked for tests, the gaps are handed off right after the running task of the plan
+	planned := TaskStatus{NodeType: NodeTypeDirectResponse, Goal: "summarize"}
+	task := TaskStatus{NodeType: NodeTypeCoverage, Goal: "find the coverage gaps and propose tests for them"}
+	state = &State{WorkingDirectory: dir, CurrentTask: task, Plan: []TaskStatus{task, planned}}
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, []TaskStatus{task, {
+		NodeType: NodeTypeCodeAnalyzer,
+		Goal:     "Propose tests for the least covered functions:\n- calc.go:Unused: 0.0% (0 of 2 statements)\n- calc.go:Div: 66.7% (2 of 3 statements)",
+	}, planned}, state.GetPlan())
+
+	// Without a plan, one is started with the running task
+	state = &State{WorkingDirectory: dir, CurrentTask: task}
+	require.NoError(t, node.Process(state))
+	require.Len(t, state.GetPlan(), 2)
+	assert.Equal(t, task, state.GetPlan()[0])
+	assert.Equal(t, NodeTypeCodeAnalyzer, state.GetPlan()[1].NodeType)
+}
+
+func TestCoverageNode_Errors(t *testing.T) {
+	node := NewCoverageNode(NewScriptedLLM())
+	err := node.Process(&State{WorkingDirectory: t.TempDir()})
+	assert.ErrorContains(t, err, "there is no go.mod")
+
+	node.RunTests = func(dir, profile string) ([]byte, error) {
+		return []byte("calc.go:3:1: syntax error"), errors.New("exit status 1")
+	}
+	err = node.Process(&State{WorkingDirectory: coverageModule(t)})
+	assert.EqualError(t, err, "go test failed: exit status 1: calc.go:3:1: syntax error")
+}
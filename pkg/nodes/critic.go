@@ -0,0 +1,118 @@
+package nodes
+
+import (
+	"fmt"
+	"strings"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/prompts"
+)
+
+// DefaultMaxRevisions is how often the critic sends a task back by default
+const DefaultMaxRevisions = 1
+
+// CriticNode reviews the result of a task of the orchestration mode before it is accepted
+// into the task history; a rejected task is done again by its node with the feedback of the
+// review, until MaxRevisions is reached
+type CriticNode struct {
+	llm LLM
+
+	// MaxRevisions is how often a task is sent back before its result is accepted anyway;
+	// 0 accepts every result after its review
+	MaxRevisions int
+
+	// revisions counts the times the running task was sent back
+	revisions int
+}
+
+// NewCriticNode creates a new critic node
+func NewCriticNode(llm LLM) *CriticNode {
+	return &CriticNode{
+		llm:          llm,
+		MaxRevisions: DefaultMaxRevisions,
+	}
+}
+
+// Process implements the Node interface for CriticNode
+func (n *CriticNode) Process(state *State) error {
+	task := state.GetCurrentTask()
+	if task.Result == "" {
+		// Nodes answering directly leave their answer in the final result only
+		task.Result = state.GetFinalResult()
+	}
+	planned := plannedTask(state, task)
+
+	prompt, err := state.RenderPrompt(prompts.CriticReview, prompts.Vars{
+		"GlobalGoal": state.GetGlobalGoal(),
+		"Goal":       planned.Goal,
+		"NodeType":   task.NodeType,
+		"Result":     task.Result,
+	})
+	if err != nil {
+		return err
+	}
+	response, err := n.llm.Complete(prompt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+	var review struct {
+		Accepted    bool   `json:"accepted"`
+		Feedback    string `json:"feedback"`
+		Explanation string `json:"explanation"`
+	}
+	if err := parseResponse(state, n.llm, response, &review); err != nil {
+		return fmt.Errorf("failed to parse review: %w", withKind(ErrParse, err))
+	}
+
+	logger := state.NodeLogger(NodeTypeCritic)
+	if !review.Accepted && n.revisions < n.MaxRevisions {
+		n.revisions++
+		logger.Info("result rejected", "node", string(task.NodeType), "revision", n.revisions)
+		state.Publish(&events.Decision{Node: string(NodeTypeCritic), Kind: events.DecisionReview, Choice: "rejected", Explanation: review.Feedback})
+		goal := planned.Goal
+		if feedback := strings.TrimSpace(review.Feedback); feedback != "" {
+			goal += "\n\nA reviewer rejected the previous result: " + feedback
+		}
+		state.SetNextNode(task.NodeType)
+		state.SetCurrentTask(TaskStatus{NodeType: task.NodeType, Goal: goal})
+		return nil
+	}
+
+	choice := "accepted"
+	if !review.Accepted {
+		logger.Warn("accepting rejected result, no revisions left", "node", string(task.NodeType), "revisions", n.revisions)
+		choice = fmt.Sprintf("accepted after %d revisions", n.revisions)
+	}
+	state.Publish(&events.Decision{Node: string(NodeTypeCritic), Kind: events.DecisionReview, Choice: choice, Explanation: review.Explanation})
+	n.revisions = 0
+
+	// The accepted task joins the history with the goal it was planned with
+	task.Goal = planned.Goal
+	task.IsCompleted = true
+	state.AppendTaskHistory(task)
+	if next, ok := advancePlan(state, task.Result); ok {
+		state.SetNextNode(next.NodeType)
+		state.SetCurrentTask(TaskStatus{NodeType: next.NodeType, Goal: next.Goal})
+		return nil
+	}
+	if answer := planAnswer(state); answer != "" {
+		state.SetFinalResult(answer)
+	}
+	state.SetNextNode(NodeTypeTerminal)
+	state.SetCurrentTask(TaskStatus{})
+	return nil
+}
+
+// plannedTask returns the task of the plan being worked on; task itself when there is no plan
+func plannedTask(state *State, task TaskStatus) TaskStatus {
+	for _, planned := range state.GetPlan() {
+		if !planned.IsCompleted {
+			return planned
+		}
+	}
+	return task
+}
+
+func (n *CriticNode) Type() NodeType {
+	return NodeTypeCritic
+}
@@ -0,0 +1,49 @@
+package nodes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCriticNode(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnContains("Review the result of a task").Respond(
+		`{"accepted": false, "feedback": "the tests of pkg/api are missing"}`,
+		`{"accepted": false, "feedback": "still missing"}`)
+	node := NewCriticNode(llm)
+	state := &State{GlobalGoal: "run the tests", Plan: []TaskStatus{{NodeType: NodeTypeBash, Goal: "run the tests"}}}
+	state.SetCurrentTask(TaskStatus{NodeType: NodeTypeBash, Goal: "run the tests", Result: "ok pkg/nodes"})
+
+	// The first rejection sends the task back with the feedback
+	require.NoError(t, node.Process(state))
+	assert.Contains(t, llm.Calls()[0], "Task Goal: run the tests\nNode Type: bash\nResult: ok pkg/nodes")
+	assert.Equal(t, NodeTypeBash, state.GetNextNode())
+	assert.Equal(t, "run the tests\n\nA reviewer rejected the previous result: the tests of pkg/api are missing", state.GetCurrentTask().Goal)
+	assert.Empty(t, state.GetTaskHistory())
+
+	// Without revisions left the result is accepted, with the goal it was planned with
+	state.SetCurrentTaskResult("ok pkg/nodes\nok pkg/api")
+	require.NoError(t, node.Process(state))
+	assert.Contains(t, llm.Calls()[1], "Task Goal: run the tests\n")
+	assert.Equal(t, NodeTypeTerminal, state.GetNextNode())
+	assert.Equal(t, []TaskStatus{{NodeType: NodeTypeBash, Goal: "run the tests", IsCompleted: true, Result: "ok pkg/nodes\nok pkg/api"}}, state.GetTaskHistory())
+	llm.AssertExpectations(t)
+}
+
+func TestCriticNode_NextTask(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnContains("Review the result of a task").Respond(`{"accepted": true}`)
+	node := NewCriticNode(llm)
+	state := &State{Plan: []TaskStatus{
+		{NodeType: NodeTypeBash, Goal: "run the tests"},
+		{NodeType: NodeTypeDirectResponse, Goal: "explain the failures"},
+	}}
+	state.SetCurrentTask(TaskStatus{NodeType: NodeTypeBash, Goal: "run the tests", Result: "FAIL pkg/api"})
+
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, NodeTypeDirectResponse, state.GetNextNode())
+	assert.Equal(t, TaskStatus{NodeType: NodeTypeDirectResponse, Goal: "explain the failures"}, state.GetCurrentTask())
+	assert.Len(t, state.GetTaskHistory(), 1)
+}
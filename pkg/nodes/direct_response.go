@@ -2,6 +2,8 @@ package nodes
 
 import (
 	"fmt"
+
+	"aiagent/pkg/prompts"
 )
 
 // DirectResponseNodeInterface defines the operations for a direct response node
@@ -30,20 +32,34 @@ func NewDirectResponseNode(llm LLM) *DirectResponseNode {
 
 // Process implements the Node interface for DirectResponseNode
 func (n *DirectResponseNode) Process(state *State) error {
-	prompt := fmt.Sprintf(`Based on the current task, provide a direct response:
-Task Goal: %s
-Current State: %s`, state.CurrentTask.Goal, state.Input)
+	prompt, err := state.RenderPrompt(prompts.DirectResponseRespond, prompts.Vars{
+		"ConversationContext": state.GetConversationContext(),
+		"Goal":                state.GetCurrentTask().Goal,
+		"Input":               state.GetInput(),
+	})
+	if err != nil {
+		return err
+	}
 
-	response, err := n.llm.Complete(prompt)
+	response, err := completeResult(state, n.llm, prompt)
 	if err != nil {
-		return fmt.Errorf("LLM error: %v", err)
+		return fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
-	state.FinalResult = response
-	state.NextNode = NodeTypeTerminal
+	state.SetFinalResult(response)
+	state.SetNextNode(NodeTypeTerminal)
 	return nil
 }
 
 func (n *DirectResponseNode) Type() NodeType {
 	return NodeTypeDirectResponse
 }
+
+// Describe implements the Describer interface for DirectResponseNode
+func (n *DirectResponseNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeDirectResponse,
+		Description: "answers a question from general knowledge, without looking at the system",
+		Examples:    []string{"what is a goroutine?"},
+	}
+}
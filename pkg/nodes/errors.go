@@ -0,0 +1,64 @@
+package nodes
+
+import (
+	"errors"
+	"net"
+)
+
+// Error kinds returned by the nodes and the LLM implementations
+// Callers match them with errors.Is; the error messages keep the original wording
+var (
+	// ErrLLM is returned when a call to the language model fails
+	ErrLLM = errors.New("LLM error")
+
+	// ErrLLMQuota is returned when the LLM provider rejects a request because of rate limits or quota
+	ErrLLMQuota = errors.New("LLM quota exceeded")
+
+	// ErrLLMAuth is returned when the LLM provider rejects the API key
+	ErrLLMAuth = errors.New("LLM authentication failed")
+
+	// ErrParse is returned when the LLM response cannot be understood
+	ErrParse = errors.New("failed to parse LLM response")
+
+	// ErrPolicyDenied is returned when a generated command is refused by the command policy
+	ErrPolicyDenied = errors.New("command validation failed")
+
+	// ErrCommandFailed is returned when an approved command exits with an error
+	ErrCommandFailed = errors.New("command execution failed")
+
+	// ErrTimeout is returned when an operation did not finish in time
+	ErrTimeout = errors.New("operation timed out")
+
+	// ErrCanceled is returned when the user declines a command or the issues to file
+	ErrCanceled = errors.New("canceled by the user")
+)
+
+// kindError attaches an error kind to an error without changing its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// withKind marks err as being of the given kind; it returns nil if err is nil
+// A network timeout is additionally marked as ErrTimeout
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() && !errors.Is(err, ErrTimeout) {
+		err = &kindError{kind: ErrTimeout, err: err}
+	}
+	if errors.Is(err, kind) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
@@ -0,0 +1,255 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/policy"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestWithKind(t *testing.T) {
+	cause := errors.New("unexpected end of JSON input")
+	err := withKind(ErrParse, cause)
+
+	assert.Equal(t, cause.Error(), err.Error())
+	assert.ErrorIs(t, err, ErrParse)
+	assert.ErrorIs(t, err, cause)
+	assert.NoError(t, withKind(ErrParse, nil))
+
+	timeout := withKind(ErrLLM, fmt.Errorf("failed to send request: %w", timeoutError{}))
+	assert.ErrorIs(t, timeout, ErrLLM)
+	assert.ErrorIs(t, timeout, ErrTimeout)
+}
+
+func TestDefaultLLM_StatusErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		kind   error
+	}{
+		{http.StatusTooManyRequests, ErrLLMQuota},
+		{http.StatusUnauthorized, ErrLLMAuth},
+		{http.StatusGatewayTimeout, ErrTimeout},
+		{http.StatusInternalServerError, ErrLLM},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"error":{"message":"request failed"}}`))
+			}))
+			defer server.Close()
+
+			llm := &DefaultLLM{ApiUrl: server.URL, ApiKey: "sk-test", ModelId: "gpt-4"}
+			_, err := llm.Complete("hello")
+			assert.ErrorIs(t, err, tt.kind)
+			assert.Contains(t, err.Error(), "request failed")
+		})
+	}
+}
+
+func TestNodeErrorKinds(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		kind     error
+	}{
+		{"policy denied", `{"command": "rm -rf /", "explanation": "clean up"}`, ErrPolicyDenied},
+		{"parse failure", `Sure, here is the command`, ErrParse},
+		{"command failed", `{"command": "ls /nonexistent-directory", "explanation": "list"}`, ErrCommandFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := NewScriptedLLM()
+			llm.OnContains("Goal: remove everything").Respond(tt.response)
+			node := NewBashNode(llm)
+			state := &State{Input: "clean up", CurrentTask: TaskStatus{Goal: "remove everything"}}
+
+			_, err := node.Process(state)
+			assert.ErrorIs(t, err, tt.kind)
+			llm.AssertExpectations(t)
+		})
+	}
+
+	llm := NewScriptedLLM()
+	llm.OnAny().Fail(errors.New("quota exceeded"))
+	_, err := NewBashNode(llm).Process(&State{})
+	assert.ErrorIs(t, err, ErrLLM)
+}
+
+func TestBashNodeApprover(t *testing.T) {
+	tests := []struct {
+		name     string
+		approved bool
+		err      error
+		kind     error
+		canceled bool
+	}{
+		{"approved", true, nil, nil, false},
+		{"denied", false, nil, ErrPolicyDenied, true},
+		{"approver failed", true, errors.New("approval timed out"), ErrPolicyDenied, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := NewScriptedLLM()
+			llm.OnAny().Respond(`{"command": "echo hi", "explanation": "greet"}`)
+			bus := events.NewBus()
+			var published []events.Type
+			bus.Subscribe(events.SubscriberFunc(func(event events.Event) {
+				published = append(published, event.Type())
+			}))
+
+			var asked []string
+			node := NewBashNode(llm)
+			node.Runner = func(command, dir string) ([]byte, int, error) { return []byte("hi"), 0, nil }
+			node.Approver = func(id, command string) (bool, error) {
+				asked = append(asked, id+": "+command)
+				return tt.approved, tt.err
+			}
+			state := &State{Input: "greet", Events: bus.ForRun("run")}
+
+			_, err := node.Process(state)
+			if tt.kind == nil {
+				assert.NoError(t, err)
+				assert.Contains(t, published, events.TypeCommandExecuted)
+			} else {
+				assert.ErrorIs(t, err, tt.kind)
+				assert.Equal(t, tt.canceled, errors.Is(err, ErrCanceled))
+				assert.Contains(t, published, events.TypeCommandRejected)
+				assert.NotContains(t, published, events.TypeCommandExecuted)
+			}
+			assert.Equal(t, []string{"1: echo hi"}, asked)
+			assert.Contains(t, published, events.TypeApprovalPending)
+			assert.Contains(t, published, events.TypeApprovalAnswered)
+		})
+	}
+}
+
+func TestBashNodeReviewer(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnAny().Respond(`{"command": "rm build.log", "explanation": "clean up"}`)
+	node := NewBashNode(llm)
+	node.Policy = PolicyRelaxed
+	node.Runner = func(command, dir string) ([]byte, int, error) { return nil, 0, nil }
+	node.Approver = func(id, command string) (bool, error) {
+		t.Fatal("the approver must not be asked about reviewed commands")
+		return false, nil
+	}
+	node.ReviewRating = RatingDangerous
+
+	var reviewed []Rating
+	node.Reviewer = func(id, command string, rating Rating) (Review, error) {
+		reviewed = append(reviewed, rating)
+		return Review{Approved: true, Reviewer: "alice"}, nil
+	}
+	state := &State{Input: "remove the build log"}
+	_, err := node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, []Rating{RatingDangerous}, reviewed)
+	assert.Equal(t, "alice", state.GetCommandReviewer())
+
+	node.Reviewer = func(id, command string, rating Rating) (Review, error) {
+		return Review{Reviewer: "bob"}, nil
+	}
+	_, err = node.Process(state)
+	assert.EqualError(t, err, "command validation failed: command was rejected by bob")
+	assert.ErrorIs(t, err, ErrCanceled)
+	assert.Equal(t, "bob", state.GetCommandReviewer())
+}
+
+func TestBashNodeEngine(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnAny().Respond(`{"command": "ls /srv", "explanation": "list"}`)
+	node := NewBashNode(llm)
+	node.Runner = func(command, dir string) ([]byte, int, error) { return []byte("app"), 0, nil }
+	node.User = "alice"
+
+	var inputs []policy.Input
+	decision := policy.Ask
+	node.Engine = policy.EngineFunc(func(_ context.Context, input policy.Input) (policy.Result, error) {
+		inputs = append(inputs, input)
+		return policy.Result{Decision: decision, Reason: "production hosts"}, nil
+	})
+
+	// Asked without anyone to ask
+	_, err := node.Process(&State{Input: "list /srv"})
+	assert.EqualError(t, err, "command validation failed: the policy requires an approval, but nobody can be asked")
+
+	var asked []string
+	node.Asker = func(id, command string) (bool, error) {
+		asked = append(asked, command)
+		return true, nil
+	}
+	_, err = node.Process(&State{Input: "list /srv"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ls /srv"}, asked)
+	assert.Equal(t, policy.ActionCommand, inputs[1].Action)
+	assert.Equal(t, "SAFE", inputs[1].Rating)
+	assert.Equal(t, "alice", inputs[1].User)
+
+	decision = policy.Deny
+	_, err = node.Process(&State{Input: "list /srv"})
+	assert.EqualError(t, err, "command validation failed: production hosts")
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+	assert.Len(t, asked, 1)
+
+	// The command policy is asked first
+	root := NewScriptedLLM()
+	root.OnAny().Respond(`{"command": "sudo ls", "explanation": "list"}`)
+	node.llm = root
+	_, err = node.Process(&State{Input: "list as root"})
+	assert.EqualError(t, err, "command validation failed: command contains dangerous pattern: sudo")
+	assert.Len(t, inputs, 3)
+}
+
+func TestBashNodeTrusted(t *testing.T) {
+	commandLLM := func(command string) LLM {
+		llm := NewScriptedLLM()
+		llm.OnAny().Respond(`{"command": "` + command + `", "explanation": "run"}`)
+		return llm
+	}
+	node := NewBashNode(commandLLM("go test ./..."))
+	node.Policy = PolicyRelaxed
+	node.Runner = func(command, dir string) ([]byte, int, error) { return nil, 0, nil }
+	var asked []string
+	node.Approver = func(id, command string) (bool, error) {
+		asked = append(asked, command)
+		return true, nil
+	}
+	node.Trusted = func(command string) bool { return true }
+
+	// A command with a good history runs without asking
+	_, err := node.Process(&State{Input: "run the tests"})
+	assert.NoError(t, err)
+	assert.Empty(t, asked)
+
+	// Dangerous commands are always asked about
+	node.llm = commandLLM("rm build.log")
+	_, err = node.Process(&State{Input: "remove the build log"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rm build.log"}, asked)
+
+	// So are the commands the policy engine wants approved
+	node.llm = commandLLM("go test ./...")
+	node.Engine = policy.EngineFunc(func(context.Context, policy.Input) (policy.Result, error) {
+		return policy.Result{Decision: policy.Ask}, nil
+	})
+	_, err = node.Process(&State{Input: "run the tests"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rm build.log", "go test ./..."}, asked)
+}
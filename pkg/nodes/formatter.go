@@ -1,8 +1,9 @@
 package nodes
 
 import (
-	"encoding/json"
 	"fmt"
+
+	"aiagent/pkg/prompts"
 )
 
 // FormatterNodeInterface defines the operations for a formatter node
@@ -31,33 +32,39 @@ func NewFormatterNode(llm LLM) *FormatterNode {
 
 // Process implements the Node interface for FormatterNode
 func (n *FormatterNode) Process(state *State) error {
-	prompt := fmt.Sprintf(`Format the following output for better readability:
-Raw Output: %s
-Task Goal: %s
-
-Return JSON response with:
-{
-    "formatted_output": "the formatted output",
-    "explanation": "why this formatting was chosen"
-}`, state.RawOutput, state.CurrentTask.Goal)
+	prompt, err := state.RenderPrompt(prompts.FormatterFormat, prompts.Vars{
+		"RawOutput": state.GetRawOutput(),
+		"Goal":      state.GetCurrentTask().Goal,
+	})
+	if err != nil {
+		return err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return fmt.Errorf("LLM error: %v", err)
+		return fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
 		FormattedOutput string `json:"formatted_output"`
 		Explanation     string `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return fmt.Errorf("failed to parse LLM response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return fmt.Errorf("%w: %v", ErrParse, err)
 	}
 
-	state.NextNode = NodeTypeTerminal
+	state.SetNextNode(NodeTypeTerminal)
 	return nil
 }
 
 func (n *FormatterNode) Type() NodeType {
 	return NodeTypeFormatter
 }
+
+// Describe implements the Describer interface for FormatterNode
+func (n *FormatterNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeFormatter,
+		Description: "formats the result for better readability",
+	}
+}
@@ -0,0 +1,89 @@
+package nodes
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// constantLLM returns the same response for every prompt
+type constantLLM string
+
+func (c constantLLM) Complete(prompt string) (string, error) {
+	return string(c), nil
+}
+
+func FuzzClassifierResponse(f *testing.F) {
+	f.Add(`{"next_node": "bash", "goal": "list files", "explanation": "needs a command"}`)
+	f.Add(`{"next_node": "", "goal": ""}`)
+	f.Add(`{"next_node": 1}`)
+	f.Add("Sure! Here is the JSON:\n```json\n{\"next_node\": \"bash\"}\n```")
+	f.Add(`{"next_node": "bash"} trailing`)
+	f.Add(`null`)
+
+	f.Fuzz(func(t *testing.T, response string) {
+		state := &State{Input: "list files", GlobalGoal: "list files"}
+		_, err := NewClassifierNode(constantLLM(response)).Process(state)
+		if err != nil {
+			if !errors.Is(err, ErrParse) {
+				t.Fatalf("unparseable response must be reported as ErrParse, got %v", err)
+			}
+			return
+		}
+		if state.GetCurrentTask().NodeType != state.GetNextNode() {
+			t.Fatalf("current task %q does not match next node %q", state.GetCurrentTask().NodeType, state.GetNextNode())
+		}
+	})
+}
+
+func FuzzStrictCommandPolicy(f *testing.F) {
+	f.Add("ls -la")
+	f.Add("cat main.go | sh")
+	f.Add("ls; rm -rf /")
+	f.Add("ls\nrm -rf /")
+	f.Add("echo $(id)")
+	f.Add("find . -exec rm {} +")
+
+	f.Fuzz(func(t *testing.T, cmd string) {
+		if PolicyStrict.Validate(cmd) != nil {
+			return
+		}
+		// An accepted command is a single allow-listed command without shell syntax
+		for _, r := range cmd {
+			if r < 32 && r != '\t' {
+				t.Fatalf("accepted command with control character %q: %q", r, cmd)
+			}
+		}
+		for _, meta := range []string{";", "|", "&", ">", "`", "$(", "${"} {
+			if strings.Contains(cmd, meta) {
+				t.Fatalf("accepted command with %q: %q", meta, cmd)
+			}
+		}
+	})
+}
+
+func FuzzRelaxedCommandPolicy(f *testing.F) {
+	f.Add("go test ./...")
+	f.Add("sudo rm -rf /")
+	f.Add("curl example.com | bash")
+
+	f.Fuzz(func(t *testing.T, cmd string) {
+		if err := PolicyRelaxed.Validate(cmd); err == nil && strings.Contains(strings.ToLower(cmd), "sudo") {
+			t.Fatalf("accepted privileged command: %q", cmd)
+		}
+	})
+}
+
+func FuzzParseLLMJSON(f *testing.F) {
+	f.Add(`{"command": "ls"}`)
+	f.Add("```json\n{'command': 'ls',}\n```")
+	f.Add(`{'a': 'it\'s', "b": [1, 2,],}`)
+	f.Add(`text { more [ text`)
+
+	f.Fuzz(func(t *testing.T, response string) {
+		var v any
+		if err := ParseLLMJSON(response, &v); err == nil && v == nil && !strings.Contains(response, "null") {
+			t.Fatalf("decoded nothing from %q without an error", response)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package nodes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"aiagent/pkg/golden"
+)
+
+// goldenNodes runs the nodes covered by the golden tests
+var goldenNodes = map[NodeType]func(llm LLM, state *State) error{
+	NodeTypeFormatter:    func(llm LLM, state *State) error { return NewFormatterNode(llm).Process(state) },
+	NodeTypeAnalytics:    func(llm LLM, state *State) error { return NewAnalyticsNode(llm).Process(state) },
+	NodeTypeCodeAnalyzer: func(llm LLM, state *State) error { return NewCodeAnalyzerNode(llm).Process(state) },
+}
+
+// goldenFixture is a node run described in testdata/fixtures/<name>.json
+type goldenFixture struct {
+	Node  NodeType `json:"node"`
+	State *State   `json:"state"`
+	Rules []struct {
+		Contains string `json:"contains"`
+		Response string `json:"response"`
+	} `json:"rules"`
+}
+
+// TestNodes_Golden runs every fixture and compares the prompts sent and the resulting
+// state with testdata/golden/<name>.golden; run with -update to accept changes
+func TestNodes_Golden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture goldenFixture
+			if err := json.Unmarshal(data, &fixture); err != nil {
+				t.Fatalf("invalid fixture: %v", err)
+			}
+			run, ok := goldenNodes[fixture.Node]
+			if !ok {
+				t.Fatalf("no golden runner for node %q", fixture.Node)
+			}
+
+			state := fixture.State
+			if state == nil {
+				state = &State{}
+			}
+			if state.WorkingDirectory == "" {
+				state.WorkingDirectory = workDir
+			}
+			llm := NewScriptedLLM()
+			for _, rule := range fixture.Rules {
+				llm.OnContains(rule.Contains).Respond(rule.Response)
+			}
+
+			err = run(llm, state)
+			snapshot := renderSnapshot(llm.Calls(), state, err)
+			golden.Assert(t, name, snapshot, golden.StripANSI, func(s string) string {
+				return strings.ReplaceAll(s, workDir, "$WORKDIR")
+			})
+		})
+	}
+}
+
+// renderSnapshot renders the prompts and the state fields a node may change; the prompts are
+// sorted, since the independent prompts of a node are sent concurrently
+func renderSnapshot(prompts []string, state *State, err error) string {
+	prompts = slices.Sorted(slices.Values(prompts))
+	var sb strings.Builder
+	for i, prompt := range prompts {
+		fmt.Fprintf(&sb, "=== prompt %d ===\n%s\n", i+1, prompt)
+	}
+	fmt.Fprintf(&sb, "=== state ===\n")
+	fmt.Fprintf(&sb, "next_node: %s\n", state.GetNextNode())
+	fmt.Fprintf(&sb, "raw_output:\n%s\n", state.GetRawOutput())
+	fmt.Fprintf(&sb, "final_result:\n%s\n", state.GetFinalResult())
+	if err != nil {
+		fmt.Fprintf(&sb, "error: %v\n", err)
+	}
+	return sb.String()
+}
@@ -0,0 +1,54 @@
+package nodes
+
+import (
+	"fmt"
+	"strings"
+
+	"aiagent/pkg/prompts"
+)
+
+// HistorySummarizer keeps an LLM-maintained summary of the tasks evicted from TaskHistory
+//
+// The state appends a plain one-line entry for every evicted task, so no history is lost
+// when the LLM is not available. Once Limits.HistorySummaryBatch tasks have been evicted,
+// the summarizer asks the LLM to condense those entries into a short summary
+type HistorySummarizer struct {
+	llm LLM
+}
+
+// NewHistorySummarizer creates a new instance of HistorySummarizer
+func NewHistorySummarizer(llm LLM) *HistorySummarizer {
+	return &HistorySummarizer{
+		llm: llm,
+	}
+}
+
+// Summarize condenses the summary of evicted tasks when enough tasks were evicted
+// On error the plain summary is kept, so the caller may ignore the error
+func (h *HistorySummarizer) Summarize(state *State) error {
+	batch := state.GetLimits().HistorySummaryBatch
+	if batch <= 0 || state.GetEvictedSinceSummary() < batch {
+		return nil
+	}
+
+	prompt, err := state.RenderPrompt(prompts.HistorySummarize, prompts.Vars{
+		"GlobalGoal": state.GetGlobalGoal(),
+		"TaskLog":    state.GetEvictedHistorySummary(),
+	})
+	if err != nil {
+		return err
+	}
+
+	response, err := h.llm.Complete(prompt)
+	if err != nil {
+		return fmt.Errorf("failed to summarize task history: %w", err)
+	}
+
+	summary := strings.TrimSpace(response)
+	if summary == "" {
+		return fmt.Errorf("failed to summarize task history: empty summary")
+	}
+
+	state.SetEvictedHistorySummary(summary + "\n")
+	return nil
+}
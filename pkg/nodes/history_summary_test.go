@@ -0,0 +1,67 @@
+package nodes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistorySummarizer_Summarize(t *testing.T) {
+	state := &State{
+		GlobalGoal:  "find large files",
+		TaskHistory: make([]TaskStatus, 0),
+		Limits: StateLimits{
+			MaxTaskHistory:      1,
+			HistorySummaryBatch: 2,
+		},
+	}
+
+	prompt := "Condense the following log of earlier tasks into a short summary for an agent working on the goal below.\n" +
+		"Keep the facts needed for the next steps (file names, command results, findings, failures) and drop everything else.\n" +
+		"Global Goal: find large files\n" +
+		"Task Log:\n" +
+		"- [bash] list files (completed): a.txt b.txt\n" +
+		"- [bash] check sizes (completed): a.txt 10MB\n\n" +
+		"Return only the summary as plain text, at most 15 lines."
+	summarizer := NewHistorySummarizer(&MockLLMForTesting{
+		Responses: map[string]string{prompt: "  a.txt (10MB) is the largest file  "},
+	})
+
+	// Nothing to do until a full batch of tasks was evicted
+	state.AppendTaskHistory(TaskStatus{NodeType: NodeTypeBash, Goal: "list files", IsCompleted: true, Result: "a.txt b.txt"})
+	state.AppendTaskHistory(TaskStatus{NodeType: NodeTypeBash, Goal: "check sizes", IsCompleted: true, Result: "a.txt 10MB"})
+	assert.NoError(t, summarizer.Summarize(state))
+	assert.Equal(t, "- [bash] list files (completed): a.txt b.txt\n", state.GetEvictedHistorySummary())
+
+	state.AppendTaskHistory(TaskStatus{NodeType: NodeTypeBash, Goal: "report", IsCompleted: true, Result: "done"})
+	assert.Equal(t, 2, state.GetEvictedSinceSummary())
+	assert.NoError(t, summarizer.Summarize(state))
+	assert.Equal(t, "a.txt (10MB) is the largest file\n", state.GetEvictedHistorySummary())
+	assert.Equal(t, 0, state.GetEvictedSinceSummary())
+	assert.Len(t, state.GetTaskHistory(), 1)
+}
+
+func TestHistorySummarizer_KeepsPlainSummaryOnError(t *testing.T) {
+	state := &State{
+		TaskHistory: make([]TaskStatus, 0),
+		Limits: StateLimits{
+			MaxTaskHistory:      1,
+			HistorySummaryBatch: 1,
+		},
+	}
+	state.AppendTaskHistory(TaskStatus{NodeType: NodeTypeBash, Goal: "first", IsCompleted: true, Result: "ok"})
+	state.AppendTaskHistory(TaskStatus{NodeType: NodeTypeBash, Goal: "second", IsCompleted: true, Result: "ok"})
+
+	summarizer := NewHistorySummarizer(&failingLLM{})
+	assert.Error(t, summarizer.Summarize(state))
+	assert.Equal(t, "- [bash] first (completed): ok\n", state.GetEvictedHistorySummary())
+	assert.Equal(t, 1, state.GetEvictedSinceSummary())
+}
+
+// failingLLM is an LLM that always returns an error
+type failingLLM struct{}
+
+func (f *failingLLM) Complete(prompt string) (string, error) {
+	return "", fmt.Errorf("service unavailable")
+}
@@ -0,0 +1,121 @@
+package nodes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// defaultConnectTimeout limits establishing a connection, including the TLS handshake
+	defaultConnectTimeout = 10 * time.Second
+
+	// maxIdleConnsPerHost is the number of connections kept open to a provider
+	maxIdleConnsPerHost = 8
+)
+
+// HTTPClientOptions configures the HTTP client the LLM providers are called with
+type HTTPClientOptions struct {
+	// ConnectTimeout limits establishing a connection, including the TLS handshake; zero uses
+	// defaultConnectTimeout
+	ConnectTimeout time.Duration
+
+	// Proxy is the URL of the proxy the requests go through; empty uses the HTTPS_PROXY,
+	// HTTP_PROXY and NO_PROXY environment variables
+	Proxy string
+
+	// CACertFile is a PEM file of CA certificates trusted in addition to the system ones,
+	// e.g. of a corporate TLS-inspecting proxy
+	CACertFile string
+
+	// LoopbackOnly refuses connections to other machines, e.g. in offline mode; no proxy is
+	// used then
+	LoopbackOnly bool
+}
+
+// ErrOffline is returned when a connection to another machine is refused in offline mode
+var ErrOffline = errors.New("network access is disabled in offline mode")
+
+// sharedHTTPClient is used by the DefaultLLMs without a Client; its connections are pooled
+// and reused across calls
+var sharedHTTPClient = mustHTTPClient(HTTPClientOptions{})
+
+// NewHTTPClient creates an HTTP client for the LLM providers that pools its connections
+// The client has no overall timeout, as a streamed response may take long; DefaultLLM limits
+// every request with its Timeout instead
+func NewHTTPClient(opts HTTPClientOptions) (*http.Client, error) {
+	connectTimeout := opts.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if opts.CACertFile != "" {
+		pem, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificates found in %s", opts.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+	dial := dialer.DialContext
+	if opts.LoopbackOnly {
+		// Other hosts are refused before their name is resolved, so not even DNS is asked
+		proxy = nil
+		dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(address)
+			if ip := net.ParseIP(host); err != nil || host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+				return nil, fmt.Errorf("%w: connection to %s refused", ErrOffline, address)
+			}
+			return dialer.DialContext(ctx, network, address)
+		}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               proxy,
+			DialContext:         dial,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: connectTimeout,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: maxIdleConnsPerHost,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}, nil
+}
+
+// mustHTTPClient creates an HTTP client from options that cannot fail
+func mustHTTPClient(opts HTTPClientOptions) *http.Client {
+	client, err := NewHTTPClient(opts)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
@@ -0,0 +1,76 @@
+package nodes
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPClient_CACertFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"trusted"}}]}`))
+	}))
+	defer server.Close()
+
+	// The certificate of the test server is not trusted by default
+	_, err := (&DefaultLLM{ApiUrl: server.URL, ApiKey: "sk-test"}).Complete("hello")
+	assert.Error(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, certPEM, 0600))
+	client, err := NewHTTPClient(HTTPClientOptions{CACertFile: caFile})
+	assert.NoError(t, err)
+
+	response, err := (&DefaultLLM{ApiUrl: server.URL, ApiKey: "sk-test", Client: client}).Complete("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "trusted", response)
+
+	_, err = NewHTTPClient(HTTPClientOptions{CACertFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.ErrorContains(t, err, "failed to read CA certificates")
+	assert.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0600))
+	_, err = NewHTTPClient(HTTPClientOptions{CACertFile: caFile})
+	assert.ErrorContains(t, err, "no CA certificates found")
+}
+
+func TestNewHTTPClient_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"via proxy"}}]}`))
+	}))
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{Proxy: proxy.URL})
+	assert.NoError(t, err)
+	response, err := (&DefaultLLM{ApiUrl: "http://llm.invalid/v1/chat/completions", ApiKey: "sk-test", Client: client}).Complete("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "via proxy", response)
+	assert.Equal(t, "http://llm.invalid/v1/chat/completions", proxied)
+
+	_, err = NewHTTPClient(HTTPClientOptions{Proxy: "not a url"})
+	assert.ErrorContains(t, err, "invalid proxy URL")
+}
+
+func TestNewHTTPClient_LoopbackOnly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"local"}}]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{LoopbackOnly: true, Proxy: "http://proxy.invalid:3128"})
+	assert.NoError(t, err)
+	response, err := (&DefaultLLM{ApiUrl: server.URL, ApiKey: "sk-test", Client: client}).Complete("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "local", response)
+
+	for _, url := range []string{"https://api.openai.com/v1/chat/completions", "http://192.0.2.1:8080/v1/chat/completions"} {
+		_, err = (&DefaultLLM{ApiUrl: url, ApiKey: "sk-test", Client: client}).Complete("hello")
+		assert.ErrorIs(t, err, ErrOffline, url)
+	}
+}
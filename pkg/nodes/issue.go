@@ -0,0 +1,206 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"aiagent/pkg/issues"
+	"aiagent/pkg/prompts"
+)
+
+// DefaultMaxIssues is the maximum number of issues the issue node files at once
+const DefaultMaxIssues = 20
+
+// IssueNode turns findings, e.g. the TODOs of a package, into issues of a tracker
+// The LLM plans the issues; nothing is created or updated before the Approver approved
+// a preview of all of them
+type IssueNode struct {
+	llm     LLM
+	tracker issues.Tracker
+
+	// Approver must approve the preview of the issues; without one no issue is filed
+	Approver CommandApprover
+
+	// Labels are added to every issue
+	Labels []string
+
+	// MaxIssues caps the number of issues filed at once; further issues are dropped
+	MaxIssues int
+
+	approvals int
+}
+
+// NewIssueNode creates a new issue node filing issues in tracker
+func NewIssueNode(llm LLM, tracker issues.Tracker) *IssueNode {
+	return &IssueNode{
+		llm:       llm,
+		tracker:   tracker,
+		MaxIssues: DefaultMaxIssues,
+	}
+}
+
+// plannedIssue is an issue the node is about to create, or to update if ID is set
+type plannedIssue struct {
+	issues.Issue
+	update bool
+}
+
+// Process implements the Node interface for IssueNode
+func (n *IssueNode) Process(state *State) error {
+	if n.tracker == nil {
+		return fmt.Errorf("%w: no issue tracker is configured", ErrParse)
+	}
+
+	prompt, err := state.RenderPrompt(prompts.IssuePlan, prompts.Vars{
+		"ConversationContext": state.GetConversationContext(),
+		"Goal":                state.GetCurrentTask().Goal,
+		"Input":               state.GetInput(),
+		"TaskHistory":         state.GetTaskHistory(),
+		"Output":              state.GetRawOutput(),
+		"Tracker":             n.tracker.Name(),
+	})
+	if err != nil {
+		return err
+	}
+
+	response, err := n.llm.Complete(prompt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+
+	var result struct {
+		Issues []struct {
+			ID     string   `json:"id"`
+			Title  string   `json:"title"`
+			Body   string   `json:"body"`
+			Labels []string `json:"labels"`
+		} `json:"issues"`
+		Explanation string `json:"explanation"`
+	}
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return fmt.Errorf("%w: %v", ErrParse, err)
+	}
+
+	logger := state.NodeLogger(NodeTypeIssue)
+	if len(result.Issues) == 0 {
+		state.SetRawOutput("No issues to file: " + result.Explanation)
+		state.SetNextNode(NodeTypeClassifier)
+		return nil
+	}
+	if n.MaxIssues > 0 && len(result.Issues) > n.MaxIssues {
+		logger.Warn("too many issues, dropping the rest", "issues", len(result.Issues), "max", n.MaxIssues)
+		result.Issues = result.Issues[:n.MaxIssues]
+	}
+
+	// Issues with the title of an open issue update it instead of filing a duplicate
+	ctx := context.Background()
+	planned := make([]plannedIssue, 0, len(result.Issues))
+	for _, issue := range result.Issues {
+		title := strings.TrimSpace(issue.Title)
+		if title == "" {
+			return fmt.Errorf("%w: issue without title", ErrParse)
+		}
+		labels := slices.Clone(issue.Labels)
+		for _, label := range n.Labels {
+			if !slices.Contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+		p := plannedIssue{Issue: issues.Issue{ID: strings.TrimSpace(issue.ID), Title: title, Body: issue.Body, Labels: labels}}
+		if p.ID == "" {
+			existing, err := n.tracker.Find(ctx, title)
+			if err != nil {
+				return fmt.Errorf("%w: failed to look up issue %q: %v", ErrCommandFailed, title, err)
+			}
+			if existing != nil {
+				p.ID = existing.ID
+			}
+		}
+		p.update = p.ID != ""
+		planned = append(planned, p)
+	}
+
+	preview := n.preview(planned)
+	logger.Debug("issues planned", "issues", len(planned), "explanation", result.Explanation)
+	if n.Approver == nil {
+		return fmt.Errorf("%w: filing issues requires approval", ErrPolicyDenied)
+	}
+	n.approvals++
+	approved, err := requestApproval(state, n.Approver, "issues-"+strconv.Itoa(n.approvals), preview)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: issue approval failed: %v", ErrPolicyDenied, err)
+	case !approved:
+		return fmt.Errorf("%w: %w", ErrPolicyDenied, withKind(ErrCanceled, errors.New("the issues were not approved")))
+	}
+
+	var sb strings.Builder
+	for _, p := range planned {
+		var filed *issues.Issue
+		action := "Created"
+		if p.update {
+			action = "Updated"
+			filed, err = n.tracker.Update(ctx, p.ID, p.Issue)
+		} else {
+			filed, err = n.tracker.Create(ctx, p.Issue)
+		}
+		if err != nil {
+			state.SetRawOutput(sb.String())
+			return fmt.Errorf("%w: failed to file issue %q: %v", ErrCommandFailed, p.Title, err)
+		}
+		logger.Info("issue filed", "action", strings.ToLower(action), "id", filed.ID, "url", filed.URL)
+		fmt.Fprintf(&sb, "%s %s %s: %s\n", action, issueRef(filed.ID), filed.Title, filed.URL)
+	}
+
+	state.SetRawOutput(sb.String())
+	state.SetNextNode(NodeTypeClassifier)
+	return nil
+}
+
+// preview describes the planned issues for their approval
+func (n *IssueNode) preview(planned []plannedIssue) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "File %d issue(s) in %s:\n", len(planned), n.tracker.Name())
+	for i, p := range planned {
+		if p.update {
+			fmt.Fprintf(&sb, "\n%d. Update %s %q\n", i+1, issueRef(p.ID), p.Title)
+		} else {
+			fmt.Fprintf(&sb, "\n%d. Create %q\n", i+1, p.Title)
+		}
+		if len(p.Labels) > 0 {
+			fmt.Fprintf(&sb, "   Labels: %s\n", strings.Join(p.Labels, ", "))
+		}
+		for _, line := range strings.Split(strings.TrimSpace(p.Body), "\n") {
+			sb.WriteString(strings.TrimRight("   "+line, " ") + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// issueRef formats the ID of an issue as it is written in the tracker, e.g. #12 or PROJ-12
+func issueRef(id string) string {
+	if _, err := strconv.Atoi(id); err == nil {
+		return "#" + id
+	}
+	return id
+}
+
+func (n *IssueNode) Type() NodeType {
+	return NodeTypeIssue
+}
+
+// Describe implements the Describer interface for IssueNode; without a tracker it is left out
+func (n *IssueNode) Describe() NodeInfo {
+	if n.tracker == nil {
+		return NodeInfo{}
+	}
+	return NodeInfo{
+		Type:        NodeTypeIssue,
+		Description: "files findings as issues in " + n.tracker.Name(),
+		Examples:    []string{"file the TODOs as issues"},
+	}
+}
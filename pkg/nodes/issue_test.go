@@ -0,0 +1,131 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/issues"
+)
+
+// fakeTracker keeps the issues in memory
+type fakeTracker struct {
+	open    []issues.Issue
+	filed   []string
+	failing bool
+}
+
+func (f *fakeTracker) Name() string { return "GitHub owner/name" }
+
+func (f *fakeTracker) Find(ctx context.Context, title string) (*issues.Issue, error) {
+	for _, issue := range f.open {
+		if issue.Title == title {
+			return &issue, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeTracker) Create(ctx context.Context, issue issues.Issue) (*issues.Issue, error) {
+	if f.failing {
+		return nil, errors.New("403 Forbidden")
+	}
+	issue.ID = strconv.Itoa(100 + len(f.filed))
+	issue.URL = "https://github.com/owner/name/issues/" + issue.ID
+	f.filed = append(f.filed, "create "+issue.Title+" ["+strings.Join(issue.Labels, ",")+"]")
+	return &issue, nil
+}
+
+func (f *fakeTracker) Update(ctx context.Context, id string, issue issues.Issue) (*issues.Issue, error) {
+	issue.ID = id
+	issue.URL = "https://github.com/owner/name/issues/" + id
+	f.filed = append(f.filed, "update "+id+" "+issue.Title)
+	return &issue, nil
+}
+
+func TestIssueNode(t *testing.T) {
+	response := `{"issues": [
+		{"title": "Handle the error of Close", "body": "main.go:12: TODO handle error", "labels": ["todo"]},
+		{"title": "Remove the retry hack", "body": "client.go:40: TODO remove"}
+	], "explanation": "two TODOs"}`
+
+	tracker := &fakeTracker{open: []issues.Issue{{ID: "7", Title: "Remove the retry hack"}}}
+	llm := NewScriptedLLM()
+	llm.OnContains("issue tracker GitHub owner/name").Respond(response)
+
+	var preview string
+	node := NewIssueNode(llm, tracker)
+	node.Labels = []string{"aiagent", "todo"}
+	node.Approver = func(id, subject string) (bool, error) {
+		assert.Equal(t, "issues-1", id)
+		preview = subject
+		return true, nil
+	}
+	state := &State{Input: "file the TODOs as issues", CurrentTask: TaskStatus{NodeType: NodeTypeIssue, Goal: "file the TODOs"}}
+
+	assert.NoError(t, node.Process(state))
+	assert.Equal(t, `File 2 issue(s) in GitHub owner/name:
+
+1. Create "Handle the error of Close"
+   Labels: todo, aiagent
+   main.go:12: TODO handle error
+
+2. Update #7 "Remove the retry hack"
+   Labels: aiagent, todo
+   client.go:40: TODO remove
+`, preview)
+	assert.Equal(t, []string{"create Handle the error of Close [todo,aiagent]", "update 7 Remove the retry hack"}, tracker.filed)
+	assert.Equal(t, "Created #100 Handle the error of Close: https://github.com/owner/name/issues/100\n"+
+		"Updated #7 Remove the retry hack: https://github.com/owner/name/issues/7\n", state.GetRawOutput())
+	assert.Equal(t, NodeTypeClassifier, state.GetNextNode())
+}
+
+func TestIssueNode_NotFiled(t *testing.T) {
+	response := `{"issues": [{"title": "Fix the build", "body": "it fails"}]}`
+	tests := []struct {
+		name     string
+		approver CommandApprover
+		failing  bool
+		kind     error
+	}{
+		{"rejected", func(id, subject string) (bool, error) { return false, nil }, false, ErrPolicyDenied},
+		{"approval failed", func(id, subject string) (bool, error) { return false, errors.New("timed out") }, false, ErrPolicyDenied},
+		{"without approver", nil, false, ErrPolicyDenied},
+		{"tracker failed", func(id, subject string) (bool, error) { return true, nil }, true, ErrCommandFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := NewScriptedLLM()
+			llm.OnAny().Respond(response)
+			tracker := &fakeTracker{failing: tt.failing}
+			node := NewIssueNode(llm, tracker)
+			node.Approver = tt.approver
+
+			err := node.Process(&State{Input: "file an issue"})
+			assert.ErrorIs(t, err, tt.kind)
+			assert.Equal(t, tt.name == "rejected", errors.Is(err, ErrCanceled))
+			assert.Empty(t, tracker.filed)
+		})
+	}
+}
+
+func TestIssueNode_NoIssues(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnAny().Respond(`{"issues": [], "explanation": "there are no TODOs"}`)
+	node := NewIssueNode(llm, &fakeTracker{})
+	node.Approver = func(id, subject string) (bool, error) {
+		t.Fatal("nothing to approve")
+		return false, nil
+	}
+	state := &State{Input: "file the TODOs"}
+
+	assert.NoError(t, node.Process(state))
+	assert.Equal(t, "No issues to file: there are no TODOs", state.GetRawOutput())
+
+	err := NewIssueNode(llm, nil).Process(&State{})
+	assert.ErrorIs(t, err, ErrParse, "without a tracker the issue node cannot run")
+}
@@ -0,0 +1,191 @@
+package nodes
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"aiagent/pkg/prompts"
+)
+
+// errNoJSON is returned by ParseLLMJSON for a response without a JSON object or array
+var errNoJSON = errors.New("no JSON object or array found in response")
+
+// maxJSONCandidates limits how many opening brackets in the prose are tried as the start of the JSON
+const maxJSONCandidates = 8
+
+// ParseLLMJSON decodes the JSON object or array in an LLM response into v
+//
+// Models often wrap the JSON in code fences or prose, or write it JavaScript style, so the
+// response is parsed leniently:
+//   - code fences and text around the JSON are ignored
+//   - trailing commas and single-quoted strings are accepted
+//
+// The first candidate that is valid JSON is decoded; if there is none, the syntax error of
+// the first candidate is returned
+func ParseLLMJSON(response string, v any) error {
+	text := stripCodeFence(response)
+
+	var first string
+	candidates := 0
+	for i := 0; i < len(text) && candidates < maxJSONCandidates; i++ {
+		if text[i] != '{' && text[i] != '[' {
+			continue
+		}
+		candidates++
+
+		candidate := balancedJSON(text[i:])
+		if json.Valid([]byte(candidate)) {
+			return json.Unmarshal([]byte(candidate), v)
+		}
+		if relaxed := normalizeJSON(candidate); json.Valid([]byte(relaxed)) {
+			return json.Unmarshal([]byte(relaxed), v)
+		}
+		if first == "" {
+			first = candidate
+		}
+	}
+
+	if first == "" {
+		return errNoJSON
+	}
+	return json.Unmarshal([]byte(first), v)
+}
+
+// ParseLLMJSONWithRepair is ParseLLMJSON, but if the response cannot be parsed the LLM is
+// asked once to repair it. If the repair fails too, the original error is returned
+func ParseLLMJSONWithRepair(llm LLM, response string, v any) error {
+	return parseWithRepair(builtinPrompts(), llm, response, v)
+}
+
+// parseResponse decodes a JSON response of the LLM, repairing it with the prompt templates of the run
+func parseResponse(state *State, llm LLM, response string, v any) error {
+	return parseWithRepair(state.GetPrompts(), llm, response, v)
+}
+
+func parseWithRepair(templates *prompts.Registry, llm LLM, response string, v any) error {
+	err := ParseLLMJSON(response, v)
+	if err == nil || llm == nil {
+		return err
+	}
+
+	prompt, renderErr := templates.Render(prompts.JSONRepair, prompts.Vars{
+		"Error":    err,
+		"Response": response,
+	})
+	if renderErr != nil {
+		return err
+	}
+
+	repaired, repairErr := llm.Complete(prompt)
+	if repairErr != nil || ParseLLMJSON(repaired, v) != nil {
+		return err
+	}
+	return nil
+}
+
+// stripCodeFence returns the content of the first Markdown code fence in text,
+// or text itself if it has none
+func stripCodeFence(text string) string {
+	start := strings.Index(text, "```")
+	if start < 0 {
+		return text
+	}
+	body := text[start+3:]
+
+	// Skip the info string, e.g. ```json
+	if newline := strings.IndexByte(body, '\n'); newline >= 0 {
+		body = body[newline+1:]
+	} else {
+		return text
+	}
+	if end := strings.Index(body, "```"); end >= 0 {
+		body = body[:end]
+	}
+	return body
+}
+
+// balancedJSON returns the prefix of text up to the bracket closing its first bracket,
+// skipping brackets in strings; an unbalanced text is returned whole
+func balancedJSON(text string) string {
+	depth := 0
+	var quote byte
+	escaped := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return text[:i+1]
+			}
+		}
+	}
+	return text
+}
+
+// normalizeJSON rewrites single-quoted strings as double-quoted strings and drops trailing
+// commas before a closing bracket
+func normalizeJSON(text string) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+
+	var quote byte
+	escaped := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+				sb.WriteByte(c)
+			case c == '\\' && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+				// \' is not a valid JSON escape
+				sb.WriteByte('\'')
+				i++
+			case c == '\\':
+				escaped = true
+				sb.WriteByte(c)
+			case c == quote:
+				quote = 0
+				sb.WriteByte('"')
+			case c == '"' && quote == '\'':
+				sb.WriteString(`\"`)
+			default:
+				sb.WriteByte(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			quote = c
+			sb.WriteByte('"')
+		case ',':
+			rest := strings.TrimLeft(text[i+1:], " \t\r\n")
+			if rest == "" || rest[0] == '}' || rest[0] == ']' {
+				continue
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,76 @@
+package nodes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLLMJSON(t *testing.T) {
+	type command struct {
+		Command     string `json:"command"`
+		Explanation string `json:"explanation"`
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		want     command
+		wantErr  bool
+	}{
+		{"plain", `{"command": "ls", "explanation": "list"}`, command{"ls", "list"}, false},
+		{"code fence", "```json\n{\"command\": \"ls\"}\n```", command{Command: "ls"}, false},
+		{"code fence without language", "```\n{\"command\": \"ls\"}\n```", command{Command: "ls"}, false},
+		{"prose around", "Sure! Here you go: {\"command\": \"ls\"} Let me know if you need more.", command{Command: "ls"}, false},
+		{"prose with braces", "Use {placeholders} like this: {\"command\": \"ls\"}", command{Command: "ls"}, false},
+		{"braces in strings", `{"command": "echo '}'", "explanation": "prints {"}`, command{"echo '}'", "prints {"}, false},
+		{"trailing commas", "{\"command\": \"ls\",\n}", command{Command: "ls"}, false},
+		{"single quotes", `{'command': 'echo "hi"', 'explanation': 'it\'s a greeting'}`, command{`echo "hi"`, "it's a greeting"}, false},
+		{"no JSON", "I think you should run ls", command{}, true},
+		{"truncated", `{"command": "ls"`, command{}, true},
+		{"wrong type", `{"command": 1}`, command{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got command
+			err := ParseLLMJSON(tt.response, &got)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseLLMJSONWithRepair(t *testing.T) {
+	t.Run("repaired", func(t *testing.T) {
+		llm := NewScriptedLLM()
+		llm.OnContains("could not be parsed").Respond(`{"command": "ls"}`)
+
+		var got struct{ Command string }
+		assert.NoError(t, ParseLLMJSONWithRepair(llm, `command: ls`, &got))
+		assert.Equal(t, "ls", got.Command)
+		llm.AssertExpectations(t)
+	})
+
+	t.Run("valid response is not sent to the LLM", func(t *testing.T) {
+		llm := NewScriptedLLM()
+
+		var got struct{ Command string }
+		assert.NoError(t, ParseLLMJSONWithRepair(llm, `{"command": "ls"}`, &got))
+		assert.Empty(t, llm.Calls())
+	})
+
+	t.Run("repair fails", func(t *testing.T) {
+		llm := NewScriptedLLM()
+		llm.OnAny().Fail(errors.New("quota exceeded"))
+
+		var got struct{ Command string }
+		err := ParseLLMJSONWithRepair(llm, `command: ls`, &got)
+		assert.ErrorIs(t, err, errNoJSON)
+	})
+}
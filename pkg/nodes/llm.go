@@ -2,6 +2,7 @@ package nodes
 
 import (
 	"fmt"
+	"io"
 )
 
 // LLM defines the interface for language model interactions
@@ -9,19 +10,76 @@ type LLM interface {
 	Complete(prompt string) (string, error)
 }
 
+// TokenUsage is the number of tokens consumed by an LLM call
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// UsageReporter is implemented by LLMs that know the token usage of their last call
+type UsageReporter interface {
+	LastUsage() TokenUsage
+}
+
+// UsageCompleter is implemented by LLMs that return the token usage of a call with its
+// response; unlike UsageReporter, it stays right when calls run concurrently
+type UsageCompleter interface {
+	CompleteWithUsage(prompt string) (string, TokenUsage, error)
+}
+
+// StreamingLLM is implemented by LLMs that pass the response to onChunk while it is
+// generated; the complete response is returned as by Complete
+type StreamingLLM interface {
+	CompleteStream(prompt string, onChunk func(chunk string)) (string, error)
+}
+
+// CompleteStream streams the response of llm to onChunk; an LLM that cannot stream passes
+// its whole response to onChunk at once
+func CompleteStream(llm LLM, prompt string, onChunk func(chunk string)) (string, error) {
+	if streaming, ok := llm.(StreamingLLM); ok {
+		return streaming.CompleteStream(prompt, onChunk)
+	}
+	response, err := llm.Complete(prompt)
+	if err == nil && response != "" {
+		onChunk(response)
+	}
+	return response, err
+}
+
+// completeResult asks llm for a response that becomes the final result, streaming it to the
+// result writer of the state, if any, so it is rendered while it is generated
+func completeResult(state *State, llm LLM, prompt string) (string, error) {
+	w := state.GetResultWriter()
+	if w == nil {
+		return llm.Complete(prompt)
+	}
+	return CompleteStream(llm, prompt, func(chunk string) {
+		io.WriteString(w, chunk)
+	})
+}
+
+// SystemPrompter is implemented by LLMs that send a system prompt with every Complete call
+type SystemPrompter interface {
+	SystemPrompt() string
+}
+
+// SystemCompleter is implemented by LLMs that can send the system prompt given with a call
+// instead of their own; a nil onChunk does not stream the response
+type SystemCompleter interface {
+	CompleteWithSystem(systemPrompt, prompt string, onChunk func(chunk string)) (string, TokenUsage, error)
+}
+
 // MockLLMForTesting implements LLM interface for testing
+// Prompts must match exactly; use ScriptedLLM to match prompts by substring or pattern
 type MockLLMForTesting struct {
 	Responses map[string]string
 }
 
+// Complete implements the LLM interface; an unknown prompt is an error
 func (m *MockLLMForTesting) Complete(prompt string) (string, error) {
 	if response, ok := m.Responses[prompt]; ok {
 		return response, nil
 	}
-	// Debug output to help identify mismatched prompts
-	fmt.Printf("No response found for prompt:\n%q\n\nAvailable prompts:\n", prompt)
-	for p := range m.Responses {
-		fmt.Printf("%q\n", p)
-	}
-	return "", nil
+	return "", fmt.Errorf("%w: %q", ErrNoScriptedResponse, prompt)
 }
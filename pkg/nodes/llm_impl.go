@@ -1,22 +1,79 @@
 package nodes
 
 import (
+	"bufio"
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+
+	"aiagent/pkg/logging"
+)
+
+const (
+	// ProviderOpenAI is the OpenAI chat completions API
+	ProviderOpenAI = "openai"
+
+	// ProviderAzure is an Azure OpenAI deployment
+	ProviderAzure = "azure"
+
+	// ProviderOllama is a local Ollama server using its OpenAI compatible API
+	ProviderOllama = "ollama"
+
+	// ProviderLlamaCpp is a local llama.cpp server (llama-server) using its OpenAI compatible API
+	ProviderLlamaCpp = "llamacpp"
 )
 
+const (
+	defaultOllamaURL   = "http://localhost:11434/v1/chat/completions"
+	defaultOllamaModel = "llama3"
+
+	// llama-server answers with the model it was started with, whatever model is requested
+	defaultLlamaCppURL   = "http://localhost:8080/v1/chat/completions"
+	defaultLlamaCppModel = "local"
+
+	// defaultTimeout is the request timeout of DefaultLLM
+	defaultTimeout = 30 * time.Second
+)
+
+// IsLocalProvider reports whether provider runs the model on the local machine, so it
+// needs no API key and costs nothing
+func IsLocalProvider(provider string) bool {
+	return provider == ProviderOllama || provider == ProviderLlamaCpp
+}
+
 // DefaultLLM implements the LLM interface using a simple API call
 type DefaultLLM struct {
 	ApiUrl    string
 	ApiKey    string
 	ModelId   string
 	MaxTokens int
+
+	// Provider is the API flavour (defaults to OpenAI)
+	Provider string
+
+	// DefaultSystemPrompt is sent as the system prompt by Complete
+	DefaultSystemPrompt string
+
+	// Logger receives the raw HTTP payloads at trace level; nil uses the default logger
+	Logger *slog.Logger
+
+	// Timeout limits a request including reading the response; zero uses defaultTimeout
+	Timeout time.Duration
+
+	// Client sends the requests; nil uses a client shared by all DefaultLLMs
+	Client *http.Client
+
+	mu        sync.Mutex
+	lastUsage TokenUsage
 }
 
 // ChatMessage represents a message in a chat conversation
@@ -30,6 +87,16 @@ type ChatCompletionRequest struct {
 	Model     string        `json:"model"`
 	Messages  []ChatMessage `json:"messages"`
 	MaxTokens int           `json:"max_tokens,omitempty"`
+
+	// Stream asks for the response as server-sent chunks
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions configures a streamed chat completion
+type StreamOptions struct {
+	// IncludeUsage asks for a last chunk with the token usage of the call
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // ChatCompletionResponse represents the response from the chat completion API
@@ -37,11 +104,20 @@ type ChatCompletionResponse struct {
 	Choices []struct {
 		Message ChatMessage `json:"message"`
 	} `json:"choices"`
+	Usage TokenUsage `json:"usage"`
 	Error struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
+// ChatCompletionChunk represents a server-sent chunk of a streamed chat completion
+type ChatCompletionChunk struct {
+	Choices []struct {
+		Delta ChatMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *TokenUsage `json:"usage"`
+}
+
 // NewDefaultLLM creates a new instance of DefaultLLM
 func NewDefaultLLM() *DefaultLLM {
 	// Get API key from environment
@@ -65,6 +141,59 @@ func NewDefaultLLM() *DefaultLLM {
 	}
 }
 
+// NewProviderLLM creates a DefaultLLM for one of the supported providers
+// Empty model and apiURL values select the provider defaults
+func NewProviderLLM(provider, model, apiURL, apiKey string) (*DefaultLLM, error) {
+	llm := &DefaultLLM{
+		ApiUrl:    apiURL,
+		ApiKey:    apiKey,
+		ModelId:   model,
+		MaxTokens: 1000,
+		Provider:  provider,
+	}
+
+	switch provider {
+	case "", ProviderOpenAI:
+		llm.Provider = ProviderOpenAI
+		if llm.ApiUrl == "" {
+			llm.ApiUrl = "https://api.openai.com/v1/chat/completions"
+		}
+		if llm.ModelId == "" {
+			llm.ModelId = "gpt-3.5-turbo"
+		}
+		if err := validateAPIKey(apiKey); err != nil {
+			return nil, fmt.Errorf("invalid API key: %v", err)
+		}
+	case ProviderAzure:
+		// Azure deployments have their own URL, e.g.
+		// https://<resource>.openai.azure.com/openai/deployments/<deployment>/chat/completions?api-version=2024-02-01
+		if llm.ApiUrl == "" {
+			return nil, fmt.Errorf("azure provider requires the deployment URL")
+		}
+		if apiKey == "" {
+			return nil, fmt.Errorf("azure provider requires an API key")
+		}
+	case ProviderOllama:
+		if llm.ApiUrl == "" {
+			llm.ApiUrl = defaultOllamaURL
+		}
+		if llm.ModelId == "" {
+			llm.ModelId = defaultOllamaModel
+		}
+	case ProviderLlamaCpp:
+		if llm.ApiUrl == "" {
+			llm.ApiUrl = defaultLlamaCppURL
+		}
+		if llm.ModelId == "" {
+			llm.ModelId = defaultLlamaCppModel
+		}
+	default:
+		return nil, fmt.Errorf("unknown LLM provider: %s", provider)
+	}
+
+	return llm, nil
+}
+
 // validateAPIKey checks if the API key is in a valid format
 func validateAPIKey(key string) error {
 	// OpenAI API keys are typically prefixed with "sk-" and are 51 characters long
@@ -85,8 +214,15 @@ func validateAPIKey(key string) error {
 
 // Generate implements the LLM interface for DefaultLLM
 func (llm *DefaultLLM) Generate(prompt string, systemPrompt string) (string, error) {
-	if llm.ApiKey == "" {
-		return "", fmt.Errorf("API key not set")
+	response, _, err := llm.generate(prompt, systemPrompt, nil)
+	return response, err
+}
+
+// generate sends the prompt and returns the response with the token usage of the call
+// If onChunk is set, the response is streamed and passed to onChunk as it arrives
+func (llm *DefaultLLM) generate(prompt string, systemPrompt string, onChunk func(string)) (string, TokenUsage, error) {
+	if llm.ApiKey == "" && !IsLocalProvider(llm.Provider) {
+		return "", TokenUsage{}, fmt.Errorf("%w: API key not set", ErrLLMAuth)
 	}
 
 	messages := []ChatMessage{}
@@ -110,61 +246,171 @@ func (llm *DefaultLLM) Generate(prompt string, systemPrompt string) (string, err
 		Messages:  messages,
 		MaxTokens: llm.MaxTokens,
 	}
+	if onChunk != nil {
+		requestBody.Stream = true
+		requestBody.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
 
 	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+		return "", TokenUsage{}, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	logger := llm.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Log(context.Background(), logging.LevelTrace, "llm request", "url", llm.ApiUrl, "body", string(jsonBody))
+
+	timeout := llm.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	req, err := http.NewRequest("POST", llm.ApiUrl, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", llm.ApiUrl, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return "", TokenUsage{}, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	// Securely add API key to header
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+llm.ApiKey)
+	switch {
+	case llm.Provider == ProviderAzure:
+		req.Header.Set("api-key", llm.ApiKey)
+	case llm.ApiKey != "":
+		req.Header.Set("Authorization", "Bearer "+llm.ApiKey)
+	}
 
-	// Use a custom HTTP client with security settings
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			},
-			DisableKeepAlives: true,
-		},
+	client := llm.Client
+	if client == nil {
+		client = sharedHTTPClient
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
+		return "", TokenUsage{}, fmt.Errorf("failed to send request: %w", withKind(ErrLLM, err))
 	}
 	defer resp.Body.Close()
 
-	var result ChatCompletionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+	if onChunk != nil && resp.StatusCode == http.StatusOK {
+		return llm.readStream(logger, resp.Body, onChunk)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", TokenUsage{}, fmt.Errorf("failed to read response: %w", withKind(ErrLLM, err))
 	}
+	logger.Log(context.Background(), logging.LevelTrace, "llm response", "status", resp.StatusCode, "body", string(body))
+
+	var result ChatCompletionResponse
+	decodeErr := json.Unmarshal(body, &result)
 
 	if resp.StatusCode != http.StatusOK {
 		errorMsg := "unknown error"
-		if result.Error.Message != "" {
+		if decodeErr == nil && result.Error.Message != "" {
 			errorMsg = result.Error.Message
 		}
-		return "", fmt.Errorf("API error (%d): %s", resp.StatusCode, errorMsg)
+		return "", TokenUsage{}, fmt.Errorf("%w: API error (%d): %s", statusError(resp.StatusCode), resp.StatusCode, errorMsg)
+	}
+	if decodeErr != nil {
+		return "", TokenUsage{}, fmt.Errorf("%w: failed to decode response: %v", ErrLLM, decodeErr)
 	}
 
+	llm.mu.Lock()
+	llm.lastUsage = result.Usage
+	llm.mu.Unlock()
+
 	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
+		return "", TokenUsage{}, fmt.Errorf("%w: no choices in response", ErrLLM)
 	}
 
-	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+	return strings.TrimSpace(result.Choices[0].Message.Content), result.Usage, nil
+}
+
+// readStream reads the server-sent chunks of a streamed response, passing their content to
+// onChunk; leading whitespace is not passed on, as it is trimmed from the returned response
+func (llm *DefaultLLM) readStream(logger *slog.Logger, body io.Reader, onChunk func(string)) (string, TokenUsage, error) {
+	var response strings.Builder
+	var usage TokenUsage
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // Blank separators and comments
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		logger.Log(context.Background(), logging.LevelTrace, "llm response chunk", "body", data)
+
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", TokenUsage{}, fmt.Errorf("%w: failed to decode response chunk: %v", ErrLLM, err)
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			content := choice.Delta.Content
+			if response.Len() == 0 {
+				content = strings.TrimLeftFunc(content, unicode.IsSpace)
+			}
+			if content == "" {
+				continue
+			}
+			response.WriteString(content)
+			onChunk(content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", TokenUsage{}, fmt.Errorf("failed to read response: %w", withKind(ErrLLM, err))
+	}
+
+	llm.mu.Lock()
+	llm.lastUsage = usage
+	llm.mu.Unlock()
+
+	if response.Len() == 0 {
+		return "", TokenUsage{}, fmt.Errorf("%w: no content in response", ErrLLM)
+	}
+	return strings.TrimSpace(response.String()), usage, nil
 }
 
 // Complete implements the LLM interface
 func (llm *DefaultLLM) Complete(prompt string) (string, error) {
-	return llm.Generate(prompt, "")
+	return llm.Generate(prompt, llm.DefaultSystemPrompt)
+}
+
+// CompleteWithUsage implements the UsageCompleter interface
+func (llm *DefaultLLM) CompleteWithUsage(prompt string) (string, TokenUsage, error) {
+	return llm.generate(prompt, llm.DefaultSystemPrompt, nil)
+}
+
+// CompleteStream implements the StreamingLLM interface
+func (llm *DefaultLLM) CompleteStream(prompt string, onChunk func(string)) (string, error) {
+	response, _, err := llm.generate(prompt, llm.DefaultSystemPrompt, onChunk)
+	return response, err
+}
+
+// CompleteWithSystem implements the SystemCompleter interface
+func (llm *DefaultLLM) CompleteWithSystem(systemPrompt, prompt string, onChunk func(string)) (string, TokenUsage, error) {
+	return llm.generate(prompt, systemPrompt, onChunk)
+}
+
+// SystemPrompt implements the SystemPrompter interface
+func (llm *DefaultLLM) SystemPrompt() string {
+	return llm.DefaultSystemPrompt
+}
+
+// LastUsage implements the UsageReporter interface
+func (llm *DefaultLLM) LastUsage() TokenUsage {
+	llm.mu.Lock()
+	defer llm.mu.Unlock()
+	return llm.lastUsage
 }
 
 // MockLLM implements the LLM interface for testing purposes
@@ -516,3 +762,17 @@ func DefaultMockGenerate(prompt string, systemPrompt string) (string, error) {
 
 	return "I don't understand the request.", nil
 }
+
+// statusError returns the error kind for a non-OK status code of the LLM API
+func statusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusPaymentRequired:
+		return ErrLLMQuota
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrLLMAuth
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return ErrTimeout
+	default:
+		return ErrLLM
+	}
+}
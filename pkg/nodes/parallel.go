@@ -0,0 +1,107 @@
+package nodes
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// llmCall is the outcome of a prompt sent by completeAll
+type llmCall struct {
+	response string
+	err      error
+}
+
+// maxConcurrentCalls caps the prompts completeAll has in flight, so a large diff or code base
+// does not hit the rate limit of the provider with one burst
+const maxConcurrentCalls = 4
+
+// completeAll sends independent prompts to the LLM concurrently, at most maxConcurrentCalls at a
+// time, so their latencies overlap instead of adding up, and returns the outcomes in the order
+// of the prompts
+// Once ctx is canceled it returns the error of ctx without waiting; the prompts not sent yet are
+// dropped, the calls in flight finish in the background and their responses are dropped
+func completeAll(ctx context.Context, llm LLM, prompts ...string) ([]llmCall, error) {
+	calls := make([]llmCall, len(prompts))
+	indexes := make(chan int, len(prompts))
+	for i := range prompts {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for range min(maxConcurrentCalls, len(prompts)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					return
+				}
+				response, err := llm.Complete(prompts[i])
+				calls[i] = llmCall{response: response, err: err}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return calls, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// packBatches groups items of the given sizes into as few batches as possible whose sizes add
+// up to at most maxSize, so bulk content takes few LLM calls without overflowing a prompt
+// Items are packed first-fit by decreasing size; an item larger than maxSize gets a batch of its
+// own. The indexes in a batch are ascending and the batches are ordered by their first index,
+// so the packing does not depend on anything but the sizes. A maxSize of 0 packs all items
+// into one batch
+func packBatches(sizes []int, maxSize int) [][]int {
+	if len(sizes) == 0 {
+		return nil
+	}
+	if maxSize <= 0 {
+		batch := make([]int, len(sizes))
+		for i := range sizes {
+			batch[i] = i
+		}
+		return [][]int{batch}
+	}
+
+	order := make([]int, len(sizes))
+	for i := range sizes {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return sizes[order[a]] > sizes[order[b]] })
+
+	var batches [][]int
+	var free []int
+	for _, i := range order {
+		placed := false
+		for b := range batches {
+			if sizes[i] <= free[b] {
+				batches[b] = append(batches[b], i)
+				free[b] -= sizes[i]
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			batches = append(batches, []int{i})
+			free = append(free, maxSize-sizes[i])
+		}
+	}
+
+	for _, batch := range batches {
+		sort.Ints(batch)
+	}
+	sort.Slice(batches, func(a, b int) bool { return batches[a][0] < batches[b][0] })
+	return batches
+}
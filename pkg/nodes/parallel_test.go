@@ -0,0 +1,107 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// barrierLLM answers once n prompts are waiting, so it only answers prompts sent concurrently
+type barrierLLM struct {
+	n       int
+	mu      sync.Mutex
+	waiting int
+	release chan struct{}
+}
+
+func (b *barrierLLM) Complete(prompt string) (string, error) {
+	b.mu.Lock()
+	b.waiting++
+	if b.waiting == b.n {
+		close(b.release)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.release:
+	case <-time.After(5 * time.Second):
+		return "", errors.New("the prompts were not sent concurrently")
+	}
+	if prompt == "fail" {
+		return "", errors.New("failed")
+	}
+	return "re: " + prompt, nil
+}
+
+func TestCompleteAll(t *testing.T) {
+	llm := &barrierLLM{n: 3, release: make(chan struct{})}
+	calls, err := completeAll(context.Background(), llm, "a", "fail", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, []llmCall{
+		{response: "re: a"},
+		{err: errors.New("failed")},
+		{response: "re: c"},
+	}, calls)
+}
+
+// countingLLM records the most prompts it had in flight at once
+type countingLLM struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (c *countingLLM) Complete(prompt string) (string, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.max = max(c.max, c.inFlight)
+	c.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+	return "re: " + prompt, nil
+}
+
+func TestCompleteAll_Limit(t *testing.T) {
+	llm := &countingLLM{}
+	prompts := make([]string, 3*maxConcurrentCalls)
+	for i := range prompts {
+		prompts[i] = fmt.Sprint(i)
+	}
+	calls, err := completeAll(context.Background(), llm, prompts...)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, len(prompts)) {
+		assert.Equal(t, "re: 7", calls[7].response)
+	}
+	assert.Equal(t, maxConcurrentCalls, llm.max)
+}
+
+func TestCompleteAll_Canceled(t *testing.T) {
+	llm := &barrierLLM{n: 2, release: make(chan struct{})} // never answers a single prompt in time
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	calls, err := completeAll(ctx, llm, "a")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, calls)
+}
+
+func TestPackBatches(t *testing.T) {
+	assert.Nil(t, packBatches(nil, 10))
+	assert.Equal(t, [][]int{{0, 1, 2}}, packBatches([]int{5, 5, 5}, 0))
+	assert.Equal(t, [][]int{{0, 1, 2}}, packBatches([]int{3, 3, 3}, 10))
+
+	// First fit by decreasing size: 7 and 3 fill one batch, 6 and 4 the next
+	assert.Equal(t, [][]int{{0, 3}, {1, 2}}, packBatches([]int{6, 7, 3, 4}, 10))
+
+	// An item too large for any batch is sent on its own
+	assert.Equal(t, [][]int{{0, 2}, {1}}, packBatches([]int{2, 25, 8}, 10))
+}
@@ -0,0 +1,92 @@
+package nodes
+
+import (
+	"fmt"
+	"strings"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/prompts"
+)
+
+// PlannerNode splits a request into tasks for the nodes in the orchestration mode; the nodes
+// execute the tasks in order and the critic reviews each result before the next task runs
+type PlannerNode struct {
+	llm LLM
+
+	// Nodes are the nodes executing the tasks, listed in the prompt
+	Nodes Catalog
+
+	// Tools are the external tools the tool node may call
+	Tools []Tool
+
+	// MaxTasks caps the tasks of a plan; the tasks beyond it are dropped
+	MaxTasks int
+}
+
+// NewPlannerNode creates a new planner node
+func NewPlannerNode(llm LLM) *PlannerNode {
+	return &PlannerNode{
+		llm:      llm,
+		MaxTasks: MaxPlanTasks,
+	}
+}
+
+// Process implements the Node interface for PlannerNode
+func (n *PlannerNode) Process(state *State) error {
+	prompt, err := state.RenderPrompt(prompts.PlannerPlan, prompts.Vars{
+		"ConversationContext": state.GetConversationContext(),
+		"Input":               state.GetInput(),
+		"Nodes":               n.Nodes,
+		"Tools":               n.Tools,
+		"MaxTasks":            n.MaxTasks,
+	})
+	if err != nil {
+		return err
+	}
+	response, err := n.llm.Complete(prompt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+
+	var result struct {
+		Tasks []struct {
+			NextNode string `json:"next_node"`
+			Goal     string `json:"goal"`
+		} `json:"tasks"`
+		Explanation string `json:"explanation"`
+	}
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return fmt.Errorf("failed to parse plan: %w", withKind(ErrParse, err))
+	}
+
+	// A task for a node that cannot run is dropped rather than failing the run later
+	var plan []TaskStatus
+	var steps []string
+	for _, task := range result.Tasks {
+		node := NodeType(task.NextNode)
+		if !n.Nodes.Has(node) || strings.TrimSpace(task.Goal) == "" {
+			state.NodeLogger(NodeTypePlanner).Warn("dropping task of unknown node", "node", task.NextNode, "goal", task.Goal)
+			continue
+		}
+		if n.MaxTasks > 0 && len(plan) == n.MaxTasks {
+			state.NodeLogger(NodeTypePlanner).Warn("too many tasks, dropping the rest", "tasks", len(result.Tasks), "max", n.MaxTasks)
+			break
+		}
+		plan = append(plan, TaskStatus{NodeType: node, Goal: task.Goal})
+		steps = append(steps, fmt.Sprintf("%d. %s: %s", len(plan), node, task.Goal))
+	}
+	if len(plan) == 0 {
+		return fmt.Errorf("%w: the plan has no task for the nodes %s", ErrParse, strings.Join(n.Nodes.Types(), ", "))
+	}
+
+	state.NodeLogger(NodeTypePlanner).Debug("planned request", "tasks", len(plan))
+	state.Publish(&events.Decision{Node: string(NodeTypePlanner), Kind: events.DecisionPlan, Choice: strings.Join(steps, "; "), Explanation: result.Explanation})
+	state.SetPlan(plan)
+	state.SetNextNode(plan[0].NodeType)
+	state.SetCurrentTask(TaskStatus{NodeType: plan[0].NodeType, Goal: plan[0].Goal})
+	return nil
+}
+
+func (n *PlannerNode) Type() NodeType {
+	return NodeTypePlanner
+}
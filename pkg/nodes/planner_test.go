@@ -0,0 +1,41 @@
+package nodes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlannerNode(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnContains("Plan how to handle the request as tasks").Respond(`{"tasks": [
+		{"next_node": "bash", "goal": "run the tests"},
+		{"next_node": "teleport", "goal": "go somewhere"},
+		{"next_node": "direct_response", "goal": "explain the failures"}
+	], "explanation": "run, then explain"}`)
+	node := NewPlannerNode(llm)
+	node.Nodes = NewCatalog(NewBashNode(nil), NewDirectResponseNode(nil))
+	state := &State{Input: "why do the tests fail?"}
+
+	require.NoError(t, node.Process(state))
+	assert.Contains(t, llm.Calls()[0], "- bash: ")
+	assert.Contains(t, llm.Calls()[0], "Request: why do the tests fail?")
+	assert.Equal(t, []TaskStatus{
+		{NodeType: NodeTypeBash, Goal: "run the tests"},
+		{NodeType: NodeTypeDirectResponse, Goal: "explain the failures"},
+	}, state.GetPlan(), "the task of an unknown node is dropped")
+	assert.Equal(t, NodeTypeBash, state.GetNextNode())
+	assert.Equal(t, TaskStatus{NodeType: NodeTypeBash, Goal: "run the tests"}, state.GetCurrentTask())
+}
+
+func TestPlannerNode_NoTasks(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnContains("Plan how to handle the request as tasks").Respond(`{"tasks": [{"next_node": "teleport", "goal": "go"}]}`)
+	node := NewPlannerNode(llm)
+	node.Nodes = NewCatalog(NewBashNode(nil))
+
+	err := node.Process(&State{Input: "go away"})
+	assert.ErrorIs(t, err, ErrParse)
+	assert.ErrorContains(t, err, "the plan has no task for the nodes bash")
+}
@@ -0,0 +1,109 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"aiagent/pkg/policy"
+)
+
+// CommandPolicy controls which generated commands the bash node is allowed to execute
+type CommandPolicy string
+
+const (
+	// PolicyStrict only allows read-only commands from a fixed allow list, without
+	// pipes, redirections or command chaining
+	PolicyStrict CommandPolicy = "strict"
+
+	// PolicyRelaxed allows any command except destructive or privileged ones
+	PolicyRelaxed CommandPolicy = "relaxed"
+)
+
+// ParseCommandPolicy converts a policy name into a CommandPolicy
+// An empty name selects the strict policy
+func ParseCommandPolicy(name string) (CommandPolicy, error) {
+	switch CommandPolicy(strings.ToLower(strings.TrimSpace(name))) {
+	case "", PolicyStrict:
+		return PolicyStrict, nil
+	case PolicyRelaxed:
+		return PolicyRelaxed, nil
+	default:
+		return "", fmt.Errorf("unknown command policy %q (expected %q or %q)", name, PolicyStrict, PolicyRelaxed)
+	}
+}
+
+// Validate checks if a command may be executed under the policy
+func (p CommandPolicy) Validate(cmd string) error {
+	if p == PolicyRelaxed {
+		return validateCommandRelaxed(cmd)
+	}
+	return validateCommand(cmd)
+}
+
+// Evaluate implements the policy.Engine interface: commands the policy does not allow are denied
+func (p CommandPolicy) Evaluate(_ context.Context, input policy.Input) (policy.Result, error) {
+	if input.Action == policy.ActionCommand {
+		if err := p.Validate(input.Command); err != nil {
+			return policy.Result{Decision: policy.Deny, Reason: err.Error()}, nil
+		}
+	}
+	return policy.Result{Decision: policy.Allow}, nil
+}
+
+// checkPolicy asks the policy engine about an action of the run; it returns why the action
+// is denied, or whether the user must approve it
+func checkPolicy(state *State, engine policy.Engine, input policy.Input) (ask bool, denied error) {
+	input.Dir = state.GetWorkingDirectory()
+	input.Time = time.Now()
+	result, err := engine.Evaluate(state.GetContext(), input)
+	switch {
+	case err != nil:
+		return false, fmt.Errorf("policy engine failed: %v", err)
+	case result.Decision == policy.Deny && result.Reason == "":
+		return false, errors.New("denied by the policy")
+	case result.Decision == policy.Deny:
+		return false, errors.New(result.Reason)
+	}
+	return result.Decision == policy.Ask, nil
+}
+
+// validateCommandRelaxed only rejects commands that can destroy data,
+// escalate privileges or download and run code
+func validateCommandRelaxed(cmd string) error {
+	if strings.TrimSpace(cmd) == "" {
+		return fmt.Errorf("empty command")
+	}
+
+	dangerousPatterns := []string{
+		"rm -rf",
+		"rm -r",
+		"rm -fr",
+		"sudo",
+		"su -",
+		"mkfs",
+		"dd if=",
+		"shred",
+		"> /dev/",
+		"chmod -r",
+		"chown -r",
+		"shutdown",
+		"reboot",
+		":(){", // Fork bomb
+		"| sh",
+		"| bash",
+		"|sh",
+		"|bash",
+	}
+
+	cmdLower := strings.ToLower(cmd)
+	for _, pattern := range dangerousPatterns {
+		if strings.Contains(cmdLower, pattern) {
+			return fmt.Errorf("command contains dangerous pattern: %s", pattern)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package nodes_test
+
+import (
+	"testing"
+
+	"aiagent/pkg/llmtest"
+	"aiagent/pkg/nodes"
+)
+
+// The contract runs in an external test package, as llmtest imports nodes
+
+const contractAPIKey = "sk-contract0test0key"
+
+func TestProviderContract_OpenAI(t *testing.T) {
+	llmtest.RunContract(t, llmtest.Backend{
+		New: func(url string, opts llmtest.Options) (nodes.LLM, error) {
+			return newContractLLM(nodes.ProviderOpenAI, url, contractAPIKey, opts)
+		},
+		CheckRequest: llmtest.CheckBearerToken(contractAPIKey),
+	})
+}
+
+func TestProviderContract_Azure(t *testing.T) {
+	llmtest.RunContract(t, llmtest.Backend{
+		New: func(url string, opts llmtest.Options) (nodes.LLM, error) {
+			return newContractLLM(nodes.ProviderAzure, url, "azure-key", opts)
+		},
+		CheckRequest: llmtest.CheckHeader("api-key", "azure-key"),
+	})
+}
+
+func TestProviderContract_Ollama(t *testing.T) {
+	llmtest.RunContract(t, llmtest.Backend{
+		New: func(url string, opts llmtest.Options) (nodes.LLM, error) {
+			return newContractLLM(nodes.ProviderOllama, url, "", opts)
+		},
+		CheckRequest: llmtest.CheckHeader("Authorization", ""),
+	})
+}
+
+func TestProviderContract_LlamaCpp(t *testing.T) {
+	llmtest.RunContract(t, llmtest.Backend{
+		New: func(url string, opts llmtest.Options) (nodes.LLM, error) {
+			return newContractLLM(nodes.ProviderLlamaCpp, url, "", opts)
+		},
+		CheckRequest: llmtest.CheckHeader("Authorization", ""),
+	})
+}
+
+func newContractLLM(provider, url, apiKey string, opts llmtest.Options) (nodes.LLM, error) {
+	llm, err := nodes.NewProviderLLM(provider, "", url, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	llm.DefaultSystemPrompt = opts.SystemPrompt
+	llm.Timeout = opts.Timeout
+	return llm, nil
+}
@@ -0,0 +1,96 @@
+package nodes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rating is the risk of a command, recorded in the audit log
+type Rating string
+
+const (
+	// RatingSafe is a read-only command of the allow list of the strict policy
+	RatingSafe Rating = "SAFE"
+
+	// RatingCaution is any other command that is not known to destroy data
+	RatingCaution Rating = "CAUTION"
+
+	// RatingDangerous is a command that deletes or overwrites data, stops processes or
+	// changes remote systems
+	RatingDangerous Rating = "DANGEROUS"
+)
+
+// ratingOrder ranks the ratings from the least to the most risky
+var ratingOrder = []Rating{RatingSafe, RatingCaution, RatingDangerous}
+
+// dangerousPrefixes start the commands rated dangerous; they are matched against every
+// command of a pipeline or chain
+var dangerousPrefixes = []string{
+	"rm", "rmdir", "mv", "dd", "shred", "truncate", "chmod", "chown", "chgrp",
+	"kill", "killall", "pkill", "systemctl stop", "systemctl restart", "systemctl disable",
+	"git push", "git reset --hard", "git clean", "git checkout --", "git branch -d", "git branch -D",
+	"docker rm", "docker rmi", "docker system prune", "docker volume rm",
+	"kubectl delete", "kubectl apply", "kubectl scale", "kubectl drain",
+	"terraform apply", "terraform destroy", "helm uninstall", "helm upgrade",
+	"apt remove", "apt-get remove", "apt purge", "yum remove", "dnf remove", "brew uninstall",
+	"npm publish", "crontab -r", "sed -i",
+}
+
+// ParseRating converts a rating name, in any case, into a Rating
+func ParseRating(name string) (Rating, error) {
+	for _, rating := range ratingOrder {
+		if strings.EqualFold(strings.TrimSpace(name), string(rating)) {
+			return rating, nil
+		}
+	}
+	return "", fmt.Errorf("unknown command rating %q (expected safe, caution or dangerous)", name)
+}
+
+// AtLeast reports whether r is as risky as threshold or riskier
+func (r Rating) AtLeast(threshold Rating) bool {
+	rank := func(rating Rating) int {
+		for i, known := range ratingOrder {
+			if rating == known {
+				return i
+			}
+		}
+		return len(ratingOrder) // Unknown ratings are treated as the riskiest
+	}
+	return rank(r) >= rank(threshold)
+}
+
+// RateCommand rates the risk of a command
+// The rating complements the command policy: the policy decides whether a command may run
+// at all, the rating whether it needs a closer look, e.g. the approval of a second person
+func RateCommand(command string) Rating {
+	if validateCommand(command) == nil {
+		return RatingSafe
+	}
+
+	// Redirections overwrite files; appending and duplicating descriptors do not
+	normalized := strings.NewReplacer(">>", " ", "2>&1", " ", ">&2", " ", "> /dev/null", " ", ">/dev/null", " ").Replace(command)
+	if strings.Contains(normalized, ">") {
+		return RatingDangerous
+	}
+
+	for _, part := range splitCommands(command) {
+		fields := strings.Fields(part)
+		for len(fields) > 0 && (fields[0] == "sudo" || fields[0] == "env" || fields[0] == "xargs" || strings.Contains(fields[0], "=")) {
+			fields = fields[1:]
+		}
+		words := strings.Join(fields, " ")
+		for _, prefix := range dangerousPrefixes {
+			if words == prefix || strings.HasPrefix(words, prefix+" ") {
+				return RatingDangerous
+			}
+		}
+	}
+	return RatingCaution
+}
+
+// splitCommands splits a shell command line into the commands of its pipelines and chains
+func splitCommands(command string) []string {
+	return strings.FieldsFunc(command, func(r rune) bool {
+		return r == '|' || r == ';' || r == '&' || r == '\n' || r == '(' || r == ')' || r == '`'
+	})
+}
@@ -0,0 +1,42 @@
+package nodes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		rating  Rating
+	}{
+		{"ls -la", RatingSafe},
+		{"git status", RatingCaution},
+		{"go test ./... 2>&1 | tail -20", RatingCaution},
+		{"echo done >> build.log", RatingCaution},
+		{"make build > /dev/null", RatingCaution},
+		{"rm build.log", RatingDangerous},
+		{"find . -name '*.tmp' | xargs rm", RatingDangerous},
+		{"go build && git push origin main", RatingDangerous},
+		{"echo hi > notes.txt", RatingDangerous},
+		{"LANG=C sed -i s/a/b/ file", RatingDangerous},
+		{"kubectl get pods", RatingCaution},
+		{"kubectl delete pod web-1", RatingDangerous},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.rating, RateCommand(tt.command), tt.command)
+	}
+}
+
+func TestRating_AtLeast(t *testing.T) {
+	assert.True(t, RatingDangerous.AtLeast(RatingCaution))
+	assert.True(t, RatingCaution.AtLeast(RatingCaution))
+	assert.False(t, RatingSafe.AtLeast(RatingCaution))
+
+	rating, err := ParseRating("dangerous")
+	assert.NoError(t, err)
+	assert.Equal(t, RatingDangerous, rating)
+	_, err = ParseRating("risky")
+	assert.EqualError(t, err, `unknown command rating "risky" (expected safe, caution or dangerous)`)
+}
@@ -0,0 +1,162 @@
+package nodes
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrNoScriptedResponse is returned by the mock LLMs for a prompt they have no response for
+var ErrNoScriptedResponse = errors.New("no scripted response for prompt")
+
+// TestingT is the part of *testing.T used by ScriptedLLM assertions
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// ScriptedLLM is a mock LLM for tests that answers prompts by rules instead of exact matches,
+// so tests keep working when the wording of a prompt changes
+//
+// Rules are tried in the order they were added; the first matching rule that is not
+// used up answers the prompt:
+//
+//	llm := NewScriptedLLM()
+//	llm.OnContains("Verify if the following task").Respond(`{"is_task_done": true}`)
+//	llm.OnMatch(`Goal: .*files`).Respond(`{"command": "ls"}`, `{"command": "pwd"}`)
+//	llm.OnAny().Fail(errors.New("quota exceeded"))
+type ScriptedLLM struct {
+	mu    sync.Mutex
+	rules []*ScriptedRule
+	calls []string
+}
+
+// ScriptedRule answers the prompts it matches with scripted responses
+// Rules are configured before the LLM is used
+type ScriptedRule struct {
+	owner       *ScriptedLLM
+	description string
+	match       func(prompt string) bool
+	responses   []scriptedResponse
+	limit       int
+	calls       int
+}
+
+type scriptedResponse struct {
+	text string
+	err  error
+}
+
+// NewScriptedLLM creates a new instance of ScriptedLLM without rules
+func NewScriptedLLM() *ScriptedLLM {
+	return &ScriptedLLM{}
+}
+
+// OnContains adds a rule for prompts containing substr
+func (m *ScriptedLLM) OnContains(substr string) *ScriptedRule {
+	return m.addRule(fmt.Sprintf("contains %q", substr), func(prompt string) bool {
+		return strings.Contains(prompt, substr)
+	})
+}
+
+// OnMatch adds a rule for prompts matching the regular expression pattern
+// It panics if pattern does not compile, like regexp.MustCompile
+func (m *ScriptedLLM) OnMatch(pattern string) *ScriptedRule {
+	re := regexp.MustCompile(pattern)
+	return m.addRule(fmt.Sprintf("matches %q", pattern), re.MatchString)
+}
+
+// OnAny adds a rule matching every prompt, e.g. as a fallback after the specific rules
+func (m *ScriptedLLM) OnAny() *ScriptedRule {
+	return m.addRule("any prompt", func(string) bool { return true })
+}
+
+func (m *ScriptedLLM) addRule(description string, match func(string) bool) *ScriptedRule {
+	rule := &ScriptedRule{owner: m, description: description, match: match}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = append(m.rules, rule)
+	return rule
+}
+
+// Respond adds responses returned in order by successive calls; the last one is repeated
+func (r *ScriptedRule) Respond(responses ...string) *ScriptedRule {
+	for _, response := range responses {
+		r.responses = append(r.responses, scriptedResponse{text: response})
+	}
+	return r
+}
+
+// Fail adds a response that returns err, e.g. to simulate API errors
+func (r *ScriptedRule) Fail(err error) *ScriptedRule {
+	r.responses = append(r.responses, scriptedResponse{err: err})
+	return r
+}
+
+// Times limits the rule to n calls; later prompts fall through to the following rules
+func (r *ScriptedRule) Times(n int) *ScriptedRule {
+	r.limit = n
+	return r
+}
+
+// Complete implements the LLM interface
+func (m *ScriptedLLM) Complete(prompt string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, prompt)
+	for _, rule := range m.rules {
+		if rule.limit > 0 && rule.calls >= rule.limit {
+			continue
+		}
+		if !rule.match(prompt) {
+			continue
+		}
+
+		i := rule.calls
+		rule.calls++
+		if len(rule.responses) == 0 {
+			return "", nil
+		}
+		if i >= len(rule.responses) {
+			i = len(rule.responses) - 1
+		}
+		response := rule.responses[i]
+		return response.text, response.err
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrNoScriptedResponse, prompt)
+}
+
+// Calls returns the prompts received so far, in order
+func (m *ScriptedLLM) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.calls...)
+}
+
+// CallCount returns the number of prompts answered by the rule
+func (r *ScriptedRule) CallCount() int {
+	r.owner.mu.Lock()
+	defer r.owner.mu.Unlock()
+	return r.calls
+}
+
+// AssertExpectations fails the test for every rule that was never used
+// and returns whether all rules were used
+func (m *ScriptedLLM) AssertExpectations(t TestingT) bool {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ok := true
+	for _, rule := range m.rules {
+		if rule.calls == 0 {
+			t.Errorf("scripted LLM: rule %s was never used", rule.description)
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,60 @@
+package nodes
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT collects the failures reported by AssertExpectations
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestScriptedLLM(t *testing.T) {
+	quota := errors.New("quota exceeded")
+	llm := NewScriptedLLM()
+	verify := llm.OnContains("Verify if").Respond(`{"is_task_done": false}`, `{"is_task_done": true}`)
+	llm.OnMatch(`Goal: .*files`).Times(1).Respond(`{"command": "ls"}`)
+	llm.OnMatch(`Goal: .*files`).Fail(quota)
+	unused := llm.OnContains("never sent").Respond("unused")
+
+	tests := []struct {
+		prompt   string
+		response string
+		err      error
+	}{
+		{"Verify if the task is done", `{"is_task_done": false}`, nil},
+		{"Verify if the task is done", `{"is_task_done": true}`, nil},
+		{"Verify if the task is done", `{"is_task_done": true}`, nil}, // The last response repeats
+		{"Goal: list files", `{"command": "ls"}`, nil},
+		{"Goal: list more files", "", quota}, // The first rule is used up
+		{"Unknown prompt", "", ErrNoScriptedResponse},
+	}
+
+	for _, tt := range tests {
+		response, err := llm.Complete(tt.prompt)
+		assert.Equal(t, tt.response, response, tt.prompt)
+		if tt.err == nil {
+			assert.NoError(t, err, tt.prompt)
+		} else {
+			assert.ErrorIs(t, err, tt.err, tt.prompt)
+		}
+	}
+
+	assert.Equal(t, 3, verify.CallCount())
+	assert.Equal(t, 0, unused.CallCount())
+	assert.Len(t, llm.Calls(), len(tests))
+
+	rt := &recordingT{}
+	assert.False(t, llm.AssertExpectations(rt))
+	assert.Equal(t, []string{`scripted LLM: rule contains "never sent" was never used`}, rt.errors)
+}
@@ -0,0 +1,565 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/logging"
+	"aiagent/pkg/prompts"
+	"aiagent/pkg/truncate"
+)
+
+// This file contains the thread-safe accessors of State.
+// Getters return copies of slices so callers can't mutate shared data without holding the lock.
+// Setters enforce the size limits configured in State.Limits
+
+const (
+	// truncatedOutputMarker is prepended to RawOutput when its oldest part was dropped
+	truncatedOutputMarker = "[... earlier output truncated]\n"
+
+	// maxEvictedSummaryBytes caps the summary of evicted tasks; its oldest lines are dropped first
+	maxEvictedSummaryBytes = 4000
+
+	// maxEvictedResultLength is the length of a task result kept in the summary of evicted tasks
+	maxEvictedResultLength = 100
+)
+
+// GetInput returns the original user input
+func (s *State) GetInput() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Input
+}
+
+// GetCommand returns the last generated bash command
+func (s *State) GetCommand() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Command
+}
+
+// SetCommand sets the last generated bash command; it has no reviewer yet
+func (s *State) SetCommand(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Command = command
+	s.CommandReviewer = ""
+}
+
+// GetCommandReviewer returns the person who reviewed the last generated bash command
+func (s *State) GetCommandReviewer() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.CommandReviewer
+}
+
+// SetCommandReviewer sets the person who reviewed the last generated bash command
+func (s *State) SetCommandReviewer(reviewer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CommandReviewer = reviewer
+}
+
+// GetNextNode returns the node that should process the state next
+func (s *State) GetNextNode() NodeType {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.NextNode
+}
+
+// SetNextNode sets the node that should process the state next
+func (s *State) SetNextNode(node NodeType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.NextNode = node
+}
+
+// GetFinalResult returns the final output to be returned to the user
+func (s *State) GetFinalResult() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.FinalResult
+}
+
+// SetFinalResult sets the final output to be returned to the user
+func (s *State) SetFinalResult(result string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.FinalResult = result
+}
+
+// GetRawOutput returns the unformatted output of the last node
+func (s *State) GetRawOutput() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.RawOutput
+}
+
+// SetRawOutput sets the unformatted output of the last node
+// Output beyond Limits.MaxRawOutputBytes is dropped from the beginning
+func (s *State) SetRawOutput(output string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.RawOutput = truncateHead(output, s.Limits.MaxRawOutputBytes)
+}
+
+// GetVerbosity returns the verbosity level (0 = quiet, 1 = -v, 2 = -vv, 3 = -vvv)
+func (s *State) GetVerbosity() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Verbosity
+}
+
+// ChildState returns the state of a sub-graph of the run: it shares the run ID, working
+// directory, conversation context, language, file limits, context, logger, events and
+// prompts of s, while its input, goal, tasks and results are its own. Its final result is not
+// written to the ResultWriter of s
+func (s *State) ChildState(goal string) *State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &State{
+		RunID:               s.RunID,
+		Input:               goal,
+		GlobalGoal:          goal,
+		TaskHistory:         make([]TaskStatus, 0),
+		Verbosity:           s.Verbosity,
+		WorkingDirectory:    s.WorkingDirectory,
+		ConversationContext: s.ConversationContext,
+		Language:            s.Language,
+		FileCountLimit:      s.FileCountLimit,
+		FileSizeLimit:       s.FileSizeLimit,
+		Limits:              s.Limits,
+		Context:             s.Context,
+		Logger:              s.Logger,
+		Events:              s.Events,
+		Prompts:             s.Prompts,
+	}
+}
+
+// NodeLogger returns the logger of a node, with the node type attached to every record
+func (s *State) NodeLogger(node NodeType) *slog.Logger {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Logger == nil {
+		return logging.Discard()
+	}
+	return s.Logger.With("node", string(node))
+}
+
+// Publish publishes a lifecycle event of the run
+func (s *State) Publish(event events.Event) {
+	s.mu.RLock()
+	publisher := s.Events
+	s.mu.RUnlock()
+	publisher.Publish(event)
+}
+
+// builtinPrompts is the registry used by states without their own
+var builtinPrompts = sync.OnceValue(prompts.Builtin)
+
+// GetResultWriter returns the writer the final result is streamed to, or nil
+func (s *State) GetResultWriter() io.Writer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ResultWriter
+}
+
+// GetPrompts returns the prompt templates of the run
+func (s *State) GetPrompts() *prompts.Registry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Prompts == nil {
+		return builtinPrompts()
+	}
+	return s.Prompts
+}
+
+// RenderPrompt renders the active version of the named prompt template
+// When the run has a language, the prompt starts with the instruction to answer in it
+func (s *State) RenderPrompt(name string, vars prompts.Vars) (string, error) {
+	registry := s.GetPrompts()
+	prompt, err := registry.Render(name, vars)
+	if err != nil {
+		return "", err
+	}
+
+	language := s.GetLanguage()
+	if language == "" {
+		return prompt, nil
+	}
+	instruction, err := registry.Render(prompts.LanguageAnswer, prompts.Vars{"Language": language})
+	if err != nil {
+		return "", err
+	}
+	return instruction + "\n\n" + prompt, nil
+}
+
+// GetRunID returns the identifier of the run
+func (s *State) GetRunID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.RunID
+}
+
+// GetWorkingDirectory returns the working directory of the run
+func (s *State) GetWorkingDirectory() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.WorkingDirectory
+}
+
+// GetConversationContext returns the summary of previous runs
+func (s *State) GetConversationContext() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ConversationContext
+}
+
+// GetContext returns the context of the run
+func (s *State) GetContext() context.Context {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Context == nil {
+		return context.Background()
+	}
+	return s.Context
+}
+
+// GetLanguage returns the language the answers are written in
+func (s *State) GetLanguage() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Language
+}
+
+// GetCurrentTask returns a copy of the task being processed
+func (s *State) GetCurrentTask() TaskStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.CurrentTask
+}
+
+// SetCurrentTask replaces the task being processed
+func (s *State) SetCurrentTask(task TaskStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CurrentTask = task
+}
+
+// SetCurrentTaskResult sets the result of the task being processed
+func (s *State) SetCurrentTaskResult(result string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CurrentTask.Result = result
+}
+
+// SetCurrentTaskCompleted marks the task being processed as completed or not
+func (s *State) SetCurrentTaskCompleted(completed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CurrentTask.IsCompleted = completed
+}
+
+// GetTaskHistory returns a copy of the history of completed tasks
+func (s *State) GetTaskHistory() []TaskStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history := make([]TaskStatus, len(s.TaskHistory))
+	copy(history, s.TaskHistory)
+	return history
+}
+
+// GetPlan returns a copy of the tasks a compound request was split into
+func (s *State) GetPlan() []TaskStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	plan := make([]TaskStatus, len(s.Plan))
+	copy(plan, s.Plan)
+	return plan
+}
+
+// SetPlan sets the tasks a compound request was split into
+func (s *State) SetPlan(plan []TaskStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Plan = plan
+}
+
+// AppendTaskHistory adds a task to the history of completed tasks
+// When the history exceeds Limits.MaxTaskHistory, the oldest tasks are evicted
+// and folded into EvictedHistorySummary
+func (s *State) AppendTaskHistory(task TaskStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.TaskHistory = append(s.TaskHistory, task)
+
+	max := s.Limits.MaxTaskHistory
+	if max <= 0 || len(s.TaskHistory) <= max {
+		return
+	}
+
+	evicted := s.TaskHistory[:len(s.TaskHistory)-max]
+	s.EvictedHistorySummary = summarizeEvictedTasks(s.EvictedHistorySummary, evicted)
+	s.evictedSinceSummary += len(evicted)
+
+	kept := make([]TaskStatus, max)
+	copy(kept, s.TaskHistory[len(s.TaskHistory)-max:])
+	s.TaskHistory = kept
+}
+
+// GetEvictedHistorySummary returns the summary of tasks evicted from the history
+func (s *State) GetEvictedHistorySummary() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.EvictedHistorySummary
+}
+
+// SetEvictedHistorySummary replaces the summary of evicted tasks with a condensed version
+func (s *State) SetEvictedHistorySummary(summary string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.EvictedHistorySummary = summary
+	s.evictedSinceSummary = 0
+}
+
+// GetLimits returns the size limits of the state
+func (s *State) GetLimits() StateLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Limits
+}
+
+// GetEvictedSinceSummary returns the number of tasks evicted since the summary was last condensed
+func (s *State) GetEvictedSinceSummary() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.evictedSinceSummary
+}
+
+// GetGlobalGoal returns the overall goal to be achieved
+func (s *State) GetGlobalGoal() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.GlobalGoal
+}
+
+// SetGlobalGoal sets the overall goal to be achieved
+func (s *State) SetGlobalGoal(goal string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.GlobalGoal = goal
+}
+
+// GetIsGoalMet reports whether the global goal has been met
+func (s *State) GetIsGoalMet() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.IsGoalMet
+}
+
+// SetIsGoalMet records whether the global goal has been met
+func (s *State) SetIsGoalMet(met bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.IsGoalMet = met
+}
+
+// GetDirectoryContents returns a copy of the collected files and directories
+func (s *State) GetDirectoryContents() []FileContent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	contents := make([]FileContent, len(s.DirectoryContents))
+	copy(contents, s.DirectoryContents)
+	return contents
+}
+
+// SetDirectoryContents replaces the collected files and directories
+// Entries beyond Limits.MaxDirectoryEntries are dropped
+func (s *State) SetDirectoryContents(contents []FileContent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if max := s.Limits.MaxDirectoryEntries; max > 0 && len(contents) > max {
+		contents = contents[:max]
+	}
+	s.DirectoryContents = contents
+}
+
+// LoadFileContent returns the content of a collected file, reading a readable file on first
+// use; contents are cached for the run, so a file included in several prompts is read once
+// and stays the same. Contents beyond Limits.MaxFileCacheBytes are kept in temporary files,
+// removed by ReleaseFiles
+func (s *State) LoadFileContent(file FileContent) string {
+	if !file.Readable || file.Content != "" {
+		return file.Content
+	}
+
+	s.mu.RLock()
+	content, cached := s.fileContents[file.Path]
+	spilled, isSpilled := s.spilledFiles[file.Path]
+	s.mu.RUnlock()
+	if cached {
+		return content
+	}
+	if isSpilled {
+		data, err := os.ReadFile(spilled)
+		if err == nil {
+			return string(data)
+		}
+	}
+
+	content, err := readFileWithLimit(file.Path, maxCollectedFileSize)
+	if err != nil {
+		content = fmt.Sprintf("[error reading file: %v]", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if max := s.Limits.MaxFileCacheBytes; max <= 0 || s.fileCacheBytes+int64(len(content)) <= max {
+		if s.fileContents == nil {
+			s.fileContents = make(map[string]string)
+		}
+		s.fileContents[file.Path] = content
+		s.fileCacheBytes += int64(len(content))
+		return content
+	}
+	if err := s.spill(file.Path, content); err != nil && s.Logger != nil {
+		s.Logger.Warn("failed to spill file content, it will be read again", "path", file.Path, "error", err)
+	}
+	return content
+}
+
+// spill writes the content of a file to a temporary file; the caller must hold the lock
+func (s *State) spill(path, content string) error {
+	if s.spillDir == "" {
+		dir, err := os.MkdirTemp("", "aiagent-files-")
+		if err != nil {
+			return err
+		}
+		s.spillDir = dir
+	}
+	if s.spilledFiles == nil {
+		s.spilledFiles = make(map[string]string)
+	}
+	name := filepath.Join(s.spillDir, strconv.Itoa(len(s.spilledFiles)))
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		return err
+	}
+	s.spilledFiles[path] = name
+	return nil
+}
+
+// ReleaseFiles drops the cached file contents and removes the temporary files holding the
+// contents that did not fit in memory; it is called when the run ends
+func (s *State) ReleaseFiles() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fileContents = nil
+	s.fileCacheBytes = 0
+	s.spilledFiles = nil
+	if s.spillDir == "" {
+		return nil
+	}
+	dir := s.spillDir
+	s.spillDir = ""
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove temporary files: %v", err)
+	}
+	return nil
+}
+
+// GetNeedsFileContent reports whether file contents must be read
+func (s *State) GetNeedsFileContent() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.NeedsFileContent
+}
+
+// GetFilePatterns returns a copy of the patterns of files to read
+func (s *State) GetFilePatterns() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	patterns := make([]string, len(s.FilePatterns))
+	copy(patterns, s.FilePatterns)
+	return patterns
+}
+
+// GetFileLimits returns the maximum number of files and the maximum file size to read
+func (s *State) GetFileLimits() (int, int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.FileCountLimit, s.FileSizeLimit
+}
+
+// SetFileLimits sets the maximum number of files and the maximum file size to read
+func (s *State) SetFileLimits(countLimit int, sizeLimit int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.FileCountLimit = countLimit
+	s.FileSizeLimit = sizeLimit
+}
+
+// GetAnalyticsQuestion returns the analytical question to answer
+func (s *State) GetAnalyticsQuestion() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.AnalyticsQuestion
+}
+
+// truncateHead drops the beginning of text so that it fits in limit bytes
+// A limit of zero or less disables truncation
+func truncateHead(text string, limit int) string {
+	if limit <= 0 || len(text) <= limit {
+		return text
+	}
+
+	marker := truncatedOutputMarker
+	if len(marker) >= limit {
+		marker = ""
+	}
+
+	start := len(text) - (limit - len(marker))
+	// Do not cut a multi-byte character in half
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return marker + text[start:]
+}
+
+// summarizeEvictedTasks appends one line per evicted task to the existing summary
+func summarizeEvictedTasks(summary string, evicted []TaskStatus) string {
+	var sb strings.Builder
+	sb.WriteString(summary)
+	for _, task := range evicted {
+		status := "incomplete"
+		if task.IsCompleted {
+			status = "completed"
+		}
+
+		result := strings.Join(strings.Fields(task.Result), " ")
+		if len(result) > maxEvictedResultLength {
+			result = truncate.Tail(result, maxEvictedResultLength) + "..."
+		}
+		sb.WriteString(fmt.Sprintf("- [%s] %s (%s): %s\n", task.NodeType, task.Goal, status, result))
+	}
+
+	// Drop the oldest lines once the summary itself grows too large
+	result := sb.String()
+	for len(result) > maxEvictedSummaryBytes {
+		newline := strings.IndexByte(result, '\n')
+		if newline < 0 {
+			return result[len(result)-maxEvictedSummaryBytes:]
+		}
+		result = result[newline+1:]
+	}
+	return result
+}
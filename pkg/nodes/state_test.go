@@ -1,7 +1,12 @@
 package nodes
 
 import (
+	"strings"
+	"sync"
 	"testing"
+	"unicode/utf8"
+
+	"aiagent/pkg/prompts"
 )
 
 func TestState_TaskManagement(t *testing.T) {
@@ -185,3 +190,122 @@ func TestState_FileContentManagement(t *testing.T) {
 		})
 	}
 }
+
+func TestState_ConcurrentAccess(t *testing.T) {
+	state := &State{
+		TaskHistory: make([]TaskStatus, 0),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			state.AppendTaskHistory(TaskStatus{NodeType: NodeTypeBash, Goal: "task"})
+			state.SetCurrentTaskResult("result")
+			state.SetNextNode(NodeTypeClassifier)
+			_ = state.GetTaskHistory()
+			_ = state.GetCurrentTask()
+		}(i)
+	}
+	wg.Wait()
+
+	if len(state.GetTaskHistory()) != 20 {
+		t.Errorf("TaskHistory length = %v, expected %v", len(state.GetTaskHistory()), 20)
+	}
+
+	// Returned slices are copies and do not alias the shared state
+	history := state.GetTaskHistory()
+	history[0].Goal = "modified"
+	if state.GetTaskHistory()[0].Goal != "task" {
+		t.Errorf("GetTaskHistory returned a slice sharing memory with the state")
+	}
+}
+
+func TestState_Limits(t *testing.T) {
+	state := &State{
+		TaskHistory: make([]TaskStatus, 0),
+		Limits: StateLimits{
+			MaxRawOutputBytes:   50,
+			MaxDirectoryEntries: 2,
+			MaxTaskHistory:      2,
+		},
+	}
+
+	// The oldest output is dropped first
+	state.SetRawOutput(strings.Repeat("a", 100) + "tail")
+	output := state.GetRawOutput()
+	if len(output) > 50 {
+		t.Errorf("RawOutput length = %v, expected at most %v", len(output), 50)
+	}
+	if !strings.HasPrefix(output, truncatedOutputMarker) || !strings.HasSuffix(output, "tail") {
+		t.Errorf("RawOutput = %q, expected truncation marker followed by the end of the output", output)
+	}
+
+	state.SetDirectoryContents([]FileContent{{Path: "a"}, {Path: "b"}, {Path: "c"}})
+	if len(state.GetDirectoryContents()) != 2 {
+		t.Errorf("DirectoryContents length = %v, expected %v", len(state.GetDirectoryContents()), 2)
+	}
+
+	// The oldest tasks are evicted into the summary
+	for _, goal := range []string{"first", "second", "third"} {
+		state.AppendTaskHistory(TaskStatus{NodeType: NodeTypeBash, Goal: goal, IsCompleted: true, Result: "done"})
+	}
+	history := state.GetTaskHistory()
+	if len(history) != 2 || history[0].Goal != "second" || history[1].Goal != "third" {
+		t.Errorf("TaskHistory = %v, expected the two most recent tasks", history)
+	}
+	expectedSummary := "- [bash] first (completed): done\n"
+	if state.GetEvictedHistorySummary() != expectedSummary {
+		t.Errorf("EvictedHistorySummary = %q, expected %q", state.GetEvictedHistorySummary(), expectedSummary)
+	}
+}
+
+func TestTruncateHead(t *testing.T) {
+	if got := truncateHead("short", 10); got != "short" {
+		t.Errorf("truncateHead() = %q, expected %q", got, "short")
+	}
+	if got := truncateHead("abcdef", 0); got != "abcdef" {
+		t.Errorf("truncateHead() = %q, expected %q", got, "abcdef")
+	}
+	// Limits smaller than the marker keep only the end of the text
+	if got := truncateHead("abcdef", 3); got != "def" {
+		t.Errorf("truncateHead() = %q, expected %q", got, "def")
+	}
+	// Multi-byte characters are never split
+	got := truncateHead(strings.Repeat("é", 40), 41)
+	if !utf8.ValidString(got) {
+		t.Errorf("truncateHead() returned invalid UTF-8: %q", got)
+	}
+}
+
+func TestSummarizeEvictedTasks_MultiByteResult(t *testing.T) {
+	result := "x" + strings.Repeat("ü", maxEvictedResultLength)
+	summary := summarizeEvictedTasks("", []TaskStatus{{NodeType: NodeTypeBash, Goal: "translate", IsCompleted: true, Result: result}})
+	if !utf8.ValidString(summary) {
+		t.Errorf("summarizeEvictedTasks() returned invalid UTF-8: %q", summary)
+	}
+	expected := "- [bash] translate (completed): x" + strings.Repeat("ü", (maxEvictedResultLength-1)/2) + "...\n"
+	if summary != expected {
+		t.Errorf("summarizeEvictedTasks() = %q, expected %q", summary, expected)
+	}
+}
+
+func TestState_RenderPromptLanguage(t *testing.T) {
+	vars := prompts.Vars{"RawOutput": "main.go", "Goal": "list files"}
+	state := &State{}
+	english, err := state.RenderPrompt(prompts.FormatterFormat, vars)
+	if err != nil {
+		t.Fatalf("RenderPrompt() error = %v", err)
+	}
+
+	state.Language = "German"
+	german, err := state.RenderPrompt(prompts.FormatterFormat, vars)
+	if err != nil {
+		t.Fatalf("RenderPrompt() error = %v", err)
+	}
+	expected := "Write every text meant for the user, such as answers, explanations, analyses and goals, in German; keep JSON keys, node names, commands, file paths and code unchanged.\n\n" + english
+	if german != expected {
+		t.Errorf("RenderPrompt() = %q, expected %q", german, expected)
+	}
+}
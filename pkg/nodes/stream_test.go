@@ -0,0 +1,50 @@
+package nodes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultLLM_CompleteStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request ChatCompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.True(t, request.Stream)
+		assert.Equal(t, &StreamOptions{IncludeUsage: true}, request.StreamOptions)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, content := range []string{"\n", "Hello", ", world", "\n"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", content)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2,\"total_tokens\":5}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	llm := &DefaultLLM{ApiUrl: server.URL, ApiKey: "sk-test", ModelId: "gpt-4"}
+	var chunks []string
+	response, err := llm.CompleteStream("hello", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, world", response)
+	assert.Equal(t, []string{"Hello", ", world", "\n"}, chunks, "leading whitespace is not streamed")
+	assert.Equal(t, TokenUsage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}, llm.LastUsage())
+}
+
+func TestDirectResponseNode_StreamsResult(t *testing.T) {
+	llm := NewScriptedLLM()
+	llm.OnAny().Respond("The answer")
+	var out strings.Builder
+	state := &State{Input: "question", CurrentTask: TaskStatus{Goal: "question"}, ResultWriter: &out}
+
+	assert.NoError(t, NewDirectResponseNode(llm).Process(state))
+	assert.Equal(t, "The answer", state.GetFinalResult())
+	assert.Equal(t, "The answer", out.String(), "an LLM that cannot stream writes the whole response")
+}
@@ -0,0 +1,119 @@
+package nodes
+
+import (
+	"fmt"
+	"time"
+
+	"aiagent/pkg/events"
+)
+
+// DefaultMaxSubGraphSteps is the number of steps after which a sub-graph is stopped by default
+const DefaultMaxSubGraphSteps = 20
+
+// Step is a step of a sub-graph; the nodes whose Process returns only an error are steps
+type Step interface {
+	Process(state *State) error
+}
+
+// StepFunc adapts a function to a Step
+type StepFunc func(state *State) error
+
+// Process implements the Step interface for StepFunc
+func (f StepFunc) Process(state *State) error {
+	return f(state)
+}
+
+// SubGraphStep is a named step of a sub-graph
+type SubGraphStep struct {
+	Type NodeType
+	Step Step
+}
+
+// SubGraph is a workflow a node runs on a state of its own, e.g. the plan, edit, test and
+// review steps of the code fixer, so the node does not orchestrate them inline
+// The steps run in order; a step may route to another step, e.g. back to an earlier one,
+// or end the sub-graph early by setting the next node to NodeTypeTerminal
+type SubGraph struct {
+	// Name identifies the sub-graph in logs and events, usually the type of its node
+	Name string
+
+	Steps []SubGraphStep
+
+	// MaxSteps stops a sub-graph looping between its steps; 0 uses DefaultMaxSubGraphSteps
+	MaxSteps int
+}
+
+// Run runs the sub-graph for goal on a child state of parent and returns its consolidated
+// result: the final result of the child state, or else the result of its last step
+// Every step is published as a node named <sub-graph>/<step>
+func (g *SubGraph) Run(parent *State, goal string) (string, error) {
+	if len(g.Steps) == 0 {
+		return "", fmt.Errorf("sub-graph %s has no steps", g.Name)
+	}
+	maxSteps := g.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSubGraphSteps
+	}
+
+	child := parent.ChildState(goal)
+	child.SetNextNode(g.Steps[0].Type)
+	logger := parent.NodeLogger(NodeType(g.Name))
+	for steps := 0; child.GetNextNode() != NodeTypeTerminal; steps++ {
+		if steps == maxSteps {
+			return "", fmt.Errorf("sub-graph %s did not finish within %d steps", g.Name, maxSteps)
+		}
+		if err := child.GetContext().Err(); err != nil {
+			return "", fmt.Errorf("sub-graph %s canceled: %w", g.Name, err)
+		}
+
+		current := child.GetNextNode()
+		index := g.stepIndex(current)
+		if index < 0 {
+			return "", fmt.Errorf("sub-graph %s has no step %s", g.Name, current)
+		}
+		next := NodeTypeTerminal
+		if index+1 < len(g.Steps) {
+			next = g.Steps[index+1].Type
+		}
+		child.SetNextNode(next)
+		child.SetRawOutput("")
+		child.SetCurrentTask(TaskStatus{NodeType: current, Goal: goal})
+
+		name := g.Name + "/" + string(current)
+		logger.Debug("step started", "step", string(current))
+		child.Publish(&events.NodeStarted{Node: name})
+		started := time.Now()
+		err := g.Steps[index].Step.Process(child)
+		finished := &events.NodeFinished{Node: name, NextNode: string(child.GetNextNode()), Duration: time.Since(started)}
+		if err != nil {
+			finished.Error = err.Error()
+		}
+		child.Publish(finished)
+		if err != nil {
+			return "", fmt.Errorf("step %s of %s failed: %w", current, g.Name, err)
+		}
+
+		task := child.GetCurrentTask()
+		if task.Result == "" {
+			task.Result = child.GetRawOutput()
+		}
+		task.IsCompleted = true
+		child.AppendTaskHistory(task)
+	}
+
+	if result := child.GetFinalResult(); result != "" {
+		return result, nil
+	}
+	history := child.GetTaskHistory()
+	return history[len(history)-1].Result, nil
+}
+
+// stepIndex returns the index of the step of a type, -1 if there is none
+func (g *SubGraph) stepIndex(step NodeType) int {
+	for i, s := range g.Steps {
+		if s.Type == step {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,100 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/events"
+)
+
+func TestSubGraph(t *testing.T) {
+	bus := events.NewBus()
+	var published []string
+	bus.Subscribe(events.SubscriberFunc(func(event events.Event) {
+		if started, ok := event.(*events.NodeStarted); ok {
+			published = append(published, started.Node)
+		}
+	}))
+	parent := &State{RunID: "run", GlobalGoal: "fix the build", WorkingDirectory: "/src", Events: bus.ForRun("run")}
+
+	reviews := 0
+	g := &SubGraph{Name: "fixer", Steps: []SubGraphStep{
+		{Type: "edit", Step: StepFunc(func(state *State) error {
+			assert.Equal(t, "/src", state.GetWorkingDirectory())
+			state.SetRawOutput("edited " + state.GetGlobalGoal())
+			return nil
+		})},
+		{Type: "review", Step: StepFunc(func(state *State) error {
+			// The first review sends the edit back
+			if reviews++; reviews == 1 {
+				state.SetNextNode("edit")
+			}
+			state.SetRawOutput("reviewed")
+			return nil
+		})},
+	}}
+
+	result, err := g.Run(parent, "fix main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "reviewed", result, "the result of the last step without a final result")
+	assert.Equal(t, []string{"fixer/edit", "fixer/review", "fixer/edit", "fixer/review"}, published)
+	assert.Equal(t, "fix the build", parent.GetGlobalGoal())
+	assert.Empty(t, parent.GetTaskHistory(), "the steps are tasks of the child state")
+}
+
+func TestSubGraph_FinalResult(t *testing.T) {
+	g := &SubGraph{Name: "fixer", Steps: []SubGraphStep{
+		{Type: "plan", Step: StepFunc(func(state *State) error {
+			state.SetFinalResult("plan done")
+			state.SetNextNode(NodeTypeTerminal)
+			return nil
+		})},
+		{Type: "edit", Step: StepFunc(func(*State) error {
+			t.Fatal("the plan ends the sub-graph")
+			return nil
+		})},
+	}}
+	result, err := g.Run(&State{}, "goal")
+	require.NoError(t, err)
+	assert.Equal(t, "plan done", result)
+}
+
+func TestSubGraph_Errors(t *testing.T) {
+	failed := errors.New("boom")
+	g := &SubGraph{Name: "fixer", Steps: []SubGraphStep{
+		{Type: "edit", Step: StepFunc(func(*State) error { return withKind(ErrLLM, failed) })},
+	}}
+	_, err := g.Run(&State{}, "goal")
+	assert.ErrorIs(t, err, ErrLLM)
+	assert.ErrorContains(t, err, "step edit of fixer failed: boom")
+
+	loop := &SubGraph{Name: "loop", MaxSteps: 3, Steps: []SubGraphStep{
+		{Type: "edit", Step: StepFunc(func(state *State) error {
+			state.SetNextNode("edit")
+			return nil
+		})},
+	}}
+	_, err = loop.Run(&State{}, "goal")
+	assert.EqualError(t, err, "sub-graph loop did not finish within 3 steps")
+
+	lost := &SubGraph{Name: "lost", Steps: []SubGraphStep{
+		{Type: "edit", Step: StepFunc(func(state *State) error {
+			state.SetNextNode("teleport")
+			return nil
+		})},
+	}}
+	_, err = lost.Run(&State{}, "goal")
+	assert.EqualError(t, err, "sub-graph lost has no step teleport")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = g.Run(&State{Context: ctx}, "goal")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = (&SubGraph{Name: "empty"}).Run(&State{}, "goal")
+	assert.EqualError(t, err, "sub-graph empty has no steps")
+}
@@ -0,0 +1,201 @@
+package nodes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"aiagent/pkg/storage"
+)
+
+// SymbolCacheCollection is the storage collection holding the cached symbols of files
+const SymbolCacheCollection = "cache"
+
+// symbolsVersion is stored with cached symbols; bump it when extractSymbols finds other
+// symbols, so the symbols cached by older versions are extracted again
+const symbolsVersion = 1
+
+// Symbol is a declaration found in a source file
+type Symbol struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Line int    `json:"line"`
+}
+
+// symbolPattern finds the declarations of one kind in a language without a parser
+// The name is the first submatch of the expression
+type symbolPattern struct {
+	kind string
+	expr *regexp.Regexp
+}
+
+// symbolPatterns are the declaration patterns of the languages without a parser by extension
+var symbolPatterns = map[string][]symbolPattern{
+	".py": {
+		{"class", regexp.MustCompile(`^class\s+(\w+)`)},
+		{"func", regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`)},
+	},
+	".js": jsSymbolPatterns,
+	".ts": jsSymbolPatterns,
+	".java": {
+		{"type", regexp.MustCompile(`^\s*(?:public\s+|private\s+|protected\s+)?(?:abstract\s+|final\s+)?(?:class|interface|enum|record)\s+(\w+)`)},
+	},
+}
+
+var jsSymbolPatterns = []symbolPattern{
+	{"class", regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?class\s+(\w+)`)},
+	{"func", regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`)},
+}
+
+// extractSymbols returns the top-level declarations of a source file, in the order they
+// appear; files of unknown languages, and Go files that do not parse, have none
+func extractSymbols(path, content string) []Symbol {
+	ext := filepath.Ext(path)
+	if ext == ".go" {
+		return extractGoSymbols(path, content)
+	}
+
+	patterns := symbolPatterns[ext]
+	if len(patterns) == 0 {
+		return nil
+	}
+	var symbols []Symbol
+	for i, line := range strings.Split(content, "\n") {
+		for _, pattern := range patterns {
+			if match := pattern.expr.FindStringSubmatch(line); match != nil {
+				symbols = append(symbols, Symbol{Kind: pattern.kind, Name: match[1], Line: i + 1})
+				break
+			}
+		}
+	}
+	return symbols
+}
+
+// extractGoSymbols returns the functions, methods, types, constants and variables of a Go file
+func extractGoSymbols(path, content string) []Symbol {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	var symbols []Symbol
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name := decl.Name.Name
+			kind := "func"
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				kind = "method"
+				name = receiverType(decl.Recv.List[0].Type) + "." + name
+			}
+			symbols = append(symbols, Symbol{Kind: kind, Name: name, Line: fset.Position(decl.Pos()).Line})
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					symbols = append(symbols, Symbol{Kind: "type", Name: spec.Name.Name, Line: fset.Position(spec.Pos()).Line})
+				case *ast.ValueSpec:
+					kind := "var"
+					if decl.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range spec.Names {
+						if name.Name != "_" {
+							symbols = append(symbols, Symbol{Kind: kind, Name: name.Name, Line: fset.Position(name.Pos()).Line})
+						}
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// receiverType returns the name of the type of a method receiver
+func receiverType(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(expr.X)
+	case *ast.IndexExpr:
+		return receiverType(expr.X)
+	case *ast.IndexListExpr:
+		return receiverType(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
+
+// formatSymbols lists the symbols of the files, in the order of files, for a prompt
+// Files without symbols are left out
+func formatSymbols(files []string, symbols map[string][]Symbol) string {
+	var sb strings.Builder
+	for _, file := range files {
+		if len(symbols[file]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "=== %s ===\n", file)
+		for _, symbol := range symbols[file] {
+			fmt.Fprintf(&sb, "%s %s (line %d)\n", symbol.Kind, symbol.Name, symbol.Line)
+		}
+	}
+	return sb.String()
+}
+
+// SymbolCache keeps the symbols extracted from files in a store, keyed by the hash of the
+// file content, so files that did not change since an earlier run are not parsed again
+// It is safe for concurrent use when its store is
+type SymbolCache struct {
+	store storage.Store
+}
+
+// cachedSymbols is the record of the symbols of a file content
+type cachedSymbols struct {
+	Version int      `json:"version"`
+	Symbols []Symbol `json:"symbols"`
+}
+
+// NewSymbolCache creates a cache keeping the symbols in store
+func NewSymbolCache(store storage.Store) *SymbolCache {
+	return &SymbolCache{
+		store: store,
+	}
+}
+
+// symbols returns the symbols of a file, extracting and caching them if they are not cached
+// yet; the symbols are returned with the error of a failed cache write
+func (c *SymbolCache) symbols(path, content string) ([]Symbol, error) {
+	if c == nil {
+		return extractSymbols(path, content), nil
+	}
+
+	key := symbolCacheKey(path, content)
+	var cached cachedSymbols
+	err := c.store.Get(SymbolCacheCollection, key, &cached)
+	if err == nil && cached.Version == symbolsVersion {
+		return cached.Symbols, nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return extractSymbols(path, content), fmt.Errorf("failed to read cached symbols of %s: %v", path, err)
+	}
+
+	symbols := extractSymbols(path, content)
+	if err := c.store.Put(SymbolCacheCollection, key, cachedSymbols{Version: symbolsVersion, Symbols: symbols}); err != nil {
+		return symbols, fmt.Errorf("failed to cache symbols of %s: %v", path, err)
+	}
+	return symbols, nil
+}
+
+// symbolCacheKey is the hash of a file content and its extension, which selects the language
+func symbolCacheKey(path, content string) string {
+	hash := sha256.Sum256([]byte(filepath.Ext(path) + "\x00" + content))
+	return hex.EncodeToString(hash[:])
+}
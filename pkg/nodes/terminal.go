@@ -8,7 +8,7 @@ func NewTerminalNode() *TerminalNode {
 
 func (n *TerminalNode) Process(state *State) (string, error) {
 	// Terminal node just returns the final result
-	return state.CurrentTask.Result, nil
+	return state.GetCurrentTask().Result, nil
 }
 
 func (n *TerminalNode) Type() NodeType {
@@ -0,0 +1,279 @@
+package nodes
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"aiagent/pkg/prompts"
+)
+
+const (
+	// DefaultMaxTodos is the maximum number of markers shown to the LLM
+	DefaultMaxTodos = 200
+
+	// maxTodoFileSize is the size above which a file is not searched for markers
+	maxTodoFileSize = 1 << 20
+)
+
+// todoPattern matches a TODO, FIXME or HACK marker at the start of a comment, with an optional
+// owner in parentheses after the marker
+var todoPattern = regexp.MustCompile(`(?://|#|/\*|\*|--|<!--|;)\s*(TODO|FIXME|HACK)\b(?:\(([^)]*)\))?:?(.*)`)
+
+// todoSkippedDirs hold dependencies rather than the code of the working directory
+var todoSkippedDirs = map[string]bool{"node_modules": true, "vendor": true}
+
+// Todo is a marker comment left in the code
+type Todo struct {
+	File   string
+	Line   int
+	Marker string
+	Text   string
+
+	// Author is the owner named in the marker, otherwise the author of the line in git;
+	// empty if unknown
+	Author string
+}
+
+func (t Todo) String() string {
+	author := t.Author
+	if author == "" {
+		author = "unknown"
+	}
+	return fmt.Sprintf("%s:%d %s (%s): %s", t.File, t.Line, t.Marker, author, t.Text)
+}
+
+// TodoNode collects the TODO, FIXME and HACK comments of the working directory, groups them
+// by file and author, and asks the LLM for a prioritized summary of what is left to do
+type TodoNode struct {
+	llm LLM
+
+	// Blame returns the authors of the lines of a file of dir by line number; nil runs
+	// git blame. A failing blame leaves the authors unknown
+	Blame func(dir, file string) (map[int]string, error)
+
+	// MaxTodos caps the markers shown to the LLM; the total is still reported
+	MaxTodos int
+}
+
+// NewTodoNode creates a new TODO node
+func NewTodoNode(llm LLM) *TodoNode {
+	return &TodoNode{
+		llm:      llm,
+		MaxTodos: DefaultMaxTodos,
+	}
+}
+
+// Process implements the Node interface for TodoNode
+func (n *TodoNode) Process(state *State) error {
+	logger := state.NodeLogger(NodeTypeTodo)
+	dir := state.GetWorkingDirectory()
+	todos, err := FindTodos(dir)
+	if err != nil {
+		return err
+	}
+	if len(todos) == 0 {
+		result := "No TODO, FIXME or HACK comments found."
+		state.SetRawOutput(result)
+		state.SetFinalResult(result)
+		return nil
+	}
+
+	total := len(todos)
+	if n.MaxTodos > 0 && total > n.MaxTodos {
+		logger.Warn("too many markers, dropping the rest", "markers", total, "max", n.MaxTodos)
+		todos = todos[:n.MaxTodos]
+	}
+	n.attribute(logger, dir, todos)
+
+	prompt, err := state.RenderPrompt(prompts.TodoSummarize, prompts.Vars{
+		"Goal":     state.GetCurrentTask().Goal,
+		"Total":    total,
+		"Shown":    len(todos),
+		"ByFile":   groupTodos(todos, func(t Todo) string { return t.File }),
+		"ByAuthor": groupTodos(todos, func(t Todo) string { return t.Author }),
+	})
+	if err != nil {
+		return err
+	}
+	summary, err := completeResult(state, n.llm, prompt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+
+	state.SetRawOutput(summary)
+	state.SetFinalResult(summary)
+	return nil
+}
+
+// attribute sets the authors of the markers without an owner from git blame
+func (n *TodoNode) attribute(logger *slog.Logger, dir string, todos []Todo) {
+	blame := n.Blame
+	if blame == nil {
+		blame = gitBlame
+	}
+	authors := make(map[string]map[int]string)
+	for i, todo := range todos {
+		if todo.Author != "" {
+			continue
+		}
+		lines, ok := authors[todo.File]
+		if !ok {
+			var err error
+			if lines, err = blame(dir, todo.File); err != nil {
+				logger.Debug("git blame failed, the authors are unknown", "file", todo.File, "error", err)
+			}
+			authors[todo.File] = lines
+		}
+		todos[i].Author = lines[todo.Line]
+	}
+}
+
+// TodoGroup is the markers of a file or an author
+type TodoGroup struct {
+	Name  string
+	Todos []Todo
+}
+
+// groupTodos groups todos by key, largest group first; the markers of unknown authors come last
+func groupTodos(todos []Todo, key func(Todo) string) []TodoGroup {
+	byKey := make(map[string]*TodoGroup)
+	var groups []*TodoGroup
+	for _, todo := range todos {
+		k := key(todo)
+		g := byKey[k]
+		if g == nil {
+			g = &TodoGroup{Name: k}
+			byKey[k] = g
+			groups = append(groups, g)
+		}
+		g.Todos = append(g.Todos, todo)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i].Name == "") != (groups[j].Name == "") {
+			return groups[j].Name == ""
+		}
+		return len(groups[i].Todos) > len(groups[j].Todos)
+	})
+	result := make([]TodoGroup, len(groups))
+	for i, g := range groups {
+		if g.Name == "" {
+			g.Name = "unknown"
+		}
+		result[i] = *g
+	}
+	return result
+}
+
+// FindTodos returns the markers of the text files below dir, skipping hidden directories and
+// dependencies, ordered by file and line; the file paths are relative to dir
+func FindTodos(dir string) ([]Todo, error) {
+	var todos []Todo
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip what cannot be read
+		}
+		if path != dir && (strings.HasPrefix(d.Name(), ".") || d.IsDir() && todoSkippedDirs[d.Name()]) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !isTextFile(d.Name()) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxTodoFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		todos = append(todos, scanTodos(filepath.ToSlash(rel), data)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for TODO comments: %v", err)
+	}
+	return todos, nil
+}
+
+// scanTodos returns the markers of the content of a file
+func scanTodos(file string, data []byte) []Todo {
+	var todos []Todo
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxTodoFileSize)
+	for line := 1; scanner.Scan(); line++ {
+		match := todoPattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		text := strings.TrimSpace(match[3])
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(text, "*/"), "-->"))
+		todos = append(todos, Todo{File: file, Line: line, Marker: match[1], Text: text, Author: strings.TrimSpace(match[2])})
+	}
+	return todos
+}
+
+// gitBlame returns the authors of the lines of a file of the git repository at dir
+func gitBlame(dir, file string) (map[int]string, error) {
+	cmd := exec.Command("git", "-C", dir, "blame", "--line-porcelain", "--", file)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseBlame(output), nil
+}
+
+// parseBlame reads the authors of the lines from the output of git blame --line-porcelain:
+// every line starts with a header "<sha> <original line> <final line>", followed by fields
+// such as "author <name>" and the line itself after a tab
+func parseBlame(output []byte) map[int]string {
+	authors := make(map[int]string)
+	line := 0
+	for _, row := range strings.Split(string(output), "\n") {
+		switch {
+		case strings.HasPrefix(row, "\t"):
+			line = 0
+		case line == 0:
+			fields := strings.Fields(row)
+			if len(fields) >= 3 {
+				line, _ = strconv.Atoi(fields[2])
+			}
+		case strings.HasPrefix(row, "author "):
+			// Lines changed in the working tree have no author yet
+			if author := strings.TrimPrefix(row, "author "); author != "Not Committed Yet" {
+				authors[line] = author
+			}
+		}
+	}
+	return authors
+}
+
+func (n *TodoNode) Type() NodeType {
+	return NodeTypeTodo
+}
+
+// Describe implements the Describer interface for TodoNode
+func (n *TodoNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeTodo,
+		Description: "collects the TODO, FIXME and HACK comments of the working directory by file and author and prioritizes them",
+		Examples:    []string{"what's left to do here?"},
+	}
+}
@@ -0,0 +1,106 @@
+package nodes
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTodoFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestFindTodos(t *testing.T) {
+	dir := t.TempDir()
+	writeTodoFile(t, filepath.Join(dir, "main.go"), "package main\n\n// TODO(alice): handle the error of Close\nfunc main() {\n\tx := \"TODO in a string\" // FIXME: panics on nil\n}\n")
+	writeTodoFile(t, filepath.Join(dir, "deploy", "run.sh"), "#!/bin/sh\n# HACK wait for the database\nsleep 5\n")
+	writeTodoFile(t, filepath.Join(dir, "index.html"), "<!-- TODO: add a footer -->\n")
+	writeTodoFile(t, filepath.Join(dir, "vendor", "lib.go"), "// TODO: not ours\n")
+	writeTodoFile(t, filepath.Join(dir, ".git", "HEAD.md"), "// TODO: hidden\n")
+
+	todos, err := FindTodos(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []Todo{
+		{File: "deploy/run.sh", Line: 2, Marker: "HACK", Text: "wait for the database"},
+		{File: "index.html", Line: 1, Marker: "TODO", Text: "add a footer"},
+		{File: "main.go", Line: 3, Marker: "TODO", Text: "handle the error of Close", Author: "alice"},
+		{File: "main.go", Line: 5, Marker: "FIXME", Text: "panics on nil"},
+	}, todos)
+}
+
+func TestTodoNode(t *testing.T) {
+	dir := t.TempDir()
+	writeTodoFile(t, filepath.Join(dir, "main.go"), "package main\n\n// TODO(alice): handle the error of Close\n// FIXME: panics on nil\n")
+	writeTodoFile(t, filepath.Join(dir, "client.go"), "package main\n\n// HACK: retry twice\n")
+
+	llm := NewScriptedLLM()
+	llm.OnContains("from its TODO, FIXME and HACK comments").Respond("1. Fix the nil panic in main.go:4 (bob)")
+	node := NewTodoNode(llm)
+	node.Blame = func(dir, file string) (map[int]string, error) {
+		if file == "client.go" {
+			return nil, errors.New("not a git repository")
+		}
+		return map[int]string{3: "carol", 4: "bob"}, nil
+	}
+	state := &State{WorkingDirectory: dir, CurrentTask: TaskStatus{NodeType: NodeTypeTodo, Goal: "what's left to do?"}}
+
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, "1. Fix the nil panic in main.go:4 (bob)", state.GetRawOutput())
+	assert.Equal(t, "1. Fix the nil panic in main.go:4 (bob)", state.GetFinalResult())
+	prompt := llm.Calls()[0]
+	assert.Contains(t, prompt, "3 comments found.")
+	assert.Contains(t, prompt, "main.go:\n- main.go:3 TODO (alice): handle the error of Close\n- main.go:4 FIXME (bob): panics on nil\n")
+	assert.Contains(t, prompt, "client.go:\n- client.go:3 HACK (unknown): retry twice\n")
+	assert.Contains(t, prompt, "- alice: 1\n- bob: 1\n- unknown: 1\n", "the owner in the marker wins over git blame")
+
+	// Markers beyond the maximum are dropped, but counted
+	node.MaxTodos = 1
+	require.NoError(t, node.Process(state))
+	assert.Contains(t, llm.Calls()[1], "3 comments found, the first 1 are listed.")
+
+	empty := &State{WorkingDirectory: t.TempDir()}
+	require.NoError(t, node.Process(empty))
+	assert.Equal(t, "No TODO, FIXME or HACK comments found.", empty.GetFinalResult())
+	assert.Len(t, llm.Calls(), 2)
+}
+
+func TestParseBlame(t *testing.T) {
+	output := "4e1b0f6d8a7c3e2b1a0f9e8d7c6b5a4f3e2d1c0b 1 1 2\n" +
+		"author Alice Smith\nauthor-mail <alice@example.com>\nsummary first\nfilename main.go\n\tpackage main\n" +
+		"4e1b0f6d8a7c3e2b1a0f9e8d7c6b5a4f3e2d1c0b 2 2\n" +
+		"author Alice Smith\nsummary first\nfilename main.go\n\t\n" +
+		"0000000000000000000000000000000000000000 3 3 1\n" +
+		"author Not Committed Yet\nfilename main.go\n\t// TODO: new\n"
+	assert.Equal(t, map[int]string{1: "Alice Smith", 2: "Alice Smith"}, parseBlame([]byte(output)))
+}
+
+func TestGitBlame(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	writeTodoFile(t, filepath.Join(dir, "main.go"), "package main\n// TODO: test\n")
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "main.go"},
+		{"-c", "user.name=Dana", "-c", "user.email=dana@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	authors, err := gitBlame(dir, "main.go")
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{1: "Dana", 2: "Dana"}, authors)
+
+	_, err = gitBlame(t.TempDir(), "main.go")
+	assert.Error(t, err)
+}
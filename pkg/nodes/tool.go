@@ -0,0 +1,111 @@
+package nodes
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"aiagent/pkg/prompts"
+)
+
+// Tool is an external tool the tool node can call
+type Tool struct {
+	// Name identifies the tool, e.g. <server>.<tool> for MCP tools
+	Name string
+
+	// Description tells the LLM what the tool does
+	Description string
+
+	// InputSchema is the JSON schema of the arguments
+	InputSchema string
+
+	// Call runs the tool with JSON arguments and returns its text output
+	Call func(arguments json.RawMessage) (string, error)
+}
+
+// ToolNode lets the LLM choose one of the external tools and its arguments, then calls it
+type ToolNode struct {
+	llm   LLM
+	tools []Tool
+}
+
+// NewToolNode creates a new tool node calling tools
+func NewToolNode(llm LLM, tools []Tool) *ToolNode {
+	return &ToolNode{
+		llm:   llm,
+		tools: tools,
+	}
+}
+
+// Process implements the Node interface for ToolNode
+func (n *ToolNode) Process(state *State) error {
+	if len(n.tools) == 0 {
+		return fmt.Errorf("%w: no external tools are configured", ErrParse)
+	}
+
+	prompt, err := state.RenderPrompt(prompts.ToolCall, prompts.Vars{
+		"Goal":  state.GetCurrentTask().Goal,
+		"Input": state.GetInput(),
+		"Tools": n.tools,
+	})
+	if err != nil {
+		return err
+	}
+
+	response, err := n.llm.Complete(prompt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+
+	var result struct {
+		Tool        string          `json:"tool"`
+		Arguments   json.RawMessage `json:"arguments"`
+		Explanation string          `json:"explanation"`
+	}
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return fmt.Errorf("%w: %v", ErrParse, err)
+	}
+
+	tool, ok := n.find(result.Tool)
+	if !ok {
+		return fmt.Errorf("%w: unknown tool: %s", ErrParse, result.Tool)
+	}
+	if len(result.Arguments) == 0 || string(result.Arguments) == "null" {
+		result.Arguments = json.RawMessage("{}")
+	}
+
+	logger := state.NodeLogger(NodeTypeTool)
+	logger.Debug("calling tool", "tool", tool.Name, "arguments", string(result.Arguments))
+	output, err := tool.Call(result.Arguments)
+	if err != nil {
+		logger.Warn("tool failed", "tool", tool.Name, "error", err)
+		return fmt.Errorf("%w: tool %s: %v", ErrCommandFailed, tool.Name, err)
+	}
+
+	state.SetRawOutput(output)
+	state.SetNextNode(NodeTypeClassifier)
+	return nil
+}
+
+func (n *ToolNode) find(name string) (Tool, bool) {
+	for _, tool := range n.tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return Tool{}, false
+}
+
+func (n *ToolNode) Type() NodeType {
+	return NodeTypeTool
+}
+
+// Describe implements the Describer interface for ToolNode; without tools it is left out
+func (n *ToolNode) Describe() NodeInfo {
+	if len(n.tools) == 0 {
+		return NodeInfo{}
+	}
+	return NodeInfo{
+		Type:        NodeTypeTool,
+		Description: "calls one of the external tools listed below",
+	}
+}
@@ -0,0 +1,53 @@
+package nodes
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToolNode(t *testing.T) {
+	var called json.RawMessage
+	tools := []Tool{
+		{Name: "files.read", Description: "reads a file", InputSchema: `{"type":"object"}`, Call: func(arguments json.RawMessage) (string, error) {
+			called = arguments
+			return "file content", nil
+		}},
+		{Name: "db.query", Description: "runs a query", Call: func(arguments json.RawMessage) (string, error) {
+			return "", errors.New("database is down")
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		output   string
+		kind     error
+	}{
+		{"call", `{"tool": "files.read", "arguments": {"path": "go.mod"}, "explanation": "read it"}`, "file content", nil},
+		{"unknown tool", `{"tool": "files.write", "arguments": {}}`, "", ErrParse},
+		{"failing tool", `{"tool": "db.query", "arguments": {"sql": "select 1"}}`, "", ErrCommandFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := NewScriptedLLM()
+			llm.OnContains("- files.read: reads a file").Respond(tt.response)
+			state := &State{Input: "show go.mod", CurrentTask: TaskStatus{NodeType: NodeTypeTool, Goal: "read go.mod"}}
+
+			err := NewToolNode(llm, tools).Process(state)
+			if tt.kind != nil {
+				assert.ErrorIs(t, err, tt.kind)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.output, state.GetRawOutput())
+			assert.Equal(t, NodeTypeClassifier, state.GetNextNode())
+			assert.JSONEq(t, `{"path": "go.mod"}`, string(called))
+		})
+	}
+
+	err := NewToolNode(NewScriptedLLM(), nil).Process(&State{})
+	assert.ErrorIs(t, err, ErrParse, "without tools the tool node cannot run")
+}
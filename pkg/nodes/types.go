@@ -1,7 +1,14 @@
 package nodes
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/prompts"
 )
 
 // NodeType represents the type of a node in the langgraph
@@ -21,6 +28,36 @@ const (
 	NodeTypeDirectResponse    NodeType = "direct_response"
 	NodeTypeCodeAnalyzer      NodeType = "code_analyzer"
 	NodeTypeCodeFixer         NodeType = "code_fixer"
+
+	// NodeTypeTool calls the external tools
+	NodeTypeTool NodeType = "tool"
+
+	// NodeTypeIssue files issues in the configured issue tracker
+	NodeTypeIssue NodeType = "issue"
+
+	// NodeTypeClarification asks the user what a request the classifier is unsure about means
+	NodeTypeClarification NodeType = "clarification"
+
+	// NodeTypeTodo collects and prioritizes the TODO comments of the working directory
+	NodeTypeTodo NodeType = "todo"
+
+	// NodeTypeVulnerabilities looks up the known vulnerabilities of the dependencies of the
+	// working directory
+	NodeTypeVulnerabilities NodeType = "vulnerabilities"
+
+	// NodeTypeCoverage measures the test coverage of the Go module in the working directory
+	NodeTypeCoverage NodeType = "coverage"
+
+	// NodeTypeChanges summarizes the recent commits of the git repository in the working
+	// directory
+	NodeTypeChanges NodeType = "changes"
+
+	// NodeTypePlanner splits a request into the tasks of the orchestration mode
+	NodeTypePlanner NodeType = "planner"
+
+	// NodeTypeCritic reviews the result of a task of the orchestration mode before it is
+	// accepted
+	NodeTypeCritic NodeType = "critic"
 )
 
 // FileContent represents a file with its content
@@ -29,6 +66,10 @@ type FileContent struct {
 	Content string
 	Size    int64
 	IsDir   bool
+
+	// Readable is set for the text files whose content is read on demand with
+	// State.LoadFileContent; Content stays empty until then
+	Readable bool
 }
 
 // TaskStatus represents the status of a task
@@ -37,6 +78,10 @@ type TaskStatus struct {
 	Goal        string   `json:"goal"`
 	IsCompleted bool     `json:"is_completed"`
 	Result      string   `json:"result"`
+
+	// Command is the command a routing rule chose for the task; the bash node runs it
+	// without asking the LLM
+	Command string `json:"command,omitempty"`
 }
 
 // String returns a string representation of TaskStatus
@@ -44,14 +89,52 @@ func (t TaskStatus) String() string {
 	return fmt.Sprintf("{NodeType:%s Goal:%s IsCompleted:%v Result:%s}", t.NodeType, t.Goal, t.IsCompleted, t.Result)
 }
 
+// StateLimits caps the size of the state fields that grow during a run
+// A value of zero disables the corresponding limit
+type StateLimits struct {
+	// MaxRawOutputBytes is the maximum size of RawOutput; the oldest output is dropped first
+	MaxRawOutputBytes int
+
+	// MaxDirectoryEntries is the maximum number of entries kept in DirectoryContents
+	MaxDirectoryEntries int
+
+	// MaxTaskHistory is the maximum number of tasks kept in TaskHistory;
+	// the oldest tasks are evicted into EvictedHistorySummary
+	MaxTaskHistory int
+
+	// HistorySummaryBatch is the number of evicted tasks after which the classifier
+	// asks the LLM to condense EvictedHistorySummary
+	HistorySummaryBatch int
+
+	// MaxFileCacheBytes is the maximum size of the file contents kept in memory; the contents
+	// loaded beyond it are spilled to temporary files
+	MaxFileCacheBytes int64
+
+	// MaxPromptContentBytes is the maximum size of the file contents sent in one prompt; larger
+	// contents are packed into several prompts. Zero sends them in one prompt
+	MaxPromptContentBytes int
+}
+
 // State represents the shared state that is passed between nodes in the langgraph
+//
+// The exported fields may be set directly while building a State, before it is
+// shared. Once the graph is running, nodes must go through the accessor methods
+// (see state.go), which serialize access so nodes can run concurrently
 type State struct {
+	mu sync.RWMutex
+
+	// RunID identifies the run in logs, events, audit entries, transcripts and reports
+	RunID string
+
 	// Input is the original user input to the system
 	Input string
 
 	// Command is the bash command that has been generated
 	Command string
 
+	// CommandReviewer names the person who reviewed Command, if it was reviewed
+	CommandReviewer string
+
 	// NextNode determines which node should process the state next
 	NextNode NodeType
 
@@ -61,18 +144,65 @@ type State struct {
 	// RawOutput contains the unformatted command output before formatting
 	RawOutput string
 
-	// Verbose determines whether to show detailed processing information
-	Verbose bool
+	// Verbosity is the number of -v flags given; nodes use it to decide how much detail to show
+	Verbosity int
 
 	// WorkingDirectory contains the current working directory path
 	WorkingDirectory string
 
+	// ConversationContext contains a summary of previous runs used for follow-up requests
+	ConversationContext string
+
+	// Language is the language the answers are written in; empty leaves it to the prompts,
+	// which are written in English
+	Language string
+
 	// Task tracking fields
 	CurrentTask TaskStatus   `json:"current_task"` // Current task being processed
 	TaskHistory []TaskStatus `json:"task_history"` // History of completed tasks
 	GlobalGoal  string       `json:"global_goal"`  // Overall goal to be achieved
 	IsGoalMet   bool         `json:"is_goal_met"`  // Whether the global goal has been met
 
+	// EvictedHistorySummary summarizes the tasks evicted from TaskHistory because of Limits
+	EvictedHistorySummary string `json:"evicted_history_summary,omitempty"`
+
+	// Plan holds the tasks a compound request was split into, run in order; their results
+	// make up the final answer
+	Plan []TaskStatus `json:"plan,omitempty"`
+
+	// evictedSinceSummary counts the tasks evicted since the LLM last condensed the summary
+	evictedSinceSummary int
+
+	// fileContents caches the contents read by LoadFileContent by path
+	fileContents map[string]string
+
+	// fileCacheBytes is the size of the contents in fileContents
+	fileCacheBytes int64
+
+	// spilledFiles maps the paths of the contents that did not fit in memory to the temporary
+	// files in spillDir holding them
+	spilledFiles map[string]string
+	spillDir     string
+
+	// Limits caps the size of the fields that grow during a run
+	Limits StateLimits `json:"-"`
+
+	// Context is canceled when the run is; nodes stop waiting for the LLM. Nil is never canceled
+	Context context.Context `json:"-"`
+
+	// Logger receives the log records of the nodes; nil discards them
+	Logger *slog.Logger `json:"-"`
+
+	// Events publishes the lifecycle events of the run; nil drops them
+	Events *events.Publisher `json:"-"`
+
+	// Prompts holds the prompt templates rendered by the nodes; nil uses the built-in templates
+	Prompts *prompts.Registry `json:"-"`
+
+	// ResultWriter receives the final result while it is generated, so it can be rendered
+	// before the run ends; nil only returns it at the end
+	ResultWriter io.Writer `json:"-"`
+
 	// AnalyticsFields contains fields used for analytics operations
 
 	// DirectoryContents contains the list of files and directories found during content collection
@@ -1,8 +1,10 @@
 package nodes
 
 import (
-	"encoding/json"
 	"fmt"
+
+	"aiagent/pkg/events"
+	"aiagent/pkg/prompts"
 )
 
 // ValidationNodeInterface defines the operations for a validation node
@@ -34,21 +36,18 @@ func NewValidationNode(llm LLM) *ValidationNode {
 // Process implements the Node interface for ValidationNode
 func (n *ValidationNode) Process(state *State) error {
 	// Validate the command output
-	prompt := fmt.Sprintf(`Validate the following command output:
-Command: %s
-Output: %s
-Task Goal: %s
-
-Return JSON response with:
-{
-    "is_valid": boolean,
-    "issues": ["issue1", "issue2"],
-    "explanation": "why the output is valid or not"
-}`, state.Command, state.RawOutput, state.CurrentTask.Goal)
+	prompt, err := state.RenderPrompt(prompts.ValidationValidate, prompts.Vars{
+		"Command": state.GetCommand(),
+		"Output":  state.GetRawOutput(),
+		"Goal":    state.GetCurrentTask().Goal,
+	})
+	if err != nil {
+		return err
+	}
 
 	response, err := n.llm.Complete(prompt)
 	if err != nil {
-		return fmt.Errorf("LLM error: %v", err)
+		return fmt.Errorf("%w: %w", ErrLLM, err)
 	}
 
 	var result struct {
@@ -56,9 +55,14 @@ Return JSON response with:
 		Issues      []string `json:"issues"`
 		Explanation string   `json:"explanation"`
 	}
-	if err := json.Unmarshal([]byte(response), &result); err != nil {
-		return fmt.Errorf("failed to parse validation response: %v", err)
+	if err := parseResponse(state, n.llm, response, &result); err != nil {
+		return fmt.Errorf("failed to parse validation response: %w", withKind(ErrParse, err))
 	}
+	choice := "valid"
+	if !result.IsValid {
+		choice = "invalid"
+	}
+	state.Publish(&events.Decision{Node: string(NodeTypeValidation), Kind: events.DecisionValidation, Choice: choice, Explanation: result.Explanation})
 
 	// Format validation result
 	var output string
@@ -71,11 +75,19 @@ Return JSON response with:
 		}
 	}
 
-	state.FinalResult = output
-	state.NextNode = NodeTypeTerminal
+	state.SetFinalResult(output)
+	state.SetNextNode(NodeTypeTerminal)
 	return nil
 }
 
 func (n *ValidationNode) Type() NodeType {
 	return NodeTypeValidation
 }
+
+// Describe implements the Describer interface for ValidationNode
+func (n *ValidationNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeValidation,
+		Description: "checks whether the output of the last command achieved the goal",
+	}
+}
@@ -0,0 +1,671 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"aiagent/pkg/prompts"
+)
+
+const (
+	// DefaultOSVURL is the OSV API the dependencies are looked up in
+	DefaultOSVURL = "https://api.osv.dev"
+
+	// osvTimeout limits every request to the OSV API
+	osvTimeout = 30 * time.Second
+
+	// govulncheckTimeout limits a govulncheck run, which builds the call graph of the module
+	govulncheckTimeout = 5 * time.Minute
+
+	// maxOSVDetails limits the vulnerabilities whose details are fetched from OSV
+	maxOSVDetails = 50
+
+	// sourceGovulncheck and sourceOSV name where a vulnerability was found
+	sourceGovulncheck = "govulncheck"
+	sourceOSV         = "OSV"
+)
+
+// Dependency is a dependency of the working directory at its exact version
+type Dependency struct {
+	// Ecosystem is the OSV ecosystem, Go or npm
+	Ecosystem string
+	Name      string
+	Version   string
+}
+
+// Vulnerability is a known vulnerability of a dependency
+type Vulnerability struct {
+	ID        string
+	Aliases   []string
+	Summary   string
+	Ecosystem string
+	Package   string
+	Version   string
+
+	// Fixed is the first version without the vulnerability, empty if there is none yet
+	Fixed string
+
+	// Source is govulncheck or OSV; only govulncheck knows whether the code calls the
+	// vulnerable function, see Called
+	Source string
+	Called bool
+}
+
+func (v Vulnerability) String() string {
+	var sb strings.Builder
+	sb.WriteString(v.ID)
+	if len(v.Aliases) > 0 {
+		fmt.Fprintf(&sb, " (%s)", strings.Join(v.Aliases, ", "))
+	}
+	fmt.Fprintf(&sb, " in %s %s %s", v.Ecosystem, v.Package, v.Version)
+	if v.Fixed != "" {
+		fmt.Fprintf(&sb, ", fixed in %s", v.Fixed)
+	} else {
+		sb.WriteString(", not fixed yet")
+	}
+	if v.Source == sourceGovulncheck {
+		if v.Called {
+			sb.WriteString(", called by the code")
+		} else {
+			sb.WriteString(", not called by the code")
+		}
+	}
+	if v.Summary != "" {
+		fmt.Fprintf(&sb, ": %s", v.Summary)
+	}
+	return sb.String()
+}
+
+// VulnerabilityNode looks up the known vulnerabilities of the dependencies of the working
+// directory and asks the LLM to explain them; the upgrade commands fixing them are suggested
+// but never run
+// The Go modules are checked with govulncheck if it is installed, which also tells whether
+// the code calls the vulnerable functions; the other dependencies, and the Go modules
+// without govulncheck, are looked up in the OSV database
+type VulnerabilityNode struct {
+	llm LLM
+
+	// Govulncheck runs govulncheck -json in dir; nil runs the installed govulncheck.
+	// An error wrapping exec.ErrNotFound falls back to OSV
+	Govulncheck func(dir string) ([]byte, error)
+
+	// Client calls the OSV API; nil uses the shared client
+	Client *http.Client
+
+	// OSVURL is the base URL of the OSV API; empty uses DefaultOSVURL
+	OSVURL string
+
+	// Offline refuses to run, as both govulncheck and OSV need the network
+	Offline bool
+}
+
+// NewVulnerabilityNode creates a new vulnerability node
+func NewVulnerabilityNode(llm LLM) *VulnerabilityNode {
+	return &VulnerabilityNode{llm: llm}
+}
+
+// Process implements the Node interface for VulnerabilityNode
+func (n *VulnerabilityNode) Process(state *State) error {
+	if n.Offline {
+		return fmt.Errorf("%w: the vulnerability databases cannot be reached", ErrOffline)
+	}
+	logger := state.NodeLogger(NodeTypeVulnerabilities)
+	dir := state.GetWorkingDirectory()
+	dependencies, err := ReadDependencies(dir)
+	if err != nil {
+		return err
+	}
+	if len(dependencies) == 0 {
+		result := "No dependencies found: there is no go.mod or package-lock.json in the working directory."
+		state.SetRawOutput(result)
+		state.SetFinalResult(result)
+		return nil
+	}
+
+	var vulnerabilities []Vulnerability
+	var sources []string
+	lookup := dependencies
+	if hasGo(dependencies) {
+		found, err := n.govulncheck(dir)
+		switch {
+		case errors.Is(err, exec.ErrNotFound):
+			logger.Info("govulncheck is not installed, looking up the Go modules in OSV")
+		case err != nil:
+			return err
+		default:
+			vulnerabilities = append(vulnerabilities, found...)
+			sources = append(sources, sourceGovulncheck)
+			lookup = withoutGo(dependencies)
+		}
+	}
+	if len(lookup) > 0 {
+		found, err := n.queryOSV(lookup)
+		if err != nil {
+			return err
+		}
+		vulnerabilities = append(vulnerabilities, found...)
+		sources = append(sources, sourceOSV)
+	}
+
+	if len(vulnerabilities) == 0 {
+		result := fmt.Sprintf("No known vulnerabilities found in %d dependencies (checked with %s).", len(dependencies), strings.Join(sources, " and "))
+		state.SetRawOutput(result)
+		state.SetFinalResult(result)
+		return nil
+	}
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		a, b := vulnerabilities[i], vulnerabilities[j]
+		if a.Called != b.Called {
+			return a.Called
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.ID < b.ID
+	})
+	upgrades := upgradeCommands(vulnerabilities)
+
+	prompt, err := state.RenderPrompt(prompts.VulnerabilitiesExplain, prompts.Vars{
+		"Goal":            state.GetCurrentTask().Goal,
+		"Sources":         strings.Join(sources, " and "),
+		"Dependencies":    len(dependencies),
+		"Vulnerabilities": vulnerabilities,
+		"Upgrades":        upgrades,
+	})
+	if err != nil {
+		return err
+	}
+	explanation, err := completeResult(state, n.llm, prompt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLLM, err)
+	}
+
+	// The commands are added as they are, so the LLM cannot change them
+	result := strings.TrimSpace(explanation)
+	if len(upgrades) > 0 {
+		suggestion := "\n\nSuggested upgrades (not run):\n\n```sh\n" + strings.Join(upgrades, "\n") + "\n```\n"
+		if w := state.GetResultWriter(); w != nil {
+			io.WriteString(w, suggestion)
+		}
+		result += suggestion
+	}
+	state.SetRawOutput(result)
+	state.SetFinalResult(result)
+	return nil
+}
+
+// govulncheck runs govulncheck in dir and returns the vulnerabilities it found
+func (n *VulnerabilityNode) govulncheck(dir string) ([]Vulnerability, error) {
+	run := n.Govulncheck
+	if run == nil {
+		run = runGovulncheck
+	}
+	output, err := run(dir)
+	if err != nil {
+		return nil, err
+	}
+	return parseGovulncheck(output)
+}
+
+// runGovulncheck runs the installed govulncheck on the packages of the module in dir
+func runGovulncheck(dir string) ([]byte, error) {
+	path, err := exec.LookPath("govulncheck")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), govulncheckTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "-json", "./...")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("govulncheck failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// govulncheckMessage is a message of the JSON stream of govulncheck; only the OSV entries
+// and the findings are used
+type govulncheckMessage struct {
+	OSV *struct {
+		ID      string   `json:"id"`
+		Summary string   `json:"summary"`
+		Aliases []string `json:"aliases"`
+	} `json:"osv"`
+	Finding *struct {
+		OSV          string `json:"osv"`
+		FixedVersion string `json:"fixed_version"`
+
+		// Trace starts at the vulnerable module, package and function; the package and the
+		// function are only set if the code imports or calls them
+		Trace []struct {
+			Module   string `json:"module"`
+			Version  string `json:"version"`
+			Package  string `json:"package"`
+			Function string `json:"function"`
+		} `json:"trace"`
+	} `json:"finding"`
+}
+
+// parseGovulncheck reads the vulnerabilities from the output of govulncheck -json, one for
+// each vulnerability and module
+func parseGovulncheck(output []byte) ([]Vulnerability, error) {
+	type entry struct {
+		summary string
+		aliases []string
+	}
+	entries := make(map[string]entry)
+	byKey := make(map[string]*Vulnerability)
+	var keys []string
+
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var message govulncheckMessage
+		if err := decoder.Decode(&message); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse the output of govulncheck: %v", ErrParse, err)
+		}
+		if message.OSV != nil {
+			entries[message.OSV.ID] = entry{summary: message.OSV.Summary, aliases: message.OSV.Aliases}
+		}
+		finding := message.Finding
+		if finding == nil || len(finding.Trace) == 0 {
+			continue
+		}
+		frame := finding.Trace[0]
+		key := finding.OSV + " " + frame.Module
+		v := byKey[key]
+		if v == nil {
+			v = &Vulnerability{
+				ID:        finding.OSV,
+				Ecosystem: "Go",
+				Package:   frame.Module,
+				Version:   frame.Version,
+				Fixed:     finding.FixedVersion,
+				Source:    sourceGovulncheck,
+			}
+			byKey[key] = v
+			keys = append(keys, key)
+		}
+		v.Called = v.Called || frame.Function != ""
+	}
+
+	vulnerabilities := make([]Vulnerability, 0, len(keys))
+	for _, key := range keys {
+		v := *byKey[key]
+		v.Summary = entries[v.ID].summary
+		v.Aliases = entries[v.ID].aliases
+		vulnerabilities = append(vulnerabilities, v)
+	}
+	return vulnerabilities, nil
+}
+
+// queryOSV looks up the dependencies in the OSV database
+func (n *VulnerabilityNode) queryOSV(dependencies []Dependency) ([]Vulnerability, error) {
+	type query struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Version string `json:"version"`
+	}
+	queries := make([]query, len(dependencies))
+	for i, d := range dependencies {
+		queries[i].Package.Name = d.Name
+		queries[i].Package.Ecosystem = d.Ecosystem
+		queries[i].Version = osvVersion(d)
+	}
+	var batch struct {
+		Results []struct {
+			Vulns []struct {
+				ID string `json:"id"`
+			} `json:"vulns"`
+		} `json:"results"`
+	}
+	if err := n.callOSV(http.MethodPost, "/v1/querybatch", map[string]any{"queries": queries}, &batch); err != nil {
+		return nil, err
+	}
+	if len(batch.Results) != len(dependencies) {
+		return nil, fmt.Errorf("%w: OSV returned %d results for %d dependencies", ErrParse, len(batch.Results), len(dependencies))
+	}
+
+	var vulnerabilities []Vulnerability
+	details := make(map[string]*osvVulnerability)
+	for i, result := range batch.Results {
+		d := dependencies[i]
+		for _, found := range result.Vulns {
+			v := Vulnerability{ID: found.ID, Ecosystem: d.Ecosystem, Package: d.Name, Version: d.Version, Source: sourceOSV}
+			osv, fetched := details[found.ID]
+			if !fetched && len(details) < maxOSVDetails {
+				osv = &osvVulnerability{}
+				if err := n.callOSV(http.MethodGet, "/v1/vulns/"+url.PathEscape(found.ID), nil, osv); err != nil {
+					return nil, err
+				}
+				details[found.ID] = osv
+			}
+			if osv != nil {
+				v.Summary = osv.Summary
+				v.Aliases = osv.Aliases
+				v.Fixed = osv.fixed(d)
+			}
+			vulnerabilities = append(vulnerabilities, v)
+		}
+	}
+	return vulnerabilities, nil
+}
+
+// callOSV sends a request to the OSV API and decodes its JSON response into result
+func (n *VulnerabilityNode) callOSV(method, path string, body any, result any) error {
+	base := n.OSVURL
+	if base == "" {
+		base = DefaultOSVURL
+	}
+	client := n.Client
+	if client == nil {
+		client = sharedHTTPClient
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), osvTimeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(base, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query OSV: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to query OSV: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("%w: failed to parse the OSV response: %v", ErrParse, err)
+	}
+	return nil
+}
+
+// osvVulnerability is the part of an OSV entry describing the vulnerability and the versions
+// fixing it
+type osvVulnerability struct {
+	Summary  string   `json:"summary"`
+	Aliases  []string `json:"aliases"`
+	Affected []struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Ranges []struct {
+			Events []struct {
+				Fixed string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+}
+
+// fixed returns the first version of the dependency fixing the vulnerability after its
+// current version, empty if there is none
+func (v *osvVulnerability) fixed(d Dependency) string {
+	current := osvVersion(d)
+	var first string
+	for _, affected := range v.Affected {
+		if affected.Package.Name != d.Name || affected.Package.Ecosystem != d.Ecosystem {
+			continue
+		}
+		for _, r := range affected.Ranges {
+			for _, event := range r.Events {
+				if event.Fixed == "" || compareVersions(event.Fixed, current) <= 0 {
+					continue
+				}
+				if first == "" || compareVersions(event.Fixed, first) < 0 {
+					first = event.Fixed
+				}
+			}
+		}
+	}
+	if first != "" && d.Ecosystem == "Go" {
+		first = "v" + first
+	}
+	return first
+}
+
+// osvVersion returns the version of a dependency as OSV expects it: Go versions have no v
+func osvVersion(d Dependency) string {
+	if d.Ecosystem == "Go" {
+		return strings.TrimPrefix(d.Version, "v")
+	}
+	return d.Version
+}
+
+// compareVersions compares two versions like 1.2.3 by their numeric parts, ignoring a v
+// prefix; a pre-release comes before its release
+func compareVersions(a, b string) int {
+	a, b = strings.TrimPrefix(a, "v"), strings.TrimPrefix(b, "v")
+	aRelease, aPre, _ := strings.Cut(a, "-")
+	bRelease, bPre, _ := strings.Cut(b, "-")
+	aParts, bParts := strings.Split(aRelease, "."), strings.Split(bRelease, ".")
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
+
+// upgradeCommands returns the commands upgrading the vulnerable dependencies to the first
+// version fixing all their vulnerabilities
+func upgradeCommands(vulnerabilities []Vulnerability) []string {
+	type upgrade struct{ ecosystem, name, version string }
+	var upgrades []*upgrade
+	byPackage := make(map[string]*upgrade)
+	for _, v := range vulnerabilities {
+		if v.Fixed == "" {
+			continue
+		}
+		key := v.Ecosystem + " " + v.Package
+		u := byPackage[key]
+		if u == nil {
+			u = &upgrade{ecosystem: v.Ecosystem, name: v.Package}
+			byPackage[key] = u
+			upgrades = append(upgrades, u)
+		}
+		if compareVersions(v.Fixed, u.version) > 0 {
+			u.version = v.Fixed
+		}
+	}
+
+	var commands []string
+	goModules := false
+	for _, u := range upgrades {
+		switch {
+		case u.ecosystem == "Go" && u.name == "stdlib":
+			// The standard library is fixed by a newer Go release
+			commands = append(commands, "go get toolchain@go"+strings.TrimPrefix(u.version, "v"))
+		case u.ecosystem == "Go":
+			commands = append(commands, fmt.Sprintf("go get %s@%s", u.name, u.version))
+			goModules = true
+		case u.ecosystem == "npm":
+			commands = append(commands, fmt.Sprintf("npm install %s@%s", u.name, u.version))
+		}
+	}
+	if goModules {
+		commands = append(commands, "go mod tidy")
+	}
+	return commands
+}
+
+// ReadDependencies returns the dependencies of the working directory at their exact
+// versions: the requirements of its go.mod and the packages of its package-lock.json
+func ReadDependencies(dir string) ([]Dependency, error) {
+	var dependencies []Dependency
+	if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		dependencies = append(dependencies, goModDependencies(data)...)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "package-lock.json")); err == nil {
+		npm, err := npmLockDependencies(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse package-lock.json: %v", err)
+		}
+		dependencies = append(dependencies, npm...)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return dependencies, nil
+}
+
+// goModDependencies returns the requirements of a go.mod
+func goModDependencies(data []byte) []Dependency {
+	var dependencies []Dependency
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		var text string
+		switch {
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case inBlock:
+			text = line
+		case line == "require (":
+			inBlock = true
+			continue
+		case strings.HasPrefix(line, "require "):
+			text = strings.TrimPrefix(line, "require ")
+		default:
+			continue
+		}
+		if fields := strings.Fields(text); len(fields) >= 2 && !strings.HasPrefix(text, "//") {
+			dependencies = append(dependencies, Dependency{Ecosystem: "Go", Name: fields[0], Version: fields[1]})
+		}
+	}
+	return dependencies
+}
+
+// npmLockDependencies returns the installed packages of a package-lock.json: the packages
+// of lockfile version 2 and 3, or the dependencies of version 1
+func npmLockDependencies(data []byte) ([]Dependency, error) {
+	var lock struct {
+		Packages map[string]struct {
+			Version string `json:"version"`
+			Link    bool   `json:"link"`
+		} `json:"packages"`
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var dependencies []Dependency
+	add := func(name, version string) {
+		if name == "" || version == "" || seen[name+"@"+version] {
+			return
+		}
+		seen[name+"@"+version] = true
+		dependencies = append(dependencies, Dependency{Ecosystem: "npm", Name: name, Version: version})
+	}
+	if len(lock.Packages) > 0 {
+		for path, pkg := range lock.Packages {
+			// The root package has an empty path, nested packages are under node_modules
+			i := strings.LastIndex(path, "node_modules/")
+			if i < 0 || pkg.Link {
+				continue
+			}
+			add(path[i+len("node_modules/"):], pkg.Version)
+		}
+	} else {
+		for name, dep := range lock.Dependencies {
+			add(name, dep.Version)
+		}
+	}
+	sort.Slice(dependencies, func(i, j int) bool {
+		if dependencies[i].Name != dependencies[j].Name {
+			return dependencies[i].Name < dependencies[j].Name
+		}
+		return dependencies[i].Version < dependencies[j].Version
+	})
+	return dependencies, nil
+}
+
+// hasGo reports whether some of the dependencies are Go modules
+func hasGo(dependencies []Dependency) bool {
+	for _, d := range dependencies {
+		if d.Ecosystem == "Go" {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutGo returns the dependencies that are not Go modules
+func withoutGo(dependencies []Dependency) []Dependency {
+	var others []Dependency
+	for _, d := range dependencies {
+		if d.Ecosystem != "Go" {
+			others = append(others, d)
+		}
+	}
+	return others
+}
+
+func (n *VulnerabilityNode) Type() NodeType {
+	return NodeTypeVulnerabilities
+}
+
+// Describe implements the Describer interface for VulnerabilityNode
+func (n *VulnerabilityNode) Describe() NodeInfo {
+	return NodeInfo{
+		Type:        NodeTypeVulnerabilities,
+		Description: "looks up the known vulnerabilities of the dependencies (go.mod, package-lock.json) with govulncheck and OSV and explains them with the upgrade commands fixing them",
+		Examples:    []string{"are there known vulnerabilities in my dependencies?"},
+	}
+}
@@ -0,0 +1,187 @@
+package nodes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// govulncheckOutput is the JSON stream of govulncheck for a module calling a vulnerable
+// function of golang.org/x/net and requiring a vulnerable golang.org/x/text it does not call
+const govulncheckOutput = `{"config": {"protocol_version": "v1.0.0", "scanner_name": "govulncheck"}}
+{"progress": {"message": "Scanning your code and 50 packages across 2 dependent modules for known vulnerabilities..."}}
+{"osv": {"id": "GO-2023-2102", "aliases": ["CVE-2023-39325"], "summary": "HTTP/2 rapid reset can cause excessive work in net/http"}}
+{"osv": {"id": "GO-2021-0113", "summary": "Out-of-bounds read in golang.org/x/text/language"}}
+{
+  "finding": {
+    "osv": "GO-2023-2102",
+    "fixed_version": "v0.17.0",
+    "trace": [{"module": "golang.org/x/net", "version": "v0.10.0", "package": "golang.org/x/net/http2", "function": "ServeConn"}, {"module": "example", "package": "example", "function": "main"}]
+  }
+}
+{"finding": {"osv": "GO-2023-2102", "fixed_version": "v0.17.0", "trace": [{"module": "golang.org/x/net", "version": "v0.10.0"}]}}
+{"finding": {"osv": "GO-2021-0113", "fixed_version": "v0.3.7", "trace": [{"module": "golang.org/x/text", "version": "v0.3.6"}]}}
+`
+
+func writeDependencies(t *testing.T, dir string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example\n\nrequire (\n\tgolang.org/x/net v0.10.0\n\tgolang.org/x/text v0.3.6 // indirect\n)\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "package-lock.json"), []byte(`{
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "web"},
+    "node_modules/lodash": {"version": "4.17.15"},
+    "node_modules/express/node_modules/qs": {"version": "6.5.2"},
+    "node_modules/local": {"link": true}
+  }
+}`), 0644))
+}
+
+// osvServer answers the batch queries and the details of the vulnerabilities like the OSV API
+func osvServer(t *testing.T, queried *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/querybatch":
+			var batch struct {
+				Queries []struct {
+					Package struct{ Name, Ecosystem string }
+					Version string
+				}
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+			var results []string
+			for _, q := range batch.Queries {
+				*queried = append(*queried, fmt.Sprintf("%s %s@%s", q.Package.Ecosystem, q.Package.Name, q.Version))
+				switch q.Package.Name {
+				case "lodash":
+					results = append(results, `{"vulns": [{"id": "GHSA-p6mc-m468-83gw"}, {"id": "GHSA-35jh-r3h4-6jhm"}]}`)
+				case "golang.org/x/text":
+					results = append(results, `{"vulns": [{"id": "GO-2021-0113"}]}`)
+				default:
+					results = append(results, `{}`)
+				}
+			}
+			fmt.Fprintf(w, `{"results": [%s]}`, strings.Join(results, ","))
+		case r.URL.Path == "/v1/vulns/GHSA-p6mc-m468-83gw":
+			fmt.Fprint(w, `{"summary": "Prototype pollution in lodash", "aliases": ["CVE-2020-8203"],
+				"affected": [{"package": {"name": "lodash", "ecosystem": "npm"}, "ranges": [{"events": [{"introduced": "0"}, {"fixed": "4.17.19"}]}]}]}`)
+		case r.URL.Path == "/v1/vulns/GHSA-35jh-r3h4-6jhm":
+			fmt.Fprint(w, `{"summary": "Command injection in lodash",
+				"affected": [{"package": {"name": "lodash", "ecosystem": "npm"}, "ranges": [{"events": [{"introduced": "0"}, {"fixed": "4.17.21"}]}]}]}`)
+		case r.URL.Path == "/v1/vulns/GO-2021-0113":
+			fmt.Fprint(w, `{"summary": "Out-of-bounds read in golang.org/x/text/language",
+				"affected": [{"package": {"name": "golang.org/x/text", "ecosystem": "Go"}, "ranges": [{"events": [{"introduced": "0"}, {"fixed": "0.3.7"}]}]}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestVulnerabilityNode_Govulncheck(t *testing.T) {
+	dir := t.TempDir()
+	writeDependencies(t, dir)
+	var queried []string
+	server := osvServer(t, &queried)
+	defer server.Close()
+
+	llm := NewScriptedLLM()
+	llm.OnContains("known vulnerabilities found in the dependencies").Respond("Upgrade golang.org/x/net first: the server is exposed to HTTP/2 rapid reset.\n")
+	node := NewVulnerabilityNode(llm)
+	node.OSVURL = server.URL
+	node.Govulncheck = func(string) ([]byte, error) { return []byte(govulncheckOutput), nil }
+	state := &State{WorkingDirectory: dir, CurrentTask: TaskStatus{NodeType: NodeTypeVulnerabilities, Goal: "are there known vulnerabilities in my dependencies?"}}
+
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, []string{"npm lodash@4.17.15", "npm qs@6.5.2"}, queried, "the Go modules are checked by govulncheck")
+
+	prompt := llm.Calls()[0]
+	assert.Contains(t, prompt, "4 vulnerabilities found in 4 dependencies, checked with govulncheck and OSV:\n"+
+		"- GO-2023-2102 (CVE-2023-39325) in Go golang.org/x/net v0.10.0, fixed in v0.17.0, called by the code: HTTP/2 rapid reset can cause excessive work in net/http\n"+
+		"- GO-2021-0113 in Go golang.org/x/text v0.3.6, fixed in v0.3.7, not called by the code: Out-of-bounds read in golang.org/x/text/language\n"+
+		"- GHSA-35jh-r3h4-6jhm in npm lodash 4.17.15, fixed in 4.17.21: Command injection in lodash\n"+
+		"- GHSA-p6mc-m468-83gw (CVE-2020-8203) in npm lodash 4.17.15, fixed in 4.17.19: Prototype pollution in lodash\n")
+
+	want := "Upgrade golang.org/x/net first: the server is exposed to HTTP/2 rapid reset.\n\n" +
+		"Suggested upgrades (not run):\n\n```sh\n" +
+		"go get golang.org/x/net@v0.17.0\ngo get golang.org/x/text@v0.3.7\nnpm install lodash@4.17.21\ngo mod tidy\n```\n"
+	assert.Equal(t, want, state.GetRawOutput())
+	assert.Equal(t, want, state.GetFinalResult())
+}
+
+func TestVulnerabilityNode_OSV(t *testing.T) {
+	dir := t.TempDir()
+	writeDependencies(t, dir)
+	var queried []string
+	server := osvServer(t, &queried)
+	defer server.Close()
+
+	llm := NewScriptedLLM()
+	llm.OnContains("checked with OSV").Respond("Two lodash vulnerabilities and one in golang.org/x/text.")
+	node := NewVulnerabilityNode(llm)
+	node.OSVURL = server.URL
+	node.Govulncheck = func(string) ([]byte, error) { return nil, fmt.Errorf("govulncheck: %w", exec.ErrNotFound) }
+	state := &State{WorkingDirectory: dir, CurrentTask: TaskStatus{NodeType: NodeTypeVulnerabilities, Goal: "any CVEs?"}}
+
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, []string{"Go golang.org/x/net@0.10.0", "Go golang.org/x/text@0.3.6", "npm lodash@4.17.15", "npm qs@6.5.2"}, queried)
+	assert.Contains(t, llm.Calls()[0], "- GO-2021-0113 in Go golang.org/x/text v0.3.6, fixed in v0.3.7: Out-of-bounds read")
+	assert.Contains(t, state.GetRawOutput(), "```sh\ngo get golang.org/x/text@v0.3.7\nnpm install lodash@4.17.21\ngo mod tidy\n```\n")
+}
+
+func TestVulnerabilityNode_NoVulnerabilities(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example\n\nrequire golang.org/x/sync v0.7.0\n"), 0644))
+
+	llm := NewScriptedLLM()
+	node := NewVulnerabilityNode(llm)
+	node.Govulncheck = func(string) ([]byte, error) {
+		return []byte(`{"config": {"scanner_name": "govulncheck"}}`), nil
+	}
+	state := &State{WorkingDirectory: dir}
+	require.NoError(t, node.Process(state))
+	assert.Equal(t, "No known vulnerabilities found in 1 dependencies (checked with govulncheck).", state.GetFinalResult())
+	assert.Empty(t, llm.Calls(), "the LLM has nothing to explain")
+
+	state = &State{WorkingDirectory: t.TempDir()}
+	require.NoError(t, node.Process(state))
+	assert.Contains(t, state.GetFinalResult(), "No dependencies found")
+}
+
+func TestVulnerabilityNode_Errors(t *testing.T) {
+	dir := t.TempDir()
+	writeDependencies(t, dir)
+
+	node := NewVulnerabilityNode(NewScriptedLLM())
+	node.Offline = true
+	assert.ErrorIs(t, node.Process(&State{WorkingDirectory: dir}), ErrOffline)
+
+	node = NewVulnerabilityNode(NewScriptedLLM())
+	node.Govulncheck = func(string) ([]byte, error) { return nil, errors.New("govulncheck failed: no Go files") }
+	assert.EqualError(t, node.Process(&State{WorkingDirectory: dir}), "govulncheck failed: no Go files")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	node.Govulncheck = func(string) ([]byte, error) { return []byte(govulncheckOutput), nil }
+	node.OSVURL = server.URL
+	assert.ErrorContains(t, node.Process(&State{WorkingDirectory: dir}), "failed to query OSV: 503 Service Unavailable: overloaded")
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, -1, compareVersions("v0.9.0", "v0.17.0"))
+	assert.Equal(t, 1, compareVersions("4.17.21", "4.17.19"))
+	assert.Equal(t, 0, compareVersions("v1.2", "1.2.0"))
+	assert.Equal(t, -1, compareVersions("1.0.0-rc.1", "1.0.0"))
+	assert.Equal(t, 1, compareVersions("1.0.0", ""))
+}
@@ -0,0 +1,203 @@
+package pii
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of personal data
+const (
+	KindEmail      = "email"
+	KindPhone      = "phone"
+	KindNationalID = "national_id"
+	KindCreditCard = "credit_card"
+)
+
+// Modes of handling personal data found in prompts
+const (
+	// ModeOff sends prompts unchanged without scanning them
+	ModeOff = "off"
+
+	// ModeWarn sends prompts unchanged and logs a warning with the kinds found
+	ModeWarn = "warn"
+
+	// ModeRedact replaces the personal data with a placeholder of its kind, e.g. [EMAIL]
+	ModeRedact = "redact"
+
+	// ModeBlock fails the LLM call
+	ModeBlock = "block"
+)
+
+// ErrBlocked is returned when a prompt with personal data is not sent
+var ErrBlocked = errors.New("personal data found")
+
+// detector finds one kind of personal data; valid, if set, rejects false positives
+type detector struct {
+	kind    string
+	pattern *regexp.Regexp
+	valid   func(match string) bool
+}
+
+// detectors lists the personal data found by the scanner
+// The patterns are conservative: digits are only reported in the formats of phone numbers,
+// IDs and card numbers, so hashes, timestamps and versions are not mistaken for them
+var detectors = []detector{
+	{
+		kind:    KindEmail,
+		pattern: regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*\.[a-zA-Z]{2,}`),
+	},
+	{
+		kind:    KindCreditCard,
+		pattern: regexp.MustCompile(`\b[3-6]\d{3}(?:[ -]?\d{4}){2}[ -]?\d{1,7}\b`),
+		valid:   luhn,
+	},
+	{
+		// US social security numbers and UK national insurance numbers
+		kind:    KindNationalID,
+		pattern: regexp.MustCompile(`\b(?:\d{3}-\d{2}-\d{4}|[A-CEGHJ-PR-TW-Z]{2} ?\d{2} ?\d{2} ?\d{2} ?[A-D])\b`),
+		valid:   validNationalID,
+	},
+	{
+		// International numbers and North American numbers with separators
+		kind:    KindPhone,
+		pattern: regexp.MustCompile(`(?:\+[1-9]\d{0,2}[ .-]?(?:\(\d{1,4}\)[ .-]?)?\d{1,4}(?:[ .-]?\d{2,4}){2,4}|\(\d{3}\) ?\d{3}[ .-]\d{4}|\b\d{3}[.-]\d{3}[.-]\d{4})\b`),
+		valid: func(match string) bool {
+			n := len(digits(match))
+			return n >= 10 && n <= 15
+		},
+	},
+}
+
+// Kinds returns the kinds of personal data the scanner can find
+func Kinds() []string {
+	kinds := make([]string, len(detectors))
+	for i, d := range detectors {
+		kinds[i] = d.kind
+	}
+	return kinds
+}
+
+// Finding is personal data found in a text
+type Finding struct {
+	Kind  string
+	Value string
+}
+
+// Scanner finds personal data in text
+type Scanner struct {
+	detectors []detector
+
+	// Allowed is text whose personal data is not reported, e.g. the request the user wrote
+	Allowed string
+}
+
+// NewScanner creates a scanner finding the given kinds; no kinds finds all of them
+func NewScanner(kinds []string) (*Scanner, error) {
+	if len(kinds) == 0 {
+		return &Scanner{detectors: detectors}, nil
+	}
+	s := &Scanner{}
+	for _, kind := range kinds {
+		found := false
+		for _, d := range detectors {
+			if d.kind == kind {
+				s.detectors = append(s.detectors, d)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown kind of personal data %q (supported: %s)", kind, strings.Join(Kinds(), ", "))
+		}
+	}
+	return s, nil
+}
+
+// Scan returns the personal data in text
+func (s *Scanner) Scan(text string) []Finding {
+	_, findings := s.Redact(text)
+	return findings
+}
+
+// Redact replaces the personal data in text with a placeholder of its kind, e.g. [EMAIL],
+// and returns what was replaced
+// Every detector scans the text redacted by the ones before it, so the digits of a card
+// number are not reported as a phone number as well
+func (s *Scanner) Redact(text string) (string, []Finding) {
+	var findings []Finding
+	for _, d := range s.detectors {
+		text = d.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if d.valid != nil && !d.valid(match) || s.Allowed != "" && strings.Contains(s.Allowed, match) {
+				return match
+			}
+			findings = append(findings, Finding{Kind: d.kind, Value: match})
+			return Placeholder(d.kind)
+		})
+	}
+	return text, findings
+}
+
+// Placeholder returns the text replacing personal data of a kind, e.g. [EMAIL]
+func Placeholder(kind string) string {
+	return "[" + strings.ToUpper(kind) + "]"
+}
+
+// Summary describes findings by kind without their values, e.g. "email (2), phone (1)"
+func Summary(findings []Finding) string {
+	counts := map[string]int{}
+	for _, f := range findings {
+		counts[f.Kind]++
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%s (%d)", kind, counts[kind])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// digits returns the digits of s
+func digits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// luhn reports whether the digits of a card number have a valid check digit
+func luhn(number string) bool {
+	d := digits(number)
+	if len(d) < 13 || len(d) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(d) - 1; i >= 0; i-- {
+		n := int(d[i] - '0')
+		if (len(d)-i)%2 == 0 {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	return sum%10 == 0
+}
+
+// validNationalID rejects social security numbers that are never issued
+func validNationalID(id string) bool {
+	if !strings.Contains(id, "-") {
+		return true
+	}
+	area, group, serial := id[0:3], id[4:6], id[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
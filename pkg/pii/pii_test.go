@@ -0,0 +1,67 @@
+package pii
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		kind string
+	}{
+		{"email", "author: Jane Doe <jane.doe@example.co.uk>", KindEmail},
+		{"international phone", "call +49 30 1234 5678 tomorrow", KindPhone},
+		{"us phone", "phone: (415) 555-0132", KindPhone},
+		{"dotted phone", "fax 415.555.0132", KindPhone},
+		{"ssn", "ssn=123-45-6789", KindNationalID},
+		{"nino", "NI number AB 12 34 56 C", KindNationalID},
+		{"card", "card 4111 1111 1111 1111 expires", KindCreditCard},
+		{"card without spaces", "pan=5500005555555559", KindCreditCard},
+	}
+	scanner, err := NewScanner(nil)
+	require.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := scanner.Scan(tt.text)
+			if assert.Len(t, findings, 1) {
+				assert.Equal(t, tt.kind, findings[0].Kind)
+			}
+		})
+	}
+}
+
+func TestScan_NoFalsePositives(t *testing.T) {
+	scanner, err := NewScanner(nil)
+	require.NoError(t, err)
+	for _, text := range []string{
+		"commit 3f786850e387550fdab836ed7e6dc881de23001b",
+		"2024-01-15T10:30:00Z started in 1234ms",
+		"go version go1.24.1 linux/amd64",
+		"card 4111 1111 1111 1112",   // invalid check digit
+		"ssn 000-12-3456",            // never issued
+		"unix time 1718000000000",    // not a card prefix
+		"listening on 192.168.10.25", // an IP address
+	} {
+		assert.Empty(t, scanner.Scan(text), text)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	scanner, err := NewScanner([]string{KindEmail, KindCreditCard})
+	require.NoError(t, err)
+
+	redacted, findings := scanner.Redact("mail ops@example.com, pay 4111-1111-1111-1111, call +1 415 555 0132")
+	assert.Equal(t, "mail [EMAIL], pay [CREDIT_CARD], call +1 415 555 0132", redacted)
+	assert.Equal(t, "credit_card (1), email (1)", Summary(findings))
+
+	scanner.Allowed = "send it to ops@example.com"
+	redacted, _ = scanner.Redact("mail ops@example.com and dev@example.com")
+	assert.Equal(t, "mail ops@example.com and [EMAIL]", redacted)
+
+	_, err = NewScanner([]string{"passport"})
+	assert.EqualError(t, err, `unknown kind of personal data "passport" (supported: email, credit_card, national_id, phone)`)
+}
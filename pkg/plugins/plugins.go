@@ -0,0 +1,293 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of plugins
+const (
+	// KindTool is an external tool called by the tool node: the plugin reads the JSON
+	// arguments from standard input and writes its result to standard output
+	KindTool = "tool"
+
+	// KindMCP is an MCP server whose tools are called by the tool node, started like the
+	// mcp_servers of the config
+	KindMCP = "mcp"
+
+	// KindProvider is an LLM provider selected by the provider of the model: the plugin reads
+	// a JSON request with the model and the prompt from standard input and writes the
+	// response to standard output
+	KindProvider = "provider"
+)
+
+const (
+	// ManifestFlag is passed to an executable without a manifest file to print its manifest
+	ManifestFlag = "--manifest"
+
+	// describeTimeout limits an executable printing its manifest
+	describeTimeout = 5 * time.Second
+
+	// defaultTimeout limits a call of a plugin if its manifest sets no timeout
+	defaultTimeout = 60 * time.Second
+)
+
+// Plugin is an external node or LLM provider found in the plugins directory
+type Plugin struct {
+	// Name identifies the plugin; tools are named after it and providers are selected by it.
+	// It defaults to the name of the manifest or executable without its extension
+	Name string `yaml:"name"`
+
+	// Kind is tool, mcp or provider
+	Kind string `yaml:"kind"`
+
+	// Description tells the LLM what a tool does
+	Description string `yaml:"description"`
+
+	// Command is the executable of the plugin, relative to the plugins directory unless it
+	// is absolute or found in PATH; it defaults to the executable that printed the manifest
+	Command string `yaml:"command"`
+
+	// Args are the arguments of the command
+	Args []string `yaml:"args"`
+
+	// Env are additional environment variables of the command
+	Env map[string]string `yaml:"env"`
+
+	// InputSchema is the JSON schema of the arguments of a tool
+	InputSchema map[string]any `yaml:"input_schema"`
+
+	// Timeout limits a call of the plugin; zero uses one minute
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Path is the manifest or executable the plugin was found in
+	Path string `yaml:"-"`
+}
+
+// Discover returns the plugins of dir in the order of their file names, with the errors of
+// the files that do not describe a valid plugin; a missing directory has no plugins
+// A plugin is described by a manifest, <name>.yaml, or is an executable printing its
+// manifest when run with --manifest. An executable with a manifest of the same name is the
+// command of that manifest
+func Discover(dir string) ([]Plugin, []error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to read plugins directory: %v", err)}
+	}
+
+	manifests := map[string]bool{}
+	for _, entry := range entries {
+		if isManifest(entry.Name()) {
+			manifests[baseName(entry.Name())] = true
+		}
+	}
+
+	var plugins []Plugin
+	var errs []error
+	names := map[string]string{}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		var plugin Plugin
+		var err error
+		switch {
+		case entry.IsDir():
+			continue
+		case isManifest(entry.Name()):
+			plugin, err = readManifest(path)
+		case manifests[baseName(entry.Name())] || !isExecutable(entry):
+			continue
+		default:
+			plugin, err = describe(path)
+		}
+		if err == nil {
+			err = plugin.validate()
+		}
+		if err == nil && names[plugin.Name] != "" {
+			err = fmt.Errorf("plugin %s is already defined in %s", plugin.Name, names[plugin.Name])
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", path, err))
+			continue
+		}
+		names[plugin.Name] = path
+		plugins = append(plugins, plugin)
+	}
+	sort.SliceStable(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins, errs
+}
+
+// readManifest reads the plugin described by the manifest at path
+func readManifest(path string) (Plugin, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Plugin{}, err
+	}
+	plugin, err := parseManifest(data, path)
+	if err != nil {
+		return Plugin{}, err
+	}
+	local := filepath.Join(filepath.Dir(path), plugin.Command)
+	if plugin.Command != "" && !filepath.IsAbs(plugin.Command) &&
+		(strings.ContainsRune(plugin.Command, filepath.Separator) || fileExists(local)) {
+		plugin.Command = local
+	}
+	return plugin, nil
+}
+
+// describe runs the executable at path to print its manifest
+func describe(path string) (Plugin, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, ManifestFlag)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return Plugin{}, fmt.Errorf("failed to print the manifest with %s: %v%s", ManifestFlag, err, stderrDetail(stderr))
+	}
+	plugin, err := parseManifest(output, path)
+	if err != nil {
+		return Plugin{}, err
+	}
+	if plugin.Command == "" {
+		plugin.Command = path
+	}
+	return plugin, nil
+}
+
+// parseManifest parses the manifest of the plugin found at path
+func parseManifest(data []byte, path string) (Plugin, error) {
+	var plugin Plugin
+	if err := yaml.Unmarshal(data, &plugin); err != nil {
+		return Plugin{}, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if plugin.Name == "" {
+		plugin.Name = baseName(filepath.Base(path))
+	}
+	plugin.Path = path
+	return plugin, nil
+}
+
+func (p Plugin) validate() error {
+	// Tools are named after the plugin and MCP tools <plugin>.<tool>
+	if p.Name == "" || strings.ContainsAny(p.Name, ". ") {
+		return fmt.Errorf("invalid plugin name %q: must not contain dots or spaces", p.Name)
+	}
+	switch p.Kind {
+	case KindTool, KindMCP, KindProvider:
+	default:
+		return fmt.Errorf("unsupported plugin kind %q (supported: %s, %s, %s)", p.Kind, KindTool, KindMCP, KindProvider)
+	}
+	if p.Command == "" {
+		return fmt.Errorf("plugin %s: command is required", p.Name)
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("plugin %s: timeout must not be negative", p.Name)
+	}
+	return nil
+}
+
+// Schema returns the input schema of a tool as JSON; a tool without a schema takes any object
+func (p Plugin) Schema() string {
+	if len(p.InputSchema) == 0 {
+		return `{"type": "object"}`
+	}
+	schema, err := json.Marshal(p.InputSchema)
+	if err != nil {
+		return `{"type": "object"}`
+	}
+	return string(schema)
+}
+
+// Run runs the command of the plugin with input on its standard input and returns its
+// standard output
+func (p Plugin) Run(input []byte) ([]byte, error) {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Dir = filepath.Dir(p.Path)
+	cmd.Env = os.Environ()
+	for name, value := range p.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("plugin %s did not finish within %s", p.Name, timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s failed: %v%s", p.Name, err, stderrDetail(stderr))
+	}
+	return output, nil
+}
+
+// LLM is an LLM provider plugin
+type LLM struct {
+	plugin Plugin
+	model  string
+}
+
+// NewLLM creates the LLM answering with the provider plugin for the named model
+func NewLLM(plugin Plugin, model string) *LLM {
+	return &LLM{plugin: plugin, model: model}
+}
+
+// Complete sends the prompt to the plugin and returns its response
+func (l *LLM) Complete(prompt string) (string, error) {
+	request, err := json.Marshal(map[string]string{"model": l.model, "prompt": prompt})
+	if err != nil {
+		return "", err
+	}
+	output, err := l.plugin.Run(request)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func stderrDetail(stderr bytes.Buffer) string {
+	if detail := strings.TrimSpace(stderr.String()); detail != "" {
+		return ": " + detail
+	}
+	return ""
+}
+
+func isManifest(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func isExecutable(entry os.DirEntry) bool {
+	info, err := entry.Info()
+	return err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0
+}
+
+func baseName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
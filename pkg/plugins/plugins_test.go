@@ -0,0 +1,89 @@
+package plugins
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, data string, perm os.FileMode) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(data), perm))
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+
+	// A manifest with its executable
+	writeFile(t, filepath.Join(dir, "jira.yaml"), "kind: tool\ndescription: Search Jira\ncommand: jira.sh\n"+
+		"input_schema:\n  type: object\n  properties:\n    query: {type: string}\n", 0644)
+	writeFile(t, filepath.Join(dir, "jira.sh"), "#!/bin/sh\necho \"found $(cat)\"\n", 0755)
+
+	// An executable printing its manifest
+	writeFile(t, filepath.Join(dir, "echo-llm"), "#!/bin/sh\n"+
+		"if [ \"$1\" = --manifest ]; then printf 'kind: provider\\n'; exit 0; fi\n"+
+		"cat\n", 0755)
+
+	// Files that are not plugins
+	writeFile(t, filepath.Join(dir, "README.md"), "notes", 0644)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "lib"), 0755))
+
+	// Invalid plugins
+	writeFile(t, filepath.Join(dir, "broken.yaml"), "kind: node\ncommand: broken\n", 0644)
+	writeFile(t, filepath.Join(dir, "silent"), "#!/bin/sh\nexit 1\n", 0755)
+
+	plugins, errs := Discover(dir)
+	require.Len(t, plugins, 2)
+	assert.Len(t, errs, 2)
+	assert.ErrorContains(t, errs[0], `unsupported plugin kind "node"`)
+	assert.ErrorContains(t, errs[1], "failed to print the manifest with --manifest")
+
+	llm := plugins[0]
+	assert.Equal(t, "echo-llm", llm.Name)
+	assert.Equal(t, KindProvider, llm.Kind)
+	assert.Equal(t, filepath.Join(dir, "echo-llm"), llm.Command)
+
+	tool := plugins[1]
+	assert.Equal(t, "jira", tool.Name)
+	assert.Equal(t, KindTool, tool.Kind)
+	assert.Equal(t, filepath.Join(dir, "jira.sh"), tool.Command)
+	assert.JSONEq(t, `{"type": "object", "properties": {"query": {"type": "string"}}}`, tool.Schema())
+
+	output, err := tool.Run([]byte(`{"query": "bug"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "found {\"query\": \"bug\"}\n", string(output))
+
+	response, err := NewLLM(llm, "small").Complete("hello")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"model": "small", "prompt": "hello"}`, response)
+}
+
+func TestDiscover_MissingDir(t *testing.T) {
+	plugins, errs := Discover(filepath.Join(t.TempDir(), "plugins"))
+	assert.Empty(t, plugins)
+	assert.Empty(t, errs)
+}
+
+func TestDiscover_Duplicate(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.yaml"), "name: search\nkind: tool\ncommand: grep\n", 0644)
+	writeFile(t, filepath.Join(dir, "b.yaml"), "name: search\nkind: mcp\ncommand: search-server\n", 0644)
+
+	plugins, errs := Discover(dir)
+	assert.Len(t, plugins, 1)
+	if assert.Len(t, errs, 1) {
+		assert.ErrorContains(t, errs[0], "plugin search is already defined in "+filepath.Join(dir, "a.yaml"))
+	}
+}
+
+func TestRun_Failure(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "fail.sh")
+	writeFile(t, script, "#!/bin/sh\necho 'no token' >&2\nexit 3\n", 0755)
+
+	_, err := Plugin{Name: "fail", Kind: KindTool, Command: script, Path: script}.Run(nil)
+	assert.EqualError(t, err, "plugin fail failed: exit status 3: no token")
+}
@@ -0,0 +1,318 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Actions checked by the policy engine
+const (
+	ActionCommand   = "command"
+	ActionFileWrite = "file_write"
+)
+
+// Decisions of the policy engine
+const (
+	Allow = "allow"
+	Deny  = "deny"
+
+	// Ask lets the action happen only after the user approved it
+	Ask = "ask"
+)
+
+// DefaultOPATimeout limits an evaluation of the OPA engine
+const DefaultOPATimeout = 10 * time.Second
+
+// lookPath finds the opa executable; tests replace it
+var lookPath = exec.LookPath
+
+// Input describes an action to the policy engine
+type Input struct {
+	Action  string `json:"action"`
+	Command string `json:"command,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Dir     string `json:"cwd"`
+
+	// Rating is the risk rating of a command: SAFE, CAUTION or DANGEROUS
+	Rating string    `json:"rating,omitempty"`
+	User   string    `json:"user,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Result is the decision of the policy engine about an action
+type Result struct {
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Engine decides whether an action may happen
+type Engine interface {
+	Evaluate(ctx context.Context, input Input) (Result, error)
+}
+
+// EngineFunc adapts a function to the Engine interface
+type EngineFunc func(ctx context.Context, input Input) (Result, error)
+
+// Evaluate implements the Engine interface
+func (f EngineFunc) Evaluate(ctx context.Context, input Input) (Result, error) {
+	return f(ctx, input)
+}
+
+// Chain evaluates every engine; the first deny wins, then any ask, otherwise the action is allowed
+func Chain(engines ...Engine) Engine {
+	return EngineFunc(func(ctx context.Context, input Input) (Result, error) {
+		result := Result{Decision: Allow}
+		for _, engine := range engines {
+			r, err := engine.Evaluate(ctx, input)
+			if err != nil {
+				return Result{}, err
+			}
+			switch r.Decision {
+			case Deny:
+				return r, nil
+			case Ask:
+				if result.Decision != Ask {
+					result = r
+				}
+			}
+		}
+		return result, nil
+	})
+}
+
+// Rule matches actions and decides about them; the empty conditions match everything
+type Rule struct {
+	// Action is command or file_write; empty matches both
+	Action string `yaml:"action"`
+
+	// Command and Path are regular expressions the command or the written path must match
+	Command string `yaml:"command"`
+	Path    string `yaml:"path"`
+
+	// Dir is a regular expression the working directory must match
+	Dir string `yaml:"dir"`
+
+	// Ratings are the command ratings matched, e.g. [DANGEROUS]
+	Ratings []string `yaml:"ratings"`
+
+	// Users are the users matched
+	Users []string `yaml:"users"`
+
+	// Hours is a time range of the day in local time, e.g. 18:00-08:00
+	Hours string `yaml:"hours"`
+
+	// Weekdays are the days matched, e.g. [sat, sun]
+	Weekdays []string `yaml:"weekdays"`
+
+	// Decision is allow, deny or ask
+	Decision string `yaml:"decision"`
+
+	// Reason is shown when the rule denies or asks
+	Reason string `yaml:"reason"`
+}
+
+// compiledRule is a Rule with its patterns compiled
+type compiledRule struct {
+	Rule
+	command, path, dir *regexp.Regexp
+	from, to           int // Minutes of the day of Hours; from == to means all day
+}
+
+// Rules is an engine deciding with the first matching rule; no match allows the action
+type Rules struct {
+	rules []compiledRule
+}
+
+// NewRules compiles rules into an engine
+func NewRules(rules []Rule) (*Rules, error) {
+	engine := &Rules{}
+	for i, rule := range rules {
+		compiled, err := compile(rule)
+		if err != nil {
+			return nil, fmt.Errorf("policy rule %d: %v", i+1, err)
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+	return engine, nil
+}
+
+func compile(rule Rule) (compiledRule, error) {
+	c := compiledRule{Rule: rule}
+	switch rule.Action {
+	case "", ActionCommand, ActionFileWrite:
+	default:
+		return c, fmt.Errorf("unknown action %q (expected %s or %s)", rule.Action, ActionCommand, ActionFileWrite)
+	}
+	switch rule.Decision {
+	case Allow, Deny, Ask:
+	default:
+		return c, fmt.Errorf("unknown decision %q (expected %s, %s or %s)", rule.Decision, Allow, Deny, Ask)
+	}
+
+	var err error
+	for _, p := range []struct {
+		pattern string
+		re      **regexp.Regexp
+	}{{rule.Command, &c.command}, {rule.Path, &c.path}, {rule.Dir, &c.dir}} {
+		if p.pattern == "" {
+			continue
+		}
+		if *p.re, err = regexp.Compile(p.pattern); err != nil {
+			return c, fmt.Errorf("invalid pattern: %v", err)
+		}
+	}
+	if rule.Hours != "" {
+		from, to, ok := strings.Cut(rule.Hours, "-")
+		if c.from, err = minuteOfDay(from); ok && err == nil {
+			c.to, err = minuteOfDay(to)
+		}
+		if !ok || err != nil {
+			return c, fmt.Errorf("invalid hours %q (expected e.g. 18:00-08:00)", rule.Hours)
+		}
+	}
+	for _, day := range rule.Weekdays {
+		if _, ok := weekday(day); !ok {
+			return c, fmt.Errorf("unknown weekday %q", day)
+		}
+	}
+	return c, nil
+}
+
+// Evaluate implements the Engine interface
+func (r *Rules) Evaluate(_ context.Context, input Input) (Result, error) {
+	for _, rule := range r.rules {
+		if rule.matches(input) {
+			return Result{Decision: rule.Decision, Reason: rule.Reason}, nil
+		}
+	}
+	return Result{Decision: Allow}, nil
+}
+
+func (r compiledRule) matches(input Input) bool {
+	switch {
+	case r.Action != "" && r.Action != input.Action,
+		r.command != nil && (input.Action != ActionCommand || !r.command.MatchString(input.Command)),
+		r.path != nil && (input.Action != ActionFileWrite || !r.path.MatchString(input.Path)),
+		r.dir != nil && !r.dir.MatchString(input.Dir),
+		len(r.Ratings) > 0 && !slices.ContainsFunc(r.Ratings, func(rating string) bool { return strings.EqualFold(rating, input.Rating) }),
+		len(r.Users) > 0 && !slices.Contains(r.Users, input.User):
+		return false
+	}
+
+	local := input.Time.Local()
+	if len(r.Weekdays) > 0 && !slices.ContainsFunc(r.Weekdays, func(day string) bool {
+		d, _ := weekday(day)
+		return d == local.Weekday()
+	}) {
+		return false
+	}
+	if r.from != r.to {
+		minute := local.Hour()*60 + local.Minute()
+		if r.from < r.to {
+			return minute >= r.from && minute < r.to
+		}
+		return minute >= r.from || minute < r.to // The range spans midnight
+	}
+	return true
+}
+
+// minuteOfDay parses a time of the day, e.g. 18:30
+func minuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// weekday parses the name of a day, e.g. sat or Saturday
+func weekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) || strings.EqualFold(name, d.String()[:3]) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// OPA is an engine evaluating a Rego policy with the opa command line tool
+// The query must return a decision ("allow", "deny" or "ask") or an object with a
+// decision and a reason
+type OPA struct {
+	// Paths are the Rego files and directories of the policy
+	Paths []string
+
+	// Query selects the decision, e.g. data.aiagent.decision
+	Query string
+
+	// Timeout limits an evaluation (default: 10s)
+	Timeout time.Duration
+}
+
+// Evaluate implements the Engine interface
+func (o *OPA) Evaluate(ctx context.Context, input Input) (Result, error) {
+	path, err := lookPath("opa")
+	if err != nil {
+		return Result{}, fmt.Errorf("the opa command is required for Rego policies: %v", err)
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to encode policy input: %v", err)
+	}
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = DefaultOPATimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := []string{"eval", "--format", "json", "--stdin-input"}
+	for _, p := range o.Paths {
+		args = append(args, "--data", p)
+	}
+	args = append(args, o.Query)
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = bytes.NewReader(body)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Result{}, fmt.Errorf("opa eval failed: %s", msg)
+		}
+		return Result{}, fmt.Errorf("opa eval failed: %v", err)
+	}
+
+	var output struct {
+		Result []struct {
+			Expressions []struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return Result{}, fmt.Errorf("failed to decode opa output: %v", err)
+	}
+	if len(output.Result) == 0 || len(output.Result[0].Expressions) == 0 {
+		return Result{}, fmt.Errorf("the policy query %s is undefined", o.Query)
+	}
+	value := output.Result[0].Expressions[0].Value
+
+	var result Result
+	if err := json.Unmarshal(value, &result.Decision); err != nil {
+		if err := json.Unmarshal(value, &result); err != nil {
+			return Result{}, fmt.Errorf("the policy query %s returned %s, not a decision", o.Query, value)
+		}
+	}
+	switch result.Decision {
+	case Allow, Deny, Ask:
+		return result, nil
+	}
+	return Result{}, fmt.Errorf("the policy query %s returned the unknown decision %q", o.Query, result.Decision)
+}
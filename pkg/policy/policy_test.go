@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRules(t *testing.T) {
+	rules, err := NewRules([]Rule{
+		{Action: ActionCommand, Command: `^git push\b`, Users: []string{"intern"}, Decision: Deny, Reason: "interns do not push"},
+		{Action: ActionCommand, Ratings: []string{"DANGEROUS"}, Hours: "18:00-08:00", Decision: Deny, Reason: "no dangerous commands after hours"},
+		{Action: ActionCommand, Ratings: []string{"dangerous"}, Decision: Ask},
+		{Action: ActionFileWrite, Path: `\.env$`, Decision: Deny},
+		{Action: ActionCommand, Dir: `^/srv/prod`, Weekdays: []string{"sat", "Sunday"}, Decision: Deny, Reason: "prod is frozen on weekends"},
+	})
+	require.NoError(t, err)
+
+	monday := time.Date(2025, 6, 2, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		name   string
+		input  Input
+		result Result
+	}{
+		{"user rule", Input{Action: ActionCommand, Command: "git push origin", User: "intern", Time: monday}, Result{Deny, "interns do not push"}},
+		{"other user", Input{Action: ActionCommand, Command: "git push origin", User: "alice", Time: monday}, Result{Decision: Allow}},
+		{"after hours", Input{Action: ActionCommand, Command: "rm x", Rating: "DANGEROUS", Time: monday.Add(10 * time.Hour)}, Result{Deny, "no dangerous commands after hours"}},
+		{"early morning", Input{Action: ActionCommand, Command: "rm x", Rating: "DANGEROUS", Time: monday.Add(-3 * time.Hour)}, Result{Deny, "no dangerous commands after hours"}},
+		{"working hours", Input{Action: ActionCommand, Command: "rm x", Rating: "DANGEROUS", Time: monday}, Result{Decision: Ask}},
+		{"file write", Input{Action: ActionFileWrite, Path: "/src/app/.env", Time: monday}, Result{Decision: Deny}},
+		{"command pattern does not match writes", Input{Action: ActionFileWrite, Path: "git push", User: "intern", Time: monday}, Result{Decision: Allow}},
+		{"weekend", Input{Action: ActionCommand, Command: "ls", Dir: "/srv/prod/api", Time: monday.AddDate(0, 0, 6)}, Result{Deny, "prod is frozen on weekends"}},
+		{"weekday", Input{Action: ActionCommand, Command: "ls", Dir: "/srv/prod/api", Time: monday}, Result{Decision: Allow}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := rules.Evaluate(context.Background(), tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.result, result)
+		})
+	}
+
+	for rule, message := range map[*Rule]string{
+		{Decision: "maybe"}:                             `policy rule 1: unknown decision "maybe" (expected allow, deny or ask)`,
+		{Action: "delete", Decision: Deny}:              `policy rule 1: unknown action "delete" (expected command or file_write)`,
+		{Command: "(", Decision: Deny}:                  "policy rule 1: invalid pattern: error parsing regexp: missing closing ): `(`",
+		{Hours: "evening", Decision: Deny}:              `policy rule 1: invalid hours "evening" (expected e.g. 18:00-08:00)`,
+		{Weekdays: []string{"fri-day"}, Decision: Deny}: `policy rule 1: unknown weekday "fri-day"`,
+	} {
+		_, err := NewRules([]Rule{*rule})
+		assert.EqualError(t, err, message)
+	}
+}
+
+func TestChain(t *testing.T) {
+	decide := func(decision string) Engine {
+		return EngineFunc(func(context.Context, Input) (Result, error) { return Result{Decision: decision, Reason: decision}, nil })
+	}
+	result, err := Chain(decide(Allow), decide(Ask), decide(Deny)).Evaluate(context.Background(), Input{})
+	require.NoError(t, err)
+	assert.Equal(t, Result{Deny, Deny}, result)
+
+	result, err = Chain(decide(Allow), decide(Ask), decide(Allow)).Evaluate(context.Background(), Input{})
+	require.NoError(t, err)
+	assert.Equal(t, Result{Ask, Ask}, result)
+
+	failing := EngineFunc(func(context.Context, Input) (Result, error) { return Result{}, errors.New("broken") })
+	_, err = Chain(decide(Allow), failing).Evaluate(context.Background(), Input{})
+	assert.EqualError(t, err, "broken")
+}
+
+func TestOPA(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fakes opa with a shell script")
+	}
+
+	// The fake opa denies commands mentioning prod and echoes its arguments into a file
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\nif grep -q prod; then\n" +
+		`echo '{"result":[{"expressions":[{"value":{"decision":"deny","reason":"prod is off limits"}}]}]}'` + "\nelse\n" +
+		`echo '{"result":[{"expressions":[{"value":"allow"}]}]}'` + "\nfi\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "opa"), []byte(script), 0700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	opa := &OPA{Paths: []string{"/etc/aiagent/policy.rego"}, Query: "data.aiagent.decision"}
+	result, err := opa.Evaluate(context.Background(), Input{Action: ActionCommand, Command: "ssh prod"})
+	require.NoError(t, err)
+	assert.Equal(t, Result{Deny, "prod is off limits"}, result)
+	recorded, err := os.ReadFile(args)
+	require.NoError(t, err)
+	assert.Equal(t, "eval --format json --stdin-input --data /etc/aiagent/policy.rego data.aiagent.decision\n", string(recorded))
+
+	result, err = opa.Evaluate(context.Background(), Input{Action: ActionCommand, Command: "ls"})
+	require.NoError(t, err)
+	assert.Equal(t, Result{Decision: Allow}, result)
+
+	original := lookPath
+	t.Cleanup(func() { lookPath = original })
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+	_, err = opa.Evaluate(context.Background(), Input{})
+	assert.ErrorContains(t, err, "the opa command is required")
+}
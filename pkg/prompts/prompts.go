@@ -0,0 +1,303 @@
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Names of the built-in templates, one per prompt sent by the nodes
+const (
+	AnalyticsAnalyze            = "analytics.analyze"
+	BashCommand                 = "bash.command"
+	ChangesChangelog            = "changes.changelog"
+	ChangesSummarizeChunk       = "changes.summarize_chunk"
+	ClassifierVerifyTask        = "classifier.verify_task"
+	ClassifierGoalMet           = "classifier.goal_met"
+	ClassifierClassify          = "classifier.classify"
+	ClassifierSecondOpinion     = "classifier.second_opinion"
+	CIDiagnose                  = "ci.diagnose"
+	CodeAnalyzerContentNeeds    = "code_analyzer.content_needs"
+	CodeAnalyzerAnalyzeContents = "code_analyzer.analyze_contents"
+	CodeAnalyzerAnalyzeSubject  = "code_analyzer.analyze_subject"
+	CodeAnalyzerExtractSubject  = "code_analyzer.extract_subject"
+	CodeAnalyzerRelatedTerms    = "code_analyzer.related_terms"
+	CodeFixerAnalyze            = "code_fixer.analyze"
+	CodeFixerFixBuild           = "code_fixer.fix_build"
+	CodeFixerFixTests           = "code_fixer.fix_tests"
+	CodeFixerNextGoal           = "code_fixer.next_goal"
+	CoverageAnalyze             = "coverage.analyze"
+	CriticReview                = "critic.review"
+	DirectResponseRespond       = "direct_response.respond"
+	EditorExplain               = "editor.explain"
+	EditorFix                   = "editor.fix"
+	FormatterFormat             = "formatter.format"
+	HistorySummarize            = "history.summarize"
+	IssuePlan                   = "issue.plan"
+	JSONRepair                  = "json.repair"
+	LanguageAnswer              = "language.answer"
+	PlannerPlan                 = "planner.plan"
+	StatsSummarize              = "stats.summarize"
+	System                      = "system"
+	TodoSummarize               = "todo.summarize"
+	ToolCall                    = "tool.call"
+	ValidationValidate          = "validation.validate"
+	VulnerabilitiesExplain      = "vulnerabilities.explain"
+)
+
+// templateExt is the file extension of template files
+const templateExt = ".tmpl"
+
+// CustomVersion is the version of the templates of a directory that are not laid out by
+// version, e.g. <dir>/bash.system.tmpl; it is active once loaded
+const CustomVersion = "custom"
+
+// SystemFor returns the name of the template of the system prompt of a node, which
+// replaces the System template for that node
+func SystemFor(node string) string {
+	return node + "." + System
+}
+
+// builtinFS holds the built-in templates as templates/<name>/<version>.tmpl
+//
+//go:embed templates
+var builtinFS embed.FS
+
+// Vars are the variables a template is rendered with, referenced as {{.Name}}
+type Vars map[string]any
+
+// Registry holds prompt templates by name and version
+// Every name has an active version, which is the one rendered by Render
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]map[string]*entry
+	active    map[string]string
+}
+
+// entry is a parsed template with its source text
+type entry struct {
+	tmpl *template.Template
+	text string
+}
+
+// NewRegistry creates a new instance of Registry without templates
+func NewRegistry() *Registry {
+	return &Registry{
+		templates: make(map[string]map[string]*entry),
+		active:    make(map[string]string),
+	}
+}
+
+// Builtin creates a registry with the built-in templates, each active in its latest version
+func Builtin() *Registry {
+	r := NewRegistry()
+	if err := r.load(builtinFS, "templates"); err != nil {
+		panic(fmt.Sprintf("prompts: invalid built-in template: %v", err))
+	}
+	for name, versions := range r.templates {
+		latest := ""
+		for version := range versions {
+			if latest == "" || compareVersions(version, latest) > 0 {
+				latest = version
+			}
+		}
+		r.active[name] = latest
+	}
+	return r
+}
+
+// Add parses text as version of the named template, replacing a template with the same
+// name and version; the first version added for a name becomes its active version
+func (r *Registry) Add(name, version, text string) error {
+	if name == "" || version == "" {
+		return fmt.Errorf("template name and version must not be empty")
+	}
+
+	// A template file ends with a newline that is not part of the prompt
+	text = strings.TrimSuffix(text, "\n")
+	tmpl, err := template.New(name + "@" + version).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s@%s: %v", name, version, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.templates[name] == nil {
+		r.templates[name] = make(map[string]*entry)
+	}
+	r.templates[name][version] = &entry{tmpl: tmpl, text: text}
+	if r.active[name] == "" {
+		r.active[name] = version
+	}
+	return nil
+}
+
+// LoadDir adds the templates in dir, laid out as <dir>/<name>/<version>.tmpl like the
+// built-in ones; a template with the name and version of a built-in one replaces it
+// A file <dir>/<name>.tmpl is added as the CustomVersion of the template and activated, so
+// it overrides the template without selecting a version
+func (r *Registry) LoadDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("failed to read prompt directory: %v", err)
+	}
+	fsys := os.DirFS(dir)
+	if err := r.load(fsys, "."); err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(fsys, "*"+templateExt)
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %v", err)
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read template: %v", err)
+		}
+		name := strings.TrimSuffix(file, templateExt)
+		if err := r.Add(name, CustomVersion, string(data)); err != nil {
+			return err
+		}
+		if err := r.Use(name, CustomVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) load(fsys fs.FS, root string) error {
+	files, err := fs.Glob(fsys, path.Join(root, "*", "*"+templateExt))
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %v", err)
+	}
+
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read template: %v", err)
+		}
+		name := path.Base(path.Dir(file))
+		version := strings.TrimSuffix(path.Base(file), templateExt)
+		if err := r.Add(name, version, string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Use makes version the active version of the named template
+func (r *Registry) Use(name, version string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	versions, ok := r.templates[name]
+	if !ok {
+		return fmt.Errorf("unknown prompt template: %s", name)
+	}
+	if _, ok := versions[version]; !ok {
+		return fmt.Errorf("unknown version %s of prompt template %s (available: %s)", version, name, strings.Join(sortedVersions(versions), ", "))
+	}
+	r.active[name] = version
+	return nil
+}
+
+// Render renders the active version of the named template
+func (r *Registry) Render(name string, vars Vars) (string, error) {
+	return r.RenderVersion(name, r.Version(name), vars)
+}
+
+// RenderVersion renders a specific version of the named template
+func (r *Registry) RenderVersion(name, version string, vars Vars) (string, error) {
+	r.mu.RLock()
+	e, ok := r.templates[name][version]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown prompt template: %s@%s", name, version)
+	}
+
+	var buf bytes.Buffer
+	if err := e.tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s@%s: %v", name, version, err)
+	}
+	return buf.String(), nil
+}
+
+// Version returns the active version of the named template, or an empty string if it is unknown
+func (r *Registry) Version(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active[name]
+}
+
+// Versions returns the versions of the named template, oldest first
+func (r *Registry) Versions(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return sortedVersions(r.templates[name])
+}
+
+// Names returns the names of all templates in alphabetical order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Active returns the active version of every template, e.g. to record which prompts a run used
+func (r *Registry) Active() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	active := make(map[string]string, len(r.active))
+	for name, version := range r.active {
+		active[name] = version
+	}
+	return active
+}
+
+// Source returns the text of a version of the named template
+func (r *Registry) Source(name, version string) (string, error) {
+	r.mu.RLock()
+	e, ok := r.templates[name][version]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown prompt template: %s@%s", name, version)
+	}
+	return e.text, nil
+}
+
+func sortedVersions(versions map[string]*entry) []string {
+	sorted := make([]string, 0, len(versions))
+	for version := range versions {
+		sorted = append(sorted, version)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return compareVersions(sorted[i], sorted[j]) < 0
+	})
+	return sorted
+}
+
+// compareVersions orders versions of the form v<number> numerically, so v10 follows v9;
+// other versions are compared as strings
+func compareVersions(a, b string) int {
+	na, errA := strconv.Atoi(strings.TrimPrefix(a, "v"))
+	nb, errB := strconv.Atoi(strings.TrimPrefix(b, "v"))
+	if errA == nil && errB == nil && na != nb {
+		if na < nb {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
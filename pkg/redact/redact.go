@@ -0,0 +1,63 @@
+package redact
+
+import (
+	"regexp"
+)
+
+// Placeholder replaces redacted secrets
+const Placeholder = "[REDACTED]"
+
+// rule describes a secret pattern and how it is replaced
+type rule struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// rules lists the secrets removed from text before it is shared
+// Rules that keep a prefix use capture groups so the context stays readable
+var rules = []rule{
+	{
+		name:        "private key",
+		pattern:     regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`),
+		replacement: Placeholder,
+	},
+	{
+		name:        "openai api key",
+		pattern:     regexp.MustCompile(`sk-[a-zA-Z0-9_-]{16,}`),
+		replacement: Placeholder,
+	},
+	{
+		name:        "github token",
+		pattern:     regexp.MustCompile(`gh[pousr]_[a-zA-Z0-9]{20,}`),
+		replacement: Placeholder,
+	},
+	{
+		name:        "aws access key",
+		pattern:     regexp.MustCompile(`(A3T[A-Z0-9]|AKIA|ASIA)[A-Z0-9]{16}`),
+		replacement: Placeholder,
+	},
+	{
+		name:        "bearer token",
+		pattern:     regexp.MustCompile(`(?i)(bearer\s+)[a-zA-Z0-9._~+/=-]{8,}`),
+		replacement: "${1}" + Placeholder,
+	},
+	{
+		name:        "credential assignment",
+		pattern:     regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api[_-]?key)\s*[:=]\s*)["']?[^\s"']{4,}["']?`),
+		replacement: "${1}" + Placeholder,
+	},
+	{
+		name:        "url credentials",
+		pattern:     regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@]+:)[^\s@/]+(@)`),
+		replacement: "${1}" + Placeholder + "${2}",
+	},
+}
+
+// Redact replaces secrets such as API keys, tokens, passwords and private keys with a placeholder
+func Redact(text string) string {
+	for _, r := range rules {
+		text = r.pattern.ReplaceAllString(text, r.replacement)
+	}
+	return text
+}
@@ -0,0 +1,249 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCommandWidth is the number of characters of a command shown in the report
+const maxCommandWidth = 60
+
+// Price is the cost of a model in USD per million tokens
+type Price struct {
+	InputPerMillion  float64 `yaml:"input_per_million"`
+	OutputPerMillion float64 `yaml:"output_per_million"`
+}
+
+// DefaultPrices are the list prices of common models in USD per million tokens
+var DefaultPrices = map[string]Price{
+	"gpt-3.5-turbo": {InputPerMillion: 0.50, OutputPerMillion: 1.50},
+	"gpt-4":         {InputPerMillion: 30, OutputPerMillion: 60},
+	"gpt-4-turbo":   {InputPerMillion: 10, OutputPerMillion: 30},
+	"gpt-4o":        {InputPerMillion: 2.50, OutputPerMillion: 10},
+	"gpt-4o-mini":   {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+}
+
+// LookupPrice returns the price of a model, preferring the overrides over DefaultPrices
+func LookupPrice(model string, overrides map[string]Price) (Price, bool) {
+	if price, ok := overrides[model]; ok {
+		return price, true
+	}
+	price, ok := DefaultPrices[model]
+	return price, ok
+}
+
+// Cost returns the cost in USD of the given token counts
+func (p Price) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*p.InputPerMillion + float64(outputTokens)*p.OutputPerMillion) / 1e6
+}
+
+// Command is a command executed during a node
+type Command struct {
+	Command  string        `json:"command"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+}
+
+// NodeVisit is a single execution of a node
+type NodeVisit struct {
+	Node         string        `json:"node"`
+	Duration     time.Duration `json:"duration"`
+	LLMCalls     int           `json:"llm_calls"`
+	InputTokens  int           `json:"input_tokens"`
+	OutputTokens int           `json:"output_tokens"`
+	Commands     []Command     `json:"commands,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// Report summarizes the execution of a run
+type Report struct {
+	RunID    string        `json:"run_id"`
+	Model    string        `json:"model"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Visits   []NodeVisit   `json:"visits"`
+
+	// Cost is the cost in USD; it is only meaningful when CostKnown is set
+	Cost      float64 `json:"cost"`
+	CostKnown bool    `json:"cost_known"`
+}
+
+// Builder collects the report of a run while it executes
+type Builder struct {
+	runID   string
+	model   string
+	price   Price
+	priced  bool
+	started time.Time
+
+	mu      sync.Mutex
+	visits  []NodeVisit
+	current int // index of the running node visit, -1 between nodes
+}
+
+// NewBuilder creates a new instance of Builder
+// The price is used to compute the cost; priced is false when the model price is unknown
+func NewBuilder(runID, model string, price Price, priced bool) *Builder {
+	return &Builder{
+		runID:   runID,
+		model:   model,
+		price:   price,
+		priced:  priced,
+		started: time.Now(),
+		current: -1,
+	}
+}
+
+// StartNode records the start of a node visit
+func (b *Builder) StartNode(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.visits = append(b.visits, NodeVisit{Node: node})
+	b.current = len(b.visits) - 1
+}
+
+// EndNode records the end of the current node visit
+func (b *Builder) EndNode(duration time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.current < 0 {
+		return
+	}
+	b.visits[b.current].Duration = duration
+	if err != nil {
+		b.visits[b.current].Error = err.Error()
+	}
+	b.current = -1
+}
+
+// AddLLMCall records an LLM call of the current node
+func (b *Builder) AddLLMCall(inputTokens, outputTokens int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	visit := b.visit()
+	visit.LLMCalls++
+	visit.InputTokens += inputTokens
+	visit.OutputTokens += outputTokens
+}
+
+// AddCommand records a command executed by the current node
+func (b *Builder) AddCommand(command string, exitCode int, duration time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	visit := b.visit()
+	visit.Commands = append(visit.Commands, Command{Command: command, ExitCode: exitCode, Duration: duration})
+}
+
+// visit returns the running node visit; calls made between nodes get their own entry
+func (b *Builder) visit() *NodeVisit {
+	if b.current < 0 {
+		b.visits = append(b.visits, NodeVisit{Node: "-"})
+		return &b.visits[len(b.visits)-1]
+	}
+	return &b.visits[b.current]
+}
+
+// Finish returns the report of the run
+func (b *Builder) Finish(err error) *Report {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	report := &Report{
+		RunID:     b.runID,
+		Model:     b.model,
+		Duration:  time.Since(b.started),
+		Visits:    append([]NodeVisit(nil), b.visits...),
+		CostKnown: b.priced,
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if b.priced {
+		input, output := report.Tokens()
+		report.Cost = b.price.Cost(input, output)
+	}
+	return report
+}
+
+// LLMCalls returns the total number of LLM calls
+func (r *Report) LLMCalls() int {
+	calls := 0
+	for _, visit := range r.Visits {
+		calls += visit.LLMCalls
+	}
+	return calls
+}
+
+// Tokens returns the total number of input and output tokens
+func (r *Report) Tokens() (int, int) {
+	input, output := 0, 0
+	for _, visit := range r.Visits {
+		input += visit.InputTokens
+		output += visit.OutputTokens
+	}
+	return input, output
+}
+
+// Write writes the report as a compact table
+func (r *Report) Write(w io.Writer) error {
+	var sb strings.Builder
+
+	status := "completed"
+	if r.Error != "" {
+		status = "failed"
+	}
+	fmt.Fprintf(&sb, "Run %s %s in %s\n", r.RunID, status, formatDuration(r.Duration))
+	fmt.Fprintf(&sb, "%3s  %-18s %9s %4s %15s  %s\n", "#", "NODE", "TIME", "LLM", "TOKENS IN/OUT", "COMMANDS")
+	for i, visit := range r.Visits {
+		tokens := "-"
+		if visit.InputTokens > 0 || visit.OutputTokens > 0 {
+			tokens = fmt.Sprintf("%d/%d", visit.InputTokens, visit.OutputTokens)
+		}
+
+		commands := make([]string, 0, len(visit.Commands))
+		for _, command := range visit.Commands {
+			commands = append(commands, fmt.Sprintf("%s (exit %d, %s)", shorten(command.Command, maxCommandWidth), command.ExitCode, formatDuration(command.Duration)))
+		}
+		if visit.Error != "" {
+			commands = append(commands, "error: "+shorten(visit.Error, maxCommandWidth))
+		}
+
+		fmt.Fprintf(&sb, "%3d  %-18s %9s %4d %15s  %s\n", i+1, visit.Node, formatDuration(visit.Duration), visit.LLMCalls, tokens, strings.Join(commands, "; "))
+	}
+
+	input, output := r.Tokens()
+	cost := "unknown"
+	if r.CostKnown {
+		cost = fmt.Sprintf("$%.4f", r.Cost)
+	}
+	fmt.Fprintf(&sb, "Total: %d node(s), %d LLM call(s), %d/%d tokens, cost %s (model %s)\n", len(r.Visits), r.LLMCalls(), input, output, cost, r.Model)
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// formatDuration rounds durations to a readable precision
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(time.Millisecond).String()
+	default:
+		return d.Round(time.Microsecond).String()
+	}
+}
+
+// shorten cuts text to at most max characters and puts it on a single line
+func shorten(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:max-3]) + "..."
+}
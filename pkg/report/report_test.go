@@ -0,0 +1,72 @@
+package report
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder_Finish(t *testing.T) {
+	price, ok := LookupPrice("gpt-4o-mini", nil)
+	assert.True(t, ok)
+
+	builder := NewBuilder("run-1", "gpt-4o-mini", price, ok)
+	builder.StartNode("classifier")
+	builder.AddLLMCall(1000, 100)
+	builder.EndNode(1200*time.Millisecond, nil)
+	builder.StartNode("bash")
+	builder.AddLLMCall(500, 50)
+	builder.AddCommand("ls -la", 0, 15*time.Millisecond)
+	builder.EndNode(800*time.Millisecond, nil)
+	builder.StartNode("bash")
+	builder.AddCommand("cat missing.txt", 1, 3*time.Millisecond)
+	builder.EndNode(10*time.Millisecond, errors.New("command execution failed: exit status 1"))
+
+	report := builder.Finish(errors.New("error in node bash"))
+	assert.Len(t, report.Visits, 3)
+	assert.Equal(t, 2, report.LLMCalls())
+	input, output := report.Tokens()
+	assert.Equal(t, 1500, input)
+	assert.Equal(t, 150, output)
+	assert.True(t, report.CostKnown)
+	assert.InDelta(t, (1500*0.15+150*0.60)/1e6, report.Cost, 1e-12)
+
+	var sb strings.Builder
+	assert.NoError(t, report.Write(&sb))
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	assert.Len(t, lines, 6)
+	assert.True(t, strings.HasPrefix(lines[0], "Run run-1 failed in "))
+	assert.Contains(t, lines[2], "classifier")
+	assert.Contains(t, lines[2], "1000/100")
+	assert.Contains(t, lines[3], "ls -la (exit 0, 15ms)")
+	assert.Contains(t, lines[4], "cat missing.txt (exit 1, 3ms); error: command execution failed: exit status 1")
+	assert.Equal(t, "Total: 3 node(s), 2 LLM call(s), 1500/150 tokens, cost $0.0003 (model gpt-4o-mini)", lines[5])
+}
+
+func TestBuilder_UnknownPrice(t *testing.T) {
+	_, ok := LookupPrice("my-model", nil)
+	assert.False(t, ok)
+
+	price, ok := LookupPrice("my-model", map[string]Price{"my-model": {InputPerMillion: 1, OutputPerMillion: 2}})
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, price.Cost(1e6, 1e6))
+
+	// Calls made outside of a node are still reported
+	builder := NewBuilder("run-2", "mock", Price{}, false)
+	builder.AddLLMCall(0, 0)
+	report := builder.Finish(nil)
+	assert.Equal(t, "-", report.Visits[0].Node)
+
+	var sb strings.Builder
+	assert.NoError(t, report.Write(&sb))
+	assert.Contains(t, sb.String(), "Run run-2 completed in ")
+	assert.Contains(t, sb.String(), "cost unknown (model mock)")
+}
+
+func TestShorten(t *testing.T) {
+	assert.Equal(t, "ls -la", shorten("ls\n  -la", 10))
+	assert.Equal(t, "abcdefg...", shorten(strings.Repeat("abcdefghij", 3), 10))
+}
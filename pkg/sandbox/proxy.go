@@ -0,0 +1,131 @@
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// dialTimeout limits the connections of the proxy to the allowed hosts
+const dialTimeout = 30 * time.Second
+
+// Proxy is an HTTP proxy forwarding requests and CONNECT tunnels to the allowed hosts only
+type Proxy struct {
+	hosts     []string
+	listener  net.Listener
+	server    *http.Server
+	transport *http.Transport
+}
+
+// NewProxy starts a proxy listening on the unix socket path
+func NewProxy(path string, hosts []string) (*Proxy, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the sandbox proxy: %v", err)
+	}
+	p := &Proxy{
+		hosts:     hosts,
+		listener:  listener,
+		transport: &http.Transport{Proxy: nil, DialContext: (&net.Dialer{Timeout: dialTimeout}).DialContext},
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: dialTimeout}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+// Close stops the proxy
+func (p *Proxy) Close() error {
+	p.transport.CloseIdleConnections()
+	return p.server.Close()
+}
+
+// ServeHTTP implements the http.Handler interface
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Hostname()
+	if r.Method == http.MethodConnect {
+		host, _, _ = net.SplitHostPort(r.Host)
+	}
+	if !Allowed(p.hosts, host) {
+		slog.Warn("sandbox blocked a connection", "host", host)
+		http.Error(w, fmt.Sprintf("aiagent sandbox: %s is not an allowed host", host), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "aiagent sandbox: only proxy requests are served", http.StatusBadRequest)
+		return
+	}
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Connection")
+	r.Header.Del("Proxy-Authorization")
+	resp, err := p.transport.RoundTrip(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("aiagent sandbox: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel connects the client to the host of a CONNECT request
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, dialTimeout)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("aiagent sandbox: %v", err), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "aiagent sandbox: tunnels are not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	// Bytes the client sent after the request were read into the buffer
+	if n := buffered.Reader.Buffered(); n > 0 {
+		data, _ := buffered.Reader.Peek(n)
+		upstream.Write(data)
+	}
+	pipe(client, upstream)
+}
+
+// pipe copies between two connections until both directions are done
+func pipe(a, b net.Conn) {
+	done := make(chan struct{})
+	go func() {
+		io.Copy(a, b)
+		closeWrite(a)
+		close(done)
+	}()
+	io.Copy(b, a)
+	closeWrite(b)
+	<-done
+	a.Close()
+	b.Close()
+}
+
+// closeWrite signals the end of the data to the other side of a connection
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else {
+		c.Close()
+	}
+}
@@ -0,0 +1,161 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Egress policies of the executed commands
+const (
+	// EgressOpen leaves the network of the commands unrestricted
+	EgressOpen = "open"
+
+	// EgressNone cuts the commands off every network
+	EgressNone = "none"
+
+	// EgressAllowlist lets the commands reach the allowed hosts only, through a filtering proxy
+	EgressAllowlist = "allowlist"
+)
+
+// BridgeCommand is the hidden first argument running the executable as the bridge between the
+// network of a command and the proxy; the main function must call RunBridge with the remaining
+// arguments
+const BridgeCommand = "__sandbox-bridge"
+
+// bridgeAddr is where the proxy is reachable from inside the network of a command
+const bridgeAddr = "127.0.0.1:3128"
+
+// ErrUnsupported is returned when the platform cannot restrict the network of commands
+var ErrUnsupported = errors.New("network egress restrictions are only supported on Linux")
+
+// Options configure a Sandbox
+type Options struct {
+	// Egress is open, none or allowlist
+	Egress string
+
+	// AllowedHosts are the hosts reachable with the allowlist egress, e.g. github.com or *.golang.org
+	AllowedHosts []string
+}
+
+// Sandbox runs commands with restricted network access
+type Sandbox struct {
+	egress string
+	proxy  *Proxy
+
+	// executable runs the bridge; tests replace it with the test binary
+	executable string
+	dir        string
+}
+
+// New creates a sandbox and checks that the platform supports it, so a misconfiguration
+// fails before any command runs; it returns nil when the egress is open
+func New(opts Options) (*Sandbox, error) {
+	switch opts.Egress {
+	case "", EgressOpen:
+		return nil, nil
+	case EgressNone, EgressAllowlist:
+	default:
+		return nil, fmt.Errorf("unknown egress %q (expected %s, %s or %s)", opts.Egress, EgressOpen, EgressNone, EgressAllowlist)
+	}
+	if err := checkSupported(); err != nil {
+		return nil, err
+	}
+
+	s := &Sandbox{egress: opts.Egress}
+	if opts.Egress == EgressNone {
+		return s, nil
+	}
+
+	if err := ValidateHosts(opts.AllowedHosts); err != nil {
+		return nil, err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the executable running the sandbox bridge: %v", err)
+	}
+	dir, err := os.MkdirTemp("", "aiagent-sandbox-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox directory: %v", err)
+	}
+	proxy, err := NewProxy(filepath.Join(dir, "proxy.sock"), opts.AllowedHosts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	s.proxy, s.executable, s.dir = proxy, executable, dir
+	return s, nil
+}
+
+// Close stops the proxy of the sandbox
+func (s *Sandbox) Close() error {
+	if s.proxy == nil {
+		return nil
+	}
+	err := s.proxy.Close()
+	os.RemoveAll(s.dir)
+	return err
+}
+
+// Run runs a command with bash in the sandbox; it has the signature of nodes.CommandRunner
+func (s *Sandbox) Run(command, dir string) ([]byte, int, error) {
+	cmd := s.command(command)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	return output, exitCode, err
+}
+
+// proxyEnv returns the environment pointing the usual HTTP clients to the bridge
+func proxyEnv() []string {
+	var env []string
+	for _, e := range os.Environ() {
+		name, _, _ := strings.Cut(e, "=")
+		switch strings.ToUpper(name) {
+		case "HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "NO_PROXY":
+			continue
+		}
+		env = append(env, e)
+	}
+	url := "http://" + bridgeAddr
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY"} {
+		env = append(env, name+"="+url, strings.ToLower(name)+"="+url)
+	}
+	return env
+}
+
+// ValidateHosts checks the hosts of an allowlist
+func ValidateHosts(hosts []string) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("the allowlist egress requires allowed_hosts")
+	}
+	for _, host := range hosts {
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || strings.ContainsAny(name, "*/: ") {
+			return fmt.Errorf("invalid allowed host %q (expected e.g. github.com or *.golang.org)", host)
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether host matches one of hosts; *.example.com matches the subdomains
+// of example.com but not example.com itself
+func Allowed(hosts []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
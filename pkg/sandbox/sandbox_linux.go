@@ -0,0 +1,123 @@
+package sandbox
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// namespaces runs a process in new user and network namespaces; the network namespace has
+// a loopback interface only, so nothing outside the machine, nor the services of the
+// machine, can be reached
+func namespaces() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+	}
+}
+
+// setCredential makes cmd run as another user
+func setCredential(cmd *exec.Cmd, uid, gid uint32, groups []uint32) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uid, Gid: gid, Groups: groups}}
+	return nil
+}
+
+// checkSupported checks that unprivileged processes may create namespaces
+func checkSupported() error {
+	cmd := exec.Command("bash", "-c", "true")
+	cmd.SysProcAttr = namespaces()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create a network namespace (unprivileged user namespaces may be disabled): %v %s", err, output)
+	}
+	return nil
+}
+
+// command returns the command running a bash command in the sandbox
+func (s *Sandbox) command(command string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if s.proxy == nil {
+		cmd = exec.Command("bash", "-c", command)
+	} else {
+		cmd = exec.Command(s.executable, BridgeCommand, s.proxy.listener.Addr().String(), command)
+		cmd.Env = proxyEnv()
+	}
+	cmd.SysProcAttr = namespaces()
+	return cmd
+}
+
+// RunBridge runs in the network namespace of a command: it brings the loopback interface up,
+// forwards the connections to the proxy address to the unix socket of the proxy, and runs the
+// command with bash. It returns the exit code of the command
+func RunBridge(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <proxy socket> <command>\n", BridgeCommand)
+		return 2
+	}
+	socket, command := args[0], args[1]
+	if err := loopbackUp(); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: failed to bring up the loopback interface: %v\n", err)
+		return 125
+	}
+	listener, err := net.Listen("tcp", bridgeAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		return 125
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				proxy, err := net.Dial("unix", socket)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				pipe(conn, proxy)
+			}()
+		}
+	}()
+
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Run()
+	if cmd.ProcessState == nil {
+		return 127
+	}
+	if code := cmd.ProcessState.ExitCode(); code >= 0 {
+		return code
+	}
+	return 1
+}
+
+// loopbackUp sets the IFF_UP flag of the lo interface, like ip link set lo up
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// struct ifreq: the interface name followed by a union holding the flags
+	var req struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(req.name[:], "lo")
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	req.flags |= syscall.IFF_UP
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// checkSupported fails, as only Linux can run commands in their own network
+func checkSupported() error {
+	return ErrUnsupported
+}
+
+// setCredential fails, as switching users is only implemented on Linux; sudo works elsewhere
+func setCredential(cmd *exec.Cmd, uid, gid uint32, groups []uint32) error {
+	return fmt.Errorf("switching to another user is only supported on Linux; run the agent as a user allowed to use sudo")
+}
+
+func (s *Sandbox) command(command string) *exec.Cmd {
+	return exec.Command("bash", "-c", command)
+}
+
+// RunBridge fails, as there is no bridge without network namespaces
+func RunBridge(args []string) int {
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", ErrUnsupported)
+	return 125
+}
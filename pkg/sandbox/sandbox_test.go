@@ -0,0 +1,165 @@
+package sandbox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain lets the sandboxes of the tests run the test binary as their bridge
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == BridgeCommand {
+		os.Exit(RunBridge(os.Args[2:]))
+	}
+	os.Exit(m.Run())
+}
+
+func TestAllowed(t *testing.T) {
+	hosts := []string{"github.com", "*.golang.org"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"github.com", true},
+		{"GitHub.com.", true},
+		{"api.github.com", false},
+		{"proxy.golang.org", true},
+		{"golang.org", false},
+		{"evilgolang.org", false},
+		{"evil.sh", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Allowed(hosts, tt.host), tt.host)
+	}
+}
+
+func TestValidateHosts(t *testing.T) {
+	assert.NoError(t, ValidateHosts([]string{"github.com", "*.golang.org"}))
+	assert.Error(t, ValidateHosts(nil))
+	assert.Error(t, ValidateHosts([]string{"*"}))
+	assert.Error(t, ValidateHosts([]string{"github.com:443"}))
+	assert.Error(t, ValidateHosts([]string{"https://github.com"}))
+}
+
+func TestNew_Open(t *testing.T) {
+	s, err := New(Options{Egress: EgressOpen})
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	_, err = New(Options{Egress: "some"})
+	assert.ErrorContains(t, err, `unknown egress "some"`)
+}
+
+// proxyRequest sends raw to the proxy listening on path and returns the status line of the answer
+func proxyRequest(t *testing.T, path, raw string) (string, *bufio.Reader, net.Conn) {
+	t.Helper()
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_, err = io.WriteString(conn, raw)
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimSpace(status), reader, conn
+}
+
+func TestProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+	}))
+	defer target.Close()
+	targetHost := strings.TrimPrefix(target.URL, "http://")
+
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+	proxy, err := NewProxy(path, []string{"127.0.0.1"})
+	require.NoError(t, err)
+	defer proxy.Close()
+
+	t.Run("allowed request", func(t *testing.T) {
+		status, reader, _ := proxyRequest(t, path, "GET "+target.URL+"/ HTTP/1.1\r\nHost: "+targetHost+"\r\nConnection: close\r\n\r\n")
+		assert.Equal(t, "HTTP/1.1 200 OK", status)
+		body, _ := io.ReadAll(reader)
+		assert.Contains(t, string(body), "hello")
+	})
+
+	t.Run("allowed tunnel", func(t *testing.T) {
+		status, reader, conn := proxyRequest(t, path, "CONNECT "+targetHost+" HTTP/1.1\r\nHost: "+targetHost+"\r\n\r\n")
+		assert.Equal(t, "HTTP/1.1 200 Connection established", status)
+		reader.ReadString('\n')
+		io.WriteString(conn, "GET / HTTP/1.1\r\nHost: "+targetHost+"\r\nConnection: close\r\n\r\n")
+		body, _ := io.ReadAll(reader)
+		assert.Contains(t, string(body), "hello")
+	})
+
+	t.Run("blocked hosts", func(t *testing.T) {
+		status, _, _ := proxyRequest(t, path, "GET http://evil.sh/install HTTP/1.1\r\nHost: evil.sh\r\n\r\n")
+		assert.Equal(t, "HTTP/1.1 403 Forbidden", status)
+		status, _, _ = proxyRequest(t, path, "CONNECT evil.sh:443 HTTP/1.1\r\nHost: evil.sh:443\r\n\r\n")
+		assert.Equal(t, "HTTP/1.1 403 Forbidden", status)
+	})
+}
+
+// newSandbox creates a sandbox, or skips the test where the platform has none
+func newSandbox(t *testing.T, opts Options) *Sandbox {
+	t.Helper()
+	s, err := New(opts)
+	if err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSandbox_EgressNone(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	s := newSandbox(t, Options{Egress: EgressNone})
+	output, exitCode, err := s.Run("echo ok; echo > /dev/tcp/127.0.0.1/"+port, t.TempDir())
+	assert.Error(t, err)
+	assert.Equal(t, 1, exitCode)
+	assert.Contains(t, string(output), "ok")
+
+	output, exitCode, err = s.Run("exit 3", t.TempDir())
+	assert.Error(t, err)
+	assert.Equal(t, 3, exitCode, string(output))
+}
+
+func TestSandbox_EgressAllowlist(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+	}))
+	defer target.Close()
+
+	s := newSandbox(t, Options{Egress: EgressAllowlist, AllowedHosts: []string{"127.0.0.1"}})
+
+	// The proxy in the environment is the only way out
+	request := func(url string) string {
+		return `proxy=${HTTP_PROXY#http://}; exec 3<>/dev/tcp/${proxy%:*}/${proxy#*:}; ` +
+			`printf 'GET ` + url + ` HTTP/1.0\r\n\r\n' >&3; cat <&3`
+	}
+	output, exitCode, err := s.Run(request(target.URL+"/"), t.TempDir())
+	require.NoError(t, err, string(output))
+	assert.Equal(t, 0, exitCode)
+	assert.Contains(t, string(output), "hello")
+
+	output, _, _ = s.Run(request("http://evil.sh/install"), t.TempDir())
+	assert.Contains(t, string(output), "403 Forbidden")
+
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(target.URL, "http://"))
+	_, _, err = s.Run("echo > /dev/tcp/127.0.0.1/"+port, t.TempDir())
+	assert.Error(t, err)
+}
@@ -0,0 +1,149 @@
+package sandbox
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// userEnv are the variables of the agent's environment the commands of the user keep;
+// the rest, e.g. API keys, stay with the agent
+var userEnv = []string{"PATH", "LANG", "TERM"}
+
+// defaultPath is the PATH of the commands when the agent has none
+const defaultPath = "/usr/local/bin:/usr/bin:/bin"
+
+// Replaced in tests
+var (
+	lookPath = exec.LookPath
+	geteuid  = os.Geteuid
+)
+
+// User runs commands as another, unprivileged user, so even approved commands cannot touch
+// the files of the user running the agent. Running as root, the agent switches to the user
+// itself; otherwise it runs the commands with sudo -n -u, which needs a sudoers rule letting
+// it do so without a password
+type User struct {
+	name string
+	home string
+	uid  uint32
+	gid  uint32
+
+	// groups are the supplementary groups of the user
+	groups []uint32
+
+	// sudo is the path of sudo when the agent is not root
+	sudo string
+
+	// env are the names of the extra variables passed on to the commands
+	env []string
+}
+
+// NewUser checks that commands can run as the user named name and returns the runner
+// The commands only see PATH, LANG and TERM of the agent's environment, the variables named
+// in env, and HOME, USER and LOGNAME of the user
+func NewUser(name string, env []string) (*User, error) {
+	account, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown user %q: %v", name, err)
+	}
+	u := &User{name: account.Username, home: account.HomeDir, env: env}
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: commands can only run as another user on Unix", name)
+	}
+	gid, err := strconv.ParseUint(account.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: invalid group ID %s", name, account.Gid)
+	}
+	if uid == 0 {
+		return nil, fmt.Errorf("user %s is root; commands must run as an unprivileged user", name)
+	}
+	if int(uid) == geteuid() {
+		return nil, fmt.Errorf("user %s is the user running the agent; commands must run as another user", name)
+	}
+	u.uid, u.gid = uint32(uid), uint32(gid)
+
+	if geteuid() == 0 {
+		if err := setCredential(&exec.Cmd{}, u.uid, u.gid, nil); err != nil {
+			return nil, err
+		}
+		groups, err := account.GroupIds()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the groups of %s: %v", name, err)
+		}
+		for _, group := range groups {
+			if id, err := strconv.ParseUint(group, 10, 32); err == nil {
+				u.groups = append(u.groups, uint32(id))
+			}
+		}
+		return u, nil
+	}
+
+	if u.sudo, err = lookPath("sudo"); err != nil {
+		return nil, fmt.Errorf("sudo is required to run commands as %s: %v", name, err)
+	}
+	// sudo must not ask for a password in the middle of a run
+	check := exec.Command(u.sudo, "-n", "-u", u.name, "--", "true")
+	var stderr bytes.Buffer
+	check.Stderr = &stderr
+	if err := check.Run(); err != nil {
+		return nil, fmt.Errorf("cannot run commands as %s with sudo -n (add a sudoers rule without a password): %s",
+			name, strings.TrimSpace(stderr.String()))
+	}
+	return u, nil
+}
+
+// Name returns the name of the user
+func (u *User) Name() string {
+	return u.name
+}
+
+// Run runs a command with bash as the user; it has the signature of nodes.CommandRunner
+func (u *User) Run(command, dir string) ([]byte, int, error) {
+	cmd, err := u.command(command)
+	if err != nil {
+		return nil, -1, err
+	}
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	return output, exitCode, err
+}
+
+// command returns the command running a bash command as the user
+func (u *User) command(command string) (*exec.Cmd, error) {
+	if u.sudo != "" {
+		cmd := exec.Command(u.sudo, "-n", "-u", u.name, "--", "bash", "-c", command)
+		cmd.Env = u.environ()
+		return cmd, nil
+	}
+	cmd := exec.Command("bash", "-c", command)
+	if err := setCredential(cmd, u.uid, u.gid, u.groups); err != nil {
+		return nil, err
+	}
+	cmd.Env = u.environ()
+	return cmd, nil
+}
+
+// environ returns the environment of the commands: the environment of the agent names its
+// own user and home, and holds its secrets, so only the allowed variables are copied
+func (u *User) environ() []string {
+	env := []string{"HOME=" + u.home, "USER=" + u.name, "LOGNAME=" + u.name}
+	if _, ok := os.LookupEnv("PATH"); !ok {
+		env = append(env, "PATH="+defaultPath)
+	}
+	for _, name := range append(append([]string{}, userEnv...), u.env...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
@@ -0,0 +1,87 @@
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUser_Refused(t *testing.T) {
+	_, err := NewUser("root", nil)
+	assert.ErrorContains(t, err, "user root is root")
+
+	_, err = NewUser("no-such-user-aiagent", nil)
+	assert.ErrorContains(t, err, `unknown user "no-such-user-aiagent"`)
+}
+
+// fakeSudo makes the tests find a sudo script instead of sudo, and pretends the agent is not root
+func fakeSudo(t *testing.T, script string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sudo")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755))
+	lookPath = func(string) (string, error) { return path, nil }
+	geteuid = func() int { return 1000 }
+	t.Cleanup(func() { lookPath, geteuid = exec.LookPath, os.Geteuid })
+}
+
+func TestNewUser_Sudo(t *testing.T) {
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skip("the nobody user does not exist")
+	}
+
+	// The script checks the arguments and runs the command without switching users
+	fakeSudo(t, `[ "$1 $2 $3 $4" = "-n -u nobody --" ] || exit 2; shift 4; exec "$@"`)
+	u, err := NewUser("nobody", nil)
+	require.NoError(t, err)
+	output, exitCode, err := u.Run("echo ran in $PWD; exit 3", "/")
+	assert.Error(t, err)
+	assert.Equal(t, 3, exitCode)
+	assert.Equal(t, "ran in /\n", string(output))
+
+	fakeSudo(t, `echo "sudo: a password is required" >&2; exit 1`)
+	_, err = NewUser("nobody", nil)
+	assert.ErrorContains(t, err, "cannot run commands as nobody with sudo -n (add a sudoers rule without a password): sudo: a password is required")
+}
+
+func TestUser_Environment(t *testing.T) {
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skip("the nobody user does not exist")
+	}
+	t.Setenv("OPENAI_API_KEY", "sk-secret")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("LANG", "C.UTF-8")
+
+	// The script passes its environment on, so the test sees what sudo is given
+	fakeSudo(t, `shift 4; exec "$@"`)
+	u, err := NewUser("nobody", []string{"GOFLAGS"})
+	require.NoError(t, err)
+	output, _, err := u.Run("echo key=$OPENAI_API_KEY; echo flags=$GOFLAGS; echo lang=$LANG; echo user=$USER", "/")
+	require.NoError(t, err)
+	assert.Equal(t, "key=\nflags=-mod=mod\nlang=C.UTF-8\nuser=nobody\n", string(output))
+}
+
+func TestUser_RunAsRoot(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users needs root")
+	}
+	u, err := NewUser("nobody", nil)
+	if err != nil {
+		t.Skipf("cannot run as nobody: %v", err)
+	}
+
+	// Commands run as the user, and cannot write the files of the agent
+	private := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(private, "secret"), []byte("x"), 0600))
+	output, exitCode, err := u.Run("id -un; echo $HOME; cat "+filepath.Join(private, "secret"), "/")
+	assert.Error(t, err)
+	assert.Equal(t, 1, exitCode)
+	lines := strings.Split(string(output), "\n")
+	assert.Equal(t, "nobody", lines[0])
+	assert.Contains(t, string(output), "Permission denied")
+}
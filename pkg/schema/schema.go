@@ -0,0 +1,93 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// VersionField is the JSON field holding the schema version of a persisted document
+const VersionField = "schema_version"
+
+// Migration upgrades a decoded document by exactly one schema version
+// It modifies the document in place
+type Migration func(doc map[string]any) error
+
+// Migrator upgrades persisted documents to the current schema version before decoding them
+// Documents without a version field are treated as version 1, the original unversioned format
+type Migrator struct {
+	name       string
+	current    int
+	migrations map[int]Migration
+}
+
+// NewMigrator creates a new migrator for the named document type at the given current version
+func NewMigrator(name string, current int) *Migrator {
+	return &Migrator{
+		name:       name,
+		current:    current,
+		migrations: make(map[int]Migration),
+	}
+}
+
+// Current returns the current schema version
+func (m *Migrator) Current() int {
+	return m.current
+}
+
+// Register adds the migration that upgrades documents from version `from` to `from+1`
+func (m *Migrator) Register(from int, migration Migration) {
+	m.migrations[from] = migration
+}
+
+// Decode upgrades the document to the current version and unmarshals it into v
+func (m *Migrator) Decode(data []byte, v any) error {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", m.name, err)
+	}
+
+	version, err := documentVersion(doc)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", m.name, err)
+	}
+
+	if version > m.current {
+		return fmt.Errorf("%s has schema version %d but this version of aiagent only supports up to %d; please upgrade", m.name, version, m.current)
+	}
+
+	if version < m.current || doc[VersionField] == nil {
+		for ; version < m.current; version++ {
+			migration, ok := m.migrations[version]
+			if !ok {
+				return fmt.Errorf("no migration registered for %s from schema version %d", m.name, version)
+			}
+			if err := migration(doc); err != nil {
+				return fmt.Errorf("failed to migrate %s from schema version %d: %v", m.name, version, err)
+			}
+		}
+		doc[VersionField] = m.current
+
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("failed to encode migrated %s: %v", m.name, err)
+		}
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", m.name, err)
+	}
+	return nil
+}
+
+// documentVersion returns the schema version stored in a document
+func documentVersion(doc map[string]any) (int, error) {
+	raw, ok := doc[VersionField]
+	if !ok || raw == nil {
+		return 1, nil
+	}
+
+	version, ok := raw.(float64)
+	if !ok || version < 1 || version != float64(int(version)) {
+		return 0, fmt.Errorf("%s must be a positive integer, got %v", VersionField, raw)
+	}
+	return int(version), nil
+}
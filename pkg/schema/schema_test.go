@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type document struct {
+	SchemaVersion int    `json:"schema_version"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+}
+
+func TestMigrator_Decode(t *testing.T) {
+	migrator := NewMigrator("document", 3)
+	migrator.Register(1, func(doc map[string]any) error {
+		// Version 2 renamed "name" to "title"
+		doc["title"] = doc["name"]
+		delete(doc, "name")
+		return nil
+	})
+	migrator.Register(2, func(doc map[string]any) error {
+		// Version 3 introduced a mandatory author
+		doc["author"] = "unknown"
+		return nil
+	})
+
+	tests := []struct {
+		name     string
+		input    string
+		expected document
+		wantErr  bool
+	}{
+		{
+			name:     "unversioned document is migrated from version 1",
+			input:    `{"name": "notes"}`,
+			expected: document{SchemaVersion: 3, Title: "notes", Author: "unknown"},
+		},
+		{
+			name:     "intermediate version only runs remaining migrations",
+			input:    `{"schema_version": 2, "title": "notes"}`,
+			expected: document{SchemaVersion: 3, Title: "notes", Author: "unknown"},
+		},
+		{
+			name:     "current version is decoded as is",
+			input:    `{"schema_version": 3, "title": "notes", "author": "me"}`,
+			expected: document{SchemaVersion: 3, Title: "notes", Author: "me"},
+		},
+		{
+			name:    "newer version is rejected",
+			input:   `{"schema_version": 4, "title": "notes"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid version is rejected",
+			input:   `{"schema_version": "two"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc document
+			err := migrator.Decode([]byte(tt.input), &doc)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, doc)
+		})
+	}
+}
+
+func TestMigrator_MissingMigration(t *testing.T) {
+	migrator := NewMigrator("document", 2)
+
+	var doc document
+	assert.Error(t, migrator.Decode([]byte(`{"title": "notes"}`), &doc))
+}
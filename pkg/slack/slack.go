@@ -0,0 +1,235 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the base URL of the Slack Web API
+	DefaultBaseURL = "https://slack.com/api"
+
+	// maxRequestAge is the maximum age of a signed request, against replays
+	maxRequestAge = 5 * time.Minute
+)
+
+// Verify checks the signature Slack adds to the requests it sends, using the signing secret of the app
+// See https://api.slack.com/authentication/verifying-requests-from-slack
+func Verify(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing request timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return fmt.Errorf("request timestamp is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("invalid request signature")
+	}
+	return nil
+}
+
+// Envelope is the body of a request of the Events API
+type Envelope struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge,omitempty"`
+	EventID   string `json:"event_id,omitempty"`
+	Event     Event  `json:"event"`
+}
+
+// Event is a message or mention event of the Events API
+type Event struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype,omitempty"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id,omitempty"`
+	Text        string `json:"text"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type,omitempty"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts,omitempty"`
+}
+
+// Interaction is the payload sent when a user clicks a button of a message
+type Interaction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Message struct {
+		TS       string `json:"ts"`
+		ThreadTS string `json:"thread_ts,omitempty"`
+	} `json:"message"`
+	Actions []Action `json:"actions"`
+}
+
+// Action is a clicked button
+type Action struct {
+	ActionID string `json:"action_id"`
+	Value    string `json:"value"`
+}
+
+// Message is a message posted or updated through the Web API
+type Message struct {
+	Channel  string  `json:"channel"`
+	TS       string  `json:"ts,omitempty"`
+	ThreadTS string  `json:"thread_ts,omitempty"`
+	Text     string  `json:"text"`
+	Blocks   []Block `json:"blocks,omitempty"`
+}
+
+// Block is a Block Kit layout block
+type Block map[string]any
+
+// Section returns a section block with Markdown text
+func Section(text string) Block {
+	return Block{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}}
+}
+
+// Button is a button of an actions block
+type Button struct {
+	ActionID string
+	Text     string
+	Value    string
+
+	// Style is "primary", "danger" or empty
+	Style string
+}
+
+// Actions returns an actions block with buttons
+func Actions(buttons ...Button) Block {
+	elements := make([]map[string]any, 0, len(buttons))
+	for _, button := range buttons {
+		element := map[string]any{
+			"type":      "button",
+			"action_id": button.ActionID,
+			"value":     button.Value,
+			"text":      map[string]string{"type": "plain_text", "text": button.Text},
+		}
+		if button.Style != "" {
+			element["style"] = button.Style
+		}
+		elements = append(elements, element)
+	}
+	return Block{"type": "actions", "elements": elements}
+}
+
+// Client calls the Slack Web API with a bot token
+type Client struct {
+	Token   string
+	BaseURL string
+	client  *http.Client
+}
+
+// NewClient creates a new instance of Client
+func NewClient(token string) *Client {
+	return &Client{
+		Token:   token,
+		BaseURL: DefaultBaseURL,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// PostMessage posts a message and returns its timestamp, which identifies it in the channel
+func (c *Client) PostMessage(ctx context.Context, message Message) (string, error) {
+	var response struct {
+		TS string `json:"ts"`
+	}
+	if err := c.call(ctx, "chat.postMessage", message, &response); err != nil {
+		return "", err
+	}
+	return response.TS, nil
+}
+
+// UpdateMessage replaces the text and blocks of the message with the timestamp message.TS
+func (c *Client) UpdateMessage(ctx context.Context, message Message) error {
+	return c.call(ctx, "chat.update", message, nil)
+}
+
+// Reaction is an emoji added to a message and the users who added it
+type Reaction struct {
+	Name  string   `json:"name"`
+	Users []string `json:"users"`
+}
+
+// Reactions returns the reactions to the message with the timestamp ts
+func (c *Client) Reactions(ctx context.Context, channel, ts string) ([]Reaction, error) {
+	var response struct {
+		Message struct {
+			Reactions []Reaction `json:"reactions"`
+		} `json:"message"`
+	}
+	// Reading methods of the Web API do not accept JSON bodies
+	query := url.Values{"channel": {channel}, "timestamp": {ts}, "full": {"true"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/reactions.get?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reactions.get request: %v", err)
+	}
+	if err := c.do(req, "reactions.get", &response); err != nil {
+		return nil, err
+	}
+	return response.Message.Reactions, nil
+}
+
+func (c *Client) call(ctx context.Context, method string, request, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %v", method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %v", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return c.do(req, method, response)
+}
+
+// do sends a request of the Web API and decodes its response
+func (c *Client) do(req *http.Request, method string, response any) error {
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", method, resp.StatusCode)
+	}
+
+	// The Web API reports errors in the body of successful responses
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("failed to decode %s response: %v", method, err)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	json.Unmarshal(raw, &status)
+	if !status.OK {
+		return fmt.Errorf("%s failed: %s", method, status.Error)
+	}
+	if response != nil {
+		return json.Unmarshal(raw, response)
+	}
+	return nil
+}
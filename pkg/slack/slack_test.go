@@ -0,0 +1,87 @@
+package slack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(secret string, timestamp time.Time, body string) http.Header {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	header := http.Header{}
+	header.Set("X-Slack-Request-Timestamp", ts)
+	header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"event_callback"}`)
+
+	assert.NoError(t, Verify("secret", sign("secret", now, string(body)), body, now))
+	assert.NoError(t, Verify("secret", sign("secret", now.Add(-time.Minute), string(body)), body, now))
+
+	assert.EqualError(t, Verify("other", sign("secret", now, string(body)), body, now), "invalid request signature")
+	assert.EqualError(t, Verify("secret", sign("secret", now, string(body)), []byte(`{}`), now), "invalid request signature")
+	assert.EqualError(t, Verify("secret", sign("secret", now.Add(-10*time.Minute), string(body)), body, now), "request timestamp is too old")
+	assert.EqualError(t, Verify("secret", http.Header{}, body, now), "missing request timestamp")
+}
+
+func TestClient(t *testing.T) {
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xoxb-token", r.Header.Get("Authorization"))
+		var request map[string]any
+		json.NewDecoder(r.Body).Decode(&request)
+		request["method"] = r.URL.Path
+		requests = append(requests, request)
+
+		if request["channel"] == "missing" {
+			fmt.Fprint(w, `{"ok": false, "error": "channel_not_found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok": true, "ts": "1700000000.000100"}`)
+	}))
+	defer server.Close()
+
+	client := NewClient("xoxb-token")
+	client.BaseURL = server.URL
+
+	ts, err := client.PostMessage(context.Background(), Message{Channel: "C1", ThreadTS: "1.2", Text: "hello", Blocks: []Block{Section("hello")}})
+	assert.NoError(t, err)
+	assert.Equal(t, "1700000000.000100", ts)
+
+	assert.NoError(t, client.UpdateMessage(context.Background(), Message{Channel: "C1", TS: ts, Text: "done"}))
+
+	_, err = client.PostMessage(context.Background(), Message{Channel: "missing", Text: "hello"})
+	assert.EqualError(t, err, "chat.postMessage failed: channel_not_found")
+
+	assert.Len(t, requests, 3)
+	assert.Equal(t, "/chat.postMessage", requests[0]["method"])
+	assert.Equal(t, "1.2", requests[0]["thread_ts"])
+	assert.Len(t, requests[0]["blocks"], 1)
+	assert.Equal(t, "/chat.update", requests[1]["method"])
+	assert.Equal(t, ts, requests[1]["ts"])
+}
+
+func TestActions(t *testing.T) {
+	block := Actions(Button{ActionID: "approve", Text: "Approve", Value: "r/1", Style: "primary"}, Button{ActionID: "reject", Text: "Reject", Value: "r/1"})
+	data, err := json.Marshal(block)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "actions", "elements": [
+		{"type": "button", "action_id": "approve", "value": "r/1", "style": "primary", "text": {"type": "plain_text", "text": "Approve"}},
+		{"type": "button", "action_id": "reject", "value": "r/1", "text": {"type": "plain_text", "text": "Reject"}}
+	]}`, string(data))
+}
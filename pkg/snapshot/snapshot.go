@@ -0,0 +1,312 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DirName is the folder of the data directory holding the snapshots
+	DirName = "snapshots"
+
+	// dataDirName is the folder where the agent keeps its local data, see history.DirName
+	dataDirName = ".aiagent"
+
+	// manifestFile is the name of the manifest in the folder of a run
+	manifestFile = "manifest.json"
+
+	// objectsDir holds the original contents by their SHA-256
+	objectsDir = "objects"
+)
+
+// ErrNotFound is returned for a run without a snapshot
+var ErrNotFound = errors.New("no snapshot of this run")
+
+// Manifest lists the files a run wrote with the SHA-256 of their contents before and after
+type Manifest struct {
+	RunID   string    `json:"run_id"`
+	Created time.Time `json:"created"`
+	Files   []File    `json:"files"`
+}
+
+// File is a file written by a run
+type File struct {
+	// Path is relative to the working tree
+	Path string `json:"path"`
+
+	// Before is the SHA-256 of the content before the run; empty if the file did not exist
+	Before string      `json:"before,omitempty"`
+	Mode   fs.FileMode `json:"mode,omitempty"`
+
+	// After is the SHA-256 of the content the run left behind
+	After string `json:"after"`
+}
+
+// Mismatch is a file whose content differs from what a run left behind
+type Mismatch struct {
+	Path     string
+	Expected string
+
+	// Actual is the SHA-256 of the current content; empty if the file is missing
+	Actual string
+}
+
+// Store keeps the snapshots of the files the runs write in a working tree, in
+// .aiagent/snapshots/<run-id>; the original contents are stored once by their SHA-256
+type Store struct {
+	root string
+	dir  string
+
+	mu sync.Mutex
+}
+
+// New creates the snapshot store of the working tree root
+func New(root string) *Store {
+	return &Store{root: root, dir: filepath.Join(root, dataDirName, DirName)}
+}
+
+// Record wraps the writes of a run: the first time a run writes a file, its original content
+// is saved; write then writes content to file, and only once it succeeded the manifest records
+// content as what the run left behind. A failed write leaves the manifest unchanged
+func (s *Store) Record(runID, file string, content []byte, write func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rel, err := s.relative(file)
+	if err != nil {
+		return err
+	}
+	manifest, err := s.load(runID)
+	if errors.Is(err, ErrNotFound) {
+		manifest, err = &Manifest{RunID: runID, Created: time.Now()}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(manifest.Files, func(f File) bool { return f.Path == rel })
+	var entry File
+	if i >= 0 {
+		entry = manifest.Files[i]
+	} else {
+		entry = File{Path: rel}
+		original, err := os.ReadFile(filepath.Join(s.root, filepath.FromSlash(rel)))
+		switch {
+		case err == nil:
+			if entry.Before, err = s.saveObject(original); err != nil {
+				return err
+			}
+			if info, err := os.Stat(filepath.Join(s.root, filepath.FromSlash(rel))); err == nil {
+				entry.Mode = info.Mode().Perm()
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return fmt.Errorf("failed to back up %s: %v", rel, err)
+		}
+	}
+
+	if err := write(); err != nil {
+		return err
+	}
+	entry.After = hash(content)
+	if i >= 0 {
+		manifest.Files[i] = entry
+	} else {
+		manifest.Files = append(manifest.Files, entry)
+	}
+	return s.save(manifest)
+}
+
+// Runs returns the IDs of the runs with a snapshot, oldest first
+func (s *Store) Runs() ([]string, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots: %v", err)
+	}
+	var runs []string
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(s.dir, dir.Name(), manifestFile)); err == nil {
+			runs = append(runs, dir.Name())
+		}
+	}
+	return runs, nil // Run IDs start with their start time
+}
+
+// Load returns the manifest of a run
+func (s *Store) Load(runID string) (*Manifest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(runID)
+}
+
+// Verify compares the working tree with what a run left behind and returns the files changed
+// since, e.g. by manual edits
+func (s *Store) Verify(runID string) ([]Mismatch, error) {
+	manifest, err := s.Load(runID)
+	if err != nil {
+		return nil, err
+	}
+	var mismatches []Mismatch
+	for _, file := range manifest.Files {
+		actual, err := hashFile(filepath.Join(s.root, filepath.FromSlash(file.Path)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if actual != file.After {
+			mismatches = append(mismatches, Mismatch{Path: file.Path, Expected: file.After, Actual: actual})
+		}
+	}
+	return mismatches, nil
+}
+
+// Restore rolls the files written by a run back to their original contents, removing the
+// files the run created. It refuses when the working tree changed since the run, unless
+// force is set, and when a saved content does not match its SHA-256
+func (s *Store) Restore(runID string, force bool) ([]File, error) {
+	mismatches, err := s.Verify(runID)
+	if err != nil {
+		return nil, err
+	}
+	if len(mismatches) > 0 && !force {
+		paths := make([]string, len(mismatches))
+		for i, m := range mismatches {
+			paths[i] = m.Path
+		}
+		return nil, fmt.Errorf("files changed since the run: %s (use --force to overwrite them)", strings.Join(paths, ", "))
+	}
+	manifest, err := s.Load(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every saved content is verified before the first file is touched
+	originals := make(map[string][]byte)
+	for _, file := range manifest.Files {
+		if file.Before == "" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(s.dir, objectsDir, file.Before))
+		if err != nil {
+			return nil, fmt.Errorf("the backup of %s is missing: %v", file.Path, err)
+		}
+		if hash(content) != file.Before {
+			return nil, fmt.Errorf("the backup of %s is corrupted: its SHA-256 does not match the manifest", file.Path)
+		}
+		originals[file.Path] = content
+	}
+
+	for _, file := range manifest.Files {
+		path := filepath.Join(s.root, filepath.FromSlash(file.Path))
+		if file.Before == "" {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("failed to remove %s: %v", file.Path, err)
+			}
+			continue
+		}
+		mode := file.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %v", file.Path, err)
+		}
+		if err := os.WriteFile(path, originals[file.Path], mode); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %v", file.Path, err)
+		}
+	}
+	return manifest.Files, nil
+}
+
+// relative returns the slash separated path of file relative to the working tree
+func (s *Store) relative(file string) (string, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(s.root, file)
+	}
+	rel, err := filepath.Rel(s.root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("cannot back up %s: it is outside of the working tree", file)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// load reads the manifest of a run; the caller must hold the lock
+func (s *Store) load(runID string) (*Manifest, error) {
+	if runID == "" || runID == "." || runID == ".." || runID != filepath.Base(runID) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, runID, manifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid snapshot manifest of %s: %v", runID, err)
+	}
+	return &manifest, nil
+}
+
+// save writes the manifest of a run; the caller must hold the lock
+func (s *Store) save(manifest *Manifest) error {
+	if manifest.RunID == "" || manifest.RunID != filepath.Base(manifest.RunID) {
+		return fmt.Errorf("invalid run ID %q for a snapshot", manifest.RunID)
+	}
+	dir := filepath.Join(s.dir, manifest.RunID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %v", err)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The manifest is replaced atomically, so a crash never leaves half of it
+	tmp := filepath.Join(dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save snapshot manifest: %v", err)
+	}
+	return os.Rename(tmp, filepath.Join(dir, manifestFile))
+}
+
+// saveObject stores content by its SHA-256 and returns it
+func (s *Store) saveObject(content []byte) (string, error) {
+	sum := hash(content)
+	dir := filepath.Join(s.dir, objectsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %v", err)
+	}
+	path := filepath.Join(dir, sum)
+	if _, err := os.Stat(path); err == nil {
+		return sum, nil
+	}
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		return "", fmt.Errorf("failed to save backup: %v", err)
+	}
+	return sum, nil
+}
+
+func hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func hashFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return hash(content), nil
+}
@@ -0,0 +1,105 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write records and writes content like the agent does
+func write(t *testing.T, s *Store, runID, root, file, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, file)), 0755))
+	require.NoError(t, s.Record(runID, file, []byte(content), func() error {
+		return os.WriteFile(filepath.Join(root, file), []byte(content), 0644)
+	}))
+}
+
+func TestStore_VerifyRestore(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.go"), []byte("original"), 0600))
+	s := New(root)
+
+	write(t, s, "run-1", root, "main.go", "first fix")
+	write(t, s, "run-1", root, "main.go", "second fix")
+	write(t, s, "run-1", root, "pkg/new.go", "generated")
+
+	manifest, err := s.Load("run-1")
+	require.NoError(t, err)
+	require.Len(t, manifest.Files, 2)
+	assert.Equal(t, hash([]byte("original")), manifest.Files[0].Before)
+	assert.Equal(t, hash([]byte("second fix")), manifest.Files[0].After)
+	assert.Empty(t, manifest.Files[1].Before)
+
+	mismatches, err := s.Verify("run-1")
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	// A manual edit interleaved after the run is detected and protected
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.go"), []byte("manual edit"), 0644))
+	mismatches, err = s.Verify("run-1")
+	require.NoError(t, err)
+	assert.Equal(t, []Mismatch{{Path: "main.go", Expected: hash([]byte("second fix")), Actual: hash([]byte("manual edit"))}}, mismatches)
+	_, err = s.Restore("run-1", false)
+	assert.ErrorContains(t, err, "files changed since the run: main.go")
+
+	files, err := s.Restore("run-1", true)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+	data, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	assert.Equal(t, "original", string(data))
+	info, _ := os.Stat(filepath.Join(root, "main.go"))
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.NoFileExists(t, filepath.Join(root, "pkg", "new.go"))
+
+	runs, err := s.Runs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run-1"}, runs)
+	_, err = s.Verify("run-2")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestStore_RestoreCorruptedBackup(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.go"), []byte("original"), 0644))
+	s := New(root)
+	write(t, s, "run-1", root, "main.go", "fix")
+
+	object := filepath.Join(root, ".aiagent", DirName, objectsDir, hash([]byte("original")))
+	require.NoError(t, os.WriteFile(object, []byte("tampered"), 0600))
+
+	_, err := s.Restore("run-1", false)
+	assert.ErrorContains(t, err, "the backup of main.go is corrupted")
+	data, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	assert.Equal(t, "fix", string(data))
+}
+
+func TestStore_RecordFailedWrite(t *testing.T) {
+	root := t.TempDir()
+	s := New(root)
+	failed := errors.New("disk full")
+	fail := func() error { return failed }
+
+	// A file the run never managed to write is not part of the snapshot
+	assert.ErrorIs(t, s.Record("run-1", "main.go", []byte("fix"), fail), failed)
+	_, err := s.Load("run-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// A failed write keeps the content the run left behind before
+	write(t, s, "run-1", root, "main.go", "first fix")
+	assert.ErrorIs(t, s.Record("run-1", "main.go", []byte("second fix"), fail), failed)
+	mismatches, err := s.Verify("run-1")
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+}
+
+func TestStore_RecordOutsideTree(t *testing.T) {
+	s := New(t.TempDir())
+	noWrite := func() error { return nil }
+	assert.ErrorContains(t, s.Record("run-1", "../etc/passwd", nil, noWrite), "outside of the working tree")
+	assert.Error(t, s.Record("../run", "main.go", nil, noWrite))
+}
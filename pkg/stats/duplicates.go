@@ -0,0 +1,394 @@
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMinTokens is the size of the smallest duplicate reported, in tokens
+	DefaultMinTokens = 60
+
+	// maxOccurrences limits the copies of a block that are compared, so a pattern repeated
+	// all over the tree does not take quadratic time
+	maxOccurrences = 50
+
+	// shingleBase is the base of the rolling hash of the shingles
+	shingleBase = 1099511628211
+)
+
+// hashComments are the languages whose comments start with #
+var hashComments = map[string]bool{"Python": true, "Shell": true, "Ruby": true, "Makefile": true, "Dockerfile": true}
+
+// keywords are kept when identifiers are normalized, so normalized code keeps its structure
+var keywords = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true, "def": true,
+	"default": true, "defer": true, "do": true, "else": true, "elif": true, "fn": true, "for": true, "func": true,
+	"go": true, "if": true, "import": true, "in": true, "let": true, "match": true, "new": true, "nil": true,
+	"null": true, "package": true, "range": true, "return": true, "select": true, "static": true, "struct": true,
+	"switch": true, "throw": true, "try": true, "type": true, "var": true, "while": true, "with": true,
+}
+
+// DuplicateOptions configure FindDuplicates
+type DuplicateOptions struct {
+	// MinTokens is the size of the smallest duplicate reported; DefaultMinTokens if zero
+	MinTokens int
+
+	// Normalize also finds copies whose identifiers and literals were changed, e.g. renamed
+	Normalize bool
+
+	// Tests includes the test files, which often repeat their setup on purpose
+	Tests bool
+}
+
+// Duplicate is a block of code found in several places
+type Duplicate struct {
+	Tokens    int        `json:"tokens"`
+	Lines     int        `json:"lines"`
+	Locations []Location `json:"locations"`
+}
+
+// Location is a range of lines of a file; Path is slash separated and relative to the root
+type Location struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s:%d-%d", l.Path, l.StartLine, l.EndLine)
+}
+
+// token is a word, literal or punctuation of a source file with its line
+type token struct {
+	text string
+	line int
+}
+
+// source is a tokenized source file
+type source struct {
+	path   string
+	tokens []token
+	hashes []uint64
+}
+
+// occurrence is a shingle, a sequence of MinTokens tokens, at a position of a source
+type occurrence struct {
+	source, pos int
+}
+
+// match is a shingle found at two positions
+type match struct {
+	a, b occurrence
+}
+
+// FindDuplicates finds the blocks of code copied across the source files of the repository
+// at root: the files are split into tokens, ignoring whitespace and comments, and every
+// sequence of MinTokens tokens is hashed; sequences found more than once are extended to the
+// largest duplicated blocks. The duplicates are returned largest first
+func FindDuplicates(root string, opts DuplicateOptions) ([]Duplicate, error) {
+	k := opts.MinTokens
+	if k <= 0 {
+		k = DefaultMinTokens
+	}
+	sources, err := readSources(root, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every shingle is hashed with a rolling hash of the hashes of its tokens
+	shingles := make(map[uint64][]occurrence)
+	power := uint64(1)
+	for i := 1; i < k; i++ {
+		power *= shingleBase
+	}
+	for s, src := range sources {
+		if len(src.tokens) < k {
+			continue
+		}
+		var h uint64
+		for i, t := range src.hashes {
+			if i >= k {
+				h -= src.hashes[i-k] * power
+			}
+			h = h*shingleBase + t
+			if i >= k-1 && len(shingles[h]) < maxOccurrences {
+				shingles[h] = append(shingles[h], occurrence{source: s, pos: i - k + 1})
+			}
+		}
+	}
+
+	var matches []match
+	for _, occurrences := range shingles {
+		for i := range occurrences {
+			for j := i + 1; j < len(occurrences); j++ {
+				matches = append(matches, match{a: occurrences[i], b: occurrences[j]})
+			}
+		}
+	}
+
+	// Matches of consecutive shingles at the same distance form a single block
+	sort.Slice(matches, func(i, j int) bool {
+		x, y := matches[i], matches[j]
+		if x.a.source != y.a.source {
+			return x.a.source < y.a.source
+		}
+		if x.b.source != y.b.source {
+			return x.b.source < y.b.source
+		}
+		if dx, dy := x.b.pos-x.a.pos, y.b.pos-y.a.pos; dx != dy {
+			return dx < dy
+		}
+		return x.a.pos < y.a.pos
+	})
+	groups := make(map[string]*Duplicate)
+	for start := 0; start < len(matches); {
+		end := start + 1
+		for end < len(matches) && sameBlock(matches[end-1], matches[end]) {
+			end++
+		}
+		first, last := matches[start], matches[end-1]
+		addBlock(groups, sources, first.a, first.b, last.a.pos-first.a.pos+k)
+		start = end
+	}
+
+	duplicates := make([]Duplicate, 0, len(groups))
+	for _, d := range groups {
+		sort.Slice(d.Locations, func(i, j int) bool {
+			if d.Locations[i].Path != d.Locations[j].Path {
+				return d.Locations[i].Path < d.Locations[j].Path
+			}
+			return d.Locations[i].StartLine < d.Locations[j].StartLine
+		})
+		duplicates = append(duplicates, *d)
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Tokens != duplicates[j].Tokens {
+			return duplicates[i].Tokens > duplicates[j].Tokens
+		}
+		a, b := duplicates[i].Locations[0], duplicates[j].Locations[0]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.StartLine < b.StartLine
+	})
+
+	// Repeated patterns match at many offsets; the blocks within a larger one are dropped
+	kept := []Duplicate{}
+	for _, d := range duplicates {
+		if !slices.ContainsFunc(kept, func(k Duplicate) bool { return covers(k.Locations, d.Locations) }) {
+			kept = append(kept, d)
+		}
+	}
+	return kept, nil
+}
+
+// covers reports whether every location of inner lies within one of outer
+func covers(outer, inner []Location) bool {
+	for _, l := range inner {
+		if !slices.ContainsFunc(outer, func(o Location) bool {
+			return o.Path == l.Path && o.StartLine <= l.StartLine && l.EndLine <= o.EndLine
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameBlock reports whether the match next continues the block of the match prev
+func sameBlock(prev, next match) bool {
+	return prev.a.source == next.a.source && prev.b.source == next.b.source &&
+		prev.b.pos-prev.a.pos == next.b.pos-next.a.pos && next.a.pos == prev.a.pos+1
+}
+
+// addBlock adds the block of n tokens found at a and b to the duplicate of its tokens
+func addBlock(groups map[string]*Duplicate, sources []source, a, b occurrence, n int) {
+	if a.source == b.source && b.pos < a.pos+n {
+		return // A block overlapping its copy is a repeated pattern, not a copy
+	}
+	tokensA := sources[a.source].tokens[a.pos : a.pos+n]
+	tokensB := sources[b.source].tokens[b.pos : b.pos+n]
+	var key strings.Builder
+	for i := range tokensA {
+		if tokensA[i].text != tokensB[i].text {
+			return // The hashes collided
+		}
+		key.WriteString(tokensA[i].text)
+		key.WriteByte(0)
+	}
+
+	d := groups[key.String()]
+	if d == nil {
+		d = &Duplicate{Tokens: n, Lines: tokensA[n-1].line - tokensA[0].line + 1}
+		groups[key.String()] = d
+	}
+	for _, o := range []occurrence{a, b} {
+		tokens := sources[o.source].tokens[o.pos : o.pos+n]
+		location := Location{Path: sources[o.source].path, StartLine: tokens[0].line, EndLine: tokens[n-1].line}
+		if !slices.Contains(d.Locations, location) {
+			d.Locations = append(d.Locations, location)
+		}
+	}
+}
+
+// readSources tokenizes the source files of the repository at root
+func readSources(root string, opts DuplicateOptions) ([]source, error) {
+	var sources []source
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && skipped(d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		lang, known := languageOf(d.Name())
+		if !d.Type().IsRegular() || !known || !lang.code {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !opts.Tests && isTest(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxReadSize {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if isBinary(data) || isGenerated(data) {
+			return nil
+		}
+
+		src := source{path: rel, tokens: tokenize(data, hashComments[lang.name], opts.Normalize)}
+		src.hashes = make([]uint64, len(src.tokens))
+		for i, t := range src.tokens {
+			h := fnv.New64a()
+			h.Write([]byte(t.text))
+			src.hashes[i] = h.Sum64()
+		}
+		sources = append(sources, src)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the source files: %v", err)
+	}
+	return sources, nil
+}
+
+// isGenerated reports whether a file says it was generated, like the files of protoc or
+// go generate; its copies are not the doing of its authors
+func isGenerated(data []byte) bool {
+	start := data[:min(len(data), 1024)]
+	return bytes.Contains(start, []byte("Code generated")) && bytes.Contains(start, []byte("DO NOT EDIT"))
+}
+
+// tokenize splits source code into words, literals and punctuation, skipping whitespace and
+// comments; with normalize, identifiers and literals are replaced by placeholders
+func tokenize(data []byte, hashComment, normalize bool) []token {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case hashComment && c == '#', !hashComment && bytes.HasPrefix(data[i:], []byte("//")):
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case !hashComment && bytes.HasPrefix(data[i:], []byte("/*")):
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(data) - i - 4
+			}
+			line += bytes.Count(data[i:i+2+end+2], []byte("\n"))
+			i += 2 + end + 2
+		case c == '"' || c == '\'' || c == '`':
+			start, startLine := i, line
+			for i++; i < len(data) && data[i] != c; i++ {
+				if data[i] == '\\' && c != '`' {
+					i++
+				} else if data[i] == '\n' {
+					if c != '`' {
+						break // An unterminated literal ends with its line
+					}
+					line++
+				}
+			}
+			i = min(i+1, len(data))
+			text := string(data[start:i])
+			if normalize {
+				text = "\"\""
+			}
+			tokens = append(tokens, token{text: text, line: startLine})
+		default:
+			r, size := utf8.DecodeRune(data[i:])
+			if !isWordRune(r) {
+				tokens = append(tokens, token{text: string(data[i : i+size]), line: line})
+				i += size
+				continue
+			}
+			start := i
+			for i < len(data) {
+				r, size := utf8.DecodeRune(data[i:])
+				if !isWordRune(r) && r != '.' || r == '.' && !unicode.IsDigit(rune(data[start])) {
+					break
+				}
+				i += size
+			}
+			text := string(data[start:i])
+			if normalize && !keywords[text] {
+				if unicode.IsDigit(rune(text[0])) {
+					text = "0"
+				} else {
+					text = "_"
+				}
+			}
+			tokens = append(tokens, token{text: text, line: line})
+		}
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// DuplicatesMarkdown formats the duplicates found with at least minTokens tokens
+func DuplicatesMarkdown(duplicates []Duplicate, minTokens int) string {
+	var sb strings.Builder
+	sb.WriteString("## Duplicate code\n\n")
+	if len(duplicates) == 0 {
+		fmt.Fprintf(&sb, "No duplicated blocks of %d tokens or more found.\n", minTokens)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "%d duplicated blocks of %d tokens or more found.\n", len(duplicates), minTokens)
+	for i, d := range duplicates {
+		fmt.Fprintf(&sb, "\n### %d. %d tokens, %d lines, %d copies\n\n", i+1, d.Tokens, d.Lines, len(d.Locations))
+		for _, l := range d.Locations {
+			fmt.Fprintf(&sb, "- `%s`\n", l)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,92 @@
+package stats
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checksum is a function long enough to be reported when it is copied
+const checksum = `func checksum(data []byte) uint32 {
+	var sum uint32
+	for i, b := range data {
+		if b == 0 {
+			continue
+		}
+		sum = sum*31 + uint32(b) + uint32(i%7)
+	}
+	return sum ^ 0x5bd1e995
+}
+`
+
+func TestFindDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.go"), "package a\n\n// checksum sums\n"+checksum)
+	// The copy is formatted and commented differently
+	writeFile(t, filepath.Join(dir, "b", "b.go"), "package b\n\nfunc other() {}\n\n"+strings.ReplaceAll(checksum, "\t", "    ")+"// end\n")
+	// The renamed copy is only found when identifiers are normalized
+	renamed := strings.NewReplacer("checksum", "digest", "sum", "total", "data", "input").Replace(checksum)
+	writeFile(t, filepath.Join(dir, "c.go"), "package c\n\n/* digest\n   sums */\n"+renamed)
+	writeFile(t, filepath.Join(dir, "a_test.go"), "package a\n\n"+checksum)
+	writeFile(t, filepath.Join(dir, "zz_generated.go"), "// Code generated by hand. DO NOT EDIT.\n\npackage a\n\n"+checksum)
+
+	duplicates, err := FindDuplicates(dir, DuplicateOptions{MinTokens: 30})
+	require.NoError(t, err)
+	require.Len(t, duplicates, 1)
+	assert.Equal(t, []Location{{Path: "a.go", StartLine: 4, EndLine: 13}, {Path: "b/b.go", StartLine: 5, EndLine: 14}}, duplicates[0].Locations)
+	assert.Equal(t, 10, duplicates[0].Lines)
+
+	duplicates, err = FindDuplicates(dir, DuplicateOptions{MinTokens: 30, Normalize: true, Tests: true})
+	require.NoError(t, err)
+	require.Len(t, duplicates, 2)
+	// The package clauses of the files without another function match as well
+	assert.Equal(t, []Location{{Path: "a.go", StartLine: 1, EndLine: 13}, {Path: "a_test.go", StartLine: 1, EndLine: 12}, {Path: "c.go", StartLine: 1, EndLine: 14}}, duplicates[0].Locations)
+	var paths []string
+	for _, l := range duplicates[1].Locations {
+		paths = append(paths, l.Path)
+	}
+	assert.Equal(t, []string{"a.go", "a_test.go", "b/b.go", "c.go"}, paths)
+
+	duplicates, err = FindDuplicates(dir, DuplicateOptions{MinTokens: 1000})
+	require.NoError(t, err)
+	assert.Empty(t, duplicates)
+	assert.Equal(t, "## Duplicate code\n\nNo duplicated blocks of 1000 tokens or more found.\n", DuplicatesMarkdown(duplicates, 1000))
+}
+
+func TestFindDuplicates_RepeatedPattern(t *testing.T) {
+	// Lines repeating the same statement match at many offsets; only the largest block is reported
+	var sb strings.Builder
+	sb.WriteString("package usage\n\nfunc a() {\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&sb, "\tprintln(%q)\n", fmt.Sprint("line ", i))
+	}
+	sb.WriteString("}\n")
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.go"), sb.String())
+	writeFile(t, filepath.Join(dir, "b.go"), sb.String())
+
+	duplicates, err := FindDuplicates(dir, DuplicateOptions{MinTokens: 20, Normalize: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, duplicates)
+	assert.Equal(t, []Location{{Path: "a.go", StartLine: 1, EndLine: 24}, {Path: "b.go", StartLine: 1, EndLine: 24}}, duplicates[0].Locations)
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize([]byte("x := \"a // b\" // comment\n/* block\n */ y += 1.5"), false, false)
+	var texts []string
+	for _, tok := range tokens {
+		texts = append(texts, fmt.Sprintf("%s@%d", tok.text, tok.line))
+	}
+	assert.Equal(t, []string{"x@1", ":@1", "=@1", `"a // b"@1`, "y@3", "+@3", "=@3", "1.5@3"}, texts)
+
+	tokens = tokenize([]byte("total = count(items) # sum\nreturn 'x'"), true, true)
+	texts = nil
+	for _, tok := range tokens {
+		texts = append(texts, tok.text)
+	}
+	assert.Equal(t, []string{"_", "=", "_", "(", "_", ")", "return", `""`}, texts)
+}
@@ -0,0 +1,482 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// headerLines is the number of lines at the start of a file searched for the header
+	headerLines = 20
+
+	// maxListedHeaders limits the files without a header listed in the Markdown report;
+	// the JSON report lists all of them
+	maxListedHeaders = 50
+)
+
+// licenseFiles are the names of the files holding a license, compared in lower case and
+// without an extension
+var licenseFiles = map[string]bool{"license": true, "licence": true, "copying": true, "unlicense": true}
+
+// spdxPattern matches the SPDX license identifier of a file
+var spdxPattern = regexp.MustCompile(`SPDX-License-Identifier:\s*([^\s*]+(?:\s+(?:AND|OR|WITH)\s+[^\s*]+)*)`)
+
+// generatedPattern matches the comment marking a generated file, which needs no header
+var generatedPattern = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// licenseTexts identify the common licenses by phrases of their text, in lower case with
+// the whitespace collapsed; the first match wins, so the licenses quoting others come first
+var licenseTexts = []struct {
+	id      string
+	phrases []string
+}{
+	{"AGPL-3.0", []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"EPL-2.0", []string{"eclipse public license", "2.0"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "names of its contributors"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+}
+
+// LicenseOptions configure ScanLicenses
+type LicenseOptions struct {
+	// Header is the text every source file must contain in its first lines; if empty, a
+	// copyright notice or an SPDX license identifier is required
+	Header string
+
+	// GoModCache is the Go module cache the licenses of Go modules are read from; if empty,
+	// GOMODCACHE, GOPATH/pkg/mod or ~/go/pkg/mod
+	GoModCache string
+}
+
+// LicenseReport is the result of a license scan
+type LicenseReport struct {
+	// License is the license of the repository, nil if it has no license file
+	License *LicenseFile `json:"license"`
+
+	Dependencies []DependencyLicense `json:"dependencies"`
+
+	// Header is the header required in the source files, e.g. "Copyright or SPDX-License-Identifier"
+	Header string `json:"header"`
+
+	// Checked is the number of source files searched for the header
+	Checked int `json:"checked"`
+
+	// MissingHeaders are the source files without the header, slash separated and relative
+	// to the root
+	MissingHeaders []string `json:"missing_headers"`
+}
+
+// LicenseFile is a license file; License is its SPDX identifier, empty if it is not recognized
+type LicenseFile struct {
+	Path    string `json:"path"`
+	License string `json:"license"`
+}
+
+// DependencyLicense is the license of a dependency declared in a manifest; License is an
+// SPDX identifier or expression, empty if unknown, and Source is where it was read from
+type DependencyLicense struct {
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	Ecosystem string `json:"ecosystem"`
+	Manifest  string `json:"manifest"`
+	Dev       bool   `json:"dev,omitempty"`
+	Indirect  bool   `json:"indirect,omitempty"`
+	License   string `json:"license"`
+	Source    string `json:"source,omitempty"`
+}
+
+// ScanLicenses identifies the license of the repository at root, the licenses of the
+// dependencies declared in its go.mod and package.json files, and the source files missing
+// the required header. The licenses of dependencies are only read from local files: the Go
+// module cache and node_modules; a dependency that was never downloaded has an unknown license
+func ScanLicenses(root string, opts LicenseOptions) (*LicenseReport, error) {
+	report := &LicenseReport{Dependencies: []DependencyLicense{}, MissingHeaders: []string{}, Header: opts.Header}
+	if report.Header == "" {
+		report.Header = "Copyright or SPDX-License-Identifier"
+	}
+	modCache := opts.GoModCache
+	if modCache == "" {
+		modCache = goModCache()
+	}
+
+	license, err := findLicense(root)
+	if err != nil {
+		return nil, err
+	}
+	if license != nil {
+		report.License = &LicenseFile{Path: license.path, License: license.id}
+	}
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && skipped(d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch d.Name() {
+		case "go.mod":
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			report.Dependencies = append(report.Dependencies, goLicenses(rel, data, modCache)...)
+			return nil
+		case "package.json":
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			dependencies, err := npmLicenses(rel, data, filepath.Dir(p))
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %v", rel, err)
+			}
+			report.Dependencies = append(report.Dependencies, dependencies...)
+			return nil
+		}
+
+		lang, ok := languageOf(d.Name())
+		if !ok || !lang.code {
+			return nil
+		}
+		head, err := readHead(p)
+		if err != nil {
+			return err
+		}
+		if isBinary(head) || generatedPattern.Match(head) {
+			return nil
+		}
+		report.Checked++
+		if !hasHeader(head, opts.Header) {
+			report.MissingHeaders = append(report.MissingHeaders, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan licenses: %v", err)
+	}
+
+	sort.Slice(report.Dependencies, func(i, j int) bool {
+		a, b := report.Dependencies[i], report.Dependencies[j]
+		if a.Manifest != b.Manifest {
+			return a.Manifest < b.Manifest
+		}
+		return a.Name < b.Name
+	})
+	sort.Strings(report.MissingHeaders)
+	return report, nil
+}
+
+// license is a license file found in a directory
+type license struct {
+	path, id string
+}
+
+// findLicense returns the license file of dir, nil if it has none; of several license files,
+// e.g. LICENSE and COPYING, the first recognized one is used
+func findLicense(dir string) (*license, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %v", dir, err)
+	}
+	var found *license
+	for _, e := range entries {
+		name := strings.ToLower(e.Name())
+		if !e.Type().IsRegular() || !licenseFiles[strings.TrimSuffix(name, path.Ext(name))] {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		l := &license{path: e.Name(), id: identifyLicense(data)}
+		if l.id != "" {
+			return l, nil
+		}
+		if found == nil {
+			found = l
+		}
+	}
+	return found, nil
+}
+
+// identifyLicense returns the SPDX identifier of a license text, empty if it is not recognized
+func identifyLicense(data []byte) string {
+	if match := spdxPattern.FindSubmatch(data); match != nil {
+		return string(match[1])
+	}
+	text := strings.ToLower(strings.Join(strings.Fields(string(data)), " "))
+	for _, l := range licenseTexts {
+		matches := true
+		for _, phrase := range l.phrases {
+			if !strings.Contains(text, phrase) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return l.id
+		}
+	}
+	return ""
+}
+
+// goLicenses returns the licenses of the requirements of a go.mod, read from the module cache
+func goLicenses(manifest string, data []byte, modCache string) []DependencyLicense {
+	var dependencies []DependencyLicense
+	for _, r := range goRequirements(data) {
+		dependency := DependencyLicense{
+			Name:      r.path,
+			Version:   r.version,
+			Ecosystem: "Go modules",
+			Manifest:  manifest,
+			Indirect:  r.indirect,
+		}
+		if modCache != "" && r.version != "" {
+			dir := filepath.Join(modCache, escapeModulePath(r.path)+"@"+escapeModulePath(r.version))
+			if l, err := findLicense(dir); err == nil && l != nil {
+				dependency.License = l.id
+				dependency.Source = filepath.ToSlash(filepath.Join(escapeModulePath(r.path)+"@"+r.version, l.path))
+			}
+		}
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies
+}
+
+// escapeModulePath escapes a module path or version like the module cache does: every upper
+// case letter becomes an exclamation mark followed by the letter in lower case
+func escapeModulePath(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			sb.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// goModCache returns the directory of the Go module cache, empty if it cannot be found
+func goModCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	if gopath := filepath.SplitList(os.Getenv("GOPATH")); len(gopath) > 0 && gopath[0] != "" {
+		return filepath.Join(gopath[0], "pkg", "mod")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, "go", "pkg", "mod")
+	}
+	return ""
+}
+
+// npmPackage is the part of a package.json describing its license and dependencies; the
+// license is usually an SPDX expression, but old packages use an object or a list
+type npmPackage struct {
+	License         json.RawMessage   `json:"license"`
+	Licenses        []json.RawMessage `json:"licenses"`
+	Version         string            `json:"version"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+}
+
+// npmLicenses returns the licenses of the dependencies of a package.json, read from the
+// packages installed in node_modules next to it
+func npmLicenses(manifest string, data []byte, dir string) ([]DependencyLicense, error) {
+	var pkg npmPackage
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+	var dependencies []DependencyLicense
+	add := func(deps map[string]string, dev bool) {
+		for name, version := range deps {
+			dependency := DependencyLicense{Name: name, Version: version, Ecosystem: "npm", Manifest: manifest, Dev: dev}
+			installed := filepath.Join(dir, "node_modules", filepath.FromSlash(name))
+			if data, err := os.ReadFile(filepath.Join(installed, "package.json")); err == nil {
+				var dep npmPackage
+				if json.Unmarshal(data, &dep) == nil {
+					if dep.Version != "" {
+						dependency.Version = dep.Version
+					}
+					if dependency.License = dep.license(); dependency.License != "" {
+						dependency.Source = path.Join("node_modules", name, "package.json")
+					}
+				}
+			}
+			if dependency.License == "" {
+				if l, err := findLicense(installed); err == nil && l != nil {
+					dependency.License = l.id
+					dependency.Source = path.Join("node_modules", name, l.path)
+				}
+			}
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	add(pkg.Dependencies, false)
+	add(pkg.DevDependencies, true)
+	return dependencies, nil
+}
+
+// license returns the license of a package.json, joining a list of licenses with OR
+func (p npmPackage) license() string {
+	licenses := p.Licenses
+	if len(p.License) > 0 {
+		licenses = []json.RawMessage{p.License}
+	}
+	var ids []string
+	for _, raw := range licenses {
+		var id string
+		if json.Unmarshal(raw, &id) != nil {
+			var object struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal(raw, &object) != nil {
+				continue
+			}
+			id = object.Type
+		}
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return strings.Join(ids, " OR ")
+}
+
+// readHead returns the first lines of a file, where its header is expected
+func readHead(p string) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var head bytes.Buffer
+	reader := bufio.NewReader(f)
+	for i := 0; i < headerLines; i++ {
+		line, err := reader.ReadBytes('\n')
+		head.Write(line)
+		if err != nil {
+			break
+		}
+	}
+	return head.Bytes(), nil
+}
+
+// hasHeader reports whether the start of a file contains the required header; without a
+// configured header, a copyright notice or an SPDX license identifier is required
+func hasHeader(head []byte, header string) bool {
+	if header != "" {
+		return bytes.Contains(head, []byte(header))
+	}
+	return bytes.Contains(bytes.ToLower(head), []byte("copyright")) || spdxPattern.Match(head)
+}
+
+// Markdown formats the report, e.g. for the LLM
+func (r *LicenseReport) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("## Licenses\n\n")
+	switch {
+	case r.License == nil:
+		sb.WriteString("**Repository license:** none, no license file found\n\n")
+	case r.License.License == "":
+		fmt.Fprintf(&sb, "**Repository license:** not recognized (`%s`)\n\n", r.License.Path)
+	default:
+		fmt.Fprintf(&sb, "**Repository license:** %s (`%s`)\n\n", r.License.License, r.License.Path)
+	}
+
+	sb.WriteString("### Dependencies\n\n")
+	if len(r.Dependencies) == 0 {
+		sb.WriteString("No dependencies found in go.mod or package.json files.\n\n")
+	} else {
+		unknown := 0
+		byLicense := make(map[string]int)
+		for _, d := range r.Dependencies {
+			if d.License == "" {
+				unknown++
+			} else {
+				byLicense[d.License]++
+			}
+		}
+		licenses := make([]string, 0, len(byLicense))
+		for l := range byLicense {
+			licenses = append(licenses, l)
+		}
+		sort.Slice(licenses, func(i, j int) bool {
+			if byLicense[licenses[i]] != byLicense[licenses[j]] {
+				return byLicense[licenses[i]] > byLicense[licenses[j]]
+			}
+			return licenses[i] < licenses[j]
+		})
+		for _, l := range licenses {
+			fmt.Fprintf(&sb, "- %s: %d\n", l, byLicense[l])
+		}
+		if unknown > 0 {
+			fmt.Fprintf(&sb, "- unknown: %d (not downloaded or not recognized)\n", unknown)
+		}
+		sb.WriteString("\n| Dependency | Version | Manifest | Kind | License |\n|---|---|---|---|---|\n")
+		for _, d := range r.Dependencies {
+			kind := "direct"
+			switch {
+			case d.Dev:
+				kind = "dev"
+			case d.Indirect:
+				kind = "indirect"
+			}
+			license := d.License
+			if license == "" {
+				license = "unknown"
+			}
+			fmt.Fprintf(&sb, "| %s | %s | `%s` | %s | %s |\n", d.Name, d.Version, d.Manifest, kind, license)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("### Headers\n\n")
+	if len(r.MissingHeaders) == 0 {
+		fmt.Fprintf(&sb, "All %d source files have the header (%s).\n", r.Checked, r.Header)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "%d of %d source files are missing the header (%s):\n\n", len(r.MissingHeaders), r.Checked, r.Header)
+	for _, file := range r.MissingHeaders[:min(len(r.MissingHeaders), maxListedHeaders)] {
+		fmt.Fprintf(&sb, "- `%s`\n", file)
+	}
+	if len(r.MissingHeaders) > maxListedHeaders {
+		fmt.Fprintf(&sb, "- and %d more\n", len(r.MissingHeaders)-maxListedHeaders)
+	}
+	return sb.String()
+}
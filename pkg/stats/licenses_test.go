@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mitLicense = `MIT License
+
+Copyright (c) 2024 Example
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software")...
+`
+
+func TestScanLicenses(t *testing.T) {
+	dir := t.TempDir()
+	cache := t.TempDir()
+	writeFile(t, filepath.Join(dir, "LICENSE"), mitLicense)
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example\n\nrequire (\n\tgithub.com/BurntSushi/toml v1.3.2\n\tgithub.com/missing/mod v0.1.0 // indirect\n)\n")
+	writeFile(t, filepath.Join(cache, "github.com", "!burnt!sushi", "toml@v1.3.2", "COPYING"), mitLicense)
+	writeFile(t, filepath.Join(dir, "web", "package.json"), `{"dependencies": {"left-pad": "^1.3.0", "@scope/old": "1"}, "devDependencies": {"tool": "2"}}`)
+	writeFile(t, filepath.Join(dir, "web", "node_modules", "left-pad", "package.json"), `{"version": "1.3.0", "license": "WTFPL"}`)
+	writeFile(t, filepath.Join(dir, "web", "node_modules", "@scope", "old", "package.json"), `{"version": "1.0.0", "licenses": [{"type": "MIT"}, {"type": "Apache-2.0"}]}`)
+	writeFile(t, filepath.Join(dir, "web", "node_modules", "tool", "LICENSE.md"), "Apache License\nVersion 2.0, January 2004\n")
+
+	writeFile(t, filepath.Join(dir, "main.go"), "// Copyright 2024 Example\n\npackage main\n")
+	writeFile(t, filepath.Join(dir, "pkg", "lib.go"), "// SPDX-License-Identifier: MIT\n\npackage pkg\n")
+	writeFile(t, filepath.Join(dir, "pkg", "util.go"), "package pkg\n")
+	writeFile(t, filepath.Join(dir, "pkg", "gen.go"), "// Code generated by stringer. DO NOT EDIT.\n\npackage pkg\n")
+	writeFile(t, filepath.Join(dir, "web", "app.js"), "export default {}\n")
+	writeFile(t, filepath.Join(dir, "README.md"), "# Example\n")
+
+	report, err := ScanLicenses(dir, LicenseOptions{GoModCache: cache})
+	require.NoError(t, err)
+	assert.Equal(t, &LicenseFile{Path: "LICENSE", License: "MIT"}, report.License)
+	assert.Equal(t, []DependencyLicense{
+		{Name: "github.com/BurntSushi/toml", Version: "v1.3.2", Ecosystem: "Go modules", Manifest: "go.mod", License: "MIT", Source: "github.com/!burnt!sushi/toml@v1.3.2/COPYING"},
+		{Name: "github.com/missing/mod", Version: "v0.1.0", Ecosystem: "Go modules", Manifest: "go.mod", Indirect: true},
+		{Name: "@scope/old", Version: "1.0.0", Ecosystem: "npm", Manifest: "web/package.json", License: "MIT OR Apache-2.0", Source: "node_modules/@scope/old/package.json"},
+		{Name: "left-pad", Version: "1.3.0", Ecosystem: "npm", Manifest: "web/package.json", License: "WTFPL", Source: "node_modules/left-pad/package.json"},
+		{Name: "tool", Version: "2", Ecosystem: "npm", Manifest: "web/package.json", Dev: true, License: "Apache-2.0", Source: "node_modules/tool/LICENSE.md"},
+	}, report.Dependencies)
+	assert.Equal(t, 4, report.Checked, "generated files and documents have no header")
+	assert.Equal(t, []string{"pkg/util.go", "web/app.js"}, report.MissingHeaders)
+
+	markdown := report.Markdown()
+	assert.Contains(t, markdown, "**Repository license:** MIT (`LICENSE`)")
+	assert.Contains(t, markdown, "- MIT: 1\n")
+	assert.Contains(t, markdown, "- unknown: 1 (not downloaded or not recognized)\n")
+	assert.Contains(t, markdown, "| github.com/missing/mod | v0.1.0 | `go.mod` | indirect | unknown |\n")
+	assert.Contains(t, markdown, "2 of 4 source files are missing the header (Copyright or SPDX-License-Identifier):\n\n- `pkg/util.go`\n- `web/app.js`\n")
+
+	report, err = ScanLicenses(dir, LicenseOptions{Header: "Copyright 2024 Example", GoModCache: cache})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pkg/lib.go", "pkg/util.go", "web/app.js"}, report.MissingHeaders)
+}
+
+func TestScanLicenses_Empty(t *testing.T) {
+	report, err := ScanLicenses(t.TempDir(), LicenseOptions{GoModCache: t.TempDir()})
+	require.NoError(t, err)
+	assert.Nil(t, report.License)
+	assert.Empty(t, report.Dependencies)
+	assert.Equal(t, "## Licenses\n\n**Repository license:** none, no license file found\n\n"+
+		"### Dependencies\n\nNo dependencies found in go.mod or package.json files.\n\n"+
+		"### Headers\n\nAll 0 source files have the header (Copyright or SPDX-License-Identifier).\n", report.Markdown())
+}
+
+func TestIdentifyLicense(t *testing.T) {
+	tests := map[string]string{
+		mitLicense: "MIT",
+		"Apache License\n   Version 2.0, January 2004":                                              "Apache-2.0",
+		"GNU GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007":                                       "GPL-3.0",
+		"GNU LESSER GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007 ... GNU General Public License": "LGPL-3.0",
+		"GNU AFFERO GENERAL PUBLIC LICENSE\nVersion 3":                                              "AGPL-3.0",
+		"Redistribution and use in source and binary forms ... Neither the name of the copyright":   "BSD-3-Clause",
+		"Redistribution and use in source and binary\nforms, with or without modification":          "BSD-2-Clause",
+		"SPDX-License-Identifier: MPL-2.0 OR Apache-2.0":                                            "MPL-2.0 OR Apache-2.0",
+		"All rights reserved.": "",
+	}
+	for text, want := range tests {
+		assert.Equal(t, want, identifyLicense([]byte(text)), text)
+	}
+}
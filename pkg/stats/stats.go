@@ -0,0 +1,452 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/prompts"
+)
+
+const (
+	// DefaultLargest is the number of largest files in a report
+	DefaultLargest = 10
+
+	// maxReadSize is the size above which the lines of a file are not counted
+	maxReadSize = 8 << 20
+
+	// binarySniff is the size of the start of a file searched for a NUL byte
+	binarySniff = 8000
+)
+
+// skippedDirs hold dependencies or generated files rather than the code of the repository;
+// hidden files and directories are skipped too
+var skippedDirs = map[string]bool{"node_modules": true, "vendor": true}
+
+// language describes the files with an extension; only the code of programming languages
+// counts as source for the test ratio
+type language struct {
+	name string
+	code bool
+}
+
+var extensions = map[string]language{
+	".go": {"Go", true}, ".py": {"Python", true}, ".js": {"JavaScript", true}, ".jsx": {"JavaScript", true},
+	".mjs": {"JavaScript", true}, ".ts": {"TypeScript", true}, ".tsx": {"TypeScript", true}, ".rs": {"Rust", true},
+	".java": {"Java", true}, ".kt": {"Kotlin", true}, ".c": {"C", true}, ".h": {"C", true}, ".cc": {"C++", true},
+	".cpp": {"C++", true}, ".hpp": {"C++", true}, ".cs": {"C#", true}, ".rb": {"Ruby", true}, ".php": {"PHP", true},
+	".swift": {"Swift", true}, ".scala": {"Scala", true}, ".sh": {"Shell", true}, ".bash": {"Shell", true},
+	".sql": {"SQL", true}, ".html": {"HTML", false}, ".css": {"CSS", false}, ".md": {"Markdown", false},
+	".yaml": {"YAML", false}, ".yml": {"YAML", false}, ".json": {"JSON", false}, ".toml": {"TOML", false},
+	".xml": {"XML", false}, ".proto": {"Protocol Buffers", false}, ".tmpl": {"Template", false},
+}
+
+var filenames = map[string]language{
+	"Makefile": {"Makefile", true}, "Dockerfile": {"Dockerfile", true},
+}
+
+// testDirs are directories holding only tests
+var testDirs = map[string]bool{"test": true, "tests": true, "__tests__": true, "spec": true}
+
+// Report is the statistics of a repository; it only depends on the files, so the same tree
+// always gives the same report
+type Report struct {
+	Files        int        `json:"files"`
+	Lines        int        `json:"lines"`
+	Languages    []Language `json:"languages"`
+	Largest      []File     `json:"largest_files"`
+	Tests        Tests      `json:"tests"`
+	Dependencies []Manifest `json:"dependencies"`
+
+	// Summary is written by the LLM, see Summarize
+	Summary string `json:"summary,omitempty"`
+}
+
+// Language is the size of the files of a language
+type Language struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Lines int    `json:"lines"`
+
+	// Code is the number of lines that are not blank
+	Code int `json:"code"`
+}
+
+// File is a file of the repository; Path is slash separated and relative to the root
+type File struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Lines int    `json:"lines"`
+}
+
+// Tests compares the code of the tests with the rest of the source code, in lines that
+// are not blank
+type Tests struct {
+	Files       int     `json:"files"`
+	Code        int     `json:"code"`
+	SourceFiles int     `json:"source_files"`
+	SourceCode  int     `json:"source_code"`
+	Ratio       float64 `json:"ratio"`
+}
+
+// Manifest counts the dependencies declared in a manifest, e.g. go.mod or package.json
+type Manifest struct {
+	Path      string `json:"path"`
+	Ecosystem string `json:"ecosystem"`
+	Direct    int    `json:"direct"`
+	Indirect  int    `json:"indirect,omitempty"`
+	Dev       int    `json:"dev,omitempty"`
+}
+
+// manifests parse the dependency manifests by file name
+var manifests = map[string]struct {
+	ecosystem string
+	parse     func(data []byte, m *Manifest) error
+}{
+	"go.mod":           {"Go modules", parseGoMod},
+	"package.json":     {"npm", parsePackageJSON},
+	"requirements.txt": {"pip", parseRequirements},
+	"Cargo.toml":       {"Cargo", parseCargo},
+}
+
+// Collect walks the repository at root and returns its statistics, listing at most largest
+// of the largest files
+func Collect(root string, largest int) (*Report, error) {
+	report := &Report{Languages: []Language{}, Largest: []File{}, Dependencies: []Manifest{}}
+	byLanguage := make(map[string]*Language)
+	var files []File
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && skipped(d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		file := File{Path: rel, Size: info.Size()}
+		var data []byte
+		if info.Size() <= maxReadSize {
+			if data, err = os.ReadFile(p); err != nil {
+				return err
+			}
+		}
+		report.Files++
+
+		if m, ok := manifests[d.Name()]; ok && data != nil {
+			manifest := Manifest{Path: rel, Ecosystem: m.ecosystem}
+			if err := m.parse(data, &manifest); err != nil {
+				return fmt.Errorf("failed to parse %s: %v", rel, err)
+			}
+			report.Dependencies = append(report.Dependencies, manifest)
+		}
+
+		lang, known := languageOf(d.Name())
+		if data == nil || isBinary(data) {
+			files = append(files, file)
+			return nil
+		}
+		lines, code := countLines(data)
+		file.Lines = lines
+		files = append(files, file)
+		report.Lines += lines
+		if !known {
+			return nil
+		}
+
+		l := byLanguage[lang.name]
+		if l == nil {
+			l = &Language{Name: lang.name}
+			byLanguage[lang.name] = l
+		}
+		l.Files++
+		l.Lines += lines
+		l.Code += code
+		if lang.code {
+			if isTest(rel) {
+				report.Tests.Files++
+				report.Tests.Code += code
+			} else {
+				report.Tests.SourceFiles++
+				report.Tests.SourceCode += code
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect statistics: %v", err)
+	}
+
+	for _, l := range byLanguage {
+		report.Languages = append(report.Languages, *l)
+	}
+	sort.Slice(report.Languages, func(i, j int) bool {
+		a, b := report.Languages[i], report.Languages[j]
+		if a.Code != b.Code {
+			return a.Code > b.Code
+		}
+		return a.Name < b.Name
+	})
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+	report.Largest = append(report.Largest, files[:min(largest, len(files))]...)
+	sort.Slice(report.Dependencies, func(i, j int) bool { return report.Dependencies[i].Path < report.Dependencies[j].Path })
+	if report.Tests.SourceCode > 0 {
+		report.Tests.Ratio = float64(report.Tests.Code) / float64(report.Tests.SourceCode)
+	}
+	return report, nil
+}
+
+// skipped reports whether an entry of the tree is left out of the statistics
+func skipped(d fs.DirEntry) bool {
+	return strings.HasPrefix(d.Name(), ".") || d.IsDir() && skippedDirs[d.Name()]
+}
+
+// languageOf returns the language of a file by its name
+func languageOf(name string) (language, bool) {
+	if lang, ok := filenames[name]; ok {
+		return lang, true
+	}
+	lang, ok := extensions[strings.ToLower(path.Ext(name))]
+	return lang, ok
+}
+
+// isTest reports whether the source file at the slash separated path rel is a test, by the
+// conventions of the common languages
+func isTest(rel string) bool {
+	name := path.Base(rel)
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	switch {
+	case strings.HasSuffix(base, "_test"), strings.HasSuffix(base, "_spec"),
+		strings.HasSuffix(base, ".test"), strings.HasSuffix(base, ".spec"):
+		return true
+	case ext == ".py" && strings.HasPrefix(base, "test_"):
+		return true
+	case (ext == ".java" || ext == ".kt" || ext == ".cs" || ext == ".scala" || ext == ".swift") &&
+		(strings.HasSuffix(base, "Test") || strings.HasSuffix(base, "Tests")):
+		return true
+	}
+	for _, dir := range strings.Split(path.Dir(rel), "/") {
+		if testDirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinary reports whether data looks like the content of a binary file
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binarySniff)], 0) >= 0
+}
+
+// countLines returns the number of lines of data and of those that are not blank
+func countLines(data []byte) (lines, code int) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxReadSize)
+	for scanner.Scan() {
+		lines++
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			code++
+		}
+	}
+	return lines, code
+}
+
+// parseGoMod counts the requirements of a go.mod; those marked // indirect are indirect
+func parseGoMod(data []byte, m *Manifest) error {
+	for _, r := range goRequirements(data) {
+		if r.indirect {
+			m.Indirect++
+		} else {
+			m.Direct++
+		}
+	}
+	return nil
+}
+
+// requirement is a module required by a go.mod
+type requirement struct {
+	path, version string
+	indirect      bool
+}
+
+// goRequirements returns the requirements of a go.mod, in both the single line and the
+// block form
+func goRequirements(data []byte) []requirement {
+	var requirements []requirement
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		var text string
+		switch {
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case inBlock:
+			text = line
+		case line == "require (":
+			inBlock = true
+			continue
+		case strings.HasPrefix(line, "require "):
+			text = strings.TrimPrefix(line, "require ")
+		default:
+			continue
+		}
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		fields := strings.Fields(text)
+		r := requirement{path: fields[0], indirect: strings.Contains(text, "// indirect")}
+		if len(fields) > 1 {
+			r.version = fields[1]
+		}
+		requirements = append(requirements, r)
+	}
+	return requirements
+}
+
+// parsePackageJSON counts the dependencies and the development dependencies of a package.json
+func parsePackageJSON(data []byte, m *Manifest) error {
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return err
+	}
+	m.Direct = len(pkg.Dependencies)
+	m.Dev = len(pkg.DevDependencies)
+	return nil
+}
+
+// parseRequirements counts the requirements of a requirements.txt, skipping comments and
+// options such as -r other.txt
+func parseRequirements(data []byte, m *Manifest) error {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "-") {
+			m.Direct++
+		}
+	}
+	return nil
+}
+
+// parseCargo counts the entries of the dependency tables of a Cargo.toml
+func parseCargo(data []byte, m *Manifest) error {
+	var count *int
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			table := strings.Trim(line, "[]")
+			count = nil
+			switch {
+			case table == "dependencies", table == "build-dependencies":
+				count = &m.Direct
+			case table == "dev-dependencies":
+				count = &m.Dev
+			case strings.HasPrefix(table, "dependencies."), strings.HasPrefix(table, "build-dependencies."):
+				m.Direct++ // A table of its own describes a single dependency
+			case strings.HasPrefix(table, "dev-dependencies."):
+				m.Dev++
+			}
+			continue
+		}
+		if count != nil && line != "" && !strings.HasPrefix(line, "#") && strings.Contains(line, "=") {
+			*count++
+		}
+	}
+	return nil
+}
+
+// Markdown formats the report
+func (r *Report) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("## Repository statistics\n\n")
+	fmt.Fprintf(&sb, "**Files:** %d, **Lines:** %d\n\n", r.Files, r.Lines)
+
+	if len(r.Languages) > 0 {
+		sb.WriteString("### Languages\n\n| Language | Files | Lines | Code |\n|---|---:|---:|---:|\n")
+		for _, l := range r.Languages {
+			fmt.Fprintf(&sb, "| %s | %d | %d | %d |\n", l.Name, l.Files, l.Lines, l.Code)
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(r.Largest) > 0 {
+		sb.WriteString("### Largest files\n\n| File | Bytes | Lines |\n|---|---:|---:|\n")
+		for _, f := range r.Largest {
+			fmt.Fprintf(&sb, "| `%s` | %d | %d |\n", f.Path, f.Size, f.Lines)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("### Tests\n\n")
+	fmt.Fprintf(&sb, "- Test files: %d, other source files: %d\n", r.Tests.Files, r.Tests.SourceFiles)
+	fmt.Fprintf(&sb, "- Lines of test code: %d, of other source code: %d\n", r.Tests.Code, r.Tests.SourceCode)
+	fmt.Fprintf(&sb, "- Test ratio: %.2f\n\n", r.Tests.Ratio)
+
+	sb.WriteString("### Dependencies\n\n")
+	if len(r.Dependencies) == 0 {
+		sb.WriteString("No dependency manifests found.\n")
+	} else {
+		sb.WriteString("| Manifest | Ecosystem | Direct | Indirect | Dev |\n|---|---|---:|---:|---:|\n")
+		for _, m := range r.Dependencies {
+			fmt.Fprintf(&sb, "| `%s` | %s | %d | %d | %d |\n", m.Path, m.Ecosystem, m.Direct, m.Indirect, m.Dev)
+		}
+	}
+
+	if r.Summary != "" {
+		fmt.Fprintf(&sb, "\n### Executive summary\n\n%s\n", r.Summary)
+	}
+	return sb.String()
+}
+
+// Summarize asks the LLM for an executive summary of the report; the statistics are given
+// to it as they are, so it does not count anything itself
+func Summarize(llm nodes.LLM, templates *prompts.Registry, dir string, r *Report) (string, error) {
+	if templates == nil {
+		templates = prompts.Builtin()
+	}
+	statistics := *r
+	statistics.Summary = ""
+	prompt, err := templates.Render(prompts.StatsSummarize, prompts.Vars{
+		"WorkingDirectory": dir,
+		"Statistics":       statistics.Markdown(),
+	})
+	if err != nil {
+		return "", err
+	}
+	response, err := llm.Complete(prompt)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", nodes.ErrLLM, err)
+	}
+	return strings.TrimSpace(response), nil
+}
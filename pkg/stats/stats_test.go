@@ -0,0 +1,102 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"aiagent/pkg/nodes"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// repository writes a small repository mixing languages, tests and manifests
+func repository(t *testing.T) string {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc main() {\n}\n")
+	writeFile(t, filepath.Join(dir, "main_test.go"), "package main\n\nfunc TestMain() {}\n")
+	writeFile(t, filepath.Join(dir, "web", "app.ts"), "export const a = 1\n")
+	writeFile(t, filepath.Join(dir, "web", "__tests__", "app.ts"), "test()\n")
+	writeFile(t, filepath.Join(dir, "scripts", "test_build.py"), "def test_build():\n    pass\n")
+	writeFile(t, filepath.Join(dir, "README.md"), "# Example\n\nText\n")
+	writeFile(t, filepath.Join(dir, "logo.png"), "\x89PNG\x00\x00\x00\x00")
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example\n\ngo 1.24\n\nrequire (\n\tgithub.com/a/b v1.0.0\n\tgithub.com/c/d v1.0.0 // indirect\n)\n\nrequire github.com/e/f v0.1.0\n")
+	writeFile(t, filepath.Join(dir, "web", "package.json"), `{"dependencies": {"react": "^18"}, "devDependencies": {"vitest": "^1", "eslint": "^8"}}`)
+	writeFile(t, filepath.Join(dir, "tools", "Cargo.toml"), "[package]\nname = \"tools\"\n\n[dependencies]\nserde = \"1\"\n\n[dependencies.tokio]\nversion = \"1\"\n\n[dev-dependencies]\nproptest = \"1\"\n")
+	writeFile(t, filepath.Join(dir, "requirements.txt"), "# tools\nrequests==2.31\n-r dev.txt\n")
+
+	// Hidden directories and dependencies are not part of the repository
+	writeFile(t, filepath.Join(dir, ".git", "config"), "[core]\n")
+	writeFile(t, filepath.Join(dir, "vendor", "lib.go"), "package lib\n")
+	writeFile(t, filepath.Join(dir, "web", "node_modules", "react", "index.js"), "module.exports = {}\n")
+	return dir
+}
+
+func TestCollect(t *testing.T) {
+	dir := repository(t)
+	report, err := Collect(dir, 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, 11, report.Files)
+	assert.Equal(t, []Language{
+		{Name: "TOML", Files: 1, Lines: 11, Code: 8},
+		{Name: "Go", Files: 2, Lines: 7, Code: 5},
+		{Name: "Markdown", Files: 1, Lines: 3, Code: 2},
+		{Name: "Python", Files: 1, Lines: 2, Code: 2},
+		{Name: "TypeScript", Files: 2, Lines: 2, Code: 2},
+		{Name: "JSON", Files: 1, Lines: 1, Code: 1},
+	}, report.Languages, "ordered by code, then by name")
+	assert.Equal(t, Tests{Files: 3, Code: 5, SourceFiles: 2, SourceCode: 4, Ratio: 1.25}, report.Tests)
+	assert.Len(t, report.Largest, 2)
+	assert.Equal(t, "go.mod", report.Largest[0].Path)
+	assert.Equal(t, []Manifest{
+		{Path: "go.mod", Ecosystem: "Go modules", Direct: 2, Indirect: 1},
+		{Path: "requirements.txt", Ecosystem: "pip", Direct: 1},
+		{Path: "tools/Cargo.toml", Ecosystem: "Cargo", Direct: 2, Dev: 1},
+		{Path: "web/package.json", Ecosystem: "npm", Direct: 1, Dev: 2},
+	}, report.Dependencies)
+
+	// The report only depends on the files
+	again, err := Collect(dir, 2)
+	require.NoError(t, err)
+	assert.Equal(t, report.Markdown(), again.Markdown())
+}
+
+func TestIsTest(t *testing.T) {
+	tests := map[string]bool{
+		"pkg/stats/stats_test.go":     true,
+		"pkg/stats/stats.go":          false,
+		"app/test_views.py":           true,
+		"app/views.py":                false,
+		"src/button.spec.tsx":         true,
+		"src/__tests__/button.tsx":    true,
+		"src/main/ParserTest.java":    true,
+		"src/main/Parser.java":        false,
+		"cmd/latest.go":               false,
+		"internal/testutil/helper.go": false,
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, isTest(path), path)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	report, err := Collect(repository(t), DefaultLargest)
+	require.NoError(t, err)
+
+	llm := nodes.NewScriptedLLM()
+	llm.OnContains("| Go | 2 | 7 | 5 |").Respond("  A small Go module with a web frontend.\n")
+	summary, err := Summarize(llm, nil, "/work", report)
+	require.NoError(t, err)
+	assert.Equal(t, "A small Go module with a web frontend.", summary)
+
+	report.Summary = summary
+	assert.Contains(t, report.Markdown(), "### Executive summary\n\nA small Go module with a web frontend.\n")
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// namePattern restricts collection names and keys to safe file names
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,128}$`)
+
+// FileStore stores each record as a JSON file at <dir>/<collection>/<key>.json
+// It needs no external dependencies and is the default backend
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a new file-based store rooted at dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{
+		dir: dir,
+	}
+}
+
+// validateName checks that a collection or key can be safely used as a file name
+func validateName(name string) error {
+	if !namePattern.MatchString(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid storage name %q", name)
+	}
+	return nil
+}
+
+// recordPath returns the file that stores collection/key
+func (s *FileStore) recordPath(collection, key string) (string, error) {
+	if err := validateName(collection); err != nil {
+		return "", err
+	}
+	if err := validateName(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, collection, key+".json"), nil
+}
+
+// Put implements the Store interface
+func (s *FileStore) Put(collection, key string, value any) error {
+	path, err := s.recordPath(collection, key)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s/%s: %v", collection, key, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create collection directory: %v", err)
+	}
+
+	// Write to a temporary file first so readers never see a partial record
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s/%s: %v", collection, key, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s/%s: %v", collection, key, err)
+	}
+
+	return nil
+}
+
+// Get implements the Store interface
+func (s *FileStore) Get(collection, key string, value any) error {
+	path, err := s.recordPath(collection, key)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to read %s/%s: %v", collection, key, err)
+	}
+
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to decode %s/%s: %v", collection, key, err)
+	}
+	return nil
+}
+
+// Delete implements the Store interface
+func (s *FileStore) Delete(collection, key string) error {
+	path, err := s.recordPath(collection, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete %s/%s: %v", collection, key, err)
+	}
+	return nil
+}
+
+// List implements the Store interface
+// The modification time of each file is used as the record's update time
+func (s *FileStore) List(collection string, query Query) ([]Record, error) {
+	if err := validateName(collection); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(filepath.Join(s.dir, collection))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Record{}, nil
+		}
+		return nil, fmt.Errorf("failed to read collection %s: %v", collection, err)
+	}
+
+	records := []Record{}
+	for _, file := range files {
+		key, ok := strings.CutSuffix(file.Name(), ".json")
+		if file.IsDir() || !ok || validateName(key) != nil {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue // The file was removed while listing
+		}
+		if !query.matches(info.ModTime()) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, collection, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s/%s: %v", collection, key, err)
+		}
+
+		records = append(records, Record{
+			Collection: collection,
+			Key:        key,
+			Value:      data,
+			UpdatedAt:  info.ModTime(),
+		})
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].UpdatedAt.Equal(records[j].UpdatedAt) {
+			return records[i].Key < records[j].Key
+		}
+		return records[i].UpdatedAt.Before(records[j].UpdatedAt)
+	})
+
+	if query.Limit > 0 && len(records) > query.Limit {
+		records = records[len(records)-query.Limit:]
+	}
+
+	return records, nil
+}
+
+// Close implements the Store interface
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testValue struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestFileStore_PutGetDelete(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+
+	var value testValue
+	assert.ErrorIs(t, store.Get("items", "a", &value), ErrNotFound)
+
+	assert.NoError(t, store.Put("items", "a", testValue{Name: "first", Count: 1}))
+	assert.NoError(t, store.Put("items", "a", testValue{Name: "first", Count: 2}))
+	assert.NoError(t, store.Get("items", "a", &value))
+	assert.Equal(t, testValue{Name: "first", Count: 2}, value)
+
+	assert.NoError(t, store.Delete("items", "a"))
+	assert.ErrorIs(t, store.Delete("items", "a"), ErrNotFound)
+
+	assert.Error(t, store.Put("items", "../escape", value))
+	assert.Error(t, store.Put("../items", "a", value))
+}
+
+func TestFileStore_List(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+
+	records, err := store.List("items", Query{})
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	assert.NoError(t, store.Put("items", "old", testValue{Name: "old"}))
+	assert.NoError(t, store.Put("items", "new", testValue{Name: "new"}))
+	assert.NoError(t, store.Put("other", "x", testValue{Name: "x"}))
+
+	// Age the first record so that time-based queries can exclude it
+	oldTime := time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "items", "old.json"), oldTime, oldTime))
+
+	records, err = store.List("items", Query{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "old", records[0].Key)
+
+	var value testValue
+	assert.NoError(t, records[1].Decode(&value))
+	assert.Equal(t, "new", value.Name)
+
+	records, err = store.List("items", Query{Since: time.Now().Add(-24 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "new", records[0].Key)
+
+	records, err = store.List("items", Query{Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "new", records[0].Key)
+}
+
+func TestOpen(t *testing.T) {
+	assert.Equal(t, BackendFile, DefaultBackend())
+
+	store, err := Open("", t.TempDir())
+	assert.NoError(t, err)
+	assert.IsType(t, &FileStore{}, store)
+	assert.NoError(t, store.Close())
+
+	_, err = Open("unknown", t.TempDir())
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BackendFile stores records as JSON files, one file per record
+const BackendFile = "file"
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// Record is a stored value together with its metadata
+type Record struct {
+	Collection string
+	Key        string
+	Value      []byte
+	UpdatedAt  time.Time
+}
+
+// Decode unmarshals the record value into v
+func (r Record) Decode(v any) error {
+	if err := json.Unmarshal(r.Value, v); err != nil {
+		return fmt.Errorf("failed to decode %s/%s: %v", r.Collection, r.Key, err)
+	}
+	return nil
+}
+
+// Query restricts the records returned by List
+// Zero values mean "no restriction"
+type Query struct {
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// matches reports whether a record updated at the given time satisfies the query time range
+func (q Query) matches(updatedAt time.Time) bool {
+	if !q.Since.IsZero() && updatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && updatedAt.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Store is a collection-oriented key/value store for the agent's persistent data
+// (conversation history, sessions, audit log, ...)
+// Values are encoded as JSON so every backend can store any serializable type
+type Store interface {
+	// Put creates or replaces the record stored under collection/key
+	Put(collection, key string, value any) error
+
+	// Get decodes the record stored under collection/key into value
+	// It returns ErrNotFound if the record does not exist
+	Get(collection, key string, value any) error
+
+	// Delete removes the record stored under collection/key
+	// It returns ErrNotFound if the record does not exist
+	Delete(collection, key string) error
+
+	// List returns the records of a collection matching the query, oldest first
+	List(collection string, query Query) ([]Record, error)
+
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// Factory opens a store whose data lives in the given directory
+type Factory func(dir string) (Store, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes a storage backend available under the given name
+// Registering an existing name replaces the previous backend
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// Backends returns the names of all registered backends
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultBackend returns the backend used when none is configured: JSON files
+func DefaultBackend() string {
+	return BackendFile
+}
+
+// Open opens a store using the named backend
+// An empty backend name selects DefaultBackend
+func Open(backend string, dir string) (Store, error) {
+	if backend == "" {
+		backend = DefaultBackend()
+	}
+
+	factoriesMu.RLock()
+	factory, ok := factories[backend]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q (available: %v)", backend, Backends())
+	}
+
+	store, err := factory(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s storage: %v", backend, err)
+	}
+	return store, nil
+}
+
+func init() {
+	Register(BackendFile, func(dir string) (Store, error) {
+		return NewFileStore(dir), nil
+	})
+}
@@ -0,0 +1,112 @@
+package terminal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"aiagent/pkg/redact"
+)
+
+// SourceTmux captures the scrollback of the current tmux pane instead of reading a file
+const SourceTmux = "tmux"
+
+// DefaultLines is the number of the last lines of the terminal kept as context
+const DefaultLines = 200
+
+// maxFileSize is the maximum size read from the end of a file; older output is ignored
+const maxFileSize = 1 << 20
+
+// tmuxCommand is the tmux executable, replaced in tests
+var tmuxCommand = "tmux"
+
+// ansiSequence matches the escape sequences of colors and cursor movements, as recorded
+// by script or tmux pipe-pane
+var ansiSequence = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// Capture returns the last lines shown in a terminal: the scrollback of the current tmux
+// pane if source is SourceTmux, otherwise the content of the file source, e.g. a log
+// recorded with script; secrets are redacted
+func Capture(source string, lines int) (string, error) {
+	if lines <= 0 {
+		lines = DefaultLines
+	}
+	var output []byte
+	var err error
+	if source == SourceTmux {
+		output, err = captureTmux(lines)
+	} else {
+		output, err = readTail(source)
+	}
+	if err != nil {
+		return "", err
+	}
+	return Clean(string(output), lines), nil
+}
+
+// captureTmux captures the visible part and the scrollback of the current pane
+func captureTmux(lines int) ([]byte, error) {
+	if os.Getenv("TMUX") == "" {
+		return nil, errors.New("not running inside tmux")
+	}
+	args := []string{"capture-pane", "-p", "-J", "-S", "-" + strconv.Itoa(lines)}
+	if pane := os.Getenv("TMUX_PANE"); pane != "" {
+		args = append(args, "-t", pane)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(tmuxCommand, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture the tmux pane: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// readTail reads the end of a file
+func readTail(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terminal output: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terminal output: %v", err)
+	}
+	offset := max(info.Size()-maxFileSize, 0)
+	data := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("failed to read terminal output: %v", err)
+	}
+	return data, nil
+}
+
+// Clean removes escape sequences and carriage returns from terminal output, keeps its
+// last lines and redacts secrets
+func Clean(output string, lines int) string {
+	output = ansiSequence.ReplaceAllString(output, "")
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+
+	var kept []string
+	for _, line := range strings.Split(output, "\n") {
+		// A carriage return redraws the line, e.g. for progress bars: the last part wins
+		if i := strings.LastIndex(line, "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		kept = append(kept, strings.TrimRight(line, " \t"))
+	}
+	for len(kept) > 0 && kept[len(kept)-1] == "" {
+		kept = kept[:len(kept)-1]
+	}
+	if lines > 0 && len(kept) > lines {
+		kept = kept[len(kept)-lines:]
+	}
+	return redact.Redact(strings.Join(kept, "\n"))
+}
@@ -0,0 +1,35 @@
+package testrepo
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	spec := Spec{Depth: 2, DirsPerLevel: 2, FilesPerDir: 3, FileSize: 200, BinaryEvery: 4}
+
+	files, err := Generate(dir, spec)
+	assert.NoError(t, err)
+	assert.Equal(t, 21, files) // (1 + 2 + 4) directories with 3 files each
+	assert.Equal(t, files, spec.Files())
+
+	var walked, binary int
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		walked++
+		if strings.HasSuffix(path, ".bin") {
+			binary++
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, files, walked)
+	assert.Equal(t, 5, binary)
+}
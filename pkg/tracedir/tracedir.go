@@ -0,0 +1,102 @@
+package tracedir
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// unsafeNameChars matches characters that are replaced in file names
+var unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Writer dumps the prompts, responses and node results of a run as numbered files,
+// so the decisions of a run can be inspected with a file browser or diff
+//
+// Files are named <seq>-<node>-<kind>.<ext>, e.g. 0003-classifier-prompt.txt;
+// the sequence number orders all files of a run. A nil *Writer writes nothing
+type Writer struct {
+	dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewWriter creates a new instance of Writer writing to <root>/<runID>
+func NewWriter(root, runID string) (*Writer, error) {
+	dir := filepath.Join(root, sanitize(runID))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create trace directory: %v", err)
+	}
+	return &Writer{dir: dir}, nil
+}
+
+// Dir returns the directory the files are written to
+func (w *Writer) Dir() string {
+	if w == nil {
+		return ""
+	}
+	return w.dir
+}
+
+// WriteLLMCall writes the system prompt (if any), the prompt and the raw response
+// (or the error) of an LLM call
+func (w *Writer) WriteLLMCall(node, systemPrompt, prompt, response string, callErr error) error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+
+	if systemPrompt != "" {
+		if err := w.write(node, "system.txt", []byte(systemPrompt)); err != nil {
+			return err
+		}
+	}
+	if err := w.write(node, "prompt.txt", []byte(prompt)); err != nil {
+		return err
+	}
+	if callErr != nil {
+		return w.write(node, "error.txt", []byte(callErr.Error()))
+	}
+	return w.write(node, "response.txt", []byte(response))
+}
+
+// WriteResult writes the parsed result of a node as indented JSON
+func (w *Writer) WriteResult(node string, result any) error {
+	if w == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode result of %s: %v", node, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	return w.write(node, "result.json", append(data, '\n'))
+}
+
+// write writes a file for the current sequence number
+func (w *Writer) write(node, suffix string, data []byte) error {
+	name := fmt.Sprintf("%04d-%s-%s", w.seq, sanitize(node), suffix)
+	if err := os.WriteFile(filepath.Join(w.dir, name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write trace file: %v", err)
+	}
+	return nil
+}
+
+// sanitize makes a value safe to use in a file name
+func sanitize(name string) string {
+	name = unsafeNameChars.ReplaceAllString(name, "_")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
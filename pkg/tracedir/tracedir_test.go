@@ -0,0 +1,57 @@
+package tracedir
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	root := t.TempDir()
+	writer, err := NewWriter(root, "20250101-120000-abc123")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "20250101-120000-abc123"), writer.Dir())
+
+	assert.NoError(t, writer.WriteLLMCall("classifier", "", "classify this", `{"next_node": "bash"}`, nil))
+	assert.NoError(t, writer.WriteResult("classifier", map[string]string{"next_node": "bash"}))
+	assert.NoError(t, writer.WriteLLMCall("bash", "You are a shell expert", "generate a command", "", errors.New("timeout")))
+
+	entries, err := os.ReadDir(writer.Dir())
+	assert.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{
+		"0001-classifier-prompt.txt",
+		"0001-classifier-response.txt",
+		"0002-classifier-result.json",
+		"0003-bash-error.txt",
+		"0003-bash-prompt.txt",
+		"0003-bash-system.txt",
+	}, names)
+
+	data, err := os.ReadFile(filepath.Join(writer.Dir(), "0002-classifier-result.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n  \"next_node\": \"bash\"\n}\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(writer.Dir(), "0001-classifier-prompt.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "classify this", string(data))
+}
+
+func TestWriter_Nil(t *testing.T) {
+	var writer *Writer
+	assert.NoError(t, writer.WriteLLMCall("classifier", "", "prompt", "response", nil))
+	assert.NoError(t, writer.WriteResult("classifier", nil))
+	assert.Equal(t, "", writer.Dir())
+}
+
+func TestSanitize(t *testing.T) {
+	assert.Equal(t, "code_analyzer", sanitize("code_analyzer"))
+	assert.Equal(t, "_etc_passwd", sanitize("../etc/passwd"))
+	assert.Equal(t, "_", sanitize(""))
+}
@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StatusCode is the status of a finished span, using the OpenTelemetry values
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key/value pair attached to a span
+// Values are strings, bools, ints, int64s or float64s
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String creates a string attribute
+func String(key, value string) Attribute { return Attribute{Key: key, Value: value} }
+
+// Int creates an integer attribute
+func Int(key string, value int) Attribute { return Attribute{Key: key, Value: int64(value)} }
+
+// Int64 creates an integer attribute
+func Int64(key string, value int64) Attribute { return Attribute{Key: key, Value: value} }
+
+// Bool creates a boolean attribute
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
+
+// Exporter sends finished spans to a tracing backend
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// SpanData is the immutable snapshot of a finished span handed to exporters
+type SpanData struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Tracer creates spans and hands them to an exporter once they end
+// A nil *Tracer is valid and records nothing, so callers never need to check
+// whether tracing is enabled
+type Tracer struct {
+	exporter Exporter
+
+	mu       sync.Mutex
+	finished []SpanData
+}
+
+// NewTracer creates a new instance of Tracer exporting to the given exporter
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+	}
+}
+
+// Start starts a root span
+func (t *Tracer) Start(name string, attrs ...Attribute) *Span {
+	return t.StartAt(nil, name, time.Now(), attrs...)
+}
+
+// StartChild starts a span as a child of parent
+func (t *Tracer) StartChild(parent *Span, name string, attrs ...Attribute) *Span {
+	return t.StartAt(parent, name, time.Now(), attrs...)
+}
+
+// StartAt starts a span at the given time, for operations that are only reported
+// after they completed; a nil parent starts a new trace
+func (t *Tracer) StartAt(parent *Span, name string, start time.Time, attrs ...Attribute) *Span {
+	if t == nil {
+		return nil
+	}
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			SpanID:     newID(8),
+			Name:       name,
+			Start:      start,
+			Attributes: append([]Attribute(nil), attrs...),
+		},
+	}
+	if parent != nil {
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentSpanID = parent.data.SpanID
+	} else {
+		span.data.TraceID = newID(16)
+	}
+	return span
+}
+
+// Flush exports all spans finished since the last flush
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	spans := t.finished
+	t.finished = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 || t.exporter == nil {
+		return nil
+	}
+	if err := t.exporter.Export(ctx, spans); err != nil {
+		return fmt.Errorf("failed to export spans: %v", err)
+	}
+	return nil
+}
+
+// end records a finished span
+func (t *Tracer) end(data SpanData) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.finished = append(t.finished, data)
+}
+
+// Span is an operation being traced
+// All methods are safe to call on a nil *Span
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// RecordError marks the span as failed; a nil error is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = StatusError
+	s.data.StatusMessage = err.Error()
+}
+
+// TraceID returns the hex encoded trace ID of the span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.TraceID
+}
+
+// End finishes the span now
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+// EndAt finishes the span at the given time; only the first call has an effect
+func (s *Span) EndAt(end time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = end
+	data := s.data
+	data.Attributes = append([]Attribute(nil), s.data.Attributes...)
+	s.mu.Unlock()
+
+	s.tracer.end(data)
+}
+
+// newID returns a random hex encoded ID of n bytes
+func newID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to the clock, IDs only need to be unique within a trace
+		nanos := time.Now().UnixNano()
+		for i := range b {
+			b[i] = byte(nanos >> (8 * (i % 8)))
+		}
+	}
+	return hex.EncodeToString(b)
+}
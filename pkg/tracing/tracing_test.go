@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryExporter keeps exported spans in memory
+type memoryExporter struct {
+	spans []SpanData
+}
+
+func (e *memoryExporter) Export(ctx context.Context, spans []SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTracer_SpanHierarchy(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(exporter)
+
+	run := tracer.Start("aiagent.run", String("aiagent.run_id", "run-1"))
+	node := tracer.StartChild(run, "node bash")
+	started := time.Now().Add(-time.Second)
+	command := tracer.StartAt(node, "command.execute", started, Int("process.exit.code", 1))
+	command.RecordError(errors.New("exit status 1"))
+	command.EndAt(started.Add(500 * time.Millisecond))
+	node.End()
+	node.End() // Ending twice has no effect
+	run.End()
+
+	assert.NoError(t, tracer.Flush(context.Background()))
+	assert.Len(t, exporter.spans, 3)
+
+	spans := make(map[string]SpanData)
+	for _, span := range exporter.spans {
+		spans[span.Name] = span
+	}
+	assert.Equal(t, run.TraceID(), spans["node bash"].TraceID)
+	assert.Equal(t, spans["aiagent.run"].SpanID, spans["node bash"].ParentSpanID)
+	assert.Equal(t, spans["node bash"].SpanID, spans["command.execute"].ParentSpanID)
+	assert.Empty(t, spans["aiagent.run"].ParentSpanID)
+	assert.Equal(t, StatusError, spans["command.execute"].Status)
+	assert.Equal(t, 500*time.Millisecond, spans["command.execute"].End.Sub(spans["command.execute"].Start))
+
+	// Spans are only exported once
+	assert.NoError(t, tracer.Flush(context.Background()))
+	assert.Len(t, exporter.spans, 3)
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.Start("run")
+	span.SetAttributes(String("key", "value"))
+	span.RecordError(errors.New("failed"))
+	span.End()
+	assert.Equal(t, "", span.TraceID())
+	assert.NoError(t, tracer.Flush(context.Background()))
+}
+
+func TestOTLPExporter_Export(t *testing.T) {
+	var body []byte
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		header = r.Header.Get("Authorization")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(TracesEndpoint(server.URL), ParseHeaders("Authorization=Bearer token, broken"), "")
+	tracer := NewTracer(exporter)
+	span := tracer.Start("llm.complete", String("gen_ai.request.model", "gpt-4o"), Int("gen_ai.usage.input_tokens", 42), Bool("cached", false))
+	span.End()
+	assert.NoError(t, tracer.Flush(context.Background()))
+	assert.Equal(t, "Bearer token", header)
+
+	var request otlpRequest
+	assert.NoError(t, json.Unmarshal(body, &request))
+	assert.Equal(t, DefaultServiceName, *request.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	exported := request.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Len(t, exported, 1)
+	assert.Equal(t, "llm.complete", exported[0].Name)
+	assert.Len(t, exported[0].TraceID, 32)
+	assert.Len(t, exported[0].SpanID, 16)
+	assert.Equal(t, "gpt-4o", *exported[0].Attributes[0].Value.StringValue)
+	assert.Equal(t, "42", *exported[0].Attributes[1].Value.IntValue)
+	assert.False(t, *exported[0].Attributes[2].Value.BoolValue)
+}
+
+func TestOTLPExporter_CollectorError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	tracer := NewTracer(NewOTLPExporter(server.URL, nil, ""))
+	tracer.Start("run").End()
+	assert.Error(t, tracer.Flush(context.Background()))
+}
+
+func TestTracesEndpoint(t *testing.T) {
+	assert.Equal(t, "http://localhost:4318/v1/traces", TracesEndpoint("http://localhost:4318"))
+	assert.Equal(t, "http://localhost:4318/v1/traces", TracesEndpoint("http://localhost:4318/"))
+	assert.Equal(t, "http://collector/v1/traces", TracesEndpoint("http://collector/v1/traces"))
+}
@@ -0,0 +1,287 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"aiagent/pkg/redact"
+	"aiagent/pkg/report"
+)
+
+// Format identifies a transcript export format
+type Format string
+
+const (
+	// FormatOpenAIJSONL writes one OpenAI chat conversation ({"messages": [...]}) per line
+	FormatOpenAIJSONL Format = "openai-jsonl"
+
+	// FormatMarkdown writes a human-readable Markdown document
+	FormatMarkdown Format = "markdown"
+
+	// FormatHTML writes a standalone HTML page
+	FormatHTML Format = "html"
+)
+
+// Formats lists all supported export formats
+var Formats = []Format{FormatOpenAIJSONL, FormatMarkdown, FormatHTML}
+
+// chatMessage is a message in the OpenAI chat format
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	Name    string `json:"name,omitempty"`
+}
+
+// Export writes the transcript in the given format
+// Secrets are always redacted from the exported content
+func Export(w io.Writer, t *Transcript, format Format) error {
+	redacted := t.Redacted()
+
+	switch format {
+	case FormatOpenAIJSONL:
+		return exportOpenAIJSONL(w, redacted)
+	case FormatMarkdown:
+		return exportMarkdown(w, redacted)
+	case FormatHTML:
+		return exportHTML(w, redacted)
+	default:
+		return fmt.Errorf("unsupported export format %q (supported: %v)", format, Formats)
+	}
+}
+
+// Redacted returns a copy of the transcript with secrets removed from all free text
+func (t *Transcript) Redacted() *Transcript {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	copied := &Transcript{
+		SchemaVersion: t.SchemaVersion,
+		RunID:         t.RunID,
+		Session:       t.Session,
+		Language:      t.Language,
+		Input:         redact.Redact(t.Input),
+		Result:        redact.Redact(t.Result),
+		Status:        t.Status,
+		Error:         redact.Redact(t.Error),
+		StartedAt:     t.StartedAt,
+		FinishedAt:    t.FinishedAt,
+		Steps:         make([]Step, len(t.Steps)),
+	}
+	for i, step := range t.Steps {
+		step.Prompt = redact.Redact(step.Prompt)
+		step.Response = redact.Redact(step.Response)
+		step.Command = redact.Redact(step.Command)
+		step.Output = redact.Redact(step.Output)
+		step.Error = redact.Redact(step.Error)
+		copied.Steps[i] = step
+	}
+	if t.Report != nil {
+		runReport := *t.Report
+		runReport.Error = redact.Redact(runReport.Error)
+		runReport.Visits = make([]report.NodeVisit, len(t.Report.Visits))
+		for i, visit := range t.Report.Visits {
+			visit.Error = redact.Redact(visit.Error)
+			visit.Commands = make([]report.Command, len(t.Report.Visits[i].Commands))
+			for j, command := range t.Report.Visits[i].Commands {
+				command.Command = redact.Redact(command.Command)
+				visit.Commands[j] = command
+			}
+			runReport.Visits[i] = visit
+		}
+		copied.Report = &runReport
+	}
+	if t.Feedback != nil {
+		feedback := *t.Feedback
+		feedback.Note = redact.Redact(feedback.Note)
+		feedback.Command = redact.Redact(feedback.Command)
+		copied.Feedback = &feedback
+	}
+	return copied
+}
+
+// exportOpenAIJSONL writes every LLM exchange and command as its own conversation,
+// followed by the overall request and final result
+func exportOpenAIJSONL(w io.Writer, t *Transcript) error {
+	encoder := json.NewEncoder(w)
+	write := func(messages ...chatMessage) error {
+		if err := encoder.Encode(map[string][]chatMessage{"messages": messages}); err != nil {
+			return fmt.Errorf("failed to write transcript: %v", err)
+		}
+		return nil
+	}
+
+	for _, step := range t.Steps {
+		var err error
+		switch step.Kind {
+		case StepLLM:
+			response := step.Response
+			if step.Error != "" {
+				response = "Error: " + step.Error
+			}
+			err = write(
+				chatMessage{Role: "user", Content: step.Prompt, Name: string(step.Node)},
+				chatMessage{Role: "assistant", Content: response},
+			)
+		case StepCommand:
+			err = write(
+				chatMessage{Role: "assistant", Content: "$ " + step.Command, Name: string(step.Node)},
+				chatMessage{Role: "user", Content: commandOutcome(step)},
+			)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	result := t.Result
+	if t.Error != "" {
+		result = "Error: " + t.Error
+	}
+	return write(
+		chatMessage{Role: "user", Content: t.Input},
+		chatMessage{Role: "assistant", Content: result},
+	)
+}
+
+// commandOutcome describes the output of a command step
+func commandOutcome(step Step) string {
+	outcome := "Output:\n" + step.Output
+	if step.Error != "" {
+		outcome += "\nError: " + step.Error
+	}
+	return outcome
+}
+
+// exportMarkdown writes the transcript as a Markdown document
+func exportMarkdown(w io.Writer, t *Transcript) error {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# Run %s\n\n", t.RunID))
+	sb.WriteString(fmt.Sprintf("- **Status:** %s\n", t.Status))
+	sb.WriteString(fmt.Sprintf("- **Started:** %s\n", t.StartedAt.Format(time.RFC3339)))
+	if !t.FinishedAt.IsZero() {
+		sb.WriteString(fmt.Sprintf("- **Duration:** %s\n", t.FinishedAt.Sub(t.StartedAt).Round(time.Millisecond)))
+	}
+	if t.Session != "" {
+		sb.WriteString(fmt.Sprintf("- **Session:** %s\n", t.Session))
+	}
+	sb.WriteString(fmt.Sprintf("\n## Request\n\n%s\n", t.Input))
+
+	for i, step := range t.Steps {
+		switch step.Kind {
+		case StepLLM:
+			sb.WriteString(fmt.Sprintf("\n## Step %d: %s (LLM)\n\n", i+1, step.Node))
+			sb.WriteString(fmt.Sprintf("### Prompt\n\n%s\n", fenced(step.Prompt)))
+			if step.Error != "" {
+				sb.WriteString(fmt.Sprintf("\n### Error\n\n%s\n", step.Error))
+			} else {
+				sb.WriteString(fmt.Sprintf("\n### Response\n\n%s\n", fenced(step.Response)))
+			}
+		case StepCommand:
+			sb.WriteString(fmt.Sprintf("\n## Step %d: %s (command)\n\n", i+1, step.Node))
+			sb.WriteString(fmt.Sprintf("%s\n", fenced("$ "+step.Command)))
+			if step.Output != "" {
+				sb.WriteString(fmt.Sprintf("\n### Output\n\n%s\n", fenced(step.Output)))
+			}
+			if step.Error != "" {
+				sb.WriteString(fmt.Sprintf("\n### Error\n\n%s\n", step.Error))
+			}
+		}
+	}
+
+	sb.WriteString("\n## Result\n\n")
+	if t.Error != "" {
+		sb.WriteString(fmt.Sprintf("Error: %s\n", t.Error))
+	} else {
+		sb.WriteString(t.Result + "\n")
+	}
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return fmt.Errorf("failed to write transcript: %v", err)
+	}
+	return nil
+}
+
+// fenced wraps text in a Markdown code fence that cannot be closed by the text itself
+func fenced(text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + text + "\n" + fence
+}
+
+// htmlTemplate renders a transcript as a standalone HTML page
+var htmlTemplate = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>aiagent run {{.RunID}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; }
+pre { background: #f5f5f5; padding: 1em; overflow-x: auto; white-space: pre-wrap; }
+.step { border-left: 4px solid #ccc; padding-left: 1em; margin: 1.5em 0; }
+.llm { border-color: #4a90d9; }
+.command { border-color: #e0a030; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Run {{.RunID}}</h1>
+<ul>
+<li><strong>Status:</strong> {{.Status}}</li>
+<li><strong>Started:</strong> {{.StartedAt.Format "2006-01-02T15:04:05Z07:00"}}</li>
+{{- if .Session}}
+<li><strong>Session:</strong> {{.Session}}</li>
+{{- end}}
+</ul>
+<h2>Request</h2>
+<pre>{{.Input}}</pre>
+{{- range $i, $step := .Steps}}
+<div class="step {{$step.Kind}}">
+{{- if eq $step.Kind "llm"}}
+<h3>Step {{inc $i}}: {{$step.Node}} (LLM)</h3>
+<h4>Prompt</h4>
+<pre>{{$step.Prompt}}</pre>
+{{- if $step.Error}}
+<p class="error">Error: {{$step.Error}}</p>
+{{- else}}
+<h4>Response</h4>
+<pre>{{$step.Response}}</pre>
+{{- end}}
+{{- else}}
+<h3>Step {{inc $i}}: {{$step.Node}} (command)</h3>
+<pre>$ {{$step.Command}}</pre>
+{{- if $step.Output}}
+<h4>Output</h4>
+<pre>{{$step.Output}}</pre>
+{{- end}}
+{{- if $step.Error}}
+<p class="error">Error: {{$step.Error}}</p>
+{{- end}}
+{{- end}}
+</div>
+{{- end}}
+<h2>Result</h2>
+{{- if .Error}}
+<p class="error">Error: {{.Error}}</p>
+{{- else}}
+<pre>{{.Result}}</pre>
+{{- end}}
+</body>
+</html>
+`))
+
+// exportHTML writes the transcript as a standalone HTML page
+func exportHTML(w io.Writer, t *Transcript) error {
+	if err := htmlTemplate.Execute(w, t); err != nil {
+		return fmt.Errorf("failed to write transcript: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package transcript
+
+import (
+	"fmt"
+	"time"
+
+	"aiagent/pkg/nodes"
+)
+
+// Verdict is the opinion of the user on the outcome of a run
+type Verdict string
+
+const (
+	VerdictGood Verdict = "good"
+	VerdictBad  Verdict = "bad"
+)
+
+// ParseVerdict parses a verdict given on the command line
+func ParseVerdict(s string) (Verdict, error) {
+	switch Verdict(s) {
+	case VerdictGood, VerdictBad:
+		return Verdict(s), nil
+	default:
+		return "", fmt.Errorf("unknown verdict %q: use good or bad", s)
+	}
+}
+
+// Feedback is the verdict of the user on a run
+type Feedback struct {
+	Verdict Verdict   `json:"verdict"`
+	Note    string    `json:"note,omitempty"`
+	Time    time.Time `json:"time"`
+
+	// Node is the node that should have handled the request of a bad run
+	Node nodes.NodeType `json:"node,omitempty"`
+
+	// Command is the command that should have run for a bad run
+	Command string `json:"command,omitempty"`
+}
+
+// SetFeedback records the verdict of the user on the run, replacing an earlier one
+func (t *Transcript) SetFeedback(feedback Feedback) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if feedback.Time.IsZero() {
+		feedback.Time = time.Now()
+	}
+	t.Feedback = &feedback
+}
+
+// Route returns the node the request of the run was routed to first
+func (t *Transcript) Route() nodes.NodeType {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.Report != nil {
+		for _, visit := range t.Report.Visits {
+			if node := nodes.NodeType(visit.Node); routed(node) {
+				return node
+			}
+		}
+	}
+	for _, step := range t.Steps {
+		if routed(step.Node) {
+			return step.Node
+		}
+	}
+	return ""
+}
+
+// routed reports whether the classifier can route a request to the node
+func routed(node nodes.NodeType) bool {
+	return node != "" && node != nodes.NodeTypeClassifier && node != nodes.NodeTypeClarification
+}
+
+// LastCommand returns the last command the run executed
+func (t *Transcript) LastCommand() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.Steps) - 1; i >= 0; i-- {
+		if step := t.Steps[i]; step.Kind == StepCommand && !step.Rejected {
+			return step.Command
+		}
+	}
+	return ""
+}
+
+// Lessons are the examples learned from the feedback on earlier runs, added to the
+// prompts so the agent does not repeat its mistakes
+type Lessons struct {
+	Routing  []nodes.RoutingExample
+	Commands []nodes.CommandExample
+}
+
+// Learn turns the feedback on the given runs into at most limit examples of each kind,
+// preferring the most recent runs
+func Learn(transcripts []*Transcript, limit int) Lessons {
+	var lessons Lessons
+	for i := len(transcripts) - 1; i >= 0; i-- {
+		t := transcripts[i]
+		if t.Feedback == nil {
+			continue
+		}
+		feedback := *t.Feedback
+		route := t.Route()
+		command := t.LastCommand()
+
+		if len(lessons.Routing) < limit {
+			if example, ok := routingLesson(t.Input, feedback, route, command); ok {
+				lessons.Routing = append(lessons.Routing, example)
+			}
+		}
+		if len(lessons.Commands) < limit {
+			if example, ok := commandLesson(t.Input, feedback, route, command); ok {
+				lessons.Commands = append(lessons.Commands, example)
+			}
+		}
+	}
+	return lessons
+}
+
+// routingLesson returns the routing example taught by the feedback on a run
+// A bad run without a correction is blamed on its command if it ran one, otherwise on its route
+func routingLesson(input string, feedback Feedback, route nodes.NodeType, command string) (nodes.RoutingExample, bool) {
+	example := nodes.RoutingExample{Input: input}
+	switch {
+	case feedback.Verdict == VerdictGood && route != "":
+		example.Node = route
+	case feedback.Verdict == VerdictBad && feedback.Node != "":
+		example.Node = feedback.Node
+		if route != feedback.Node {
+			example.Wrong = route
+		}
+	case feedback.Verdict == VerdictBad && feedback.Command == "" && command == "" && route != "":
+		example.Wrong = route
+	default:
+		return example, false
+	}
+	return example, true
+}
+
+// commandLesson returns the command example taught by the feedback on a run
+func commandLesson(input string, feedback Feedback, route nodes.NodeType, command string) (nodes.CommandExample, bool) {
+	example := nodes.CommandExample{Goal: input}
+	switch {
+	case feedback.Verdict == VerdictGood && route == nodes.NodeTypeBash && command != "":
+		example.Command = command
+	case feedback.Verdict == VerdictBad && feedback.Command != "":
+		example.Command = feedback.Command
+		if command != feedback.Command {
+			example.Wrong = command
+		}
+	case feedback.Verdict == VerdictBad && feedback.Node == "" && route == nodes.NodeTypeBash && command != "":
+		example.Wrong = command
+	default:
+		return example, false
+	}
+	return example, true
+}
@@ -0,0 +1,70 @@
+package transcript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/storage"
+)
+
+func TestParseVerdict(t *testing.T) {
+	verdict, err := ParseVerdict("bad")
+	assert.NoError(t, err)
+	assert.Equal(t, VerdictBad, verdict)
+
+	_, err = ParseVerdict("meh")
+	assert.EqualError(t, err, `unknown verdict "meh": use good or bad`)
+}
+
+func TestStore_Feedback(t *testing.T) {
+	store := NewStore(storage.NewFileStore(t.TempDir()))
+	tr := newTestTranscript()
+	tr.SetFeedback(Feedback{Verdict: VerdictBad, Command: "ls -la", Note: "hidden files too"})
+	assert.NoError(t, store.Save(tr))
+
+	loaded, err := store.Load("run-1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, loaded.Feedback) {
+		assert.Equal(t, VerdictBad, loaded.Feedback.Verdict)
+		assert.Equal(t, "ls -la", loaded.Feedback.Command)
+		assert.Equal(t, "hidden files too", loaded.Feedback.Note)
+		assert.False(t, loaded.Feedback.Time.IsZero())
+	}
+}
+
+func TestLearn(t *testing.T) {
+	run := func(input string, node nodes.NodeType, command string, feedback *Feedback) *Transcript {
+		tr := New("run-"+input, input)
+		tr.AddStep(Step{Kind: StepLLM, Node: nodes.NodeTypeClassifier})
+		tr.AddStep(Step{Kind: StepLLM, Node: node})
+		if command != "" {
+			tr.AddStep(Step{Kind: StepCommand, Node: nodes.NodeTypeBash, Command: command})
+		}
+		tr.Feedback = feedback
+		return tr
+	}
+
+	transcripts := []*Transcript{
+		run("oldest", nodes.NodeTypeBash, "ls", &Feedback{Verdict: VerdictGood}),
+		run("no feedback", nodes.NodeTypeBash, "ls", nil),
+		run("disk usage", nodes.NodeTypeBash, "du", &Feedback{Verdict: VerdictGood}),
+		run("what is go", nodes.NodeTypeBash, "go", &Feedback{Verdict: VerdictBad, Node: nodes.NodeTypeDirectResponse}),
+		run("hidden files", nodes.NodeTypeBash, "ls", &Feedback{Verdict: VerdictBad, Command: "ls -a"}),
+		run("wrong command", nodes.NodeTypeBash, "rm -r x", &Feedback{Verdict: VerdictBad}),
+		run("explain main", nodes.NodeTypeDirectResponse, "", &Feedback{Verdict: VerdictBad}),
+	}
+
+	lessons := Learn(transcripts, 3)
+	assert.Equal(t, []nodes.RoutingExample{
+		{Input: "explain main", Wrong: nodes.NodeTypeDirectResponse},
+		{Input: "what is go", Node: nodes.NodeTypeDirectResponse, Wrong: nodes.NodeTypeBash},
+		{Input: "disk usage", Node: nodes.NodeTypeBash},
+	}, lessons.Routing)
+	assert.Equal(t, []nodes.CommandExample{
+		{Goal: "wrong command", Wrong: "rm -r x"},
+		{Goal: "hidden files", Command: "ls -a", Wrong: "ls"},
+		{Goal: "disk usage", Command: "du"},
+	}, lessons.Commands)
+}
@@ -0,0 +1,158 @@
+package transcript
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"aiagent/pkg/nodes"
+)
+
+var (
+	// ErrReplayExhausted is returned when a replay needs more LLM responses or commands than were recorded
+	ErrReplayExhausted = errors.New("no more recorded steps to replay")
+
+	// ErrReplayDiverged is returned by a strict Player when a prompt or command differs from the recording
+	ErrReplayDiverged = errors.New("replay diverged from the recorded run")
+)
+
+// Divergence describes a prompt or command of a replay that differs from the recorded one
+type Divergence struct {
+	Kind     StepKind
+	Index    int // Position among the recorded steps of the same kind
+	Node     nodes.NodeType
+	Recorded string
+	Actual   string
+}
+
+// Player replays a recorded run: it answers LLM calls with the recorded responses
+// and, when used as command runner, returns the recorded command output
+// Steps are replayed in their recorded order; since prompts sent concurrently may have been
+// recorded in any order, a prompt is answered by a later unused step with the same prompt first
+type Player struct {
+	// Strict makes the player fail as soon as a prompt or command differs from the recording
+	Strict bool
+
+	mu          sync.Mutex
+	llmSteps    []Step
+	commands    []Step
+	nextLLM     int // First LLM step that was not replayed
+	replayedLLM []bool
+	nextCommand int
+	divergences []Divergence
+}
+
+// NewPlayer creates a new player for the recorded steps of t
+func NewPlayer(t *Transcript) *Player {
+	p := &Player{}
+	for _, step := range t.Steps {
+		switch step.Kind {
+		case StepLLM:
+			p.llmSteps = append(p.llmSteps, step)
+		case StepCommand:
+			if !wasRejected(step) {
+				p.commands = append(p.commands, step)
+			}
+		}
+	}
+	p.replayedLLM = make([]bool, len(p.llmSteps))
+	return p
+}
+
+// wasRejected reports whether a recorded command was refused by the command policy
+// Transcripts written before Step.Rejected existed only carry the error message
+func wasRejected(step Step) bool {
+	return step.Rejected || strings.HasPrefix(step.Error, nodes.ErrPolicyDenied.Error())
+}
+
+// Complete implements the LLM interface by returning the next recorded response
+func (p *Player) Complete(prompt string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.nextLLM >= len(p.llmSteps) {
+		return "", fmt.Errorf("%w: the run made more than %d LLM calls", ErrReplayExhausted, len(p.llmSteps))
+	}
+	index := p.nextLLM
+	for i := p.nextLLM; i < len(p.llmSteps); i++ {
+		if !p.replayedLLM[i] && p.llmSteps[i].Prompt == prompt {
+			index = i
+			break
+		}
+	}
+	step := p.llmSteps[index]
+	p.replayedLLM[index] = true
+	for p.nextLLM < len(p.llmSteps) && p.replayedLLM[p.nextLLM] {
+		p.nextLLM++
+	}
+
+	if err := p.compare(StepLLM, index, step, step.Prompt, prompt); err != nil {
+		return "", err
+	}
+	if step.Error != "" {
+		return step.Response, errors.New(step.Error)
+	}
+	return step.Response, nil
+}
+
+// RunCommand implements nodes.CommandRunner by returning the output of the next recorded command
+// The exit code of a recorded failure is not known and reported as 1
+func (p *Player) RunCommand(command, dir string) ([]byte, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.nextCommand >= len(p.commands) {
+		return nil, -1, fmt.Errorf("%w: the run executed more than %d commands", ErrReplayExhausted, len(p.commands))
+	}
+	index := p.nextCommand
+	step := p.commands[index]
+	p.nextCommand++
+
+	if err := p.compare(StepCommand, index, step, step.Command, command); err != nil {
+		return nil, -1, err
+	}
+	if step.Error != "" {
+		// The bash node adds the error kind again
+		message := strings.TrimPrefix(step.Error, nodes.ErrCommandFailed.Error()+": ")
+		return []byte(step.Output), 1, errors.New(message)
+	}
+	return []byte(step.Output), 0, nil
+}
+
+// compare records a divergence if actual differs from recorded; in strict mode it returns an error
+func (p *Player) compare(kind StepKind, index int, step Step, recorded, actual string) error {
+	if recorded == actual {
+		return nil
+	}
+	p.divergences = append(p.divergences, Divergence{
+		Kind:     kind,
+		Index:    index,
+		Node:     step.Node,
+		Recorded: recorded,
+		Actual:   actual,
+	})
+	if p.Strict {
+		return fmt.Errorf("%w: %s step %d of node %s", ErrReplayDiverged, kind, index+1, step.Node)
+	}
+	return nil
+}
+
+// Divergences returns the prompts and commands that differed from the recording
+func (p *Player) Divergences() []Divergence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Divergence(nil), p.divergences...)
+}
+
+// Remaining returns the number of recorded LLM responses and commands that were not replayed
+func (p *Player) Remaining() (llmCalls int, commands int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, replayed := range p.replayedLLM {
+		if !replayed {
+			llmCalls++
+		}
+	}
+	return llmCalls, len(p.commands) - p.nextCommand
+}
@@ -0,0 +1,109 @@
+package transcript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/nodes"
+)
+
+func TestPlayer(t *testing.T) {
+	recorded := newTestTranscript()
+	recorded.AddStep(Step{Kind: StepCommand, Node: nodes.NodeTypeBash, Command: "rm -rf /", Error: "command validation failed: dangerous", Rejected: true})
+	recorded.AddStep(Step{Kind: StepCommand, Node: nodes.NodeTypeBash, Command: "ls missing", Output: "ls: missing: No such file", Error: "command execution failed: exit status 2"})
+	player := NewPlayer(recorded)
+
+	response, err := player.Complete("classify: list files")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"next_node": "bash"}`, response)
+
+	output, exitCode, err := player.RunCommand("ls", "/tmp")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "main.go\ntoken=abcdef123", string(output))
+
+	// The rejected command never ran, so the next command is the failed one
+	output, exitCode, err = player.RunCommand("ls missing", "/tmp")
+	assert.EqualError(t, err, "exit status 2")
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "ls: missing: No such file", string(output))
+
+	_, err = player.Complete("classify again")
+	assert.ErrorIs(t, err, ErrReplayExhausted)
+	assert.Empty(t, player.Divergences())
+
+	llmCalls, commands := player.Remaining()
+	assert.Equal(t, 0, llmCalls)
+	assert.Equal(t, 0, commands)
+}
+
+func TestPlayer_Divergence(t *testing.T) {
+	player := NewPlayer(newTestTranscript())
+
+	response, err := player.Complete("classify: list all files")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"next_node": "bash"}`, response)
+	assert.Equal(t, []Divergence{{
+		Kind:     StepLLM,
+		Node:     nodes.NodeTypeClassifier,
+		Recorded: "classify: list files",
+		Actual:   "classify: list all files",
+	}}, player.Divergences())
+
+	strict := NewPlayer(newTestTranscript())
+	strict.Strict = true
+	_, _, err = strict.RunCommand("ls -la", "/tmp")
+	assert.ErrorIs(t, err, ErrReplayDiverged)
+}
+
+func TestPlayer_ConcurrentPrompts(t *testing.T) {
+	recorded := New("run-1", "list files")
+	recorded.AddStep(Step{Kind: StepLLM, Node: nodes.NodeTypeClassifier, Prompt: "verify", Response: "done"})
+	recorded.AddStep(Step{Kind: StepLLM, Node: nodes.NodeTypeClassifier, Prompt: "goal met?", Response: "met"})
+	recorded.AddStep(Step{Kind: StepLLM, Node: nodes.NodeTypeClassifier, Prompt: "classify", Response: "bash"})
+	player := NewPlayer(recorded)
+
+	// The prompts sent together are answered in the other order
+	response, err := player.Complete("goal met?")
+	assert.NoError(t, err)
+	assert.Equal(t, "met", response)
+	llmCalls, _ := player.Remaining()
+	assert.Equal(t, 2, llmCalls)
+
+	response, err = player.Complete("verify")
+	assert.NoError(t, err)
+	assert.Equal(t, "done", response)
+
+	response, err = player.Complete("classify again")
+	assert.NoError(t, err)
+	assert.Equal(t, "bash", response)
+	assert.Len(t, player.Divergences(), 1)
+	llmCalls, _ = player.Remaining()
+	assert.Equal(t, 0, llmCalls)
+}
+
+func TestPlayer_BashNode(t *testing.T) {
+	prompt := `Based on the goal, generate a bash command to execute:
+Goal: list files
+Current State: list files
+
+Return JSON response with:
+{
+    "command": "the bash command to execute",
+    "explanation": "why this command was chosen"
+}`
+	recorded := New("run-1", "list files")
+	recorded.AddStep(Step{Kind: StepLLM, Node: nodes.NodeTypeBash, Prompt: prompt, Response: `{"command": "ls", "explanation": "list"}`})
+	recorded.AddStep(Step{Kind: StepCommand, Node: nodes.NodeTypeBash, Command: "ls", Output: "recorded.go"})
+
+	player := NewPlayer(recorded)
+	node := nodes.NewBashNode(player)
+	node.Runner = player.RunCommand
+	state := &nodes.State{Input: "list files", WorkingDirectory: t.TempDir(), CurrentTask: nodes.TaskStatus{Goal: "list files"}}
+
+	result, err := node.Process(state)
+	assert.NoError(t, err)
+	assert.Equal(t, "recorded.go", result)
+	assert.Empty(t, player.Divergences())
+}
@@ -0,0 +1,264 @@
+package transcript
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/report"
+	"aiagent/pkg/schema"
+	"aiagent/pkg/storage"
+)
+
+const (
+	// Collection is the storage collection holding transcripts
+	Collection = "transcripts"
+
+	// SchemaVersion is the current schema version of persisted transcripts
+	SchemaVersion = 1
+)
+
+// ErrNotFound is returned by Store.Load for an unknown run
+var ErrNotFound = errors.New("no transcript found")
+
+// Migrations upgrades transcripts written by older versions of the agent
+// Register a migration here whenever SchemaVersion is increased
+var Migrations = schema.NewMigrator("transcript", SchemaVersion)
+
+// StepKind identifies what a transcript step records
+type StepKind string
+
+const (
+	// StepLLM records a prompt sent to the LLM and its response
+	StepLLM StepKind = "llm"
+
+	// StepCommand records a command executed by the agent
+	StepCommand StepKind = "command"
+)
+
+// Status describes how a run ended
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Step is a single action performed during a run
+type Step struct {
+	Kind     StepKind       `json:"kind"`
+	Node     nodes.NodeType `json:"node"`
+	Time     time.Time      `json:"time"`
+	Prompt   string         `json:"prompt,omitempty"`
+	Response string         `json:"response,omitempty"`
+	Command  string         `json:"command,omitempty"`
+	Output   string         `json:"output,omitempty"`
+	Error    string         `json:"error,omitempty"`
+
+	// Rejected is set for commands that were refused by the command policy and never ran
+	Rejected bool `json:"rejected,omitempty"`
+}
+
+// Transcript records everything that happened during a single run of the agent
+type Transcript struct {
+	SchemaVersion       int       `json:"schema_version"`
+	RunID               string    `json:"run_id"`
+	Session             string    `json:"session,omitempty"`
+	ReplayOf            string    `json:"replay_of,omitempty"`
+	Input               string    `json:"input"`
+	ConversationContext string    `json:"conversation_context,omitempty"`
+	Result              string    `json:"result"`
+	Status              Status    `json:"status"`
+	Error               string    `json:"error,omitempty"`
+	StartedAt           time.Time `json:"started_at"`
+	FinishedAt          time.Time `json:"finished_at,omitempty"`
+	Steps               []Step    `json:"steps"`
+
+	// Prompts maps each prompt template to the version used in the run, to compare runs of different versions
+	Prompts map[string]string `json:"prompts,omitempty"`
+
+	// User is the authenticated user who started the run in server mode
+	User string `json:"user,omitempty"`
+
+	// Report is the execution report of the run: nodes, timings, LLM calls, tokens and cost
+	Report *report.Report `json:"report,omitempty"`
+
+	// Language is the language the answers of the run were written in; empty for English
+	Language string `json:"language,omitempty"`
+
+	// Feedback is the verdict of the user on the run, given with "aiagent feedback"
+	Feedback *Feedback `json:"feedback,omitempty"`
+
+	mu sync.Mutex
+}
+
+// New creates a new transcript for a run that starts now
+func New(runID string, input string) *Transcript {
+	return &Transcript{
+		SchemaVersion: SchemaVersion,
+		RunID:         runID,
+		Input:         input,
+		Status:        StatusRunning,
+		StartedAt:     time.Now(),
+		Steps:         []Step{},
+	}
+}
+
+// NewRunID generates a new unique run identifier
+// IDs start with the start time so that they sort chronologically
+func NewRunID() string {
+	buf := make([]byte, 3)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().UTC().Format("20060102-150405.000000")
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(buf)
+}
+
+// AddStep appends a step to the transcript
+func (t *Transcript) AddStep(step Step) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if step.Time.IsZero() {
+		step.Time = time.Now()
+	}
+	t.Steps = append(t.Steps, step)
+}
+
+// Finish records the outcome of the run
+func (t *Transcript) Finish(result string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Result = result
+	t.FinishedAt = time.Now()
+	t.Status = StatusCompleted
+	if err != nil {
+		t.Status = StatusFailed
+		t.Error = err.Error()
+	}
+}
+
+// Recorder wraps an LLM and records every prompt and response in a transcript
+type Recorder struct {
+	llm        nodes.LLM
+	transcript *Transcript
+
+	mu   sync.Mutex
+	node nodes.NodeType
+}
+
+// NewRecorder creates a new recording wrapper around llm
+func NewRecorder(llm nodes.LLM, transcript *Transcript) *Recorder {
+	return &Recorder{
+		llm:        llm,
+		transcript: transcript,
+	}
+}
+
+// SetNode sets the node that the following LLM calls are attributed to
+func (r *Recorder) SetNode(node nodes.NodeType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.node = node
+}
+
+// currentNode returns the node that LLM calls are currently attributed to
+func (r *Recorder) currentNode() nodes.NodeType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.node
+}
+
+// Complete implements the LLM interface
+func (r *Recorder) Complete(prompt string) (string, error) {
+	response, err := r.llm.Complete(prompt)
+	r.record(prompt, response, err)
+	return response, err
+}
+
+// CompleteStream implements the StreamingLLM interface
+func (r *Recorder) CompleteStream(prompt string, onChunk func(string)) (string, error) {
+	response, err := nodes.CompleteStream(r.llm, prompt, onChunk)
+	r.record(prompt, response, err)
+	return response, err
+}
+
+// record adds an LLM call to the transcript
+func (r *Recorder) record(prompt, response string, err error) {
+	step := Step{
+		Kind:     StepLLM,
+		Node:     r.currentNode(),
+		Prompt:   prompt,
+		Response: response,
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	r.transcript.AddStep(step)
+}
+
+// Store persists transcripts in a storage backend
+type Store struct {
+	store storage.Store
+}
+
+// NewStore creates a new transcript store on top of the given storage
+func NewStore(store storage.Store) *Store {
+	return &Store{
+		store: store,
+	}
+}
+
+// Save persists the transcript
+func (s *Store) Save(t *Transcript) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.SchemaVersion = SchemaVersion
+	if err := s.store.Put(Collection, t.RunID, t); err != nil {
+		return fmt.Errorf("failed to save transcript %s: %v", t.RunID, err)
+	}
+	return nil
+}
+
+// Load reads the transcript of the given run
+func (s *Store) Load(runID string) (*Transcript, error) {
+	var raw json.RawMessage
+	if err := s.store.Get(Collection, runID, &raw); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("%w for run %s", ErrNotFound, runID)
+		}
+		return nil, fmt.Errorf("failed to load transcript %s: %v", runID, err)
+	}
+
+	var t Transcript
+	if err := Migrations.Decode(raw, &t); err != nil {
+		return nil, fmt.Errorf("failed to load transcript %s: %v", runID, err)
+	}
+	return &t, nil
+}
+
+// List returns the most recent transcripts, oldest first
+func (s *Store) List(limit int) ([]*Transcript, error) {
+	records, err := s.store.List(Collection, storage.Query{Limit: limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transcripts: %v", err)
+	}
+
+	transcripts := make([]*Transcript, 0, len(records))
+	for _, record := range records {
+		var t Transcript
+		if err := Migrations.Decode(record.Value, &t); err != nil {
+			return nil, fmt.Errorf("failed to load transcript %s: %v", record.Key, err)
+		}
+		transcripts = append(transcripts, &t)
+	}
+	return transcripts, nil
+}
@@ -0,0 +1,110 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/nodes"
+	"aiagent/pkg/storage"
+)
+
+// fakeLLM returns a fixed response or error
+type fakeLLM struct {
+	response string
+	err      error
+}
+
+func (f *fakeLLM) Complete(prompt string) (string, error) {
+	return f.response, f.err
+}
+
+func newTestTranscript() *Transcript {
+	t := New("run-1", "list files")
+	t.AddStep(Step{Kind: StepLLM, Node: nodes.NodeTypeClassifier, Prompt: "classify: list files", Response: `{"next_node": "bash"}`})
+	t.AddStep(Step{Kind: StepCommand, Node: nodes.NodeTypeBash, Command: "ls", Output: "main.go\ntoken=abcdef123"})
+	t.Finish("main.go", nil)
+	return t
+}
+
+func TestRecorder(t *testing.T) {
+	tr := New("run-1", "hello")
+	recorder := NewRecorder(&fakeLLM{response: "hi"}, tr)
+	recorder.SetNode(nodes.NodeTypeDirectResponse)
+
+	response, err := recorder.Complete("say hi")
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", response)
+
+	recorder = NewRecorder(&fakeLLM{err: errors.New("quota exceeded")}, tr)
+	_, err = recorder.Complete("say hi again")
+	assert.Error(t, err)
+
+	assert.Len(t, tr.Steps, 2)
+	assert.Equal(t, nodes.NodeTypeDirectResponse, tr.Steps[0].Node)
+	assert.Equal(t, "say hi", tr.Steps[0].Prompt)
+	assert.Equal(t, "quota exceeded", tr.Steps[1].Error)
+}
+
+func TestStore_SaveLoad(t *testing.T) {
+	store := NewStore(storage.NewFileStore(t.TempDir()))
+
+	assert.NoError(t, store.Save(newTestTranscript()))
+
+	loaded, err := store.Load("run-1")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCompleted, loaded.Status)
+	assert.Equal(t, "main.go", loaded.Result)
+	assert.Len(t, loaded.Steps, 2)
+
+	_, err = store.Load("missing")
+	assert.Error(t, err)
+
+	transcripts, err := store.List(10)
+	assert.NoError(t, err)
+	assert.Len(t, transcripts, 1)
+}
+
+func TestExport_OpenAIJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, Export(&buf, newTestTranscript(), FormatOpenAIJSONL))
+
+	lines := []map[string][]chatMessage{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string][]chatMessage
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+
+	// One line per step plus the overall conversation
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "user", lines[0]["messages"][0].Role)
+	assert.Equal(t, "classify: list files", lines[0]["messages"][0].Content)
+	assert.Equal(t, "$ ls", lines[1]["messages"][0].Content)
+	assert.NotContains(t, lines[1]["messages"][1].Content, "abcdef123")
+	assert.Equal(t, "main.go", lines[2]["messages"][1].Content)
+}
+
+func TestExport_MarkdownAndHTML(t *testing.T) {
+	var md bytes.Buffer
+	assert.NoError(t, Export(&md, newTestTranscript(), FormatMarkdown))
+	assert.Contains(t, md.String(), "# Run run-1")
+	assert.Contains(t, md.String(), "## Step 2: bash (command)")
+	assert.NotContains(t, md.String(), "abcdef123")
+
+	tr := newTestTranscript()
+	tr.Input = "<script>alert(1)</script>"
+	var page bytes.Buffer
+	assert.NoError(t, Export(&page, tr, FormatHTML))
+	assert.True(t, strings.HasPrefix(page.String(), "<!DOCTYPE html>"))
+	assert.Contains(t, page.String(), "Step 1: classifier (LLM)")
+	assert.NotContains(t, page.String(), "<script>")
+
+	assert.Error(t, Export(&page, tr, Format("pdf")))
+}
@@ -0,0 +1,17 @@
+package truncate
+
+import "unicode/utf8"
+
+// Tail keeps the first limit bytes of text, without cutting a multi-byte character in half
+func Tail(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	return text[:limit]
+}
@@ -0,0 +1,22 @@
+package truncate
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTail(t *testing.T) {
+	assert.Equal(t, "short", Tail("short", 10))
+	assert.Equal(t, "abc", Tail("abcdef", 3))
+	assert.Equal(t, "", Tail("abcdef", 0))
+	assert.Equal(t, "", Tail("abcdef", -1))
+
+	// A character is dropped rather than cut in half
+	got := Tail("x"+strings.Repeat("ü", 10), 4)
+	assert.Equal(t, "xü", got)
+	assert.True(t, utf8.ValidString(got))
+	assert.Equal(t, "", Tail("日本", 2))
+}
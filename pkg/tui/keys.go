@@ -0,0 +1,152 @@
+package tui
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyType identifies a key; printable characters are KeyRunes
+type KeyType int
+
+const (
+	KeyRunes KeyType = iota
+	KeyEnter
+	KeyBackspace
+	KeyTab
+	KeyEsc
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyHome
+	KeyEnd
+	KeyPgUp
+	KeyPgDown
+	KeyCtrlC
+	KeyCtrlD
+	KeyCtrlL
+	KeyCtrlU
+)
+
+// KeyMsg is sent for every key pressed; Runes holds the characters of KeyRunes
+type KeyMsg struct {
+	Type  KeyType
+	Runes []rune
+}
+
+// String returns the characters of a key, or its name for other keys
+func (k KeyMsg) String() string {
+	if k.Type == KeyRunes {
+		return string(k.Runes)
+	}
+	return keyNames[k.Type]
+}
+
+var keyNames = map[KeyType]string{
+	KeyEnter:     "enter",
+	KeyBackspace: "backspace",
+	KeyTab:       "tab",
+	KeyEsc:       "esc",
+	KeyUp:        "up",
+	KeyDown:      "down",
+	KeyLeft:      "left",
+	KeyRight:     "right",
+	KeyHome:      "home",
+	KeyEnd:       "end",
+	KeyPgUp:      "pgup",
+	KeyPgDown:    "pgdown",
+	KeyCtrlC:     "ctrl+c",
+	KeyCtrlD:     "ctrl+d",
+	KeyCtrlL:     "ctrl+l",
+	KeyCtrlU:     "ctrl+u",
+}
+
+// escapeSequences are the sequences sent by terminals for special keys
+var escapeSequences = map[string]KeyType{
+	"\x1b[A":  KeyUp,
+	"\x1b[B":  KeyDown,
+	"\x1b[C":  KeyRight,
+	"\x1b[D":  KeyLeft,
+	"\x1bOA":  KeyUp,
+	"\x1bOB":  KeyDown,
+	"\x1bOC":  KeyRight,
+	"\x1bOD":  KeyLeft,
+	"\x1b[H":  KeyHome,
+	"\x1b[F":  KeyEnd,
+	"\x1b[1~": KeyHome,
+	"\x1b[4~": KeyEnd,
+	"\x1b[5~": KeyPgUp,
+	"\x1b[6~": KeyPgDown,
+}
+
+// controlKeys are the keys sent as single control characters
+var controlKeys = map[byte]KeyType{
+	'\r':   KeyEnter,
+	'\n':   KeyEnter,
+	'\t':   KeyTab,
+	0x7f:   KeyBackspace,
+	0x08:   KeyBackspace,
+	0x03:   KeyCtrlC,
+	0x04:   KeyCtrlD,
+	0x0c:   KeyCtrlL,
+	0x15:   KeyCtrlU,
+	'\x1b': KeyEsc,
+}
+
+// ParseKeys splits the bytes read from a terminal in raw mode into keys; printable
+// characters typed or pasted together are a single KeyRunes, unknown sequences are dropped
+func ParseKeys(data []byte) []KeyMsg {
+	var keys []KeyMsg
+	for len(data) > 0 {
+		if data[0] == '\x1b' && len(data) > 1 {
+			if key, n, known := parseEscape(data); n > 0 {
+				if known {
+					keys = append(keys, KeyMsg{Type: key})
+				}
+				data = data[n:]
+				continue
+			}
+		}
+		if key, ok := controlKeys[data[0]]; ok {
+			keys = append(keys, KeyMsg{Type: key})
+			data = data[1:]
+			continue
+		}
+		if data[0] < 0x20 {
+			data = data[1:] // other control characters
+			continue
+		}
+
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		if r == utf8.RuneError {
+			continue
+		}
+		if n := len(keys); n > 0 && keys[n-1].Type == KeyRunes {
+			keys[n-1].Runes = append(keys[n-1].Runes, r)
+		} else {
+			keys = append(keys, KeyMsg{Type: KeyRunes, Runes: []rune{r}})
+		}
+	}
+	return keys
+}
+
+// parseEscape returns the length of the escape sequence at the start of data, 0 if there
+// is none, and the key it stands for if it is known
+func parseEscape(data []byte) (key KeyType, n int, known bool) {
+	for seq, key := range escapeSequences {
+		if strings.HasPrefix(string(data), seq) {
+			return key, len(seq), true
+		}
+	}
+	if data[1] != '[' {
+		return 0, 0, false
+	}
+	// Other CSI sequences: parameters, then a final byte in 0x40-0x7e
+	for i := 2; i < len(data); i++ {
+		if data[i] >= 0x40 && data[i] <= 0x7e {
+			return 0, i + 1, false
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,37 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []KeyMsg
+	}{
+		{"runes are merged", "héllo", []KeyMsg{{Type: KeyRunes, Runes: []rune("héllo")}}},
+		{"control keys", "a\r\x7f\x03", []KeyMsg{
+			{Type: KeyRunes, Runes: []rune("a")},
+			{Type: KeyEnter},
+			{Type: KeyBackspace},
+			{Type: KeyCtrlC},
+		}},
+		{"escape sequences", "\x1b[A\x1b[5~\x1bOB", []KeyMsg{{Type: KeyUp}, {Type: KeyPgUp}, {Type: KeyDown}}},
+		{"lone escape", "\x1b", []KeyMsg{{Type: KeyEsc}}},
+		{"unknown sequences are dropped", "\x1b[1;5Cx", []KeyMsg{{Type: KeyRunes, Runes: []rune("x")}}},
+		{"other control characters are dropped", "\x01x", []KeyMsg{{Type: KeyRunes, Runes: []rune("x")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseKeys([]byte(tt.data)))
+		})
+	}
+}
+
+func TestKeyMsg_String(t *testing.T) {
+	assert.Equal(t, "ab", KeyMsg{Type: KeyRunes, Runes: []rune("ab")}.String())
+	assert.Equal(t, "ctrl+c", KeyMsg{Type: KeyCtrlC}.String())
+}
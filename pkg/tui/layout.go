@@ -0,0 +1,114 @@
+package tui
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Wrap splits text into lines of at most width characters, breaking at spaces where
+// possible; tabs are expanded and other control characters are dropped
+func Wrap(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var lines []string
+	for _, paragraph := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line := []rune(sanitize(paragraph))
+		for len(line) > width {
+			cut := width
+			if i := lastSpace(line[:width+1]); i > 0 {
+				cut = i
+			}
+			lines = append(lines, strings.TrimRight(string(line[:cut]), " "))
+			line = []rune(strings.TrimLeft(string(line[cut:]), " "))
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+func lastSpace(line []rune) int {
+	for i := len(line) - 1; i > 0; i-- {
+		if line[i] == ' ' {
+			return i
+		}
+	}
+	return -1
+}
+
+// sanitize expands tabs and drops the control characters that would move the cursor
+func sanitize(line string) string {
+	line = strings.ReplaceAll(line, "\t", "    ")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// Fit cuts or pads a line to exactly width characters
+func Fit(line string, width int) string {
+	n := utf8.RuneCountInString(line)
+	if n > width {
+		runes := []rune(line)
+		if width > 1 {
+			return string(runes[:width-1]) + "…"
+		}
+		return string(runes[:width])
+	}
+	return line + strings.Repeat(" ", width-n)
+}
+
+// Box draws lines in a box with a border and a title, width and height characters large
+// including the border; when there are more lines than fit, the last ones are shown,
+// skipping the last scroll lines
+func Box(title string, lines []string, width, height, scroll int) []string {
+	if width < 4 || height < 2 {
+		return make([]string, max(height, 0))
+	}
+	inner := width - 2
+	rows := height - 2
+
+	end := max(len(lines)-scroll, 0)
+	start := max(end-rows, 0)
+	visible := lines[start:end]
+
+	top := "─ " + title + " "
+	if utf8.RuneCountInString(top) > inner {
+		top = Fit(top, inner)
+	}
+	box := []string{"┌" + top + strings.Repeat("─", inner-utf8.RuneCountInString(top)) + "┐"}
+	for i := 0; i < rows; i++ {
+		line := ""
+		if i < len(visible) {
+			line = visible[i]
+		}
+		box = append(box, "│"+Fit(line, inner)+"│")
+	}
+	return append(box, "└"+strings.Repeat("─", inner)+"┘")
+}
+
+// JoinHorizontal places blocks of lines side by side; every line of a block must have
+// the same width, and shorter blocks are padded with spaces
+func JoinHorizontal(blocks ...[]string) []string {
+	height := 0
+	for _, block := range blocks {
+		height = max(height, len(block))
+	}
+	lines := make([]string, height)
+	for _, block := range blocks {
+		width := 0
+		if len(block) > 0 {
+			width = utf8.RuneCountInString(block[0])
+		}
+		for i := range lines {
+			if i < len(block) {
+				lines[i] += block[i]
+			} else {
+				lines[i] += strings.Repeat(" ", width)
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,39 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrap(t *testing.T) {
+	assert.Equal(t, []string{"the quick", "brown fox"}, Wrap("the quick brown fox", 10))
+	assert.Equal(t, []string{"abcde", "fgh"}, Wrap("abcdefgh", 5))
+	assert.Equal(t, []string{"a", "", "b"}, Wrap("a\n\nb\n", 5))
+	assert.Equal(t, []string{"    x"}, Wrap("\tx\x1b", 10))
+}
+
+func TestFit(t *testing.T) {
+	assert.Equal(t, "ab  ", Fit("ab", 4))
+	assert.Equal(t, "abc…", Fit("abcdef", 4))
+	assert.Equal(t, "ab", Fit("ab", 2))
+}
+
+func TestBox(t *testing.T) {
+	box := Box("T", []string{"1", "2", "3"}, 6, 4, 0)
+	assert.Equal(t, []string{
+		"┌─ T ┐",
+		"│2   │",
+		"│3   │",
+		"└────┘",
+	}, box)
+
+	box = Box("T", []string{"1", "2", "3"}, 6, 4, 1)
+	assert.Equal(t, "│1   │", box[1])
+	assert.Equal(t, "│2   │", box[2])
+}
+
+func TestJoinHorizontal(t *testing.T) {
+	lines := JoinHorizontal([]string{"ab", "cd", "ef"}, []string{"1"})
+	assert.Equal(t, []string{"ab1", "cd ", "ef "}, lines)
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package tui
+
+import (
+	"errors"
+	"os"
+)
+
+// errUnsupported is returned on platforms where raw mode is not implemented
+var errUnsupported = errors.New("terminal control is only supported on Linux")
+
+// isTerminal reports false, so programs run without raw mode
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errUnsupported
+}
+
+func windowSize(fd int) (int, int, error) {
+	return 0, 0, errUnsupported
+}
+
+func notifyResize(c chan<- os.Signal) {}
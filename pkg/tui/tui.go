@@ -0,0 +1,198 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+)
+
+// Default size of the screen when the output is not a terminal
+const (
+	DefaultWidth  = 80
+	DefaultHeight = 24
+)
+
+// Escape sequences of the terminal
+const (
+	enterAltScreen = "\x1b[?1049h"
+	exitAltScreen  = "\x1b[?1049l"
+	hideCursor     = "\x1b[?25l"
+	showCursor     = "\x1b[?25h"
+	cursorHome     = "\x1b[H"
+	clearLine      = "\x1b[K"
+	clearBelow     = "\x1b[J"
+)
+
+// Msg is a message passed to the Update method of a model: a key, a new window size,
+// or any value sent by the application with Program.Send
+type Msg any
+
+// Cmd is run in its own goroutine after an update; the message it returns, if not nil,
+// is passed to the model
+type Cmd func() Msg
+
+// Model is the state of an application in the style of the Elm architecture: Update
+// returns the new state for a message, and View renders the state as the whole screen
+type Model interface {
+	Update(msg Msg) (Model, Cmd)
+	View() string
+}
+
+// WindowSizeMsg is sent when the program starts and whenever the terminal is resized
+type WindowSizeMsg struct {
+	Width  int
+	Height int
+}
+
+// QuitMsg stops the program
+type QuitMsg struct{}
+
+// Quit is a Cmd stopping the program
+func Quit() Msg {
+	return QuitMsg{}
+}
+
+// Program runs a model full-screen: it reads keys from its input in raw mode and redraws
+// the output after every message
+type Program struct {
+	model Model
+	in    io.Reader
+	out   io.Writer
+
+	msgs chan Msg
+	done chan struct{}
+	once sync.Once
+}
+
+// NewProgram creates a program running model, reading keys from in and drawing on out
+// The terminal is switched to raw mode only if in is a terminal
+func NewProgram(model Model, in io.Reader, out io.Writer) *Program {
+	return &Program{
+		model: model,
+		in:    in,
+		out:   out,
+		msgs:  make(chan Msg, 64),
+		done:  make(chan struct{}),
+	}
+}
+
+// Send passes a message to the model; it may be called from any goroutine and does
+// nothing once the program has stopped
+func (p *Program) Send(msg Msg) {
+	select {
+	case p.msgs <- msg:
+	case <-p.done:
+	}
+}
+
+// Run runs the program until the model returns Quit, and returns the final model
+func (p *Program) Run() (Model, error) {
+	defer p.once.Do(func() { close(p.done) })
+
+	width, height := DefaultWidth, DefaultHeight
+	if file, ok := p.in.(*os.File); ok && isTerminal(int(file.Fd())) {
+		restore, err := makeRaw(int(file.Fd()))
+		if err != nil {
+			return p.model, fmt.Errorf("failed to switch the terminal to raw mode: %v", err)
+		}
+		defer restore()
+		if w, h, err := windowSize(int(file.Fd())); err == nil {
+			width, height = w, h
+		}
+
+		resized := make(chan os.Signal, 1)
+		notifyResize(resized)
+		defer signal.Stop(resized)
+		go func() {
+			for {
+				select {
+				case <-resized:
+					if w, h, err := windowSize(int(file.Fd())); err == nil {
+						p.Send(WindowSizeMsg{Width: w, Height: h})
+					}
+				case <-p.done:
+					return
+				}
+			}
+		}()
+	}
+
+	out := bufio.NewWriter(p.out)
+	fmt.Fprint(out, enterAltScreen+hideCursor)
+	defer func() {
+		fmt.Fprint(out, showCursor+exitAltScreen)
+		out.Flush()
+	}()
+
+	go p.readKeys()
+
+	model := p.model
+	p.msgs <- WindowSizeMsg{Width: width, Height: height}
+	last := ""
+	for msg := range p.msgs {
+		if _, ok := msg.(QuitMsg); ok {
+			break
+		}
+		var cmd Cmd
+		model, cmd = model.Update(msg)
+		if cmd != nil {
+			go func() {
+				if msg := cmd(); msg != nil {
+					p.Send(msg)
+				}
+			}()
+		}
+
+		// Messages are drawn in batches, so bursts of events do not redraw every time
+		if len(p.msgs) > 0 {
+			continue
+		}
+		if frame := model.View(); frame != last {
+			render(out, frame)
+			last = frame
+		}
+		if err := out.Flush(); err != nil {
+			return model, fmt.Errorf("failed to draw: %v", err)
+		}
+	}
+	return model, nil
+}
+
+// readKeys passes the keys read from the input to the model until the input ends
+func (p *Program) readKeys() {
+	buf := make([]byte, 256)
+	for {
+		n, err := p.in.Read(buf)
+		for _, key := range ParseKeys(buf[:n]) {
+			p.Send(key)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// render redraws the screen with frame, clearing what is left of the previous one
+func render(w io.Writer, frame string) {
+	lines := strings.Split(frame, "\n")
+	var sb strings.Builder
+	sb.WriteString(cursorHome)
+	for i, line := range lines {
+		if i > 0 {
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString(line)
+		sb.WriteString(clearLine)
+	}
+	sb.WriteString(clearBelow)
+	io.WriteString(w, sb.String())
+}
+
+// IsTerminal reports whether f is a terminal in which a program can run full-screen
+func IsTerminal(f *os.File) bool {
+	return isTerminal(int(f.Fd()))
+}
@@ -0,0 +1,75 @@
+package tui
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoModel shows the typed text and quits on enter
+type echoModel struct {
+	text  string
+	width int
+}
+
+func (m echoModel) Update(msg Msg) (Model, Cmd) {
+	switch msg := msg.(type) {
+	case WindowSizeMsg:
+		m.width = msg.Width
+	case KeyMsg:
+		if msg.Type == KeyEnter {
+			return m, Quit
+		}
+		m.text += msg.String()
+	case string:
+		m.text += msg
+	}
+	return m, nil
+}
+
+func (m echoModel) View() string {
+	return "text: " + m.text
+}
+
+func TestProgram_Run(t *testing.T) {
+	in, keys := io.Pipe()
+	var out bytes.Buffer
+	program := NewProgram(echoModel{}, in, &out)
+
+	done := make(chan Model, 1)
+	go func() {
+		model, err := program.Run()
+		assert.NoError(t, err)
+		done <- model
+	}()
+
+	program.Send("sent ")
+	_, err := keys.Write([]byte("typed"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = keys.Write([]byte("\r"))
+	require.NoError(t, err)
+
+	select {
+	case model := <-done:
+		final := model.(echoModel)
+		assert.Equal(t, "sent typed", final.text)
+		assert.Equal(t, DefaultWidth, final.width)
+	case <-time.After(5 * time.Second):
+		t.Fatal("program did not quit")
+	}
+
+	screen := out.String()
+	assert.True(t, strings.HasPrefix(screen, enterAltScreen+hideCursor))
+	assert.True(t, strings.HasSuffix(screen, showCursor+exitAltScreen))
+	assert.Contains(t, screen, cursorHome+"text: sent typed"+clearLine)
+
+	// Send does not block once the program stopped
+	program.Send("late")
+	keys.Close()
+}
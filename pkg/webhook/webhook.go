@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"aiagent/pkg/events"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the body as sha256=<hex> when a secret is set
+	SignatureHeader = "X-Aiagent-Signature"
+
+	// DefaultTimeout limits a single delivery attempt
+	DefaultTimeout = 10 * time.Second
+
+	// attempts is the number of deliveries tried before a callback is given up
+	attempts = 3
+)
+
+// Payload is the JSON body posted to the callback URL when a run finishes
+type Payload struct {
+	RunID    string        `json:"run_id"`
+	Session  string        `json:"session,omitempty"`
+	Input    string        `json:"input"`
+	Status   string        `json:"status"`
+	Result   string        `json:"result,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+
+	// Cost is the cost of the run in USD; it is missing when the model price is unknown
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+// Notifier posts a Payload to a callback URL for every finished run
+// It subscribes to the event bus and takes the input of a run from its run_started event
+type Notifier struct {
+	URL    string
+	Secret string
+	client *http.Client
+	retry  time.Duration
+
+	mu      sync.Mutex
+	started map[string]*events.RunStarted
+}
+
+// NewNotifier creates a new instance of Notifier; the payloads are signed when secret is not empty
+func NewNotifier(url, secret string, timeout time.Duration) *Notifier {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Notifier{
+		URL:     url,
+		Secret:  secret,
+		client:  &http.Client{Timeout: timeout},
+		retry:   time.Second,
+		started: make(map[string]*events.RunStarted),
+	}
+}
+
+// Handle implements the events.Subscriber interface
+// The callback is delivered before Handle returns, so a command line run does not exit before it
+func (n *Notifier) Handle(event events.Event) {
+	switch e := event.(type) {
+	case *events.RunStarted:
+		n.mu.Lock()
+		n.started[e.RunID] = e
+		n.mu.Unlock()
+	case *events.RunFinished:
+		n.mu.Lock()
+		started := n.started[e.RunID]
+		delete(n.started, e.RunID)
+		n.mu.Unlock()
+
+		payload := Payload{
+			RunID:    e.RunID,
+			Status:   "completed",
+			Result:   e.Result,
+			Error:    e.Error,
+			Duration: e.Duration,
+			Cost:     e.Cost,
+		}
+		if e.Error != "" {
+			payload.Status = "failed"
+		}
+		if started != nil {
+			payload.Session = started.Session
+			payload.Input = started.Input
+		}
+		if err := n.Send(payload); err != nil {
+			slog.Warn("failed to deliver run callback", "run_id", e.RunID, "url", n.URL, "error", err)
+		}
+	}
+}
+
+// Send posts the payload to the callback URL, retrying failed deliveries
+func (n *Notifier) Send(payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %v", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = n.post(body)
+		if err == nil || attempt == attempts {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * n.retry)
+	}
+}
+
+func (n *Notifier) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send callback: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("callback returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Sign returns the signature of body in the format of SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body, for receivers written in Go
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
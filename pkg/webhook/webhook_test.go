@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"aiagent/pkg/events"
+)
+
+func TestNotifier(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	bus := events.NewBus()
+	bus.Subscribe(NewNotifier(server.URL, "secret", 0))
+	publisher := bus.ForRun("run-1")
+	publisher.Publish(&events.RunStarted{Session: "ci", Input: "run the tests"})
+	cost := 0.25
+	publisher.Publish(&events.RunFinished{Result: "all tests pass", Duration: time.Second, Cost: &cost})
+
+	var payload Payload
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, Payload{
+		RunID:    "run-1",
+		Session:  "ci",
+		Input:    "run the tests",
+		Status:   "completed",
+		Result:   "all tests pass",
+		Duration: time.Second,
+		Cost:     &cost,
+	}, payload)
+	assert.True(t, Verify("secret", body, signature))
+	assert.False(t, Verify("other", body, signature))
+}
+
+func TestNotifier_FailedRunWithoutSecret(t *testing.T) {
+	var payload Payload
+	var signed bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+		signed = r.Header.Get(SignatureHeader) != ""
+	}))
+	defer server.Close()
+
+	bus := events.NewBus()
+	bus.Subscribe(NewNotifier(server.URL, "", 0))
+	bus.ForRun("run-2").Publish(&events.RunFinished{Error: "llm unavailable"})
+
+	assert.Equal(t, "failed", payload.Status)
+	assert.Equal(t, "llm unavailable", payload.Error)
+	assert.Nil(t, payload.Cost)
+	assert.False(t, signed)
+}
+
+func TestNotifier_Retry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < attempts {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier(server.URL, "", 0)
+	notifier.retry = time.Millisecond
+	assert.NoError(t, notifier.Send(Payload{RunID: "run-3"}))
+	assert.Equal(t, int32(attempts), calls.Load())
+
+	calls.Store(-10)
+	assert.ErrorContains(t, notifier.Send(Payload{RunID: "run-3"}), "callback returned 503: busy")
+}
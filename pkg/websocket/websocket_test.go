@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newEchoServer starts a server echoing every message
+func newEchoServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(message)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example of RFC 6455 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", acceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestEcho(t *testing.T) {
+	server := newEchoServer(t)
+	conn, err := Dial(wsURL(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, message := range []string{"hello", strings.Repeat("a", 200), strings.Repeat("b", 70000)} {
+		assert.NoError(t, conn.WriteMessage([]byte(message)))
+		got, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, message, string(got))
+	}
+
+	assert.NoError(t, conn.WriteJSON(map[string]string{"type": "ping"}))
+	var got map[string]string
+	assert.NoError(t, conn.ReadJSON(&got))
+	assert.Equal(t, "ping", got["type"])
+}
+
+func TestPingAndClose(t *testing.T) {
+	server := newEchoServer(t)
+	conn, err := Dial(wsURL(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, conn.writeFrame(opPing, []byte("are you there")))
+	_, opcode, payload, err := conn.readFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(opPong), opcode)
+	assert.Equal(t, "are you there", string(payload))
+
+	assert.NoError(t, conn.writeFrame(opClose, []byte{0x03, 0xe8}))
+	_, err = conn.ReadMessage()
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestUpgrade_Refused(t *testing.T) {
+	server := newEchoServer(t)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"no upgrade", map[string]string{}, http.StatusBadRequest},
+		{"old version", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": "a2V5"}, http.StatusUpgradeRequired},
+		{"no key", map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13"}, http.StatusBadRequest},
+		{"other origin", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "a2V5", "Origin": "http://evil.example"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}